@@ -5,9 +5,19 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
 
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,30 +31,160 @@ type WSConnection interface {
 	Close() error
 }
 
-func DefaultConnectionFactory(url string, origin string) (WSConnection, error) {
-	logger.WithField("url", url).Info("Connecting to")
+// maxRedirects is the number of redirects followed when connecting, e.g. to the home node of the user in a cluster.
+const maxRedirects = 3
 
-	header := http.Header{"Origin": []string{origin}}
-	conn, _, err := websocket.DefaultDialer.Dial(url, header)
-	if err != nil {
-		return nil, err
+// closeTimeout is the maximum duration of sending the close message when closing a connection.
+const closeTimeout = time.Second
+
+// maxPendingChunkedMessages is the maximum number of messages being received in chunks at once.
+const maxPendingChunkedMessages = 16
+
+// The delays between the reconnection attempts of the clients with auto-reconnect grow exponentially,
+// from ReconnectMinBackoff to ReconnectMaxBackoff.
+var (
+	ReconnectMinBackoff = 25 * time.Millisecond
+	ReconnectMaxBackoff = 10 * time.Second
+)
+
+// FetchTimeout is the maximum duration of waiting for the end of a Fetch.
+var FetchTimeout = 30 * time.Second
+
+// errNotConnected is returned when writing before the first connection of the client.
+var errNotConnected = errors.New("the client is not connected")
+
+// DialConfig configures the websocket connections: the TLS of the wss:// URLs, and the authentication of the handshakes.
+type DialConfig struct {
+	// TLSConfig is used for the wss:// URLs, e.g. with the CAs of the server or a client certificate (the default if nil)
+	TLSConfig *tls.Config
+	// Token is sent as a bearer token in the Authorization header, if not empty
+	Token string
+	// Header is added to the headers of the handshakes, e.g. with an API key
+	Header http.Header
+	// Will is published by the server if the connection drops without being closed by the client (if not nil)
+	Will *Will
+	// RESTURL is the URL of the REST API of the server (e.g. http://localhost:8080/api), used to publish and receive
+	// the messages when the websocket can not be established, if not empty (see restConnection)
+	RESTURL string
+	// Protobuf asks the server to send the messages in the protobuf encoding, which is faster to parse than the text one
+	Protobuf bool
+	// ChunkSize is the size above which the bodies of the messages are sent in chunks, by the server and by the client
+	// (not if 0), so that large bodies are not sent in one frame
+	ChunkSize int
+}
+
+func (config DialConfig) header(origin string) http.Header {
+	header := http.Header{}
+	for name, values := range config.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Origin", origin)
+	if config.Token != "" {
+		header.Set("Authorization", "Bearer "+config.Token)
+	}
+	if config.Will != nil {
+		header.Set(protocol.WillTopicHeader, config.Will.Topic)
+		header.Set(protocol.WillMessageHeader, config.Will.Body)
+	}
+	if config.Protobuf {
+		header.Set(protocol.EncodingHeader, protocol.EncodingProtobuf)
+	}
+	if config.ChunkSize > 0 {
+		header.Set(protocol.ChunkSizeHeader, strconv.Itoa(config.ChunkSize))
+	}
+	return header
+}
+
+// Will is a last-will message, which the server publishes to its topic if the connection drops uncleanly,
+// e.g. to tell the other clients that the client went offline. It is registered again on each reconnection.
+type Will struct {
+	Topic string
+	// Body is sent in a header of the handshakes, so it can not have line breaks
+	Body string
+}
+
+// wsConnection sends a close message before closing the websocket, so that the server knows
+// that the connection was closed by the client, and does not publish its will.
+type wsConnection struct {
+	*websocket.Conn
+}
+
+func (conn wsConnection) Close() error {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(closeTimeout))
+	return conn.Conn.Close()
+}
+
+// NewConnectionFactory returns a connection factory dialing with the config.
+func NewConnectionFactory(config DialConfig) WSConnectionFactory {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		TLSClientConfig:  config.TLSConfig,
+	}
+	return func(url string, origin string) (WSConnection, error) {
+		logger.WithField("url", url).Info("Connecting to")
+
+		header := config.header(origin)
+		conn, resp, err := dialer.Dial(url, header)
+		for redirects := 0; err == websocket.ErrBadHandshake && isRedirect(resp) && redirects < maxRedirects; redirects++ {
+			url = resp.Header.Get("Location")
+			logger.WithField("url", url).Info("Redirected to")
+			conn, resp, err = dialer.Dial(url, header)
+		}
+		if err != nil && config.RESTURL != "" {
+			logger.WithError(err).WithField("restURL", config.RESTURL).Warn("Falling back to the REST API")
+			return newRESTConnection(config, url, origin)
+		}
+		if err != nil {
+			return nil, err
+		}
+		logger.WithField("url", url).Info("Connected to")
+
+		return wsConnection{conn}, nil
 	}
-	logger.WithField("url", url).Info("Connected to")
+}
+
+func DefaultConnectionFactory(url string, origin string) (WSConnection, error) {
+	return NewConnectionFactory(DialConfig{})(url, origin)
+}
 
-	return conn, nil
+func isRedirect(resp *http.Response) bool {
+	return resp != nil &&
+		(resp.StatusCode == http.StatusTemporaryRedirect || resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusFound) &&
+		resp.Header.Get("Location") != ""
 }
 
 type WSConnectionFactory func(url string, origin string) (WSConnection, error)
 
 type Client interface {
 	Start() error
+	StartContext(ctx context.Context) error
 	Close()
 
 	Subscribe(path string) error
+	SubscribeFrom(topic string, since int64) error
+	SubscribeWithFilters(path string, filters map[string]string) error
+	SubscribeFunc(path string, handler MessageHandler, onError ErrorHandler) error
+	SubscribeContext(ctx context.Context, path string) (Subscription, error)
+	OpenSubscription(path string) (Subscription, error)
 	Unsubscribe(path string) error
 
+	Fetch(topic string, since int64, limit int) ([]*protocol.Message, error)
+	FetchContext(ctx context.Context, topic string, since int64, limit int) ([]*protocol.Message, error)
+
 	Send(path string, body string, header string) error
+	SendContext(ctx context.Context, path string, body string, header string) error
+	SendAndWait(path string, body string, timeout time.Duration) (uint64, error)
+	SendAndWaitContext(ctx context.Context, path string, body string) (uint64, error)
 	SendBytes(path string, body []byte, header string) error
+	SendBinary(path string, body []byte, contentType string) error
+	SendContent(path string, body []byte, contentType string, contentEncoding string) error
+	SendWithPriority(path string, body string, priority protocol.Priority) error
+	Request(topic string, body string, timeout time.Duration) (*protocol.Message, error)
+	RequestContext(ctx context.Context, topic string, body string) (*protocol.Message, error)
+	Reply(request *protocol.Message, body string) error
+	Presence(userIDs ...string) (PresenceWatch, error)
 
 	WriteRawMessage(message []byte) error
 	Messages() chan *protocol.Message
@@ -52,23 +192,55 @@ type Client interface {
 	Errors() chan *protocol.NotificationMessage
 
 	SetWSConnectionFactory(WSConnectionFactory)
+	SetHooks(Hooks)
+	SetOfflineQueue(size int, policy OverflowPolicy)
+	SetChunkSize(size int)
+	AddEventListener(EventListener)
 	IsConnected() bool
+	QueueDepth() int
 }
 
 type client struct {
-	mu                  sync.RWMutex
-	ws                  WSConnection
+	mu sync.RWMutex
+	// the current connection, replaced on each reconnection (guarded by mu)
+	ws WSConnection
+	// writeMu serializes the writes to the connection, which supports only one concurrent writer
+	writeMu sync.Mutex
+
 	messages            chan *protocol.Message
 	statusMessages      chan *protocol.NotificationMessage
 	errors              chan *protocol.NotificationMessage
 	url                 string
 	origin              string
 	shouldStopChan      chan bool
+	closed              chan bool
+	closeOnce           sync.Once
 	shouldStopFlag      bool
 	autoReconnect       bool
 	wSConnectionFactory func(url string, origin string) (WSConnection, error)
 	// flag, to indicate if the client is connected
 	connected bool
+	// subscriptions are subscribed again after a reconnection, by their path
+	subscriptions map[string]*subscription
+	// the running fetches, by their topic
+	fetches map[string]*fetch
+	// the sent messages waiting for their receipt, by their publisherMessageId
+	receipts   map[string]chan *protocol.NotificationMessage
+	lastSendID uint64
+	hooks      Hooks
+	// the queue of the messages sent while disconnected, if enabled
+	offlineQueue   *offlineQueue
+	eventListeners []EventListener
+	// the size above which the bodies of the sent messages are split in chunks, if any
+	chunkSize int
+	// reassembler reassembles the messages received in chunks
+	reassembler *protocol.Reassembler
+}
+
+// fetch collects the messages of a fetch command, until the server signals its end.
+type fetch struct {
+	messages []*protocol.Message
+	done     chan bool
 }
 
 // Open is a shortcut for New() and Start()
@@ -78,6 +250,14 @@ func Open(url, origin string, channelSize int, autoReconnect bool) (Client, erro
 	return c, c.Start()
 }
 
+// OpenWithConfig is like Open, but connects with the config, e.g. to wss:// URLs with a token.
+func OpenWithConfig(url, origin string, channelSize int, autoReconnect bool, config DialConfig) (Client, error) {
+	c := New(url, origin, channelSize, autoReconnect)
+	c.SetWSConnectionFactory(NewConnectionFactory(config))
+	c.SetChunkSize(config.ChunkSize)
+	return c, c.Start()
+}
+
 // New creates a new client, without starting the connection
 func New(url, origin string, channelSize int, autoReconnect bool) Client {
 	return &client{
@@ -87,7 +267,12 @@ func New(url, origin string, channelSize int, autoReconnect bool) Client {
 		url:            url,
 		origin:         origin,
 		shouldStopChan: make(chan bool, 1),
+		closed:         make(chan bool),
 		autoReconnect:  autoReconnect,
+		subscriptions:  make(map[string]*subscription),
+		fetches:        make(map[string]*fetch),
+		receipts:       make(map[string]chan *protocol.NotificationMessage),
+		reassembler:    &protocol.Reassembler{MaxPending: maxPendingChunkedMessages},
 	}
 }
 
@@ -95,12 +280,177 @@ func (c *client) SetWSConnectionFactory(connection WSConnectionFactory) {
 	c.wSConnectionFactory = connection
 }
 
+// SetOfflineQueue enables the queuing of at most size messages sent while disconnected (disabled if 0),
+// which are sent in order once connected again, with the policy deciding which message is dropped when it is full.
+// A client with an offline queue should be started with auto-reconnect.
+func (c *client) SetOfflineQueue(size int, policy OverflowPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if size <= 0 {
+		c.offlineQueue = nil
+		return
+	}
+	c.offlineQueue = &offlineQueue{size: size, policy: policy}
+}
+
+// SetChunkSize sends the bodies larger than size in chunks (not if 0), which the server reassembles.
+func (c *client) SetChunkSize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.chunkSize = size
+}
+
+// frames returns the send command, or the commands sending the chunks of its body if it is larger than the chunk size.
+func (c *client) frames(cmd *protocol.Cmd) ([][]byte, error) {
+	c.mu.RLock()
+	size := c.chunkSize
+	c.mu.RUnlock()
+	if size <= 0 || len(cmd.Body) <= size {
+		return [][]byte{cmd.Bytes()}, nil
+	}
+	msg := &protocol.Message{HeaderJSON: cmd.HeaderJSON, Body: cmd.Body}
+	chunks, err := msg.Split(size, xid.New().String())
+	if err != nil {
+		return nil, err
+	}
+	frames := make([][]byte, 0, len(chunks))
+	for _, chunk := range chunks {
+		frames = append(frames, (&protocol.Cmd{
+			Name:       cmd.Name,
+			Arg:        cmd.Arg,
+			HeaderJSON: chunk.HeaderJSON,
+			Body:       chunk.Body,
+		}).Bytes())
+	}
+	return frames, nil
+}
+
+func (c *client) getOfflineQueue() *offlineQueue {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.offlineQueue
+}
+
+// AddEventListener adds a listener notified of the state changes of the client and of its subscriptions.
+func (c *client) AddEventListener(l EventListener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.eventListeners = append(c.eventListeners, l)
+}
+
+func (c *client) emit(e Event) {
+	c.mu.RLock()
+	listeners := c.eventListeners
+	c.mu.RUnlock()
+	for _, l := range listeners {
+		l.OnEvent(e)
+	}
+}
+
+// lost emits the loss of the connection, and of all the subscriptions, which are resumed once reconnected.
+func (c *client) lost(err error) {
+	c.emit(Event{Type: EventDisconnected, Err: err})
+
+	c.mu.Lock()
+	paths := make([]string, 0, len(c.subscriptions))
+	for path, s := range c.subscriptions {
+		s.resuming = true
+		paths = append(paths, path)
+	}
+	c.mu.Unlock()
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		c.emit(Event{Type: EventSubscriptionLost, Path: path, Err: err})
+	}
+}
+
+// subscriptionChanged emits the confirmations and the refusals of the subscriptions by the server.
+func (c *client) subscriptionChanged(n *protocol.NotificationMessage) {
+	args := strings.SplitN(n.Arg, " ", 2)
+	path := args[0]
+	switch n.Name {
+	case protocol.SUCCESS_SUBSCRIBED_TO:
+		eventType := EventSubscribed
+		c.mu.Lock()
+		if s, exists := c.subscriptions[path]; exists {
+			s.confirm()
+			if s.resuming {
+				s.resuming = false
+				eventType = EventResumed
+			}
+		}
+		c.mu.Unlock()
+		c.emit(Event{Type: eventType, Path: path})
+	case protocol.ERROR_SUBSCRIBED_TO:
+		var err error
+		if len(args) > 1 {
+			err = errors.New(args[1])
+		}
+		c.emit(Event{Type: EventSubscriptionLost, Path: path, Err: err})
+	}
+}
+
+// SetHooks sets the hooks called on the events of the client.
+func (c *client) SetHooks(hooks Hooks) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = hooks
+}
+
+func (c *client) getHooks() Hooks {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.hooks
+}
+
+// QueueDepth returns the number of received messages not read yet, on the Messages channel and on the ones
+// of the logical subscriptions.
+func (c *client) QueueDepth() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	depth := len(c.messages)
+	for _, s := range c.subscriptions {
+		for _, l := range s.listeners {
+			depth += len(l.messageC)
+		}
+	}
+	return depth
+}
+
 func (c *client) IsConnected() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.connected
 }
 
+// conn returns the current connection, or nil before the first one.
+func (c *client) conn() WSConnection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ws
+}
+
+func (c *client) setConn(ws WSConnection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ws != nil {
+		c.ws = ws
+	}
+}
+
+// write sends the message on the current connection. All the writes go through it,
+// since the websocket connections do not support concurrent writers.
+func (c *client) write(message []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	ws := c.conn()
+	if ws == nil {
+		return errNotConnected
+	}
+	return ws.WriteMessage(websocket.BinaryMessage, message)
+}
+
 func (c *client) setIsConnected(connected bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -111,19 +461,62 @@ func (c *client) setIsConnected(connected bool) {
 // If an error occurs on first connect, it will be returned.
 // Further connection errors will only be logged.
 func (c *client) Start() error {
-	var err error
-	c.ws, err = c.wSConnectionFactory(c.url, c.origin)
+	return c.StartContext(context.Background())
+}
+
+// StartContext is like Start, but gives up the first connection when the context is done,
+// without reconnecting.
+func (c *client) StartContext(ctx context.Context) error {
+	ws, err := c.connect(ctx)
+	c.setConn(ws)
 	c.setIsConnected(err == nil)
 
-	if c.IsConnected() {
-		go c.readLoop()
-	} else if c.autoReconnect {
+	if err != nil && err == ctx.Err() {
+		return err
+	}
+	if err == nil {
+		c.emit(Event{Type: EventConnected})
+	}
+	if c.autoReconnect {
 		go c.startWithReconnect()
+	} else if c.IsConnected() {
+		go c.readLoop()
 	}
 	return err
 }
 
+// connect returns a new connection, or the error of the context if it is done first
+// (the connection is then closed when established).
+func (c *client) connect(ctx context.Context) (WSConnection, error) {
+	if ctx.Done() == nil {
+		return c.wSConnectionFactory(c.url, c.origin)
+	}
+
+	type result struct {
+		ws  WSConnection
+		err error
+	}
+	resultC := make(chan result, 1)
+	go func() {
+		ws, err := c.wSConnectionFactory(c.url, c.origin)
+		resultC <- result{ws, err}
+	}()
+
+	select {
+	case r := <-resultC:
+		return r.ws, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-resultC; r.err == nil {
+				r.ws.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
 func (c *client) startWithReconnect() {
+	backoff := ReconnectMinBackoff
 	for {
 		if c.IsConnected() {
 			err := c.readLoop()
@@ -137,24 +530,108 @@ func (c *client) startWithReconnect() {
 			return
 		}
 
-		var err error
-		c.ws, err = c.wSConnectionFactory(c.url, c.origin)
+		ws, err := c.wSConnectionFactory(c.url, c.origin)
 		if err != nil {
 			c.setIsConnected(false)
 
-			logger.WithError(err).Error("Error on connect, retry in 50 ms")
+			logger.WithError(err).WithField("retryIn", backoff).Error("Error on connect")
 
-			time.Sleep(time.Millisecond * 50)
+			select {
+			case <-time.After(backoff):
+			case <-c.closed:
+				return
+			}
+			if backoff *= 2; backoff > ReconnectMaxBackoff {
+				backoff = ReconnectMaxBackoff
+			}
 		} else {
+			c.setConn(ws)
 			c.setIsConnected(true)
+			backoff = ReconnectMinBackoff
 			logger.Warn("Reconnected again")
+			c.getHooks().reconnected()
+			c.emit(Event{Type: EventConnected})
+			c.resubscribe()
+			if q := c.getOfflineQueue(); q != nil {
+				q.flush(c)
+			}
+		}
+	}
+}
+
+// resubscribe subscribes again to the subscribed paths, from the message following the last one received on each.
+func (c *client) resubscribe() {
+	c.mu.RLock()
+	cmds := make([]*protocol.Cmd, 0, len(c.subscriptions))
+	for _, s := range c.subscriptions {
+		cmds = append(cmds, s.cmd())
+	}
+	c.mu.RUnlock()
+
+	for _, cmd := range cmds {
+		if err := c.write(cmd.Bytes()); err != nil {
+			logger.WithError(err).WithField("path", cmd.Arg).Error("Error on subscribing again")
+		}
+	}
+}
+
+// received remembers the ID of the message for the subscriptions matching its path, and returns their listeners.
+// The message is also for the Messages channel if one of them was subscribed with Subscribe, or if there is no listener.
+func (c *client) received(message *protocol.Message) (listeners []*listener, toChannel bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path, s := range c.subscriptions {
+		if !matchesPath(string(message.Path), path) {
+			continue
+		}
+		if message.ID > s.lastID {
+			s.lastID = message.ID
+		}
+		listeners = append(listeners, s.listeners...)
+		toChannel = toChannel || s.channel
+	}
+	return listeners, toChannel || len(listeners) == 0
+}
+
+// errorListeners returns the listeners receiving errors, of the path given in the argument of the error
+// (or all of them if empty).
+func (c *client) errorListeners(arg string) (listeners []*listener) {
+	path := ""
+	if args := strings.Fields(arg); len(args) > 0 {
+		path = args[0]
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for p, s := range c.subscriptions {
+		if path != "" && p != path {
+			continue
 		}
+		for _, l := range s.listeners {
+			if l.errorC != nil {
+				listeners = append(listeners, l)
+			}
+		}
+	}
+	return
+}
+
+// connectionError sends the error of the connection to the Errors channel, and to all the listeners receiving errors.
+func (c *client) connectionError(err error) {
+	msg := clientErrorMessage(err.Error())
+	for _, l := range c.errorListeners("") {
+		l.deliverError(msg)
 	}
+	c.errors <- msg
+}
+
+// matchesPath returns true if the path is the subscribed path or one of its subtopics.
+func matchesPath(path, subscribed string) bool {
+	return path == subscribed || strings.HasPrefix(path, strings.TrimSuffix(subscribed, "/")+"/")
 }
 
 func (c *client) readLoop() error {
 	for {
-		_, msg, err := c.ws.ReadMessage()
+		_, msg, err := c.conn().ReadMessage()
 		if err != nil {
 			c.setIsConnected(false)
 			if c.shouldStop() {
@@ -163,7 +640,9 @@ func (c *client) readLoop() error {
 
 			logger.WithError(err).Error("Error when reading from websocket")
 
-			c.errors <- clientErrorMessage(err.Error())
+			c.getHooks().disconnected(err)
+			c.lost(err)
+			c.connectionError(err)
 			return err
 		}
 
@@ -195,8 +674,47 @@ func (c *client) handleIncomingMessage(msg []byte) {
 
 	switch message := parsed.(type) {
 	case *protocol.Message:
-		c.messages <- message
+		message, err = c.reassembler.Add(message)
+		if err != nil {
+			logger.WithError(err).Error("Error on reassembling of incoming message")
+			c.errors <- clientErrorMessage(err.Error())
+			return
+		}
+		if message == nil {
+			// the other chunks of the message are still missing
+			return
+		}
+		c.getHooks().messageReceived(message)
+		if message.Expired(time.Now()) {
+			logger.WithFields(message.LogFields()).Debug("Dropping expired message")
+			return
+		}
+		if c.fetched(message) {
+			return
+		}
+		listeners, toChannel := c.received(message)
+		for _, l := range listeners {
+			l.deliverMessage(message)
+		}
+		if toChannel {
+			c.messages <- message
+		}
 	case *protocol.NotificationMessage:
+		if message.Name == protocol.SUCCESS_FETCH_END {
+			c.fetchEnded(message.Arg)
+		}
+		c.subscriptionChanged(message)
+		if c.receipt(message) {
+			return
+		}
+		if message.IsError && strings.HasPrefix(message.Arg, "/") {
+			if listeners := c.errorListeners(message.Arg); len(listeners) > 0 {
+				for _, l := range listeners {
+					l.deliverError(message)
+				}
+				return
+			}
+		}
 		if message.IsError {
 			select {
 			case c.errors <- message:
@@ -211,21 +729,241 @@ func (c *client) handleIncomingMessage(msg []byte) {
 	}
 }
 
+// Subscribe sends the receive command with the path (and optionally the startId and the maxCount, see the protocol).
+// The clients with auto-reconnect subscribe again after each reconnection, from the last received message.
 func (c *client) Subscribe(path string) error {
+	return c.subscribe(path, "", nil)
+}
+
+// SubscribeWithFilters subscribes like Subscribe, with filters like "user_id", "device_id" or custom fields:
+// they are added to the params of the route of the subscription on the server, and the messages published with
+// filters are only received if they all match (see the filter parameters of the REST API).
+// The user_id can only be filtered with the user of the connection.
+func (c *client) SubscribeWithFilters(path string, filters map[string]string) error {
+	header, err := json.Marshal(filters)
+	if err != nil {
+		return err
+	}
+	return c.subscribe(path, string(header), nil)
+}
+
+// SubscribeFunc subscribes like Subscribe, but the messages of the path are passed to the handler
+// instead of the Messages channel, and its errors to onError (if not nil) instead of the Errors channel.
+// The handlers of each subscription are called in their own go routine, one message or error at a time.
+func (c *client) SubscribeFunc(path string, handler MessageHandler, onError ErrorHandler) error {
+	l, err := c.newListener(path)
+	if err != nil {
+		return err
+	}
+	l.handler = handler
+	l.onError = onError
+	if onError == nil {
+		l.errorC = nil
+	}
+	go l.run()
+	return c.subscribe(path, "", l)
+}
+
+// OpenSubscription returns a new logical subscription to the path, receiving its messages and errors on its own channels.
+// The logical subscriptions to the same path share the subscription of the connection, from the time they are opened:
+// the path is subscribed by the first one (optionally with a startId), and unsubscribed after the last one.
+func (c *client) OpenSubscription(path string) (Subscription, error) {
+	l, err := c.newListener(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.subscribe(path, "", l); err != nil {
+		c.removeListener(l)
+		return nil, err
+	}
+	return l, nil
+}
+
+// SubscribeContext opens a logical subscription like OpenSubscription, which is unsubscribed when the context is done.
+func (c *client) SubscribeContext(ctx context.Context, path string) (Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s, err := c.OpenSubscription(path)
+	if err != nil {
+		return nil, err
+	}
+	l := s.(*listener)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Unsubscribe()
+		case <-l.done:
+		}
+	}()
+	return s, nil
+}
+
+func (c *client) newListener(path string) (*listener, error) {
+	args := strings.Fields(path)
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("a subscription requires a path and optionally a startId, but was %q", path)
+	}
+	return &listener{
+		client:   c,
+		path:     args[0],
+		messageC: make(chan *protocol.Message, cap(c.messages)),
+		errorC:   make(chan *protocol.NotificationMessage, cap(c.errors)),
+		done:     make(chan bool),
+	}, nil
+}
+
+// subscribe sends the receive command, and records the subscription of the path with the listener
+// (or for the Messages channel if nil). The listeners of an already subscribed path share its subscription.
+func (c *client) subscribe(path string, filters string, l *listener) error {
 	cmd := &protocol.Cmd{
-		Name: protocol.CmdReceive,
-		Arg:  path,
+		Name:       protocol.CmdReceive,
+		Arg:        path,
+		HeaderJSON: filters,
+	}
+	// the fetching of a maxCount of messages is not a subscription
+	if args := strings.Fields(path); len(args) > 0 && len(args) < 3 {
+		c.mu.Lock()
+		s, exists := c.subscriptions[args[0]]
+		if !exists {
+			s = &subscription{arg: path, filters: filters, confirmed: make(chan bool)}
+			c.subscriptions[args[0]] = s
+		}
+		if l == nil {
+			s.arg = path
+			s.filters = filters
+			s.channel = true
+		} else {
+			s.listeners = append(s.listeners, l)
+		}
+		c.mu.Unlock()
+
+		if exists && l != nil {
+			return nil
+		}
 	}
-	err := c.ws.WriteMessage(websocket.BinaryMessage, cmd.Bytes())
+	err := c.write(cmd.Bytes())
 	return err
 }
 
+// removeListener stops the listener, and unsubscribes its path if there is no other subscription to it.
+func (c *client) removeListener(l *listener) error {
+	c.mu.Lock()
+	s, exists := c.subscriptions[l.path]
+	if !exists || !s.remove(l) {
+		c.mu.Unlock()
+		return nil
+	}
+	l.stop()
+	last := len(s.listeners) == 0 && !s.channel
+	if last {
+		delete(c.subscriptions, l.path)
+	}
+	c.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+	cmd := &protocol.Cmd{
+		Name: protocol.CmdCancel,
+		Arg:  l.path,
+	}
+	return c.write(cmd.Bytes())
+}
+
+// SubscribeFrom fetches the messages of the topic from the message with the ID since
+// (or the last -since messages if negative), and then subscribes to it.
+// The messages are all received on the Messages channel.
+func (c *client) SubscribeFrom(topic string, since int64) error {
+	return c.Subscribe(fmt.Sprintf("%s %d", topic, since))
+}
+
+// Fetch returns the messages of the topic from the message with the ID since, or the last -since messages if negative,
+// at most limit of them (0 for no limit), ordered by their ID. It blocks until the server has sent all of them.
+// The fetched messages are not received on the Messages channel.
+func (c *client) Fetch(topic string, since int64, limit int) ([]*protocol.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), FetchTimeout)
+	defer cancel()
+	return c.FetchContext(ctx, topic, since, limit)
+}
+
+// FetchContext is like Fetch, but gives up waiting for the messages when the context is done.
+func (c *client) FetchContext(ctx context.Context, topic string, since int64, limit int) ([]*protocol.Message, error) {
+	f := &fetch{done: make(chan bool)}
+	c.mu.Lock()
+	if _, exists := c.fetches[topic]; exists {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("a fetch of %s is already running", topic)
+	}
+	c.fetches[topic] = f
+	c.mu.Unlock()
+
+	cmd := &protocol.Cmd{
+		Name: protocol.CmdReceive,
+		Arg:  fmt.Sprintf("%s %d %d", topic, since, limit),
+	}
+	if err := c.write(cmd.Bytes()); err != nil {
+		c.removeFetch(topic, f)
+		return nil, err
+	}
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		c.removeFetch(topic, f)
+		return nil, fmt.Errorf("fetching %s: %v", topic, ctx.Err())
+	}
+
+	sort.Slice(f.messages, func(i, j int) bool { return f.messages[i].ID < f.messages[j].ID })
+	return f.messages, nil
+}
+
+// fetched adds the message to the running fetch of its topic, and returns true if there is one.
+func (c *client) fetched(message *protocol.Message) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, f := range c.fetches {
+		if matchesPath(string(message.Path), topic) {
+			f.messages = append(f.messages, message)
+			return true
+		}
+	}
+	return false
+}
+
+// fetchEnded completes the running fetch of the topic, if any.
+func (c *client) fetchEnded(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, exists := c.fetches[topic]; exists {
+		delete(c.fetches, topic)
+		close(f.done)
+	}
+}
+
+func (c *client) removeFetch(topic string, f *fetch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fetches[topic] == f {
+		delete(c.fetches, topic)
+	}
+}
+
 func (c *client) Unsubscribe(path string) error {
+	c.mu.Lock()
+	if s, exists := c.subscriptions[path]; exists {
+		for _, l := range s.listeners {
+			l.stop()
+		}
+		delete(c.subscriptions, path)
+	}
+	c.mu.Unlock()
+
 	cmd := &protocol.Cmd{
 		Name: protocol.CmdCancel,
 		Arg:  path,
 	}
-	err := c.ws.WriteMessage(websocket.BinaryMessage, cmd.Bytes())
+	err := c.write(cmd.Bytes())
 	return err
 }
 
@@ -233,6 +971,14 @@ func (c *client) Send(path string, body string, header string) error {
 	return c.SendBytes(path, []byte(body), header)
 }
 
+// SendContext is like Send, but does not send the message if the context is already done.
+func (c *client) SendContext(ctx context.Context, path string, body string, header string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Send(path, body, header)
+}
+
 func (c *client) SendBytes(path string, body []byte, header string) error {
 	cmd := &protocol.Cmd{
 		Name:       protocol.CmdSend,
@@ -241,11 +987,139 @@ func (c *client) SendBytes(path string, body []byte, header string) error {
 		HeaderJSON: header,
 	}
 
-	return c.WriteRawMessage(cmd.Bytes())
+	start := time.Now()
+	frames, err := c.frames(cmd)
+	q := c.getOfflineQueue()
+	for i := 0; err == nil && i < len(frames); i++ {
+		if q != nil {
+			err = q.send(c, frames[i])
+		} else {
+			err = c.WriteRawMessage(frames[i])
+		}
+	}
+	c.getHooks().messageSent(path, start, err)
+	return err
+}
+
+// SendBinary sends a binary body with its media type (e.g. "image/png") in the Content-Type field of the message header.
+// The receivers get it with the ContentType of the message; IsBinary is true for the non-textual media types.
+func (c *client) SendBinary(path string, body []byte, contentType string) error {
+	return c.SendContent(path, body, contentType, "")
+}
+
+// SendContent sends a body with its media type and its encoding (e.g. "gzip") in the message header, omitting them if empty.
+// The receivers get them with the ContentType and the ContentEncoding of the message, and the decoded body with DecodedBody.
+func (c *client) SendContent(path string, body []byte, contentType string, contentEncoding string) error {
+	msg := &protocol.Message{}
+	if contentType != "" {
+		if err := msg.SetContentType(contentType); err != nil {
+			return err
+		}
+	}
+	if contentEncoding != "" {
+		if err := msg.SetContentEncoding(contentEncoding); err != nil {
+			return err
+		}
+	}
+	return c.SendBytes(path, body, msg.HeaderJSON)
+}
+
+// SendWithPriority sends the message with the given priority in the Priority field of the message header.
+func (c *client) SendWithPriority(path string, body string, priority protocol.Priority) error {
+	msg := &protocol.Message{}
+	if err := msg.SetPriority(priority); err != nil {
+		return err
+	}
+	return c.SendBytes(path, []byte(body), msg.HeaderJSON)
+}
+
+// SendAndWait sends the message with a publisherMessageId, and waits for the receipt of the server.
+// It returns the ID of the stored message (0 if the message was forwarded to the node storing its topic),
+// or an error if the message was rejected or if the timeout expired.
+func (c *client) SendAndWait(path string, body string, timeout time.Duration) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.SendAndWaitContext(ctx, path, body)
+}
+
+// SendAndWaitContext is like SendAndWait, but gives up waiting for the receipt when the context is done.
+func (c *client) SendAndWaitContext(ctx context.Context, path string, body string) (id uint64, err error) {
+	start := time.Now()
+	defer func() { c.getHooks().messageConfirmed(path, start, err) }()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	publisherMessageID := strconv.FormatUint(atomic.AddUint64(&c.lastSendID, 1), 10)
+	receiptC := make(chan *protocol.NotificationMessage, 1)
+	c.mu.Lock()
+	c.receipts[publisherMessageID] = receiptC
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.receipts, publisherMessageID)
+		c.mu.Unlock()
+	}()
+
+	cmd := &protocol.Cmd{
+		Name: protocol.CmdSend,
+		Arg:  path + " " + publisherMessageID,
+		Body: []byte(body),
+	}
+	frames, err := c.frames(cmd)
+	if err != nil {
+		return 0, err
+	}
+	for _, frame := range frames {
+		if err := c.WriteRawMessage(frame); err != nil {
+			return 0, err
+		}
+	}
+
+	select {
+	case n := <-receiptC:
+		if n.IsError {
+			return 0, fmt.Errorf("message to %s not sent: %s %s", path, n.Name, n.Arg)
+		}
+		receipt := &protocol.SendReceipt{}
+		if err := json.Unmarshal([]byte(n.Json), receipt); err != nil {
+			return 0, err
+		}
+		return receipt.SequenceID, nil
+	case <-ctx.Done():
+		return 0, fmt.Errorf("waiting for the receipt of the message to %s: %v", path, ctx.Err())
+	}
+}
+
+// receipt passes the notification to the SendAndWait waiting for it, and returns true if there is one.
+func (c *client) receipt(n *protocol.NotificationMessage) bool {
+	args := strings.Fields(n.Arg)
+	var publisherMessageID string
+	switch {
+	case n.Name == protocol.SUCCESS_SEND && len(args) > 0,
+		n.Name == protocol.ERROR_SEND && len(args) > 0:
+		publisherMessageID = args[0]
+	case n.Name == protocol.ERROR_RATE_LIMITED && len(args) > 1,
+		n.Name == protocol.ERROR_QUOTA_EXCEEDED && len(args) > 1:
+		publisherMessageID = args[1]
+	default:
+		return false
+	}
+
+	c.mu.RLock()
+	receiptC, exists := c.receipts[publisherMessageID]
+	c.mu.RUnlock()
+	if exists {
+		select {
+		case receiptC <- n:
+		default:
+		}
+	}
+	return exists
 }
 
 func (c *client) WriteRawMessage(message []byte) error {
-	return c.ws.WriteMessage(websocket.BinaryMessage, message)
+	return c.write(message)
 }
 
 func (c *client) Messages() chan *protocol.Message {
@@ -261,8 +1135,20 @@ func (c *client) Errors() chan *protocol.NotificationMessage {
 }
 
 func (c *client) Close() {
+	c.closeOnce.Do(func() { close(c.closed) })
 	c.shouldStopChan <- true
-	c.ws.Close()
+	if ws := c.conn(); ws != nil {
+		ws.Close()
+	}
+
+	c.mu.Lock()
+	for path, s := range c.subscriptions {
+		for _, l := range s.listeners {
+			l.stop()
+		}
+		delete(c.subscriptions, path)
+	}
+	c.mu.Unlock()
 }
 
 func clientErrorMessage(message string) *protocol.NotificationMessage {
@@ -1,13 +1,20 @@
 package client
 
 import (
+	"github.com/smancke/guble/protocol"
 	"github.com/smancke/guble/testutil"
 
+	"context"
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/golang/mock/gomock"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
@@ -294,3 +301,637 @@ func TestSendUnSubscribeMessage(t *testing.T) {
 	// stop client after 200ms
 	time.AfterFunc(time.Millisecond*200, func() { c.Close() })
 }
+
+func TestReconnectAndResubscribe(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	// given a client subscribed to two paths, with a first connection failing after a message
+	c := New("url", "origin", 10, true)
+	firstConn := NewMockWSConnection(ctrl)
+	firstConn.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /foo"))
+	firstConn.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /other -5"))
+	firstConn.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /fetched 0 20"))
+	subscribed := make(chan bool)
+	firstRead := firstConn.EXPECT().ReadMessage().Do(func() { <-subscribed }).
+		Return(websocket.BinaryMessage, []byte(aNormalMessage), nil)
+	firstConn.EXPECT().ReadMessage().After(firstRead).
+		Return(0, nil, fmt.Errorf("connection lost"))
+
+	// and a second connection on which the paths are subscribed again, after the last received message
+	secondConn := NewMockWSConnection(ctrl)
+	resubscribed := make(chan string, 2)
+	secondConn.EXPECT().WriteMessage(websocket.BinaryMessage, gomock.Any()).Do(func(_ int, data []byte) {
+		resubscribed <- string(data)
+	}).Times(2)
+	closed := make(chan bool, 1)
+	secondConn.EXPECT().ReadMessage().Do(func() { <-closed }).
+		Return(0, nil, fmt.Errorf("closed"))
+	secondConn.EXPECT().Close().Do(func() { closed <- true })
+
+	connections := 0
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		connections++
+		switch connections {
+		case 1:
+			return firstConn, nil
+		case 2:
+			return nil, fmt.Errorf("emulate connection error")
+		}
+		return secondConn, nil
+	})
+
+	a.NoError(c.Start())
+	a.NoError(c.Subscribe("/foo"))
+	a.NoError(c.Subscribe("/other -5"))
+	a.NoError(c.Subscribe("/fetched 0 20"))
+	close(subscribed)
+
+	select {
+	case m := <-c.Messages():
+		a.Equal(uint64(42), m.ID)
+	case <-time.After(time.Millisecond * 100):
+		a.Fail("timeout while waiting for message")
+	}
+
+	var cmds []string
+	for i := 0; i < 2; i++ {
+		select {
+		case cmd := <-resubscribed:
+			cmds = append(cmds, cmd)
+		case <-time.After(time.Millisecond * 200):
+			a.Fail("timeout while waiting for the subscriptions")
+		}
+	}
+	sort.Strings(cmds)
+	a.Equal([]string{"+ /foo 43", "+ /other -5"}, cmds)
+	a.Equal(3, connections)
+	a.True(c.IsConnected())
+
+	c.Close()
+}
+
+func TestFetch(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	// given a client
+	c := New("url", "origin", 10, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+
+	// which receives the fetched messages (in the reverse order), and then a message of another topic
+	fetchSent := make(chan bool)
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /foo -2 0")).
+		Do(func(int, []byte) { close(fetchSent) })
+	closed := make(chan bool, 1)
+	gomock.InOrder(
+		connMock.EXPECT().ReadMessage().Do(func() { <-fetchSent }).
+			Return(websocket.BinaryMessage, []byte("#fetch-start /foo 2"), nil),
+		connMock.EXPECT().ReadMessage().
+			Return(websocket.BinaryMessage, []byte("/foo,43,user01,phone01,{},1420110000,0\n\nSecond"), nil),
+		connMock.EXPECT().ReadMessage().
+			Return(websocket.BinaryMessage, []byte(aNormalMessage), nil),
+		connMock.EXPECT().ReadMessage().
+			Return(websocket.BinaryMessage, []byte("#fetch-end /foo"), nil),
+		connMock.EXPECT().ReadMessage().
+			Return(websocket.BinaryMessage, []byte("/other,7,user01,phone01,{},1420110000,0\n\nOther"), nil),
+		connMock.EXPECT().ReadMessage().Do(func() { <-closed }).
+			Return(0, nil, fmt.Errorf("closed")),
+	)
+	connMock.EXPECT().Close().Do(func() { closed <- true })
+
+	a.NoError(c.Start())
+
+	// when the last two messages of the topic are fetched
+	messages, err := c.Fetch("/foo", -2, 0)
+
+	// then they are returned ordered by ID
+	a.NoError(err)
+	if a.Equal(2, len(messages)) {
+		a.Equal(uint64(42), messages[0].ID)
+		a.Equal("Hello World", string(messages[0].Body))
+		a.Equal(uint64(43), messages[1].ID)
+		a.Equal("Second", string(messages[1].Body))
+	}
+
+	// and only the other messages are received on the channel
+	select {
+	case m := <-c.Messages():
+		a.Equal(uint64(7), m.ID)
+	case <-time.After(time.Millisecond * 100):
+		a.Fail("timeout while waiting for message")
+	}
+
+	c.Close()
+}
+
+func TestFetchTimeout(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	defer func(timeout time.Duration) { FetchTimeout = timeout }(FetchTimeout)
+	FetchTimeout = time.Millisecond * 10
+
+	// given a client, never receiving the end of the fetch
+	c := New("url", "origin", 10, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /foo 10 5")).Times(2)
+	closed := make(chan bool, 1)
+	connMock.EXPECT().ReadMessage().Do(func() { <-closed }).
+		Return(0, nil, fmt.Errorf("closed")).AnyTimes()
+	connMock.EXPECT().Close().Do(func() { closed <- true })
+
+	a.NoError(c.Start())
+
+	// when fetching, then the fetch times out
+	_, err := c.Fetch("/foo", 10, 5)
+	a.Error(err)
+
+	// and the topic can be fetched again
+	_, err = c.Fetch("/foo", 10, 5)
+	a.Error(err)
+
+	c.Close()
+}
+
+func TestSubscribeFrom(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	c := New("url", "origin", 10, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /foo -10"))
+	closed := make(chan bool, 1)
+	connMock.EXPECT().ReadMessage().Do(func() { <-closed }).
+		Return(0, nil, fmt.Errorf("closed")).AnyTimes()
+	connMock.EXPECT().Close().Do(func() { closed <- true })
+
+	a.NoError(c.Start())
+	a.NoError(c.SubscribeFrom("/foo", -10))
+
+	c.Close()
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	// given a client
+	c := New("url", "origin", 10, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+
+	// which receives a message and an error of a subscription with handlers, and a message of another topic
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /foo"))
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /other"))
+	subscribed := make(chan bool)
+	gomock.InOrder(
+		connMock.EXPECT().ReadMessage().Do(func() { <-subscribed }).
+			Return(websocket.BinaryMessage, []byte(aNormalMessage), nil),
+		connMock.EXPECT().ReadMessage().
+			Return(websocket.BinaryMessage, []byte("!error-subscribed-to /foo not allowed"), nil),
+		connMock.EXPECT().ReadMessage().
+			Return(websocket.BinaryMessage, []byte("/other,7,user01,phone01,{},1420110000,0\n\nOther"), nil),
+		connMock.EXPECT().ReadMessage().
+			Return(0, nil, fmt.Errorf("connection lost")),
+	)
+
+	a.NoError(c.Start())
+
+	messages := make(chan *protocol.Message, 1)
+	errors := make(chan *protocol.NotificationMessage, 2)
+	a.NoError(c.SubscribeFunc("/foo",
+		func(m *protocol.Message) { messages <- m },
+		func(e *protocol.NotificationMessage) { errors <- e }))
+	a.NoError(c.Subscribe("/other"))
+	close(subscribed)
+
+	// then the message and the errors of the subscription are passed to its handlers
+	select {
+	case m := <-messages:
+		a.Equal(uint64(42), m.ID)
+	case <-time.After(time.Millisecond * 100):
+		a.Fail("timeout while waiting for message")
+	}
+	for _, name := range []string{protocol.ERROR_SUBSCRIBED_TO, "clientError"} {
+		select {
+		case e := <-errors:
+			a.Equal(name, e.Name)
+		case <-time.After(time.Millisecond * 100):
+			a.Fail("timeout while waiting for error")
+		}
+	}
+
+	// and the other message and the connection error to the channels
+	select {
+	case m := <-c.Messages():
+		a.Equal(uint64(7), m.ID)
+	case <-time.After(time.Millisecond * 100):
+		a.Fail("timeout while waiting for message")
+	}
+	select {
+	case e := <-c.Errors():
+		a.Equal("clientError", e.Name)
+	case <-time.After(time.Millisecond * 100):
+		a.Fail("timeout while waiting for error")
+	}
+
+	// and a fetch is not a subscription with handlers
+	a.Error(c.SubscribeFunc("/foo 0 10", func(*protocol.Message) {}, nil))
+}
+
+func TestDialConfigHeader(t *testing.T) {
+	a := assert.New(t)
+
+	config := DialConfig{
+		Token:  "secret",
+		Header: http.Header{"X-Api-Key": []string{"key"}, "Origin": []string{"ignored"}},
+	}
+	header := config.header("http://localhost/")
+
+	a.Equal("http://localhost/", header.Get("Origin"))
+	a.Equal("Bearer secret", header.Get("Authorization"))
+	a.Equal("key", header.Get("X-Api-Key"))
+	a.Equal("ignored", config.Header.Get("Origin"))
+
+	config.Will = &Will{Topic: "/status/marvin", Body: "offline"}
+	header = config.header("http://localhost/")
+	a.Equal("/status/marvin", header.Get(protocol.WillTopicHeader))
+	a.Equal("offline", header.Get(protocol.WillMessageHeader))
+
+	config.Protobuf = true
+	a.Equal(protocol.EncodingProtobuf, config.header("http://localhost/").Get(protocol.EncodingHeader))
+
+	config.ChunkSize = 1 << 20
+	a.Equal("1048576", config.header("http://localhost/").Get(protocol.ChunkSizeHeader))
+
+	a.Equal(http.Header{"Origin": []string{"http://localhost/"}}, DialConfig{}.header("http://localhost/"))
+}
+
+// serverConnection is a connection to a server answering to each written command.
+type serverConnection struct {
+	answer func(cmd string) string
+	reads  chan []byte
+}
+
+func (conn *serverConnection) WriteMessage(messageType int, data []byte) error {
+	if answer := conn.answer(string(data)); answer != "" {
+		conn.reads <- []byte(answer)
+	}
+	return nil
+}
+
+func (conn *serverConnection) ReadMessage() (int, []byte, error) {
+	data, ok := <-conn.reads
+	if !ok {
+		return 0, nil, fmt.Errorf("closed")
+	}
+	return websocket.BinaryMessage, data, nil
+}
+
+func (conn *serverConnection) Close() error {
+	close(conn.reads)
+	return nil
+}
+
+func TestSendAndWait(t *testing.T) {
+	a := assert.New(t)
+
+	// given a client, connected to a server confirming the messages to /foo, rejecting the ones to /limited,
+	// and never answering to the other ones
+	var sent []string
+	conn := &serverConnection{
+		reads: make(chan []byte, 10),
+		answer: func(cmd string) string {
+			sent = append(sent, cmd)
+			args := strings.Fields(strings.SplitN(cmd, "\n", 2)[0])
+			switch args[1] {
+			case "/foo":
+				return "#send " + args[2] + "\n" +
+					`{"sequenceId":42,"path":"/foo","publisherMessageId":"` + args[2] + `","messagePublishingTime":1420110000}`
+			case "/limited":
+				return "!error-rate-limited /limited " + args[2]
+			}
+			return ""
+		},
+	}
+	c := New("url", "origin", 10, false)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		return conn, nil
+	})
+	a.NoError(c.Start())
+
+	// when sending and waiting for the receipts, then the ID of the stored message is returned
+	id, err := c.SendAndWait("/foo", "Hello", time.Millisecond*100)
+	a.NoError(err)
+	a.Equal(uint64(42), id)
+
+	// and the rejections and the timeouts are errors
+	_, err = c.SendAndWait("/limited", "Hello", time.Millisecond*100)
+	a.Error(err)
+	_, err = c.SendAndWait("/other", "Hello", time.Millisecond*10)
+	a.Error(err)
+
+	a.Equal([]string{"> /foo 1\n\nHello", "> /limited 2\n\nHello", "> /other 3\n\nHello"}, sent)
+
+	// and the receipts are not passed to the channels
+	select {
+	case n := <-c.StatusMessages():
+		a.Fail("unexpected status message", n.Name)
+	case n := <-c.Errors():
+		a.Fail("unexpected error", n.Name)
+	default:
+	}
+
+	c.Close()
+}
+
+func TestStartContext_Done(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	// given a client with auto-reconnect, whose connection is established after the context is done
+	c := New("url", "origin", 10, true)
+	connMock := NewMockWSConnection(ctrl)
+	closed := make(chan bool)
+	connMock.EXPECT().Close().Do(func() { close(closed) })
+	release := make(chan bool)
+	connections := 0
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		connections++
+		<-release
+		return connMock, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	// when starting, then the error of the context is returned
+	a.Equal(context.DeadlineExceeded, c.StartContext(ctx))
+	a.False(c.IsConnected())
+
+	// and the late connection is closed, without reconnecting
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(time.Millisecond * 100):
+		a.Fail("connection not closed")
+	}
+	a.Equal(1, connections)
+}
+
+func TestContextOperations(t *testing.T) {
+	a := assert.New(t)
+
+	// given a connected client
+	sent := make(chan string, 10)
+	conn := &serverConnection{
+		reads: make(chan []byte, 10),
+		answer: func(cmd string) string {
+			sent <- cmd
+			return ""
+		},
+	}
+	c := New("url", "origin", 10, false)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		return conn, nil
+	})
+	a.NoError(c.Start())
+
+	// when subscribing with a context, then the path is unsubscribed once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := c.SubscribeContext(ctx, "/foo")
+	a.NoError(err)
+	a.Equal("+ /foo", <-sent)
+	cancel()
+	select {
+	case cmd := <-sent:
+		a.Equal("- /foo", cmd)
+	case <-time.After(time.Millisecond * 100):
+		a.Fail("not unsubscribed")
+	}
+
+	// and nothing is sent or subscribed with a done context
+	a.Equal(context.Canceled, c.SendContext(ctx, "/foo", "Hello", ""))
+	_, err = c.SendAndWaitContext(ctx, "/foo", "Hello")
+	a.Equal(context.Canceled, err)
+	_, err = c.SubscribeContext(ctx, "/foo")
+	a.Equal(context.Canceled, err)
+
+	// and waiting for the fetched messages ends with the context
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err = c.FetchContext(ctx, "/foo", 0, 10)
+	a.Error(err)
+	a.Equal("+ /foo 0 10", <-sent)
+
+	select {
+	case cmd := <-sent:
+		a.Fail("unexpected command", cmd)
+	default:
+	}
+
+	c.Close()
+}
+
+func TestSubscribeWithFilters(t *testing.T) {
+	a := assert.New(t)
+
+	sent := make(chan string, 10)
+	conn := &serverConnection{
+		reads: make(chan []byte, 10),
+		answer: func(cmd string) string {
+			sent <- cmd
+			return ""
+		},
+	}
+	c := New("url", "origin", 10, false)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		return conn, nil
+	})
+	a.NoError(c.Start())
+
+	// when subscribing with filters, then they are sent as header of the command
+	a.NoError(c.SubscribeWithFilters("/foo", map[string]string{"device_id": "phone01", "region": "eu"}))
+	a.Equal("+ /foo\n"+`{"device_id":"phone01","region":"eu"}`, <-sent)
+
+	// and again when subscribing again after a reconnection
+	c.(*client).resubscribe()
+	a.Equal("+ /foo\n"+`{"device_id":"phone01","region":"eu"}`, <-sent)
+
+	c.Close()
+}
+
+func TestSendBinary(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	c := New("url", "origin", 1, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+	connMock.EXPECT().ReadMessage().Return(0, nil, fmt.Errorf("closed")).AnyTimes()
+	connMock.EXPECT().Close()
+	a.NoError(c.Start())
+
+	body := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x00}
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage,
+		append([]byte("> /foo\n{\"Content-Type\":\"image/png\"}\n"), body...))
+	a.NoError(c.SendBinary("/foo", body, "image/png"))
+
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage,
+		append([]byte("> /foo\n{\"Content-Encoding\":\"gzip\",\"Content-Type\":\"application/json\"}\n"), body...))
+	a.NoError(c.SendContent("/foo", body, "application/json", "gzip"))
+
+	c.Close()
+}
+
+func TestSendWithPriority(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	c := New("url", "origin", 1, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+	connMock.EXPECT().ReadMessage().Return(0, nil, fmt.Errorf("closed")).AnyTimes()
+	connMock.EXPECT().Close()
+	a.NoError(c.Start())
+
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("> /foo\n{\"Priority\":\"high\"}\nhello"))
+	a.NoError(c.SendWithPriority("/foo", "hello", protocol.PriorityHigh))
+	a.Error(c.SendWithPriority("/foo", "hello", protocol.Priority(2)))
+
+	c.Close()
+}
+
+func TestSendChunked(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	c := New("url", "origin", 1, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+	connMock.EXPECT().ReadMessage().Return(0, nil, fmt.Errorf("closed")).AnyTimes()
+	connMock.EXPECT().Close()
+	a.NoError(c.Start())
+	c.SetChunkSize(4)
+
+	// the small bodies are sent in one command
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("> /foo\n\nabc"))
+	a.NoError(c.Send("/foo", "abc", ""))
+
+	// the large bodies are sent in chunks
+	var frames []string
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, gomock.Any()).Do(func(_ int, data []byte) {
+		frames = append(frames, string(data))
+	}).Times(3)
+	a.NoError(c.Send("/foo", "Hello World", `{"key":"value"}`))
+
+	reassembler := &protocol.Reassembler{}
+	for i, frame := range frames {
+		cmd, err := protocol.ParseCmd([]byte(frame))
+		a.NoError(err)
+		a.Equal("/foo", cmd.Arg)
+		msg, err := reassembler.Add(&protocol.Message{Path: protocol.Path(cmd.Arg), HeaderJSON: cmd.HeaderJSON, Body: cmd.Body})
+		a.NoError(err)
+		if i == 2 && a.NotNil(msg) {
+			a.Equal("Hello World", string(msg.Body))
+			a.Equal(`{"key":"value"}`, msg.HeaderJSON)
+		}
+	}
+
+	c.Close()
+}
+
+func TestReceiveChunked(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	c := New("url", "origin", 10, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+
+	chunks, err := (&protocol.Message{ID: 42, Path: "/foo", Time: 1420110000, Body: []byte("Hello World")}).Split(4, "abc")
+	a.NoError(err)
+	closed := make(chan bool)
+	gomock.InOrder(
+		connMock.EXPECT().ReadMessage().Return(4, chunks[2].Bytes(), nil),
+		connMock.EXPECT().ReadMessage().Return(4, chunks[0].Bytes(), nil),
+		connMock.EXPECT().ReadMessage().Return(4, chunks[1].Bytes(), nil),
+		connMock.EXPECT().ReadMessage().Do(func() { <-closed }).Return(0, nil, fmt.Errorf("closed")).AnyTimes(),
+	)
+	connMock.EXPECT().Close().Do(func() { close(closed) })
+	a.NoError(c.Start())
+
+	// the message is received once reassembled
+	select {
+	case msg := <-c.Messages():
+		a.Equal(uint64(42), msg.ID)
+		a.Equal("Hello World", string(msg.Body))
+		a.Equal("", msg.HeaderJSON)
+	case <-time.After(time.Second):
+		a.Fail("the message is not received")
+	}
+	a.Empty(c.Messages())
+
+	c.Close()
+}
+
+// exclusiveConnection fails the writes overlapping another one.
+type exclusiveConnection struct {
+	serverConnection
+	writing int32
+	overlap int32
+}
+
+func (conn *exclusiveConnection) WriteMessage(messageType int, data []byte) error {
+	if !atomic.CompareAndSwapInt32(&conn.writing, 0, 1) {
+		atomic.StoreInt32(&conn.overlap, 1)
+		return fmt.Errorf("concurrent write")
+	}
+	defer atomic.StoreInt32(&conn.writing, 0)
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	a := assert.New(t)
+
+	conn := &exclusiveConnection{serverConnection: serverConnection{reads: make(chan []byte, 10)}}
+	c := New("url", "origin", 10, false)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		return conn, nil
+	})
+	a.NoError(c.Start())
+
+	// when sending and subscribing from several goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			a.NoError(c.Send("/foo", "Hello", ""))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			a.NoError(c.Subscribe(fmt.Sprintf("/bar/%d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	// then the writes are serialized
+	a.Equal(int32(0), atomic.LoadInt32(&conn.overlap))
+	c.Close()
+}
@@ -0,0 +1,57 @@
+package client
+
+import "fmt"
+
+// EventType is the type of the state changes of a client and of its subscriptions.
+type EventType int
+
+const (
+	// EventConnected is emitted when the client is connected, at start or after a reconnection
+	EventConnected EventType = iota
+	// EventDisconnected is emitted when the connection is lost, with its error
+	EventDisconnected
+	// EventSubscribed is emitted when the server confirmed a subscription
+	EventSubscribed
+	// EventSubscriptionLost is emitted for each subscription when the connection is lost,
+	// and when the server refused or ended a subscription
+	EventSubscriptionLost
+	// EventResumed is emitted when the server confirmed a subscription again after a reconnection
+	EventResumed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventDisconnected:
+		return "disconnected"
+	case EventSubscribed:
+		return "subscribed"
+	case EventSubscriptionLost:
+		return "subscription-lost"
+	case EventResumed:
+		return "resumed"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a state change of a client, or of one of its subscriptions (with its path).
+type Event struct {
+	Type EventType
+	Path string
+	Err  error
+}
+
+// EventListener is notified of the state changes of a client.
+// The events are emitted synchronously, in their order: OnEvent should return quickly.
+type EventListener interface {
+	OnEvent(e Event)
+}
+
+// EventListenerFunc is a func used as EventListener.
+type EventListenerFunc func(e Event)
+
+// OnEvent calls the func.
+func (f EventListenerFunc) OnEvent(e Event) {
+	f(e)
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	a := assert.New(t)
+
+	// given a client with auto-reconnect, connected to a server confirming the subscriptions
+	newConnection := func() *serverConnection {
+		conn := &serverConnection{reads: make(chan []byte, 10)}
+		conn.answer = func(cmd string) string {
+			if strings.HasPrefix(cmd, "+ ") {
+				return "#subscribed-to " + strings.Fields(cmd)[1]
+			}
+			return ""
+		}
+		return conn
+	}
+	first, second := newConnection(), newConnection()
+	connections := 0
+	c := New("url", "origin", 10, true)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		connections++
+		if connections == 1 {
+			return first, nil
+		}
+		return second, nil
+	})
+
+	events := make(chan Event, 10)
+	c.AddEventListener(EventListenerFunc(func(e Event) { events <- e }))
+	expectEvent := func(eventType EventType, path string, withError bool) {
+		select {
+		case e := <-events:
+			a.Equal(eventType, e.Type, e.Type.String())
+			a.Equal(path, e.Path)
+			a.Equal(withError, e.Err != nil)
+		case <-time.After(time.Millisecond * 100):
+			a.Fail("timeout while waiting for " + eventType.String())
+		}
+	}
+
+	// when connecting and subscribing, then the events are emitted
+	a.NoError(c.Start())
+	expectEvent(EventConnected, "", false)
+	a.NoError(c.Subscribe("/foo"))
+	expectEvent(EventSubscribed, "/foo", false)
+
+	// and when a subscription is refused
+	first.reads <- []byte("!error-subscribed-to /bar not allowed")
+	expectEvent(EventSubscriptionLost, "/bar", true)
+
+	// and when the connection is lost, the subscriptions are lost, and resumed once reconnected
+	close(first.reads)
+	expectEvent(EventDisconnected, "", true)
+	expectEvent(EventSubscriptionLost, "/foo", true)
+	expectEvent(EventConnected, "", false)
+	expectEvent(EventResumed, "/foo", false)
+
+	c.Close()
+}
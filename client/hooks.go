@@ -0,0 +1,56 @@
+package client
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"time"
+)
+
+// Hooks are called on the events of a client, e.g. to record them in the metrics of the application.
+// All of them are optional, and are called synchronously: they should return quickly.
+type Hooks struct {
+	// MessageReceived is called with each message received, before it is passed on
+	MessageReceived func(m *protocol.Message)
+
+	// Disconnected is called when the connection is lost
+	Disconnected func(err error)
+
+	// Reconnected is called when a client with auto-reconnect is connected again
+	Reconnected func()
+
+	// MessageSent is called after writing a message to the connection, with the duration of the writing
+	MessageSent func(path string, latency time.Duration, err error)
+
+	// MessageConfirmed is called after a SendAndWait, with the duration until the receipt of the server
+	MessageConfirmed func(path string, latency time.Duration, err error)
+}
+
+func (h Hooks) messageReceived(m *protocol.Message) {
+	if h.MessageReceived != nil {
+		h.MessageReceived(m)
+	}
+}
+
+func (h Hooks) disconnected(err error) {
+	if h.Disconnected != nil {
+		h.Disconnected(err)
+	}
+}
+
+func (h Hooks) reconnected() {
+	if h.Reconnected != nil {
+		h.Reconnected()
+	}
+}
+
+func (h Hooks) messageSent(path string, start time.Time, err error) {
+	if h.MessageSent != nil {
+		h.MessageSent(path, time.Since(start), err)
+	}
+}
+
+func (h Hooks) messageConfirmed(path string, start time.Time, err error) {
+	if h.MessageConfirmed != nil {
+		h.MessageConfirmed(path, time.Since(start), err)
+	}
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	a := assert.New(t)
+
+	// given a client with auto-reconnect and hooks, connected to a server confirming the messages
+	newConnection := func() *serverConnection {
+		return &serverConnection{
+			reads: make(chan []byte, 10),
+			answer: func(cmd string) string {
+				args := strings.Fields(strings.SplitN(cmd, "\n", 2)[0])
+				if len(args) > 2 {
+					return "#send " + args[2] + "\n" + `{"sequenceId":42}`
+				}
+				return ""
+			},
+		}
+	}
+	first, second := newConnection(), newConnection()
+	connections := 0
+	c := New("url", "origin", 10, true)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		connections++
+		if connections == 1 {
+			return first, nil
+		}
+		return second, nil
+	})
+
+	events := make(chan string, 10)
+	c.SetHooks(Hooks{
+		MessageReceived: func(m *protocol.Message) { events <- fmt.Sprintf("received %d", m.ID) },
+		Disconnected:    func(err error) { events <- "disconnected" },
+		Reconnected:     func() { events <- "reconnected" },
+		MessageSent: func(path string, latency time.Duration, err error) {
+			events <- fmt.Sprintf("sent %s %v", path, err)
+		},
+		MessageConfirmed: func(path string, latency time.Duration, err error) {
+			events <- fmt.Sprintf("confirmed %s %v", path, err)
+		},
+	})
+	a.NoError(c.Start())
+
+	expectEvent := func(expected string) {
+		select {
+		case event := <-events:
+			a.Equal(expected, event)
+		case <-time.After(time.Millisecond * 100):
+			a.Fail("timeout while waiting for " + expected)
+		}
+	}
+
+	// when sending messages, then the hooks are called
+	a.NoError(c.Send("/foo", "Hello", ""))
+	expectEvent("sent /foo <nil>")
+	_, err := c.SendAndWait("/foo", "Hello", time.Millisecond*100)
+	a.NoError(err)
+	expectEvent("confirmed /foo <nil>")
+
+	// and when receiving a message, which is then waiting to be read
+	first.reads <- []byte(aNormalMessage)
+	expectEvent("received 42")
+	for i := 0; i < 100 && c.QueueDepth() == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	a.Equal(1, c.QueueDepth())
+	<-c.Messages()
+	a.Equal(0, c.QueueDepth())
+
+	// and when the connection is lost, and connected again
+	close(first.reads)
+	expectEvent("disconnected")
+	expectEvent("reconnected")
+
+	c.Close()
+}
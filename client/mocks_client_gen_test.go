@@ -7,6 +7,9 @@ import (
 	"github.com/golang/mock/gomock"
 
 	"github.com/smancke/guble/protocol"
+
+	"context"
+	"time"
 )
 
 // Mock of WSConnection interface
@@ -83,6 +86,14 @@ func (_m *MockClient) EXPECT() *_MockClientRecorder {
 	return _m.recorder
 }
 
+func (_m *MockClient) AddEventListener(_param0 EventListener) {
+	_m.ctrl.Call(_m, "AddEventListener", _param0)
+}
+
+func (_mr *_MockClientRecorder) AddEventListener(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddEventListener", arg0)
+}
+
 func (_m *MockClient) Close() {
 	_m.ctrl.Call(_m, "Close")
 }
@@ -101,6 +112,28 @@ func (_mr *_MockClientRecorder) Errors() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Errors")
 }
 
+func (_m *MockClient) Fetch(_param0 string, _param1 int64, _param2 int) ([]*protocol.Message, error) {
+	ret := _m.ctrl.Call(_m, "Fetch", _param0, _param1, _param2)
+	ret0, _ := ret[0].([]*protocol.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) Fetch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Fetch", arg0, arg1, arg2)
+}
+
+func (_m *MockClient) FetchContext(_param0 context.Context, _param1 string, _param2 int64, _param3 int) ([]*protocol.Message, error) {
+	ret := _m.ctrl.Call(_m, "FetchContext", _param0, _param1, _param2, _param3)
+	ret0, _ := ret[0].([]*protocol.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) FetchContext(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "FetchContext", arg0, arg1, arg2, arg3)
+}
+
 func (_m *MockClient) IsConnected() bool {
 	ret := _m.ctrl.Call(_m, "IsConnected")
 	ret0, _ := ret[0].(bool)
@@ -121,6 +154,74 @@ func (_mr *_MockClientRecorder) Messages() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Messages")
 }
 
+func (_m *MockClient) OpenSubscription(_param0 string) (Subscription, error) {
+	ret := _m.ctrl.Call(_m, "OpenSubscription", _param0)
+	ret0, _ := ret[0].(Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) OpenSubscription(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "OpenSubscription", arg0)
+}
+
+func (_m *MockClient) Presence(_param0 ...string) (PresenceWatch, error) {
+	_s := []interface{}{}
+	for _, _x := range _param0 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "Presence", _s...)
+	ret0, _ := ret[0].(PresenceWatch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) Presence(arg0 ...interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Presence", arg0...)
+}
+
+func (_m *MockClient) QueueDepth() int {
+	ret := _m.ctrl.Call(_m, "QueueDepth")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) QueueDepth() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueueDepth")
+}
+
+func (_m *MockClient) Reply(_param0 *protocol.Message, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "Reply", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) Reply(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Reply", arg0, arg1)
+}
+
+func (_m *MockClient) Request(_param0 string, _param1 string, _param2 time.Duration) (*protocol.Message, error) {
+	ret := _m.ctrl.Call(_m, "Request", _param0, _param1, _param2)
+	ret0, _ := ret[0].(*protocol.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) Request(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Request", arg0, arg1, arg2)
+}
+
+func (_m *MockClient) RequestContext(_param0 context.Context, _param1 string, _param2 string) (*protocol.Message, error) {
+	ret := _m.ctrl.Call(_m, "RequestContext", _param0, _param1, _param2)
+	ret0, _ := ret[0].(*protocol.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) RequestContext(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RequestContext", arg0, arg1, arg2)
+}
+
 func (_m *MockClient) Send(_param0 string, _param1 string, _param2 string) error {
 	ret := _m.ctrl.Call(_m, "Send", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
@@ -131,6 +232,58 @@ func (_mr *_MockClientRecorder) Send(arg0, arg1, arg2 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Send", arg0, arg1, arg2)
 }
 
+func (_m *MockClient) SendAndWait(_param0 string, _param1 string, _param2 time.Duration) (uint64, error) {
+	ret := _m.ctrl.Call(_m, "SendAndWait", _param0, _param1, _param2)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) SendAndWait(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendAndWait", arg0, arg1, arg2)
+}
+
+func (_m *MockClient) SendAndWaitContext(_param0 context.Context, _param1 string, _param2 string) (uint64, error) {
+	ret := _m.ctrl.Call(_m, "SendAndWaitContext", _param0, _param1, _param2)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) SendAndWaitContext(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendAndWaitContext", arg0, arg1, arg2)
+}
+
+func (_m *MockClient) SendBinary(_param0 string, _param1 []byte, _param2 string) error {
+	ret := _m.ctrl.Call(_m, "SendBinary", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) SendBinary(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendBinary", arg0, arg1, arg2)
+}
+
+func (_m *MockClient) SendWithPriority(_param0 string, _param1 string, _param2 protocol.Priority) error {
+	ret := _m.ctrl.Call(_m, "SendWithPriority", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) SendWithPriority(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendWithPriority", arg0, arg1, arg2)
+}
+
+func (_m *MockClient) SendContent(_param0 string, _param1 []byte, _param2 string, _param3 string) error {
+	ret := _m.ctrl.Call(_m, "SendContent", _param0, _param1, _param2, _param3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) SendContent(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendContent", arg0, arg1, arg2, arg3)
+}
+
 func (_m *MockClient) SendBytes(_param0 string, _param1 []byte, _param2 string) error {
 	ret := _m.ctrl.Call(_m, "SendBytes", _param0, _param1, _param2)
 	ret0, _ := ret[0].(error)
@@ -141,6 +294,40 @@ func (_mr *_MockClientRecorder) SendBytes(arg0, arg1, arg2 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendBytes", arg0, arg1, arg2)
 }
 
+func (_m *MockClient) SendContext(_param0 context.Context, _param1 string, _param2 string, _param3 string) error {
+	ret := _m.ctrl.Call(_m, "SendContext", _param0, _param1, _param2, _param3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) SendContext(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendContext", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockClient) SetHooks(_param0 Hooks) {
+	_m.ctrl.Call(_m, "SetHooks", _param0)
+}
+
+func (_mr *_MockClientRecorder) SetHooks(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetHooks", arg0)
+}
+
+func (_m *MockClient) SetChunkSize(_param0 int) {
+	_m.ctrl.Call(_m, "SetChunkSize", _param0)
+}
+
+func (_mr *_MockClientRecorder) SetChunkSize(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetChunkSize", arg0)
+}
+
+func (_m *MockClient) SetOfflineQueue(_param0 int, _param1 OverflowPolicy) {
+	_m.ctrl.Call(_m, "SetOfflineQueue", _param0, _param1)
+}
+
+func (_mr *_MockClientRecorder) SetOfflineQueue(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetOfflineQueue", arg0, arg1)
+}
+
 func (_m *MockClient) SetWSConnectionFactory(_param0 WSConnectionFactory) {
 	_m.ctrl.Call(_m, "SetWSConnectionFactory", _param0)
 }
@@ -159,6 +346,16 @@ func (_mr *_MockClientRecorder) Start() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Start")
 }
 
+func (_m *MockClient) StartContext(_param0 context.Context) error {
+	ret := _m.ctrl.Call(_m, "StartContext", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) StartContext(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StartContext", arg0)
+}
+
 func (_m *MockClient) StatusMessages() chan *protocol.NotificationMessage {
 	ret := _m.ctrl.Call(_m, "StatusMessages")
 	ret0, _ := ret[0].(chan *protocol.NotificationMessage)
@@ -179,6 +376,47 @@ func (_mr *_MockClientRecorder) Subscribe(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Subscribe", arg0)
 }
 
+func (_m *MockClient) SubscribeContext(_param0 context.Context, _param1 string) (Subscription, error) {
+	ret := _m.ctrl.Call(_m, "SubscribeContext", _param0, _param1)
+	ret0, _ := ret[0].(Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) SubscribeContext(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SubscribeContext", arg0, arg1)
+}
+
+func (_m *MockClient) SubscribeFrom(_param0 string, _param1 int64) error {
+	ret := _m.ctrl.Call(_m, "SubscribeFrom", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) SubscribeFrom(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SubscribeFrom", arg0, arg1)
+}
+
+func (_m *MockClient) SubscribeFunc(_param0 string, _param1 MessageHandler, _param2 ErrorHandler) error {
+	ret := _m.ctrl.Call(_m, "SubscribeFunc", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) SubscribeFunc(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SubscribeFunc", arg0, arg1, arg2)
+}
+
+func (_m *MockClient) SubscribeWithFilters(_param0 string, _param1 map[string]string) error {
+	ret := _m.ctrl.Call(_m, "SubscribeWithFilters", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) SubscribeWithFilters(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SubscribeWithFilters", arg0, arg1)
+}
+
 func (_m *MockClient) Unsubscribe(_param0 string) error {
 	ret := _m.ctrl.Call(_m, "Unsubscribe", _param0)
 	ret0, _ := ret[0].(error)
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrOfflineQueueFull is returned by Send while disconnected, if the offline queue is full and rejects the new messages.
+var ErrOfflineQueueFull = errors.New("offline queue of the client is full")
+
+// OverflowPolicy decides which message is dropped when the offline queue is full.
+type OverflowPolicy int
+
+const (
+	// RejectNewest rejects the new messages with ErrOfflineQueueFull
+	RejectNewest OverflowPolicy = iota
+	// DropOldest drops the oldest queued message to queue the new one
+	DropOldest
+)
+
+// offlineQueue buffers the sent messages while the client is disconnected, to send them in order once reconnected.
+type offlineQueue struct {
+	mu       sync.Mutex
+	size     int
+	policy   OverflowPolicy
+	messages [][]byte
+}
+
+// send writes the message if connected and no message is queued before it, and queues it otherwise.
+func (q *offlineQueue) send(c *client, message []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.messages) == 0 && c.IsConnected() {
+		err := c.write(message)
+		if err == nil {
+			return nil
+		}
+		logger.WithError(err).Warn("Queuing the message after an error on sending")
+	}
+
+	if len(q.messages) >= q.size {
+		if q.policy == RejectNewest {
+			return ErrOfflineQueueFull
+		}
+		q.messages = q.messages[1:]
+		logger.WithField("size", q.size).Warn("Dropped the oldest message of the full offline queue")
+	}
+	q.messages = append(q.messages, message)
+	return nil
+}
+
+// flush writes the queued messages in order, and keeps the ones not written after an error.
+func (q *offlineQueue) flush(c *client) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.messages) > 0 {
+		if err := c.write(q.messages[0]); err != nil {
+			logger.WithError(err).WithField("queued", len(q.messages)).Error("Error on sending the queued messages")
+			return
+		}
+		q.messages = q.messages[1:]
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOfflineQueue_SendsTheQueuedMessagesOnReconnect(t *testing.T) {
+	a := assert.New(t)
+
+	// given a client with an offline queue, whose first connection fails
+	sent := make(chan string, 10)
+	conn := &serverConnection{
+		reads: make(chan []byte, 10),
+		answer: func(cmd string) string {
+			sent <- cmd
+			return ""
+		},
+	}
+	connect := make(chan bool)
+	c := New("url", "origin", 10, true)
+	c.SetOfflineQueue(2, RejectNewest)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		select {
+		case <-connect:
+			return conn, nil
+		default:
+			return nil, fmt.Errorf("emulate connection error")
+		}
+	})
+	a.Error(c.Start())
+
+	// when sending while disconnected, then the messages are queued, until the queue is full
+	a.NoError(c.Send("/foo", "1", ""))
+	a.NoError(c.Send("/foo", "2", ""))
+	a.Equal(ErrOfflineQueueFull, c.Send("/foo", "3", ""))
+
+	// and they are sent in order once connected
+	close(connect)
+	for _, expected := range []string{"> /foo\n\n1", "> /foo\n\n2"} {
+		select {
+		case cmd := <-sent:
+			a.Equal(expected, cmd)
+		case <-time.After(time.Millisecond * 200):
+			a.Fail("timeout while waiting for " + expected)
+		}
+	}
+
+	// and the next messages are sent directly
+	a.NoError(c.Send("/foo", "4", ""))
+	a.Equal("> /foo\n\n4", <-sent)
+
+	c.Close()
+}
+
+func TestOfflineQueue_DropOldest(t *testing.T) {
+	a := assert.New(t)
+
+	c := New("url", "origin", 10, true).(*client)
+	q := &offlineQueue{size: 2, policy: DropOldest}
+
+	for _, m := range []string{"1", "2", "3"} {
+		a.NoError(q.send(c, []byte(m)))
+	}
+	a.Equal([][]byte{[]byte("2"), []byte("3")}, q.messages)
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PresenceEvent tells that a user joined (opened its first connection to the server) or left (closed its last one).
+type PresenceEvent struct {
+	UserID string
+	Online bool
+	Time   time.Time
+}
+
+// PresenceWatch receives the presence events of the watched users (published by the servers started with --presence),
+// starting with their last events, until it is closed.
+type PresenceWatch interface {
+	Events() <-chan PresenceEvent
+	// Online returns the watched users which are online, in alphabetical order
+	Online() []string
+	Close() error
+}
+
+type presenceWatch struct {
+	subscriptions []Subscription
+	events        chan PresenceEvent
+	done          chan bool
+	closeOnce     sync.Once
+
+	mu     sync.RWMutex
+	online map[string]bool
+}
+
+// Presence watches the presence of the users, subscribing to their presence topics from their last events.
+// The subscribing user has to be allowed to receive the messages of /presence/<user>.
+func (c *client) Presence(userIDs ...string) (PresenceWatch, error) {
+	w := &presenceWatch{
+		events: make(chan PresenceEvent, cap(c.messages)),
+		done:   make(chan bool),
+		online: make(map[string]bool),
+	}
+	for _, userID := range userIDs {
+		s, err := c.OpenSubscription(protocol.PresencePrefix + userID + " -1")
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		w.subscriptions = append(w.subscriptions, s)
+		go w.watch(s)
+	}
+	return w, nil
+}
+
+func (w *presenceWatch) watch(s Subscription) {
+	for {
+		select {
+		case m := <-s.Messages():
+			e := PresenceEvent{
+				UserID: strings.TrimPrefix(string(m.Path), protocol.PresencePrefix),
+				Online: string(m.Body) == protocol.PresenceJoin,
+				Time:   time.Unix(m.Time, 0),
+			}
+			w.mu.Lock()
+			w.online[e.UserID] = e.Online
+			w.mu.Unlock()
+			select {
+			case w.events <- e:
+			case <-w.done:
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *presenceWatch) Events() <-chan PresenceEvent {
+	return w.events
+}
+
+func (w *presenceWatch) Online() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var online []string
+	for userID, isOnline := range w.online {
+		if isOnline {
+			online = append(online, userID)
+		}
+	}
+	sort.Strings(online)
+	return online
+}
+
+// Close unsubscribes from the presence topics.
+func (w *presenceWatch) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		for _, s := range w.subscriptions {
+			if unsubscribeErr := s.Unsubscribe(); unsubscribeErr != nil {
+				err = unsubscribeErr
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresence(t *testing.T) {
+	a := assert.New(t)
+
+	// given a client, connected to a server with the last presence events of marvin and arthur
+	conn := &serverConnection{
+		reads: make(chan []byte, 10),
+		answer: func(cmd string) string {
+			args := strings.Fields(cmd)
+			switch {
+			case args[0] == "+" && args[1] == "/presence/marvin":
+				a.Equal("-1", args[2])
+				return "/presence/marvin,3,marvin,app,{},1420110000,1\n{}\njoin"
+			case args[0] == "+" && args[1] == "/presence/arthur":
+				return "/presence/arthur,4,arthur,app,{},1420110001,1\n{}\nleave"
+			}
+			return ""
+		},
+	}
+	c := New("url", "origin", 10, false)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		return conn, nil
+	})
+	a.NoError(c.Start())
+	defer c.Close()
+
+	// when watching their presence
+	w, err := c.Presence("marvin", "arthur")
+	a.NoError(err)
+
+	// then their last events are received
+	expectEvent := func(userID string, online bool) {
+		select {
+		case e := <-w.Events():
+			a.Equal(userID, e.UserID)
+			a.Equal(online, e.Online)
+		case <-time.After(time.Second):
+			a.Fail("timeout while waiting for the presence event of " + userID)
+		}
+	}
+	received := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-w.Events():
+			received[e.UserID] = e.Online
+		case <-time.After(time.Second):
+			a.Fail("timeout while waiting for presence events")
+		}
+	}
+	a.Equal(map[string]bool{"marvin": true, "arthur": false}, received)
+	a.Equal([]string{"marvin"}, w.Online())
+
+	// and the following ones
+	conn.reads <- []byte("/presence/arthur,5,arthur,app,{},1420110002,1\n{}\njoin")
+	expectEvent("arthur", true)
+	a.Equal([]string{"arthur", "marvin"}, w.Online())
+
+	a.NoError(w.Close())
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// ReplyPrefix is the prefix of the unique reply-to paths of the requests, which the clients have to be allowed
+// to subscribe to, and the responders to publish to.
+var ReplyPrefix = "/replies/"
+
+// ErrNoReplyTo is returned when replying to a message without reply-to path.
+var ErrNoReplyTo = errors.New("the message has no reply-to path")
+
+// Request publishes the body to the topic with a unique reply-to path in the Reply-To field of its header
+// (and the unique part of it as correlation ID), and returns the first message published to the reply-to path (e.g. by a responder calling Reply),
+// or an error if the timeout expired.
+func (c *client) Request(topic string, body string, timeout time.Duration) (*protocol.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.RequestContext(ctx, topic, body)
+}
+
+// RequestContext is like Request, but gives up waiting for the reply when the context is done.
+// The request is published once the server confirmed the subscription to its reply-to path, so that the reply
+// can not be missed.
+func (c *client) RequestContext(ctx context.Context, topic string, body string) (*protocol.Message, error) {
+	correlationID := xid.New().String()
+	replyTo := ReplyPrefix + correlationID
+	s, err := c.SubscribeContext(ctx, replyTo)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Unsubscribe()
+
+	c.mu.RLock()
+	var confirmed chan bool
+	if sub, exists := c.subscriptions[replyTo]; exists {
+		confirmed = sub.confirmed
+	}
+	c.mu.RUnlock()
+	select {
+	case <-confirmed:
+	case e := <-s.Errors():
+		return nil, fmt.Errorf("subscribing to the replies of %s: %s %s", topic, e.Name, e.Arg)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("subscribing to the replies of %s: %v", topic, ctx.Err())
+	}
+
+	request := &protocol.Message{}
+	if err := request.SetReplyTo(replyTo); err != nil {
+		return nil, err
+	}
+	if err := request.SetCorrelationID(correlationID); err != nil {
+		return nil, err
+	}
+	if err := c.SendContext(ctx, topic, body, request.HeaderJSON); err != nil {
+		return nil, err
+	}
+
+	select {
+	case m := <-s.Messages():
+		return m, nil
+	case e := <-s.Errors():
+		return nil, fmt.Errorf("waiting for the reply to %s: %s %s", topic, e.Name, e.Arg)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for the reply to %s: %v", topic, ctx.Err())
+	}
+}
+
+// Reply publishes the body to the reply-to path of the request, with the correlation ID of the request.
+func (c *client) Reply(request *protocol.Message, body string) error {
+	if request.ReplyTo == "" {
+		return ErrNoReplyTo
+	}
+	reply := request.NewReply([]byte(body))
+	return c.Send(string(reply.Path), body, reply.HeaderJSON)
+}
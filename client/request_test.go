@@ -0,0 +1,63 @@
+package client
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequest(t *testing.T) {
+	a := assert.New(t)
+
+	// given a client, connected to a server confirming the subscriptions, and to a responder of /echo
+	// replying to the requests on their reply-to paths
+	var subscribed string
+	conn := &serverConnection{
+		reads: make(chan []byte, 10),
+		answer: func(cmd string) string {
+			parts := strings.SplitN(cmd, "\n", 3)
+			args := strings.Fields(parts[0])
+			switch {
+			case args[0] == "+":
+				subscribed = args[1]
+				return "#subscribed-to " + args[1]
+			case args[0] == ">" && args[1] == "/echo":
+				request := &protocol.Message{HeaderJSON: parts[1]}
+				request.ParseCorrelation()
+				a.Equal(subscribed, request.ReplyTo)
+				a.Equal(ReplyPrefix+request.CorrelationID, request.ReplyTo)
+				reply := request.NewReply([]byte(parts[2]))
+				return request.ReplyTo + ",42,responder,app,{},1420110000,1\n" + reply.HeaderJSON + "\n" + parts[2]
+			}
+			return ""
+		},
+	}
+	c := New("url", "origin", 10, false)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		return conn, nil
+	})
+	a.NoError(c.Start())
+	defer c.Close()
+
+	// when sending a request
+	reply, err := c.Request("/echo", "ping", time.Second)
+
+	// then the reply is returned
+	a.NoError(err)
+	a.Equal("ping", string(reply.Body))
+	a.True(strings.HasPrefix(subscribed, ReplyPrefix))
+	a.Equal(protocol.Path(subscribed), reply.Path)
+	a.Equal(ReplyPrefix+reply.CorrelationID, subscribed)
+
+	// and the requests without replies time out
+	_, err = c.Request("/nobody", "ping", time.Millisecond*10)
+	a.Error(err)
+
+	// and only the messages with a reply-to path can be replied to
+	a.Equal(ErrNoReplyTo, c.Reply(reply, "pong"))
+	a.NoError(c.Reply(&protocol.Message{ReplyTo: "/replies/1"}, "pong"))
+}
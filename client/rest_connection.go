@@ -0,0 +1,348 @@
+package client
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// maxEventSize is the maximum size of the lines of the server-sent events of the REST transport.
+	maxEventSize = 10 * 1024 * 1024
+
+	// binaryEvent is the type of the events with the base64 encoded messages of binary bodies
+	binaryEvent = "binary"
+)
+
+var (
+	errRESTConnectionClosed = errors.New("REST connection closed")
+	errRESTFetch            = errors.New("fetching is not supported by the REST transport")
+)
+
+// restConnection is a WSConnection over the REST API of the server, for the networks where the websockets
+// can not be established (e.g. behind proxies): the send commands are published with POST requests,
+// and the receive commands open server-sent event streams, whose messages are read like the ones of a websocket.
+// The fetch-only receive commands and the negative start IDs are not supported.
+type restConnection struct {
+	httpClient *http.Client
+	url        string
+	userID     string
+	header     http.Header
+
+	readC     chan []byte
+	closed    chan bool
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	err     error
+	streams map[string]context.CancelFunc
+}
+
+// newRESTConnection checks that the REST API at the URL of the config is available, and returns a connection to it
+// for the user of the websocket URL.
+func newRESTConnection(config DialConfig, wsURL string, origin string) (*restConnection, error) {
+	c := &restConnection{
+		httpClient: &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config.TLSConfig,
+		}},
+		url:     strings.TrimSuffix(config.RESTURL, "/"),
+		userID:  userIDOf(wsURL),
+		header:  config.header(origin),
+		readC:   make(chan []byte, 10),
+		closed:  make(chan bool),
+		streams: make(map[string]context.CancelFunc),
+	}
+
+	resp, err := c.do(context.Background(), http.MethodHead, c.url+"/message/", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("REST API at %s not available: %s", c.url, resp.Status)
+	}
+
+	c.notify(&protocol.NotificationMessage{
+		Name: protocol.SUCCESS_CONNECTED,
+		Arg:  "You are connected to the server.",
+		Json: fmt.Sprintf(`{"UserId": "%s"}`, c.userID),
+	})
+	return c, nil
+}
+
+// userIDOf returns the user ID of a websocket URL like ws://host/stream/user/<user ID>.
+func userIDOf(wsURL string) string {
+	parts := strings.SplitN(wsURL, "/user/", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func (c *restConnection) WriteMessage(messageType int, data []byte) error {
+	cmd, err := protocol.ParseCmd(data)
+	if err != nil {
+		return err
+	}
+	switch cmd.Name {
+	case protocol.CmdSend:
+		return c.send(cmd)
+	case protocol.CmdReceive:
+		return c.subscribe(cmd)
+	case protocol.CmdCancel:
+		c.cancel(cmd.Arg)
+		return nil
+	}
+	return fmt.Errorf("command not supported by the REST transport: %s", cmd.Name)
+}
+
+func (c *restConnection) ReadMessage() (int, []byte, error) {
+	select {
+	case message := <-c.readC:
+		return websocket.BinaryMessage, message, nil
+	case <-c.closed:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return 0, nil, c.err
+	}
+}
+
+func (c *restConnection) Close() error {
+	c.closeWithError(errRESTConnectionClosed)
+	return nil
+}
+
+// closeWithError closes the connection, ending all the streams, with the error returned by the following reads.
+func (c *restConnection) closeWithError(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		for path, cancel := range c.streams {
+			cancel()
+			delete(c.streams, path)
+		}
+		c.mu.Unlock()
+		close(c.closed)
+	})
+}
+
+// send publishes the message, and passes the receipt to the reads like the server does.
+// The rejected messages are returned as errors.
+func (c *restConnection) send(cmd *protocol.Cmd) error {
+	args := strings.Fields(cmd.Arg)
+	if len(args) == 0 {
+		return fmt.Errorf("send command without path")
+	}
+	query := url.Values{"userId": {c.userID}}
+	publisherMessageID := ""
+	if len(args) > 1 {
+		publisherMessageID = args[1]
+		query.Set("messageId", publisherMessageID)
+	}
+	header := http.Header{"Accept": {"application/json"}}
+	if cmd.HeaderJSON != "" {
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(cmd.HeaderJSON), &fields); err != nil {
+			return fmt.Errorf("invalid header of the message to %s: %v", args[0], err)
+		}
+		for name, value := range fields {
+			header.Set("X-Guble-"+name, value)
+		}
+	}
+
+	resp, err := c.do(context.Background(), http.MethodPost, c.url+"/message"+args[0]+"?"+query.Encode(), header, cmd.Body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("message to %s not sent: %s %s", args[0], resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	n := &protocol.NotificationMessage{Name: protocol.SUCCESS_SEND}
+	if publisherMessageID != "" {
+		n.Arg = publisherMessageID
+		n.Json = strings.TrimSpace(string(body))
+	}
+	c.notify(n)
+	return nil
+}
+
+// subscribe opens the stream of the path (instead of its previous one, if any), and reads it in a go routine.
+// The refusals of the server are passed to the reads like the ones of the websocket.
+func (c *restConnection) subscribe(cmd *protocol.Cmd) error {
+	args := strings.Fields(cmd.Arg)
+	if len(args) == 0 {
+		return fmt.Errorf("receive command without path")
+	}
+	if len(args) > 2 || len(args) == 2 && strings.HasPrefix(args[1], "-") {
+		return errRESTFetch
+	}
+	path := args[0]
+
+	query := url.Values{"userId": {c.userID}}
+	if len(args) == 2 {
+		query.Set("since", args[1])
+	}
+	if cmd.HeaderJSON != "" {
+		var filters map[string]string
+		if err := json.Unmarshal([]byte(cmd.HeaderJSON), &filters); err != nil {
+			return fmt.Errorf("invalid filters of %s: %v", path, err)
+		}
+		for name, value := range filters {
+			query.Set(filterParam(name), value)
+		}
+	}
+
+	c.cancelStream(path)
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, err := c.do(ctx, http.MethodGet, c.url+"/stream"+path+"?"+query.Encode(), http.Header{"Accept": {"text/event-stream"}}, nil)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		c.notify(&protocol.NotificationMessage{
+			Name:    protocol.ERROR_SUBSCRIBED_TO,
+			Arg:     path + " " + strings.TrimSpace(string(body)),
+			IsError: true,
+		})
+		return nil
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		resp.Body.Close()
+		cancel()
+		return c.err
+	}
+	c.streams[path] = cancel
+	c.mu.Unlock()
+	c.notify(&protocol.NotificationMessage{Name: protocol.SUCCESS_SUBSCRIBED_TO, Arg: path})
+	go c.readStream(ctx, path, resp)
+	return nil
+}
+
+// filterParam returns the query parameter of a filter, e.g. filterDeviceId for device_id.
+func filterParam(name string) string {
+	param := "filter"
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			param += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return param
+}
+
+// readStream passes the messages of the server-sent events to the reads. If the stream ends without being canceled,
+// the connection is closed, so that the client connects and subscribes again.
+func (c *restConnection) readStream(ctx context.Context, path string, resp *http.Response) {
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+	var (
+		eventType string
+		data      []string
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				c.deliverEvent(eventType, strings.Join(data, "\n"))
+			}
+			eventType, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = fmt.Errorf("stream of %s ended", path)
+	}
+	logger.WithError(err).WithField("path", path).Warn("Closing the REST connection")
+	c.closeWithError(err)
+}
+
+// deliverEvent passes the message of an event to the reads, decoding the base64 data of the binary events.
+func (c *restConnection) deliverEvent(eventType string, data string) {
+	if eventType != binaryEvent {
+		c.deliver([]byte(data))
+		return
+	}
+	message, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		logger.WithError(err).Error("Error on decoding of a binary event")
+		return
+	}
+	c.deliver(message)
+}
+
+// cancel ends the stream of the path, and confirms it like the server does.
+func (c *restConnection) cancel(path string) {
+	c.cancelStream(path)
+	c.notify(&protocol.NotificationMessage{Name: protocol.SUCCESS_CANCELED, Arg: path})
+}
+
+func (c *restConnection) cancelStream(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, exists := c.streams[path]; exists {
+		cancel()
+		delete(c.streams, path)
+	}
+}
+
+func (c *restConnection) do(ctx context.Context, method, rawURL string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return c.httpClient.Do(req)
+}
+
+func (c *restConnection) notify(n *protocol.NotificationMessage) {
+	c.deliver(n.Bytes())
+}
+
+func (c *restConnection) deliver(message []byte) {
+	select {
+	case c.readC <- message:
+	case <-c.closed:
+	}
+}
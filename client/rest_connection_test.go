@@ -0,0 +1,111 @@
+package client
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRESTConnection(t *testing.T) {
+	a := assert.New(t)
+
+	// given a REST API publishing with receipts, and streaming a text and a binary message of /foo
+	binaryMessage := &protocol.Message{ID: 43, Path: "/foo", Body: []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x00}}
+	a.NoError(binaryMessage.SetContentType("image/png"))
+	published := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead:
+		case r.Method == http.MethodPost && r.URL.Path == "/api/message/foo":
+			body, _ := ioutil.ReadAll(r.Body)
+			a.Equal("Hello", string(body))
+			a.Equal("application/json", r.Header.Get("Accept"))
+			published <- r
+			fmt.Fprintf(w, `{"sequenceId":42,"path":"/foo","publisherMessageId":"%s"}`, r.URL.Query().Get("messageId"))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/stream/foo":
+			a.Equal("marvin", r.URL.Query().Get("userId"))
+			a.Equal("5", r.URL.Query().Get("since"))
+			a.Equal("d1", r.URL.Query().Get("filterDeviceId"))
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ":\n\nid: 42\n")
+			for _, line := range []string{"/foo,42,user01,phone01,{},1420110000,1", "{}", "Hello", "World"} {
+				fmt.Fprintf(w, "data: %s\n", line)
+			}
+			fmt.Fprint(w, "\n")
+			fmt.Fprintf(w, "id: 43\nevent: binary\ndata: %s\n\n", base64.StdEncoding.EncodeToString(binaryMessage.Bytes()))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// and a client falling back to it
+	config := DialConfig{Token: "secret", RESTURL: server.URL + "/api/"}
+	c := New("ws://localhost/stream/user/marvin", "origin", 10, false)
+	c.SetWSConnectionFactory(func(url string, origin string) (WSConnection, error) {
+		return newRESTConnection(config, url, origin)
+	})
+	a.NoError(c.Start())
+	defer c.Close()
+
+	// when sending and waiting for the receipt
+	id, err := c.SendAndWait("/foo", "Hello", time.Second)
+
+	// then the message is published for the user of the client
+	a.NoError(err)
+	a.Equal(uint64(42), id)
+	r := <-published
+	a.Equal("marvin", r.URL.Query().Get("userId"))
+	a.Equal("Bearer secret", r.Header.Get("Authorization"))
+
+	// and the messages of the subscriptions are received from the streams
+	a.NoError(c.SubscribeWithFilters("/foo 5", map[string]string{"device_id": "d1"}))
+	select {
+	case m := <-c.Messages():
+		a.Equal(uint64(42), m.ID)
+		a.Equal("Hello\nWorld", string(m.Body))
+	case <-time.After(time.Second):
+		a.Fail("timeout while waiting for message")
+	}
+	select {
+	case m := <-c.Messages():
+		a.Equal(binaryMessage.Body, m.Body)
+		a.Equal("image/png", m.ContentType)
+	case <-time.After(time.Second):
+		a.Fail("timeout while waiting for message")
+	}
+
+	// and the fetches are not supported
+	_, err = c.Fetch("/foo", 0, 10)
+	a.Equal(errRESTFetch, err)
+
+	// and the refused subscriptions are notified like the ones of the websocket
+	a.NoError(c.Subscribe("/bar"))
+	select {
+	case e := <-c.Errors():
+		a.Equal(protocol.ERROR_SUBSCRIBED_TO, e.Name)
+		a.Contains(e.Arg, "/bar")
+	case <-time.After(time.Second):
+		a.Fail("timeout while waiting for error")
+	}
+}
+
+func TestRESTConnection_Unavailable(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := newRESTConnection(DialConfig{RESTURL: server.URL + "/api"}, "ws://localhost/stream/user/marvin", "origin")
+	a.Error(err)
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"strconv"
+	"strings"
+)
+
+// MessageHandler is called with each message of a subscription.
+type MessageHandler func(*protocol.Message)
+
+// ErrorHandler is called with each error of a subscription, and with the errors of the connection.
+type ErrorHandler func(*protocol.NotificationMessage)
+
+// Subscription is a logical subscription to a path, sharing the connection of its client with the other ones.
+// It receives the messages and the errors of the path (and the errors of the connection) on its own channels,
+// until it is unsubscribed.
+type Subscription interface {
+	Messages() <-chan *protocol.Message
+	Errors() <-chan *protocol.NotificationMessage
+	Unsubscribe() error
+}
+
+// subscription is a receive command subscribing to a path, and the ID of the last message received on it (or 0).
+// Its messages are passed to its listeners, and to the Messages channel of the client if subscribed with Subscribe.
+type subscription struct {
+	arg       string
+	filters   string
+	lastID    uint64
+	resuming  bool
+	channel   bool
+	listeners []*listener
+	// confirmed is closed when the server confirmed the subscription
+	confirmed chan bool
+}
+
+func (s *subscription) confirm() {
+	select {
+	case <-s.confirmed:
+	default:
+		close(s.confirmed)
+	}
+}
+
+// cmd returns the command subscribing again, from the message following the last one received (if any).
+func (s *subscription) cmd() *protocol.Cmd {
+	arg := s.arg
+	if s.lastID > 0 {
+		arg = strings.Fields(s.arg)[0] + " " + strconv.FormatUint(s.lastID+1, 10)
+	}
+	return &protocol.Cmd{
+		Name:       protocol.CmdReceive,
+		Arg:        arg,
+		HeaderJSON: s.filters,
+	}
+}
+
+// remove returns false if the listener is not one of the subscription.
+func (s *subscription) remove(l *listener) bool {
+	for i, other := range s.listeners {
+		if other == l {
+			s.listeners = append(s.listeners[:i], s.listeners[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// listener is a logical subscription, receiving the messages of a subscription on its channels,
+// or passing them to its handlers in its own go routine.
+type listener struct {
+	client   *client
+	path     string
+	handler  MessageHandler
+	onError  ErrorHandler
+	messageC chan *protocol.Message
+	errorC   chan *protocol.NotificationMessage
+	done     chan bool
+}
+
+func (l *listener) Messages() <-chan *protocol.Message {
+	return l.messageC
+}
+
+func (l *listener) Errors() <-chan *protocol.NotificationMessage {
+	return l.errorC
+}
+
+// Unsubscribe ends the logical subscription. The path is unsubscribed from the server
+// only when it has no other subscription.
+func (l *listener) Unsubscribe() error {
+	return l.client.removeListener(l)
+}
+
+func (l *listener) run() {
+	for {
+		select {
+		case m := <-l.messageC:
+			l.handler(m)
+		case e := <-l.errorC:
+			l.onError(e)
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *listener) deliverMessage(m *protocol.Message) {
+	select {
+	case l.messageC <- m:
+	case <-l.done:
+	}
+}
+
+// deliverError drops the errors if the listener has no error channel, or if it is full.
+func (l *listener) deliverError(e *protocol.NotificationMessage) {
+	select {
+	case l.errorC <- e:
+	default:
+	}
+}
+
+func (l *listener) stop() {
+	close(l.done)
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"github.com/smancke/guble/testutil"
+
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenSubscription_SharesTheConnection(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	// given a client
+	c := New("url", "origin", 10, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+
+	// which subscribes each path once, and unsubscribes it after its last subscription
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /foo"))
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /bar 5"))
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("- /foo"))
+	subscribed := make(chan bool)
+	received := connMock.EXPECT().ReadMessage().Do(func() { <-subscribed }).
+		Return(websocket.BinaryMessage, []byte(aNormalMessage), nil)
+	closed := make(chan bool, 1)
+	connMock.EXPECT().ReadMessage().After(received).Do(func() { <-closed }).
+		Return(0, nil, fmt.Errorf("closed"))
+	connMock.EXPECT().Close().Do(func() { closed <- true })
+
+	a.NoError(c.Start())
+
+	// when opening two subscriptions to the same path, and another one
+	first, err := c.OpenSubscription("/foo")
+	a.NoError(err)
+	second, err := c.OpenSubscription("/foo")
+	a.NoError(err)
+	other, err := c.OpenSubscription("/bar 5")
+	a.NoError(err)
+	close(subscribed)
+
+	// then the message is received by both subscriptions to its path
+	for _, s := range []Subscription{first, second} {
+		select {
+		case m := <-s.Messages():
+			a.Equal(uint64(42), m.ID)
+		case <-time.After(time.Millisecond * 100):
+			a.Fail("timeout while waiting for message")
+		}
+	}
+
+	// and not by the other subscription, nor the channel of the client
+	select {
+	case <-other.Messages():
+		a.Fail("unexpected message")
+	case <-c.Messages():
+		a.Fail("unexpected message")
+	case <-time.After(time.Millisecond * 10):
+	}
+
+	// and the path is unsubscribed only after both subscriptions
+	a.NoError(first.Unsubscribe())
+	a.NoError(first.Unsubscribe())
+	a.NoError(second.Unsubscribe())
+
+	c.Close()
+}
+
+func TestOpenSubscription_ErrorsAndInvalidPaths(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	c := New("url", "origin", 10, false)
+	connMock := NewMockWSConnection(ctrl)
+	c.SetWSConnectionFactory(MockConnectionFactory(connMock))
+
+	connMock.EXPECT().WriteMessage(websocket.BinaryMessage, []byte("+ /foo"))
+	subscribed := make(chan bool)
+	expectReads(connMock, subscribed,
+		"!error-subscribed-to /foo not allowed",
+		"!error-bad-request unknown command")
+	connMock.EXPECT().Close()
+
+	a.NoError(c.Start())
+
+	s, err := c.OpenSubscription("/foo")
+	a.NoError(err)
+	close(subscribed)
+
+	// the errors of its path are received by the subscription, the other ones by the client
+	select {
+	case e := <-s.Errors():
+		a.Equal("error-subscribed-to", e.Name)
+	case <-time.After(time.Millisecond * 100):
+		a.Fail("timeout while waiting for error")
+	}
+	select {
+	case e := <-c.Errors():
+		a.Equal("error-bad-request", e.Name)
+	case <-time.After(time.Millisecond * 100):
+		a.Fail("timeout while waiting for error")
+	}
+
+	_, err = c.OpenSubscription("/foo 0 10")
+	a.Error(err)
+	_, err = c.OpenSubscription("")
+	a.Error(err)
+
+	c.Close()
+}
+
+// expectReads expects the reads of the messages once subscribed, and then a failing read.
+func expectReads(connMock *MockWSConnection, subscribed chan bool, messages ...string) {
+	previous := connMock.EXPECT().ReadMessage().Do(func() { <-subscribed }).
+		Return(websocket.BinaryMessage, []byte(messages[0]), nil)
+	for _, m := range messages[1:] {
+		previous = connMock.EXPECT().ReadMessage().After(previous).
+			Return(websocket.BinaryMessage, []byte(m), nil)
+	}
+	connMock.EXPECT().ReadMessage().After(previous).
+		Return(0, nil, fmt.Errorf("closed")).AnyTimes()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"github.com/smancke/guble/client"
+	"github.com/smancke/guble/protocol"
+
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	benchSubscribeTimeout = 10 * time.Second
+	benchDrainTimeout     = 5 * time.Second
+)
+
+type benchConfig struct {
+	topic       string
+	publishers  int
+	subscribers int
+	rate        int
+	duration    time.Duration
+	size        int
+}
+
+// benchResult holds the counters and the latencies of a load test.
+type benchResult struct {
+	sent      uint64
+	failed    uint64
+	received  uint64
+	published time.Duration
+
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+func (r *benchResult) receive(m *protocol.Message) {
+	atomic.AddUint64(&r.received, 1)
+	fields := strings.SplitN(string(m.Body), " ", 2)
+	sentAt, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return
+	}
+	latency := time.Since(time.Unix(0, sentAt))
+	r.mu.Lock()
+	r.latencies = append(r.latencies, latency)
+	r.mu.Unlock()
+}
+
+// runBench connects the subscribers to the topic, publishes the messages at the rate for the duration,
+// waits for the pending messages, and reports the throughput and the latency percentiles.
+// The latency is measured from the publishing time written at the start of the bodies,
+// so the publishers and the subscribers have to run on the same host (as they do here).
+func runBench(config benchConfig, connect func(userID string) (client.Client, error), w io.Writer) error {
+	if config.publishers <= 0 || config.subscribers < 0 || config.rate <= 0 || config.duration <= 0 {
+		return errors.New("the publishers, the rate and the duration have to be positive")
+	}
+	result := &benchResult{}
+	var clients []client.Client
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+
+	subscribed := make(chan bool, config.subscribers)
+	for i := 0; i < config.subscribers; i++ {
+		c, err := connect(fmt.Sprintf("sub-%d", i))
+		if err != nil {
+			return err
+		}
+		clients = append(clients, c)
+		c.AddEventListener(client.EventListenerFunc(func(e client.Event) {
+			if e.Type == client.EventSubscribed && e.Path == config.topic {
+				subscribed <- true
+			}
+		}))
+		if err := c.SubscribeFunc(config.topic, result.receive, nil); err != nil {
+			return err
+		}
+	}
+	timeout := time.After(benchSubscribeTimeout)
+	for i := 0; i < config.subscribers; i++ {
+		select {
+		case <-subscribed:
+		case <-timeout:
+			return fmt.Errorf("only %d of %d subscribers were subscribed to %s", i, config.subscribers, config.topic)
+		}
+	}
+
+	publishers := make([]client.Client, 0, config.publishers)
+	for i := 0; i < config.publishers; i++ {
+		c, err := connect(fmt.Sprintf("pub-%d", i))
+		if err != nil {
+			return err
+		}
+		clients = append(clients, c)
+		publishers = append(publishers, c)
+	}
+
+	interval := time.Duration(int64(time.Second) * int64(config.publishers) / int64(config.rate))
+	padding := strings.Repeat("x", config.size)
+	start := time.Now()
+	deadline := start.Add(config.duration)
+	var wg sync.WaitGroup
+	for _, c := range publishers {
+		wg.Add(1)
+		go func(c client.Client) {
+			defer wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for now := range ticker.C {
+				if now.After(deadline) {
+					return
+				}
+				body := strconv.FormatInt(time.Now().UnixNano(), 10) + " "
+				if len(body) < config.size {
+					body += padding[:config.size-len(body)]
+				}
+				if err := c.Send(config.topic, body, ""); err != nil {
+					atomic.AddUint64(&result.failed, 1)
+					continue
+				}
+				atomic.AddUint64(&result.sent, 1)
+			}
+		}(c)
+	}
+	wg.Wait()
+	result.published = time.Since(start)
+
+	expected := atomic.LoadUint64(&result.sent) * uint64(config.subscribers)
+	drained := time.Now().Add(benchDrainTimeout)
+	for atomic.LoadUint64(&result.received) < expected && time.Now().Before(drained) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return result.report(w, expected)
+}
+
+func (r *benchResult) report(w io.Writer, expected uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seconds := r.published.Seconds()
+	sent, received := atomic.LoadUint64(&r.sent), atomic.LoadUint64(&r.received)
+	fmt.Fprintf(w, "published: %d messages in %v (%.1f msg/s), %d failed\n",
+		sent, r.published.Round(time.Millisecond), float64(sent)/seconds, atomic.LoadUint64(&r.failed))
+	fmt.Fprintf(w, "received:  %d of %d messages (%.1f msg/s)\n", received, expected, float64(received)/seconds)
+	if len(r.latencies) == 0 {
+		_, err := fmt.Fprintln(w, "latency:   no messages received")
+		return err
+	}
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	_, err := fmt.Fprintf(w, "latency:   p50 %v, p90 %v, p99 %v, max %v\n",
+		percentile(r.latencies, 50), percentile(r.latencies, 90), percentile(r.latencies, 99), r.latencies[len(r.latencies)-1])
+	return err
+}
+
+// percentile returns the p-th percentile of the sorted durations (nearest rank).
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Round(time.Microsecond)
+}
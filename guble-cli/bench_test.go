@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/smancke/guble/client"
+	"github.com/smancke/guble/protocol"
+
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loopbackClient delivers the messages sent by any of the clients of its broker to their subscribers.
+type loopbackClient struct {
+	client.Client
+	broker *loopbackBroker
+}
+
+type loopbackBroker struct {
+	mu       sync.Mutex
+	handlers []client.MessageHandler
+	closed   int
+}
+
+func (c *loopbackClient) AddEventListener(l client.EventListener) {
+	go l.OnEvent(client.Event{Type: client.EventSubscribed, Path: "/load"})
+}
+
+func (c *loopbackClient) SubscribeFunc(path string, handler client.MessageHandler, onError client.ErrorHandler) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.broker.handlers = append(c.broker.handlers, handler)
+	return nil
+}
+
+func (c *loopbackClient) Send(path string, body string, header string) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	for _, handler := range c.broker.handlers {
+		handler(&protocol.Message{Path: protocol.Path(path), Body: []byte(body)})
+	}
+	return nil
+}
+
+func (c *loopbackClient) Close() {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.broker.closed++
+}
+
+func Test_runBench(t *testing.T) {
+	a := assert.New(t)
+
+	broker := &loopbackBroker{}
+	var users []string
+	connect := func(userID string) (client.Client, error) {
+		users = append(users, userID)
+		return &loopbackClient{broker: broker}, nil
+	}
+
+	buff := &bytes.Buffer{}
+	a.NoError(runBench(benchConfig{
+		topic:       "/load",
+		publishers:  2,
+		subscribers: 3,
+		rate:        200,
+		duration:    100 * time.Millisecond,
+		size:        50,
+	}, connect, buff))
+
+	a.Equal([]string{"sub-0", "sub-1", "sub-2", "pub-0", "pub-1"}, users)
+	a.Equal(5, broker.closed)
+	lines := strings.Split(buff.String(), "\n")
+	a.Len(lines, 4)
+	a.True(strings.HasPrefix(lines[0], "published: "), lines[0])
+	a.True(strings.HasSuffix(lines[0], ", 0 failed"), lines[0])
+	a.True(strings.HasPrefix(lines[1], "received:  "), lines[1])
+	a.True(strings.HasPrefix(lines[2], "latency:   p50 "), lines[2])
+
+	a.Error(runBench(benchConfig{topic: "/load", publishers: 0, rate: 1, duration: time.Second}, connect, buff))
+}
+
+func Test_percentile(t *testing.T) {
+	a := assert.New(t)
+
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	a.Equal(50*time.Millisecond, percentile(sorted, 50))
+	a.Equal(99*time.Millisecond, percentile(sorted, 99))
+	a.Equal(time.Millisecond, percentile(sorted[:1], 99))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/smancke/guble/client"
+	"github.com/smancke/guble/protocol"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// fetchedMessage is the JSON output of a fetched message.
+type fetchedMessage struct {
+	ID            uint64          `json:"id"`
+	Path          string          `json:"path"`
+	UserID        string          `json:"userId"`
+	ApplicationID string          `json:"applicationId"`
+	Time          time.Time       `json:"time"`
+	Header        json.RawMessage `json:"header,omitempty"`
+	Body          string          `json:"body,omitempty"`
+	BinaryBody    []byte          `json:"binaryBody,omitempty"`
+}
+
+func runFetch(c client.Client, w io.Writer) error {
+	start, since, err := fetchStart(*fetchLast, *fetchSince, time.Now())
+	if err != nil {
+		return err
+	}
+	messages, err := c.Fetch(*fetchTopic, start, 0)
+	if err != nil {
+		return err
+	}
+	return printMessages(w, messages, since, *jsonOutput)
+}
+
+// fetchStart returns the start of the fetch for the --last and --since options, and the time
+// since which the fetched messages are printed (the server fetches them by ID only).
+func fetchStart(last int, since string, now time.Time) (int64, time.Time, error) {
+	if last < 0 {
+		return 0, time.Time{}, errors.New("--last has to be positive")
+	}
+	if last > 0 && since != "" {
+		return 0, time.Time{}, errors.New("--last and --since can not be used together")
+	}
+	if last > 0 {
+		return -int64(last), time.Time{}, nil
+	}
+	if since == "" {
+		return 0, time.Time{}, nil
+	}
+	if id, err := strconv.ParseUint(since, 10, 63); err == nil {
+		return int64(id), time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return 0, t, nil
+	}
+	if d, err := time.ParseDuration(since); err == nil && d > 0 {
+		return 0, now.Add(-d), nil
+	}
+	return 0, time.Time{}, fmt.Errorf("invalid --since %q: expected an ID, a time (RFC 3339) or a duration", since)
+}
+
+// printMessages prints the messages published since the time (if not zero), as text or as JSON lines.
+func printMessages(w io.Writer, messages []*protocol.Message, since time.Time, asJSON bool) error {
+	encoder := json.NewEncoder(w)
+	for _, m := range messages {
+		published := time.Unix(m.Time, 0).UTC()
+		if !since.IsZero() && published.Before(since) {
+			continue
+		}
+		if !asJSON {
+			body := m.BodyAsString()
+			if m.IsBinary() {
+				body = fmt.Sprintf("<%d bytes of %s>", len(m.Body), m.ContentType)
+			}
+			if _, err := fmt.Fprintf(w, "%d %s %s: %s\n", m.ID, published.Format(time.RFC3339), m.UserID, body); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := encoder.Encode(newFetchedMessage(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newFetchedMessage(m *protocol.Message) *fetchedMessage {
+	fetched := &fetchedMessage{
+		ID:            m.ID,
+		Path:          string(m.Path),
+		UserID:        m.UserID,
+		ApplicationID: m.ApplicationID,
+		Time:          time.Unix(m.Time, 0).UTC(),
+	}
+	if m.HeaderJSON != "" {
+		fetched.Header = json.RawMessage(m.HeaderJSON)
+	}
+	if m.IsBinary() {
+		fetched.BinaryBody = m.Body
+	} else {
+		fetched.Body = m.BodyAsString()
+	}
+	return fetched
+}
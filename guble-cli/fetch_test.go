@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_fetchStart(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for _, test := range []struct {
+		last  int
+		since string
+		start int64
+		after time.Time
+		fails bool
+	}{
+		{start: 0},
+		{last: 5, start: -5},
+		{since: "42", start: 42},
+		{since: "2017-01-02T10:00:00Z", after: time.Date(2017, 1, 2, 10, 0, 0, 0, time.UTC)},
+		{since: "1h", after: now.Add(-time.Hour)},
+		{since: "yesterday", fails: true},
+		{last: 5, since: "42", fails: true},
+		{last: -1, fails: true},
+	} {
+		start, after, err := fetchStart(test.last, test.since, now)
+		if test.fails {
+			a.Error(err, test.since)
+			continue
+		}
+		a.NoError(err, test.since)
+		a.Equal(test.start, start, test.since)
+		a.True(test.after.Equal(after), test.since)
+	}
+}
+
+func Test_printMessages(t *testing.T) {
+	a := assert.New(t)
+
+	image := &protocol.Message{ID: 3, Path: "/foo", UserID: "marvin", Time: 1483369445, Body: []byte{0, 1, 2}}
+	a.NoError(image.SetContentType("image/png"))
+	messages := []*protocol.Message{
+		{ID: 1, Path: "/foo", UserID: "arthur", Time: 1483369200, Body: []byte("too old")},
+		{ID: 2, Path: "/foo", UserID: "marvin", Time: 1483369445, HeaderJSON: `{"x":"y"}`, Body: []byte("Hello")},
+		image,
+	}
+	since := time.Unix(1483369400, 0)
+
+	// as text
+	buff := &bytes.Buffer{}
+	a.NoError(printMessages(buff, messages, since, false))
+	a.Equal("2 2017-01-02T15:04:05Z marvin: Hello\n3 2017-01-02T15:04:05Z marvin: <3 bytes of image/png>\n", buff.String())
+
+	// as JSON lines
+	buff.Reset()
+	a.NoError(printMessages(buff, messages, since, true))
+	decoder := json.NewDecoder(buff)
+	var text, binary fetchedMessage
+	a.NoError(decoder.Decode(&text))
+	a.NoError(decoder.Decode(&binary))
+	a.False(decoder.More())
+
+	a.Equal(uint64(2), text.ID)
+	a.Equal("/foo", text.Path)
+	a.Equal("marvin", text.UserID)
+	a.JSONEq(`{"x":"y"}`, string(text.Header))
+	a.Equal("Hello", text.Body)
+	a.True(time.Unix(1483369445, 0).Equal(text.Time))
+	a.Equal([]byte{0, 1, 2}, binary.BinaryBody)
+	a.Empty(binary.Body)
+}
@@ -2,25 +2,76 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/chzyer/readline"
 	"github.com/smancke/guble/client"
 	"github.com/smancke/guble/protocol"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
-	exit     = kingpin.Flag("exit", "Exit after sending the commands").Short('x').Bool()
-	commands = kingpin.Arg("commands", "The commands to send after startup").Strings()
-	verbose  = kingpin.Flag("verbose", "Display verbose server communication").Short('v').Bool()
-	url      = kingpin.Flag("url", "The websocket url to connect to").Default("ws://localhost:8080/stream/").String()
-	user     = kingpin.Flag("user", "The user name to connect with (guble-cli)").Short('u').Default("guble-cli").String()
-	logLevel = kingpin.Flag("log", "Log level").
+	interactive = kingpin.Command("interactive", "Send the commands, and then the lines of the standard input, to the server").Default()
+	commands    = interactive.Arg("commands", "The commands to send after startup").Strings()
+
+	fetch      = kingpin.Command("fetch", "Print the stored messages of a topic, and exit")
+	fetchTopic = fetch.Arg("topic", "The topic to fetch").Required().String()
+	fetchLast  = fetch.Flag("last", "Fetch the last N messages").Int()
+	fetchSince = fetch.Flag("since", "Fetch the messages from this ID, published since this time (RFC 3339) or since this duration ago (e.g. 1h)").String()
+
+	tail        = kingpin.Command("tail", "Print the last messages of a topic matching the filters, and the new ones with --follow")
+	tailTopic   = tail.Arg("topic", "The topic to tail").Required().String()
+	tailFilters = tail.Flag("filter", "A filter of the messages, as key=value (flag can be repeated)").Strings()
+	tailLast    = tail.Flag("last", "The number of stored messages printed first").Short('n').Default("10").Int()
+	tailFollow  = tail.Flag("follow", "Keep printing the new messages of the topic, until interrupted").Short('f').Bool()
+
+	publish      = kingpin.Command("publish", "Publish the messages of a file or of the standard input, one per line")
+	publishTopic = publish.Arg("topic", "The topic of the messages without a path").String()
+	publishFile  = publish.Flag("file", "The file of the messages (default: the standard input)").ExistingFile()
+	publishRate  = publish.Flag("rate", "The maximum number of messages published per second (0: unlimited)").Default("0").Int()
+	publishRaw   = publish.Flag("raw", "Publish each line as the body of a message, instead of reading the messages as JSON").Bool()
+
+	bench            = kingpin.Command("bench", "Publish and receive messages on a topic, and report the throughput and the latency")
+	benchTopic       = bench.Flag("topic", "The topic of the messages").Default("/load").String()
+	benchPublishers  = bench.Flag("publishers", "The number of publishing connections").Default("10").Int()
+	benchSubscribers = bench.Flag("subscribers", "The number of subscribed connections").Default("100").Int()
+	benchRate        = bench.Flag("rate", "The number of messages published per second, by all the publishers").Default("1000").Int()
+	benchDuration    = bench.Flag("duration", "The duration of the publishing").Default("10s").Duration()
+	benchSize        = bench.Flag("size", "The size of the message bodies, in bytes").Default("100").Int()
+
+	topics         = kingpin.Command("topics", "Administrate the stored topics, using the topics endpoint of the server")
+	topicsList     = topics.Command("list", "List the stored root topics, with their statistics")
+	topicsStats    = topics.Command("stats", "Print the statistics of a topic")
+	topicsStatsArg = topicsStats.Arg("path", "The topic").Required().String()
+	topicsPurge    = topics.Command("purge", "Delete the stored messages of a root topic")
+	topicsPurgeArg = topicsPurge.Arg("path", "The root topic").Required().String()
+	adminURL       = topics.Flag("admin-url", "The URL of the topics endpoint").Default("http://localhost:8080/admin/topics").Envar("GUBLE_ADMIN_URL").String()
+	adminUser      = topics.Flag("admin-user", "The user name of the basic auth of the admin endpoints").Default("admin").Envar("GUBLE_ADMIN_USER").String()
+	adminPassword  = topics.Flag("admin-password", "The password of the basic auth of the admin endpoints").Envar("GUBLE_ADMIN_PASSWORD").String()
+	adminAPIKey    = topics.Flag("admin-api-key", "The API key of the admin endpoints, sent in the header X-Admin-Key").Envar("GUBLE_ADMIN_API_KEY").String()
+
+	jsonOutput  = kingpin.Flag("json", "Print the output as JSON, one object per line; the JSON lines of the input are published").Bool()
+	exec        = kingpin.Flag("exec", "Publish the lines of the standard input, wait for their receipts and exit (implies --json)").Bool()
+	execTimeout = kingpin.Flag("exec-timeout", "The time to wait for the receipts at the end of the input, with --exec").Default("10s").Duration()
+
+	exit        = kingpin.Flag("exit", "Exit after sending the commands").Short('x').Bool()
+	historyFile = kingpin.Flag("history", "The file of the command history of the interactive mode on a terminal").Default(defaultHistoryFile()).Envar("GUBLE_HISTORY").String()
+	verbose     = kingpin.Flag("verbose", "Display verbose server communication").Short('v').Bool()
+	url         = kingpin.Flag("url", "The websocket url to connect to").Default("ws://localhost:8080/stream/").String()
+	user        = kingpin.Flag("user", "The user name to connect with (guble-cli)").Short('u').Default("guble-cli").String()
+	token       = kingpin.Flag("token", "The bearer token authenticating the connection").Envar("GUBLE_TOKEN").String()
+	caCert      = kingpin.Flag("ca-cert", "The CA certificates verifying the server of a wss:// url (PEM file)").ExistingFile()
+	insecure    = kingpin.Flag("insecure", "Do not verify the certificate of the server of a wss:// url").Bool()
+	logLevel    = kingpin.Flag("log", "Log level").
 			Short('l').
 			Default(log.ErrorLevel.String()).
 			Envar("GUBLE_LOG").
@@ -38,7 +89,7 @@ func logLevels() (levels []string) {
 
 // This is a minimal commandline client to connect through a websocket
 func main() {
-	kingpin.Parse()
+	command := kingpin.Parse()
 
 	// set log level
 	level, err := log.ParseLevel(*logLevel)
@@ -47,15 +98,126 @@ func main() {
 	}
 	log.SetLevel(level)
 
-	origin := "http://localhost/"
-	url := fmt.Sprintf("%v/user/%v", removeTrailingSlash(*url), *user)
-	client, err := client.Open(url, origin, 100, true)
+	tlsConfig, err := newTLSConfig(*caCert, *insecure)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if strings.HasPrefix(command, topics.FullCommand()+" ") {
+		if err := runTopics(command, newTopicsClient(tlsConfig), os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	connect := func(userID string, autoReconnect bool) (client.Client, error) {
+		url := fmt.Sprintf("%v/user/%v", removeTrailingSlash(*url), userID)
+		return client.OpenWithConfig(url, "http://localhost/", 100, autoReconnect, client.DialConfig{
+			TLSConfig: tlsConfig,
+			Token:     *token,
+		})
+	}
+	if command == bench.FullCommand() {
+		config := benchConfig{
+			topic:       *benchTopic,
+			publishers:  *benchPublishers,
+			subscribers: *benchSubscribers,
+			rate:        *benchRate,
+			duration:    *benchDuration,
+			size:        *benchSize,
+		}
+		if err := runBench(config, func(userID string) (client.Client, error) {
+			return connect(*user+"-"+userID, false)
+		}, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	client, err := connect(*user, command == interactive.FullCommand() || (command == tail.FullCommand() && *tailFollow))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if command == publish.FullCommand() {
+		in := os.Stdin
+		if *publishFile != "" {
+			if in, err = os.Open(*publishFile); err != nil {
+				log.Fatal(err)
+			}
+			defer in.Close()
+		}
+		err = runPublish(client, publishConfig{
+			topic: *publishTopic,
+			rate:  *publishRate,
+			raw:   *publishRaw,
+		}, in, os.Stdout)
+		client.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == tail.FullCommand() {
+		filters, err := parseFilters(*tailFilters)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = runTail(client, tailConfig{
+			topic:   *tailTopic,
+			filters: filters,
+			last:    *tailLast,
+			follow:  *tailFollow,
+			asJSON:  *jsonOutput,
+			userID:  *user,
+		}, os.Stdout, nil)
+		client.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == fetch.FullCommand() {
+		err := runFetch(client, os.Stdout)
+		client.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *exec || *jsonOutput {
+		s := newScript(client, os.Stdout)
+		for _, cmd := range *commands {
+			client.WriteRawMessage([]byte(cmd))
+		}
+		if *exec {
+			err := s.run(os.Stdin, *execTimeout)
+			client.Close()
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		go s.printLoop(nil)
+		go func() {
+			if err := s.read(os.Stdin); err != nil {
+				logger.WithError(err).Error("Error on reading the standard input")
+			}
+		}()
+		waitForTermination(func() {})
+	}
+
+	if !*exit && readline.IsTerminal(int(os.Stdin.Fd())) {
+		if err := runShell(client, *commands, *historyFile); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	go writeLoop(client)
-	go readLoop(client)
+	go readLoop(client, os.Stdout, nil)
 
 	for _, cmd := range *commands {
 		client.WriteRawMessage([]byte(cmd))
@@ -66,20 +228,24 @@ func main() {
 	waitForTermination(func() {})
 }
 
-func readLoop(client client.Client) {
+// readLoop prints the messages and the notifications received by the client, calling received for each message if not nil.
+func readLoop(client client.Client, w io.Writer, received func(m *protocol.Message)) {
 	for {
 		select {
 		case incomingMessage := <-client.Messages():
+			if received != nil {
+				received(incomingMessage)
+			}
 			if *verbose {
-				fmt.Println(string(incomingMessage.Bytes()))
+				fmt.Fprintln(w, string(incomingMessage.Bytes()))
 			} else {
-				fmt.Printf("%v: %v\n", incomingMessage.UserID, incomingMessage.BodyAsString())
+				fmt.Fprintf(w, "%v: %v\n", incomingMessage.UserID, incomingMessage.BodyAsString())
 			}
 		case e := <-client.Errors():
-			fmt.Println("ERROR: " + string(e.Bytes()))
+			fmt.Fprintln(w, "ERROR: "+string(e.Bytes()))
 		case status := <-client.StatusMessages():
-			fmt.Println(string(status.Bytes()))
-			fmt.Println()
+			fmt.Fprintln(w, string(status.Bytes()))
+			fmt.Fprintln(w)
 		}
 	}
 }
@@ -154,6 +320,25 @@ func printHelp() {
 `)
 }
 
+// newTLSConfig returns the TLS configuration of the connection, or nil for the default one.
+func newTLSConfig(caCert string, insecure bool) (*tls.Config, error) {
+	if caCert == "" && !insecure {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if caCert != "" {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", caCert)
+		}
+	}
+	return config, nil
+}
+
 func removeTrailingSlash(path string) string {
 	if len(path) > 1 && path[len(path)-1] == '/' {
 		return path[:len(path)-1]
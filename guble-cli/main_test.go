@@ -52,3 +52,24 @@ func Test_removeTrailingSlash(t *testing.T) {
 		assert.Equal(t, c.expected, removeTrailingSlash(c.path), fmt.Sprintf("Failed at  case no=%d", i))
 	}
 }
+
+func Test_newTLSConfig(t *testing.T) {
+	a := assert.New(t)
+
+	config, err := newTLSConfig("", false)
+	a.NoError(err)
+	a.Nil(config)
+
+	config, err = newTLSConfig("", true)
+	a.NoError(err)
+	a.True(config.InsecureSkipVerify)
+
+	file, err := ioutil.TempFile("", "guble-cli")
+	a.NoError(err)
+	defer os.Remove(file.Name())
+	file.WriteString("no certificate")
+	file.Close()
+
+	_, err = newTLSConfig(file.Name(), false)
+	a.Error(err)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/smancke/guble/client"
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// publishConfig are the options of the publish command.
+type publishConfig struct {
+	topic string
+	// rate is the maximum number of messages published per second, or 0 for no limit
+	rate int
+	// raw publishes each line as the body of a message, instead of reading the messages as JSON
+	raw bool
+}
+
+// publishedLine is a message read from a JSON line of the input: its body is a JSON string, or any other JSON value
+// published as it is. The path defaults to the topic of the command.
+type publishedLine struct {
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body"`
+	Header json.RawMessage `json:"header"`
+}
+
+// runPublish publishes the messages read from the input, one per line, at the rate of the config,
+// and prints the number of published messages.
+func runPublish(c client.Client, config publishConfig, in io.Reader, w io.Writer) error {
+	if config.raw && config.topic == "" {
+		return fmt.Errorf("the topic is required with --raw")
+	}
+	var tick <-chan time.Time
+	if config.rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(config.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	start := time.Now()
+	published := 0
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		path, body, header := config.topic, text, ""
+		if !config.raw {
+			var err error
+			if path, body, header, err = parsePublishedLine(text, config.topic); err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+		if tick != nil {
+			<-tick
+		}
+		if err := c.Send(path, body, header); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		published++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	_, err := fmt.Fprintf(w, "published %d messages in %v (%.1f msg/s)\n",
+		published, elapsed, float64(published)/elapsed.Seconds())
+	return err
+}
+
+// parsePublishedLine returns the path, the body and the header of the message of a JSON line.
+func parsePublishedLine(text string, topic string) (string, string, string, error) {
+	var l publishedLine
+	if err := json.Unmarshal([]byte(text), &l); err != nil {
+		return "", "", "", fmt.Errorf("invalid message: %v", err)
+	}
+	path := l.Path
+	if path == "" {
+		path = topic
+	}
+	if path == "" {
+		return "", "", "", fmt.Errorf("the message has no path")
+	}
+	body := string(l.Body)
+	if len(l.Body) > 0 && l.Body[0] == '"' {
+		if err := json.Unmarshal(l.Body, &body); err != nil {
+			return "", "", "", err
+		}
+	}
+	header := ""
+	if len(l.Header) > 0 && string(l.Header) != "null" {
+		if l.Header[0] != '{' {
+			return "", "", "", fmt.Errorf("the header is not a JSON object")
+		}
+		header = string(l.Header)
+	}
+	return path, body, header, nil
+}
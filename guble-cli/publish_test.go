@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sentMessage is a message sent by the sendingClient.
+type sentMessage struct {
+	path, body, header string
+	at                 time.Time
+}
+
+type sendingClient struct {
+	*echoClient
+	sentMessages []sentMessage
+}
+
+func (c *sendingClient) Send(path string, body string, header string) error {
+	c.sentMessages = append(c.sentMessages, sentMessage{path, body, header, time.Now()})
+	return nil
+}
+
+func Test_runPublish(t *testing.T) {
+	a := assert.New(t)
+
+	c := &sendingClient{echoClient: newEchoClient()}
+	buff := &bytes.Buffer{}
+	a.NoError(runPublish(c, publishConfig{topic: "/foo"}, strings.NewReader(`{"body":"hello"}
+{"body":{"order":17},"header":{"correlation_id":"abc"}}
+
+{"path":"/bar","body":42}
+`), buff))
+
+	a.Equal([]sentMessage{
+		{"/foo", "hello", "", c.sentMessages[0].at},
+		{"/foo", `{"order":17}`, `{"correlation_id":"abc"}`, c.sentMessages[1].at},
+		{"/bar", "42", "", c.sentMessages[2].at},
+	}, c.sentMessages)
+	a.True(strings.HasPrefix(buff.String(), "published 3 messages in "), buff.String())
+}
+
+func Test_runPublish_RawWithRate(t *testing.T) {
+	a := assert.New(t)
+
+	c := &sendingClient{echoClient: newEchoClient()}
+	a.NoError(runPublish(c, publishConfig{topic: "/foo", rate: 100, raw: true}, strings.NewReader("a\n{\"body\":\"b\"}\nc\n"), &bytes.Buffer{}))
+
+	a.Len(c.sentMessages, 3)
+	a.Equal("a", c.sentMessages[0].body)
+	a.Equal(`{"body":"b"}`, c.sentMessages[1].body)
+	// the messages are sent every 10ms
+	a.True(c.sentMessages[2].at.Sub(c.sentMessages[0].at) >= 15*time.Millisecond)
+}
+
+func Test_runPublish_Errors(t *testing.T) {
+	a := assert.New(t)
+
+	for _, input := range []string{
+		"not json",
+		`{"body":"no path"}`,
+		`{"path":"/foo","header":"not an object"}`,
+	} {
+		err := runPublish(&sendingClient{echoClient: newEchoClient()}, publishConfig{}, strings.NewReader(input), &bytes.Buffer{})
+		a.Error(err, input)
+		a.True(strings.HasPrefix(err.Error(), "line 1: "), err.Error())
+	}
+	a.Error(runPublish(&sendingClient{echoClient: newEchoClient()}, publishConfig{raw: true}, strings.NewReader("a"), &bytes.Buffer{}))
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"github.com/smancke/guble/client"
+	"github.com/smancke/guble/protocol"
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scriptPublish is a message to publish, read as a JSON line from the input of the scripting mode.
+type scriptPublish struct {
+	Path   string          `json:"path"`
+	Body   string          `json:"body"`
+	Header json.RawMessage `json:"header,omitempty"`
+	// ID is the publisher message ID, returned in the receipt; a sequence number is used if it is empty
+	ID string `json:"id,omitempty"`
+}
+
+// scriptEvent is the JSON output of the scripting mode: a received message, the receipt of a published message,
+// a status notification or an error of the server.
+type scriptEvent struct {
+	Type string `json:"type"`
+	*fetchedMessage
+	Name    string                `json:"name,omitempty"`
+	Arg     string                `json:"arg,omitempty"`
+	Receipt *protocol.SendReceipt `json:"receipt,omitempty"`
+}
+
+// script publishes the messages read as JSON lines, and prints the messages and notifications received by the client
+// as JSON lines, keeping track of the published messages waiting for their receipts.
+type script struct {
+	client  client.Client
+	encoder *json.Encoder
+
+	mu        sync.Mutex
+	lastID    uint64
+	pending   map[string]bool
+	published int
+	failed    int
+	drained   chan bool
+}
+
+func newScript(c client.Client, w io.Writer) *script {
+	return &script{
+		client:  c,
+		encoder: json.NewEncoder(w),
+		pending: make(map[string]bool),
+	}
+}
+
+// run publishes the lines of the input, and prints the received events until the receipts of all the published messages
+// are received after the end of the input, or until the timeout expires.
+// It returns an error if some messages were not published.
+func (s *script) run(in io.Reader, timeout time.Duration) error {
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		s.printLoop(stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	if err := s.read(in); err != nil {
+		return err
+	}
+	if !s.wait(timeout) {
+		s.mu.Lock()
+		s.failed += len(s.pending)
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed > 0 {
+		return fmt.Errorf("%d of %d messages not published", s.failed, s.published)
+	}
+	return nil
+}
+
+// read publishes the JSON lines of the input, and sends the other lines as commands to the server.
+func (s *script) read(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "{") {
+			if err := s.client.WriteRawMessage([]byte(line)); err != nil {
+				return err
+			}
+			continue
+		}
+		var p scriptPublish
+		if err := json.Unmarshal([]byte(line), &p); err != nil {
+			return fmt.Errorf("invalid message %q: %v", line, err)
+		}
+		if err := s.publish(&p); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *script) publish(p *scriptPublish) error {
+	if p.Path == "" {
+		return fmt.Errorf("the message %q has no path", p.Body)
+	}
+	if strings.ContainsAny(p.ID, " \t") {
+		return fmt.Errorf("invalid publisher message ID %q", p.ID)
+	}
+
+	s.mu.Lock()
+	if p.ID == "" {
+		s.lastID++
+		p.ID = strconv.FormatUint(s.lastID, 10)
+	}
+	s.pending[p.ID] = true
+	s.published++
+	s.mu.Unlock()
+
+	cmd := &protocol.Cmd{
+		Name: protocol.CmdSend,
+		Arg:  p.Path + " " + p.ID,
+		Body: []byte(p.Body),
+	}
+	if len(p.Header) > 0 {
+		cmd.HeaderJSON = string(p.Header)
+	}
+	return s.client.WriteRawMessage(cmd.Bytes())
+}
+
+// wait returns true when no published message is waiting for its receipt, or false if the timeout expires before.
+func (s *script) wait(timeout time.Duration) bool {
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return true
+	}
+	s.drained = make(chan bool)
+	drained := s.drained
+	s.mu.Unlock()
+
+	select {
+	case <-drained:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// printLoop prints the events received by the client, until the stop channel is closed.
+func (s *script) printLoop(stop <-chan bool) {
+	for {
+		select {
+		case m := <-s.client.Messages():
+			s.print(&scriptEvent{Type: "message", fetchedMessage: newFetchedMessage(m)})
+		case n := <-s.client.StatusMessages():
+			s.notified(n)
+		case n := <-s.client.Errors():
+			s.notified(n)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// notified prints the notification, as the receipt of a published message if it is one.
+func (s *script) notified(n *protocol.NotificationMessage) {
+	event := &scriptEvent{Type: "status", Name: n.Name, Arg: n.Arg}
+	if n.IsError {
+		event.Type = "error"
+	}
+	if id := publisherMessageID(n); id != "" {
+		s.received(id, n.IsError)
+		if !n.IsError {
+			receipt := &protocol.SendReceipt{}
+			if err := json.Unmarshal([]byte(n.Json), receipt); err == nil {
+				event = &scriptEvent{Type: "receipt", Receipt: receipt}
+			}
+		}
+	}
+	s.print(event)
+}
+
+// received removes the published message from those waiting for a receipt.
+func (s *script) received(id string, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pending[id] {
+		return
+	}
+	delete(s.pending, id)
+	if failed {
+		s.failed++
+	}
+	if len(s.pending) == 0 && s.drained != nil {
+		close(s.drained)
+		s.drained = nil
+	}
+}
+
+func (s *script) print(event *scriptEvent) {
+	if err := s.encoder.Encode(event); err != nil {
+		logger.WithError(err).Error("Error on printing an event")
+	}
+}
+
+// publisherMessageID returns the publisher message ID of a receipt or of a rejected message, or "" for the other notifications.
+func publisherMessageID(n *protocol.NotificationMessage) string {
+	args := strings.Fields(n.Arg)
+	switch {
+	case n.Name == protocol.SUCCESS_SEND && len(args) > 0,
+		n.Name == protocol.ERROR_SEND && len(args) > 0:
+		return args[0]
+	case n.Name == protocol.ERROR_RATE_LIMITED && len(args) > 1,
+		n.Name == protocol.ERROR_QUOTA_EXCEEDED && len(args) > 1:
+		return args[1]
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"github.com/smancke/guble/client"
+	"github.com/smancke/guble/protocol"
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echoClient answers the sent messages with their receipts (or with an error for the topic /rejected),
+// and delivers them back as received messages.
+type echoClient struct {
+	client.Client
+	sent           []string
+	messages       chan *protocol.Message
+	statusMessages chan *protocol.NotificationMessage
+	errors         chan *protocol.NotificationMessage
+}
+
+func newEchoClient() *echoClient {
+	return &echoClient{
+		messages:       make(chan *protocol.Message, 10),
+		statusMessages: make(chan *protocol.NotificationMessage, 10),
+		errors:         make(chan *protocol.NotificationMessage, 10),
+	}
+}
+
+func (c *echoClient) WriteRawMessage(message []byte) error {
+	c.sent = append(c.sent, string(message))
+	cmd, err := protocol.ParseCmd(message)
+	if err != nil || cmd.Name != protocol.CmdSend {
+		return err
+	}
+	args := strings.Fields(cmd.Arg)
+	if args[0] == "/rejected" {
+		c.errors <- &protocol.NotificationMessage{Name: protocol.ERROR_SEND, Arg: args[1] + " not allowed", IsError: true}
+		return nil
+	}
+	receipt, _ := json.Marshal(&protocol.SendReceipt{SequenceID: 42, Path: args[0], PublisherMessageID: args[1], MessagePublishingTime: 1500000000})
+	c.statusMessages <- &protocol.NotificationMessage{Name: protocol.SUCCESS_SEND, Arg: args[1], Json: string(receipt)}
+	return nil
+}
+
+func (c *echoClient) Messages() chan *protocol.Message                   { return c.messages }
+func (c *echoClient) StatusMessages() chan *protocol.NotificationMessage { return c.statusMessages }
+func (c *echoClient) Errors() chan *protocol.NotificationMessage         { return c.errors }
+
+func Test_script_run(t *testing.T) {
+	a := assert.New(t)
+
+	c := newEchoClient()
+	c.messages <- &protocol.Message{ID: 7, Path: "/foo", UserID: "marvin", Time: 1500000000, Body: []byte("hello")}
+
+	buff := &bytes.Buffer{}
+	err := newScript(c, buff).run(strings.NewReader(`{"path":"/foo","body":"hi","header":{"a":"b"}}
+
++ /bar
+{"path":"/foo","body":"again","id":"x"}
+`), time.Second)
+	a.NoError(err)
+
+	a.Equal([]string{"> /foo 1\n{\"a\":\"b\"}\nhi", "+ /bar", "> /foo x\n\nagain"}, c.sent)
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	a.Len(lines, 3)
+	a.Contains(lines, `{"type":"message","id":7,"path":"/foo","userId":"marvin","applicationId":"","time":"2017-07-14T02:40:00Z","body":"hello"}`)
+	a.Contains(lines, `{"type":"receipt","receipt":{"sequenceId":42,"path":"/foo","publisherMessageId":"1","messagePublishingTime":1500000000}}`)
+	a.Contains(lines, `{"type":"receipt","receipt":{"sequenceId":42,"path":"/foo","publisherMessageId":"x","messagePublishingTime":1500000000}}`)
+}
+
+func Test_script_run_Failures(t *testing.T) {
+	a := assert.New(t)
+
+	c := newEchoClient()
+	buff := &bytes.Buffer{}
+	err := newScript(c, buff).run(strings.NewReader(`{"path":"/foo","body":"hi"}
+{"path":"/rejected","body":"hi"}
+`), time.Second)
+	a.EqualError(err, "1 of 2 messages not published")
+	a.Contains(buff.String(), `{"type":"error","name":"error-send","arg":"2 not allowed"}`)
+
+	// the input has to be valid
+	err = newScript(newEchoClient(), buff).run(strings.NewReader(`{"path":`), time.Second)
+	a.Error(err)
+	err = newScript(newEchoClient(), buff).run(strings.NewReader(`{"body":"hi"}`), time.Second)
+	a.Error(err)
+}
+
+func Test_script_run_Timeout(t *testing.T) {
+	a := assert.New(t)
+
+	// the receipts of the messages published to a blocked channel are not received
+	c := newEchoClient()
+	c.statusMessages = make(chan *protocol.NotificationMessage)
+	blocked := &blockingClient{echoClient: c}
+
+	err := newScript(blocked, &bytes.Buffer{}).run(strings.NewReader(`{"path":"/foo","body":"hi"}`), 10*time.Millisecond)
+	a.EqualError(err, "1 of 1 messages not published")
+}
+
+// blockingClient drops the receipts.
+type blockingClient struct {
+	*echoClient
+}
+
+func (c *blockingClient) WriteRawMessage(message []byte) error {
+	c.sent = append(c.sent, string(message))
+	return nil
+}
+
+func Test_publisherMessageID(t *testing.T) {
+	for i, c := range []struct {
+		notification *protocol.NotificationMessage
+		expected     string
+	}{
+		{&protocol.NotificationMessage{Name: protocol.SUCCESS_SEND, Arg: "42"}, "42"},
+		{&protocol.NotificationMessage{Name: protocol.SUCCESS_SEND}, ""},
+		{&protocol.NotificationMessage{Name: protocol.ERROR_SEND, Arg: "42 not allowed"}, "42"},
+		{&protocol.NotificationMessage{Name: protocol.ERROR_RATE_LIMITED, Arg: "/foo 42"}, "42"},
+		{&protocol.NotificationMessage{Name: protocol.ERROR_QUOTA_EXCEEDED, Arg: "/foo"}, ""},
+		{&protocol.NotificationMessage{Name: protocol.SUCCESS_SUBSCRIBED_TO, Arg: "/foo"}, ""},
+	} {
+		assert.Equal(t, c.expected, publisherMessageID(c.notification), fmt.Sprintf("Failed at case no=%d", i))
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"github.com/chzyer/readline"
+	"github.com/smancke/guble/client"
+	"github.com/smancke/guble/protocol"
+
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	shellPrompt    = "guble$ "
+	headerPrompt   = "header: "
+	bodyPrompt     = "body: "
+	continuePrompt = "....: "
+)
+
+// shellCommands are the commands completed at the start of a line.
+var shellCommands = []string{"+ ", "- ", "> ", "?", "help"}
+
+// lineReader reads the lines typed on the terminal.
+type lineReader interface {
+	Readline() (string, error)
+	SetPrompt(prompt string)
+	SaveHistory(content string) error
+}
+
+// shell is the interactive mode on a terminal: it keeps a history of the commands, completes the commands
+// and the known topics, and reads multi-line bodies, whose lines end with a backslash except for the last one.
+type shell struct {
+	client client.Client
+
+	mu     sync.Mutex
+	topics map[string]bool
+}
+
+func newShell(c client.Client) *shell {
+	return &shell{
+		client: c,
+		topics: make(map[string]bool),
+	}
+}
+
+// defaultHistoryFile returns the history file in the home directory of the user.
+func defaultHistoryFile() string {
+	return filepath.Join(os.Getenv("HOME"), ".guble_history")
+}
+
+// runShell sends the commands, and then the commands typed on the terminal, until the shell is exited.
+func runShell(c client.Client, commands []string, historyFile string) error {
+	s := newShell(c)
+	s.loadHistory(historyFile)
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:                 shellPrompt,
+		HistoryFile:            historyFile,
+		DisableAutoSaveHistory: true,
+		HistorySearchFold:      true,
+		AutoComplete:           s,
+		InterruptPrompt:        "^C",
+		EOFPrompt:              "exit",
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	go readLoop(c, rl.Stdout(), func(m *protocol.Message) {
+		s.addTopic(string(m.Path))
+	})
+	for _, cmd := range commands {
+		s.addTopicOfCommand(cmd)
+		c.WriteRawMessage([]byte(cmd))
+	}
+	err = s.run(rl)
+	c.Close()
+	return err
+}
+
+// run sends the commands read from the terminal, until its end (Ctrl-D) or an interrupt on an empty line (Ctrl-C).
+// An interrupt while reading the header or the body of a message cancels the message.
+func (s *shell) run(r lineReader) error {
+	for {
+		line, err := r.Readline()
+		if err == readline.ErrInterrupt {
+			if line == "" {
+				return nil
+			}
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		text := strings.TrimSpace(line)
+		if text == "" {
+			continue
+		}
+		r.SaveHistory(text)
+		if text == "?" || text == "help" {
+			printHelp()
+			continue
+		}
+		if strings.HasPrefix(text, ">") {
+			message, err := s.readMessage(r)
+			if err == readline.ErrInterrupt {
+				continue
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			text += "\n" + message
+		}
+
+		s.addTopicOfCommand(text)
+		if *verbose {
+			logger.Printf("Sending: %v\n", text)
+		}
+		if err := s.client.WriteRawMessage([]byte(text)); err != nil {
+			return fmt.Errorf("error on writing the message: %v", err)
+		}
+	}
+}
+
+// readMessage reads the header and the body of a message to send.
+func (s *shell) readMessage(r lineReader) (string, error) {
+	defer r.SetPrompt(shellPrompt)
+	r.SetPrompt(headerPrompt)
+	header, err := r.Readline()
+	if err != nil {
+		return "", err
+	}
+	r.SetPrompt(bodyPrompt)
+	var lines []string
+	for {
+		line, err := r.Readline()
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasSuffix(line, `\`) {
+			lines = append(lines, line)
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(line, `\`))
+		r.SetPrompt(continuePrompt)
+	}
+	return strings.TrimSpace(header) + "\n" + strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// Do returns the completions of the word before the cursor: a command at the start of the line,
+// or a known topic after a subscribe, unsubscribe or send command. It implements readline.AutoCompleter.
+func (s *shell) Do(line []rune, pos int) ([][]rune, int) {
+	typed := string(line[:pos])
+	word := typed[strings.LastIndex(typed, " ")+1:]
+	var candidates []string
+	switch fields := strings.Fields(typed[:len(typed)-len(word)]); {
+	case len(fields) == 0:
+		candidates = shellCommands
+	case len(fields) == 1 && isTopicCommand(fields[0]):
+		for _, topic := range s.knownTopics() {
+			candidates = append(candidates, topic+" ")
+		}
+	}
+
+	var completions [][]rune
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			completions = append(completions, []rune(candidate[len(word):]))
+		}
+	}
+	return completions, len([]rune(word))
+}
+
+// addTopic adds a topic to the completed ones.
+func (s *shell) addTopic(path string) {
+	if !strings.HasPrefix(path, "/") {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.topics[path] = true
+}
+
+// addTopicOfCommand adds the topic of a subscribe, unsubscribe or send command to the completed ones.
+func (s *shell) addTopicOfCommand(command string) {
+	fields := strings.Fields(command)
+	if len(fields) >= 2 && isTopicCommand(fields[0]) {
+		s.addTopic(fields[1])
+	}
+}
+
+// loadHistory adds the topics of the commands of the history file (if it exists) to the completed ones.
+func (s *shell) loadHistory(historyFile string) {
+	data, err := ioutil.ReadFile(historyFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		s.addTopicOfCommand(line)
+	}
+}
+
+// knownTopics returns the sorted topics of the commands and of the received messages.
+func (s *shell) knownTopics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func isTopicCommand(name string) bool {
+	return name == "+" || name == "-" || name == ">"
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"github.com/chzyer/readline"
+	"github.com/stretchr/testify/assert"
+
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// typedLines is a terminal on which lines (or interrupts, as nil) are typed.
+type typedLines struct {
+	lines   []*string
+	prompts []string
+	history []string
+}
+
+func typed(lines ...interface{}) *typedLines {
+	t := &typedLines{}
+	for _, l := range lines {
+		if s, ok := l.(string); ok {
+			t.lines = append(t.lines, &s)
+		} else {
+			t.lines = append(t.lines, nil)
+		}
+	}
+	return t
+}
+
+func (t *typedLines) Readline() (string, error) {
+	if len(t.lines) == 0 {
+		return "", io.EOF
+	}
+	line := t.lines[0]
+	t.lines = t.lines[1:]
+	if line == nil {
+		return "", readline.ErrInterrupt
+	}
+	return *line, nil
+}
+
+func (t *typedLines) SetPrompt(prompt string) { t.prompts = append(t.prompts, prompt) }
+func (t *typedLines) SaveHistory(content string) error {
+	t.history = append(t.history, content)
+	return nil
+}
+
+func Test_shell_run(t *testing.T) {
+	a := assert.New(t)
+
+	c := newEchoClient()
+	s := newShell(c)
+	terminal := typed(
+		"+ /foo", "",
+		"> /foo/bar 42", `{"a":"b"}`, `line one\`, `line two\`, "line three",
+		"> /cancelled 43", nil,
+		"- /foo",
+	)
+	a.NoError(s.run(terminal))
+
+	a.Equal([]string{
+		"+ /foo",
+		"> /foo/bar 42\n{\"a\":\"b\"}\nline one\nline two\nline three",
+		"- /foo",
+	}, c.sent)
+	a.Equal([]string{"+ /foo", "> /foo/bar 42", "> /cancelled 43", "- /foo"}, terminal.history)
+	a.Equal([]string{headerPrompt, bodyPrompt, continuePrompt, continuePrompt, shellPrompt, headerPrompt, shellPrompt}, terminal.prompts)
+	a.Equal([]string{"/foo", "/foo/bar"}, s.knownTopics())
+}
+
+func Test_shell_run_InterruptOnEmptyLine(t *testing.T) {
+	c := newEchoClient()
+	assert.NoError(t, newShell(c).run(typed(nil, "+ /foo")))
+	assert.Empty(t, c.sent)
+}
+
+func Test_shell_Do(t *testing.T) {
+	a := assert.New(t)
+
+	s := newShell(newEchoClient())
+	s.addTopic("/foo")
+	s.addTopic("/foo/bar")
+	s.addTopic("/baz")
+	s.addTopic("not a topic")
+
+	complete := func(line string) ([]string, int) {
+		completions, length := s.Do([]rune(line), len([]rune(line)))
+		var result []string
+		for _, c := range completions {
+			result = append(result, string(c))
+		}
+		return result, length
+	}
+
+	completions, length := complete("")
+	a.Equal([]string{"+ ", "- ", "> ", "?", "help"}, completions)
+	a.Equal(0, length)
+
+	completions, length = complete("he")
+	a.Equal([]string{"lp"}, completions)
+	a.Equal(2, length)
+
+	completions, length = complete("+ ")
+	a.Equal([]string{"/baz ", "/foo ", "/foo/bar "}, completions)
+	a.Equal(0, length)
+
+	completions, length = complete("> /fo")
+	a.Equal([]string{"o ", "o/bar "}, completions)
+	a.Equal(3, length)
+
+	completions, _ = complete("+ /foo 0 ")
+	a.Empty(completions)
+}
+
+func Test_shell_loadHistory(t *testing.T) {
+	a := assert.New(t)
+
+	file, err := ioutil.TempFile("", "guble-cli")
+	a.NoError(err)
+	defer os.Remove(file.Name())
+	file.WriteString("+ /foo -5\n?\n> /bar 1\n- /foo\n")
+	file.Close()
+
+	s := newShell(newEchoClient())
+	s.loadHistory(file.Name())
+	s.loadHistory(file.Name() + ".missing")
+	a.Equal([]string{"/bar", "/foo"}, s.knownTopics())
+}
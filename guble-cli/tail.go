@@ -0,0 +1,138 @@
+package main
+
+import (
+	"github.com/smancke/guble/client"
+	"github.com/smancke/guble/protocol"
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tailConfig are the options of the tail command.
+type tailConfig struct {
+	topic   string
+	filters map[string]string
+	last    int
+	follow  bool
+	asJSON  bool
+	// userID is the user of the connection, matched by the user_id filter of the messages if it is not filtered
+	userID string
+}
+
+// runTail prints the last messages of the topic matching the filters, and then the new ones with follow,
+// until the stop channel is closed.
+func runTail(c client.Client, config tailConfig, w io.Writer, stop <-chan bool) error {
+	var lastID uint64
+	if config.last > 0 {
+		messages, err := c.Fetch(config.topic, -int64(config.last), 0)
+		if err != nil {
+			return err
+		}
+		for _, m := range messages {
+			lastID = m.ID
+			if !matchesFilters(m, config.filters, config.userID) {
+				continue
+			}
+			if err := printTailed(w, m, config.asJSON); err != nil {
+				return err
+			}
+		}
+	}
+	if !config.follow {
+		return nil
+	}
+
+	path := config.topic
+	if lastID > 0 {
+		path = fmt.Sprintf("%s %d", config.topic, lastID+1)
+	}
+	if err := c.SubscribeWithFilters(path, config.filters); err != nil {
+		return err
+	}
+	for {
+		select {
+		case m := <-c.Messages():
+			if err := printTailed(w, m, config.asJSON); err != nil {
+				return err
+			}
+		case e := <-c.Errors():
+			return fmt.Errorf("%s %s", e.Name, e.Arg)
+		case <-c.StatusMessages():
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// parseFilters parses the filters given as "key=value".
+func parseFilters(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	filters := make(map[string]string, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid filter %q: expected key=value", value)
+		}
+		filters[parts[0]] = parts[1]
+	}
+	return filters, nil
+}
+
+// matchesFilters returns true if the message would be routed to a subscription with the filters, like on the server:
+// all the filters of the message have to be matched by those of the subscription, or by the user of the connection.
+func matchesFilters(m *protocol.Message, filters map[string]string, userID string) bool {
+	for key, value := range m.Filters {
+		expected, ok := filters[key]
+		if !ok && key == "user_id" {
+			expected = userID
+		}
+		if expected != value {
+			return false
+		}
+	}
+	return true
+}
+
+// printTailed prints the message with its header fields and its body (indented if it is JSON), or as a JSON line.
+func printTailed(w io.Writer, m *protocol.Message, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(newFetchedMessage(m))
+	}
+	buff := &bytes.Buffer{}
+	fmt.Fprintf(buff, "==> %s #%d %s %s <==\n", m.Path, m.ID, time.Unix(m.Time, 0).UTC().Format(time.RFC3339), m.UserID)
+	if m.HeaderJSON != "" {
+		header := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(m.HeaderJSON), &header); err != nil {
+			fmt.Fprintf(buff, "%s\n", m.HeaderJSON)
+		}
+		keys := make([]string, 0, len(header))
+		for key := range header {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(buff, "%s: %v\n", key, header[key])
+		}
+	}
+	body := bytes.TrimSpace(m.Body)
+	switch {
+	case m.IsBinary():
+		fmt.Fprintf(buff, "<%d bytes of %s>\n", len(m.Body), m.ContentType)
+	case len(body) > 0 && (body[0] == '{' || body[0] == '[') && json.Valid(body):
+		json.Indent(buff, body, "", "  ")
+		buff.WriteString("\n")
+	default:
+		buff.Write(m.Body)
+		buff.WriteString("\n")
+	}
+	buff.WriteString("\n")
+	_, err := w.Write(buff.Bytes())
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tailClient returns the stored messages, and records the subscription.
+type tailClient struct {
+	*echoClient
+	stored     []*protocol.Message
+	fetchStart int64
+	subscribed string
+	filters    map[string]string
+}
+
+func (c *tailClient) Fetch(topic string, since int64, limit int) ([]*protocol.Message, error) {
+	c.fetchStart = since
+	return c.stored, nil
+}
+
+func (c *tailClient) SubscribeWithFilters(path string, filters map[string]string) error {
+	c.subscribed, c.filters = path, filters
+	return nil
+}
+
+func Test_runTail(t *testing.T) {
+	a := assert.New(t)
+
+	c := &tailClient{echoClient: newEchoClient(), stored: []*protocol.Message{
+		{ID: 1, Path: "/foo", UserID: "42", Time: 1500000000, Filters: map[string]string{"user_id": "42"}, Body: []byte("mine")},
+		{ID: 2, Path: "/foo", UserID: "43", Time: 1500000000, Filters: map[string]string{"user_id": "43"}, Body: []byte("not mine")},
+		{ID: 3, Path: "/foo", UserID: "44", Time: 1500000060, HeaderJSON: `{"b":2,"a":"x"}`, Body: []byte(` {"text":"hello"}`)},
+	}}
+	filters := map[string]string{"user_id": "42"}
+
+	buff := &bytes.Buffer{}
+	a.NoError(runTail(c, tailConfig{topic: "/foo", filters: filters, last: 5}, buff, nil))
+	a.Equal(int64(-5), c.fetchStart)
+	a.Equal("", c.subscribed)
+	a.Equal(`==> /foo #1 2017-07-14T02:40:00Z 42 <==
+mine
+
+==> /foo #3 2017-07-14T02:41:00Z 44 <==
+a: x
+b: 2
+{
+  "text": "hello"
+}
+
+`, buff.String())
+
+	// with follow, the new messages are printed after the stored ones, until stopped
+	buff.Reset()
+	c.messages <- &protocol.Message{ID: 4, Path: "/foo", UserID: "42", Time: 1500000120, Body: []byte("new")}
+	stop := make(chan bool)
+	done := make(chan error)
+	go func() {
+		done <- runTail(c, tailConfig{topic: "/foo", filters: filters, last: 1, follow: true, asJSON: true}, buff, stop)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	a.NoError(<-done)
+	a.Equal("/foo 4", c.subscribed)
+	a.Equal(filters, c.filters)
+	a.Contains(buff.String(), `{"id":4,"path":"/foo","userId":"42","applicationId":"","time":"2017-07-14T02:42:00Z","body":"new"}`)
+
+	// the errors of the subscription end the tail
+	c.errors <- &protocol.NotificationMessage{Name: protocol.ERROR_BAD_REQUEST, Arg: "user_id can not be filtered", IsError: true}
+	a.Error(runTail(c, tailConfig{topic: "/foo", follow: true}, buff, nil))
+}
+
+func Test_parseFilters(t *testing.T) {
+	a := assert.New(t)
+
+	filters, err := parseFilters([]string{"user_id=42", "device_id=a=b"})
+	a.NoError(err)
+	a.Equal(map[string]string{"user_id": "42", "device_id": "a=b"}, filters)
+
+	filters, err = parseFilters(nil)
+	a.NoError(err)
+	a.Nil(filters)
+
+	for i, value := range []string{"user_id", "=42"} {
+		_, err := parseFilters([]string{value})
+		a.Error(err, fmt.Sprintf("Failed at case no=%d", i))
+	}
+}
+
+func Test_matchesFilters(t *testing.T) {
+	a := assert.New(t)
+
+	m := &protocol.Message{Filters: map[string]string{"user_id": "42", "device_id": "d"}}
+	a.True(matchesFilters(m, map[string]string{"device_id": "d"}, "42"))
+	a.True(matchesFilters(m, map[string]string{"user_id": "42", "device_id": "d"}, "guble-cli"))
+	a.False(matchesFilters(m, map[string]string{"device_id": "d"}, "guble-cli"))
+	a.False(matchesFilters(m, nil, "42"))
+	a.True(matchesFilters(&protocol.Message{}, map[string]string{"device_id": "d"}, "42"))
+}
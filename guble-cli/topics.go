@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// topicStats are the statistics of a topic returned by the topics endpoint of the server.
+type topicStats struct {
+	Topic        string `json:"topic"`
+	Messages     uint64 `json:"messages"`
+	MaxMessageID uint64 `json:"maxMessageId"`
+	Subscribers  int    `json:"subscribers"`
+}
+
+// topicsClient calls the topics endpoint of the server, with the admin credentials.
+type topicsClient struct {
+	url      string
+	user     string
+	password string
+	apiKey   string
+	client   *http.Client
+}
+
+func newTopicsClient(tlsConfig *tls.Config) *topicsClient {
+	return &topicsClient{
+		url:      removeTrailingSlash(*adminURL),
+		user:     *adminUser,
+		password: *adminPassword,
+		apiKey:   *adminAPIKey,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+}
+
+// do sends the request for the topic (the list of the topics if empty), and returns the body of the response.
+func (c *topicsClient) do(method string, topic string) ([]byte, error) {
+	req, err := http.NewRequest(method, c.url+"/"+strings.TrimPrefix(topic, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.password != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-Admin-Key", c.apiKey)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s %s", method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func runTopics(command string, c *topicsClient, w io.Writer) error {
+	switch command {
+	case topicsList.FullCommand():
+		body, err := c.do(http.MethodGet, "")
+		if err != nil {
+			return err
+		}
+		var stats []topicStats
+		if err := json.Unmarshal(body, &stats); err != nil {
+			return err
+		}
+		return printTopicStats(w, stats, *jsonOutput)
+	case topicsStats.FullCommand():
+		body, err := c.do(http.MethodGet, *topicsStatsArg)
+		if err != nil {
+			return err
+		}
+		var stats topicStats
+		if err := json.Unmarshal(body, &stats); err != nil {
+			return err
+		}
+		return printTopicStats(w, []topicStats{stats}, *jsonOutput)
+	case topicsPurge.FullCommand():
+		if _, err := c.do(http.MethodDelete, *topicsPurgeArg); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "purged %s\n", *topicsPurgeArg)
+		return err
+	}
+	return fmt.Errorf("unknown command %q", command)
+}
+
+// printTopicStats prints the statistics as a table, or as JSON lines.
+func printTopicStats(w io.Writer, stats []topicStats, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		for _, s := range stats {
+			if err := encoder.Encode(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOPIC\tMESSAGES\tMAX ID\tSUBSCRIBERS")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", s.Topic, s.Messages, s.MaxMessageID, s.Subscribers)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_runTopics(t *testing.T) {
+	a := assert.New(t)
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		a.Equal("admin", user)
+		a.Equal("secret", password)
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.URL.Path == "/admin/topics/":
+			w.Write([]byte(`[{"topic":"/foo","messages":2,"maxMessageId":42,"subscribers":1},{"topic":"/other","messages":1,"maxMessageId":7}]`))
+		case r.URL.Path == "/admin/topics/foo/bar" && r.Method == http.MethodGet:
+			w.Write([]byte(`{"topic":"/foo/bar","messages":2,"maxMessageId":42,"subscribers":3}`))
+		case r.URL.Path == "/admin/topics/foo" && r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, `{"error":"only the root topics can be purged"}`, http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	c := &topicsClient{url: server.URL + "/admin/topics", user: "admin", password: "secret", client: &http.Client{Timeout: time.Second}}
+	buff := &bytes.Buffer{}
+
+	a.NoError(runTopics(topicsList.FullCommand(), c, buff))
+	a.Equal("TOPIC   MESSAGES  MAX ID  SUBSCRIBERS\n/foo    2         42      1\n/other  1         7       0\n", buff.String())
+
+	buff.Reset()
+	*topicsStatsArg = "/foo/bar"
+	*jsonOutput = true
+	defer func() { *jsonOutput = false }()
+	a.NoError(runTopics(topicsStats.FullCommand(), c, buff))
+	a.JSONEq(`{"topic":"/foo/bar","messages":2,"maxMessageId":42,"subscribers":3}`, buff.String())
+
+	buff.Reset()
+	*topicsPurgeArg = "/foo"
+	a.NoError(runTopics(topicsPurge.FullCommand(), c, buff))
+	a.Equal("purged /foo\n", buff.String())
+
+	*topicsPurgeArg = "/foo/bar"
+	err := runTopics(topicsPurge.FullCommand(), c, buff)
+	a.Error(err)
+	a.Contains(err.Error(), "only the root topics can be purged")
+
+	a.Equal([]string{"GET /admin/topics/", "GET /admin/topics/foo/bar", "DELETE /admin/topics/foo", "DELETE /admin/topics/foo/bar"}, requests)
+}
@@ -0,0 +1,318 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// ChunkHeader is the field of the message header identifying a chunk of a message whose body was split
+// (see Split), as "<id> <index>/<count>": the chunks share the ID, and the index is counted from 0.
+const ChunkHeader = "Chunk"
+
+// ChunkSizeHeader is the header of the websocket handshake asking the server to send the messages
+// whose body is larger than the given number of bytes in chunks, which the client reassembles.
+const ChunkSizeHeader = "Guble-Chunk-Size"
+
+// MaxChunkCount is the maximum number of chunks of a message: Split uses larger chunks if needed,
+// and a chunk with a larger count is invalid.
+const MaxChunkCount = 1 << 16
+
+// ErrChunkedMessageTooLarge is returned by a Reassembler when the body of a chunked message exceeds its MaxSize.
+var ErrChunkedMessageTooLarge = errors.New("the chunked message is too large")
+
+// ErrReassemblyBudgetExceeded is returned by a Reassembler when its Budget can not hold one more chunked message.
+var ErrReassemblyBudgetExceeded = errors.New("too many chunked messages are being reassembled")
+
+// Chunk identifies a chunk of a message.
+type Chunk struct {
+	ID    string
+	Index int
+	Count int
+}
+
+// Chunk returns the chunk given in the message header, or nil if the message is not a chunk.
+func (msg *Message) Chunk() (*Chunk, error) {
+	if !strings.Contains(msg.HeaderJSON, `"`+ChunkHeader+`"`) {
+		return nil, nil
+	}
+	value := msg.Header(ChunkHeader)
+	if value == "" {
+		return nil, nil
+	}
+	invalid := fmt.Errorf("invalid chunk %q", value)
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return nil, invalid
+	}
+	position := strings.SplitN(fields[1], "/", 2)
+	if len(position) != 2 {
+		return nil, invalid
+	}
+	c := &Chunk{ID: fields[0]}
+	var err error
+	if c.Index, err = strconv.Atoi(position[0]); err != nil {
+		return nil, invalid
+	}
+	if c.Count, err = strconv.Atoi(position[1]); err != nil {
+		return nil, invalid
+	}
+	if c.Count < 1 || c.Count > MaxChunkCount || c.Index < 0 || c.Index >= c.Count {
+		return nil, invalid
+	}
+	return c, nil
+}
+
+// Split returns the chunks of the message, if its body is larger than the size: messages with the same fields,
+// whose bodies are the parts of the body, and with the chunk in their header. The message is returned
+// as it is if it does not need to be split. The size is increased if there would be more than MaxChunkCount chunks.
+// The ID must not be empty nor contain spaces.
+func (msg *Message) Split(size int, id string) ([]*Message, error) {
+	if id == "" || strings.IndexFunc(id, unicode.IsSpace) >= 0 {
+		return nil, fmt.Errorf("invalid chunk ID %q", id)
+	}
+	if size <= 0 || len(msg.Body) <= size {
+		return []*Message{msg}, nil
+	}
+	if minSize := (len(msg.Body) + MaxChunkCount - 1) / MaxChunkCount; size < minSize {
+		size = minSize
+	}
+	count := (len(msg.Body) + size - 1) / size
+	chunks := make([]*Message, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg.Body) {
+			end = len(msg.Body)
+		}
+		chunk := *msg
+		chunk.Body = msg.Body[i*size : end]
+		if err := chunk.SetHeader(ChunkHeader, fmt.Sprintf("%s %d/%d", id, i, count)); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, &chunk)
+	}
+	return chunks, nil
+}
+
+// ReassemblyBudget limits the memory of the messages being reassembled by the Reassemblers sharing it,
+// e.g. by all the connections of a server. It is safe for concurrent use.
+type ReassemblyBudget struct {
+	max  int64
+	used int64
+}
+
+// NewReassemblyBudget returns a budget of max bytes.
+func NewReassemblyBudget(max int) *ReassemblyBudget {
+	return &ReassemblyBudget{max: int64(max)}
+}
+
+// Used returns the number of bytes reserved by the messages being reassembled.
+func (b *ReassemblyBudget) Used() int {
+	return int(atomic.LoadInt64(&b.used))
+}
+
+func (b *ReassemblyBudget) reserve(n int) bool {
+	for {
+		used := atomic.LoadInt64(&b.used)
+		if used+int64(n) > b.max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.used, used, used+int64(n)) {
+			return true
+		}
+	}
+}
+
+func (b *ReassemblyBudget) release(n int) {
+	atomic.AddInt64(&b.used, -int64(n))
+}
+
+// Reassembler reassembles the chunked messages from their chunks, received in any order.
+// The chunks are copied into the body of their message as they arrive, so all the chunks of a message
+// but the last one must have the same size, as the chunks returned by Split.
+// It is safe for concurrent use.
+type Reassembler struct {
+	// MaxSize is the maximum size of a reassembled body (no limit if 0).
+	MaxSize int
+	// MaxPending is the maximum number of messages being reassembled, the oldest one being dropped
+	// when a new one starts (no limit if 0).
+	MaxPending int
+	// Budget limits the memory of the messages being reassembled, with the other Reassemblers sharing it
+	// (no limit if nil).
+	Budget *ReassemblyBudget
+
+	mu      sync.Mutex
+	pending map[string]*pendingChunks
+	order   []string
+}
+
+// pendingChunks is a message being reassembled. Its body is allocated when the size of its chunks is known,
+// i.e. when a chunk other than the last one is received; the last chunk is kept aside until then.
+type pendingChunks struct {
+	body      []byte
+	chunkSize int
+	last      []byte
+	count     int
+	size      int
+	received  map[int]bool
+	reserved  int
+}
+
+// Add returns the message if it is not a chunk, the reassembled message if it is its last missing chunk, or nil
+// if other chunks are missing. The reassembled message has the fields of its last chunk, without the chunk header.
+func (r *Reassembler) Add(msg *Message) (*Message, error) {
+	chunk, err := msg.Chunk()
+	if err != nil || chunk == nil {
+		return msg, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := string(msg.Path) + " " + chunk.ID
+	p, exists := r.pending[key]
+	if !exists {
+		if r.pending == nil {
+			r.pending = make(map[string]*pendingChunks)
+		}
+		if r.MaxPending > 0 && len(r.order) >= r.MaxPending {
+			r.remove(r.order[0])
+		}
+		p = &pendingChunks{count: chunk.Count, received: make(map[int]bool)}
+		r.pending[key] = p
+		r.order = append(r.order, key)
+	}
+	if err := r.store(p, chunk, msg.Body); err != nil {
+		r.remove(key)
+		return nil, err
+	}
+	if len(p.received) < p.count {
+		return nil, nil
+	}
+
+	r.remove(key)
+	reassembled := *msg
+	reassembled.Body = p.body[:p.size]
+	if err := reassembled.DeleteHeader(ChunkHeader); err != nil {
+		return nil, err
+	}
+	return &reassembled, nil
+}
+
+// store copies the body of the chunk into the body of its message.
+func (r *Reassembler) store(p *pendingChunks, chunk *Chunk, body []byte) error {
+	if chunk.Count != p.count || p.received[chunk.Index] {
+		return fmt.Errorf("the chunk %d/%d of %s does not match the previous chunks", chunk.Index, chunk.Count, chunk.ID)
+	}
+	isLast := chunk.Index == p.count-1
+	if p.body == nil {
+		if isLast && p.count > 1 {
+			// the size of the other chunks is not known yet
+			if r.MaxSize > 0 && len(body) > r.MaxSize {
+				return ErrChunkedMessageTooLarge
+			}
+			if err := r.reserve(p, len(body)); err != nil {
+				return err
+			}
+			p.last = body
+			p.received[chunk.Index] = true
+			return nil
+		}
+		if err := r.allocate(p, len(body)); err != nil {
+			return err
+		}
+	}
+	if isLast {
+		if len(body) > p.chunkSize {
+			return fmt.Errorf("the last chunk of %s is larger than the previous chunks", chunk.ID)
+		}
+		p.size = (p.count-1)*p.chunkSize + len(body)
+		if r.MaxSize > 0 && p.size > r.MaxSize {
+			return ErrChunkedMessageTooLarge
+		}
+	} else if len(body) != p.chunkSize {
+		return fmt.Errorf("the chunk %d/%d of %s does not have the size of the previous chunks", chunk.Index, chunk.Count, chunk.ID)
+	}
+	copy(p.body[chunk.Index*p.chunkSize:], body)
+	p.received[chunk.Index] = true
+	return nil
+}
+
+// allocate reserves the body of the message, once the size of its chunks is known,
+// and copies the last chunk into it if it was already received.
+func (r *Reassembler) allocate(p *pendingChunks, chunkSize int) error {
+	if chunkSize == 0 {
+		return fmt.Errorf("empty chunk")
+	}
+	lastSize := chunkSize
+	if p.last != nil {
+		if len(p.last) > chunkSize {
+			return fmt.Errorf("the last chunk is larger than the previous chunks")
+		}
+		lastSize = len(p.last)
+	}
+	capacity := (p.count-1)*chunkSize + lastSize
+	minSize := capacity
+	if p.last == nil {
+		minSize = capacity - lastSize + 1
+	}
+	if r.MaxSize > 0 && minSize > r.MaxSize {
+		return ErrChunkedMessageTooLarge
+	}
+	if err := r.reserve(p, capacity); err != nil {
+		return err
+	}
+	p.body = make([]byte, capacity)
+	p.chunkSize = chunkSize
+	if p.last != nil {
+		p.size = capacity
+		copy(p.body[(p.count-1)*chunkSize:], p.last)
+		p.last = nil
+	}
+	return nil
+}
+
+// reserve replaces the memory reserved for the message by the given number of bytes.
+func (r *Reassembler) reserve(p *pendingChunks, n int) error {
+	if r.Budget != nil {
+		if !r.Budget.reserve(n) {
+			return ErrReassemblyBudgetExceeded
+		}
+		r.Budget.release(p.reserved)
+	}
+	p.reserved = n
+	return nil
+}
+
+// Pending returns the number of messages being reassembled.
+func (r *Reassembler) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// Reset drops the messages being reassembled, releasing their memory from the Budget.
+func (r *Reassembler) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.order) > 0 {
+		r.remove(r.order[0])
+	}
+}
+
+func (r *Reassembler) remove(key string) {
+	if p, exists := r.pending[key]; exists && r.Budget != nil {
+		r.Budget.release(p.reserved)
+	}
+	delete(r.pending, key)
+	for i, k := range r.order {
+		if k == key {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
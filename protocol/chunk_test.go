@@ -0,0 +1,195 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_Split(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{Path: "/foo", HeaderJSON: `{"Content-Type":"text/plain"}`, Body: []byte("Hello World")}
+	chunks, err := msg.Split(4, "abc")
+	a.NoError(err)
+	if a.Len(chunks, 3) {
+		a.Equal("Hell", string(chunks[0].Body))
+		a.Equal("rld", string(chunks[2].Body))
+		a.Equal(`{"Chunk":"abc 2/3","Content-Type":"text/plain"}`, chunks[2].HeaderJSON)
+		a.Equal(Path("/foo"), chunks[1].Path)
+
+		chunk, err := chunks[1].Chunk()
+		a.NoError(err)
+		a.Equal(&Chunk{ID: "abc", Index: 1, Count: 3}, chunk)
+	}
+	// the message is not modified
+	a.Equal(`{"Content-Type":"text/plain"}`, msg.HeaderJSON)
+
+	// the chunks are larger than the size rather than too many
+	chunks, err = (&Message{Path: "/foo", Body: make([]byte, 3*MaxChunkCount)}).Split(1, "abc")
+	a.NoError(err)
+	a.Len(chunks, MaxChunkCount)
+	a.Len(chunks[0].Body, 3)
+
+	// the small bodies are not split
+	chunks, err = msg.Split(11, "abc")
+	a.NoError(err)
+	a.Equal([]*Message{msg}, chunks)
+	chunks, err = msg.Split(0, "abc")
+	a.NoError(err)
+	a.Equal([]*Message{msg}, chunks)
+
+	chunk, err := msg.Chunk()
+	a.NoError(err)
+	a.Nil(chunk)
+
+	// the IDs are separated from the position of the chunks by a space
+	for _, invalid := range []string{"", "a b", "a\tb"} {
+		_, err = msg.Split(4, invalid)
+		a.Error(err, invalid)
+	}
+
+	for _, invalid := range []string{"abc", "abc 3/3", "abc -1/3", "abc 0/0", "abc x/y", "abc 0/65537", "a b 0/3", "abc 0/3/4"} {
+		_, err = (&Message{HeaderJSON: `{"Chunk":"` + invalid + `"}`}).Chunk()
+		a.Error(err, invalid)
+	}
+}
+
+func TestReassembler_Add(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{Path: "/foo", HeaderJSON: `{"Content-Type":"text/plain"}`, Body: []byte("Hello World")}
+	chunks, err := msg.Split(4, "abc")
+	a.NoError(err)
+
+	// the messages which are not chunks are returned as they are
+	r := &Reassembler{}
+	other := &Message{Path: "/bar", Body: []byte("bar")}
+	result, err := r.Add(other)
+	a.NoError(err)
+	a.Equal(other, result)
+
+	// the chunks are reassembled in any order
+	for _, i := range []int{2, 0} {
+		result, err = r.Add(chunks[i])
+		a.NoError(err)
+		a.Nil(result)
+	}
+	a.Equal(1, r.Pending())
+	result, err = r.Add(chunks[1])
+	a.NoError(err)
+	if a.NotNil(result) {
+		a.Equal("Hello World", string(result.Body))
+		a.Equal(`{"Content-Type":"text/plain"}`, result.HeaderJSON)
+		a.Equal(Path("/foo"), result.Path)
+	}
+	a.Equal(0, r.Pending())
+
+	// the chunk header is removed from the reassembled message
+	chunks, err = (&Message{Path: "/foo", Body: []byte("Hello")}).Split(3, "def")
+	a.NoError(err)
+	r.Add(chunks[0])
+	result, err = r.Add(chunks[1])
+	a.NoError(err)
+	a.Equal("", result.HeaderJSON)
+}
+
+func TestReassembler_Limits(t *testing.T) {
+	a := assert.New(t)
+
+	big, err := (&Message{Path: "/foo", Body: []byte("Hello World")}).Split(4, "big")
+	a.NoError(err)
+	r := &Reassembler{MaxSize: 6, MaxPending: 1}
+	// the size is checked as soon as the size of the chunks is known
+	_, err = r.Add(big[0])
+	a.Equal(ErrChunkedMessageTooLarge, err)
+	a.Equal(0, r.Pending())
+	_, err = r.Add(big[2])
+	a.NoError(err)
+	_, err = r.Add(big[1])
+	a.Equal(ErrChunkedMessageTooLarge, err)
+	a.Equal(0, r.Pending())
+
+	// the oldest message is dropped when too many messages are pending
+	first, _ := (&Message{Path: "/foo", Body: []byte("abc")}).Split(2, "first")
+	second, _ := (&Message{Path: "/foo", Body: []byte("def")}).Split(2, "second")
+	r.Add(first[0])
+	r.Add(second[0])
+	a.Equal(1, r.Pending())
+	result, err := r.Add(first[1])
+	a.NoError(err)
+	a.Nil(result)
+	result, err = r.Add(second[1])
+	a.NoError(err)
+	a.Nil(result)
+
+	// the chunks must agree on their count
+	_, err = r.Add(&Message{Path: "/foo", HeaderJSON: `{"Chunk":"second 0/3"}`})
+	a.Error(err)
+	a.Equal(0, r.Pending())
+}
+
+func TestReassembler_ChunkSizes(t *testing.T) {
+	a := assert.New(t)
+
+	r := &Reassembler{}
+	chunk := func(header, body string) *Message {
+		return &Message{Path: "/foo", HeaderJSON: `{"Chunk":"` + header + `"}`, Body: []byte(body)}
+	}
+
+	// the chunks but the last one must have the same size
+	r.Add(chunk("abc 0/3", "Hell"))
+	_, err := r.Add(chunk("abc 1/3", "o W"))
+	a.Error(err)
+	a.Equal(0, r.Pending())
+
+	// the last chunk must not be larger than the others
+	r.Add(chunk("abc 2/3", "Hello"))
+	_, err = r.Add(chunk("abc 0/3", "Hell"))
+	a.Error(err)
+	a.Equal(0, r.Pending())
+
+	// a chunk is received once
+	r.Add(chunk("abc 0/3", "Hell"))
+	_, err = r.Add(chunk("abc 0/3", "Hell"))
+	a.Error(err)
+	a.Equal(0, r.Pending())
+}
+
+func TestReassembler_Budget(t *testing.T) {
+	a := assert.New(t)
+
+	budget := NewReassemblyBudget(20)
+	first := &Reassembler{Budget: budget}
+	second := &Reassembler{Budget: budget}
+
+	hello, err := (&Message{Path: "/foo", Body: []byte("Hello World")}).Split(4, "hello")
+	a.NoError(err)
+	other, err := (&Message{Path: "/foo", Body: []byte("Hello World")}).Split(4, "other")
+	a.NoError(err)
+
+	// the last chunk received first is reserved on its own, then the whole body
+	first.Add(hello[2])
+	a.Equal(3, budget.Used())
+	first.Add(hello[0])
+	a.Equal(11, budget.Used())
+
+	// the budget is shared by the reassemblers
+	_, err = second.Add(other[0])
+	a.Equal(ErrReassemblyBudgetExceeded, err)
+	a.Equal(0, second.Pending())
+	a.Equal(11, budget.Used())
+
+	// the memory is released when the message is reassembled
+	result, err := first.Add(hello[1])
+	a.NoError(err)
+	a.Equal("Hello World", string(result.Body))
+	a.Equal(0, budget.Used())
+
+	// and when the reassembler is reset
+	second.Add(other[0])
+	a.Equal(12, budget.Used())
+	second.Reset()
+	a.Equal(0, second.Pending())
+	a.Equal(0, budget.Used())
+}
@@ -13,6 +13,13 @@ const (
 	CmdCancel  = "-"
 )
 
+// The headers of the websocket handshake registering a last-will message, which the server publishes
+// to the topic if the connection drops without being closed by the client.
+const (
+	WillTopicHeader   = "Guble-Will-Topic"
+	WillMessageHeader = "Guble-Will-Message"
+)
+
 // Cmd is a representation of a command, which the client sends to the server
 type Cmd struct {
 
@@ -0,0 +1,93 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"strings"
+)
+
+// ContentTypeHeader is the field of the message header with the media type of the body, e.g. "image/png".
+// It matches the header "X-Guble-Content-Type" of the REST API.
+const ContentTypeHeader = "Content-Type"
+
+// ContentEncodingHeader is the field of the message header with the encoding of the body, e.g. "gzip".
+// It matches the header "X-Guble-Content-Encoding" of the REST API.
+const ContentEncodingHeader = "Content-Encoding"
+
+// ParseContent sets the media type and the encoding of the body from the message header.
+func (msg *Message) ParseContent() {
+	msg.parseContent(msg.decodeHeader())
+}
+
+func (msg *Message) parseContent(header map[string]interface{}) {
+	msg.ContentType, _ = header[ContentTypeHeader].(string)
+	msg.ContentEncoding, _ = header[ContentEncodingHeader].(string)
+}
+
+// SetContentType sets the media type of the body in the message header, keeping its other fields.
+func (msg *Message) SetContentType(contentType string) error {
+	if err := msg.SetHeader(ContentTypeHeader, contentType); err != nil {
+		return err
+	}
+	msg.ContentType = contentType
+	return nil
+}
+
+// SetContentEncoding sets the encoding of the body in the message header, keeping its other fields.
+func (msg *Message) SetContentEncoding(contentEncoding string) error {
+	if err := msg.SetHeader(ContentEncodingHeader, contentEncoding); err != nil {
+		return err
+	}
+	msg.ContentEncoding = contentEncoding
+	return nil
+}
+
+// IsBinary returns true if the body is encoded (e.g. compressed), or if its media type is not a textual one
+// (text/*, JSON, XML or form data). The messages without a media type are considered as text.
+func (msg *Message) IsBinary() bool {
+	if msg.ContentEncoding != "" && !strings.EqualFold(msg.ContentEncoding, "identity") {
+		return true
+	}
+	if msg.ContentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(msg.ContentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/json",
+		mediaType == "application/xml",
+		mediaType == "application/javascript",
+		mediaType == "application/x-www-form-urlencoded":
+		return false
+	}
+	return true
+}
+
+// DecodedBody returns the body decoded according to its encoding: gzip, deflate or identity (the default).
+func (msg *Message) DecodedBody() ([]byte, error) {
+	switch strings.ToLower(msg.ContentEncoding) {
+	case "", "identity":
+		return msg.Body, nil
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(msg.Body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case "deflate":
+		r := flate.NewReader(bytes.NewReader(msg.Body))
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", msg.ContentEncoding)
+}
@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_ContentType(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{Path: "/foo", HeaderJSON: `{"Key":"Value"}`}
+	a.Equal("", msg.ContentType)
+	a.False(msg.IsBinary())
+
+	a.NoError(msg.SetContentType("image/png"))
+	a.Equal("image/png", msg.ContentType)
+	a.Equal("image/png", msg.Header(ContentTypeHeader))
+	a.True(msg.IsBinary())
+	a.Contains(msg.HeaderJSON, `"Key":"Value"`)
+
+	for contentType, binary := range map[string]bool{
+		"text/plain; charset=utf-8": false,
+		"application/json":          false,
+		"application/ld+json":       false,
+		"application/atom+xml":      false,
+		"application/octet-stream":  true,
+		"application/x-protobuf":    true,
+		"invalid;;":                 false,
+	} {
+		a.NoError(msg.SetContentType(contentType))
+		a.Equal(binary, msg.IsBinary(), contentType)
+	}
+}
+
+func TestMessage_BinaryBody(t *testing.T) {
+	a := assert.New(t)
+
+	body := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00}
+	msg := &Message{ID: 42, Path: "/foo", UserID: "marvin", ApplicationID: "app", Time: 1420110000, Body: body}
+	a.NoError(msg.SetContentType("image/png"))
+
+	parsed, err := ParseMessage(msg.Bytes())
+	a.NoError(err)
+	a.Equal(body, parsed.Body)
+	a.Equal("image/png", parsed.ContentType)
+}
+
+func TestMessage_ContentEncoding(t *testing.T) {
+	a := assert.New(t)
+
+	compressed := &bytes.Buffer{}
+	w := gzip.NewWriter(compressed)
+	w.Write([]byte(`{"key":"value"}`))
+	w.Close()
+
+	msg := &Message{ID: 42, Path: "/foo", Time: 1420110000, Body: compressed.Bytes()}
+	a.NoError(msg.SetContentType("application/json"))
+	a.NoError(msg.SetContentEncoding("gzip"))
+	a.True(msg.IsBinary())
+
+	// the content metadata is preserved by the serialization
+	parsed, err := ParseMessage(msg.Bytes())
+	a.NoError(err)
+	a.Equal("application/json", parsed.ContentType)
+	a.Equal("gzip", parsed.ContentEncoding)
+	body, err := parsed.DecodedBody()
+	a.NoError(err)
+	a.Equal(`{"key":"value"}`, string(body))
+
+	parsed.ContentEncoding = "identity"
+	a.False(parsed.IsBinary())
+	body, err = parsed.DecodedBody()
+	a.NoError(err)
+	a.Equal(compressed.Bytes(), body)
+
+	parsed.ContentEncoding = "br"
+	_, err = parsed.DecodedBody()
+	a.EqualError(err, `unsupported content encoding "br"`)
+}
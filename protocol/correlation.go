@@ -0,0 +1,46 @@
+package protocol
+
+// CorrelationIDHeader is the field of the message header with the ID correlating the message with the other messages
+// of a flow, e.g. a reply with its request. It matches the header "X-Guble-Correlation-Id" of the REST API.
+const CorrelationIDHeader = "Correlation-Id"
+
+// ReplyToHeader is the field of the message header with the path to publish the replies to,
+// e.g. by the requests of the Go client. It matches the header "X-Guble-Reply-To" of the REST API.
+const ReplyToHeader = "Reply-To"
+
+// ParseCorrelation sets the correlation ID and the reply-to path from the message header.
+func (msg *Message) ParseCorrelation() {
+	msg.parseCorrelation(msg.decodeHeader())
+}
+
+func (msg *Message) parseCorrelation(header map[string]interface{}) {
+	msg.CorrelationID, _ = header[CorrelationIDHeader].(string)
+	msg.ReplyTo, _ = header[ReplyToHeader].(string)
+}
+
+// SetCorrelationID sets the correlation ID in the message header, keeping its other fields.
+func (msg *Message) SetCorrelationID(correlationID string) error {
+	if err := msg.SetHeader(CorrelationIDHeader, correlationID); err != nil {
+		return err
+	}
+	msg.CorrelationID = correlationID
+	return nil
+}
+
+// SetReplyTo sets the path to publish the replies to in the message header, keeping its other fields.
+func (msg *Message) SetReplyTo(path string) error {
+	if err := msg.SetHeader(ReplyToHeader, path); err != nil {
+		return err
+	}
+	msg.ReplyTo = path
+	return nil
+}
+
+// NewReply returns a reply to the message, to be published to its reply-to path with its correlation ID.
+func (msg *Message) NewReply(body []byte) *Message {
+	reply := &Message{Path: Path(msg.ReplyTo), Body: body}
+	if msg.CorrelationID != "" {
+		reply.SetCorrelationID(msg.CorrelationID)
+	}
+	return reply
+}
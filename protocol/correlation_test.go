@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_Correlation(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{ID: 42, Path: "/orders", Time: 1420110000, HeaderJSON: `{"Key":"Value"}`, Body: []byte("order 17")}
+	msg.ParseCorrelation()
+	a.Equal("", msg.CorrelationID)
+	a.Equal("", msg.ReplyTo)
+
+	a.NoError(msg.SetCorrelationID("b50vu0a23akg00a5k3jg"))
+	a.NoError(msg.SetReplyTo("/replies/b50vu0a23akg00a5k3jg"))
+	a.JSONEq(`{"Key":"Value","Correlation-Id":"b50vu0a23akg00a5k3jg","Reply-To":"/replies/b50vu0a23akg00a5k3jg"}`, msg.HeaderJSON)
+
+	// the fields are serialized in both encodings
+	for _, data := range [][]byte{msg.Bytes(), msg.MarshalProto()} {
+		decoded, err := Decode(data)
+		a.NoError(err)
+		parsed := decoded.(*Message)
+		a.Equal("b50vu0a23akg00a5k3jg", parsed.CorrelationID)
+		a.Equal("/replies/b50vu0a23akg00a5k3jg", parsed.ReplyTo)
+	}
+
+	// the reply is published to the reply-to path with the correlation ID
+	reply := msg.NewReply([]byte("accepted"))
+	a.Equal(Path("/replies/b50vu0a23akg00a5k3jg"), reply.Path)
+	a.Equal("b50vu0a23akg00a5k3jg", reply.CorrelationID)
+	a.JSONEq(`{"Correlation-Id":"b50vu0a23akg00a5k3jg"}`, reply.HeaderJSON)
+	a.Equal("", (&Message{ReplyTo: "/replies/1"}).NewReply(nil).HeaderJSON)
+}
@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// The fields of the message header carrying the metadata of an end-to-end encrypted body.
+// They match the headers "X-Guble-Encryption-Key-Id", "X-Guble-Encryption-Algorithm" and "X-Guble-Encryption-Nonce"
+// of the REST API.
+const (
+	EncryptionKeyIDHeader     = "Encryption-Key-Id"
+	EncryptionAlgorithmHeader = "Encryption-Algorithm"
+	EncryptionNonceHeader     = "Encryption-Nonce"
+)
+
+var (
+	ErrEncryptionKeyID     = errors.New("The encryption metadata requires a key ID")
+	ErrEncryptionAlgorithm = errors.New("The encryption metadata requires an algorithm")
+	ErrEncryptionNonce     = errors.New("The nonce of the encryption metadata has to be base64 encoded")
+)
+
+// Encryption is the metadata of an end-to-end encrypted body, given by the publisher for the subscribers.
+// The server never decrypts the body: it is stored, fetched and sent by the connectors unchanged.
+type Encryption struct {
+	KeyID     string
+	Algorithm string
+	// Nonce is base64 encoded (standard or URL encoding, with or without padding); it is optional
+	Nonce string
+}
+
+// Validate checks that the metadata has a key ID and an algorithm, and that its nonce (if any) is base64 encoded.
+func (e *Encryption) Validate() error {
+	if e.KeyID == "" {
+		return ErrEncryptionKeyID
+	}
+	if e.Algorithm == "" {
+		return ErrEncryptionAlgorithm
+	}
+	if e.Nonce != "" && !isBase64(e.Nonce) {
+		return ErrEncryptionNonce
+	}
+	return nil
+}
+
+func isBase64(s string) bool {
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		if _, err := encoding.DecodeString(s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Encryption returns the encryption metadata of the message header, or nil if the body is not encrypted.
+func (msg *Message) Encryption() *Encryption {
+	if msg.HeaderJSON == "" {
+		return nil
+	}
+	header := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(msg.HeaderJSON), &header); err != nil {
+		return nil
+	}
+	e := &Encryption{}
+	e.KeyID, _ = header[EncryptionKeyIDHeader].(string)
+	e.Algorithm, _ = header[EncryptionAlgorithmHeader].(string)
+	e.Nonce, _ = header[EncryptionNonceHeader].(string)
+	if e.KeyID == "" && e.Algorithm == "" && e.Nonce == "" {
+		return nil
+	}
+	return e
+}
+
+// IsEncrypted returns true if the message header has encryption metadata.
+func (msg *Message) IsEncrypted() bool {
+	return msg.Encryption() != nil
+}
+
+// SetEncryption sets the encryption metadata in the message header, keeping its other fields.
+func (msg *Message) SetEncryption(e Encryption) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if err := msg.SetHeader(EncryptionKeyIDHeader, e.KeyID); err != nil {
+		return err
+	}
+	if err := msg.SetHeader(EncryptionAlgorithmHeader, e.Algorithm); err != nil {
+		return err
+	}
+	if e.Nonce == "" {
+		return nil
+	}
+	return msg.SetHeader(EncryptionNonceHeader, e.Nonce)
+}
+
+// ValidateEncryption returns an error if the message header has invalid encryption metadata.
+func (msg *Message) ValidateEncryption() error {
+	if e := msg.Encryption(); e != nil {
+		return e.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_Encryption(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{Path: "/foo", HeaderJSON: `{"Content-Type":"application/octet-stream"}`}
+	a.Nil(msg.Encryption())
+	a.False(msg.IsEncrypted())
+	a.NoError(msg.ValidateEncryption())
+
+	a.NoError(msg.SetEncryption(Encryption{KeyID: "team-a-2024", Algorithm: "A256GCM", Nonce: "3q2+7w3q2+7w3q2+"}))
+	a.True(msg.IsEncrypted())
+	a.Equal(&Encryption{KeyID: "team-a-2024", Algorithm: "A256GCM", Nonce: "3q2+7w3q2+7w3q2+"}, msg.Encryption())
+	a.Contains(msg.HeaderJSON, `"Content-Type":"application/octet-stream"`)
+
+	a.Equal(ErrEncryptionAlgorithm, msg.SetEncryption(Encryption{KeyID: "team-a-2024"}))
+
+	msg.HeaderJSON = `{"Encryption-Key-Id":"team-a-2024","Encryption-Algorithm":"A256GCM","Encryption-Nonce":"not base64!"}`
+	a.Equal(ErrEncryptionNonce, msg.ValidateEncryption())
+	msg.HeaderJSON = `{"Encryption-Nonce":"3q2+7w3q2+7w3q2+"}`
+	a.Equal(ErrEncryptionKeyID, msg.ValidateEncryption())
+}
+
+func TestMessage_EncryptedBodyIsOpaque(t *testing.T) {
+	a := assert.New(t)
+
+	// a binary body, with newlines and commas, is serialized (e.g. in the store) and parsed unchanged
+	body := []byte{0x00, '\n', 0xff, ',', '\n', '\n', 0x7f}
+	msg := &Message{ID: 42, Path: "/foo", UserID: "marvin", ApplicationID: "app", Time: 1420110000, Body: body}
+	a.NoError(msg.SetEncryption(Encryption{KeyID: "team-a-2024", Algorithm: "A256GCM"}))
+
+	parsed, err := ParseMessage(msg.Bytes())
+	a.NoError(err)
+	a.Equal(body, parsed.Body)
+	a.Equal(msg.Encryption(), parsed.Encryption())
+}
@@ -10,8 +10,11 @@ import (
 
 func PanicLogger() {
 	if r := recover(); r != nil {
-		log.Printf("PANIC (%v): %v", identifyLogOrigin(), r)
-		log.Printf(getStackTraceMessage(fmt.Sprintf("%v", r)))
+		log.WithFields(log.Fields{
+			"origin": identifyLogOrigin(),
+			"panic":  fmt.Sprintf("%v", r),
+			"stack":  getStackTraceMessage(fmt.Sprintf("%v", r)),
+		}).Error("PANIC")
 	}
 }
 
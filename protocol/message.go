@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 )
@@ -41,6 +43,28 @@ type Message struct {
 
 	// Used in cluster mode to identify a guble node
 	NodeID uint8
+
+	// The expiration time, as Unix Timestamp (0 if the message does not expire).
+	// It is serialized in the header field Expires (see ExpiresHeader).
+	Expires int64
+
+	// The media type and the encoding of the body ("" if they are not given).
+	// They are serialized in the header fields Content-Type and Content-Encoding (see ContentTypeHeader).
+	ContentType     string
+	ContentEncoding string
+
+	// The ID correlating the message with the other messages of a flow (e.g. a reply with its request),
+	// and the path to publish the replies to ("" if they are not given).
+	// They are serialized in the header fields Correlation-Id and Reply-To (see CorrelationIDHeader).
+	CorrelationID string
+	ReplyTo       string
+
+	// The priority of the message, PriorityNormal if it is not given.
+	// It is serialized in the header field Priority (see PriorityHeader).
+	Priority Priority
+
+	// The time the message was received by this node, for measuring its delivery latency (not serialized)
+	ReceivedAt time.Time
 }
 
 type MessageDeliveryCallback func(*Message)
@@ -52,6 +76,16 @@ func (msg *Message) Metadata() string {
 	return string(buff.Bytes())
 }
 
+// LogFields returns the fields identifying the message in the structured log entries.
+func (msg *Message) LogFields() log.Fields {
+	return log.Fields{
+		"messageID": msg.ID,
+		"topic":     string(msg.Path),
+		"userID":    msg.UserID,
+		"node":      msg.NodeID,
+	}
+}
+
 func (msg *Message) String() string {
 	return fmt.Sprintf("%d", msg.ID)
 }
@@ -121,6 +155,216 @@ func (msg *Message) decodeFilters(data []byte) {
 	}
 }
 
+// Header returns a string field of the header of the message, or "" if there is none.
+func (msg *Message) Header(key string) string {
+	value, _ := msg.decodeHeader()[key].(string)
+	return value
+}
+
+// decodeHeader returns the fields of the header, or nil if it is empty or invalid.
+func (msg *Message) decodeHeader() map[string]interface{} {
+	if msg.HeaderJSON == "" {
+		return nil
+	}
+	header := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(msg.HeaderJSON), &header); err != nil {
+		return nil
+	}
+	return header
+}
+
+// ParseHeader decodes the header once, and sets the expiration time, the priority, the media type and the encoding
+// of the body, the correlation ID and the reply-to path from it. The error is the one of the expiration time
+// or of the priority, whose fields are then left unset.
+func (msg *Message) ParseHeader() error {
+	header := msg.decodeHeader()
+	msg.parseContent(header)
+	msg.parseCorrelation(header)
+	err := msg.parseExpires(header)
+	if perr := msg.parsePriority(header); err == nil {
+		err = perr
+	}
+	return err
+}
+
+// ExpiresHeader is the field of the message header with the expiration time of the message, after which it is
+// not delivered anymore: a Unix timestamp, an RFC 3339 time, or a duration after the publishing time (e.g. "30s").
+const ExpiresHeader = "Expires"
+
+// ParseExpires sets the expiration time of the message from its header, a duration being added
+// to the publishing time (or to the current time if it is not set yet).
+func (msg *Message) ParseExpires() error {
+	if !strings.Contains(msg.HeaderJSON, `"`+ExpiresHeader+`"`) {
+		msg.Expires = 0
+		return nil
+	}
+	return msg.parseExpires(msg.decodeHeader())
+}
+
+func (msg *Message) parseExpires(header map[string]interface{}) error {
+	msg.Expires = 0
+	switch value := header[ExpiresHeader].(type) {
+	case nil:
+		return nil
+	case float64:
+		msg.Expires = int64(value)
+		return nil
+	case string:
+		if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+			msg.Expires = timestamp
+			return nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			msg.Expires = t.Unix()
+			return nil
+		}
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			published := msg.Time
+			if published == 0 {
+				published = time.Now().Unix()
+			}
+			msg.Expires = published + int64(math.Ceil(d.Seconds()))
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid expiration time %v: use a Unix timestamp, an RFC 3339 time or a duration", header[ExpiresHeader])
+}
+
+// SetExpires sets the expiration time of the message, in its header.
+func (msg *Message) SetExpires(t time.Time) error {
+	if err := msg.SetHeader(ExpiresHeader, t.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	msg.Expires = t.Unix()
+	return nil
+}
+
+// Expired returns true if the message has an expiration time, which is passed.
+func (msg *Message) Expired(now time.Time) bool {
+	return msg.Expires > 0 && now.Unix() >= msg.Expires
+}
+
+// IsExpired returns true if the serialized message has an expiration time, which is passed.
+func IsExpired(data []byte, now time.Time) bool {
+	if !bytes.Contains(data, []byte(`"`+ExpiresHeader+`"`)) {
+		return false
+	}
+	msg, err := ParseMessage(data)
+	return err == nil && msg.Expired(now)
+}
+
+// Priority is the priority of a message: the connectors map it to the priority of their push service.
+type Priority int
+
+// The priorities of the messages, serialized by their names.
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// PriorityHeader is the field of the message header with the priority of the message: "low", "normal" or "high".
+const PriorityHeader = "Priority"
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return strconv.Itoa(int(p))
+}
+
+// ParsePriority returns the priority of the given name, ignoring the case.
+func ParsePriority(name string) (Priority, error) {
+	for p, n := range priorityNames {
+		if strings.EqualFold(name, n) {
+			return p, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("invalid priority %q: use low, normal or high", name)
+}
+
+// ParsePriority sets the priority of the message from its header.
+func (msg *Message) ParsePriority() error {
+	if !strings.Contains(msg.HeaderJSON, `"`+PriorityHeader+`"`) {
+		msg.Priority = PriorityNormal
+		return nil
+	}
+	return msg.parsePriority(msg.decodeHeader())
+}
+
+func (msg *Message) parsePriority(header map[string]interface{}) error {
+	msg.Priority = PriorityNormal
+	switch value := header[PriorityHeader].(type) {
+	case nil:
+		return nil
+	case string:
+		p, err := ParsePriority(value)
+		if err != nil {
+			return err
+		}
+		msg.Priority = p
+		return nil
+	}
+	return fmt.Errorf("invalid priority %v: use low, normal or high", header[PriorityHeader])
+}
+
+// SetPriority sets the priority of the message, in its header.
+func (msg *Message) SetPriority(p Priority) error {
+	if _, ok := priorityNames[p]; !ok {
+		return fmt.Errorf("invalid priority %v", p)
+	}
+	if err := msg.SetHeader(PriorityHeader, p.String()); err != nil {
+		return err
+	}
+	msg.Priority = p
+	return nil
+}
+
+// SetHeader sets a field of the header of the message, keeping its other fields.
+func (msg *Message) SetHeader(key, value string) error {
+	header := make(map[string]interface{})
+	if msg.HeaderJSON != "" {
+		if err := json.Unmarshal([]byte(msg.HeaderJSON), &header); err != nil {
+			return err
+		}
+	}
+	header[key] = value
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	msg.HeaderJSON = string(data)
+	return nil
+}
+
+// DeleteHeader removes a field of the header of the message, keeping its other fields.
+func (msg *Message) DeleteHeader(key string) error {
+	if msg.HeaderJSON == "" {
+		return nil
+	}
+	header := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(msg.HeaderJSON), &header); err != nil {
+		return err
+	}
+	delete(header, key)
+	if len(header) == 0 {
+		msg.HeaderJSON = ""
+		return nil
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	msg.HeaderJSON = string(data)
+	return nil
+}
+
 func (msg *Message) SetFilter(key, value string) {
 	if msg.Filters == nil {
 		msg.Filters = make(map[string]string, 1)
@@ -136,11 +380,24 @@ const (
 	SUCCESS_FETCH_END     = "fetch-end"
 	SUCCESS_SUBSCRIBED_TO = "subscribed-to"
 	SUCCESS_CANCELED      = "canceled"
+	SUCCESS_RECONNECT     = "reconnect"
 	ERROR_SUBSCRIBED_TO   = "error-subscribed-to"
+	ERROR_SEND            = "error-send"
 	ERROR_BAD_REQUEST     = "error-bad-request"
 	ERROR_INTERNAL_SERVER = "error-server-internal"
+	ERROR_RATE_LIMITED    = "error-rate-limited"
+	ERROR_QUOTA_EXCEEDED  = "error-quota-exceeded"
+	ERROR_UNAVAILABLE     = "error-unavailable"
 )
 
+// SendReceipt is the json data of the send notification of a message sent with a publisherMessageId.
+type SendReceipt struct {
+	SequenceID            uint64 `json:"sequenceId"`
+	Path                  string `json:"path"`
+	PublisherMessageID    string `json:"publisherMessageId"`
+	MessagePublishingTime int64  `json:"messagePublishingTime"`
+}
+
 // NotificationMessage is a representation of a status messages or error message, sent from the server
 type NotificationMessage struct {
 
@@ -181,11 +438,15 @@ func (msg *NotificationMessage) Bytes() []byte {
 }
 
 // Decode decodes a message, sent from the server to the client.
-// The decoded messages can have one of the types: *Message or *NotificationMessage
+// The decoded messages can have one of the types: *Message or *NotificationMessage; the messages can be in the text
+// or in the protobuf encoding.
 func Decode(message []byte) (interface{}, error) {
 	if len(message) >= 1 && (message[0] == '#' || message[0] == '!') {
 		return parseNotificationMessage(message)
 	}
+	if IsProto(message) {
+		return ParseProtoMessage(message)
+	}
 	return ParseMessage(message)
 }
 
@@ -238,9 +499,17 @@ func ParseMessage(message []byte) (*Message, error) {
 		msg.Body = []byte(parts[2])
 	}
 
+	msg.parseHeader()
 	return msg, nil
 }
 
+// parseHeader sets the fields of the message given by its header, logging the invalid ones.
+func (msg *Message) parseHeader() {
+	if err := msg.ParseHeader(); err != nil {
+		log.WithError(err).WithField("header", msg.HeaderJSON).Error("Error decoding the header")
+	}
+}
+
 func parseNotificationMessage(message []byte) (*NotificationMessage, error) {
 	msg := &NotificationMessage{}
 
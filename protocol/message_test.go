@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -40,6 +41,137 @@ func TestParsingANormalMessage(t *testing.T) {
 	assert.Equal("Hello World", string(msg.Body))
 }
 
+func TestMessageLogFields(t *testing.T) {
+	msg := &Message{ID: 42, Path: "/foo/bar", UserID: "marvin", NodeID: 2}
+
+	fields := msg.LogFields()
+	assert.Equal(t, uint64(42), fields["messageID"])
+	assert.Equal(t, "/foo/bar", fields["topic"])
+	assert.Equal(t, "marvin", fields["userID"])
+	assert.Equal(t, uint8(2), fields["node"])
+}
+
+func TestMessageSetHeader(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{}
+	a.NoError(msg.SetHeader("requestID", "id1"))
+	a.Equal(`{"requestID":"id1"}`, msg.HeaderJSON)
+
+	msg.HeaderJSON = `{"Correlation-Id": "7sdks723ksgqn"}`
+	a.NoError(msg.SetHeader("requestID", "id2"))
+	a.JSONEq(`{"Correlation-Id": "7sdks723ksgqn", "requestID": "id2"}`, msg.HeaderJSON)
+
+	msg.HeaderJSON = "{invalid"
+	a.Error(msg.SetHeader("requestID", "id3"))
+	a.Equal("{invalid", msg.HeaderJSON)
+}
+
+func TestMessageParseExpires(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		header  string
+		expires int64
+	}{
+		{``, 0},
+		{`{"Content-Type": "text/plain"}`, 0},
+		{`{"Expires": 1420113600}`, 1420113600},
+		{`{"Expires": "1420113600"}`, 1420113600},
+		{`{"Expires": "2015-01-01T13:00:00+01:00"}`, 1420113600},
+		{`{"Expires": "1h"}`, 1420113600},
+		{`{"Expires": "1.5s"}`, 1420110002},
+	}
+	for i, c := range cases {
+		msg := &Message{Time: unixTime.Unix(), HeaderJSON: c.header}
+		a.NoError(msg.ParseExpires(), fmt.Sprintf("case %d", i))
+		a.Equal(c.expires, msg.Expires, fmt.Sprintf("case %d", i))
+	}
+
+	msg := &Message{HeaderJSON: `{"Expires": "10s"}`}
+	a.NoError(msg.ParseExpires())
+	a.InDelta(time.Now().Unix()+10, msg.Expires, 1)
+
+	for _, header := range []string{`{"Expires": "tomorrow"}`, `{"Expires": "-1h"}`, `{"Expires": true}`} {
+		msg := &Message{HeaderJSON: header, Expires: 42}
+		a.Error(msg.ParseExpires(), header)
+		a.Equal(int64(0), msg.Expires)
+	}
+}
+
+func TestMessageExpires(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{ID: 42, Path: "/foo", Time: unixTime.Unix(), HeaderJSON: `{"Content-Type": "text/plain"}`, Body: []byte("hello")}
+	a.False(msg.Expired(unixTime.Add(100 * 365 * 24 * time.Hour)))
+	a.False(IsExpired(msg.Bytes(), unixTime))
+
+	// the expiration time is serialized in the header
+	a.NoError(msg.SetExpires(unixTime.Add(time.Hour)))
+	a.JSONEq(`{"Content-Type": "text/plain", "Expires": "2015-01-01T12:00:00Z"}`, msg.HeaderJSON)
+
+	parsed, err := ParseMessage(msg.Bytes())
+	a.NoError(err)
+	a.Equal(unixTime.Add(time.Hour).Unix(), parsed.Expires)
+
+	a.False(parsed.Expired(unixTime.Add(time.Hour - time.Second)))
+	a.True(parsed.Expired(unixTime.Add(time.Hour)))
+	a.False(IsExpired(msg.Bytes(), unixTime))
+	a.True(IsExpired(msg.Bytes(), unixTime.Add(2*time.Hour)))
+}
+
+func TestMessagePriority(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{ID: 42, Path: "/foo", HeaderJSON: `{"Content-Type": "text/plain"}`, Body: []byte("hello")}
+	a.NoError(msg.ParsePriority())
+	a.Equal(PriorityNormal, msg.Priority)
+
+	// the priority is serialized in the header
+	a.NoError(msg.SetPriority(PriorityHigh))
+	a.JSONEq(`{"Content-Type": "text/plain", "Priority": "high"}`, msg.HeaderJSON)
+	parsed, err := ParseMessage(msg.Bytes())
+	a.NoError(err)
+	a.Equal(PriorityHigh, parsed.Priority)
+	a.Equal("high", parsed.Priority.String())
+
+	msg = &Message{HeaderJSON: `{"Priority": "LOW"}`}
+	a.NoError(msg.ParsePriority())
+	a.Equal(PriorityLow, msg.Priority)
+
+	for _, header := range []string{`{"Priority": "urgent"}`, `{"Priority": 1}`} {
+		msg := &Message{HeaderJSON: header, Priority: PriorityHigh}
+		a.Error(msg.ParsePriority(), header)
+		a.Equal(PriorityNormal, msg.Priority)
+	}
+	a.Error(msg.SetPriority(Priority(5)))
+}
+
+func TestMessage_ParseHeader(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{HeaderJSON: `{"Expires": 1420113600, "Priority": "high", "Content-Type": "image/png",
+		"Content-Encoding": "gzip", "Correlation-Id": "abc", "Reply-To": "/replies"}`}
+	a.NoError(msg.ParseHeader())
+	a.Equal(int64(1420113600), msg.Expires)
+	a.Equal(PriorityHigh, msg.Priority)
+	a.Equal("image/png", msg.ContentType)
+	a.Equal("gzip", msg.ContentEncoding)
+	a.Equal("abc", msg.CorrelationID)
+	a.Equal("/replies", msg.ReplyTo)
+
+	// the other fields are set even if the priority is invalid
+	msg = &Message{HeaderJSON: `{"Priority": "urgent", "Correlation-Id": "abc"}`}
+	a.Error(msg.ParseHeader())
+	a.Equal(PriorityNormal, msg.Priority)
+	a.Equal("abc", msg.CorrelationID)
+
+	msg = &Message{HeaderJSON: `not json`, Priority: PriorityHigh, ContentType: "text/plain"}
+	a.NoError(msg.ParseHeader())
+	a.Equal(PriorityNormal, msg.Priority)
+	a.Equal("", msg.ContentType)
+}
+
 func TestSerializeANormalMessage(t *testing.T) {
 	// given: a message
 	msg := &Message{
@@ -224,3 +356,17 @@ func TestMessage_decodeFilters(t *testing.T) {
 	a.Equal(msg.Filters["user"], "user01")
 	a.Equal(msg.Filters["device_id"], "ID_DEVICE")
 }
+
+func TestMessage_Header(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{}
+	a.Equal("", msg.Header("Key"))
+
+	msg.HeaderJSON = `{"Key":"Value","Count":1}`
+	a.Equal("Value", msg.Header("Key"))
+	a.Equal("", msg.Header("Count"))
+
+	msg.HeaderJSON = "invalid"
+	a.Equal("", msg.Header("Key"))
+}
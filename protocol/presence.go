@@ -0,0 +1,11 @@
+package protocol
+
+// PresencePrefix is the prefix of the topics where the server publishes the presence events of the users,
+// e.g. /presence/marvin.
+const PresencePrefix = "/presence/"
+
+// The bodies of the presence events: a user joins with its first connection, and leaves with its last one.
+const (
+	PresenceJoin  = "join"
+	PresenceLeave = "leave"
+)
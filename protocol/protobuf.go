@@ -0,0 +1,76 @@
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/smancke/guble/protocol/pb"
+)
+
+// EncodingHeader is the header of the websocket handshake choosing the encoding of the messages sent
+// to the client: EncodingProtobuf, or the text encoding by default. The notifications are always text.
+const EncodingHeader = "Guble-Encoding"
+
+// EncodingProtobuf is the value of the EncodingHeader choosing the protobuf encoding (see pb/message.proto).
+const EncodingProtobuf = "protobuf"
+
+// IsProto returns true if the data is a message in the protobuf encoding: the messages in the text encoding
+// start with their path, and the notifications with '#' or '!'.
+func IsProto(data []byte) bool {
+	return len(data) > 0 && data[0] != '/' && data[0] != '#' && data[0] != '!'
+}
+
+// MarshalProto returns the message in the protobuf encoding (see pb/message.proto).
+func (msg *Message) MarshalProto() []byte {
+	data, err := proto.Marshal(msg.ToProto())
+	if err != nil {
+		// a message without required or nested fields is always marshalled
+		panic(err)
+	}
+	return data
+}
+
+// ToProto returns the generated protobuf message with the fields of the message.
+func (msg *Message) ToProto() *pb.Message {
+	return &pb.Message{
+		Id:            msg.ID,
+		Path:          string(msg.Path),
+		UserId:        msg.UserID,
+		ApplicationId: msg.ApplicationID,
+		Time:          msg.Time,
+		HeaderJson:    msg.HeaderJSON,
+		Body:          msg.Body,
+		NodeId:        uint32(msg.NodeID),
+		Filters:       msg.Filters,
+	}
+}
+
+// ParseProtoMessage parses a message in the protobuf encoding. The unknown fields are skipped.
+func ParseProtoMessage(data []byte) (*Message, error) {
+	pm := &pb.Message{}
+	if err := proto.Unmarshal(data, pm); err != nil {
+		return nil, err
+	}
+	if len(pm.Path) == 0 || pm.Path[0] != '/' {
+		return nil, fmt.Errorf("message has invalid topic, got %v", pm.Path)
+	}
+	if pm.NodeId > 255 {
+		return nil, fmt.Errorf("invalid node ID %d", pm.NodeId)
+	}
+
+	msg := &Message{
+		ID:            pm.Id,
+		Path:          Path(pm.Path),
+		UserID:        pm.UserId,
+		ApplicationID: pm.ApplicationId,
+		Time:          pm.Time,
+		HeaderJSON:    pm.HeaderJson,
+		Body:          pm.Body,
+		NodeID:        uint8(pm.NodeId),
+	}
+	for key, value := range pm.Filters {
+		msg.SetFilter(key, value)
+	}
+	msg.parseHeader()
+	return msg, nil
+}
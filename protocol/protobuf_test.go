@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_MarshalProto(t *testing.T) {
+	a := assert.New(t)
+
+	msg := &Message{ID: 42, Path: "/foo", Time: 1}
+	a.Equal([]byte{0x08, 42, 0x12, 4, '/', 'f', 'o', 'o', 0x28, 1}, msg.MarshalProto())
+
+	msg = &Message{
+		ID:            42,
+		Path:          "/foo/bar",
+		UserID:        "marvin",
+		ApplicationID: "app",
+		Time:          1420110000,
+		HeaderJSON:    `{"Content-Type": "text/plain", "Priority": "high"}`,
+		Body:          []byte("Hello\nWorld"),
+		NodeID:        3,
+		Filters:       map[string]string{"user": "marvin", "device": "tablet"},
+	}
+	data := msg.MarshalProto()
+	a.True(IsProto(data))
+	a.False(IsProto(msg.Bytes()))
+
+	parsed, err := ParseProtoMessage(data)
+	a.NoError(err)
+	a.Equal(msg.ID, parsed.ID)
+	a.Equal(msg.Path, parsed.Path)
+	a.Equal(msg.UserID, parsed.UserID)
+	a.Equal(msg.ApplicationID, parsed.ApplicationID)
+	a.Equal(msg.Time, parsed.Time)
+	a.Equal(msg.HeaderJSON, parsed.HeaderJSON)
+	a.Equal(msg.Body, parsed.Body)
+	a.Equal(msg.NodeID, parsed.NodeID)
+	a.Equal(msg.Filters, parsed.Filters)
+
+	// the fields of the header are parsed
+	a.Equal("text/plain", parsed.ContentType)
+	a.Equal(PriorityHigh, parsed.Priority)
+
+	decoded, err := Decode(data)
+	a.NoError(err)
+	a.Equal(parsed, decoded)
+}
+
+func TestParseProtoMessage_Errors(t *testing.T) {
+	a := assert.New(t)
+
+	// the unknown fields are skipped
+	data := append([]byte{0x50, 1, 0x5a, 2, 'x', 'y', 0x61, 1, 2, 3, 4, 5, 6, 7, 8}, (&Message{Path: "/foo"}).MarshalProto()...)
+	msg, err := ParseProtoMessage(data)
+	a.NoError(err)
+	a.Equal(Path("/foo"), msg.Path)
+
+	_, err = ParseProtoMessage([]byte{0x12, 4, '/', 'f'})
+	a.Error(err)
+
+	_, err = ParseProtoMessage([]byte{0x12, 3, 'f', 'o', 'o'})
+	a.EqualError(err, "message has invalid topic, got foo")
+
+	_, err = ParseProtoMessage([]byte{0x0b})
+	a.Error(err)
+
+	_, err = ParseProtoMessage([]byte{0x12, 4, '/', 'f', 'o', 'o', 0x40, 0x80, 0x02})
+	a.EqualError(err, "invalid node ID 256")
+}
@@ -202,4 +202,106 @@ $MOCKGEN -self_package router -package sms \
       github.com/smancke/guble/server/store \
       MessageStore &
 
+# server/grpc Mocks
+$MOCKGEN -package grpc \
+      -destination server/grpc/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/graphql Mocks
+$MOCKGEN -package graphql \
+      -destination server/graphql/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/stomp Mocks
+$MOCKGEN -package stomp \
+      -destination server/stomp/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/amqp Mocks
+$MOCKGEN -package amqp \
+      -destination server/amqp/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/nats Mocks
+$MOCKGEN -package nats \
+      -destination server/nats/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/redis Mocks
+$MOCKGEN -package redis \
+      -destination server/redis/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/webhook Mocks
+$MOCKGEN -package webhook \
+      -destination server/webhook/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/slack Mocks
+$MOCKGEN -package slack \
+      -destination server/slack/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/wns Mocks
+$MOCKGEN -package wns \
+      -destination server/wns/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/hms Mocks
+$MOCKGEN -package hms \
+      -destination server/hms/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/pubsub Mocks
+$MOCKGEN -package pubsub \
+      -destination server/pubsub/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/sns Mocks
+$MOCKGEN -package sns \
+      -destination server/sns/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/xmpp Mocks
+$MOCKGEN -package xmpp \
+      -destination server/xmpp/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/telegram Mocks
+$MOCKGEN -package telegram \
+      -destination server/telegram/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/plugin Mocks
+$MOCKGEN -package plugin \
+      -destination server/plugin/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/federation Mocks
+$MOCKGEN -package federation \
+      -destination server/federation/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
+# server/alerting Mocks
+$MOCKGEN -package alerting \
+      -destination server/alerting/mocks_router_gen_test.go \
+      github.com/smancke/guble/server/router \
+      Router &
+
 wait
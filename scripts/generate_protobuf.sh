@@ -0,0 +1,15 @@
+#!/bin/bash -xe
+
+# Prerequisites: protoc and protoc-gen-go should be installed
+#   go get github.com/golang/protobuf/protoc-gen-go
+
+if [ -z "$GOPATH" ]; then
+      echo "Missing $GOPATH!";
+      exit 1
+fi
+
+# the gRPC API imports the message of the protobuf encoding from protocol/pb
+PB_IMPORT=Mprotocol/pb/message.proto=github.com/smancke/guble/protocol/pb
+
+protoc -I . --go_out=. protocol/pb/message.proto
+protoc -I . --go_out=plugins=grpc,$PB_IMPORT:. server/grpc/guble.proto
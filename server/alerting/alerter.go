@@ -0,0 +1,201 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/metrics"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// DefaultInterval is the interval of checking the rules
+	DefaultInterval = 30 * time.Second
+
+	// DefaultTopic is the reserved topic where the alerts are published
+	DefaultTopic = "/_guble/alerts"
+
+	// StatusFiring is the status of an alert whose rule started to be breached
+	StatusFiring = "firing"
+	// StatusResolved is the status of an alert whose rule is not breached anymore
+	StatusResolved = "resolved"
+
+	alertUserID    = "guble"
+	webhookTimeout = 10 * time.Second
+)
+
+// Config is used for configuring the alerting thresholds and their notifications.
+type Config struct {
+	Rules      *[]string
+	Interval   *time.Duration
+	WebhookURL *string
+	Topic      *string
+}
+
+// Alert is the notification of a rule starting, or stopping, to be breached.
+// It is posted as JSON to the webhook, and published to the alert topic.
+type Alert struct {
+	Rule      string  `json:"rule"`
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Status    string  `json:"status"`
+	Time      int64   `json:"time"`
+}
+
+// Alerter checks periodically the rules against the current values of the metrics, and notifies
+// (through the webhook and/or the alert topic) when a rule starts to be breached, and when it is resolved.
+type Alerter struct {
+	router   router.Router
+	rules    []Rule
+	interval time.Duration
+	webhook  string
+	topic    protocol.Path
+	client   *http.Client
+
+	breached map[string]bool
+
+	stopC chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New returns a new Alerter, or an error if a rule is invalid.
+func New(router router.Router, config Config) (*Alerter, error) {
+	a := &Alerter{
+		router:   router,
+		interval: DefaultInterval,
+		client:   &http.Client{Timeout: webhookTimeout},
+		breached: make(map[string]bool),
+	}
+	if config.Rules != nil {
+		for _, s := range *config.Rules {
+			rule, err := ParseRule(s)
+			if err != nil {
+				return nil, err
+			}
+			a.rules = append(a.rules, rule)
+		}
+	}
+	if config.Interval != nil && *config.Interval > 0 {
+		a.interval = *config.Interval
+	}
+	if config.WebhookURL != nil {
+		a.webhook = *config.WebhookURL
+	}
+	if config.Topic != nil {
+		a.topic = protocol.Path(*config.Topic)
+	}
+	return a, nil
+}
+
+// Start begins checking the rules.
+func (a *Alerter) Start() error {
+	resetAlertingMetrics()
+	a.stopC = make(chan struct{})
+	a.wg.Add(1)
+	go a.loop()
+	logger.WithField("rules", len(a.rules)).Info("Alerting started")
+	return nil
+}
+
+// Stop stops checking the rules.
+func (a *Alerter) Stop() error {
+	if a.stopC == nil {
+		return nil
+	}
+	close(a.stopC)
+	a.wg.Wait()
+	a.stopC = nil
+	return nil
+}
+
+func (a *Alerter) loop() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.check()
+		case <-a.stopC:
+			return
+		}
+	}
+}
+
+// check evaluates the rules, and notifies the changes of their state.
+func (a *Alerter) check() {
+	for _, rule := range a.rules {
+		value, ok := metrics.Lookup(rule.Metric)
+		if !ok {
+			logger.WithField("metric", rule.Metric).Debug("Metric of alerting rule not found")
+			continue
+		}
+		key := rule.String()
+		breached := rule.Breached(value)
+		if breached == a.breached[key] {
+			continue
+		}
+		a.breached[key] = breached
+
+		alert := Alert{
+			Rule:      key,
+			Metric:    rule.Metric,
+			Value:     value,
+			Threshold: rule.Threshold,
+			Status:    StatusResolved,
+			Time:      time.Now().Unix(),
+		}
+		if breached {
+			alert.Status = StatusFiring
+			mTotalAlerts.Add(1)
+			logger.WithField("rule", key).WithField("value", value).Warn("Alerting rule breached")
+		} else {
+			mTotalResolved.Add(1)
+			logger.WithField("rule", key).WithField("value", value).Info("Alerting rule resolved")
+		}
+		a.notify(alert)
+	}
+}
+
+func (a *Alerter) notify(alert Alert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		logger.WithError(err).Error("Could not encode alert")
+		return
+	}
+	if a.webhook != "" {
+		if err := a.post(body); err != nil {
+			logger.WithError(err).WithField("rule", alert.Rule).Error("Could not send alert to the webhook")
+			mTotalNotificationErrors.Add(1)
+		}
+	}
+	if a.topic != "" {
+		if err := a.router.HandleMessage(&protocol.Message{
+			Path:   a.topic,
+			UserID: alertUserID,
+			Body:   body,
+		}); err != nil {
+			logger.WithError(err).WithField("rule", alert.Rule).Error("Could not publish alert")
+			mTotalNotificationErrors.Add(1)
+		}
+	}
+}
+
+func (a *Alerter) post(body []byte) error {
+	response, err := a.client.Post(a.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook responded with status code %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package alerting
+
+import (
+	"encoding/json"
+	"expvar"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var testQueued = expvar.NewInt("alerting_test.current_queued")
+
+func TestParseRule(t *testing.T) {
+	a := assert.New(t)
+
+	rule, err := ParseRule("router.delivery_latency_msec.p99 >= 250.5")
+	a.NoError(err)
+	a.Equal(Rule{Metric: "router.delivery_latency_msec.p99", Operator: ">=", Threshold: 250.5}, rule)
+	a.True(rule.Breached(250.5))
+	a.False(rule.Breached(250))
+
+	rule, err = ParseRule("router.current_routes<1")
+	a.NoError(err)
+	a.Equal("<", rule.Operator)
+	a.True(rule.Breached(0))
+
+	for _, invalid := range []string{"", "router.current_routes", "> 1", "router.current_routes > x"} {
+		_, err = ParseRule(invalid)
+		a.Error(err, invalid)
+	}
+}
+
+func TestAlerterNotifiesBreachAndResolution(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	var posted []Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var alert Alert
+		a.NoError(json.Unmarshal(body, &alert))
+		posted = append(posted, alert)
+	}))
+	defer server.Close()
+
+	routerMock := NewMockRouter(ctrl)
+	var published []*protocol.Message
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		published = append(published, m)
+	}).Return(nil).Times(2)
+
+	rules := []string{"alerting_test.current_queued > 10", "alerting_test.missing > 1"}
+	webhook := server.URL
+	topic := DefaultTopic
+	alerter, err := New(routerMock, Config{Rules: &rules, WebhookURL: &webhook, Topic: &topic})
+	a.NoError(err)
+
+	testQueued.Set(5)
+	alerter.check()
+	a.Empty(posted)
+
+	testQueued.Set(11)
+	alerter.check()
+	alerter.check()
+	testQueued.Set(3)
+	alerter.check()
+
+	a.Len(posted, 2)
+	a.Equal(StatusFiring, posted[0].Status)
+	a.Equal(float64(11), posted[0].Value)
+	a.Equal("alerting_test.current_queued", posted[0].Metric)
+	a.Equal(StatusResolved, posted[1].Status)
+
+	a.Len(published, 2)
+	a.Equal(protocol.Path(DefaultTopic), published[0].Path)
+}
+
+func TestNewWithInvalidRule(t *testing.T) {
+	rules := []string{"router.current_routes ~ 1"}
+	_, err := New(nil, Config{Rules: &rules})
+	assert.Error(t, err)
+}
@@ -0,0 +1,18 @@
+package alerting
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                       = metrics.NS("alerting")
+	mTotalAlerts             = ns.NewInt("total_alerts")
+	mTotalResolved           = ns.NewInt("total_resolved")
+	mTotalNotificationErrors = ns.NewInt("total_notification_errors")
+)
+
+func resetAlertingMetrics() {
+	mTotalAlerts.Set(0)
+	mTotalResolved.Set(0)
+	mTotalNotificationErrors.Set(0)
+}
@@ -0,0 +1,7 @@
+package alerting
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "alerting")
@@ -0,0 +1,53 @@
+package alerting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// operators are the comparisons of a rule, the longest ones first for parsing.
+var operators = []string{">=", "<=", ">", "<"}
+
+// Rule is a threshold on a metric, e.g. "router.current_queued_messages > 1000".
+type Rule struct {
+	Metric    string
+	Operator  string
+	Threshold float64
+}
+
+// ParseRule parses a rule in the format "<metric> <operator> <threshold>", the operator being one of: > >= < <=.
+func ParseRule(s string) (Rule, error) {
+	for _, op := range operators {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+		metric := strings.TrimSpace(s[:i])
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(s[i+len(op):]), 64)
+		if metric == "" || err != nil {
+			break
+		}
+		return Rule{Metric: metric, Operator: op, Threshold: threshold}, nil
+	}
+	return Rule{}, fmt.Errorf("Invalid alerting rule %q (format: <metric> <operator> <threshold>)", s)
+}
+
+// Breached returns true if the value of the metric breaches the threshold.
+func (r Rule) Breached(value float64) bool {
+	switch r.Operator {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	}
+	return false
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s %s %v", r.Metric, r.Operator, r.Threshold)
+}
@@ -0,0 +1,331 @@
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/jpillora/backoff"
+	amqplib "github.com/streadway/amqp"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// bridgeID marks the messages crossing the bridge, in both directions,
+	// so that they are never sent back to where they came from.
+	bridgeID = "guble-amqp-bridge"
+
+	defaultChannelSize = 1000
+
+	headerMessageID = "guble-message-id"
+	headerPath      = "guble-path"
+	headerUserID    = "guble-user-id"
+)
+
+var (
+	ErrNotConnected = errors.New("AMQP bridge is not connected")
+)
+
+// Config is used for configuring the AMQP bridge.
+type Config struct {
+	Enabled      *bool
+	URL          *string
+	Exchange     *string
+	ExchangeType *string
+
+	// Topics are the guble topics which are published to the exchange.
+	Topics *[]string
+
+	// Queue is consumed and its messages are published in guble (an empty Queue disables this direction).
+	Queue      *string
+	BindingKey *string
+
+	// TopicPrefix is prepended to the path of the messages coming from the Queue.
+	TopicPrefix *string
+}
+
+type bridge struct {
+	config Config
+	router router.Router
+	dial   Dialer
+
+	mu      sync.RWMutex
+	channel Channel
+
+	routes []*router.Route
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+
+	logger *log.Entry
+}
+
+// New returns a bridge between the guble router and the AMQP broker reached through the dialer.
+func New(router router.Router, dial Dialer, config Config) (*bridge, error) {
+	return &bridge{
+		config: config,
+		router: router,
+		dial:   dial,
+		logger: logger.WithField("exchange", *config.Exchange),
+	}, nil
+}
+
+func (b *bridge) Start() error {
+	b.logger.Debug("Starting AMQP bridge")
+	resetAMQPMetrics()
+
+	ch, err := b.dial(b.config)
+	if err != nil {
+		b.logger.WithField("error", err.Error()).Error("Could not connect to AMQP broker")
+		return err
+	}
+	b.setChannel(ch)
+
+	b.ctx, b.cancelFunc = context.WithCancel(context.Background())
+	b.routes = nil
+
+	for _, topic := range *b.config.Topics {
+		route := router.NewRoute(router.RouteConfig{
+			Path:        protocol.Path(topic),
+			ChannelSize: defaultChannelSize,
+		})
+		if _, err := b.router.Subscribe(route); err != nil {
+			b.cancelFunc()
+			return err
+		}
+		b.routes = append(b.routes, route)
+		b.wg.Add(1)
+		go b.forward(route)
+	}
+
+	if *b.config.Queue != "" {
+		b.wg.Add(1)
+		go b.consume()
+	}
+
+	b.logger.Debug("Started AMQP bridge")
+	return nil
+}
+
+func (b *bridge) Stop() error {
+	b.logger.Debug("Stopping AMQP bridge")
+	if b.cancelFunc != nil {
+		// the bridge is stopped after a failed start as well
+		b.cancelFunc()
+	}
+	for _, route := range b.routes {
+		b.router.Unsubscribe(route)
+	}
+
+	var err error
+	if ch := b.setChannel(nil); ch != nil {
+		err = ch.Close()
+	}
+	b.wg.Wait()
+	b.logger.Debug("Stopped AMQP bridge")
+	return err
+}
+
+// forward publishes to the exchange the messages received by a guble route.
+func (b *bridge) forward(route *router.Route) {
+	defer b.wg.Done()
+	err := router.Forward(b.ctx, b.router, route, func(m *protocol.Message) {
+		if m.UserID == bridgeID {
+			return
+		}
+		if err := b.publish(m); err != nil {
+			b.logger.WithFields(log.Fields{
+				"error":   err.Error(),
+				"message": m.ID,
+			}).Error("Could not publish message to AMQP")
+			mTotalPublishErrors.Add(1)
+			return
+		}
+		mTotalPublishedMessages.Add(1)
+	})
+	if err != nil {
+		b.logger.WithField("error", err.Error()).Error("Could not subscribe again")
+	}
+}
+
+func (b *bridge) publish(m *protocol.Message) error {
+	ch := b.getChannel()
+	if ch == nil {
+		return ErrNotConnected
+	}
+
+	headers := amqplib.Table{}
+	if m.HeaderJSON != "" {
+		var h map[string]interface{}
+		if err := json.Unmarshal([]byte(m.HeaderJSON), &h); err == nil {
+			for k, v := range h {
+				if s, ok := v.(string); ok {
+					headers[k] = s
+				}
+			}
+		}
+	}
+	headers[headerMessageID] = int64(m.ID)
+	headers[headerPath] = string(m.Path)
+	headers[headerUserID] = m.UserID
+
+	publishing := amqplib.Publishing{
+		Headers:      headers,
+		AppId:        bridgeID,
+		DeliveryMode: amqplib.Persistent,
+		Timestamp:    time.Unix(m.Time, 0),
+		Body:         m.Body,
+	}
+	key := routingKey(m.Path)
+
+	err := ch.Publish(*b.config.Exchange, key, false, false, publishing)
+	if err != nil {
+		// the channel may have been closed by the broker: reconnect and try once more
+		if ch, err = b.reconnect(ch); err != nil {
+			return err
+		}
+		err = ch.Publish(*b.config.Exchange, key, false, false, publishing)
+	}
+	return err
+}
+
+// consume publishes in guble the messages from the configured queue, reconnecting when needed.
+func (b *bridge) consume() {
+	defer b.wg.Done()
+	bo := &backoff.Backoff{Min: 100 * time.Millisecond, Max: 30 * time.Second, Factor: 2}
+
+	for {
+		ch := b.getChannel()
+		if ch != nil {
+			deliveries, err := ch.Consume(*b.config.Queue, bridgeID, false, false, false, false, nil)
+			if err != nil {
+				b.logger.WithField("error", err.Error()).Error("Could not consume from AMQP queue")
+			} else {
+				bo.Reset()
+				b.receiveLoop(deliveries)
+			}
+		}
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-time.After(bo.Duration()):
+		case <-b.ctx.Done():
+			return
+		}
+		if _, err := b.reconnect(ch); err != nil {
+			b.logger.WithField("error", err.Error()).Error("Could not reconnect to AMQP broker")
+		}
+	}
+}
+
+func (b *bridge) receiveLoop(deliveries <-chan amqplib.Delivery) {
+	for {
+		select {
+		case d, opened := <-deliveries:
+			if !opened {
+				b.logger.Info("AMQP deliveries channel closed")
+				return
+			}
+			b.receive(d)
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *bridge) receive(d amqplib.Delivery) {
+	if d.AppId == bridgeID {
+		d.Ack(false)
+		return
+	}
+
+	var headerJSON string
+	headers := make(map[string]string)
+	for k, v := range d.Headers {
+		if s, ok := v.(string); ok {
+			headers[k] = s
+		}
+	}
+	if len(headers) > 0 {
+		if data, err := json.Marshal(headers); err == nil {
+			headerJSON = string(data)
+		}
+	}
+
+	m := &protocol.Message{
+		Path:          topicPath(*b.config.TopicPrefix, d.RoutingKey),
+		UserID:        bridgeID,
+		ApplicationID: d.AppId,
+		HeaderJSON:    headerJSON,
+		Body:          d.Body,
+	}
+	if err := b.router.HandleMessage(m); err != nil {
+		b.logger.WithFields(log.Fields{
+			"error":      err.Error(),
+			"routingKey": d.RoutingKey,
+		}).Error("Could not handle message from AMQP")
+		mTotalReceiveErrors.Add(1)
+		d.Nack(false, false)
+		return
+	}
+	mTotalReceivedMessages.Add(1)
+	d.Ack(false)
+}
+
+// reconnect replaces the old channel with a new one, unless this has already been done concurrently.
+func (b *bridge) reconnect(old Channel) (Channel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ctx.Err() != nil {
+		return nil, ErrNotConnected
+	}
+	if b.channel != old && b.channel != nil {
+		return b.channel, nil
+	}
+	if old != nil {
+		old.Close()
+	}
+	b.channel = nil
+
+	mTotalReconnects.Add(1)
+	ch, err := b.dial(b.config)
+	if err != nil {
+		return nil, err
+	}
+	b.channel = ch
+	return ch, nil
+}
+
+func (b *bridge) getChannel() Channel {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.channel
+}
+
+// setChannel replaces the current channel, returning the previous one.
+func (b *bridge) setChannel(ch Channel) Channel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := b.channel
+	b.channel = ch
+	return old
+}
+
+// routingKey converts a guble path to an AMQP routing key: /foo/bar becomes foo.bar
+func routingKey(p protocol.Path) string {
+	return strings.Replace(p.RemovePrefixSlash(), "/", ".", -1)
+}
+
+// topicPath converts an AMQP routing key to a guble path (under the given prefix): foo.bar becomes /prefix/foo/bar
+func topicPath(prefix, key string) protocol.Path {
+	return protocol.Path(strings.TrimRight(prefix, "/") + "/" + strings.Replace(key, ".", "/", -1))
+}
@@ -0,0 +1,22 @@
+package amqp
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                      = metrics.NS("amqp")
+	mTotalPublishedMessages = ns.NewInt("total_published_messages")
+	mTotalPublishErrors     = ns.NewInt("total_publish_errors")
+	mTotalReceivedMessages  = ns.NewInt("total_received_messages")
+	mTotalReceiveErrors     = ns.NewInt("total_receive_errors")
+	mTotalReconnects        = ns.NewInt("total_reconnects")
+)
+
+func resetAMQPMetrics() {
+	mTotalPublishedMessages.Set(0)
+	mTotalPublishErrors.Set(0)
+	mTotalReceivedMessages.Set(0)
+	mTotalReceiveErrors.Set(0)
+	mTotalReconnects.Set(0)
+}
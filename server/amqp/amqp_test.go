@@ -0,0 +1,253 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	amqplib "github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+type published struct {
+	key        string
+	publishing amqplib.Publishing
+}
+
+type fakeChannel struct {
+	publishedC  chan published
+	deliveriesC chan amqplib.Delivery
+	publishErr  error
+
+	mu     sync.Mutex
+	closed bool
+	acks   []uint64
+	nacks  []uint64
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{
+		publishedC:  make(chan published, 10),
+		deliveriesC: make(chan amqplib.Delivery, 10),
+	}
+}
+
+func (c *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqplib.Publishing) error {
+	if c.publishErr != nil {
+		return c.publishErr
+	}
+	c.publishedC <- published{key, msg}
+	return nil
+}
+
+func (c *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqplib.Table) (<-chan amqplib.Delivery, error) {
+	return c.deliveriesC, nil
+}
+
+func (c *fakeChannel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeChannel) Ack(tag uint64, multiple bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.acks = append(c.acks, tag)
+	return nil
+}
+
+func (c *fakeChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nacks = append(c.nacks, tag)
+	return nil
+}
+
+func (c *fakeChannel) Reject(tag uint64, requeue bool) error {
+	return c.Nack(tag, false, requeue)
+}
+
+func (c *fakeChannel) acked() ([]uint64, []uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.acks, c.nacks
+}
+
+func testConfig(topics []string, queue string) Config {
+	enabled := true
+	url := "amqp://localhost"
+	exchange := "guble"
+	exchangeType := "topic"
+	bindingKey := "#"
+	prefix := "/amqp"
+	return Config{
+		Enabled:      &enabled,
+		URL:          &url,
+		Exchange:     &exchange,
+		ExchangeType: &exchangeType,
+		Topics:       &topics,
+		Queue:        &queue,
+		BindingKey:   &bindingKey,
+		TopicPrefix:  &prefix,
+	}
+}
+
+func TestRoutingKeyAndTopicPath(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("foo.bar", routingKey(protocol.Path("/foo/bar")))
+	a.Equal("foo", routingKey(protocol.Path("/foo")))
+	a.Equal(protocol.Path("/amqp/foo/bar"), topicPath("/amqp", "foo.bar"))
+	a.Equal(protocol.Path("/amqp/foo"), topicPath("/amqp/", "foo"))
+	a.Equal(protocol.Path("/foo"), topicPath("", "foo"))
+}
+
+func TestBridge_StartFailsWhenDialFails(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	dialErr := errors.New("connection refused")
+
+	b, err := New(routerMock, func(Config) (Channel, error) { return nil, dialErr }, testConfig([]string{"/foo"}, ""))
+	a.NoError(err)
+	a.Equal(dialErr, b.Start())
+
+	// the service is stopped after its failed start
+	a.NoError(b.Stop())
+}
+
+func TestBridge_PublishesGubleMessages(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	ch := newFakeChannel()
+	routerMock := NewMockRouter(testutil.MockCtrl)
+
+	var route *router.Route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo"), r.Path)
+		route = r
+	}).Return(nil, nil)
+
+	b, err := New(routerMock, func(Config) (Channel, error) { return ch, nil }, testConfig([]string{"/foo"}, ""))
+	a.NoError(err)
+	a.NoError(b.Start())
+
+	a.NoError(route.Deliver(&protocol.Message{
+		ID:         42,
+		Path:       "/foo/bar",
+		UserID:     "user01",
+		HeaderJSON: `{"Correlation-Id":"abc"}`,
+		Body:       []byte("hello"),
+	}, false))
+	// messages coming from the bridge itself are not published back
+	a.NoError(route.Deliver(&protocol.Message{ID: 43, Path: "/foo/bar", UserID: bridgeID}, false))
+
+	select {
+	case p := <-ch.publishedC:
+		a.Equal("foo.bar", p.key)
+		a.Equal(bridgeID, p.publishing.AppId)
+		a.Equal([]byte("hello"), p.publishing.Body)
+		a.Equal(int64(42), p.publishing.Headers[headerMessageID])
+		a.Equal("user01", p.publishing.Headers[headerUserID])
+		a.Equal("abc", p.publishing.Headers["Correlation-Id"])
+	case <-time.After(time.Second):
+		a.Fail("message was not published")
+	}
+
+	routerMock.EXPECT().Unsubscribe(route)
+	a.NoError(b.Stop())
+	a.True(ch.closed)
+	a.Len(ch.publishedC, 0)
+
+	// a restarted bridge has only its new routes
+	routerMock.EXPECT().Subscribe(gomock.Any()).Return(nil, nil)
+	a.NoError(b.Start())
+	a.Len(b.routes, 1)
+	routerMock.EXPECT().Unsubscribe(gomock.Any())
+	a.NoError(b.Stop())
+}
+
+func TestBridge_ReceivesAMQPMessages(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	ch := newFakeChannel()
+	routerMock := NewMockRouter(testutil.MockCtrl)
+
+	b, err := New(routerMock, func(Config) (Channel, error) { return ch, nil }, testConfig(nil, "guble-queue"))
+	a.NoError(err)
+
+	done := make(chan bool)
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/amqp/foo/bar"), m.Path)
+		a.Equal(bridgeID, m.UserID)
+		a.Equal("other-app", m.ApplicationID)
+		a.JSONEq(`{"Correlation-Id":"abc"}`, m.HeaderJSON)
+		a.Equal([]byte("hello"), m.Body)
+		done <- true
+	}).Return(nil)
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		done <- true
+	}).Return(errors.New("not allowed"))
+
+	a.NoError(b.Start())
+
+	// published by the bridge itself: only acknowledged
+	ch.deliveriesC <- amqplib.Delivery{Acknowledger: ch, DeliveryTag: 1, AppId: bridgeID, RoutingKey: "foo"}
+	ch.deliveriesC <- amqplib.Delivery{
+		Acknowledger: ch,
+		DeliveryTag:  2,
+		AppId:        "other-app",
+		RoutingKey:   "foo.bar",
+		Headers:      amqplib.Table{"Correlation-Id": "abc", "retries": int32(1)},
+		Body:         []byte("hello"),
+	}
+	ch.deliveriesC <- amqplib.Delivery{Acknowledger: ch, DeliveryTag: 3, RoutingKey: "foo"}
+	testutil.ExpectDone(a, done)
+	testutil.ExpectDone(a, done)
+
+	time.Sleep(50 * time.Millisecond)
+	acks, nacks := ch.acked()
+	a.Equal([]uint64{1, 2}, acks)
+	a.Equal([]uint64{3}, nacks)
+
+	a.NoError(b.Stop())
+}
+
+func TestBridge_ReconnectsWhenPublishFails(t *testing.T) {
+	a := assert.New(t)
+
+	failing := newFakeChannel()
+	failing.publishErr = errors.New("channel closed")
+	working := newFakeChannel()
+
+	dials := 0
+	b, err := New(nil, func(Config) (Channel, error) {
+		dials++
+		return working, nil
+	}, testConfig(nil, ""))
+	a.NoError(err)
+	b.ctx, b.cancelFunc = context.WithCancel(context.Background())
+	defer b.cancelFunc()
+	b.setChannel(failing)
+
+	a.NoError(b.publish(&protocol.Message{ID: 1, Path: "/foo"}))
+	a.Equal(1, dials)
+	a.True(failing.closed)
+	a.Equal(working, b.getChannel())
+	a.Len(working.publishedC, 1)
+}
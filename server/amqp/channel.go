@@ -0,0 +1,58 @@
+package amqp
+
+import (
+	amqplib "github.com/streadway/amqp"
+)
+
+// Channel is the subset of an AMQP channel used by the bridge.
+type Channel interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqplib.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqplib.Table) (<-chan amqplib.Delivery, error)
+	Close() error
+}
+
+// Dialer opens a Channel to the broker, declaring the exchange / queue topology given in the Config.
+type Dialer func(Config) (Channel, error)
+
+type channel struct {
+	*amqplib.Channel
+	conn *amqplib.Connection
+}
+
+// Dial is the default Dialer: it connects to the broker at config.URL,
+// declares the (durable) exchange and, if configured, the queue bound to it.
+func Dial(config Config) (Channel, error) {
+	conn, err := amqplib.Dial(*config.URL)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := &channel{Channel: ch, conn: conn}
+
+	if err := ch.ExchangeDeclare(*config.Exchange, *config.ExchangeType, true, false, false, false, nil); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if *config.Queue == "" {
+		return c, nil
+	}
+	if _, err := ch.QueueDeclare(*config.Queue, true, false, false, false, nil); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := ch.QueueBind(*config.Queue, *config.BindingKey, *config.Exchange, false, nil); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes both the channel and the underlying connection.
+func (c *channel) Close() error {
+	c.Channel.Close()
+	return c.conn.Close()
+}
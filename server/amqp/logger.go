@@ -0,0 +1,7 @@
+package amqp
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "amqp")
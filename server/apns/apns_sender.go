@@ -2,11 +2,10 @@ package apns
 
 import (
 	"errors"
-	"github.com/jpillora/backoff"
 	"github.com/sideshow/apns2"
+	"github.com/smancke/guble/protocol"
 	"github.com/smancke/guble/server/connector"
 	"net"
-	"time"
 )
 
 const (
@@ -17,7 +16,6 @@ const (
 
 var (
 	errPusherInvalidParams = errors.New("Invalid parameters of APNS Pusher")
-	ErrRetryFailed         = errors.New("Retry failed")
 )
 
 type sender struct {
@@ -47,30 +45,23 @@ func NewSenderUsingPusher(pusher Pusher, appTopic string) (connector.Sender, err
 func (s sender) Send(request connector.Request) (interface{}, error) {
 	deviceToken := request.Subscriber().Route().Get(deviceIDKey)
 	logger.WithField("deviceToken", deviceToken).Info("Trying to push a message to APNS")
-	push := func() (interface{}, error) {
-		return s.client.Push(&apns2.Notification{
-			Priority:    apns2.PriorityHigh,
-			Topic:       s.appTopic,
-			DeviceToken: deviceToken,
-			Payload:     request.Message().Body,
-		})
+	priority := apns2.PriorityHigh
+	if request.Message().Priority == protocol.PriorityLow {
+		priority = apns2.PriorityLow
 	}
-	withRetry := &retryable{
-		Backoff: backoff.Backoff{
-			Min:    1 * time.Second,
-			Max:    10 * time.Second,
-			Factor: 2,
-			Jitter: true,
-		},
-		maxTries: 3,
-	}
-	result, err := withRetry.execute(push)
-	if err != nil && err == ErrRetryFailed {
+	result, err := s.client.Push(&apns2.Notification{
+		Priority:    priority,
+		Topic:       s.appTopic,
+		DeviceToken: deviceToken,
+		Payload:     request.Message().Body,
+	})
+	if _, ok := err.(net.Error); ok {
+		// the request is retried by the connector (see connector.RetryConfig), on a new TLS connection
+		mTotalSendNetworkErrors.Add(1)
 		if closable, ok := s.client.(closable); ok {
-			logger.Warn("Close TLS and retry again")
+			logger.WithField("error", err.Error()).Warn("Close TLS after a network error")
 			mTotalSendRetryCloseTLS.Add(1)
 			closable.CloseTLS()
-			return push()
 		} else {
 			mTotalSendRetryUnrecoverable.Add(1)
 			logger.Error("Cannot Close TLS. Unrecoverable state")
@@ -78,29 +69,3 @@ func (s sender) Send(request connector.Request) (interface{}, error) {
 	}
 	return result, err
 }
-
-type retryable struct {
-	backoff.Backoff
-	maxTries int
-}
-
-func (r *retryable) execute(op func() (interface{}, error)) (interface{}, error) {
-	tryCounter := 0
-	for {
-		tryCounter++
-		result, opError := op()
-		// retry on network errors
-		if _, ok := opError.(net.Error); ok {
-			mTotalSendNetworkErrors.Add(1)
-			if tryCounter >= r.maxTries {
-				return "", ErrRetryFailed
-			}
-			d := r.Duration()
-			logger.WithField("error", opError.Error()).Warn("Retry in ", d)
-			time.Sleep(d)
-			continue
-		} else {
-			return result, opError
-		}
-	}
-}
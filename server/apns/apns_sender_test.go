@@ -1,8 +1,8 @@
 package apns
 
 import (
-	"errors"
 	"github.com/golang/mock/gomock"
+	"github.com/sideshow/apns2"
 	"github.com/smancke/guble/protocol"
 	"github.com/smancke/guble/server/router"
 	"github.com/smancke/guble/testutil"
@@ -63,7 +63,8 @@ func TestSender_Send(t *testing.T) {
 	route := router.NewRoute(routeConfig)
 
 	msg := &protocol.Message{
-		Body: []byte("{}"),
+		Body:     []byte("{}"),
+		Priority: protocol.PriorityLow,
 	}
 
 	mSubscriber := NewMockSubscriber(testutil.MockCtrl)
@@ -74,7 +75,10 @@ func TestSender_Send(t *testing.T) {
 	mRequest.EXPECT().Message().Return(msg).AnyTimes()
 
 	mPusher := NewMockPusher(testutil.MockCtrl)
-	mPusher.EXPECT().Push(gomock.Any()).Return(nil, nil)
+	mPusher.EXPECT().Push(gomock.Any()).Do(func(n *apns2.Notification) {
+		// the low priority of the message is kept
+		a.Equal(apns2.PriorityLow, n.Priority)
+	}).Return(nil, nil)
 
 	// and
 	s, err := NewSenderUsingPusher(mPusher, "com.myapp")
@@ -122,62 +126,15 @@ func TestSender_Retry(t *testing.T) {
 	s, err := NewSenderUsingPusher(mPusher, "com.myapp")
 	a.NoError(err)
 
-	// when
-	rsp, err := s.Send(mRequest)
+	// when the first push fails with a network error
+	_, err = s.Send(mRequest)
 
-	// then
+	// then the error is returned, for the connector to retry the request
+	a.Equal(errMockTimeout, err)
+
+	rsp, err := s.Send(mRequest)
 	a.NoError(err)
 	a.Nil(rsp)
-
-}
-
-type resultpair struct {
-	result interface{}
-	err    error
-}
-
-func Test_Retriable(t *testing.T) {
-	a := assert.New(t)
-
-	testCases := []struct {
-		name                string
-		maxTries            int
-		results             []resultpair
-		expectedResult      string
-		expectedError       error
-		expectedMethodCalls int
-	}{
-		{"No errors", 3, []resultpair{{result: "0"}}, "0", nil, 1},
-		{"Retry once", 3, []resultpair{{err: errMockTimeout}, {result: "1"}}, "1", nil, 2},
-		{"Retry twice", 3, []resultpair{{err: errMockTimeout}, {err: errMockTimeout}, {result: "2"}}, "2", nil, 3},
-		{"Retry only twice", 3, []resultpair{{err: errMockTimeout}, {err: errMockTimeout}, {err: errMockTimeout, result: ""}, {result: "3"}}, "", ErrRetryFailed, 3},
-		{"Do not retry", 3, []resultpair{{err: errMockOther, result: ""}, {result: "1"}}, "", errMockOther, 1},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-
-			// given
-			var counter int
-			method := func() (interface{}, error) {
-				elem := tc.results[counter]
-				counter++
-				return elem.result, elem.err
-			}
-
-			withRetry := &retryable{
-				maxTries: tc.maxTries,
-			}
-
-			// when
-			result, err := withRetry.execute(method)
-
-			// then
-			a.EqualValues(tc.expectedResult, result)
-			a.EqualValues(tc.expectedError, err)
-			a.EqualValues(tc.expectedMethodCalls, counter)
-		})
-	}
 }
 
 // see - net.Error
@@ -188,4 +145,3 @@ func (e *mockTimeout) Timeout() bool   { return true }
 func (e *mockTimeout) Temporary() bool { return true }
 
 var errMockTimeout error = &mockTimeout{}
-var errMockOther error = errors.New("mock not retriable")
@@ -0,0 +1,228 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/auth"
+)
+
+const (
+	// DefaultPrefix is the prefix of the endpoint exporting the audit log
+	DefaultPrefix = "/admin/audit"
+
+	// Subscribe is the event of a new subscription to a topic
+	Subscribe = "subscribe"
+	// Unsubscribe is the event of a subscription which was removed
+	Unsubscribe = "unsubscribe"
+	// AuthFailure is the event of an access to a topic denied to a user
+	AuthFailure = "auth_failure"
+	// AdminCall is the event of a call of an admin endpoint
+	AdminCall = "admin_call"
+)
+
+var ErrNoPath = errors.New("The path of the audit log is missing")
+
+// Config is used for configuring the audit log.
+type Config struct {
+	Path     *string
+	Endpoint *string
+}
+
+// Event is an entry of the audit log, written as a line of JSON.
+type Event struct {
+	Time       time.Time     `json:"time"`
+	Type       string        `json:"type"`
+	UserID     string        `json:"userID,omitempty"`
+	Topic      protocol.Path `json:"topic,omitempty"`
+	Access     string        `json:"access,omitempty"`
+	RemoteAddr string        `json:"remoteAddr,omitempty"`
+	Method     string        `json:"method,omitempty"`
+	URL        string        `json:"url,omitempty"`
+}
+
+// Log appends the security-relevant events to a file, one JSON object per line, and exports them on its endpoint.
+type Log struct {
+	path   string
+	prefix string
+
+	file  *os.File
+	mutex sync.Mutex
+}
+
+var (
+	current      *Log
+	currentMutex sync.RWMutex
+)
+
+// New returns a new audit Log, which has to be started for recording the events.
+func New(config Config) *Log {
+	l := &Log{prefix: DefaultPrefix}
+	if config.Path != nil {
+		l.path = *config.Path
+	}
+	if config.Endpoint != nil {
+		l.prefix = *config.Endpoint
+	}
+	return l
+}
+
+// Start opens the file of the audit log for appending, and makes the log the one used by Record.
+func (l *Log) Start() error {
+	if l.path == "" {
+		return ErrNoPath
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	resetAuditMetrics()
+
+	l.mutex.Lock()
+	l.file = file
+	l.mutex.Unlock()
+
+	currentMutex.Lock()
+	current = l
+	currentMutex.Unlock()
+	logger.WithField("path", l.path).Info("Audit log started")
+	return nil
+}
+
+// Stop stops recording the events, and closes the file.
+func (l *Log) Stop() error {
+	currentMutex.Lock()
+	if current == l {
+		current = nil
+	}
+	currentMutex.Unlock()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Record appends the event to the current audit log, if any.
+func Record(e Event) {
+	currentMutex.RLock()
+	l := current
+	currentMutex.RUnlock()
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.write(e)
+}
+
+// RecordAuthFailure records an access to a topic denied to a user.
+func RecordAuthFailure(accessType auth.AccessType, userID string, path protocol.Path) {
+	access := "read"
+	if accessType == auth.WRITE {
+		access = "write"
+	}
+	Record(Event{Type: AuthFailure, UserID: userID, Topic: path, Access: access})
+}
+
+// RecordRequest records the call of an admin endpoint.
+func RecordRequest(req *http.Request) {
+	Record(Event{
+		Type:       AdminCall,
+		RemoteAddr: req.RemoteAddr,
+		Method:     req.Method,
+		URL:        req.URL.String(),
+	})
+}
+
+// Handler wraps the handler of an admin endpoint, recording its calls.
+func Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		RecordRequest(req)
+		handler.ServeHTTP(w, req)
+	})
+}
+
+func (l *Log) write(e Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		logger.WithError(err).Error("Could not encode audit event")
+		return
+	}
+	data = append(data, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return
+	}
+	if _, err := l.file.Write(data); err != nil {
+		logger.WithError(err).Error("Could not write audit event")
+		mTotalWriteErrors.Add(1)
+		return
+	}
+	mTotalEvents.Add(1)
+}
+
+// GetPrefix returns the prefix of the endpoint exporting the audit log.
+func (l *Log) GetPrefix() string {
+	return l.prefix
+}
+
+// ServeHTTP exports the audit log as JSON lines, optionally filtered by the `type` of the events
+// and by `since` (a unix timestamp).
+func (l *Log) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, `{"error":"only HTTP GET is accepted"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	RecordRequest(req)
+
+	var since time.Time
+	if s := req.URL.Query().Get("since"); s != "" {
+		unix, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, `{"error":"invalid since"}`, http.StatusBadRequest)
+			return
+		}
+		since = time.Unix(unix, 0)
+	}
+	eventType := req.URL.Query().Get("type")
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		logger.WithError(err).Error("Could not open the audit log")
+		http.Error(w, `{"error":"audit log not available"}`, http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if (eventType != "" && e.Type != eventType) || e.Time.Before(since) {
+			continue
+		}
+		w.Write(scanner.Bytes())
+		w.Write([]byte{'\n'})
+	}
+	if err := scanner.Err(); err != nil {
+		logger.WithError(err).Error("Error reading the audit log")
+	}
+}
@@ -0,0 +1,16 @@
+package audit
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                = metrics.NS("audit")
+	mTotalEvents      = ns.NewInt("total_events")
+	mTotalWriteErrors = ns.NewInt("total_write_errors")
+)
+
+func resetAuditMetrics() {
+	mTotalEvents.Set(0)
+	mTotalWriteErrors.Set(0)
+}
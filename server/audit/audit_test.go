@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/smancke/guble/server/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndExport(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guble_audit_test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	l := New(Config{Path: &path})
+
+	// nothing is recorded before the log is started
+	Record(Event{Type: Subscribe, UserID: "before", Topic: "/foo"})
+
+	a.NoError(l.Start())
+	Record(Event{Type: Subscribe, UserID: "user01", Topic: "/foo"})
+	RecordAuthFailure(auth.WRITE, "user02", "/bar")
+	Handler(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/admin/drain", nil))
+	a.NoError(l.Stop())
+
+	// nothing is recorded after the log is stopped
+	Record(Event{Type: Unsubscribe, UserID: "after", Topic: "/foo"})
+
+	events := readEvents(t, path)
+	a.Len(events, 3)
+	a.Equal(Subscribe, events[0].Type)
+	a.Equal("user01", events[0].UserID)
+	a.False(events[0].Time.IsZero())
+	a.Equal(AuthFailure, events[1].Type)
+	a.Equal("write", events[1].Access)
+	a.Equal(AdminCall, events[2].Type)
+	a.Equal(http.MethodPost, events[2].Method)
+	a.Equal("/admin/drain", events[2].URL)
+
+	// the log is appended after a restart, and exported filtered by type
+	a.NoError(l.Start())
+	defer l.Stop()
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/audit?type=auth_failure", nil))
+	a.Equal(http.StatusOK, rec.Code)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	a.Len(lines, 1)
+	a.Contains(lines[0], "user02")
+
+	// the export itself is recorded
+	a.Len(readEvents(t, path), 4)
+
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/audit?since=x", nil))
+	a.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestStartWithoutPath(t *testing.T) {
+	assert.Equal(t, ErrNoPath, New(Config{}).Start())
+}
+
+func readEvents(t *testing.T, path string) []Event {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	return events
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+)
+
+const (
+	// DefaultACLInterval is the interval of reloading the rules and the roles from the KV store
+	DefaultACLInterval = 30 * time.Second
+
+	// ACLSchema is the schema of the rules in the KV store: any key, with a rule as value
+	ACLSchema = "acl"
+
+	// ACLRolesSchema is the schema of the roles in the KV store: the user ID as key, with its roles as value
+	ACLRolesSchema = "acl_roles"
+
+	subjectAll  = "*"
+	subjectUser = "user:"
+	subjectRole = "role:"
+	subjectKey  = "key:"
+
+	accessPublish   = "publish"
+	accessSubscribe = "subscribe"
+)
+
+// ACLStore is the persistence of the rules and of the roles, implemented by a kvstore.KVStore.
+type ACLStore interface {
+	Iterate(schema, keyPrefix string) (entries chan [2]string)
+}
+
+// ACLConfig is used for configuring the access-control lists of the topics.
+type ACLConfig struct {
+	Enabled  *bool
+	Rules    *[]string
+	Roles    *[]string
+	Interval *time.Duration
+}
+
+// ACLRule allows a subject to publish to and/or to subscribe to the topics matching a pattern.
+type ACLRule struct {
+	// Subject is "user:<user ID>", "role:<role>", "key:<API key>" or "*" (everybody)
+	Subject   string
+	Publish   bool
+	Subscribe bool
+	// Pattern is matched as a path.Match pattern (e.g. "/team-a/*"); a trailing "/**" matches all the levels below
+	Pattern string
+}
+
+// ParseACLRule parses a rule in the format "<subject> <publish|subscribe|publish,subscribe> <pattern>",
+// e.g. "role:team-a publish,subscribe /team-a/**".
+func ParseACLRule(s string) (ACLRule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return ACLRule{}, fmt.Errorf("Invalid ACL rule %q: expected <subject> <access> <pattern>", s)
+	}
+	rule := ACLRule{Subject: fields[0], Pattern: fields[2]}
+	if rule.Subject != subjectAll &&
+		!strings.HasPrefix(rule.Subject, subjectUser) &&
+		!strings.HasPrefix(rule.Subject, subjectRole) &&
+		!strings.HasPrefix(rule.Subject, subjectKey) {
+		return ACLRule{}, fmt.Errorf("Invalid subject of the ACL rule %q", s)
+	}
+	for _, access := range strings.Split(fields[1], ",") {
+		switch access {
+		case accessPublish:
+			rule.Publish = true
+		case accessSubscribe:
+			rule.Subscribe = true
+		default:
+			return ACLRule{}, fmt.Errorf("Invalid access of the ACL rule %q", s)
+		}
+	}
+	if !strings.HasPrefix(rule.Pattern, "/") {
+		return ACLRule{}, fmt.Errorf("Invalid pattern of the ACL rule %q", s)
+	}
+	if _, err := path.Match(strings.TrimSuffix(rule.Pattern, "/**"), "/"); err != nil {
+		return ACLRule{}, fmt.Errorf("Invalid pattern of the ACL rule %q: %v", s, err)
+	}
+	return rule, nil
+}
+
+// parseACLRoles parses the roles of a user in the format "<user ID>=<role>[,<role>...]".
+func parseACLRoles(s string) (string, []string, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil, fmt.Errorf("Invalid ACL roles %q: expected <user ID>=<role>[,<role>...]", s)
+	}
+	return parts[0], strings.Split(parts[1], ","), nil
+}
+
+// matches returns true if the rule allows the access to the path.
+func (rule ACLRule) matches(accessType AccessType, p protocol.Path) bool {
+	if accessType == READ && !rule.Subscribe || accessType == WRITE && !rule.Publish {
+		return false
+	}
+	topic := string(p)
+	if prefix := strings.TrimSuffix(rule.Pattern, "/**"); prefix != rule.Pattern {
+		if prefix == "" {
+			return true
+		}
+		if ok, _ := path.Match(prefix, topic); ok {
+			return true
+		}
+		levels := strings.Count(prefix, "/")
+		parts := strings.SplitN(topic, "/", levels+2)
+		if len(parts) <= levels+1 {
+			return false
+		}
+		ok, _ := path.Match(prefix, strings.Join(parts[:levels+1], "/"))
+		return ok
+	}
+	ok, _ := path.Match(rule.Pattern, topic)
+	return ok
+}
+
+// ACLAccessManager allows the accesses granted by its rules to the users, to their roles or to their API keys,
+// and denies all the other accesses.
+// The rules and the roles are given by the configuration, and by the KV store where they are reloaded periodically.
+type ACLAccessManager struct {
+	store       ACLStore
+	configRules []ACLRule
+	configRoles map[string][]string
+	interval    time.Duration
+
+	mutex      sync.RWMutex
+	rules      map[string][]ACLRule
+	userRoles  map[string][]string
+	tokenRoles map[string][]string
+
+	stopC chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewACLAccessManager returns a new ACLAccessManager, with the rules and the roles of the config,
+// and the ones of the store (if any); they are loaded when it is started.
+func NewACLAccessManager(store ACLStore, config ACLConfig) (*ACLAccessManager, error) {
+	m := &ACLAccessManager{
+		store:       store,
+		configRoles: make(map[string][]string),
+		interval:    DefaultACLInterval,
+	}
+	if config.Interval != nil && *config.Interval > 0 {
+		m.interval = *config.Interval
+	}
+	if config.Rules != nil {
+		for _, s := range *config.Rules {
+			rule, err := ParseACLRule(s)
+			if err != nil {
+				return nil, err
+			}
+			m.configRules = append(m.configRules, rule)
+		}
+	}
+	if config.Roles != nil {
+		for _, s := range *config.Roles {
+			userID, roles, err := parseACLRoles(s)
+			if err != nil {
+				return nil, err
+			}
+			m.configRoles[userID] = append(m.configRoles[userID], roles...)
+		}
+	}
+	return m, nil
+}
+
+// Start loads the rules and the roles, and begins reloading the ones of the store periodically.
+func (m *ACLAccessManager) Start() error {
+	m.load()
+	if m.store == nil {
+		return nil
+	}
+	m.stopC = make(chan struct{})
+	m.wg.Add(1)
+	go m.loop()
+	return nil
+}
+
+// Stop ends reloading the rules and the roles.
+func (m *ACLAccessManager) Stop() error {
+	if m.stopC == nil {
+		return nil
+	}
+	close(m.stopC)
+	m.wg.Wait()
+	m.stopC = nil
+	return nil
+}
+
+func (m *ACLAccessManager) loop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.load()
+		case <-m.stopC:
+			return
+		}
+	}
+}
+
+// load replaces the rules and the roles by the ones of the config and of the store; the invalid ones are skipped.
+func (m *ACLAccessManager) load() {
+	rules := make(map[string][]ACLRule)
+	for _, rule := range m.configRules {
+		rules[rule.Subject] = append(rules[rule.Subject], rule)
+	}
+	roles := make(map[string][]string)
+	for userID, r := range m.configRoles {
+		roles[userID] = append(roles[userID], r...)
+	}
+
+	if m.store != nil {
+		for entry := range m.store.Iterate(ACLSchema, "") {
+			rule, err := ParseACLRule(entry[1])
+			if err != nil {
+				logger.WithError(err).WithField("key", entry[0]).Warn("Skipping invalid ACL rule")
+				continue
+			}
+			rules[rule.Subject] = append(rules[rule.Subject], rule)
+		}
+		for entry := range m.store.Iterate(ACLRolesSchema, "") {
+			userID, r, err := parseACLRoles(entry[0] + "=" + entry[1])
+			if err != nil {
+				logger.WithError(err).WithField("key", entry[0]).Warn("Skipping invalid ACL roles")
+				continue
+			}
+			roles[userID] = append(roles[userID], r...)
+		}
+	}
+
+	m.mutex.Lock()
+	m.rules = rules
+	m.userRoles = roles
+	m.mutex.Unlock()
+}
+
+// BindRoles sets the roles given to the user by its token, in addition to its configured roles.
+// It is an implementation of the RoleBinder interface.
+func (m *ACLAccessManager) BindRoles(userID string, roles []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.tokenRoles == nil {
+		m.tokenRoles = make(map[string][]string)
+	}
+	if len(roles) == 0 {
+		delete(m.tokenRoles, userID)
+		return
+	}
+	m.tokenRoles[userID] = roles
+}
+
+// IsAllowed is an implementation of the AccessManager interface.
+// The access is allowed if a rule of everybody, of the user, of one of its roles, or of the user ID as an API key
+// allows it for the path.
+func (m *ACLAccessManager) IsAllowed(accessType AccessType, userID string, path protocol.Path) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	subjects := []string{subjectAll}
+	if userID != "" {
+		subjects = append(subjects, subjectUser+userID, subjectKey+userID)
+		for _, role := range m.userRoles[userID] {
+			subjects = append(subjects, subjectRole+role)
+		}
+		for _, role := range m.tokenRoles[userID] {
+			subjects = append(subjects, subjectRole+role)
+		}
+	}
+	for _, subject := range subjects {
+		for _, rule := range m.rules[subject] {
+			if rule.matches(accessType, path) {
+				return true
+			}
+		}
+	}
+
+	logger.WithFields(log.Fields{
+		"userID":     userID,
+		"accessType": accessType,
+		"path":       path,
+	}).Debug("Access denied by the ACL")
+	return false
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/server/kvstore"
+)
+
+func TestParseACLRule(t *testing.T) {
+	a := assert.New(t)
+
+	rule, err := ParseACLRule("role:team-a publish,subscribe /team-a/**")
+	a.NoError(err)
+	a.Equal(ACLRule{Subject: "role:team-a", Publish: true, Subscribe: true, Pattern: "/team-a/**"}, rule)
+
+	for _, invalid := range []string{
+		"",
+		"role:team-a publish",
+		"team-a publish /team-a",
+		"user:marvin delete /team-a",
+		"user:marvin publish team-a",
+		"user:marvin publish /team-a/[",
+	} {
+		_, err = ParseACLRule(invalid)
+		a.Error(err, invalid)
+	}
+}
+
+func TestACLRule_Matches(t *testing.T) {
+	a := assert.New(t)
+
+	rule := ACLRule{Subscribe: true, Pattern: "/team-a/**"}
+	a.True(rule.matches(READ, "/team-a"))
+	a.True(rule.matches(READ, "/team-a/foo/bar"))
+	a.False(rule.matches(READ, "/team-ab"))
+	a.False(rule.matches(WRITE, "/team-a/foo"))
+
+	rule = ACLRule{Publish: true, Pattern: "/*/alerts/**"}
+	a.True(rule.matches(WRITE, "/team-a/alerts/cpu"))
+	a.False(rule.matches(WRITE, "/team-a/metrics"))
+
+	rule = ACLRule{Publish: true, Pattern: "/news/*"}
+	a.True(rule.matches(WRITE, "/news/sport"))
+	a.False(rule.matches(WRITE, "/news/sport/football"))
+
+	a.True(ACLRule{Subscribe: true, Pattern: "/**"}.matches(READ, "/anything"))
+}
+
+func TestACLAccessManager(t *testing.T) {
+	a := assert.New(t)
+
+	kvs := kvstore.NewMemoryKVStore()
+	rules := []string{"role:team-a publish,subscribe /team-a/**", "* subscribe /public/**"}
+	roles := []string{"marvin=team-a"}
+	interval := 10 * time.Millisecond
+	m, err := NewACLAccessManager(kvs, ACLConfig{Rules: &rules, Roles: &roles, Interval: &interval})
+	a.NoError(err)
+	a.NoError(m.Start())
+	defer m.Stop()
+
+	a.True(m.IsAllowed(WRITE, "marvin", "/team-a/foo"))
+	a.True(m.IsAllowed(READ, "arthur", "/public/news"))
+	a.False(m.IsAllowed(WRITE, "arthur", "/public/news"))
+	a.False(m.IsAllowed(READ, "arthur", "/team-a/foo"))
+	a.False(m.IsAllowed(READ, "", "/team-a/foo"))
+
+	// the rules and the roles of the KV store are reloaded
+	a.NoError(kvs.Put(ACLSchema, "1", []byte("role:team-b subscribe /team-b/**")))
+	a.NoError(kvs.Put(ACLSchema, "2", []byte("key:s3cr3t publish /team-b/**")))
+	a.NoError(kvs.Put(ACLSchema, "3", []byte("invalid")))
+	a.NoError(kvs.Put(ACLRolesSchema, "arthur", []byte("team-b")))
+	time.Sleep(50 * time.Millisecond)
+
+	a.True(m.IsAllowed(READ, "arthur", "/team-b/foo"))
+	a.False(m.IsAllowed(WRITE, "arthur", "/team-b/foo"))
+	a.True(m.IsAllowed(WRITE, "s3cr3t", "/team-b/foo"))
+	a.True(m.IsAllowed(WRITE, "marvin", "/team-a/foo"))
+}
+
+func TestNewACLAccessManagerWithInvalidConfig(t *testing.T) {
+	rules := []string{"user:marvin publish"}
+	_, err := NewACLAccessManager(nil, ACLConfig{Rules: &rules})
+	assert.Error(t, err)
+
+	roles := []string{"marvin"}
+	_, err = NewACLAccessManager(nil, ACLConfig{Roles: &roles})
+	assert.Error(t, err)
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+)
+
+const (
+	// DefaultAuthorizerTimeout is the timeout of the requests to the external authorizer
+	DefaultAuthorizerTimeout = 2 * time.Second
+
+	// DefaultAuthorizerCacheTTL is the duration of caching the decisions, if the authorizer does not give one
+	DefaultAuthorizerCacheTTL = 30 * time.Second
+
+	authorizerCacheMax = 10000
+)
+
+// AuthorizerConfig is used for configuring the external authorizer of the accesses to the topics.
+type AuthorizerConfig struct {
+	// URL is the endpoint receiving the AuthorizerRequest by POST; the authorizer is disabled if it is empty
+	URL      *string
+	Timeout  *time.Duration
+	CacheTTL *time.Duration
+}
+
+// AuthorizerRequest is the JSON body posted to the external authorizer.
+type AuthorizerRequest struct {
+	User string `json:"user"`
+	Path string `json:"path"`
+	// Action is "publish" or "subscribe"
+	Action string `json:"action"`
+}
+
+// AuthorizerResponse is the JSON decision of the external authorizer.
+type AuthorizerResponse struct {
+	Allow bool `json:"allow"`
+	// TTL is the number of seconds the decision can be cached (the default TTL if 0, not cached if < 0)
+	TTL int `json:"ttl"`
+}
+
+type authorizerDecision struct {
+	allow   bool
+	expires time.Time
+}
+
+// Authorizer is an AccessManager delegating the decisions to an external HTTP service, and caching them.
+// The accesses are denied if the service fails (these failures are not cached).
+type Authorizer struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+
+	mutex sync.Mutex
+	cache map[AuthorizerRequest]authorizerDecision
+}
+
+// NewAuthorizer returns an Authorizer posting to the URL of the config.
+func NewAuthorizer(config AuthorizerConfig) (*Authorizer, error) {
+	if stringValue(config.URL) == "" {
+		return nil, fmt.Errorf("The URL of the authorizer is required")
+	}
+	a := &Authorizer{
+		url:    *config.URL,
+		ttl:    DefaultAuthorizerCacheTTL,
+		client: &http.Client{Timeout: DefaultAuthorizerTimeout},
+		now:    time.Now,
+		cache:  make(map[AuthorizerRequest]authorizerDecision),
+	}
+	if config.Timeout != nil && *config.Timeout > 0 {
+		a.client.Timeout = *config.Timeout
+	}
+	if config.CacheTTL != nil {
+		a.ttl = *config.CacheTTL
+	}
+	return a, nil
+}
+
+// IsAllowed is an implementation of the AccessManager interface.
+func (a *Authorizer) IsAllowed(accessType AccessType, userID string, path protocol.Path) bool {
+	request := AuthorizerRequest{User: userID, Path: string(path), Action: accessPublish}
+	if accessType == READ {
+		request.Action = accessSubscribe
+	}
+
+	now := a.now()
+	a.mutex.Lock()
+	if decision, ok := a.cache[request]; ok && now.Before(decision.expires) {
+		a.mutex.Unlock()
+		return decision.allow
+	}
+	a.mutex.Unlock()
+
+	response, err := a.authorize(request)
+	if err != nil {
+		logger.WithError(err).WithFields(log.Fields{
+			"url":    a.url,
+			"userID": userID,
+			"path":   path,
+		}).Error("Could not get the decision of the authorizer")
+		return false
+	}
+
+	ttl := a.ttl
+	if response.TTL != 0 {
+		ttl = time.Duration(response.TTL) * time.Second
+	}
+	if ttl > 0 {
+		a.mutex.Lock()
+		if len(a.cache) >= authorizerCacheMax {
+			for r, d := range a.cache {
+				if !now.Before(d.expires) {
+					delete(a.cache, r)
+				}
+			}
+			if len(a.cache) >= authorizerCacheMax {
+				a.cache = make(map[AuthorizerRequest]authorizerDecision)
+			}
+		}
+		a.cache[request] = authorizerDecision{allow: response.Allow, expires: now.Add(ttl)}
+		a.mutex.Unlock()
+	}
+	return response.Allow
+}
+
+func (a *Authorizer) authorize(request AuthorizerRequest) (*AuthorizerResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status of the authorizer: %d", resp.StatusCode)
+	}
+	response := &AuthorizerResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// AccessManagers allow an access only if all of them allow it (e.g. the ACL and an external authorizer).
+type AccessManagers []AccessManager
+
+// IsAllowed is an implementation of the AccessManager interface.
+func (managers AccessManagers) IsAllowed(accessType AccessType, userID string, path protocol.Path) bool {
+	for _, m := range managers {
+		if !m.IsAllowed(accessType, userID, path) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testAuthorizerServer(requests *[]AuthorizerRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request AuthorizerRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		*requests = append(*requests, request)
+		switch request.User {
+		case "marvin":
+			w.Write([]byte(`{"allow":true}`))
+		case "uncached":
+			w.Write([]byte(`{"allow":true,"ttl":-1}`))
+		case "failing":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"allow":false,"ttl":300}`))
+		}
+	}))
+}
+
+func TestAuthorizer_IsAllowed(t *testing.T) {
+	a := assert.New(t)
+	var requests []AuthorizerRequest
+	server := testAuthorizerServer(&requests)
+	defer server.Close()
+
+	authorizer, err := NewAuthorizer(AuthorizerConfig{URL: &server.URL})
+	a.NoError(err)
+	now := time.Unix(1000, 0)
+	authorizer.now = func() time.Time { return now }
+
+	a.True(authorizer.IsAllowed(WRITE, "marvin", "/foo"))
+	a.Equal(AuthorizerRequest{User: "marvin", Path: "/foo", Action: "publish"}, requests[0])
+	a.False(authorizer.IsAllowed(READ, "other", "/foo"))
+	a.Equal(AuthorizerRequest{User: "other", Path: "/foo", Action: "subscribe"}, requests[1])
+
+	// the decisions are cached for their TTL (the default TTL if none)
+	a.True(authorizer.IsAllowed(WRITE, "marvin", "/foo"))
+	a.False(authorizer.IsAllowed(READ, "other", "/foo"))
+	a.Len(requests, 2)
+	now = now.Add(DefaultAuthorizerCacheTTL)
+	a.True(authorizer.IsAllowed(WRITE, "marvin", "/foo"))
+	a.False(authorizer.IsAllowed(READ, "other", "/foo"))
+	a.Len(requests, 3)
+
+	// not cached: the negative TTL and the failures, which deny the access
+	a.True(authorizer.IsAllowed(WRITE, "uncached", "/foo"))
+	a.True(authorizer.IsAllowed(WRITE, "uncached", "/foo"))
+	a.False(authorizer.IsAllowed(WRITE, "failing", "/foo"))
+	a.False(authorizer.IsAllowed(WRITE, "failing", "/foo"))
+	a.Len(requests, 7)
+}
+
+func TestAuthorizer_Unreachable(t *testing.T) {
+	a := assert.New(t)
+
+	url := "http://127.0.0.1:1/authorize"
+	authorizer, err := NewAuthorizer(AuthorizerConfig{URL: &url})
+	a.NoError(err)
+	a.False(authorizer.IsAllowed(WRITE, "marvin", "/foo"))
+
+	_, err = NewAuthorizer(AuthorizerConfig{})
+	a.Error(err)
+}
+
+func TestAccessManagers(t *testing.T) {
+	a := assert.New(t)
+
+	a.True(AccessManagers{NewAllowAllAccessManager(true), NewAllowAllAccessManager(true)}.IsAllowed(WRITE, "marvin", "/foo"))
+	a.False(AccessManagers{NewAllowAllAccessManager(true), NewAllowAllAccessManager(false)}.IsAllowed(WRITE, "marvin", "/foo"))
+}
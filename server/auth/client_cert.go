@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// IdentityCN maps the common name of the client certificates to the user IDs
+	IdentityCN = "cn"
+
+	// IdentitySAN maps the first subject alternative name (DNS name, email address or URI)
+	// of the client certificates to the user IDs
+	IdentitySAN = "san"
+)
+
+type clientIdentityKey struct{}
+
+// ValidIdentityField returns an error if the field is neither IdentityCN nor IdentitySAN.
+func ValidIdentityField(field string) error {
+	if field != IdentityCN && field != IdentitySAN {
+		return fmt.Errorf("Invalid identity field of the client certificates %q: expected %s or %s", field, IdentityCN, IdentitySAN)
+	}
+	return nil
+}
+
+// CertificateIdentity returns the identity of the certificate given by the field (IdentityCN or IdentitySAN).
+func CertificateIdentity(cert *x509.Certificate, field string) string {
+	if field != IdentitySAN {
+		return cert.Subject.CommonName
+	}
+	switch {
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return ""
+}
+
+// ClientIdentityHandler sets the identity of the verified client certificate (if any) of each request,
+// which is returned by ClientIdentity.
+func ClientIdentityHandler(field string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			if identity := CertificateIdentity(r.TLS.VerifiedChains[0][0], field); identity != "" {
+				r = r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, identity))
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ClientIdentity returns the identity of the verified client certificate of the request, or "" if there is none.
+func ClientIdentity(r *http.Request) string {
+	identity, _ := r.Context().Value(clientIdentityKey{}).(string)
+	return identity
+}
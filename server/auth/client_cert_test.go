@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertificateIdentity(t *testing.T) {
+	a := assert.New(t)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "device-1"}}
+	a.Equal("device-1", CertificateIdentity(cert, IdentityCN))
+	a.Equal("", CertificateIdentity(cert, IdentitySAN))
+
+	cert.EmailAddresses = []string{"device-1@example.com"}
+	a.Equal("device-1@example.com", CertificateIdentity(cert, IdentitySAN))
+	cert.DNSNames = []string{"device-1.example.com"}
+	a.Equal("device-1.example.com", CertificateIdentity(cert, IdentitySAN))
+
+	a.NoError(ValidIdentityField(IdentitySAN))
+	a.Error(ValidIdentityField("email"))
+}
+
+func TestAuthenticateByClientCertificate(t *testing.T) {
+	a := assert.New(t)
+
+	var userID string
+	var err error
+	handler := ClientIdentityHandler(IdentityCN, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err = Authenticate(nil, r, r.URL.Query().Get("userId"))
+	}))
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "device-1"}}
+	req := httptest.NewRequest(http.MethodGet, "/stream/", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	a.NoError(err)
+	a.Equal("device-1", userID)
+
+	req = httptest.NewRequest(http.MethodGet, "/stream/?userId=device-2", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	a.Equal(ErrUserIDMismatch, err)
+
+	// without a verified certificate and without a token validator, the claimed user ID is kept
+	req = httptest.NewRequest(http.MethodGet, "/stream/?userId=device-2", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	a.NoError(err)
+	a.Equal("device-2", userID)
+}
@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwtLeeway is the tolerated clock skew when checking the expiration and the start of validity of the tokens
+	jwtLeeway = 30 * time.Second
+
+	// jwksMinRefresh is the minimum interval between two fetches of the JWKS, when a token has an unknown key ID
+	jwksMinRefresh = time.Minute
+
+	jwksTimeout = 10 * time.Second
+
+	accessTokenParam = "access_token"
+)
+
+var (
+	ErrNoTokenKey     = errors.New("A secret, a public key or a JWKS URL is required for validating the tokens")
+	ErrMissingToken   = errors.New("The bearer token is missing")
+	ErrInvalidToken   = errors.New("The token is invalid")
+	ErrExpiredToken   = errors.New("The token is expired or not valid yet")
+	ErrUnknownKey     = errors.New("The key of the token is unknown")
+	ErrUserIDMismatch = errors.New("The user ID does not match the subject of the token or of the client certificate")
+)
+
+// Claims are the claims of a validated token.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	Roles     []string
+	Raw       map[string]interface{}
+}
+
+// TokenValidator validates the bearer tokens of the requests.
+type TokenValidator interface {
+	Validate(token string) (*Claims, error)
+}
+
+// JWTConfig is used for configuring the validation of the JSON Web Tokens.
+type JWTConfig struct {
+	Enabled   *bool
+	Secret    *string
+	PublicKey *string
+	JWKSURL   *string
+	Issuer    *string
+	Audience  *string
+}
+
+// JWTValidator validates JSON Web Tokens signed with HS256 (by a shared secret)
+// or with RS256 (by a public key, or by one of the keys published at a JWKS URL).
+type JWTValidator struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+	jwksURL   string
+	issuer    string
+	audience  string
+
+	mutex       sync.Mutex
+	jwks        map[string]*rsa.PublicKey
+	jwksFetched time.Time
+	client      *http.Client
+}
+
+// NewJWTValidator returns a new JWTValidator; the public key is read from the PEM file given in the config.
+func NewJWTValidator(config JWTConfig) (*JWTValidator, error) {
+	v := &JWTValidator{
+		secret:   []byte(stringValue(config.Secret)),
+		jwksURL:  stringValue(config.JWKSURL),
+		issuer:   stringValue(config.Issuer),
+		audience: stringValue(config.Audience),
+		client:   &http.Client{Timeout: jwksTimeout},
+	}
+	if path := stringValue(config.PublicKey); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if v.publicKey, err = parseRSAPublicKey(data); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.secret) == 0 && v.publicKey == nil && v.jwksURL == "" {
+		return nil, ErrNoTokenKey
+	}
+	return v, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Validate checks the signature of the token, its expiration, its issuer and its audience, and returns its claims.
+func (v *JWTValidator) Validate(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := v.verify(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims, err := parseClaims(raw)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, ErrInvalidToken
+	}
+	if v.audience != "" && !contains(claims.Audience, v.audience) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// verify checks the signature of the signed part of the token with the key of the algorithm.
+// Only the algorithms with a configured key are accepted (and never "none").
+func (v *JWTValidator) verify(alg, kid, signed string, signature []byte) error {
+	switch alg {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return ErrInvalidToken
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrInvalidToken
+		}
+		return nil
+	case "RS256":
+		key, err := v.rsaKey(kid)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) != nil {
+			return ErrInvalidToken
+		}
+		return nil
+	}
+	return ErrInvalidToken
+}
+
+// rsaKey returns the configured public key, or the key of the ID published at the JWKS URL.
+func (v *JWTValidator) rsaKey(kid string) (*rsa.PublicKey, error) {
+	if v.jwksURL == "" {
+		if v.publicKey == nil {
+			return nil, ErrInvalidToken
+		}
+		return v.publicKey, nil
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if key, ok := v.jwks[kid]; ok {
+		return key, nil
+	}
+	if time.Since(v.jwksFetched) < jwksMinRefresh {
+		return nil, ErrUnknownKey
+	}
+	v.jwksFetched = time.Now()
+	keys, err := v.fetchJWKS()
+	if err != nil {
+		logger.WithError(err).WithField("url", v.jwksURL).Error("Could not fetch the JWKS")
+		return nil, ErrUnknownKey
+	}
+	v.jwks = keys
+	if key, ok := v.jwks[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// fetchJWKS returns the RSA keys published at the JWKS URL, by their ID.
+func (v *JWTValidator) fetchJWKS() (map[string]*rsa.PublicKey, error) {
+	resp, err := v.client.Get(v.jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status of the JWKS response: %d", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("The public key is not PEM encoded")
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("The public key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// parseClaims reads the registered claims, and checks the expiration and the start of validity.
+func parseClaims(raw map[string]interface{}) (*Claims, error) {
+	claims := &Claims{Raw: raw}
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Issuer, _ = raw["iss"].(string)
+	switch aud := raw["aud"].(type) {
+	case string:
+		claims.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				claims.Audience = append(claims.Audience, s)
+			}
+		}
+	}
+	now := time.Now()
+	if exp, ok := raw["exp"].(float64); ok {
+		claims.ExpiresAt = time.Unix(int64(exp), 0)
+		if now.After(claims.ExpiresAt.Add(jwtLeeway)) {
+			return nil, ErrExpiredToken
+		}
+	}
+	if nbf, ok := raw["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenFromRequest returns the bearer token of the Authorization header of the request,
+// or of its access_token query parameter (the browsers can not set headers on the websocket requests).
+func TokenFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	return r.URL.Query().Get(accessTokenParam)
+}
+
+// Authenticate returns the user ID of the request: the identity of its verified client certificate if any,
+// otherwise the subject of its bearer token validated by v (or the claimed user ID, if v is nil).
+// The user ID claimed by the request (if any) has to be the identity of the certificate or the subject of the token.
+func Authenticate(v TokenValidator, r *http.Request, userID string) (string, error) {
+	if identity := ClientIdentity(r); identity != "" {
+		if userID != "" && userID != identity {
+			return "", ErrUserIDMismatch
+		}
+		return identity, nil
+	}
+	if v == nil {
+		return userID, nil
+	}
+	return AuthenticateToken(v, TokenFromRequest(r), userID)
+}
+
+// AuthenticateToken returns the subject of the bearer token validated by v, for the clients which do not
+// send HTTP requests (e.g. gRPC metadata or STOMP CONNECT frames). The claimed user ID (if any) has to be the subject.
+func AuthenticateToken(v TokenValidator, token string, userID string) (string, error) {
+	if token == "" {
+		return "", ErrMissingToken
+	}
+	claims, err := v.Validate(token)
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject == "" {
+		return "", ErrInvalidToken
+	}
+	if userID != "" && userID != claims.Subject {
+		return "", ErrUserIDMismatch
+	}
+	return claims.Subject, nil
+}
+
+// AuthenticationStatus returns the HTTP status of a failed authentication.
+func AuthenticationStatus(err error) int {
+	if err == ErrUserIDMismatch {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTValidator_HS256(t *testing.T) {
+	a := assert.New(t)
+
+	secret, issuer, audience := "secret", "guble-tests", "guble"
+	v, err := NewJWTValidator(JWTConfig{Secret: &secret, Issuer: &issuer, Audience: &audience})
+	a.NoError(err)
+
+	claims, err := v.Validate(signHS256(t, "secret", map[string]interface{}{
+		"sub": "marvin",
+		"iss": "guble-tests",
+		"aud": []string{"other", "guble"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	a.NoError(err)
+	a.Equal("marvin", claims.Subject)
+
+	for _, invalid := range []struct {
+		secret string
+		claims map[string]interface{}
+		err    error
+	}{
+		{"other", map[string]interface{}{"sub": "marvin", "iss": issuer, "aud": audience}, ErrInvalidToken},
+		{"secret", map[string]interface{}{"sub": "marvin", "iss": "other", "aud": audience}, ErrInvalidToken},
+		{"secret", map[string]interface{}{"sub": "marvin", "iss": issuer, "aud": "other"}, ErrInvalidToken},
+		{"secret", map[string]interface{}{"iss": issuer, "aud": audience}, ErrInvalidToken},
+		{"secret", map[string]interface{}{"sub": "marvin", "iss": issuer, "aud": audience, "exp": time.Now().Add(-time.Hour).Unix()}, ErrExpiredToken},
+		{"secret", map[string]interface{}{"sub": "marvin", "iss": issuer, "aud": audience, "nbf": time.Now().Add(time.Hour).Unix()}, ErrExpiredToken},
+	} {
+		_, err = v.Validate(signHS256(t, invalid.secret, invalid.claims))
+		a.Equal(invalid.err, err, "%v", invalid.claims)
+	}
+
+	// unsigned tokens are rejected
+	unsigned := segment(t, map[string]string{"alg": "none"}) + "." + segment(t, map[string]string{"sub": "marvin"}) + "."
+	_, err = v.Validate(unsigned)
+	a.Equal(ErrInvalidToken, err)
+
+	_, err = v.Validate("invalid")
+	a.Equal(ErrInvalidToken, err)
+}
+
+func TestJWTValidator_RS256WithJWKS(t *testing.T) {
+	a := assert.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NoError(err)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer server.Close()
+
+	url := server.URL
+	v, err := NewJWTValidator(JWTConfig{JWKSURL: &url})
+	a.NoError(err)
+
+	claims, err := v.Validate(signRS256(t, key, "key1", map[string]interface{}{"sub": "marvin"}))
+	a.NoError(err)
+	a.Equal("marvin", claims.Subject)
+
+	// the unknown keys do not refetch the JWKS before the minimum interval
+	_, err = v.Validate(signRS256(t, key, "key2", map[string]interface{}{"sub": "marvin"}))
+	a.Equal(ErrUnknownKey, err)
+	a.Equal(1, fetches)
+
+	// the tokens signed with HS256 are rejected without a secret
+	_, err = v.Validate(signHS256(t, "", map[string]interface{}{"sub": "marvin"}))
+	a.Equal(ErrInvalidToken, err)
+}
+
+func TestNewJWTValidatorWithoutKey(t *testing.T) {
+	_, err := NewJWTValidator(JWTConfig{})
+	assert.Equal(t, ErrNoTokenKey, err)
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := assert.New(t)
+
+	secret := "secret"
+	v, err := NewJWTValidator(JWTConfig{Secret: &secret})
+	a.NoError(err)
+	token := signHS256(t, secret, map[string]interface{}{"sub": "marvin"})
+
+	req := httptest.NewRequest(http.MethodGet, "/stream/user/marvin", nil)
+	_, err = Authenticate(v, req, "marvin")
+	a.Equal(ErrMissingToken, err)
+	a.Equal(http.StatusUnauthorized, AuthenticationStatus(err))
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	userID, err := Authenticate(v, req, "")
+	a.NoError(err)
+	a.Equal("marvin", userID)
+
+	req = httptest.NewRequest(http.MethodGet, "/stream/user/arthur?access_token="+token, nil)
+	_, err = Authenticate(v, req, "arthur")
+	a.Equal(ErrUserIDMismatch, err)
+	a.Equal(http.StatusForbidden, AuthenticationStatus(err))
+}
+
+func segment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, secret string, claims map[string]interface{}) string {
+	signed := segment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + segment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := segment(t, map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + segment(t, claims)
+	hash := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	assert.NoError(t, err)
+	return strings.Join([]string{signed, base64.RawURLEncoding.EncodeToString(signature)}, ".")
+}
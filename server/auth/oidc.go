@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultUserClaim is the claim of the tokens mapped to the guble user ID
+	DefaultUserClaim = "sub"
+
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	oidcTimeout       = 10 * time.Second
+
+	// introspectionCacheTTL is the maximum duration of caching the result of an introspection
+	introspectionCacheTTL = 30 * time.Second
+	introspectionCacheMax = 10000
+)
+
+var ErrNoOIDCProvider = errors.New("An issuer URL or an introspection URL is required for validating the OAuth2 tokens")
+
+// OIDCConfig is used for configuring the validation of the OAuth2 access tokens issued by an identity provider,
+// by the OIDC discovery of its keys, or by the introspection of the tokens.
+type OIDCConfig struct {
+	IssuerURL        *string
+	IntrospectionURL *string
+	ClientID         *string
+	ClientSecret     *string
+	Audience         *string
+	UserClaim        *string
+	RolesClaim       *string
+}
+
+// RoleBinder binds the roles given by the tokens of the users to their user IDs.
+type RoleBinder interface {
+	BindRoles(userID string, roles []string)
+}
+
+// NewOIDCValidator returns a TokenValidator of the OAuth2 access tokens: by introspection if an introspection URL is configured,
+// otherwise as JSON Web Tokens signed by the keys published by the issuer (found by OIDC discovery).
+// The claims of the tokens are mapped to the user IDs and the roles, which are bound by the binder (if any).
+func NewOIDCValidator(config OIDCConfig, binder RoleBinder) (TokenValidator, error) {
+	client := &http.Client{Timeout: oidcTimeout}
+	var v TokenValidator
+	switch {
+	case stringValue(config.IntrospectionURL) != "":
+		v = &introspectionValidator{
+			url:          stringValue(config.IntrospectionURL),
+			clientID:     stringValue(config.ClientID),
+			clientSecret: stringValue(config.ClientSecret),
+			audience:     stringValue(config.Audience),
+			client:       client,
+			cache:        make(map[string]*introspectionResult),
+		}
+	case stringValue(config.IssuerURL) != "":
+		discovered, err := discoverOIDC(client, stringValue(config.IssuerURL))
+		if err != nil {
+			return nil, err
+		}
+		if v, err = NewJWTValidator(JWTConfig{
+			JWKSURL:  &discovered.JWKSURI,
+			Issuer:   &discovered.Issuer,
+			Audience: config.Audience,
+		}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrNoOIDCProvider
+	}
+
+	userClaim := stringValue(config.UserClaim)
+	if userClaim == "" {
+		userClaim = DefaultUserClaim
+	}
+	return &claimsMapper{
+		validator:  v,
+		userClaim:  userClaim,
+		rolesClaim: stringValue(config.RolesClaim),
+		binder:     binder,
+	}, nil
+}
+
+type oidcDiscovery struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// discoverOIDC fetches the OpenID configuration of the issuer.
+func discoverOIDC(client *http.Client, issuerURL string) (*oidcDiscovery, error) {
+	resp, err := client.Get(strings.TrimSuffix(issuerURL, "/") + oidcDiscoveryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status of the OIDC discovery: %d", resp.StatusCode)
+	}
+
+	discovery := &oidcDiscovery{}
+	if err := json.NewDecoder(resp.Body).Decode(discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != strings.TrimSuffix(issuerURL, "/") && discovery.Issuer != issuerURL {
+		return nil, fmt.Errorf("The discovered issuer %q does not match %q", discovery.Issuer, issuerURL)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("The OIDC discovery does not publish a JWKS URI")
+	}
+	logger.WithField("issuer", discovery.Issuer).Info("Discovered the OIDC provider")
+	return discovery, nil
+}
+
+// introspectionValidator validates the tokens by the introspection endpoint of the authorization server (RFC 7662).
+type introspectionValidator struct {
+	url          string
+	clientID     string
+	clientSecret string
+	audience     string
+	client       *http.Client
+
+	mutex sync.Mutex
+	cache map[string]*introspectionResult
+}
+
+type introspectionResult struct {
+	claims  *Claims
+	err     error
+	expires time.Time
+}
+
+// Validate returns the claims of an active token, caching the results for a short time.
+func (v *introspectionValidator) Validate(token string) (*Claims, error) {
+	now := time.Now()
+	v.mutex.Lock()
+	if result, ok := v.cache[token]; ok && now.Before(result.expires) {
+		v.mutex.Unlock()
+		return result.claims, result.err
+	}
+	v.mutex.Unlock()
+
+	claims, err := v.introspect(token)
+	if err != nil && err != ErrInvalidToken && err != ErrExpiredToken {
+		// the failures of the introspection itself are not cached
+		logger.WithError(err).WithField("url", v.url).Error("Could not introspect the token")
+		return nil, ErrInvalidToken
+	}
+
+	result := &introspectionResult{claims: claims, err: err, expires: now.Add(introspectionCacheTTL)}
+	if claims != nil && !claims.ExpiresAt.IsZero() && claims.ExpiresAt.Before(result.expires) {
+		result.expires = claims.ExpiresAt
+	}
+	v.mutex.Lock()
+	if len(v.cache) >= introspectionCacheMax {
+		for t, r := range v.cache {
+			if !now.Before(r.expires) {
+				delete(v.cache, t)
+			}
+		}
+		if len(v.cache) >= introspectionCacheMax {
+			v.cache = make(map[string]*introspectionResult)
+		}
+	}
+	v.cache[token] = result
+	v.mutex.Unlock()
+	return claims, err
+}
+
+func (v *introspectionValidator) introspect(token string) (*Claims, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+	req, err := http.NewRequest(http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.clientID), url.QueryEscape(v.clientSecret))
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status of the introspection: %d", resp.StatusCode)
+	}
+
+	var raw map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	if active, _ := raw["active"].(bool); !active {
+		return nil, ErrInvalidToken
+	}
+	claims, err := parseClaims(raw)
+	if err != nil {
+		return nil, err
+	}
+	if v.audience != "" && !contains(claims.Audience, v.audience) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// claimsMapper maps the configured claims of the validated tokens to the user ID and to the roles.
+type claimsMapper struct {
+	validator  TokenValidator
+	userClaim  string
+	rolesClaim string
+	binder     RoleBinder
+}
+
+func (m *claimsMapper) Validate(token string) (*Claims, error) {
+	claims, err := m.validator.Validate(token)
+	if err != nil {
+		return nil, err
+	}
+	mapped := *claims
+	if m.userClaim != DefaultUserClaim {
+		mapped.Subject, _ = claims.Raw[m.userClaim].(string)
+		if mapped.Subject == "" {
+			return nil, ErrInvalidToken
+		}
+	}
+	if m.rolesClaim != "" {
+		mapped.Roles = stringsClaim(claims.Raw[m.rolesClaim])
+		if m.binder != nil {
+			m.binder.BindRoles(mapped.Subject, mapped.Roles)
+		}
+	}
+	return &mapped, nil
+}
+
+// stringsClaim returns the values of a claim given as an array of strings,
+// or as a string of values separated by spaces (like the OAuth2 scope).
+func stringsClaim(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return strings.Fields(c)
+	case []interface{}:
+		var values []string
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// TokenValidators validates the tokens by the first of its validators accepting them.
+type TokenValidators []TokenValidator
+
+// Validate returns the claims of the first validator accepting the token, or the error of the last one.
+func (validators TokenValidators) Validate(token string) (*Claims, error) {
+	err := ErrInvalidToken
+	for _, v := range validators {
+		var claims *Claims
+		if claims, err = v.Validate(token); err == nil {
+			return claims, nil
+		}
+	}
+	return nil, err
+}
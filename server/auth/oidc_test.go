@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOIDCValidator_Discovery(t *testing.T) {
+	a := assert.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NoError(err)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case oidcDiscoveryPath:
+			json.NewEncoder(w).Encode(map[string]string{"issuer": server.URL, "jwks_uri": server.URL + "/keys"})
+		case "/keys":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]string{{
+					"kty": "RSA",
+					"kid": "key1",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	issuer, userClaim, rolesClaim := server.URL, "email", "groups"
+	acl, err := NewACLAccessManager(nil, ACLConfig{Rules: &[]string{"role:team-a publish /team-a/**"}})
+	a.NoError(err)
+	a.NoError(acl.Start())
+	v, err := NewOIDCValidator(OIDCConfig{IssuerURL: &issuer, UserClaim: &userClaim, RolesClaim: &rolesClaim}, acl)
+	a.NoError(err)
+
+	a.False(acl.IsAllowed(WRITE, "marvin@example.com", "/team-a/foo"))
+	claims, err := v.Validate(signRS256(t, key, "key1", map[string]interface{}{
+		"sub":    "1234",
+		"iss":    issuer,
+		"email":  "marvin@example.com",
+		"groups": []string{"team-a"},
+	}))
+	a.NoError(err)
+	a.Equal("marvin@example.com", claims.Subject)
+	a.Equal([]string{"team-a"}, claims.Roles)
+	a.True(acl.IsAllowed(WRITE, "marvin@example.com", "/team-a/foo"))
+
+	// the tokens of another issuer are rejected
+	_, err = v.Validate(signRS256(t, key, "key1", map[string]interface{}{"sub": "1234", "iss": "other", "email": "marvin@example.com"}))
+	a.Equal(ErrInvalidToken, err)
+
+	// the user claim is required
+	_, err = v.Validate(signRS256(t, key, "key1", map[string]interface{}{"sub": "1234", "iss": issuer}))
+	a.Equal(ErrInvalidToken, err)
+}
+
+func TestOIDCValidator_Introspection(t *testing.T) {
+	a := assert.New(t)
+
+	introspections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		introspections++
+		clientID, clientSecret, _ := r.BasicAuth()
+		a.Equal("guble", clientID)
+		a.Equal("secret", clientSecret)
+		if r.PostFormValue("token") != "active-token" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active":   true,
+			"username": "marvin",
+			"scope":    "publish subscribe",
+		})
+	}))
+	defer server.Close()
+
+	url, clientID, clientSecret, userClaim, rolesClaim := server.URL, "guble", "secret", "username", "scope"
+	v, err := NewOIDCValidator(OIDCConfig{
+		IntrospectionURL: &url,
+		ClientID:         &clientID,
+		ClientSecret:     &clientSecret,
+		UserClaim:        &userClaim,
+		RolesClaim:       &rolesClaim,
+	}, nil)
+	a.NoError(err)
+
+	for i := 0; i < 2; i++ {
+		claims, err := v.Validate("active-token")
+		a.NoError(err)
+		a.Equal("marvin", claims.Subject)
+		a.Equal([]string{"publish", "subscribe"}, claims.Roles)
+	}
+	_, err = v.Validate("revoked-token")
+	a.Equal(ErrInvalidToken, err)
+
+	// the results are cached
+	a.Equal(2, introspections)
+}
+
+func TestNewOIDCValidatorWithoutProvider(t *testing.T) {
+	_, err := NewOIDCValidator(OIDCConfig{}, nil)
+	assert.Equal(t, ErrNoOIDCProvider, err)
+}
+
+func TestTokenValidators(t *testing.T) {
+	a := assert.New(t)
+
+	secret1, secret2 := "secret1", "secret2"
+	v1, err := NewJWTValidator(JWTConfig{Secret: &secret1})
+	a.NoError(err)
+	v2, err := NewJWTValidator(JWTConfig{Secret: &secret2})
+	a.NoError(err)
+	validators := TokenValidators{v1, v2}
+
+	claims, err := validators.Validate(signHS256(t, secret2, map[string]interface{}{"sub": "marvin"}))
+	a.NoError(err)
+	a.Equal("marvin", claims.Subject)
+
+	_, err = validators.Validate(signHS256(t, "other", map[string]interface{}{"sub": "marvin"}))
+	a.Equal(ErrInvalidToken, err)
+}
@@ -0,0 +1,406 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+const (
+	// DefaultUsersPrefix is the prefix of the endpoint managing the users, their roles and the ACL rules
+	DefaultUsersPrefix = "/admin/acl"
+
+	// UsersSchema is the schema of the users in the KV store: the user ID as key, with its JSON record as value
+	UsersSchema = "acl_users"
+
+	// UserKeysSchema is the schema of the API keys in the KV store: the SHA-256 of the key as key, with the user ID as value
+	UserKeysSchema = "acl_user_keys"
+
+	// AdminRole is the role of the users allowed to manage the users, the roles and the rules
+	AdminRole = "admin"
+
+	apiKeyBytes = 32
+)
+
+var (
+	ErrUserExists    = errors.New("The user already exists")
+	ErrUnknownUser   = errors.New("The user does not exist")
+	ErrInvalidUser   = errors.New("The user ID is invalid")
+	ErrUnknownAPIKey = errors.New("The API key is unknown")
+)
+
+// UserStore is the persistence of the users, of their roles and of the rules, implemented by a kvstore.KVStore.
+type UserStore interface {
+	Put(schema, key string, value []byte) error
+	Get(schema, key string) (value []byte, exist bool, err error)
+	Delete(schema, key string) error
+	Iterate(schema, keyPrefix string) (entries chan [2]string)
+}
+
+// UsersConfig is used for configuring the management of the users.
+type UsersConfig struct {
+	Enabled    *bool
+	Endpoint   *string
+	AdminToken *string
+}
+
+// User is a user managed by the UserManager.
+type User struct {
+	ID      string   `json:"id"`
+	Roles   []string `json:"roles"`
+	Created int64    `json:"created"`
+	// APIKey is returned only when the user is created
+	APIKey string `json:"apiKey,omitempty"`
+}
+
+type userRecord struct {
+	KeyHash string `json:"keyHash"`
+	Created int64  `json:"created"`
+}
+
+// UserManager manages the users, their roles and the ACL rules, persisted in the KV store,
+// so that the access can be controlled without an external identity provider.
+// Each user gets an API key when created, which is validated as a bearer token.
+// The roles and the rules are stored in the schemas of the ACLAccessManager, which is reloaded after each change.
+type UserManager struct {
+	store      UserStore
+	acl        *ACLAccessManager
+	prefix     string
+	adminToken string
+	validator  TokenValidator
+}
+
+// NewUserManager returns a new UserManager of the users persisted in the store; the acl (if any) is reloaded after the changes.
+func NewUserManager(store UserStore, acl *ACLAccessManager, config UsersConfig) *UserManager {
+	m := &UserManager{
+		store:      store,
+		acl:        acl,
+		prefix:     DefaultUsersPrefix,
+		adminToken: stringValue(config.AdminToken),
+	}
+	if endpoint := stringValue(config.Endpoint); endpoint != "" {
+		m.prefix = endpoint
+	}
+	m.validator = m
+	return m
+}
+
+// WithTokenValidator authorizes the requests to the endpoint by the tokens validated by v
+// (e.g. the validators of all the enabled authentications), instead of by the API keys of the users only.
+func (m *UserManager) WithTokenValidator(v TokenValidator) *UserManager {
+	if v != nil {
+		m.validator = v
+	}
+	return m
+}
+
+// CreateUser creates a user with its roles, and returns it with its API key.
+func (m *UserManager) CreateUser(userID string, roles []string) (*User, error) {
+	if userID == "" || strings.ContainsAny(userID, "/= \t\n") {
+		return nil, ErrInvalidUser
+	}
+	if _, exists, err := m.store.Get(UsersSchema, userID); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, ErrUserExists
+	}
+
+	key := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	apiKey := base64.RawURLEncoding.EncodeToString(key)
+	record := userRecord{KeyHash: hashAPIKey(apiKey), Created: time.Now().Unix()}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.Put(UserKeysSchema, record.KeyHash, []byte(userID)); err != nil {
+		return nil, err
+	}
+	if err := m.store.Put(UsersSchema, userID, data); err != nil {
+		return nil, err
+	}
+	if err := m.putRoles(userID, roles); err != nil {
+		return nil, err
+	}
+	m.reloadACL()
+	logger.WithField("userID", userID).Info("Created the user")
+	return &User{ID: userID, Roles: roles, Created: record.Created, APIKey: apiKey}, nil
+}
+
+// DeleteUser deletes the user, its API key, its roles and the rules of the user.
+func (m *UserManager) DeleteUser(userID string) error {
+	record, err := m.record(userID)
+	if err != nil {
+		return err
+	}
+	if err := m.store.Delete(UserKeysSchema, record.KeyHash); err != nil {
+		return err
+	}
+	if err := m.store.Delete(UsersSchema, userID); err != nil {
+		return err
+	}
+	if err := m.store.Delete(ACLRolesSchema, userID); err != nil {
+		return err
+	}
+	for id, rule := range m.Rules() {
+		if r, err := ParseACLRule(rule); err == nil && r.Subject == subjectUser+userID {
+			if err := m.store.Delete(ACLSchema, id); err != nil {
+				return err
+			}
+		}
+	}
+	m.reloadACL()
+	logger.WithField("userID", userID).Info("Deleted the user")
+	return nil
+}
+
+// SetRoles replaces the roles of the user.
+func (m *UserManager) SetRoles(userID string, roles []string) error {
+	if _, err := m.record(userID); err != nil {
+		return err
+	}
+	if err := m.putRoles(userID, roles); err != nil {
+		return err
+	}
+	m.reloadACL()
+	return nil
+}
+
+func (m *UserManager) putRoles(userID string, roles []string) error {
+	if len(roles) == 0 {
+		return m.store.Delete(ACLRolesSchema, userID)
+	}
+	return m.store.Put(ACLRolesSchema, userID, []byte(strings.Join(roles, ",")))
+}
+
+func (m *UserManager) roles(userID string) []string {
+	value, exists, err := m.store.Get(ACLRolesSchema, userID)
+	if err != nil || !exists || len(value) == 0 {
+		return []string{}
+	}
+	return strings.Split(string(value), ",")
+}
+
+func (m *UserManager) record(userID string) (*userRecord, error) {
+	data, exists, err := m.store.Get(UsersSchema, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUnknownUser
+	}
+	record := &userRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Users returns the users, sorted by their IDs.
+func (m *UserManager) Users() []*User {
+	users := []*User{}
+	for entry := range m.store.Iterate(UsersSchema, "") {
+		record := &userRecord{}
+		if err := json.Unmarshal([]byte(entry[1]), record); err != nil {
+			continue
+		}
+		users = append(users, &User{ID: entry[0], Roles: m.roles(entry[0]), Created: record.Created})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// AddRule adds an ACL rule (in the format of ParseACLRule), and returns its ID.
+func (m *UserManager) AddRule(rule string) (string, error) {
+	if _, err := ParseACLRule(rule); err != nil {
+		return "", err
+	}
+	id := xid.New().String()
+	if err := m.store.Put(ACLSchema, id, []byte(rule)); err != nil {
+		return "", err
+	}
+	m.reloadACL()
+	return id, nil
+}
+
+// DeleteRule deletes the ACL rule of the ID.
+func (m *UserManager) DeleteRule(id string) error {
+	if err := m.store.Delete(ACLSchema, id); err != nil {
+		return err
+	}
+	m.reloadACL()
+	return nil
+}
+
+// Rules returns the ACL rules of the store, by their IDs.
+func (m *UserManager) Rules() map[string]string {
+	rules := make(map[string]string)
+	for entry := range m.store.Iterate(ACLSchema, "") {
+		rules[entry[0]] = entry[1]
+	}
+	return rules
+}
+
+func (m *UserManager) reloadACL() {
+	if m.acl != nil {
+		m.acl.load()
+	}
+}
+
+func hashAPIKey(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(hash[:])
+}
+
+// Validate returns the user of the API key, with its roles.
+// It is an implementation of the TokenValidator interface.
+func (m *UserManager) Validate(token string) (*Claims, error) {
+	userID, exists, err := m.store.Get(UserKeysSchema, hashAPIKey(token))
+	if err != nil {
+		logger.WithError(err).Error("Could not look up the API key")
+		return nil, ErrInvalidToken
+	}
+	if !exists {
+		return nil, ErrUnknownAPIKey
+	}
+	return &Claims{Subject: string(userID), Roles: m.roles(string(userID))}, nil
+}
+
+// authorize returns true if the request has the admin token, or the token of a user with the admin role.
+func (m *UserManager) authorize(r *http.Request) bool {
+	token := TokenFromRequest(r)
+	if token == "" {
+		return false
+	}
+	if m.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(m.adminToken)) == 1 {
+		return true
+	}
+	claims, err := m.validator.Validate(token)
+	if err != nil {
+		return false
+	}
+	roles := append(append([]string{}, claims.Roles...), m.roles(claims.Subject)...)
+	if m.acl != nil {
+		m.acl.mutex.RLock()
+		roles = append(roles, m.acl.userRoles[claims.Subject]...)
+		m.acl.mutex.RUnlock()
+	}
+	return contains(roles, AdminRole)
+}
+
+// GetPrefix returns the prefix of the endpoint.
+func (m *UserManager) GetPrefix() string {
+	return m.prefix
+}
+
+// ServeHTTP manages the users and the rules, for the admins:
+//
+//	GET    <prefix>/users               the users with their roles
+//	POST   <prefix>/users               creates a user {"id":"marvin","roles":["team-a"]}, returned with its API key
+//	PUT    <prefix>/users/<id>/roles    replaces the roles of a user ["team-a","team-b"]
+//	DELETE <prefix>/users/<id>          deletes a user, with its roles and its rules
+//	GET    <prefix>/rules               the rules by their IDs
+//	POST   <prefix>/rules               adds a rule {"rule":"role:team-a publish,subscribe /team-a/**"}, returned with its ID
+//	DELETE <prefix>/rules/<id>          deletes a rule
+func (m *UserManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !m.authorize(r) {
+		logger.WithField("remoteAddr", r.RemoteAddr).Warn("Unauthorized request to the users endpoint")
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, m.prefix), "/"), "/")
+	switch {
+	case parts[0] == "users" && len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, m.Users())
+	case parts[0] == "users" && len(parts) == 1 && r.Method == http.MethodPost:
+		var user User
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		created, err := m.CreateUser(user.ID, user.Roles)
+		if err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	case parts[0] == "users" && len(parts) == 3 && parts[2] == "roles" && r.Method == http.MethodPut:
+		var roles []string
+		if err := json.NewDecoder(r.Body).Decode(&roles); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := m.SetRoles(parts[1], roles); err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case parts[0] == "users" && len(parts) == 2 && r.Method == http.MethodDelete:
+		if err := m.DeleteUser(parts[1]); err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case parts[0] == "rules" && len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, m.Rules())
+	case parts[0] == "rules" && len(parts) == 1 && r.Method == http.MethodPost:
+		var body struct {
+			Rule string `json:"rule"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		id, err := m.AddRule(body.Rule)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id, "rule": body.Rule})
+	case parts[0] == "rules" && len(parts) == 2 && r.Method == http.MethodDelete:
+		if err := m.DeleteRule(parts[1]); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+	}
+}
+
+func errorStatus(err error) int {
+	switch err {
+	case ErrUnknownUser:
+		return http.StatusNotFound
+	case ErrUserExists:
+		return http.StatusConflict
+	case ErrInvalidUser:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.WithError(err).Error("Error encoding data.")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/kvstore"
+)
+
+func TestUserManager(t *testing.T) {
+	a := assert.New(t)
+
+	kvs := kvstore.NewMemoryKVStore()
+	acl, err := NewACLAccessManager(kvs, ACLConfig{})
+	a.NoError(err)
+	a.NoError(acl.Start())
+	defer acl.Stop()
+	m := NewUserManager(kvs, acl, UsersConfig{})
+
+	user, err := m.CreateUser("marvin", []string{"team-a"})
+	a.NoError(err)
+	a.NotEmpty(user.APIKey)
+	_, err = m.CreateUser("marvin", nil)
+	a.Equal(ErrUserExists, err)
+	_, err = m.CreateUser("mar/vin", nil)
+	a.Equal(ErrInvalidUser, err)
+
+	claims, err := m.Validate(user.APIKey)
+	a.NoError(err)
+	a.Equal("marvin", claims.Subject)
+	a.Equal([]string{"team-a"}, claims.Roles)
+	_, err = m.Validate("unknown")
+	a.Equal(ErrUnknownAPIKey, err)
+
+	// the rules and the roles are applied by the ACL without waiting for its reload
+	_, err = m.AddRule("role:team-a publish /team-a/**")
+	a.NoError(err)
+	_, err = m.AddRule("user:marvin subscribe /private")
+	a.NoError(err)
+	a.True(acl.IsAllowed(WRITE, "marvin", protocol.Path("/team-a/news")))
+	a.True(acl.IsAllowed(READ, "marvin", protocol.Path("/private")))
+
+	a.NoError(m.SetRoles("marvin", []string{"team-b"}))
+	a.False(acl.IsAllowed(WRITE, "marvin", protocol.Path("/team-a/news")))
+	a.Equal(ErrUnknownUser, m.SetRoles("arthur", nil))
+
+	// the user is deleted with its API key and its rules
+	a.NoError(m.DeleteUser("marvin"))
+	_, err = m.Validate(user.APIKey)
+	a.Equal(ErrUnknownAPIKey, err)
+	a.False(acl.IsAllowed(READ, "marvin", protocol.Path("/private")))
+	a.Len(m.Rules(), 1)
+	a.Len(m.Users(), 0)
+}
+
+func TestUserManager_ServeHTTP(t *testing.T) {
+	a := assert.New(t)
+
+	token := "secret"
+	m := NewUserManager(kvstore.NewMemoryKVStore(), nil, UsersConfig{AdminToken: &token})
+
+	request := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, DefaultUsersPrefix+path, bytes.NewReader(data))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		return w
+	}
+
+	a.Equal(http.StatusUnauthorized, request(http.MethodGet, "/users", "", nil).Code)
+	a.Equal(http.StatusUnauthorized, request(http.MethodGet, "/users", "invalid", nil).Code)
+
+	w := request(http.MethodPost, "/users", token, User{ID: "zaphod", Roles: []string{AdminRole}})
+	a.Equal(http.StatusCreated, w.Code)
+	var admin User
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &admin))
+
+	// the API key of an admin is accepted
+	a.Equal(http.StatusCreated, request(http.MethodPost, "/users", admin.APIKey, User{ID: "marvin"}).Code)
+	a.Equal(http.StatusConflict, request(http.MethodPost, "/users", admin.APIKey, User{ID: "marvin"}).Code)
+	a.Equal(http.StatusNoContent, request(http.MethodPut, "/users/marvin/roles", admin.APIKey, []string{"team-a"}).Code)
+	a.Equal(http.StatusNotFound, request(http.MethodPut, "/users/arthur/roles", admin.APIKey, []string{"team-a"}).Code)
+
+	w = request(http.MethodGet, "/users", admin.APIKey, nil)
+	a.Equal(http.StatusOK, w.Code)
+	var users []User
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &users))
+	a.Equal([]User{
+		{ID: "marvin", Roles: []string{"team-a"}, Created: users[0].Created},
+		{ID: "zaphod", Roles: []string{AdminRole}, Created: users[1].Created},
+	}, users)
+
+	a.Equal(http.StatusBadRequest, request(http.MethodPost, "/rules", token, map[string]string{"rule": "invalid"}).Code)
+	w = request(http.MethodPost, "/rules", token, map[string]string{"rule": "role:team-a publish /team-a/**"})
+	a.Equal(http.StatusCreated, w.Code)
+	var rule map[string]string
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &rule))
+	a.Equal(http.StatusNoContent, request(http.MethodDelete, "/rules/"+rule["id"], token, nil).Code)
+	a.Equal(http.StatusNoContent, request(http.MethodDelete, "/users/marvin", token, nil).Code)
+	a.Equal(http.StatusNotFound, request(http.MethodDelete, "/users/marvin", token, nil).Code)
+
+	// the users without the admin role are not allowed
+	w = request(http.MethodPost, "/users", token, User{ID: "arthur"})
+	var arthur User
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &arthur))
+	a.Equal(http.StatusUnauthorized, request(http.MethodGet, "/users", arthur.APIKey, nil).Code)
+}
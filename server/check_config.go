@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/smancke/guble/server/cluster"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/webserver"
+)
+
+// requiredOption is an option which has to be set when its connector is enabled.
+type requiredOption struct {
+	flag  string
+	value *string
+}
+
+// runCheckConfig validates the configuration without starting the server, and prints the errors found.
+// It returns the exit status of `gubled check-config`: 0 if the configuration is valid, 1 otherwise.
+func runCheckConfig(w io.Writer) int {
+	errs := checkConfig()
+	if len(errs) == 0 {
+		fmt.Fprintln(w, "The configuration is valid.")
+		return 0
+	}
+	fmt.Fprintf(w, "The configuration has %d error(s):\n", len(errs))
+	for _, err := range errs {
+		fmt.Fprintf(w, "  - %v\n", err)
+	}
+	return 1
+}
+
+// checkConfig returns the errors of the configuration which would prevent the server from starting or from working:
+// the secrets, the storage, the web server, the credentials of the enabled connectors and the cluster settings.
+func checkConfig() (errs []error) {
+	if err := resolveSecrets(); err != nil {
+		errs = append(errs, fmt.Errorf("the secrets can not be resolved: %v", err))
+	}
+	errs = append(errs, storageErrors()...)
+	errs = append(errs, webServerErrors()...)
+	errs = append(errs, moduleErrors()...)
+	errs = append(errs, connectorErrors()...)
+	errs = append(errs, clusterErrors()...)
+	return errs
+}
+
+func storageErrors() (errs []error) {
+	switch *Config.KVS {
+	case "memory", "file", "postgres":
+	default:
+		errs = append(errs, fmt.Errorf("--kvs %q is not a key-value backend: use file, memory or postgres", *Config.KVS))
+	}
+	switch *Config.MS {
+	case "none", "memory", "", "file":
+	default:
+		errs = append(errs, fmt.Errorf("--ms %q is not a message-store backend: use file or memory", *Config.MS))
+	}
+	if err := ValidateStoragePath(); err != nil {
+		errs = append(errs, fmt.Errorf("--storage-path %s has to be a writable directory: %v", *Config.StoragePath, err))
+	}
+	return errs
+}
+
+func webServerErrors() (errs []error) {
+	if _, err := webserver.NewTLSConfig(Config.TLS); err != nil {
+		errs = append(errs, fmt.Errorf("the TLS configuration is invalid: %v", err))
+	}
+	for _, definition := range *Config.Listeners {
+		if _, err := webserver.ParseListener(definition); err != nil {
+			errs = append(errs, fmt.Errorf("--listener: %v", err))
+		}
+	}
+	return errs
+}
+
+func moduleErrors() (errs []error) {
+	for _, disabled := range *Config.DisabledModules {
+		known := disabled == clusterModule || disabled == metricsModule
+		for _, f := range moduleFactories {
+			known = known || f.name == disabled
+		}
+		if !known {
+			errs = append(errs, fmt.Errorf("--disable-module %q is not a module", disabled))
+		}
+	}
+	if _, err := connector.ParsePayloadTemplates(*Config.Connector.Templates); err != nil {
+		errs = append(errs, fmt.Errorf("invalid payload template: %v", err))
+	}
+	return errs
+}
+
+// connectorErrors returns the missing credentials of the enabled connectors.
+func connectorErrors() (errs []error) {
+	connectors := []struct {
+		name     string
+		enabled  *bool
+		required []requiredOption
+	}{
+		{"fcm", Config.FCM.Enabled, []requiredOption{{"fcm-api-key", Config.FCM.APIKey}}},
+		{"sms", Config.SMS.Enabled, []requiredOption{{"sms-api-key", Config.SMS.APIKey}, {"sms-api-secret", Config.SMS.APISecret}}},
+		{"federation", Config.Federation.Enabled, []requiredOption{{"federation-name", Config.Federation.Name}, {"federation-token", Config.Federation.Token}}},
+		{"slack", Config.Slack.Enabled, []requiredOption{{"slack-webhook-url", Config.Slack.WebhookURL}}},
+		{"wns", Config.WNS.Enabled, []requiredOption{{"wns-client-id", Config.WNS.ClientID}, {"wns-client-secret", Config.WNS.ClientSecret}}},
+		{"hms", Config.HMS.Enabled, []requiredOption{{"hms-app-id", Config.HMS.AppID}, {"hms-app-secret", Config.HMS.AppSecret}}},
+		{"telegram", Config.Telegram.Enabled, []requiredOption{{"telegram-bot-token", Config.Telegram.BotToken}}},
+		{"sns", Config.SNS.Enabled, []requiredOption{{"sns-region", Config.SNS.Region}}},
+		{"pubsub", Config.PubSub.Enabled, []requiredOption{{"pubsub-project", Config.PubSub.Project}}},
+		{"xmpp", Config.XMPP.Enabled, []requiredOption{{"xmpp-domain", Config.XMPP.Domain}, {"xmpp-secret", Config.XMPP.Secret}}},
+	}
+	for _, c := range connectors {
+		if !*c.enabled || moduleDisabled(c.name) {
+			continue
+		}
+		for _, option := range c.required {
+			if *option.value == "" {
+				errs = append(errs, fmt.Errorf("--%s is required by --%s", option.flag, c.name))
+			}
+		}
+	}
+
+	if *Config.APNS.Enabled && !moduleDisabled("apns") {
+		if *Config.APNS.CertificateFileName == "" && len(*Config.APNS.CertificateBytes) == 0 {
+			errs = append(errs, errors.New("--apns-cert-file or --apns-cert-bytes is required by --apns"))
+		}
+		if *Config.APNS.CertificateFileName != "" {
+			if _, err := os.Stat(*Config.APNS.CertificateFileName); err != nil {
+				errs = append(errs, fmt.Errorf("--apns-cert-file can not be read: %v", err))
+			}
+		}
+		if *Config.APNS.CertificatePassword == "" {
+			errs = append(errs, errors.New("--apns-cert-password is required by --apns"))
+		}
+	}
+	if *Config.PubSub.Enabled && *Config.PubSub.CredentialsFile != "" {
+		if _, err := os.Stat(*Config.PubSub.CredentialsFile); err != nil {
+			errs = append(errs, fmt.Errorf("--pubsub-credentials-file can not be read: %v", err))
+		}
+	}
+	return errs
+}
+
+// clusterErrors returns the errors of the cluster settings, if the node is started in cluster mode.
+func clusterErrors() (errs []error) {
+	if moduleDisabled(clusterModule) || (*Config.Cluster.NodeID == 0 && len(*Config.Cluster.Remotes) == 0) {
+		return nil
+	}
+	if *Config.Cluster.NodeID == 0 {
+		errs = append(errs, errors.New("--node-id is required by --remotes: a strictly positive integer, unique in the cluster"))
+	}
+	if *Config.Cluster.NodePort <= 0 {
+		errs = append(errs, fmt.Errorf("--node-port %d has to be a strictly positive port number", *Config.Cluster.NodePort))
+	}
+	if *Config.Cluster.SecretKey != "" {
+		key, err := base64.StdEncoding.DecodeString(*Config.Cluster.SecretKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("--cluster-secret-key is not base64-encoded: %v", err))
+		} else if l := len(key); l != 16 && l != 24 && l != 32 {
+			errs = append(errs, fmt.Errorf("--cluster-secret-key has %d bytes: use an AES key of 16, 24 or 32 bytes", l))
+		}
+	}
+	if *Config.Cluster.Sequencer && *Config.Cluster.Size <= 0 {
+		errs = append(errs, errors.New("--cluster-size is required by --cluster-sequencer, for computing the majority acknowledging the reserved IDs"))
+	}
+	if *Config.Cluster.DiscoveryKubernetes != "" {
+		if _, err := cluster.NewKubernetesDiscovery(*Config.Cluster.DiscoveryKubernetes, *Config.Cluster.NodePort); err != nil {
+			errs = append(errs, fmt.Errorf("--cluster-discovery-kubernetes: %v", err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConfig(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guble_check_config_test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	*Config.KVS = "memory"
+	*Config.MS = "file"
+	*Config.StoragePath = dir
+	*Config.FCM.Enabled = true
+	*Config.FCM.APIKey = "xyz"
+	defer func() {
+		*Config.FCM.Enabled = false
+		*Config.FCM.APIKey = ""
+	}()
+
+	// given a valid configuration
+	buff := &bytes.Buffer{}
+	a.Equal(0, runCheckConfig(buff))
+	a.Equal("The configuration is valid.\n", buff.String())
+
+	// when it has errors
+	*Config.StoragePath = "/does/not/exist"
+	*Config.FCM.APIKey = ""
+	*Config.Listeners = []string{"unix:/run/guble.sock?tls=true"}
+	*Config.DisabledModules = []string{"fmc"}
+	*Config.Cluster.Remotes = tcpAddrList{&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 10000}}
+	*Config.Cluster.NodePort = 10000
+	*Config.Cluster.SecretKey = "c2VjcmV0"
+	*Config.Cluster.Sequencer = true
+	defer func() {
+		*Config.StoragePath = ""
+		*Config.Listeners = nil
+		*Config.DisabledModules = nil
+		*Config.Cluster.Remotes = nil
+		*Config.Cluster.SecretKey = ""
+		*Config.Cluster.Sequencer = false
+	}()
+
+	// then all of them are reported, with the options to fix
+	buff.Reset()
+	a.Equal(1, runCheckConfig(buff))
+	a.Contains(buff.String(), "The configuration has 7 error(s):\n")
+	a.Contains(buff.String(), "  - --storage-path /does/not/exist has to be a writable directory: ")
+	a.Contains(buff.String(), "  - --listener: Invalid listener \"unix:/run/guble.sock?tls=true\": TLS is only supported on TCP listeners\n")
+	a.Contains(buff.String(), "  - --disable-module \"fmc\" is not a module\n")
+	a.Contains(buff.String(), "  - --fcm-api-key is required by --fcm\n")
+	a.Contains(buff.String(), "  - --node-id is required by --remotes: a strictly positive integer, unique in the cluster\n")
+	a.Contains(buff.String(), "  - --cluster-secret-key has 6 bytes: use an AES key of 16, 24 or 32 bytes\n")
+	a.Contains(buff.String(), "  - --cluster-size is required by --cluster-sequencer, for computing the majority acknowledging the reserved IDs\n")
+}
+
+func TestCheckConfig_ConnectorCredentials(t *testing.T) {
+	a := assert.New(t)
+
+	*Config.KVS = "memory"
+	*Config.MS = "memory"
+	*Config.APNS.Enabled = true
+	*Config.APNS.CertificateFileName = "/does/not/exist.p12"
+	*Config.Telegram.Enabled = true
+	*Config.XMPP.Enabled = true
+	*Config.XMPP.Domain = "guble.example.com"
+	*Config.XMPP.Secret = "secret"
+	defer func() {
+		*Config.APNS.Enabled = false
+		*Config.APNS.CertificateFileName = ""
+		*Config.Telegram.Enabled = false
+		*Config.XMPP.Enabled = false
+		*Config.XMPP.Domain = ""
+		*Config.XMPP.Secret = ""
+	}()
+
+	errs := connectorErrors()
+	a.Len(errs, 3)
+	a.Contains(errs[0].Error(), "--telegram-bot-token is required by --telegram")
+	a.Contains(errs[1].Error(), "--apns-cert-file can not be read: ")
+	a.Contains(errs[2].Error(), "--apns-cert-password is required by --apns")
+
+	// the disabled modules are not checked
+	*Config.DisabledModules = []string{"apns", "telegram"}
+	defer func() { *Config.DisabledModules = nil }()
+	a.Empty(connectorErrors())
+}
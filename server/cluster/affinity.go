@@ -0,0 +1,18 @@
+package cluster
+
+// userKeyPrefix distinguishes the users from the partitions on the hash ring.
+const userKeyPrefix = "user:"
+
+// HomeNode returns the ID of the home node of the user, and the HTTP address advertised by that node
+// (empty if it is not known). The users are assigned to the nodes by consistent hashing, like the partitions,
+// so that only the users of a joining or leaving node get another home node.
+func (cluster *Cluster) HomeNode(userID string) (uint8, string) {
+	id := cluster.Owner(userKeyPrefix + userID)
+	if id == cluster.Config.ID {
+		return id, cluster.Config.HTTPAddress
+	}
+	if node := cluster.GetNodeByID(id); node != nil {
+		return id, string(node.Meta)
+	}
+	return id, ""
+}
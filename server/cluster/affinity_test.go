@@ -0,0 +1,37 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCluster_HomeNode(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	conf.UserAffinity = true
+	conf.HTTPAddress = "10.0.0.1:8080"
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	a.Equal([]byte("10.0.0.1:8080"), node.NodeMeta(512))
+	a.Nil(node.NodeMeta(4))
+
+	// a node alone is the home node of all the users
+	id, address := node.HomeNode("marvin")
+	a.Equal(conf.ID, id)
+	a.Equal("10.0.0.1:8080", address)
+}
+
+func TestHashRing_UsersAreSpreadAcrossNodes(t *testing.T) {
+	a := assert.New(t)
+
+	ring := newHashRing([]uint8{1, 2, 3})
+	homes := make(map[uint8]int)
+	for _, user := range []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi", "ivan", "judy"} {
+		homes[ring.owner(userKeyPrefix+user)]++
+	}
+	a.Len(homes, 3)
+}
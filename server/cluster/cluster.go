@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 
 	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/kvstore"
 	"github.com/smancke/guble/server/store"
 
 	log "github.com/Sirupsen/logrus"
@@ -12,11 +13,16 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 )
 
 var (
 	ErrNodeNotFound = errors.New("Node not found.")
+
+	ErrInvalidSecretKey = errors.New("Cluster secret key should have 16, 24 or 32 bytes")
 )
 
 // Config is a struct used by the local node when creating and running the guble cluster
@@ -26,6 +32,58 @@ type Config struct {
 	Port                 int
 	Remotes              []*net.TCPAddr
 	HealthScoreThreshold int
+
+	// Sequencer enables the assignment of message IDs by the cluster leader,
+	// making them strictly increasing per partition across the cluster.
+	Sequencer bool
+
+	// Partitioning assigns each partition to an owner node by consistent hashing.
+	// Messages are forwarded to the owner of their partition, which is the only node storing them.
+	Partitioning bool
+
+	// Replicas is the number of nodes storing a copy of each partition in addition to its owner, when partitioning is enabled.
+	// The messages are replicated asynchronously, and fetched from a replica if the owner is not available.
+	Replicas int
+
+	// Discovery finds the other nodes of the cluster, in addition to the Remotes;
+	// the discovered nodes are joined again every DiscoveryInterval.
+	Discovery         Discovery
+	DiscoveryInterval time.Duration
+
+	// SecretKey enables the encryption of all the cluster traffic with this AES key (16, 24 or 32 bytes).
+	// It covers the gossip as well as the messages sent between the nodes, which are also authenticated:
+	// a node not having the same key can not join the cluster.
+	SecretKey []byte
+
+	// SplitBrainPolicy is applied when the cluster is split by a network partition, instead of letting both sides
+	// accept messages with diverging IDs. Size is the expected number of nodes, for computing the majority;
+	// if not set, it is the number of nodes seen since this node started.
+	SplitBrainPolicy SplitBrainPolicy
+	Size             int
+
+	// SubscriptionRegistry lets the nodes know the topics subscribed on each other, so that a message is sent
+	// only to its storage nodes and to the nodes having subscribers for it; it requires Partitioning.
+	SubscriptionRegistry bool
+
+	// UserAffinity pins the websocket connections of each user to a home node: the clients connecting to another node
+	// are redirected to the HTTPAddress (host:port) advertised by the home node.
+	UserAffinity bool
+	HTTPAddress  string
+
+	// Snapshot lets a node joining the cluster transfer the state of another node before serving:
+	// the entries of the SnapshotSchemas of the KVStore (e.g. the subscriptions of the connectors),
+	// and the last SnapshotMessages messages of each partition.
+	Snapshot         bool
+	SnapshotSchemas  []string
+	SnapshotMessages int
+
+	// PeerQueueSize is the number of messages waiting to be sent to a node: when a node is too slow,
+	// the messages exceeding it are dropped instead of being buffered by all the other nodes.
+	PeerQueueSize int
+
+	// Protobuf sends the guble messages to the other nodes in the protobuf encoding instead of the text one.
+	// The nodes decode both, so it can be enabled once all the nodes support it.
+	Protobuf bool
 }
 
 // router interface specify only the methods we require in cluster from the Router
@@ -34,6 +92,7 @@ type Config struct {
 type router interface {
 	HandleMessage(message *protocol.Message) error
 	MessageStore() (store.MessageStore, error)
+	KVStore() (kvstore.KVStore, error)
 }
 
 // Cluster is a struct for managing the `local view` of the guble cluster, as seen by a node.
@@ -45,6 +104,10 @@ type Cluster struct {
 	// Should be set after the node is created with New(), and before Start().
 	Router router
 
+	// RateUsageHandler (if any) receives the usage of the rate limits shared by the other nodes.
+	// Should be set before Start().
+	RateUsageHandler RateUsageHandler
+
 	name       string
 	memberlist *memberlist.Memberlist
 	broadcasts [][]byte
@@ -54,20 +117,61 @@ type Cluster struct {
 	numUpdates int
 
 	synchronizer *synchronizer
+	sequencer    *sequencer
+	fetcher      *remoteFetcher
+	snapshots    *snapshotTransfer
+	dedup        *deduplicator
+	registry     *subscriptionRegistry
+
+	ring      *hashRing
+	ringMutex sync.Mutex
+
+	queues      map[string]*peerQueue
+	queuesMutex sync.Mutex
+
+	discoveryStopC chan struct{}
+	left           int32 // set when this node left the cluster at runtime
+
+	listeners      []func()
+	listenersMutex sync.Mutex
+
+	stats       statistics
+	statusStopC chan struct{}
+
+	knownNodes map[uint8]bool
+	hadQuorum  bool
+	knownMutex sync.Mutex
 }
 
 //New returns a new instance of the cluster, created using the given Config.
 func New(config *Config) (*Cluster, error) {
 	c := &Cluster{
-		Config: config,
-		name:   fmt.Sprintf("%d", config.ID),
+		Config:    config,
+		name:      fmt.Sprintf("%d", config.ID),
+		hadQuorum: true,
 	}
+	c.fetcher = newRemoteFetcher(c)
+	c.snapshots = newSnapshotTransfer(c)
+	c.dedup = newDeduplicator(dedupCapacity)
+	c.registry = newSubscriptionRegistry()
 
 	memberlistConfig := memberlist.DefaultLANConfig()
 	memberlistConfig.Name = c.name
 	memberlistConfig.BindAddr = config.Host
 	memberlistConfig.BindPort = config.Port
 
+	if len(config.SecretKey) > 0 {
+		switch len(config.SecretKey) {
+		case 16, 24, 32:
+		default:
+			logger.WithField("length", len(config.SecretKey)).Error("Invalid cluster secret key")
+			return nil, ErrInvalidSecretKey
+		}
+		memberlistConfig.SecretKey = config.SecretKey
+		memberlistConfig.GossipVerifyIncoming = true
+		memberlistConfig.GossipVerifyOutgoing = true
+	}
+
 	//TODO Cosmin temporarily disabling any logging from memberlist, we might want to enable it again using logrus?
 	memberlistConfig.LogOutput = ioutil.Discard
 
@@ -93,6 +197,7 @@ func (cluster *Cluster) Start() error {
 		logger.Error(errorMessage)
 		return errors.New(errorMessage)
 	}
+	resetClusterMetrics()
 
 	synchronizer, err := newSynchronizer(cluster)
 	if err != nil {
@@ -101,6 +206,38 @@ func (cluster *Cluster) Start() error {
 	}
 	cluster.synchronizer = synchronizer
 
+	if cluster.Config.Sequencer {
+		sequencer, err := newSequencer(cluster)
+		if err != nil {
+			logger.WithError(err).Error("Error creating cluster sequencer")
+			return err
+		}
+		cluster.sequencer = sequencer
+	}
+
+	cluster.statusStopC = make(chan struct{})
+	go cluster.pingLoop()
+
+	if cluster.Config.Discovery != nil {
+		// the first node has nobody to join: the cluster is formed (and healed) by the discovery loop
+		if remotes := cluster.discover(); len(remotes) > 0 {
+			if _, err := cluster.memberlist.Join(remotes); err != nil {
+				logger.WithField("error", err).Warn("Could not join any of the discovered cluster nodes")
+			}
+		}
+		if cluster.Config.DiscoveryInterval <= 0 {
+			cluster.Config.DiscoveryInterval = DefaultDiscoveryInterval
+		}
+		cluster.discoveryStopC = make(chan struct{})
+		go cluster.discoveryLoop()
+
+		if cluster.Config.Snapshot {
+			cluster.transferSnapshot()
+		}
+		logger.Debug("Started Cluster")
+		return nil
+	}
+
 	num, err := cluster.memberlist.Join(cluster.remotesAsStrings())
 	if err != nil {
 		logger.WithField("error", err).Error("Error when this node wanted to join the cluster")
@@ -112,6 +249,10 @@ func (cluster *Cluster) Start() error {
 		return errors.New(errorMessage)
 	}
 
+	if cluster.Config.Snapshot {
+		// a failed transfer is logged: the node serves anyway, and its partitions are synchronized later
+		cluster.transferSnapshot()
+	}
 	logger.Debug("Started Cluster")
 
 	return nil
@@ -122,6 +263,13 @@ func (cluster *Cluster) Stop() error {
 	if cluster.synchronizer != nil {
 		close(cluster.synchronizer.stopC)
 	}
+	if cluster.discoveryStopC != nil {
+		close(cluster.discoveryStopC)
+	}
+	if cluster.statusStopC != nil {
+		close(cluster.statusStopC)
+	}
+	cluster.stopPeerQueues()
 	return cluster.memberlist.Shutdown()
 }
 
@@ -135,6 +283,113 @@ func (cluster *Cluster) Check() error {
 	return nil
 }
 
+// NextMessageID returns the next message ID of the partition, assigned by the sequencer leader of the cluster.
+// It returns ErrSequencerDisabled if the cluster was not configured to use a sequencer.
+func (cluster *Cluster) NextMessageID(partition string) (uint64, error) {
+	if cluster.sequencer == nil {
+		return 0, ErrSequencerDisabled
+	}
+	return cluster.sequencer.nextID(partition)
+}
+
+// Owner returns the ID of the node owning the partition, when partitioning is enabled.
+// The partitions of a node leaving the cluster are taken over by the remaining nodes.
+func (cluster *Cluster) Owner(partition string) uint8 {
+	return cluster.StorageNodes(partition)[0]
+}
+
+// StorageNodes returns the IDs of the nodes storing the partition, when partitioning is enabled:
+// its owner followed by its replicas. The first replica takes over the partition when the owner leaves.
+func (cluster *Cluster) StorageNodes(partition string) []uint8 {
+	ids := cluster.memberIDs()
+	if len(ids) == 0 {
+		return []uint8{cluster.Config.ID}
+	}
+
+	cluster.ringMutex.Lock()
+	defer cluster.ringMutex.Unlock()
+
+	if cluster.ring == nil || !cluster.ring.hasNodes(ids) {
+		logger.WithField("nodes", ids).Debug("Rebuilding the partitions hash ring")
+		cluster.ring = newHashRing(ids)
+	}
+	return cluster.ring.nodesFor(partition, 1+cluster.Config.Replicas)
+}
+
+// OwnsKey returns true if this node is the owner of the key, among the live members of the cluster.
+// It is used for distributing work (e.g. the subscriptions of the connectors) across the nodes.
+func (cluster *Cluster) OwnsKey(key string) bool {
+	return cluster.Owner(key) == cluster.Config.ID
+}
+
+// AddMembershipListener registers a function called (asynchronously) when a node joins or leaves the cluster.
+func (cluster *Cluster) AddMembershipListener(listener func()) {
+	cluster.listenersMutex.Lock()
+	defer cluster.listenersMutex.Unlock()
+	cluster.listeners = append(cluster.listeners, listener)
+}
+
+func (cluster *Cluster) notifyMembershipListeners() {
+	cluster.listenersMutex.Lock()
+	defer cluster.listenersMutex.Unlock()
+	for _, listener := range cluster.listeners {
+		go listener()
+	}
+}
+
+// IsStorageNode returns true if this node is the owner or a replica of the partition.
+func (cluster *Cluster) IsStorageNode(partition string) bool {
+	return containsNode(cluster.StorageNodes(partition), cluster.Config.ID)
+}
+
+// ForwardMessage sends a guble-protocol-message received by this node to the owner of its partition.
+func (cluster *Cluster) ForwardMessage(nodeID uint8, pMessage *protocol.Message) error {
+	logger.WithFields(log.Fields{
+		"to":   nodeID,
+		"path": pMessage.Path,
+	}).Debug("ForwardMessage")
+	return cluster.sendMessageToNodeID(nodeID, cluster.newMessage(mtForwardMessage, cluster.encodeMessage(pMessage)))
+}
+
+// encodeMessage returns the guble message in the encoding of the messages sent to the other nodes.
+func (cluster *Cluster) encodeMessage(pMessage *protocol.Message) []byte {
+	if cluster.Config.Protobuf {
+		return pMessage.MarshalProto()
+	}
+	return pMessage.Bytes()
+}
+
+// decodeMessage parses a guble message sent by another node, in the text or in the protobuf encoding.
+func decodeMessage(data []byte) (*protocol.Message, error) {
+	if protocol.IsProto(data) {
+		return protocol.ParseProtoMessage(data)
+	}
+	return protocol.ParseMessage(data)
+}
+
+// memberIDs returns the sorted IDs of the live members of the cluster.
+func (cluster *Cluster) memberIDs() []uint8 {
+	var ids []uint8
+	for _, node := range cluster.memberlist.Members() {
+		id, err := strconv.ParseUint(node.Name, 10, 8)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint8(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// parseNodeID returns the ID of a member of the cluster, and false if its name is not a node ID.
+func parseNodeID(node *memberlist.Node) (uint8, bool) {
+	id, err := strconv.ParseUint(node.Name, 10, 8)
+	if err != nil {
+		return 0, false
+	}
+	return uint8(id), true
+}
+
 // newMessage returns a *message to be used in broadcasting or sending to a node
 func (cluster *Cluster) newMessage(t messageType, body []byte) *message {
 	return &message{
@@ -165,16 +420,30 @@ func (cluster *Cluster) BroadcastString(sMessage *string) error {
 
 // BroadcastMessage broadcasts a guble-protocol-message to all the other nodes in the guble cluster.
 func (cluster *Cluster) BroadcastMessage(pMessage *protocol.Message) error {
-	logger.WithField("message", pMessage).Debug("BroadcastMessage")
+	logger.WithFields(pMessage.LogFields()).Debug("BroadcastMessage")
 	cMessage := &message{
 		NodeID: cluster.Config.ID,
 		Type:   mtGubleMessage,
-		Body:   pMessage.Bytes(),
+		Body:   cluster.encodeMessage(pMessage),
 	}
-	return cluster.broadcastClusterMessage(cMessage)
+	if !cluster.registryEnabled() {
+		return cluster.broadcastClusterMessage(cMessage)
+	}
+
+	// only the nodes storing the message or having subscribers for it need it
+	storageNodes := cluster.StorageNodes(pMessage.Path.Partition())
+	return cluster.broadcastClusterMessageTo(cMessage, func(node *memberlist.Node) bool {
+		id, ok := parseNodeID(node)
+		return !ok || containsNode(storageNodes, id) || cluster.interested(node, pMessage.Path)
+	})
 }
 
 func (cluster *Cluster) broadcastClusterMessage(cMessage *message) error {
+	return cluster.broadcastClusterMessageTo(cMessage, func(*memberlist.Node) bool { return true })
+}
+
+// broadcastClusterMessageTo sends the message to the other nodes accepted by the filter.
+func (cluster *Cluster) broadcastClusterMessageTo(cMessage *message, filter func(*memberlist.Node) bool) error {
 	if cMessage == nil {
 		errorMessage := "Could not broadcast a nil cluster-message"
 		logger.Error(errorMessage)
@@ -188,10 +457,10 @@ func (cluster *Cluster) broadcastClusterMessage(cMessage *message) error {
 	}
 
 	for _, node := range cluster.memberlist.Members() {
-		if cluster.name == node.Name {
+		if cluster.name == node.Name || !filter(node) {
 			continue
 		}
-		go cluster.sendToNode(node, cMessageBytes)
+		cluster.enqueue(node, cMessageBytes)
 	}
 	return nil
 }
@@ -201,6 +470,7 @@ func (cluster *Cluster) sendToNode(node *memberlist.Node, msgBytes []byte) error
 		"node": cluster.Config.ID,
 		"to":   node.Name,
 	}).Debug("Sending cluster-message to a node")
+	defer cluster.sending(node)()
 
 	err := cluster.memberlist.SendToTCP(node, msgBytes)
 	if err != nil {
@@ -224,6 +494,7 @@ func (cluster *Cluster) sendMessageToNode(node *memberlist.Node, cmsg *message)
 		return err
 	}
 
+	defer cluster.sending(node)()
 	if err = cluster.memberlist.SendToTCP(node, bytes); err != nil {
 		logger.WithField("node", node.Name).WithError(err).Error("Error send message to node")
 		return err
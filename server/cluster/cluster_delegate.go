@@ -2,8 +2,6 @@ package cluster
 
 import (
 	log "github.com/Sirupsen/logrus"
-
-	"github.com/smancke/guble/protocol"
 )
 
 // ======================================================
@@ -26,6 +24,7 @@ func (cluster *Cluster) NotifyMsg(data []byte) {
 		"senderNodeID": cmsg.NodeID,
 		"type":         cmsg.Type,
 	}).Debug("NotifyMsg: Received cluster message")
+	cluster.seen(cmsg)
 
 	switch cmsg.Type {
 	case mtGubleMessage:
@@ -37,6 +36,36 @@ func (cluster *Cluster) NotifyMsg(data []byte) {
 	case mtSyncMessageRequest:
 		// cluster node is requesting to receive messages for sync
 		cluster.handleSyncMessageRequest(cmsg)
+	case mtForwardMessage:
+		cluster.handleGubleMessage(cmsg)
+	case mtPing:
+		go cluster.handlePing(cmsg)
+	case mtPong:
+		cluster.handlePong(cmsg)
+	case mtLeave:
+		go cluster.handleLeave(cmsg)
+	case mtSubscriptions:
+		cluster.handleSubscriptions(cmsg)
+	case mtFetchRequest:
+		go cluster.handleFetchRequest(cmsg)
+	case mtFetchResponse:
+		cluster.handleFetchResponse(cmsg)
+	case mtSnapshotRequest:
+		go cluster.handleSnapshotRequest(cmsg)
+	case mtSnapshotChunk:
+		cluster.handleSnapshotChunk(cmsg)
+	case mtLoad:
+		cluster.handleLoad(cmsg)
+	case mtRateUsage:
+		cluster.handleRateUsage(cmsg)
+	case mtSequenceRequest:
+		go cluster.handleSequenceRequest(cmsg)
+	case mtSequenceResponse:
+		cluster.handleSequenceResponse(cmsg)
+	case mtSequenceReserve:
+		go cluster.handleSequenceReserve(cmsg)
+	case mtSequenceReserveAck:
+		cluster.handleSequenceReserveAck(cmsg)
 	}
 }
 
@@ -46,22 +75,38 @@ func (cluster *Cluster) GetBroadcasts(overhead, limit int) [][]byte {
 	return b
 }
 
-func (cluster *Cluster) NodeMeta(limit int) []byte { return nil }
+// NodeMeta returns the HTTP address of this node, advertised to the other nodes.
+func (cluster *Cluster) NodeMeta(limit int) []byte {
+	if len(cluster.Config.HTTPAddress) > limit {
+		logger.WithField("address", cluster.Config.HTTPAddress).Error("HTTP address is too long to be advertised")
+		return nil
+	}
+	return []byte(cluster.Config.HTTPAddress)
+}
 
 func (cluster *Cluster) LocalState(join bool) []byte { return nil }
 
 func (cluster *Cluster) MergeRemoteState(s []byte, join bool) {}
 
-// handles message received with type `mtGubleMessage`
+// handles message received with type `mtGubleMessage` or `mtForwardMessage`
 func (cluster *Cluster) handleGubleMessage(cmsg *message) {
 	if cluster.Router == nil {
 		return
 	}
-	message, err := protocol.ParseMessage(cmsg.Body)
+	message, err := decodeMessage(cmsg.Body)
 	if err != nil {
 		logger.WithField("err", err).Error("Parsing of guble-message contained in cluster-message failed")
 		return
 	}
+	cluster.seenMessageID(cmsg.NodeID, message.ID)
+	// a message forwarded to the owner of its partition is not sequenced yet: it has no origin node
+	if message.NodeID != 0 && cluster.dedup.isDuplicate(message.NodeID, message.Path.Partition(), message.ID) {
+		logger.WithFields(log.Fields{
+			"nodeID": message.NodeID,
+			"id":     message.ID,
+		}).Debug("Dropping duplicate message")
+		return
+	}
 	cluster.Router.HandleMessage(message)
 }
 
@@ -102,3 +147,63 @@ func (cluster *Cluster) handleSyncMessageRequest(cmsg *message) {
 		logger.WithError(err).Error("Error send synchronization messages")
 	}
 }
+
+func (cluster *Cluster) handleSequenceRequest(cmsg *message) {
+	if cluster.sequencer == nil {
+		return
+	}
+	if err := cluster.sequencer.handleRequest(cmsg.NodeID, cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error handling sequencer request")
+	}
+}
+
+func (cluster *Cluster) handleSequenceResponse(cmsg *message) {
+	if cluster.sequencer == nil {
+		return
+	}
+	if err := cluster.sequencer.handleResponse(cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error handling sequencer response")
+	}
+}
+
+func (cluster *Cluster) handleSequenceReserve(cmsg *message) {
+	if cluster.sequencer == nil {
+		return
+	}
+	if err := cluster.sequencer.handleReservation(cmsg.NodeID, cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error handling sequencer reservation")
+	}
+}
+
+func (cluster *Cluster) handleSequenceReserveAck(cmsg *message) {
+	if cluster.sequencer == nil {
+		return
+	}
+	if err := cluster.sequencer.handleReservationAck(cmsg.NodeID, cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error handling sequencer reservation acknowledgement")
+	}
+}
+
+func (cluster *Cluster) handleFetchRequest(cmsg *message) {
+	if err := cluster.fetcher.handleRequest(cmsg.NodeID, cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error handling fetch request")
+	}
+}
+
+func (cluster *Cluster) handleSnapshotRequest(cmsg *message) {
+	if err := cluster.snapshots.handleRequest(cmsg.NodeID, cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error handling snapshot request")
+	}
+}
+
+func (cluster *Cluster) handleSnapshotChunk(cmsg *message) {
+	if err := cluster.snapshots.handleChunk(cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error handling snapshot chunk")
+	}
+}
+
+func (cluster *Cluster) handleFetchResponse(cmsg *message) {
+	if err := cluster.fetcher.handleResponse(cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error handling fetch response")
+	}
+}
@@ -14,12 +14,20 @@ func (cluster *Cluster) NotifyJoin(node *memberlist.Node) {
 	cluster.numJoins++
 	cluster.eventLog(node, "Cluster Node Join")
 
+	cluster.checkSplitBrain(node, cluster.trackJoin(node))
 	cluster.sendPartitions(node)
+	cluster.sendSubscriptions(node)
+	cluster.notifyMembershipListeners()
 }
 
 func (cluster *Cluster) NotifyLeave(node *memberlist.Node) {
 	cluster.numLeaves++
 	cluster.eventLog(node, "Cluster Node Leave")
+	cluster.checkSplitBrain(node, false)
+	cluster.forgetSubscriptions(node)
+	cluster.forgetLoad(node)
+	cluster.stopPeerQueue(node.Name)
+	cluster.notifyMembershipListeners()
 }
 
 func (cluster *Cluster) NotifyUpdate(node *memberlist.Node) {
@@ -37,6 +45,11 @@ func (cluster *Cluster) eventLog(node *memberlist.Node, message string) {
 }
 
 func (cluster *Cluster) sendPartitions(node *memberlist.Node) {
+	if cluster.Config.Partitioning {
+		// each partition is stored only by its owner: there is nothing to synchronize
+		return
+	}
+
 	if _, inSync := cluster.synchronizer.inSync(node.Name); inSync {
 		logger.WithField("node", node.Name).Debug("Already in sync with node")
 		return
@@ -0,0 +1,26 @@
+package cluster
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                    = metrics.NS("cluster")
+	mTotalQueuedMessages  = ns.NewInt("total_queued_messages")
+	mTotalSentMessages    = ns.NewInt("total_sent_messages")
+	mTotalSendErrors      = ns.NewInt("total_send_errors")
+	mTotalDroppedMessages = ns.NewInt("total_dropped_messages")
+	mPendingMessages      = ns.NewInt("pending_messages")
+
+	mNodeConnections   = ns.NewMap("node_connections")
+	mNodeUsers         = ns.NewMap("node_users")
+	mNodeSubscriptions = ns.NewMap("node_subscriptions")
+)
+
+func resetClusterMetrics() {
+	mTotalQueuedMessages.Set(0)
+	mTotalSentMessages.Set(0)
+	mTotalSendErrors.Set(0)
+	mTotalDroppedMessages.Set(0)
+	mPendingMessages.Set(0)
+}
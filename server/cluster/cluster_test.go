@@ -6,6 +6,7 @@ import (
 	"github.com/smancke/guble/server/store/filestore"
 
 	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/kvstore"
 	"github.com/smancke/guble/server/store"
 
 	"github.com/hashicorp/go-multierror"
@@ -222,13 +223,14 @@ func TestCluster_broadcastClusterMessage(t *testing.T) {
 }
 
 type dummyRouter struct {
-	store store.MessageStore
+	store   store.MessageStore
+	kvStore kvstore.KVStore
 }
 
 func newDummyRouter(t *testing.T) *dummyRouter {
 	dir, err := ioutil.TempDir("", "guble_cluster_test")
 	assert.NoError(t, err)
-	return &dummyRouter{store: filestore.New(dir)}
+	return &dummyRouter{store: filestore.New(dir), kvStore: kvstore.NewMemoryKVStore()}
 }
 
 func (_ *dummyRouter) HandleMessage(pmsg *protocol.Message) error {
@@ -238,3 +240,38 @@ func (_ *dummyRouter) HandleMessage(pmsg *protocol.Message) error {
 func (d *dummyRouter) MessageStore() (store.MessageStore, error) {
 	return d.store, nil
 }
+
+func (d *dummyRouter) KVStore() (kvstore.KVStore, error) {
+	return d.kvStore, nil
+}
+
+func TestCluster_NewShouldReturnErrorWhenSecretKeyIsInvalid(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	conf.SecretKey = []byte("too short")
+
+	node, err := New(&conf)
+	a.Nil(node)
+	a.Equal(ErrInvalidSecretKey, err)
+}
+
+func TestCluster_EncodeMessage(t *testing.T) {
+	a := assert.New(t)
+
+	pMessage := &protocol.Message{ID: 42, Path: "/foo", NodeID: 1, Time: 1420110000, Body: []byte("Hello")}
+	cluster := &Cluster{Config: &Config{}}
+	a.Equal(pMessage.Bytes(), cluster.encodeMessage(pMessage))
+	cluster.Config.Protobuf = true
+	a.Equal(pMessage.MarshalProto(), cluster.encodeMessage(pMessage))
+
+	// both encodings are decoded
+	for _, data := range [][]byte{pMessage.Bytes(), pMessage.MarshalProto()} {
+		decoded, err := decodeMessage(data)
+		a.NoError(err)
+		a.Equal(pMessage.ID, decoded.ID)
+		a.Equal(pMessage.Path, decoded.Path)
+		a.Equal(pMessage.NodeID, decoded.NodeID)
+		a.Equal(pMessage.Body, decoded.Body)
+	}
+}
@@ -26,6 +26,49 @@ const (
 	mtSyncMessage
 
 	mtStringMessage
+
+	// Sent to the sequencer leader to request the next message ID of a partition
+	mtSequenceRequest
+
+	// Sent by the sequencer leader with the message ID assigned for a request
+	mtSequenceResponse
+
+	// Broadcasted by the sequencer leader to reserve a block of message IDs of a partition
+	mtSequenceReserve
+
+	// Guble protocol.Message received by a node, forwarded to the owner of its partition
+	mtForwardMessage
+
+	// Sent to a node storing a partition to fetch some of its messages
+	mtFetchRequest
+
+	// Sent back with the messages fetched for a request
+	mtFetchResponse
+
+	// Sent periodically to the other nodes for measuring the round-trip latency; answered with mtPong
+	mtPing
+	mtPong
+
+	// Sent to a node which should leave the cluster
+	mtLeave
+
+	// Sent to the other nodes with the topics subscribed on a node, when they change
+	mtSubscriptions
+
+	// Sent by a joining node to request the state snapshot of another node
+	mtSnapshotRequest
+
+	// Sent back with a part of the state snapshot
+	mtSnapshotChunk
+
+	// Sent periodically to the other nodes with the numbers of connections, users and subscriptions of a node
+	mtLoad
+
+	// Sent periodically to the other nodes with the usage of the rate limits on a node
+	mtRateUsage
+
+	// Sent back to the sequencer leader when a node recorded its reservation
+	mtSequenceReserveAck
 )
 
 type encoder interface {
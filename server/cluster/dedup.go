@@ -0,0 +1,51 @@
+package cluster
+
+import "sync"
+
+// dedupCapacity is the number of the most recent messages remembered for deduplication.
+const dedupCapacity = 10000
+
+// messageKey identifies a message in the cluster: the IDs are assigned per partition,
+// so that messages of different partitions may have the same node ID and ID.
+type messageKey struct {
+	nodeID    uint8
+	partition string
+	id        uint64
+}
+
+// deduplicator remembers the (node ID, partition, message ID) keys of the most recent messages received from the cluster,
+// so that a message broadcast again (e.g. after a node left and rejoined the cluster) is not delivered twice.
+type deduplicator struct {
+	mutex sync.Mutex
+	seen  map[messageKey]struct{}
+	keys  []messageKey // ring buffer of the keys, in the order they were seen
+	next  int
+}
+
+func newDeduplicator(capacity int) *deduplicator {
+	return &deduplicator{
+		seen: make(map[messageKey]struct{}, capacity),
+		keys: make([]messageKey, 0, capacity),
+	}
+}
+
+// isDuplicate returns true if the message was already seen, and remembers it otherwise, forgetting the oldest one.
+func (d *deduplicator) isDuplicate(nodeID uint8, partition string, id uint64) bool {
+	key := messageKey{nodeID: nodeID, partition: partition, id: id}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	if len(d.keys) < cap(d.keys) {
+		d.keys = append(d.keys, key)
+	} else {
+		delete(d.seen, d.keys[d.next])
+		d.keys[d.next] = key
+		d.next = (d.next + 1) % len(d.keys)
+	}
+	d.seen[key] = struct{}{}
+	return false
+}
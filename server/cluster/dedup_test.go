@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+)
+
+func TestDeduplicator_ForgetsTheOldestMessages(t *testing.T) {
+	a := assert.New(t)
+
+	d := newDeduplicator(2)
+	a.False(d.isDuplicate(1, "p", 1))
+	a.False(d.isDuplicate(1, "p", 2))
+	a.False(d.isDuplicate(2, "p", 1))
+	a.True(d.isDuplicate(1, "p", 2))
+	a.True(d.isDuplicate(2, "p", 1))
+
+	// (1, p, 1) was forgotten when (2, p, 1) was seen
+	a.False(d.isDuplicate(1, "p", 1))
+}
+
+func TestDeduplicator_KeepsPartitionsApart(t *testing.T) {
+	a := assert.New(t)
+
+	d := newDeduplicator(10)
+	a.False(d.isDuplicate(1, "foo", 1))
+	a.False(d.isDuplicate(1, "bar", 1))
+	a.True(d.isDuplicate(1, "foo", 1))
+}
+
+type countingRouter struct {
+	*dummyRouter
+	messages []*protocol.Message
+}
+
+func (r *countingRouter) HandleMessage(pmsg *protocol.Message) error {
+	r.messages = append(r.messages, pmsg)
+	return nil
+}
+
+func TestCluster_DropsDuplicateMessages(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+	router := &countingRouter{dummyRouter: newDummyRouter(t)}
+	node.Router = router
+
+	receive := func(t messageType, m *protocol.Message) {
+		data, err := (&message{NodeID: 2, Type: t, Body: m.Bytes()}).encode()
+		a.NoError(err)
+		node.NotifyMsg(data)
+	}
+
+	m := &protocol.Message{ID: 42, NodeID: 2, Path: "/foo", Body: []byte("bar")}
+	receive(mtGubleMessage, m)
+	// broadcast again, e.g. after node 2 rejoined
+	receive(mtGubleMessage, m)
+	receive(mtGubleMessage, &protocol.Message{ID: 42, NodeID: 3, Path: "/foo", Body: []byte("bar")})
+	// the same ID in another partition
+	receive(mtGubleMessage, &protocol.Message{ID: 42, NodeID: 2, Path: "/bar", Body: []byte("bar")})
+
+	// messages forwarded to the owner of their partition are not sequenced yet
+	forwarded := &protocol.Message{Path: "/foo", Body: []byte("baz")}
+	receive(mtForwardMessage, forwarded)
+	receive(mtForwardMessage, forwarded)
+
+	a.Len(router.messages, 5)
+}
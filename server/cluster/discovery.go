@@ -0,0 +1,226 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// DefaultDiscoveryInterval is the interval of discovering the other nodes of the cluster again
+	DefaultDiscoveryInterval = 30 * time.Second
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// Discovery finds the addresses of the other guble nodes, used instead of (or in addition to) the static remotes.
+type Discovery interface {
+	Discover() ([]*net.TCPAddr, error)
+}
+
+// DNSDiscovery discovers the nodes from the DNS SRV records of a name, e.g. `_guble._tcp.guble.example.com`.
+type DNSDiscovery struct {
+	Name string
+
+	lookupSRV func(service, proto, name string) (string, []*net.SRV, error)
+	lookupIP  func(host string) ([]net.IP, error)
+}
+
+// NewDNSDiscovery returns a Discovery looking up the SRV records of the given name.
+func NewDNSDiscovery(name string) *DNSDiscovery {
+	return &DNSDiscovery{
+		Name:      name,
+		lookupSRV: net.LookupSRV,
+		lookupIP:  net.LookupIP,
+	}
+}
+
+// Discover returns the addresses of all the targets of the SRV records.
+func (d *DNSDiscovery) Discover() ([]*net.TCPAddr, error) {
+	_, records, err := d.lookupSRV("", "", d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []*net.TCPAddr
+	for _, record := range records {
+		ips, err := d.lookupIP(strings.TrimSuffix(record.Target, "."))
+		if err != nil {
+			logger.WithError(err).WithField("target", record.Target).Warn("Could not resolve SRV target")
+			continue
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, &net.TCPAddr{IP: ip, Port: int(record.Port)})
+		}
+	}
+	return addrs, nil
+}
+
+// KubernetesDiscovery discovers the nodes from the endpoints of a Kubernetes service,
+// using the API server and the service account of the pod.
+// The not-ready endpoints are included, so that the nodes can join before they are ready.
+type KubernetesDiscovery struct {
+	Namespace string
+	Service   string
+
+	// Port is the cluster port of the nodes, which is the same for all the pods of the service.
+	Port int
+
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+// NewKubernetesDiscovery returns a Discovery for the service (given as `<namespace>/<service>` or `<service>`),
+// configured from the environment of the pod.
+func NewKubernetesDiscovery(service string, port int) (*KubernetesDiscovery, error) {
+	namespace := "default"
+	if parts := strings.SplitN(service, "/", 2); len(parts) == 2 {
+		namespace, service = parts[0], parts[1]
+	} else if data, err := ioutil.ReadFile(serviceAccountDir + "/namespace"); err == nil {
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	host, apiPort := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || apiPort == "" {
+		return nil, fmt.Errorf("Kubernetes discovery is only available inside a pod")
+	}
+
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	return &KubernetesDiscovery{
+		Namespace: namespace,
+		Service:   service,
+		Port:      port,
+		apiURL:    "https://" + net.JoinHostPort(host, apiPort),
+		token:     strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+type endpoints struct {
+	Subsets []struct {
+		Addresses         []endpointAddress `json:"addresses"`
+		NotReadyAddresses []endpointAddress `json:"notReadyAddresses"`
+	} `json:"subsets"`
+}
+
+type endpointAddress struct {
+	IP string `json:"ip"`
+}
+
+// Discover returns the addresses of the endpoints of the service.
+func (d *KubernetesDiscovery) Discover() ([]*net.TCPAddr, error) {
+	url := fmt.Sprintf("%s/api/v1/namespaces/%s/endpoints/%s", d.apiURL, d.Namespace, d.Service)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Kubernetes API returned status code %d for endpoints %s/%s", resp.StatusCode, d.Namespace, d.Service)
+	}
+
+	var e endpoints
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		return nil, err
+	}
+
+	var addrs []*net.TCPAddr
+	for _, subset := range e.Subsets {
+		for _, address := range append(subset.Addresses, subset.NotReadyAddresses...) {
+			if ip := net.ParseIP(address.IP); ip != nil {
+				addrs = append(addrs, &net.TCPAddr{IP: ip, Port: d.Port})
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// discover returns the addresses of the static remotes and of the discovered nodes
+// which are not yet members of the cluster.
+func (cluster *Cluster) discover() []string {
+	addrs := cluster.Config.Remotes
+	if cluster.Config.Discovery != nil {
+		discovered, err := cluster.Config.Discovery.Discover()
+		if err != nil {
+			logger.WithError(err).Error("Error discovering the cluster nodes")
+		}
+		addrs = append(addrs[:len(addrs):len(addrs)], discovered...)
+	}
+
+	members := make(map[string]bool)
+	for _, node := range cluster.memberlist.Members() {
+		members[net.JoinHostPort(node.Addr.String(), strconv.Itoa(int(node.Port)))] = true
+	}
+	var remotes []string
+	for _, addr := range addrs {
+		if address := addr.String(); !members[address] {
+			remotes = append(remotes, address)
+		}
+	}
+	logger.WithField("remotes", remotes).Debug("Discovered cluster nodes")
+	return remotes
+}
+
+// discoveryLoop periodically joins the discovered nodes which are not members of the cluster,
+// healing the cluster after network partitions or when nodes are added.
+func (cluster *Cluster) discoveryLoop() {
+	ticker := time.NewTicker(cluster.Config.DiscoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if atomic.LoadInt32(&cluster.left) == 1 {
+				continue
+			}
+			remotes := cluster.discover()
+			if len(remotes) == 0 {
+				continue
+			}
+			num, err := cluster.memberlist.Join(remotes)
+			if err != nil {
+				logger.WithFields(log.Fields{
+					"error":   err,
+					"remotes": remotes,
+				}).Warn("Could not join the discovered cluster nodes")
+				continue
+			}
+			logger.WithField("joined", num).Debug("Joined discovered cluster nodes")
+		case <-cluster.discoveryStopC:
+			return
+		}
+	}
+}
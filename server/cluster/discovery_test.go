@@ -0,0 +1,100 @@
+package cluster
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSDiscovery_Discover(t *testing.T) {
+	a := assert.New(t)
+
+	d := NewDNSDiscovery("_guble._tcp.example.com")
+	d.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		a.Equal("_guble._tcp.example.com", name)
+		return "", []*net.SRV{
+			{Target: "node1.example.com.", Port: 10000},
+			{Target: "node2.example.com.", Port: 10001},
+			{Target: "unknown.example.com.", Port: 10002},
+		}, nil
+	}
+	d.lookupIP = func(host string) ([]net.IP, error) {
+		switch host {
+		case "node1.example.com":
+			return []net.IP{net.ParseIP("10.0.0.1")}, nil
+		case "node2.example.com":
+			return []net.IP{net.ParseIP("10.0.0.2")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	addrs, err := d.Discover()
+	a.NoError(err)
+	if a.Len(addrs, 2) {
+		a.Equal("10.0.0.1:10000", addrs[0].String())
+		a.Equal("10.0.0.2:10001", addrs[1].String())
+	}
+}
+
+func TestDNSDiscovery_LookupError(t *testing.T) {
+	d := NewDNSDiscovery("_guble._tcp.example.com")
+	d.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, errors.New("lookup failed")
+	}
+
+	_, err := d.Discover()
+	assert.Error(t, err)
+}
+
+func TestKubernetesDiscovery_Discover(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("/api/v1/namespaces/messaging/endpoints/guble", r.URL.Path)
+		a.Equal("Bearer secret", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"subsets":[{
+			"addresses":[{"ip":"10.0.0.1"},{"ip":"10.0.0.2"}],
+			"notReadyAddresses":[{"ip":"10.0.0.3"}],
+			"ports":[{"name":"http","port":8080}]
+		}]}`))
+	}))
+	defer server.Close()
+
+	d := &KubernetesDiscovery{
+		Namespace: "messaging",
+		Service:   "guble",
+		Port:      10000,
+		apiURL:    server.URL,
+		token:     "secret",
+		client:    http.DefaultClient,
+	}
+
+	addrs, err := d.Discover()
+	a.NoError(err)
+	if a.Len(addrs, 3) {
+		a.Equal("10.0.0.1:10000", addrs[0].String())
+		a.Equal("10.0.0.2:10000", addrs[1].String())
+		a.Equal("10.0.0.3:10000", addrs[2].String())
+	}
+}
+
+func TestKubernetesDiscovery_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	d := &KubernetesDiscovery{Namespace: "default", Service: "guble", apiURL: server.URL, client: http.DefaultClient}
+
+	_, err := d.Discover()
+	assert.Error(t, err)
+}
+
+func TestNewKubernetesDiscovery_OutsideOfPod(t *testing.T) {
+	_, err := NewKubernetesDiscovery("guble", 10000)
+	assert.Error(t, err)
+}
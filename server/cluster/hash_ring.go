@@ -0,0 +1,91 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// virtualNodes is the number of points each node has on the hash ring,
+// spreading the partitions evenly across the nodes.
+const virtualNodes = 64
+
+// hashRing assigns keys to nodes by consistent hashing, so that only the keys
+// of a joining or leaving node move to another node.
+type hashRing struct {
+	nodes  []uint8
+	hashes []uint32
+	owners map[uint32]uint8
+}
+
+func newHashRing(nodes []uint8) *hashRing {
+	r := &hashRing{
+		nodes:  nodes,
+		owners: make(map[uint32]uint8, len(nodes)*virtualNodes),
+	}
+	for _, node := range nodes {
+		for i := 0; i < virtualNodes; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(int(node)) + "-" + strconv.Itoa(i)))
+			if _, exists := r.owners[hash]; exists {
+				continue
+			}
+			r.owners[hash] = node
+			r.hashes = append(r.hashes, hash)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// owner returns the node owning the key, or 0 if the ring is empty.
+func (r *hashRing) owner(key string) uint8 {
+	if nodes := r.nodesFor(key, 1); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return 0
+}
+
+// nodesFor returns the owner of the key followed by the next distinct nodes on the ring, n nodes at most.
+// When the owner leaves, the next node becomes the owner of the key.
+func (r *hashRing) nodesFor(key string, n int) []uint8 {
+	if len(r.hashes) == 0 {
+		return nil
+	}
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+
+	nodes := make([]uint8, 0, n)
+	for i := 0; i < len(r.hashes) && len(nodes) < n; i++ {
+		node := r.owners[r.hashes[(start+i)%len(r.hashes)]]
+		if !containsNode(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func containsNode(nodes []uint8, node uint8) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// hasNodes returns true if the ring was built for exactly the given (sorted) nodes.
+func (r *hashRing) hasNodes(nodes []uint8) bool {
+	if len(r.nodes) != len(nodes) {
+		return false
+	}
+	for i := range nodes {
+		if r.nodes[i] != nodes[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashRing_Empty(t *testing.T) {
+	assert.Equal(t, uint8(0), newHashRing(nil).owner("/topic"))
+}
+
+func TestHashRing_OwnerIsStableAndSpread(t *testing.T) {
+	a := assert.New(t)
+	r := newHashRing([]uint8{1, 2, 3})
+
+	counts := make(map[uint8]int)
+	for i := 0; i < 3000; i++ {
+		key := "partition" + strconv.Itoa(i)
+		owner := r.owner(key)
+		a.Equal(owner, r.owner(key))
+		counts[owner]++
+	}
+
+	a.Len(counts, 3)
+	for _, count := range counts {
+		a.True(count > 500, "Partitions should be spread evenly across the nodes")
+	}
+}
+
+func TestHashRing_OnlyPartitionsOfLeavingNodeMove(t *testing.T) {
+	a := assert.New(t)
+	before := newHashRing([]uint8{1, 2, 3})
+	after := newHashRing([]uint8{1, 3})
+
+	for i := 0; i < 1000; i++ {
+		key := "partition" + strconv.Itoa(i)
+		if owner := before.owner(key); owner != 2 {
+			a.Equal(owner, after.owner(key))
+		} else {
+			a.NotEqual(uint8(2), after.owner(key))
+		}
+	}
+}
+
+func TestHashRing_HasNodes(t *testing.T) {
+	a := assert.New(t)
+	r := newHashRing([]uint8{1, 2})
+
+	a.True(r.hasNodes([]uint8{1, 2}))
+	a.False(r.hasNodes([]uint8{1}))
+	a.False(r.hasNodes([]uint8{1, 3}))
+}
+
+func TestHashRing_NodesFor(t *testing.T) {
+	a := assert.New(t)
+	r := newHashRing([]uint8{1, 2, 3})
+
+	for i := 0; i < 100; i++ {
+		key := "partition" + strconv.Itoa(i)
+		nodes := r.nodesFor(key, 2)
+		a.Len(nodes, 2)
+		a.Equal(r.owner(key), nodes[0])
+		a.NotEqual(nodes[0], nodes[1])
+
+		// the first replica takes over the partition when the owner leaves
+		var remaining []uint8
+		for _, node := range []uint8{1, 2, 3} {
+			if node != nodes[0] {
+				remaining = append(remaining, node)
+			}
+		}
+		a.Equal(nodes[1], newHashRing(remaining).owner(key))
+	}
+
+	a.Len(r.nodesFor("partition", 5), 3)
+}
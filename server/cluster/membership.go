@@ -0,0 +1,109 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	membersPath = "members"
+
+	// leaveTimeout is the maximum duration of broadcasting the leave of this node to the cluster
+	leaveTimeout = 5 * time.Second
+)
+
+var ErrNoNodeJoined = errors.New("No node was successfully contacted for joining")
+
+// Join adds to the cluster the nodes at the addresses (format: "IP:port"), at runtime.
+func (cluster *Cluster) Join(addresses []string) error {
+	logger.WithField("addresses", addresses).Info("Joining nodes")
+	atomic.StoreInt32(&cluster.left, 0)
+	num, err := cluster.memberlist.Join(addresses)
+	if err != nil {
+		return err
+	}
+	if num == 0 {
+		return ErrNoNodeJoined
+	}
+	return nil
+}
+
+// RemoveNode gracefully removes a node from the cluster: the node broadcasts its leave to the other nodes,
+// which take over its partitions and its connector subscriptions; it does not rejoin the cluster, until restarted
+// or joined again.
+func (cluster *Cluster) RemoveNode(nodeID uint8) error {
+	if nodeID == cluster.Config.ID {
+		return cluster.leave()
+	}
+	logger.WithField("node", nodeID).Info("Requesting node to leave the cluster")
+	return cluster.sendMessageToNodeID(nodeID, cluster.newMessage(mtLeave, nil))
+}
+
+func (cluster *Cluster) leave() error {
+	logger.Info("Leaving the cluster")
+	// the discovered nodes are not joined again
+	atomic.StoreInt32(&cluster.left, 1)
+	return cluster.memberlist.Leave(leaveTimeout)
+}
+
+// handleLeave makes this node leave the cluster, as requested by another node.
+func (cluster *Cluster) handleLeave(cmsg *message) {
+	logger.WithField("node", cmsg.NodeID).Info("Leave requested by node")
+	if err := cluster.leave(); err != nil {
+		logger.WithError(err).Error("Error leaving the cluster")
+	}
+}
+
+// serveMembers handles the membership requests: a POST on the members path with a JSON list of addresses
+// joins the nodes, and a DELETE of members/<id> removes the node.
+func (cluster *Cluster) serveMembers(w http.ResponseWriter, req *http.Request, path string) {
+	switch req.Method {
+	case http.MethodPost:
+		if path != "" {
+			http.Error(w, `{"error":"the nodes are joined on the members path"}`, http.StatusNotFound)
+			return
+		}
+		var addresses []string
+		if err := json.NewDecoder(req.Body).Decode(&addresses); err != nil || len(addresses) == 0 {
+			http.Error(w, `{"error":"a JSON list of node addresses (format: \"IP:port\") is expected"}`, http.StatusBadRequest)
+			return
+		}
+		if err := cluster.Join(addresses); err != nil {
+			logger.WithError(err).Error("Error joining nodes")
+			http.Error(w, `{"error":"could not join the nodes"}`, http.StatusBadGateway)
+			return
+		}
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(path, 10, 8)
+		if err != nil {
+			http.Error(w, `{"error":"invalid node ID"}`, http.StatusBadRequest)
+			return
+		}
+		if err := cluster.RemoveNode(uint8(id)); err == ErrNodeNotFound {
+			http.Error(w, `{"error":"node not found"}`, http.StatusNotFound)
+			return
+		} else if err != nil {
+			logger.WithError(err).WithField("node", id).Error("Error removing node")
+			http.Error(w, `{"error":"could not remove the node"}`, http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, `{"error": Error method not allowed.Only HTTP POST and DELETE are accepted}`, http.StatusMethodNotAllowed)
+		return
+	}
+	cluster.writeStatus(w)
+}
+
+// splitMembersPath returns true and the rest of the path, if the request is on the members path.
+func splitMembersPath(urlPath string) (string, bool) {
+	path := strings.Trim(strings.TrimPrefix(urlPath, statusPrefix), "/")
+	if path != membersPath && !strings.HasPrefix(path, membersPath+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(path, membersPath), "/"), true
+}
@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMembersPath(t *testing.T) {
+	a := assert.New(t)
+
+	path, ok := splitMembersPath("/admin/cluster/members")
+	a.True(ok)
+	a.Equal("", path)
+
+	path, ok = splitMembersPath("/admin/cluster/members/3")
+	a.True(ok)
+	a.Equal("3", path)
+
+	_, ok = splitMembersPath("/admin/cluster/")
+	a.False(ok)
+	_, ok = splitMembersPath("/admin/cluster/membersx")
+	a.False(ok)
+}
+
+func TestCluster_ServeMembers(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	serve := func(method, path, body string) int {
+		w := httptest.NewRecorder()
+		node.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w.Code
+	}
+
+	a.Equal(http.StatusBadRequest, serve(http.MethodPost, "/admin/cluster/members", "10.0.0.2:10000"))
+	a.Equal(http.StatusBadRequest, serve(http.MethodPost, "/admin/cluster/members", "[]"))
+	// none of the nodes is reachable
+	a.Equal(http.StatusBadGateway, serve(http.MethodPost, "/admin/cluster/members", `["127.0.0.1:1"]`))
+
+	a.Equal(http.StatusBadRequest, serve(http.MethodDelete, "/admin/cluster/members/foo", ""))
+	a.Equal(http.StatusNotFound, serve(http.MethodDelete, "/admin/cluster/members/200", ""))
+	a.Equal(http.StatusMethodNotAllowed, serve(http.MethodPut, "/admin/cluster/members", ""))
+
+	// this node leaves the cluster
+	a.Equal(http.StatusOK, serve(http.MethodDelete, "/admin/cluster/members/"+strconv.Itoa(int(conf.ID)), ""))
+	a.Equal(int32(1), node.left)
+}
@@ -0,0 +1,91 @@
+package cluster
+
+import (
+	"expvar"
+	"strconv"
+
+	"github.com/hashicorp/memberlist"
+
+	"github.com/smancke/guble/server/metrics"
+)
+
+// nodeLoad are the totals of a node, sent periodically to the other nodes.
+type nodeLoad struct {
+	Connections   int64
+	Users         int64
+	Subscriptions int64
+}
+
+func (l *nodeLoad) encode() ([]byte, error) {
+	return encode(l)
+}
+
+func (l *nodeLoad) decode(data []byte) error {
+	return decode(l, data)
+}
+
+// localLoad returns the current totals of this node, read from its gauges.
+func localLoad() *nodeLoad {
+	lookup := func(name string) int64 {
+		value, _ := metrics.Lookup(name)
+		return int64(value)
+	}
+	return &nodeLoad{
+		Connections:   lookup("websocket.current_connections"),
+		Users:         lookup("websocket.current_users"),
+		Subscriptions: lookup("router.current_subscriptions"),
+	}
+}
+
+// sendLoad publishes the totals of this node in its gauges, and sends them to the other nodes.
+func (cluster *Cluster) sendLoad() {
+	load := localLoad()
+	setNodeLoad(cluster.Config.ID, load)
+
+	cmsg, err := cluster.newEncoderMessage(mtLoad, load)
+	if err != nil {
+		logger.WithError(err).Error("Could not encode the load")
+		return
+	}
+	data, err := cmsg.encode()
+	if err != nil {
+		logger.WithError(err).Error("Could not encode the load")
+		return
+	}
+	for _, node := range cluster.memberlist.Members() {
+		if node.Name != cluster.name {
+			cluster.enqueue(node, data)
+		}
+	}
+}
+
+// handleLoad records the totals sent by another node.
+func (cluster *Cluster) handleLoad(cmsg *message) {
+	load := &nodeLoad{}
+	if err := load.decode(cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error decoding load")
+		return
+	}
+	cluster.stats.update(cmsg.NodeID, func(s *nodeStats) { s.load = *load })
+	setNodeLoad(cmsg.NodeID, load)
+}
+
+// forgetLoad resets the gauges of a node leaving the cluster.
+func (cluster *Cluster) forgetLoad(node *memberlist.Node) {
+	if id, ok := parseNodeID(node); ok {
+		setNodeLoad(id, &nodeLoad{})
+	}
+}
+
+func setNodeLoad(id uint8, load *nodeLoad) {
+	key := strconv.Itoa(int(id))
+	mNodeConnections.Set(key, gauge(load.Connections))
+	mNodeUsers.Set(key, gauge(load.Users))
+	mNodeSubscriptions.Set(key, gauge(load.Subscriptions))
+}
+
+func gauge(value int64) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(value)
+	return v
+}
@@ -0,0 +1,38 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCluster_NodeLoad(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	cmsg, err := node.newEncoderMessage(mtLoad, &nodeLoad{Connections: 5, Users: 3, Subscriptions: 8})
+	a.NoError(err)
+	cmsg.NodeID = 2
+	data, err := cmsg.encode()
+	a.NoError(err)
+	node.NotifyMsg(data)
+
+	a.Equal("5", mNodeConnections.Get("2").String())
+	a.Equal("3", mNodeUsers.Get("2").String())
+	a.Equal("8", mNodeSubscriptions.Get("2").String())
+
+	node.stats.Lock()
+	ns := node.withStats(NodeStatus{ID: 2})
+	node.stats.Unlock()
+	a.Equal(int64(5), ns.Connections)
+	a.Equal(int64(3), ns.Users)
+	a.Equal(int64(8), ns.Subscriptions)
+
+	node.forgetLoad(&memberlist.Node{Name: "2"})
+	a.Equal("0", mNodeConnections.Get("2").String())
+}
@@ -0,0 +1,119 @@
+package cluster
+
+import (
+	"errors"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/memberlist"
+)
+
+// defaultPeerQueueSize is the number of cluster messages waiting to be sent to a node, before shedding the new ones
+const defaultPeerQueueSize = 1000
+
+var ErrPeerQueueFull = errors.New("Too many cluster messages are waiting to be sent to the node")
+
+// peerQueue sends the cluster messages to a node one after the other, in the order they were queued.
+// It is bounded, so that a slow node can not make the other nodes buffer an unlimited number of messages.
+type peerQueue struct {
+	queueC chan *queuedMessage
+	stopC  chan struct{}
+}
+
+type queuedMessage struct {
+	node *memberlist.Node
+	data []byte
+}
+
+// enqueue queues an encoded cluster message for the node, and returns ErrPeerQueueFull
+// (dropping the message) if the node does not keep up with the messages sent to it.
+func (cluster *Cluster) enqueue(node *memberlist.Node, data []byte) error {
+	q := cluster.peerQueue(node.Name)
+	select {
+	case q.queueC <- &queuedMessage{node: node, data: data}:
+		mTotalQueuedMessages.Add(1)
+		mPendingMessages.Add(1)
+		return nil
+	default:
+		mTotalDroppedMessages.Add(1)
+		logger.WithFields(log.Fields{
+			"node":   node.Name,
+			"queued": len(q.queueC),
+		}).Warn("Cluster node is too slow, dropping message")
+		return ErrPeerQueueFull
+	}
+}
+
+// peerQueue returns the queue of the node, starting it if needed.
+func (cluster *Cluster) peerQueue(name string) *peerQueue {
+	cluster.queuesMutex.Lock()
+	defer cluster.queuesMutex.Unlock()
+
+	if cluster.queues == nil {
+		cluster.queues = make(map[string]*peerQueue)
+	}
+	q, ok := cluster.queues[name]
+	if !ok {
+		size := cluster.Config.PeerQueueSize
+		if size <= 0 {
+			size = defaultPeerQueueSize
+		}
+		q = &peerQueue{
+			queueC: make(chan *queuedMessage, size),
+			stopC:  make(chan struct{}),
+		}
+		cluster.queues[name] = q
+		go cluster.sendLoop(q)
+	}
+	return q
+}
+
+// queueLength returns the number of messages waiting to be sent to the node.
+func (cluster *Cluster) queueLength(name string) int {
+	cluster.queuesMutex.Lock()
+	defer cluster.queuesMutex.Unlock()
+
+	if q, ok := cluster.queues[name]; ok {
+		return len(q.queueC)
+	}
+	return 0
+}
+
+// stopPeerQueue stops sending to a node leaving the cluster; the messages waiting for it are dropped.
+func (cluster *Cluster) stopPeerQueue(name string) {
+	cluster.queuesMutex.Lock()
+	defer cluster.queuesMutex.Unlock()
+
+	if q, ok := cluster.queues[name]; ok {
+		close(q.stopC)
+		delete(cluster.queues, name)
+	}
+}
+
+func (cluster *Cluster) stopPeerQueues() {
+	cluster.queuesMutex.Lock()
+	defer cluster.queuesMutex.Unlock()
+
+	for name, q := range cluster.queues {
+		close(q.stopC)
+		delete(cluster.queues, name)
+	}
+}
+
+func (cluster *Cluster) sendLoop(q *peerQueue) {
+	for {
+		select {
+		case m := <-q.queueC:
+			mPendingMessages.Add(-1)
+			if err := cluster.sendToNode(m.node, m.data); err != nil {
+				mTotalSendErrors.Add(1)
+			} else {
+				mTotalSentMessages.Add(1)
+			}
+		case <-q.stopC:
+			dropped := len(q.queueC)
+			mPendingMessages.Add(int64(-dropped))
+			mTotalDroppedMessages.Add(int64(dropped))
+			return
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCluster_EnqueueShedsMessagesForSlowNode(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	// the queue of a node which does not receive anything
+	node.queues = map[string]*peerQueue{
+		"9": {queueC: make(chan *queuedMessage, 2), stopC: make(chan struct{})},
+	}
+	slow := &memberlist.Node{Name: "9"}
+
+	a.NoError(node.enqueue(slow, []byte("first")))
+	a.NoError(node.enqueue(slow, []byte("second")))
+	a.Equal(ErrPeerQueueFull, node.enqueue(slow, []byte("third")))
+
+	a.Equal(2, node.queueLength("9"))
+	a.Equal(0, node.queueLength("10"))
+
+	node.stopPeerQueue("9")
+	a.Equal(0, node.queueLength("9"))
+}
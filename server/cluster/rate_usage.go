@@ -0,0 +1,51 @@
+package cluster
+
+// RateUsageHandler handles the usage of the rate limits by the identities on another node of the cluster,
+// e.g. the number of requests of each identity since the previous usage sent by the node.
+type RateUsageHandler interface {
+	HandleRateUsage(usage map[string]float64)
+}
+
+// rateUsage is sent periodically by a node to the other nodes, for sharing the state of its rate limits.
+type rateUsage struct {
+	Usage map[string]float64
+}
+
+func (u *rateUsage) encode() ([]byte, error) {
+	return encode(u)
+}
+
+func (u *rateUsage) decode(data []byte) error {
+	return decode(u, data)
+}
+
+// BroadcastRateUsage sends the usage of the rate limits on this node to the other nodes.
+func (cluster *Cluster) BroadcastRateUsage(usage map[string]float64) error {
+	cmsg, err := cluster.newEncoderMessage(mtRateUsage, &rateUsage{Usage: usage})
+	if err != nil {
+		return err
+	}
+	data, err := cmsg.encode()
+	if err != nil {
+		return err
+	}
+	for _, node := range cluster.memberlist.Members() {
+		if node.Name != cluster.name {
+			cluster.enqueue(node, data)
+		}
+	}
+	return nil
+}
+
+// handleRateUsage passes the usage of the rate limits on another node to the RateUsageHandler (if any).
+func (cluster *Cluster) handleRateUsage(cmsg *message) {
+	if cluster.RateUsageHandler == nil {
+		return
+	}
+	u := &rateUsage{}
+	if err := u.decode(cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error decoding rate usage")
+		return
+	}
+	cluster.RateUsageHandler.HandleRateUsage(u.Usage)
+}
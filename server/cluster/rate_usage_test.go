@@ -0,0 +1,35 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type rateUsageRecorder struct {
+	usage map[string]float64
+}
+
+func (r *rateUsageRecorder) HandleRateUsage(usage map[string]float64) {
+	r.usage = usage
+}
+
+func TestCluster_RateUsage(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+	recorder := &rateUsageRecorder{}
+	node.RateUsageHandler = recorder
+
+	cmsg, err := node.newEncoderMessage(mtRateUsage, &rateUsage{Usage: map[string]float64{"requests|ip:10.0.0.1": 3}})
+	a.NoError(err)
+	cmsg.NodeID = 2
+	data, err := cmsg.encode()
+	a.NoError(err)
+	node.NotifyMsg(data)
+
+	a.Equal(map[string]float64{"requests|ip:10.0.0.1": 3}, recorder.usage)
+}
@@ -0,0 +1,203 @@
+package cluster
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/store"
+)
+
+const defaultRemoteFetchTimeout = 10 * time.Second
+
+var (
+	ErrNoStorageNode = errors.New("None of the nodes storing the partition returned the messages")
+
+	ErrRemoteFetchTimeout = errors.New("Timeout waiting for the messages fetched from another node")
+)
+
+// remoteFetcher fetches messages from the nodes storing a partition, when partitioning is enabled.
+// The whole result of a fetch is sent back in a single cluster message, keeping the messages in order.
+type remoteFetcher struct {
+	cluster *Cluster
+	timeout time.Duration
+
+	requestID uint64
+	mutex     sync.Mutex
+	pending   map[uint64]chan *fetchResponse
+}
+
+func newRemoteFetcher(cluster *Cluster) *remoteFetcher {
+	return &remoteFetcher{
+		cluster: cluster,
+		timeout: defaultRemoteFetchTimeout,
+		pending: make(map[uint64]chan *fetchResponse),
+	}
+}
+
+// Fetch asynchronously fetches the messages of the request from the owner of the partition,
+// or from one of its replicas if the owner does not respond.
+func (cluster *Cluster) Fetch(req *store.FetchRequest) {
+	go func() {
+		var lastErr error = ErrNoStorageNode
+		for _, nodeID := range cluster.StorageNodes(req.Partition) {
+			if nodeID == cluster.Config.ID {
+				continue
+			}
+			response, err := cluster.fetcher.fetch(nodeID, req)
+			if err != nil {
+				logger.WithError(err).WithFields(log.Fields{
+					"node":      nodeID,
+					"partition": req.Partition,
+				}).Warn("Could not fetch messages from node, trying the next one")
+				lastErr = err
+				continue
+			}
+
+			req.StartC <- len(response.Messages)
+			for _, m := range response.Messages {
+				if req.IsDone() {
+					return
+				}
+				req.PushFetchMessage(m)
+			}
+			req.Done()
+			return
+		}
+		req.ErrorC <- lastErr
+	}()
+}
+
+func (f *remoteFetcher) fetch(nodeID uint8, req *store.FetchRequest) (*fetchResponse, error) {
+	id := atomic.AddUint64(&f.requestID, 1)
+	responseC := make(chan *fetchResponse, 1)
+	f.mutex.Lock()
+	f.pending[id] = responseC
+	f.mutex.Unlock()
+	defer func() {
+		f.mutex.Lock()
+		delete(f.pending, id)
+		f.mutex.Unlock()
+	}()
+
+	cmsg, err := f.cluster.newEncoderMessage(mtFetchRequest, &fetchRequest{
+		RequestID: id,
+		Partition: req.Partition,
+		StartID:   req.StartID,
+		EndID:     req.EndID,
+		Direction: req.Direction,
+		Count:     req.Count,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := f.cluster.sendMessageToNodeID(nodeID, cmsg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case response := <-responseC:
+		if response.Error != "" {
+			return nil, errors.New(response.Error)
+		}
+		return response, nil
+	case <-time.After(f.timeout):
+		return nil, ErrRemoteFetchTimeout
+	}
+}
+
+// handleRequest fetches the requested messages from the local store and sends them back to the node.
+func (f *remoteFetcher) handleRequest(nodeID uint8, data []byte) error {
+	request := &fetchRequest{}
+	if err := request.decode(data); err != nil {
+		return err
+	}
+
+	response := &fetchResponse{RequestID: request.RequestID}
+	if messages, err := f.fetchLocal(request); err != nil {
+		response.Error = err.Error()
+	} else {
+		response.Messages = messages
+	}
+
+	cmsg, err := f.cluster.newEncoderMessage(mtFetchResponse, response)
+	if err != nil {
+		return err
+	}
+	return f.cluster.sendMessageToNodeID(nodeID, cmsg)
+}
+
+func (f *remoteFetcher) fetchLocal(request *fetchRequest) ([]*store.FetchedMessage, error) {
+	messageStore, err := f.cluster.Router.MessageStore()
+	if err != nil {
+		return nil, err
+	}
+
+	req := store.NewFetchRequest(request.Partition, request.StartID, request.EndID, request.Direction, request.Count)
+	req.Init()
+	messageStore.Fetch(req)
+
+	var messages []*store.FetchedMessage
+	for {
+		select {
+		case <-req.StartC:
+		case m, opened := <-req.MessageC:
+			if !opened {
+				return messages, nil
+			}
+			messages = append(messages, m)
+		case err := <-req.ErrorC:
+			return nil, err
+		}
+	}
+}
+
+// handleResponse passes the fetched messages to the waiting request.
+func (f *remoteFetcher) handleResponse(data []byte) error {
+	response := &fetchResponse{}
+	if err := response.decode(data); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	responseC, ok := f.pending[response.RequestID]
+	f.mutex.Unlock()
+	if ok {
+		responseC <- response
+	}
+	return nil
+}
+
+type fetchRequest struct {
+	RequestID uint64
+	Partition string
+	StartID   uint64
+	EndID     uint64
+	Direction store.FetchDirection
+	Count     int
+}
+
+func (r *fetchRequest) encode() ([]byte, error) {
+	return encode(r)
+}
+
+func (r *fetchRequest) decode(data []byte) error {
+	return decode(r, data)
+}
+
+type fetchResponse struct {
+	RequestID uint64
+	Messages  []*store.FetchedMessage
+	Error     string
+}
+
+func (r *fetchResponse) encode() ([]byte, error) {
+	return encode(r)
+}
+
+func (r *fetchResponse) decode(data []byte) error {
+	return decode(r, data)
+}
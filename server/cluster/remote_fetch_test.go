@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/server/store"
+)
+
+func TestRemoteFetcher_FetchLocal(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+	router := newDummyRouter(t)
+	node.Router = router
+
+	a.NoError(router.store.Store("p", 1, []byte("first")))
+	a.NoError(router.store.Store("p", 2, []byte("second")))
+	a.NoError(router.store.Store("p", 3, []byte("third")))
+
+	messages, err := node.fetcher.fetchLocal(&fetchRequest{
+		Partition: "p",
+		StartID:   2,
+		Direction: store.DirectionForward,
+		Count:     10,
+	})
+	a.NoError(err)
+	if a.Len(messages, 2) {
+		a.Equal(uint64(2), messages[0].ID)
+		a.Equal("second", string(messages[0].Message))
+		a.Equal(uint64(3), messages[1].ID)
+	}
+}
+
+func TestRemoteFetcher_ResponseIsPassedToPendingRequest(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	responseC := make(chan *fetchResponse, 1)
+	node.fetcher.pending[3] = responseC
+
+	data, err := (&fetchResponse{
+		RequestID: 3,
+		Messages:  []*store.FetchedMessage{{ID: 5, Message: []byte("fifth")}},
+	}).encode()
+	a.NoError(err)
+	a.NoError(node.fetcher.handleResponse(data))
+
+	response := <-responseC
+	if a.Len(response.Messages, 1) {
+		a.Equal(uint64(5), response.Messages[0].ID)
+	}
+}
@@ -0,0 +1,420 @@
+package cluster
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/memberlist"
+
+	"github.com/smancke/guble/server/store"
+)
+
+const (
+	// sequenceBlockSize is the number of IDs a leader reserves at once for a partition
+	sequenceBlockSize = 100
+
+	defaultSequencerTimeout = 5 * time.Second
+)
+
+var (
+	ErrSequencerDisabled = errors.New("Cluster sequencer is not enabled")
+
+	ErrSequencerTimeout = errors.New("Timeout waiting for a message ID from the sequencer leader")
+
+	ErrNoSequencerQuorum = errors.New("Sequencer reservation was not acknowledged by a majority of the cluster")
+
+	ErrSequencerSize = errors.New("Cluster sequencer requires the size of the cluster")
+)
+
+// sequencer assigns the IDs of the messages in the cluster, so that they are
+// strictly increasing per partition, whichever node received the message.
+//
+// The live member with the lowest node ID is the leader and the only node assigning IDs;
+// the other nodes request their IDs from it. Before handing out IDs, the leader reserves
+// a block of them by announcing its upper bound to the cluster, and uses it only after a
+// majority of the nodes acknowledged it; the majority is computed against the configured Size
+// of the cluster, so that a minority side of a network partition can not assign any ID.
+// Each acknowledgement carries the highest reservation the node recorded before: since two majorities
+// always share a node, a leader learns the last block of any former leader from the acknowledgements
+// of its own reservation, and reserves again after it, so IDs are never reused after a node failure:
+// the IDs left unused in the block of a failed leader are the only gaps in a partition.
+type sequencer struct {
+	cluster *Cluster
+	store   store.MessageStore
+	timeout time.Duration
+
+	mutex     sync.Mutex
+	last      map[string]uint64 // the last ID assigned by this node as leader, per partition
+	reserved  map[string]uint64 // the highest reserved ID announced in the cluster, per partition
+	reserving map[string]bool   // the partitions whose reservation is waiting for the quorum
+	// reservedCond is signalled when a reservation of this node completed
+	reservedCond *sync.Cond
+
+	requestID uint64
+	pendingMu sync.Mutex
+	pending   map[uint64]chan *sequenceResponse
+	acks      map[uint64]chan reservationAck // the acknowledgements of a reservation, per request
+}
+
+// reservationAck is the acknowledgement of a reservation by a node, with the highest reservation it recorded before.
+type reservationAck struct {
+	nodeID   uint8
+	reserved uint64
+}
+
+func newSequencer(cluster *Cluster) (*sequencer, error) {
+	if cluster.Config.Size <= 0 {
+		return nil, ErrSequencerSize
+	}
+	store, err := cluster.Router.MessageStore()
+	if err != nil {
+		logger.WithError(err).Error("Error retriving message store for sequencer")
+		return nil, err
+	}
+
+	s := &sequencer{
+		cluster:   cluster,
+		store:     store,
+		timeout:   defaultSequencerTimeout,
+		last:      make(map[string]uint64),
+		reserved:  make(map[string]uint64),
+		reserving: make(map[string]bool),
+		pending:   make(map[uint64]chan *sequenceResponse),
+		acks:      make(map[uint64]chan reservationAck),
+	}
+	s.reservedCond = sync.NewCond(&s.mutex)
+	return s, nil
+}
+
+// nextID returns the next message ID of the partition, from the leader of the cluster.
+func (s *sequencer) nextID(partition string) (uint64, error) {
+	leaderID := s.leader()
+	if leaderID == s.cluster.Config.ID {
+		return s.assign(partition)
+	}
+
+	id := atomic.AddUint64(&s.requestID, 1)
+	responseC := make(chan *sequenceResponse, 1)
+	s.pendingMu.Lock()
+	s.pending[id] = responseC
+	s.pendingMu.Unlock()
+	defer func() {
+		s.pendingMu.Lock()
+		delete(s.pending, id)
+		s.pendingMu.Unlock()
+	}()
+
+	cmsg, err := s.cluster.newEncoderMessage(mtSequenceRequest, &sequenceRequest{
+		RequestID: id,
+		Partition: partition,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.cluster.sendMessageToNodeID(leaderID, cmsg); err != nil {
+		return 0, err
+	}
+
+	select {
+	case response := <-responseC:
+		if response.Error != "" {
+			return 0, errors.New(response.Error)
+		}
+		return response.ID, nil
+	case <-time.After(s.timeout):
+		return 0, ErrSequencerTimeout
+	}
+}
+
+// assign returns the next ID of the partition; it is called only on the leader.
+// The mutex is released while a reservation waits for the quorum, so that the reservations of other nodes
+// are still recorded and acknowledged meanwhile.
+func (s *sequencer) assign(partition string) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		last, ok := s.last[partition]
+		if !ok {
+			maxID, err := s.store.MaxMessageID(partition)
+			if err != nil {
+				return 0, err
+			}
+			last = maxID
+			if reserved := s.reserved[partition]; reserved > last {
+				last = reserved
+			}
+		}
+
+		id := last + 1
+		if id <= s.reserved[partition] {
+			s.last[partition] = id
+			logger.WithFields(log.Fields{
+				"id":        id,
+				"partition": partition,
+			}).Debug("Assigned message ID")
+			return id, nil
+		}
+		if s.reserving[partition] {
+			s.reservedCond.Wait()
+			continue
+		}
+
+		upTo := last + sequenceBlockSize
+		s.reserving[partition] = true
+		s.mutex.Unlock()
+		highest, err := s.reserve(partition, upTo)
+		s.mutex.Lock()
+		delete(s.reserving, partition)
+		s.reservedCond.Broadcast()
+		if err != nil {
+			return 0, err
+		}
+
+		// the reservations recorded meanwhile, or by the majority, may overlap the block
+		if s.reserved[partition] > highest {
+			highest = s.reserved[partition]
+		}
+		if highest >= id {
+			logger.WithFields(log.Fields{
+				"partition": partition,
+				"reserved":  highest,
+			}).Info("Sequencer continues after the reservation of a former leader")
+			s.reserved[partition] = highest
+			s.last[partition] = highest
+			continue
+		}
+		s.reserved[partition] = upTo
+		s.last[partition] = last
+	}
+}
+
+// reserve announces the upper bound of the IDs the leader may assign in the partition, and returns the highest
+// reservation recorded before by the nodes acknowledging it.
+// It returns an error if the reservation was not acknowledged by a majority of the cluster (including the leader)
+// before the timeout.
+func (s *sequencer) reserve(partition string, upTo uint64) (uint64, error) {
+	size := s.cluster.Config.Size
+	var others []*memberlist.Node
+	for _, node := range s.cluster.memberlist.Members() {
+		if node.Name != s.cluster.name {
+			others = append(others, node)
+		}
+	}
+	if 2*(len(others)+1) <= size {
+		logger.WithFields(log.Fields{
+			"partition": partition,
+			"members":   len(others) + 1,
+			"size":      size,
+		}).Error("Sequencer has no quorum for a reservation")
+		return 0, ErrNoSequencerQuorum
+	}
+
+	id := atomic.AddUint64(&s.requestID, 1)
+	ackC := make(chan reservationAck, len(others))
+	s.pendingMu.Lock()
+	s.acks[id] = ackC
+	s.pendingMu.Unlock()
+	defer func() {
+		s.pendingMu.Lock()
+		delete(s.acks, id)
+		s.pendingMu.Unlock()
+	}()
+
+	cmsg, err := s.cluster.newEncoderMessage(mtSequenceReserve, &sequenceReservation{
+		RequestID: id,
+		Partition: partition,
+		ID:        upTo,
+	})
+	if err != nil {
+		return 0, err
+	}
+	data, err := cmsg.encode()
+	if err != nil {
+		return 0, err
+	}
+	for _, node := range others {
+		s.cluster.sendToNode(node, data)
+	}
+
+	acked := map[uint8]bool{s.cluster.Config.ID: true}
+	var highest uint64
+	timeout := time.After(s.timeout)
+	for 2*len(acked) <= size {
+		select {
+		case ack := <-ackC:
+			acked[ack.nodeID] = true
+			if ack.reserved > highest {
+				highest = ack.reserved
+			}
+		case <-timeout:
+			logger.WithFields(log.Fields{
+				"partition": partition,
+				"acks":      len(acked),
+				"size":      size,
+			}).Error("Sequencer reservation was not acknowledged")
+			return 0, ErrNoSequencerQuorum
+		}
+	}
+	return highest, nil
+}
+
+// leader returns the ID of the live member with the lowest node ID.
+func (s *sequencer) leader() uint8 {
+	leaderID := s.cluster.Config.ID
+	if ids := s.cluster.memberIDs(); len(ids) > 0 && ids[0] < leaderID {
+		leaderID = ids[0]
+	}
+	return leaderID
+}
+
+// handleRequest assigns an ID for the requesting node and sends it back.
+func (s *sequencer) handleRequest(nodeID uint8, data []byte) error {
+	request := &sequenceRequest{}
+	if err := request.decode(data); err != nil {
+		return err
+	}
+
+	response := &sequenceResponse{RequestID: request.RequestID}
+	if leaderID := s.leader(); leaderID != s.cluster.Config.ID {
+		response.Error = "node " + s.cluster.name + " is not the sequencer leader"
+	} else if id, err := s.assign(request.Partition); err != nil {
+		response.Error = err.Error()
+	} else {
+		response.ID = id
+	}
+
+	cmsg, err := s.cluster.newEncoderMessage(mtSequenceResponse, response)
+	if err != nil {
+		return err
+	}
+	return s.cluster.sendMessageToNodeID(nodeID, cmsg)
+}
+
+// handleResponse passes the ID received from the leader to the waiting request.
+func (s *sequencer) handleResponse(data []byte) error {
+	response := &sequenceResponse{}
+	if err := response.decode(data); err != nil {
+		return err
+	}
+
+	s.pendingMu.Lock()
+	responseC, ok := s.pending[response.RequestID]
+	s.pendingMu.Unlock()
+	if ok {
+		responseC <- response
+	}
+	return nil
+}
+
+// handleReservation records a reservation announced by a leader, and acknowledges it
+// with the highest reservation recorded before.
+func (s *sequencer) handleReservation(nodeID uint8, data []byte) error {
+	reservation := &sequenceReservation{}
+	if err := reservation.decode(data); err != nil {
+		return err
+	}
+	reserved := s.record(reservation)
+
+	cmsg, err := s.cluster.newEncoderMessage(mtSequenceReserveAck, &sequenceReservationAck{
+		RequestID: reservation.RequestID,
+		Reserved:  reserved,
+	})
+	if err != nil {
+		return err
+	}
+	return s.cluster.sendMessageToNodeID(nodeID, cmsg)
+}
+
+// handleReservationAck passes the acknowledgement of a node to the waiting reservation.
+func (s *sequencer) handleReservationAck(nodeID uint8, data []byte) error {
+	ack := &sequenceReservationAck{}
+	if err := ack.decode(data); err != nil {
+		return err
+	}
+
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if ackC, ok := s.acks[ack.RequestID]; ok {
+		select {
+		case ackC <- reservationAck{nodeID: nodeID, reserved: ack.Reserved}:
+		default:
+		}
+	}
+	return nil
+}
+
+// record takes a reservation into account, so that the IDs it covers are never assigned by this node,
+// and returns the highest reservation of the partition recorded before.
+func (s *sequencer) record(reservation *sequenceReservation) uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	reserved := s.reserved[reservation.Partition]
+	if reservation.ID > reserved {
+		s.reserved[reservation.Partition] = reservation.ID
+	}
+	if last, ok := s.last[reservation.Partition]; ok && last < reservation.ID {
+		// another node assigned IDs meanwhile: never hand out any of them again
+		s.last[reservation.Partition] = reservation.ID
+	}
+	return reserved
+}
+
+type sequenceRequest struct {
+	RequestID uint64
+	Partition string
+}
+
+func (r *sequenceRequest) encode() ([]byte, error) {
+	return encode(r)
+}
+
+func (r *sequenceRequest) decode(data []byte) error {
+	return decode(r, data)
+}
+
+type sequenceResponse struct {
+	RequestID uint64
+	ID        uint64
+	Error     string
+}
+
+func (r *sequenceResponse) encode() ([]byte, error) {
+	return encode(r)
+}
+
+func (r *sequenceResponse) decode(data []byte) error {
+	return decode(r, data)
+}
+
+type sequenceReservation struct {
+	RequestID uint64
+	Partition string
+	ID        uint64
+}
+
+func (r *sequenceReservation) encode() ([]byte, error) {
+	return encode(r)
+}
+
+func (r *sequenceReservation) decode(data []byte) error {
+	return decode(r, data)
+}
+
+type sequenceReservationAck struct {
+	RequestID uint64
+	// Reserved is the highest reservation of the partition recorded by the node before
+	Reserved uint64
+}
+
+func (r *sequenceReservationAck) encode() ([]byte, error) {
+	return encode(r)
+}
+
+func (r *sequenceReservationAck) decode(data []byte) error {
+	return decode(r, data)
+}
@@ -0,0 +1,185 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSequencer(t *testing.T) (*Cluster, *sequencer) {
+	conf := testConfig()
+	conf.Size = 1
+	node, err := New(&conf)
+	assert.NoError(t, err)
+	node.Router = newDummyRouter(t)
+
+	s, err := newSequencer(node)
+	assert.NoError(t, err)
+	return node, s
+}
+
+func TestSequencer_AssignsConsecutiveIDsAsLeader(t *testing.T) {
+	a := assert.New(t)
+	node, s := newTestSequencer(t)
+	defer node.Stop()
+
+	a.NoError(s.store.Store("p", 1, []byte("first")))
+	a.NoError(s.store.Store("p", 2, []byte("second")))
+
+	for i := uint64(3); i < 3+2*sequenceBlockSize; i++ {
+		id, err := s.nextID("p")
+		a.NoError(err)
+		a.Equal(i, id)
+	}
+
+	id, err := s.nextID("other")
+	a.NoError(err)
+	a.Equal(uint64(1), id)
+}
+
+func TestSequencer_ContinuesAfterReservationOfAnotherLeader(t *testing.T) {
+	a := assert.New(t)
+	node, s := newTestSequencer(t)
+	defer node.Stop()
+
+	id, err := s.nextID("p")
+	a.NoError(err)
+	a.Equal(uint64(1), id)
+
+	s.record(&sequenceReservation{Partition: "p", ID: 500})
+
+	id, err = s.nextID("p")
+	a.NoError(err)
+	a.Equal(uint64(501), id)
+
+	// an older reservation does not move the IDs backwards
+	s.record(&sequenceReservation{Partition: "p", ID: 200})
+
+	id, err = s.nextID("p")
+	a.NoError(err)
+	a.Equal(uint64(502), id)
+}
+
+func TestSequencer_RecordReturnsThePreviousReservation(t *testing.T) {
+	a := assert.New(t)
+	node, s := newTestSequencer(t)
+	defer node.Stop()
+
+	a.Equal(uint64(0), s.record(&sequenceReservation{Partition: "p", ID: 200}))
+	a.Equal(uint64(200), s.record(&sequenceReservation{Partition: "p", ID: 100}))
+	a.Equal(uint64(200), s.record(&sequenceReservation{Partition: "p", ID: 300}))
+	a.Equal(uint64(0), s.record(&sequenceReservation{Partition: "other", ID: 300}))
+}
+
+func TestSequencer_RecordsReservationsWhileReserving(t *testing.T) {
+	a := assert.New(t)
+	node, s := newTestSequencer(t)
+	defer node.Stop()
+
+	// a reservation of the partition is waiting for the quorum
+	s.mutex.Lock()
+	s.reserving["p"] = true
+	s.mutex.Unlock()
+
+	idC := make(chan uint64)
+	go func() {
+		id, err := s.nextID("p")
+		a.NoError(err)
+		idC <- id
+	}()
+
+	// the reservations of other nodes are recorded meanwhile
+	done := make(chan bool)
+	go func() {
+		s.record(&sequenceReservation{Partition: "p", ID: 500})
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		a.Fail("the reservation was not recorded")
+	}
+
+	s.mutex.Lock()
+	delete(s.reserving, "p")
+	s.reservedCond.Broadcast()
+	s.mutex.Unlock()
+	a.Equal(uint64(501), <-idC)
+}
+
+func TestSequencer_ResponseIsPassedToPendingRequest(t *testing.T) {
+	a := assert.New(t)
+	node, s := newTestSequencer(t)
+	defer node.Stop()
+
+	responseC := make(chan *sequenceResponse, 1)
+	s.pending[7] = responseC
+
+	data, err := (&sequenceResponse{RequestID: 7, ID: 42}).encode()
+	a.NoError(err)
+	a.NoError(s.handleResponse(data))
+
+	response := <-responseC
+	a.Equal(uint64(42), response.ID)
+
+	// responses to unknown requests are ignored
+	data, err = (&sequenceResponse{RequestID: 8, ID: 43}).encode()
+	a.NoError(err)
+	a.NoError(s.handleResponse(data))
+}
+
+func TestSequencer_RefusesIDsWithoutQuorum(t *testing.T) {
+	a := assert.New(t)
+	node, s := newTestSequencer(t)
+	defer node.Stop()
+
+	// a single live node of a cluster of 3
+	node.Config.Size = 3
+	_, err := s.nextID("p")
+	a.Equal(ErrNoSequencerQuorum, err)
+}
+
+func TestSequencer_AckIsPassedToPendingReservation(t *testing.T) {
+	a := assert.New(t)
+	node, s := newTestSequencer(t)
+	defer node.Stop()
+
+	ackC := make(chan reservationAck, 1)
+	s.acks[7] = ackC
+
+	data, err := (&sequenceReservationAck{RequestID: 7, Reserved: 300}).encode()
+	a.NoError(err)
+	a.NoError(s.handleReservationAck(2, data))
+	a.Equal(reservationAck{nodeID: 2, reserved: 300}, <-ackC)
+
+	// acknowledgements of unknown reservations are ignored
+	data, err = (&sequenceReservationAck{RequestID: 8}).encode()
+	a.NoError(err)
+	a.NoError(s.handleReservationAck(3, data))
+}
+
+func TestSequencer_RequiresClusterSize(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+	node.Router = newDummyRouter(t)
+
+	_, err = newSequencer(node)
+	a.Equal(ErrSequencerSize, err)
+}
+
+func TestCluster_NextMessageIDWithoutSequencer(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	_, err = node.NextMessageID("p")
+	a.Equal(ErrSequencerDisabled, err)
+}
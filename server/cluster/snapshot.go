@@ -0,0 +1,315 @@
+package cluster
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/store"
+)
+
+const (
+	// defaultSnapshotTimeout is the maximum delay between two chunks of a snapshot
+	defaultSnapshotTimeout = 30 * time.Second
+
+	// snapshotChunkEntries is the maximum number of KVStore entries sent in a chunk
+	snapshotChunkEntries = 1000
+)
+
+var (
+	ErrSnapshotTimeout = errors.New("Timeout waiting for the state snapshot of another node")
+)
+
+// snapshotTransfer streams the state of a node to a node joining the cluster, before it starts serving:
+// the entries of some KVStore schemas (e.g. the subscriptions of the connectors),
+// and the most recent messages of all the partitions.
+type snapshotTransfer struct {
+	cluster *Cluster
+	timeout time.Duration
+
+	requestID uint64
+	mutex     sync.Mutex
+	pending   map[uint64]*pendingSnapshot
+}
+
+type pendingSnapshot struct {
+	chunkC chan *snapshotChunk
+	doneC  chan struct{}
+}
+
+func newSnapshotTransfer(cluster *Cluster) *snapshotTransfer {
+	return &snapshotTransfer{
+		cluster: cluster,
+		timeout: defaultSnapshotTimeout,
+		pending: make(map[uint64]*pendingSnapshot),
+	}
+}
+
+// transferSnapshot requests the snapshot from the member with the lowest ID, and stores it locally.
+// The first node of the cluster has no snapshot to transfer.
+func (cluster *Cluster) transferSnapshot() error {
+	var nodeID uint8
+	for _, id := range cluster.memberIDs() {
+		if id != cluster.Config.ID {
+			nodeID = id
+			break
+		}
+	}
+	if nodeID == 0 {
+		logger.Info("No other node to transfer the state snapshot from")
+		return nil
+	}
+
+	logger.WithField("node", nodeID).Info("Transferring the state snapshot")
+	start := time.Now()
+	if err := cluster.snapshots.transfer(nodeID); err != nil {
+		logger.WithError(err).WithField("node", nodeID).Error("Could not transfer the state snapshot")
+		return err
+	}
+	logger.WithFields(log.Fields{
+		"node":     nodeID,
+		"duration": time.Since(start),
+	}).Info("Transferred the state snapshot")
+	return nil
+}
+
+func (s *snapshotTransfer) transfer(nodeID uint8) error {
+	id := atomic.AddUint64(&s.requestID, 1)
+	p := &pendingSnapshot{
+		chunkC: make(chan *snapshotChunk, 16),
+		doneC:  make(chan struct{}),
+	}
+	s.mutex.Lock()
+	s.pending[id] = p
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.pending, id)
+		s.mutex.Unlock()
+		close(p.doneC)
+	}()
+
+	cmsg, err := s.cluster.newEncoderMessage(mtSnapshotRequest, &snapshotRequest{
+		RequestID: id,
+		Schemas:   s.cluster.Config.SnapshotSchemas,
+		Messages:  s.cluster.Config.SnapshotMessages,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.cluster.sendMessageToNodeID(nodeID, cmsg); err != nil {
+		return err
+	}
+
+	// the chunks are sent in separate messages, which may be received out of order
+	received, expected := 0, -1
+	for {
+		select {
+		case chunk := <-p.chunkC:
+			if chunk.Error != "" {
+				return errors.New(chunk.Error)
+			}
+			if chunk.Last {
+				expected = chunk.Chunks
+			} else {
+				if err := s.apply(chunk); err != nil {
+					return err
+				}
+				received++
+			}
+			if received == expected {
+				return nil
+			}
+		case <-time.After(s.timeout):
+			return ErrSnapshotTimeout
+		}
+	}
+}
+
+// apply stores a chunk of the snapshot; the messages already stored in a partition are skipped.
+func (s *snapshotTransfer) apply(chunk *snapshotChunk) error {
+	if len(chunk.Entries) > 0 {
+		kvStore, err := s.cluster.Router.KVStore()
+		if err != nil {
+			return err
+		}
+		for _, entry := range chunk.Entries {
+			if err := kvStore.Put(chunk.Schema, entry[0], []byte(entry[1])); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(chunk.Messages) > 0 {
+		messageStore, err := s.cluster.Router.MessageStore()
+		if err != nil {
+			return err
+		}
+		maxID, err := messageStore.MaxMessageID(chunk.Partition)
+		if err != nil {
+			return err
+		}
+		sort.Slice(chunk.Messages, func(i, j int) bool { return chunk.Messages[i].ID < chunk.Messages[j].ID })
+		for _, m := range chunk.Messages {
+			if m.ID <= maxID {
+				continue
+			}
+			if err := messageStore.Store(chunk.Partition, m.ID, m.Message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleRequest streams the snapshot of this node to the requesting node, in chunks.
+func (s *snapshotTransfer) handleRequest(nodeID uint8, data []byte) error {
+	request := &snapshotRequest{}
+	if err := request.decode(data); err != nil {
+		return err
+	}
+
+	sent := 0
+	send := func(chunk *snapshotChunk) error {
+		chunk.RequestID = request.RequestID
+		if !chunk.Last {
+			sent++
+		}
+		cmsg, err := s.cluster.newEncoderMessage(mtSnapshotChunk, chunk)
+		if err != nil {
+			return err
+		}
+		return s.cluster.sendMessageToNodeID(nodeID, cmsg)
+	}
+
+	if err := s.chunks(request, send); err != nil {
+		logger.WithError(err).WithField("node", nodeID).Error("Could not send the state snapshot")
+		return send(&snapshotChunk{Last: true, Error: err.Error()})
+	}
+	return send(&snapshotChunk{Last: true, Chunks: sent})
+}
+
+// chunks passes the snapshot of this node to the send function, in chunks (the last one excepted).
+func (s *snapshotTransfer) chunks(request *snapshotRequest, send func(*snapshotChunk) error) error {
+	if len(request.Schemas) > 0 {
+		kvStore, err := s.cluster.Router.KVStore()
+		if err != nil {
+			return err
+		}
+		for _, schema := range request.Schemas {
+			chunk := &snapshotChunk{Schema: schema}
+			for entry := range kvStore.Iterate(schema, "") {
+				chunk.Entries = append(chunk.Entries, entry)
+				if len(chunk.Entries) == snapshotChunkEntries {
+					if err := send(chunk); err != nil {
+						return err
+					}
+					chunk = &snapshotChunk{Schema: schema}
+				}
+			}
+			if len(chunk.Entries) > 0 {
+				if err := send(chunk); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if request.Messages <= 0 {
+		return nil
+	}
+	messageStore, err := s.cluster.Router.MessageStore()
+	if err != nil {
+		return err
+	}
+	messagePartitions, err := messageStore.Partitions()
+	if err != nil {
+		return err
+	}
+	for _, p := range messagePartitions {
+		maxID := p.MaxMessageID()
+		if maxID == 0 {
+			continue
+		}
+		messages, err := s.cluster.fetcher.fetchLocal(&fetchRequest{
+			Partition: p.Name(),
+			StartID:   maxID,
+			Direction: store.DirectionBackwards,
+			Count:     request.Messages,
+		})
+		if err != nil {
+			return err
+		}
+		if len(messages) > 0 {
+			if err := send(&snapshotChunk{Partition: p.Name(), Messages: messages}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleChunk passes a chunk to the waiting transfer.
+func (s *snapshotTransfer) handleChunk(data []byte) error {
+	chunk := &snapshotChunk{}
+	if err := chunk.decode(data); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	p, ok := s.pending[chunk.RequestID]
+	s.mutex.Unlock()
+	if ok {
+		select {
+		case p.chunkC <- chunk:
+		case <-p.doneC:
+		}
+	}
+	return nil
+}
+
+type snapshotRequest struct {
+	RequestID uint64
+
+	// Schemas are the KVStore schemas to transfer
+	Schemas []string
+
+	// Messages is the number of most recent messages to transfer from each partition
+	Messages int
+}
+
+func (r *snapshotRequest) encode() ([]byte, error) {
+	return encode(r)
+}
+
+func (r *snapshotRequest) decode(data []byte) error {
+	return decode(r, data)
+}
+
+// snapshotChunk contains either KVStore entries of a schema, or messages of a partition.
+type snapshotChunk struct {
+	RequestID uint64
+
+	Schema  string
+	Entries [][2]string
+
+	Partition string
+	Messages  []*store.FetchedMessage
+
+	// Last is the final chunk, with the number of chunks sent before it
+	Last   bool
+	Chunks int
+	Error  string
+}
+
+func (c *snapshotChunk) encode() ([]byte, error) {
+	return encode(c)
+}
+
+func (c *snapshotChunk) decode(data []byte) error {
+	return decode(c, data)
+}
@@ -0,0 +1,83 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotTransfer_ChunksAreApplied(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+	router := newDummyRouter(t)
+	node.Router = router
+
+	a.NoError(router.kvStore.Put("fcm_registration", "marvin", []byte("token1")))
+	a.NoError(router.kvStore.Put("fcm_registration", "zaphod", []byte("token2")))
+	for id := uint64(1); id <= 5; id++ {
+		a.NoError(router.store.Store("p", id, []byte{byte('0' + id)}))
+	}
+
+	var chunks []*snapshotChunk
+	err = node.snapshots.chunks(&snapshotRequest{Schemas: []string{"fcm_registration"}, Messages: 3},
+		func(chunk *snapshotChunk) error {
+			chunks = append(chunks, chunk)
+			return nil
+		})
+	a.NoError(err)
+	a.Len(chunks, 2)
+
+	joiningConf := testConfig()
+	joining, err := New(&joiningConf)
+	a.NoError(err)
+	defer joining.Stop()
+	joiningRouter := newDummyRouter(t)
+	joining.Router = joiningRouter
+
+	// a message already stored by the joining node is not stored again
+	a.NoError(joiningRouter.store.Store("p", 3, []byte("3")))
+	for _, chunk := range chunks {
+		a.NoError(joining.snapshots.apply(chunk))
+	}
+
+	value, exists, err := joiningRouter.kvStore.Get("fcm_registration", "zaphod")
+	a.NoError(err)
+	a.True(exists)
+	a.Equal("token2", string(value))
+
+	maxID, err := joiningRouter.store.MaxMessageID("p")
+	a.NoError(err)
+	a.Equal(uint64(5), maxID)
+	p, err := joiningRouter.store.Partition("p")
+	a.NoError(err)
+	a.Equal(uint64(3), p.Count())
+}
+
+func TestSnapshotTransfer_ChunkIsPassedToPendingTransfer(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	p := &pendingSnapshot{chunkC: make(chan *snapshotChunk, 1), doneC: make(chan struct{})}
+	node.snapshots.pending[7] = p
+
+	data, err := (&snapshotChunk{RequestID: 7, Last: true, Chunks: 2}).encode()
+	a.NoError(err)
+	a.NoError(node.snapshots.handleChunk(data))
+
+	chunk := <-p.chunkC
+	a.True(chunk.Last)
+	a.Equal(2, chunk.Chunks)
+
+	// the chunks of a finished transfer are dropped
+	close(p.doneC)
+	a.NoError(node.snapshots.handleChunk(data))
+	a.NoError(node.snapshots.handleChunk(data))
+}
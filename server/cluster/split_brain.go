@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"errors"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/memberlist"
+)
+
+// SplitBrainPolicy is the behaviour of a node when the cluster is split by a network partition.
+type SplitBrainPolicy string
+
+const (
+	// SplitBrainIgnore lets all the nodes accept messages, whatever the number of nodes they see.
+	SplitBrainIgnore SplitBrainPolicy = "ignore"
+
+	// SplitBrainQuorum lets only the nodes seeing a strict majority of the cluster accept messages:
+	// when the cluster is split in two halves, none of them accepts messages.
+	SplitBrainQuorum SplitBrainPolicy = "quorum"
+
+	// SplitBrainReadOnly makes the minority read-only; when the cluster is split in two halves,
+	// the half containing the node with the lowest ID keeps accepting messages.
+	SplitBrainReadOnly SplitBrainPolicy = "read-only"
+
+	// SplitBrainMerge lets all the nodes accept messages, and synchronizes the partitions again when the nodes rejoin,
+	// skipping the messages already stored.
+	SplitBrainMerge SplitBrainPolicy = "merge"
+)
+
+var ErrNoQuorum = errors.New("This node does not see a majority of the cluster: it does not accept messages")
+
+// SplitBrainPolicies returns the names of all the policies.
+func SplitBrainPolicies() []string {
+	return []string{
+		string(SplitBrainIgnore),
+		string(SplitBrainQuorum),
+		string(SplitBrainReadOnly),
+		string(SplitBrainMerge),
+	}
+}
+
+// HasQuorum returns true if this node sees a strict majority of the nodes of the cluster
+// (or exactly the half containing the lowest node ID, with the read-only policy).
+// The size of the cluster is the configured Size, or else the number of nodes seen since this node started.
+func (cluster *Cluster) HasQuorum() bool {
+	return cluster.hasQuorum(cluster.memberIDs())
+}
+
+// hasQuorum returns true if the (sorted) live members are a majority of the cluster.
+func (cluster *Cluster) hasQuorum(members []uint8) bool {
+	if len(members) == 0 {
+		// not started yet
+		return true
+	}
+
+	cluster.knownMutex.Lock()
+	defer cluster.knownMutex.Unlock()
+
+	size := cluster.Config.Size
+	if size <= 0 {
+		size = len(cluster.knownNodes)
+	}
+	if 2*len(members) > size {
+		return true
+	}
+	if cluster.Config.SplitBrainPolicy == SplitBrainReadOnly && 2*len(members) == size {
+		return members[0] == cluster.lowestKnownNode()
+	}
+	return false
+}
+
+// AcceptsWrites returns ErrNoQuorum if, according to the split-brain policy,
+// this node should not accept the messages received from its clients.
+func (cluster *Cluster) AcceptsWrites() error {
+	switch cluster.Config.SplitBrainPolicy {
+	case SplitBrainQuorum, SplitBrainReadOnly:
+		if !cluster.HasQuorum() {
+			return ErrNoQuorum
+		}
+	}
+	return nil
+}
+
+// lowestKnownNode returns the lowest ID of the nodes seen since this node started; knownMutex should be locked.
+func (cluster *Cluster) lowestKnownNode() uint8 {
+	var lowest uint8
+	for id := range cluster.knownNodes {
+		if lowest == 0 || id < lowest {
+			lowest = id
+		}
+	}
+	return lowest
+}
+
+// trackJoin records a joining node, and returns true if the node was already seen (i.e. it rejoins the cluster).
+func (cluster *Cluster) trackJoin(node *memberlist.Node) bool {
+	id, err := strconv.ParseUint(node.Name, 10, 8)
+	if err != nil {
+		return false
+	}
+
+	cluster.knownMutex.Lock()
+	defer cluster.knownMutex.Unlock()
+
+	if cluster.knownNodes == nil {
+		cluster.knownNodes = make(map[uint8]bool)
+	}
+	rejoined := cluster.knownNodes[uint8(id)]
+	cluster.knownNodes[uint8(id)] = true
+	return rejoined
+}
+
+// checkSplitBrain logs the loss or the recovery of the quorum after a membership change,
+// and lets the partitions of a rejoining node be synchronized again with the merge policy.
+func (cluster *Cluster) checkSplitBrain(node *memberlist.Node, rejoined bool) {
+	if cluster.Config.SplitBrainPolicy == "" || cluster.Config.SplitBrainPolicy == SplitBrainIgnore {
+		return
+	}
+
+	hasQuorum := cluster.HasQuorum()
+	cluster.knownMutex.Lock()
+	changed := hasQuorum != cluster.hadQuorum
+	cluster.hadQuorum = hasQuorum
+	cluster.knownMutex.Unlock()
+
+	if changed {
+		fields := log.Fields{
+			"node":    node.Name,
+			"members": cluster.memberIDs(),
+			"policy":  cluster.Config.SplitBrainPolicy,
+		}
+		if hasQuorum {
+			logger.WithFields(fields).Info("Cluster is not split anymore")
+		} else {
+			logger.WithFields(fields).Warn("Cluster is split: this node does not see a majority of the nodes")
+		}
+	}
+
+	if rejoined && cluster.Config.SplitBrainPolicy == SplitBrainMerge && cluster.synchronizer != nil {
+		if id, err := strconv.ParseUint(node.Name, 10, 8); err == nil {
+			cluster.synchronizer.forget(uint8(id))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCluster_HasQuorum(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	for _, name := range []string{"1", "2", "3", "4"} {
+		a.False(node.trackJoin(&memberlist.Node{Name: name}))
+	}
+	a.True(node.trackJoin(&memberlist.Node{Name: "2"}))
+
+	a.True(node.hasQuorum([]uint8{1, 2, 3}))
+	a.False(node.hasQuorum([]uint8{3}))
+
+	// two halves: none of them has a quorum
+	a.False(node.hasQuorum([]uint8{1, 2}))
+	a.False(node.hasQuorum([]uint8{3, 4}))
+
+	// the half with the lowest node ID keeps accepting messages when only the minority is read-only
+	node.Config.SplitBrainPolicy = SplitBrainReadOnly
+	a.True(node.hasQuorum([]uint8{1, 2}))
+	a.False(node.hasQuorum([]uint8{3, 4}))
+
+	// the configured size of the cluster takes precedence over the nodes seen
+	node.Config.Size = 7
+	a.False(node.hasQuorum([]uint8{1, 2, 3}))
+}
+
+func TestCluster_AcceptsWrites(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	// the members of the stopped memberlist are not known: the writes are accepted
+	for _, policy := range []SplitBrainPolicy{SplitBrainIgnore, SplitBrainQuorum, SplitBrainReadOnly, SplitBrainMerge} {
+		node.Config.SplitBrainPolicy = policy
+		a.NoError(node.AcceptsWrites())
+	}
+}
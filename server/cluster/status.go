@@ -0,0 +1,228 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+const (
+	statusPrefix = "/admin/cluster/"
+
+	// pingInterval is the interval of measuring the round-trip latency to the other nodes,
+	// and of sending the load of this node to them
+	pingInterval = 5 * time.Second
+)
+
+// NodeStatus is the status of a cluster member, as seen by this node.
+type NodeStatus struct {
+	ID                uint8      `json:"id"`
+	Address           string     `json:"address,omitempty"`
+	Alive             bool       `json:"alive"`
+	LastSeen          *time.Time `json:"last_seen,omitempty"`
+	LastMessageID     uint64     `json:"last_message_id"`
+	ForwardingBacklog int64      `json:"forwarding_backlog"`
+	RoundTripMillis   float64    `json:"round_trip_ms"`
+	Connections       int64      `json:"connections"`
+	Users             int64      `json:"users"`
+	Subscriptions     int64      `json:"subscriptions"`
+}
+
+// Status is the status of the cluster, as seen by this node.
+type Status struct {
+	NodeID uint8 `json:"node_id"`
+	// Address is the address of this node for the cluster traffic
+	Address string       `json:"address,omitempty"`
+	Quorum  bool         `json:"quorum"`
+	Members []NodeStatus `json:"members"`
+}
+
+// nodeStats are the statistics collected about the messages exchanged with a node.
+type nodeStats struct {
+	lastSeen      time.Time
+	lastMessageID uint64
+	backlog       int64
+	roundTrip     time.Duration
+	load          nodeLoad
+}
+
+type statistics struct {
+	sync.Mutex
+	nodes map[uint8]*nodeStats
+}
+
+// update calls the function with the statistics of the node, creating them if needed.
+func (s *statistics) update(nodeID uint8, f func(*nodeStats)) {
+	s.Lock()
+	defer s.Unlock()
+	if s.nodes == nil {
+		s.nodes = make(map[uint8]*nodeStats)
+	}
+	stats, ok := s.nodes[nodeID]
+	if !ok {
+		stats = &nodeStats{}
+		s.nodes[nodeID] = stats
+	}
+	f(stats)
+}
+
+// Status returns the liveness of all the known cluster members, the ID of the last message received from each of them,
+// the number of messages being sent to them, and the round-trip latency to them.
+func (cluster *Cluster) Status() *Status {
+	status := &Status{NodeID: cluster.Config.ID, Quorum: cluster.HasQuorum()}
+	if local := cluster.memberlist.LocalNode(); local != nil {
+		status.Address = net.JoinHostPort(local.Addr.String(), strconv.Itoa(int(local.Port)))
+	}
+
+	cluster.stats.Lock()
+	defer cluster.stats.Unlock()
+
+	alive := make(map[uint8]bool)
+	for _, node := range cluster.memberlist.Members() {
+		id, err := strconv.ParseUint(node.Name, 10, 8)
+		if err != nil || uint8(id) == cluster.Config.ID {
+			continue
+		}
+		alive[uint8(id)] = true
+		ns := NodeStatus{
+			ID:      uint8(id),
+			Address: net.JoinHostPort(node.Addr.String(), strconv.Itoa(int(node.Port))),
+			Alive:   true,
+		}
+		status.Members = append(status.Members, cluster.withStats(ns))
+	}
+	for id := range cluster.stats.nodes {
+		if !alive[id] {
+			status.Members = append(status.Members, cluster.withStats(NodeStatus{ID: id}))
+		}
+	}
+
+	sort.Slice(status.Members, func(i, j int) bool { return status.Members[i].ID < status.Members[j].ID })
+	return status
+}
+
+// withStats adds the collected statistics of the node to its status; the statistics should be locked.
+func (cluster *Cluster) withStats(ns NodeStatus) NodeStatus {
+	ns.ForwardingBacklog = int64(cluster.queueLength(strconv.Itoa(int(ns.ID))))
+	stats, ok := cluster.stats.nodes[ns.ID]
+	if !ok {
+		return ns
+	}
+	if !stats.lastSeen.IsZero() {
+		lastSeen := stats.lastSeen
+		ns.LastSeen = &lastSeen
+	}
+	ns.LastMessageID = stats.lastMessageID
+	ns.ForwardingBacklog += stats.backlog
+	ns.RoundTripMillis = float64(stats.roundTrip) / float64(time.Millisecond)
+	ns.Connections = stats.load.Connections
+	ns.Users = stats.load.Users
+	ns.Subscriptions = stats.load.Subscriptions
+	return ns
+}
+
+// ServeHTTP returns the Status of the cluster as JSON, and handles the membership requests.
+func (cluster *Cluster) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if path, ok := splitMembersPath(req.URL.Path); ok && req.Method != http.MethodGet {
+		cluster.serveMembers(w, req, path)
+		return
+	}
+
+	if req.Method != http.MethodGet {
+		http.Error(w, `{"error": Error method not allowed.Only HTTP GET is accepted}`, http.StatusMethodNotAllowed)
+		return
+	}
+	cluster.writeStatus(w)
+}
+
+func (cluster *Cluster) writeStatus(w http.ResponseWriter) {
+	if err := json.NewEncoder(w).Encode(cluster.Status()); err != nil {
+		http.Error(w, `{"error":Error encoding data.}`, http.StatusInternalServerError)
+		logger.WithField("error", err.Error()).Error("Error encoding data.")
+	}
+}
+
+// GetPrefix returns the prefix of the cluster status and membership endpoint.
+func (cluster *Cluster) GetPrefix() string {
+	return statusPrefix
+}
+
+// pingLoop periodically sends a ping to the other nodes, for measuring the round-trip latency,
+// and sends them the load of this node.
+func (cluster *Cluster) pingLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			body := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+			cmsg := cluster.newMessage(mtPing, body)
+			data, err := cmsg.encode()
+			if err != nil {
+				logger.WithError(err).Error("Could not encode ping")
+				continue
+			}
+			for _, node := range cluster.memberlist.Members() {
+				if node.Name != cluster.name {
+					cluster.enqueue(node, data)
+				}
+			}
+			cluster.sendLoad()
+		case <-cluster.statusStopC:
+			return
+		}
+	}
+}
+
+// handlePing sends the ping back to its sender.
+func (cluster *Cluster) handlePing(cmsg *message) {
+	if err := cluster.sendMessageToNodeID(cmsg.NodeID, cluster.newMessage(mtPong, cmsg.Body)); err != nil {
+		logger.WithError(err).WithField("node", cmsg.NodeID).Debug("Could not answer ping")
+	}
+}
+
+// handlePong records the round-trip latency of a ping sent by this node.
+func (cluster *Cluster) handlePong(cmsg *message) {
+	sent, err := strconv.ParseInt(string(cmsg.Body), 10, 64)
+	if err != nil {
+		logger.WithError(err).Error("Invalid pong")
+		return
+	}
+	roundTrip := time.Duration(time.Now().UnixNano() - sent)
+	cluster.stats.update(cmsg.NodeID, func(s *nodeStats) { s.roundTrip = roundTrip })
+}
+
+// seen records that a message was received from the node.
+func (cluster *Cluster) seen(cmsg *message) {
+	cluster.stats.update(cmsg.NodeID, func(s *nodeStats) { s.lastSeen = time.Now() })
+}
+
+// seenMessageID records the ID of a guble message received from the node.
+func (cluster *Cluster) seenMessageID(nodeID uint8, id uint64) {
+	cluster.stats.update(nodeID, func(s *nodeStats) {
+		if id > s.lastMessageID {
+			s.lastMessageID = id
+		}
+	})
+}
+
+// sending tracks the backlog of messages being sent to the node: it returns the function to call after sending.
+func (cluster *Cluster) sending(node *memberlist.Node) func() {
+	id, err := strconv.ParseUint(node.Name, 10, 8)
+	if err != nil {
+		return func() {}
+	}
+	cluster.stats.update(uint8(id), func(s *nodeStats) { s.backlog++ })
+	return func() {
+		cluster.stats.update(uint8(id), func(s *nodeStats) { s.backlog-- })
+	}
+}
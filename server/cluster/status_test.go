@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+)
+
+func TestCluster_StatusOfNodes(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+	node.Router = newDummyRouter(t)
+
+	// a guble message and a pong received from node 200, which is not a member anymore
+	m := &protocol.Message{ID: 42, Path: "/foo", Body: []byte("bar")}
+	data, err := (&message{NodeID: 200, Type: mtGubleMessage, Body: m.Bytes()}).encode()
+	a.NoError(err)
+	node.NotifyMsg(data)
+
+	sent := time.Now().Add(-20 * time.Millisecond).UnixNano()
+	data, err = (&message{NodeID: 200, Type: mtPong, Body: []byte(strconv.FormatInt(sent, 10))}).encode()
+	a.NoError(err)
+	node.NotifyMsg(data)
+
+	status := node.Status()
+	a.Equal(conf.ID, status.NodeID)
+	a.Contains(status.Address, ":"+strconv.Itoa(conf.Port))
+	if a.Len(status.Members, 1) {
+		ns := status.Members[0]
+		a.Equal(uint8(200), ns.ID)
+		a.False(ns.Alive)
+		a.NotNil(ns.LastSeen)
+		a.Equal(uint64(42), ns.LastMessageID)
+		a.Equal(int64(0), ns.ForwardingBacklog)
+		a.True(ns.RoundTripMillis >= 20)
+	}
+}
+
+func TestCluster_ServeHTTP(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	a.Equal("/admin/cluster/", node.GetPrefix())
+
+	w := httptest.NewRecorder()
+	node.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/cluster", nil))
+	a.Equal(http.StatusOK, w.Code)
+
+	status := &Status{}
+	a.NoError(json.Unmarshal(w.Body.Bytes(), status))
+	a.Equal(conf.ID, status.NodeID)
+
+	w = httptest.NewRecorder()
+	node.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/cluster", nil))
+	a.Equal(http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/memberlist"
+
+	"github.com/smancke/guble/protocol"
+)
+
+// subscriptionRegistry keeps the topic paths subscribed on each node of the cluster,
+// so that a message is sent only to the nodes having subscribers for it.
+type subscriptionRegistry struct {
+	mutex sync.RWMutex
+
+	// local are the paths subscribed on this node, and version increases on each of their changes,
+	// also across the restarts of the node
+	local   []protocol.Path
+	version uint64
+
+	nodes map[uint8]*nodeSubscriptions
+}
+
+type nodeSubscriptions struct {
+	Version uint64
+	Paths   []protocol.Path
+}
+
+func (s *nodeSubscriptions) encode() ([]byte, error) {
+	return encode(s)
+}
+
+func (s *nodeSubscriptions) decode(data []byte) error {
+	return decode(s, data)
+}
+
+func newSubscriptionRegistry() *subscriptionRegistry {
+	return &subscriptionRegistry{nodes: make(map[uint8]*nodeSubscriptions)}
+}
+
+// registryEnabled returns true if the messages are sent only to the interested nodes;
+// without partitioning, all the nodes store all the messages, so the messages are sent to all of them.
+func (cluster *Cluster) registryEnabled() bool {
+	return cluster.Config.SubscriptionRegistry && cluster.Config.Partitioning
+}
+
+// UpdateSubscriptions replaces the topic paths subscribed on this node, and sends them to the other nodes.
+// It should be called by the router each time a path gets its first subscriber, or loses its last one.
+func (cluster *Cluster) UpdateSubscriptions(paths []protocol.Path) {
+	if !cluster.registryEnabled() {
+		return
+	}
+
+	r := cluster.registry
+	r.mutex.Lock()
+	r.version++
+	if now := uint64(time.Now().UnixNano()); now > r.version {
+		r.version = now
+	}
+	r.local = paths
+	cmsg, err := cluster.newEncoderMessage(mtSubscriptions, &nodeSubscriptions{Version: r.version, Paths: paths})
+	r.mutex.Unlock()
+	if err != nil {
+		logger.WithError(err).Error("Could not encode the subscriptions")
+		return
+	}
+
+	cluster.broadcastClusterMessage(cmsg)
+}
+
+// sendSubscriptions sends the paths subscribed on this node to a node joining the cluster.
+func (cluster *Cluster) sendSubscriptions(node *memberlist.Node) {
+	if !cluster.registryEnabled() {
+		return
+	}
+
+	r := cluster.registry
+	r.mutex.RLock()
+	cmsg, err := cluster.newEncoderMessage(mtSubscriptions, &nodeSubscriptions{Version: r.version, Paths: r.local})
+	r.mutex.RUnlock()
+	if err != nil {
+		logger.WithError(err).Error("Could not encode the subscriptions")
+		return
+	}
+	data, err := cmsg.encode()
+	if err != nil {
+		logger.WithError(err).Error("Could not encode the subscriptions")
+		return
+	}
+	cluster.enqueue(node, data)
+}
+
+// handleSubscriptions registers the paths subscribed on another node, unless they are older than the registered ones.
+func (cluster *Cluster) handleSubscriptions(cmsg *message) {
+	subscriptions := &nodeSubscriptions{}
+	if err := subscriptions.decode(cmsg.Body); err != nil {
+		logger.WithError(err).Error("Error decoding subscriptions")
+		return
+	}
+
+	r := cluster.registry
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if current, ok := r.nodes[cmsg.NodeID]; ok && current.Version >= subscriptions.Version {
+		return
+	}
+	r.nodes[cmsg.NodeID] = subscriptions
+	logger.WithFields(log.Fields{
+		"node":  cmsg.NodeID,
+		"paths": len(subscriptions.Paths),
+	}).Debug("Registered the subscriptions of node")
+}
+
+// forgetSubscriptions removes the subscriptions of a node leaving the cluster.
+func (cluster *Cluster) forgetSubscriptions(node *memberlist.Node) {
+	if id, ok := parseNodeID(node); ok {
+		r := cluster.registry
+		r.mutex.Lock()
+		delete(r.nodes, id)
+		r.mutex.Unlock()
+	}
+}
+
+// interested returns true if the node has subscribers for the path,
+// or if its subscriptions are not known yet.
+func (cluster *Cluster) interested(node *memberlist.Node, path protocol.Path) bool {
+	id, ok := parseNodeID(node)
+	if !ok {
+		return true
+	}
+
+	r := cluster.registry
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	subscriptions, ok := r.nodes[id]
+	if !ok {
+		return true
+	}
+	for _, p := range subscriptions.Paths {
+		if matchesTopic(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesTopic returns true if a message of the path is delivered to the subscribers of the topic,
+// the same way as the router matches its routes.
+func matchesTopic(path, topic protocol.Path) bool {
+	return path == topic || strings.HasPrefix(string(path), string(topic)+"/")
+}
@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+)
+
+func TestMatchesTopic(t *testing.T) {
+	a := assert.New(t)
+
+	a.True(matchesTopic("/foo", "/foo"))
+	a.True(matchesTopic("/foo/bar", "/foo"))
+	a.False(matchesTopic("/foobar", "/foo"))
+	a.False(matchesTopic("/foo", "/foo/bar"))
+}
+
+func TestCluster_SubscriptionRegistry(t *testing.T) {
+	a := assert.New(t)
+
+	conf := testConfig()
+	conf.Partitioning = true
+	conf.SubscriptionRegistry = true
+	node, err := New(&conf)
+	a.NoError(err)
+	defer node.Stop()
+
+	receive := func(nodeID uint8, s *nodeSubscriptions) {
+		cmsg, err := node.newEncoderMessage(mtSubscriptions, s)
+		a.NoError(err)
+		cmsg.NodeID = nodeID
+		data, err := cmsg.encode()
+		a.NoError(err)
+		node.NotifyMsg(data)
+	}
+	node2 := &memberlist.Node{Name: "2"}
+
+	// the subscriptions of the node are not known yet
+	a.True(node.interested(node2, "/foo"))
+
+	receive(2, &nodeSubscriptions{Version: 2, Paths: []protocol.Path{"/foo", "/bar/baz"}})
+	a.True(node.interested(node2, "/foo/1"))
+	a.True(node.interested(node2, "/bar/baz"))
+	a.False(node.interested(node2, "/bar"))
+
+	// older subscriptions are ignored
+	receive(2, &nodeSubscriptions{Version: 1, Paths: []protocol.Path{"/bar"}})
+	a.False(node.interested(node2, "/bar"))
+
+	receive(2, &nodeSubscriptions{Version: 3})
+	a.False(node.interested(node2, "/foo"))
+
+	node.forgetSubscriptions(node2)
+	a.True(node.interested(node2, "/foo"))
+}
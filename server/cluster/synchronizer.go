@@ -86,6 +86,14 @@ func (s *synchronizer) inSyncID(nodeID uint8) bool {
 	return in
 }
 
+// forget removes the node from the nodes in sync, so that the partitions are synchronized again when it rejoins.
+func (s *synchronizer) forget(nodeID uint8) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.nodes, nodeID)
+}
+
 // addNode adds the node to the state with the missing partitions
 func (s *synchronizer) addNode(nodeID uint8, partitions partitions) {
 	s.Lock()
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"github.com/smancke/guble/server/cluster"
+	"github.com/smancke/guble/server/webserver"
+
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// clusterSecretKeySize is the size of the AES keys generated by `gubled cluster init`
+const clusterSecretKeySize = 32
+
+// seedNode is a node of the configuration generated for a new cluster or for a node joining it.
+type seedNode struct {
+	id      uint8
+	port    int
+	address string
+	remotes []string
+}
+
+// runCluster runs a subcommand of `gubled cluster`: init, join or status.
+func runCluster(command string, w io.Writer) error {
+	if err := resolveSecrets(); err != nil {
+		return fmt.Errorf("the secrets can not be resolved: %v", err)
+	}
+	switch command {
+	case clusterInitCommand.FullCommand():
+		return runClusterInit(*clusterInitHosts, *clusterInitOutputDir, w)
+	case clusterJoinCommand.FullCommand():
+		return runClusterJoin(*clusterAdminURL, w)
+	case clusterStatusCommand.FullCommand():
+		return runClusterStatus(*clusterAdminURL, w)
+	}
+	return fmt.Errorf("unknown command %q", command)
+}
+
+// runClusterInit generates the configuration of the nodes of a new cluster, one per host: their node IDs,
+// the remotes joined at startup, the expected size of the cluster and the secret key (a new one unless
+// --cluster-secret-key is given). It prints the configurations as YAML documents, or writes them to
+// node-<id>.yaml files of the output directory.
+func runClusterInit(hosts []string, outputDir string, w io.Writer) error {
+	if len(hosts) > 255 {
+		return fmt.Errorf("a cluster has at most 255 nodes")
+	}
+	secretKey, err := clusterInitSecretKey()
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]seedNode, 0, len(hosts))
+	addresses := make(map[string]bool)
+	for i, host := range hosts {
+		address, port, err := nodeAddress(host)
+		if err != nil {
+			return err
+		}
+		if addresses[address] {
+			return fmt.Errorf("the node %s is given twice", address)
+		}
+		addresses[address] = true
+		nodes = append(nodes, seedNode{id: uint8(i + 1), port: port, address: address})
+	}
+	for i := range nodes {
+		for _, other := range nodes {
+			if other.id != nodes[i].id {
+				nodes[i].remotes = append(nodes[i].remotes, other.address)
+			}
+		}
+	}
+
+	for i, node := range nodes {
+		config := node.config(secretKey, len(nodes))
+		if outputDir == "" {
+			if i > 0 {
+				fmt.Fprintln(w, "---")
+			}
+			fmt.Fprint(w, config)
+			continue
+		}
+		path := filepath.Join(outputDir, fmt.Sprintf("node-%d.yaml", node.id))
+		if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Wrote the configuration of node %d (%s) to %s\n", node.id, node.address, path)
+	}
+	return nil
+}
+
+// runClusterJoin generates the configuration of a new node joining the cluster of the running node:
+// the next free node ID (or --node-id if it is free), and the addresses of the alive nodes as remotes.
+func runClusterJoin(adminURL string, w io.Writer) error {
+	status, err := fetchClusterStatus(adminURL)
+	if err != nil {
+		return err
+	}
+	used := map[uint8]bool{status.NodeID: true}
+	node := seedNode{id: *Config.Cluster.NodeID, port: *Config.Cluster.NodePort}
+	if status.Address != "" {
+		node.remotes = append(node.remotes, status.Address)
+	}
+	for _, member := range status.Members {
+		used[member.ID] = true
+		if member.Alive && member.Address != "" {
+			node.remotes = append(node.remotes, member.Address)
+		}
+	}
+
+	if node.id == 0 {
+		for id := 1; id <= 255 && node.id == 0; id++ {
+			if !used[uint8(id)] {
+				node.id = uint8(id)
+			}
+		}
+		if node.id == 0 {
+			return fmt.Errorf("the cluster has no free node ID")
+		}
+	} else if used[node.id] {
+		return fmt.Errorf("the node ID %d is already used in the cluster", node.id)
+	}
+	fmt.Fprint(w, node.config(*Config.Cluster.SecretKey, 0))
+	return nil
+}
+
+// runClusterStatus prints the members of the cluster, as seen by the running node.
+func runClusterStatus(adminURL string, w io.Writer) error {
+	status, err := fetchClusterStatus(adminURL)
+	if err != nil {
+		return err
+	}
+	quorum := "yes"
+	if !status.Quorum {
+		quorum = "no"
+	}
+	fmt.Fprintf(w, "Node %d (%s), quorum: %s\n\n", status.NodeID, status.Address, quorum)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tADDRESS\tALIVE\tLAST SEEN\tLAST MESSAGE\tBACKLOG\tROUND TRIP")
+	for _, member := range status.Members {
+		alive, lastSeen := "yes", "-"
+		if !member.Alive {
+			alive = "no"
+		}
+		if member.LastSeen != nil {
+			lastSeen = time.Since(*member.LastSeen).Truncate(time.Second).String() + " ago"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%.1fms\n", member.ID, member.Address, alive, lastSeen,
+			member.LastMessageID, member.ForwardingBacklog, member.RoundTripMillis)
+	}
+	return tw.Flush()
+}
+
+// fetchClusterStatus returns the status of the cluster endpoint of a running node,
+// authenticated with the admin credentials of the configuration.
+func fetchClusterStatus(adminURL string) (*cluster.Status, error) {
+	req, err := http.NewRequest(http.MethodGet, adminURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if *Config.AdminAuth.Password != "" {
+		req.SetBasicAuth(*Config.AdminAuth.Username, *Config.AdminAuth.Password)
+	}
+	if *Config.AdminAuth.APIKey != "" {
+		req.Header.Set(webserver.AdminKeyHeader, *Config.AdminAuth.APIKey)
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("the cluster status can not be fetched: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("the cluster status can not be fetched: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	status := &cluster.Status{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, fmt.Errorf("invalid cluster status: %v", err)
+	}
+	return status, nil
+}
+
+// clusterInitSecretKey returns the configured cluster secret key, or a new random one.
+func clusterInitSecretKey() (string, error) {
+	if *Config.Cluster.SecretKey != "" {
+		return *Config.Cluster.SecretKey, nil
+	}
+	key := make([]byte, clusterSecretKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// nodeAddress returns the address "host:port" of a node given as "host[:port]", the port defaulting to --node-port.
+func nodeAddress(node string) (string, int, error) {
+	host, port := node, *Config.Cluster.NodePort
+	if h, p, err := net.SplitHostPort(node); err == nil {
+		if port, err = strconv.Atoi(p); err != nil || port <= 0 {
+			return "", 0, fmt.Errorf("invalid port of the node %q", node)
+		}
+		host = h
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("invalid node %q: the host is missing", node)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), port, nil
+}
+
+// config returns the configuration of the node as a YAML config file; the secret key and the size are omitted
+// if they are empty.
+func (n seedNode) config(secretKey string, size int) string {
+	var b strings.Builder
+	if n.address != "" {
+		fmt.Fprintf(&b, "# guble node %d (%s)\n", n.id, n.address)
+	}
+	fmt.Fprintf(&b, "node-id: %d\n", n.id)
+	fmt.Fprintf(&b, "node-port: %d\n", n.port)
+	if len(n.remotes) > 0 {
+		fmt.Fprintln(&b, "remotes:")
+		for _, remote := range n.remotes {
+			fmt.Fprintf(&b, "  - %q\n", remote)
+		}
+	}
+	if size > 0 {
+		fmt.Fprintf(&b, "cluster-size: %d\n", size)
+	}
+	if secretKey != "" {
+		fmt.Fprintf(&b, "cluster-secret-key: %q\n", secretKey)
+	}
+	return b.String()
+}
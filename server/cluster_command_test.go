@@ -0,0 +1,176 @@
+package server
+
+import (
+	"github.com/smancke/guble/server/cluster"
+	"github.com/smancke/guble/server/webserver"
+
+	"github.com/stretchr/testify/assert"
+
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClusterInit(t *testing.T) {
+	a := assert.New(t)
+	*Config.Cluster.NodePort = 10000
+
+	buff := &bytes.Buffer{}
+	a.NoError(runClusterInit([]string{"10.0.0.1", "10.0.0.2:10001", "guble-3"}, "", buff))
+
+	// the nodes share a new secret key
+	keys := regexp.MustCompile(`cluster-secret-key: "(.*)"`).FindAllStringSubmatch(buff.String(), -1)
+	if a.Len(keys, 3) {
+		key, err := base64.StdEncoding.DecodeString(keys[0][1])
+		a.NoError(err)
+		a.Len(key, 32)
+		a.Equal(keys[0][1], keys[1][1])
+		a.Equal(keys[0][1], keys[2][1])
+	}
+
+	docs := strings.Split(buff.String(), "---\n")
+	if a.Len(docs, 3) {
+		a.Equal(`# guble node 2 (10.0.0.2:10001)
+node-id: 2
+node-port: 10001
+remotes:
+  - "10.0.0.1:10000"
+  - "guble-3:10000"
+cluster-size: 3
+cluster-secret-key: "`+keys[0][1]+`"
+`, docs[1])
+	}
+
+	// the configured key is kept
+	*Config.Cluster.SecretKey = "c2VjcmV0"
+	defer func() { *Config.Cluster.SecretKey = "" }()
+	buff.Reset()
+	a.NoError(runClusterInit([]string{"10.0.0.1", "10.0.0.2"}, "", buff))
+	a.Equal(2, strings.Count(buff.String(), `cluster-secret-key: "c2VjcmV0"`))
+}
+
+func TestClusterInit_OutputDir(t *testing.T) {
+	a := assert.New(t)
+	*Config.Cluster.NodePort = 10000
+
+	dir, err := ioutil.TempDir("", "guble_cluster_init_test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	buff := &bytes.Buffer{}
+	a.NoError(runClusterInit([]string{"10.0.0.1", "10.0.0.2"}, dir, buff))
+	a.Equal("Wrote the configuration of node 1 (10.0.0.1:10000) to "+filepath.Join(dir, "node-1.yaml")+"\n"+
+		"Wrote the configuration of node 2 (10.0.0.2:10000) to "+filepath.Join(dir, "node-2.yaml")+"\n", buff.String())
+
+	info, err := os.Stat(filepath.Join(dir, "node-2.yaml"))
+	a.NoError(err)
+	a.Equal(os.FileMode(0600), info.Mode().Perm())
+	data, err := ioutil.ReadFile(filepath.Join(dir, "node-2.yaml"))
+	a.NoError(err)
+	a.Contains(string(data), "node-id: 2\n")
+	a.Contains(string(data), "remotes:\n  - \"10.0.0.1:10000\"\n")
+}
+
+func TestClusterInit_Errors(t *testing.T) {
+	a := assert.New(t)
+	*Config.Cluster.NodePort = 10000
+
+	err := runClusterInit([]string{"10.0.0.1", "10.0.0.1:10000"}, "", &bytes.Buffer{})
+	a.EqualError(err, "the node 10.0.0.1:10000 is given twice")
+
+	err = runClusterInit([]string{"10.0.0.1:port"}, "", &bytes.Buffer{})
+	a.EqualError(err, `invalid port of the node "10.0.0.1:port"`)
+
+	err = runClusterInit([]string{":10000"}, "", &bytes.Buffer{})
+	a.EqualError(err, `invalid node ":10000": the host is missing`)
+}
+
+// clusterEndpoint serves the status, if the request has the API key of the admin endpoints.
+func clusterEndpoint(status *cluster.Status) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(webserver.AdminKeyHeader) != "key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(status)
+	}))
+}
+
+func TestClusterJoin(t *testing.T) {
+	a := assert.New(t)
+	*Config.Cluster.NodePort = 10000
+	*Config.Cluster.SecretKey = "c2VjcmV0"
+	*Config.AdminAuth.APIKey = "key"
+	defer func() {
+		*Config.Cluster.SecretKey = ""
+		*Config.AdminAuth.APIKey = ""
+	}()
+
+	endpoint := clusterEndpoint(&cluster.Status{
+		NodeID:  1,
+		Address: "10.0.0.1:10000",
+		Members: []cluster.NodeStatus{
+			{ID: 2, Address: "10.0.0.2:10000", Alive: true},
+			{ID: 4},
+		},
+	})
+	defer endpoint.Close()
+
+	// when joining the cluster without a node ID
+	buff := &bytes.Buffer{}
+	a.NoError(runClusterJoin(endpoint.URL, buff))
+
+	// then the node has the first free ID, and the alive nodes as remotes
+	a.Equal(`node-id: 3
+node-port: 10000
+remotes:
+  - "10.0.0.1:10000"
+  - "10.0.0.2:10000"
+cluster-secret-key: "c2VjcmV0"
+`, buff.String())
+
+	// and a given node ID must be free
+	*Config.Cluster.NodeID = 4
+	defer func() { *Config.Cluster.NodeID = 0 }()
+	a.EqualError(runClusterJoin(endpoint.URL, &bytes.Buffer{}), "the node ID 4 is already used in the cluster")
+
+	*Config.AdminAuth.APIKey = "wrong"
+	err := runClusterJoin(endpoint.URL, &bytes.Buffer{})
+	a.EqualError(err, "the cluster status can not be fetched: 401 Unauthorized unauthorized")
+}
+
+func TestClusterStatus(t *testing.T) {
+	a := assert.New(t)
+	*Config.AdminAuth.APIKey = "key"
+	defer func() { *Config.AdminAuth.APIKey = "" }()
+
+	lastSeen := time.Now().Add(-3 * time.Second)
+	endpoint := clusterEndpoint(&cluster.Status{
+		NodeID:  1,
+		Address: "10.0.0.1:10000",
+		Quorum:  true,
+		Members: []cluster.NodeStatus{
+			{ID: 2, Address: "10.0.0.2:10000", Alive: true, LastSeen: &lastSeen, LastMessageID: 42, ForwardingBacklog: 5, RoundTripMillis: 1.25},
+			{ID: 4},
+		},
+	})
+	defer endpoint.Close()
+
+	buff := &bytes.Buffer{}
+	a.NoError(runClusterStatus(endpoint.URL, buff))
+	a.Equal(`Node 1 (10.0.0.1:10000), quorum: yes
+
+ID  ADDRESS         ALIVE  LAST SEEN  LAST MESSAGE  BACKLOG  ROUND TRIP
+2   10.0.0.2:10000  yes    3s ago     42            5        1.2ms
+4                   no     -          0             0        0.0ms
+`, buff.String())
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"github.com/BurntSushi/toml"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	configFileFlag   = "config"
+	configFileEnvvar = "GUBLE_CONFIG"
+)
+
+// configFilePath returns the path of the config file given with --config in the command line arguments,
+// or else in the GUBLE_CONFIG environment variable. It is needed before parsing the flags,
+// because the config file provides their defaults.
+func configFilePath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--"+configFileFlag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--"+configFileFlag+"=") {
+			return strings.TrimPrefix(arg, "--"+configFileFlag+"=")
+		}
+	}
+	return os.Getenv(configFileEnvvar)
+}
+
+// readConfigFile reads a YAML (.yaml, .yml) or TOML (.toml) config file, and returns its values by flag name.
+// The keys of the nested maps (or TOML tables) are joined to their parent key with "-",
+// e.g. the key api-key in the map fcm is the value of --fcm-api-key. The lists are the values of the repeatable flags.
+func readConfigFile(path string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q (expected .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	values := make(map[string][]string)
+	if err := flattenConfig("", raw, values); err != nil {
+		return nil, fmt.Errorf("error in config file %s: %v", path, err)
+	}
+	return values, nil
+}
+
+func flattenConfig(prefix string, value interface{}, values map[string][]string) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if err := flattenConfig(configKey(prefix, key), child, values); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		for key, child := range v {
+			if err := flattenConfig(configKey(prefix, fmt.Sprint(key)), child, values); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+				return fmt.Errorf("the list %s can only contain values", prefix)
+			}
+			list = append(list, fmt.Sprint(item))
+		}
+		values[prefix] = list
+	case nil:
+	default:
+		values[prefix] = []string{fmt.Sprint(v)}
+	}
+	return nil
+}
+
+func configKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "-" + key
+}
+
+// applyConfigFile sets the values of the config file as the defaults of the flags, so that the environment variables
+// and the command line flags still override them.
+func applyConfigFile(app *kingpin.Application, values map[string][]string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := app.GetFlag(name)
+		if flag == nil || name == configFileFlag {
+			return fmt.Errorf("unknown option %q in the config file", name)
+		}
+		flag.Default(values[name]...)
+	}
+	return nil
+}
+
+// loadConfigFile applies the config file given with --config or GUBLE_CONFIG, if there is one.
+func loadConfigFile(args []string) error {
+	path := configFilePath(args)
+	if path == "" {
+		return nil
+	}
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	return applyConfigFile(kingpin.CommandLine, values)
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "guble_config_test")
+	assert.NoError(t, err)
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestReadConfigFile(t *testing.T) {
+	a := assert.New(t)
+
+	expected := map[string][]string{
+		"http":        {":8081"},
+		"fcm":         {"true"},
+		"fcm-api-key": {"fcm-api-key"},
+		"fcm-workers": {"3"},
+		"remotes":     {"127.0.0.1:8080", "127.0.0.1:20002"},
+		"pg-host":     {"pg-host"},
+		"pg-port":     {"5432"},
+	}
+
+	yamlPath := writeConfigFile(t, "guble.yaml", `
+http: ":8081"
+fcm: true
+fcm-api-key: fcm-api-key
+fcm-workers: 3
+remotes:
+  - "127.0.0.1:8080"
+  - "127.0.0.1:20002"
+pg:
+  host: pg-host
+  port: 5432
+`)
+	defer os.RemoveAll(filepath.Dir(yamlPath))
+	values, err := readConfigFile(yamlPath)
+	a.NoError(err)
+	a.Equal(expected, values)
+
+	tomlPath := writeConfigFile(t, "guble.toml", `
+http = ":8081"
+fcm = true
+fcm-api-key = "fcm-api-key"
+fcm-workers = 3
+remotes = ["127.0.0.1:8080", "127.0.0.1:20002"]
+
+[pg]
+host = "pg-host"
+port = 5432
+`)
+	defer os.RemoveAll(filepath.Dir(tomlPath))
+	values, err = readConfigFile(tomlPath)
+	a.NoError(err)
+	a.Equal(expected, values)
+
+	iniPath := writeConfigFile(t, "guble.ini", "http=:8081")
+	defer os.RemoveAll(filepath.Dir(iniPath))
+	_, err = readConfigFile(iniPath)
+	a.Error(err)
+
+	_, err = readConfigFile("/does/not/exist.yaml")
+	a.Error(err)
+}
+
+func TestConfigFilePath(t *testing.T) {
+	a := assert.New(t)
+
+	os.Setenv(configFileEnvvar, "/etc/guble/env.yaml")
+	defer os.Unsetenv(configFileEnvvar)
+
+	a.Equal("/etc/guble/flag.yaml", configFilePath([]string{"--log", "info", "--config", "/etc/guble/flag.yaml"}))
+	a.Equal("/etc/guble/flag.toml", configFilePath([]string{"--config=/etc/guble/flag.toml"}))
+	a.Equal("/etc/guble/env.yaml", configFilePath([]string{"--log", "info"}))
+}
+
+func TestApplyConfigFile_Precedence(t *testing.T) {
+	a := assert.New(t)
+
+	app := kingpin.New("gubled", "")
+	http := app.Flag("http", "").Default(":8080").String()
+	env := app.Flag("env", "").Default("dev").Envar("GUBLE_TEST_ENV").String()
+	storagePath := app.Flag("storage-path", "").Default("/var/lib/guble").String()
+	remotes := app.Flag("remotes", "").Strings()
+	workers := app.Flag("fcm-workers", "").Default("1").Int()
+
+	os.Setenv("GUBLE_TEST_ENV", "integration")
+	defer os.Unsetenv("GUBLE_TEST_ENV")
+
+	// given a config file with all the options
+	a.NoError(applyConfigFile(app, map[string][]string{
+		"http":         {":8081"},
+		"env":          {"prod"},
+		"storage-path": {"/data"},
+		"remotes":      {"127.0.0.1:8080", "127.0.0.1:20002"},
+		"fcm-workers":  {"3"},
+	}))
+
+	// when some of them are also given as environment variables and flags
+	_, err := app.Parse([]string{"--storage-path", "/tmp/guble"})
+	a.NoError(err)
+
+	// then the flags override the environment variables, which override the config file, which overrides the defaults
+	a.Equal("/tmp/guble", *storagePath)
+	a.Equal("integration", *env)
+	a.Equal(":8081", *http)
+	a.Equal([]string{"127.0.0.1:8080", "127.0.0.1:20002"}, *remotes)
+	a.Equal(3, *workers)
+
+	// and the unknown options are rejected
+	a.Error(applyConfigFile(app, map[string][]string{"htp": {":8081"}}))
+}
@@ -0,0 +1,126 @@
+package connector
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/cluster"
+)
+
+var (
+	// DefaultClusterBalancing distributes the subscriptions of the connectors whose Config does not enable it
+	// across the cluster nodes.
+	DefaultClusterBalancing = false
+
+	// RebalanceInterval is the interval of picking up the subscriptions created or removed on the other nodes.
+	RebalanceInterval = 10 * time.Second
+)
+
+// balancer runs only the subscribers owned by this node, so that each message is pushed by a single node
+// when the connector runs on all the nodes of a cluster sharing the same KV store.
+// The subscribers are rebalanced when a node joins or leaves the cluster.
+type balancer struct {
+	cluster *cluster.Cluster
+
+	mutex   sync.Mutex
+	running map[string]Subscriber
+}
+
+func newBalancer(c *cluster.Cluster) *balancer {
+	return &balancer{
+		cluster: c,
+		running: make(map[string]Subscriber),
+	}
+}
+
+// owns returns true if the subscriber should run on this node.
+func (c *connector) owns(s Subscriber) bool {
+	return c.balancer == nil || c.balancer.cluster.OwnsKey(s.Key())
+}
+
+// runOwned runs the subscriber if it is owned by this node.
+func (c *connector) runOwned(s Subscriber) {
+	if !c.owns(s) {
+		c.logger.WithField("subscriber", s.Key()).Debug("Subscriber is owned by another node")
+		return
+	}
+	if c.balancer != nil {
+		c.balancer.mutex.Lock()
+		c.balancer.running[s.Key()] = s
+		c.balancer.mutex.Unlock()
+	}
+	go c.Run(s)
+}
+
+// startBalancing rebalances the subscribers on every membership change, and periodically.
+func (c *connector) startBalancing() {
+	if c.balancer == nil {
+		return
+	}
+	c.balancer.cluster.AddMembershipListener(c.rebalance)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(RebalanceInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.rebalance()
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// rebalance starts the subscribers this node took over, and cancels the ones now owned by another node.
+func (c *connector) rebalance() {
+	if c.ctx.Err() != nil {
+		return
+	}
+	if err := c.manager.Refresh(); err != nil {
+		c.logger.WithField("error", err.Error()).Error("Could not refresh the subscribers")
+		return
+	}
+
+	c.balancer.mutex.Lock()
+	defer c.balancer.mutex.Unlock()
+
+	subscribers := c.manager.List()
+	current := make(map[string]bool, len(subscribers))
+	var started, stopped int
+	for _, s := range subscribers {
+		current[s.Key()] = true
+		_, running := c.balancer.running[s.Key()]
+		owned := c.owns(s)
+		switch {
+		case owned && !running:
+			// resume after the last message delivered by the previous owner
+			s.Reset()
+			c.balancer.running[s.Key()] = s
+			go c.Run(s)
+			started++
+		case !owned && running:
+			s.Cancel()
+			delete(c.balancer.running, s.Key())
+			stopped++
+		}
+	}
+	for key := range c.balancer.running {
+		if !current[key] {
+			// removed on another node (and cancelled by the manager)
+			delete(c.balancer.running, key)
+		}
+	}
+
+	if started > 0 || stopped > 0 {
+		c.logger.WithFields(log.Fields{
+			"started": started,
+			"stopped": stopped,
+		}).Info("Rebalanced subscribers")
+	}
+}
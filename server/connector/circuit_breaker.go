@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const defaultOpenTimeout = 30 * time.Second
+
+// CircuitBreakerConfig configures the pausing of the sending, after repeated failures of the provider of a connector.
+type CircuitBreakerConfig struct {
+	// Failures is the number of consecutive failures opening the circuit (no circuit breaker if <= 0)
+	Failures int
+	// OpenTimeout is the time during which the circuit stays open, before trying a request again (default: 30s)
+	OpenTimeout time.Duration
+	// Failure tells whether the error is a failure of the provider (default: Temporary)
+	Failure func(error) bool
+}
+
+// DefaultCircuitBreaker is used by the connectors whose Config has no CircuitBreaker.
+var DefaultCircuitBreaker CircuitBreakerConfig
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// breakerSender is a Sender pausing the requests to another Sender while the circuit is open:
+// the requests wait in the queue of the connector, instead of failing against an unavailable provider.
+// After the open timeout, a single request is tried: its success closes the circuit, its failure opens it again.
+type breakerSender struct {
+	Sender
+	config CircuitBreakerConfig
+	name   string
+
+	mu        sync.Mutex
+	state     circuitState
+	failures  int
+	openUntil time.Time
+	// changedC is closed when the state of the circuit changes, waking up the waiting requests
+	changedC chan struct{}
+}
+
+func newBreakerSender(sender Sender, config CircuitBreakerConfig, name string) *breakerSender {
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = defaultOpenTimeout
+	}
+	if config.Failure == nil {
+		config.Failure = Temporary
+	}
+	return &breakerSender{
+		Sender:   sender,
+		config:   config,
+		name:     name,
+		changedC: make(chan struct{}),
+	}
+}
+
+func (b *breakerSender) Send(request Request) (interface{}, error) {
+	b.wait()
+	response, err := b.Sender.Send(request)
+	b.record(err)
+	return response, err
+}
+
+// wait returns when a request can be sent: the circuit is closed, or this request is the trial of the half-open circuit.
+func (b *breakerSender) wait() {
+	for {
+		b.mu.Lock()
+		var timeout time.Duration
+		switch b.state {
+		case circuitClosed:
+			b.mu.Unlock()
+			return
+		case circuitOpen:
+			timeout = b.openUntil.Sub(time.Now())
+			if timeout <= 0 {
+				b.setState(circuitHalfOpen)
+				b.mu.Unlock()
+				return
+			}
+		case circuitHalfOpen:
+			timeout = b.config.OpenTimeout
+		}
+		changedC := b.changedC
+		b.mu.Unlock()
+
+		select {
+		case <-changedC:
+		case <-time.After(timeout):
+		}
+	}
+}
+
+// record updates the circuit with the result of a request.
+func (b *breakerSender) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || !b.config.Failure(err) {
+		b.failures = 0
+		if b.state != circuitClosed {
+			logger.WithField("name", b.name).Info("Closing circuit: the provider is available again")
+			b.setState(circuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= b.config.Failures) {
+		logger.WithFields(log.Fields{
+			"name":     b.name,
+			"failures": b.failures,
+			"error":    err.Error(),
+			"timeout":  b.config.OpenTimeout,
+		}).Warn("Opening circuit: pausing the requests to the failing provider")
+		mTotalCircuitOpened.Add(b.name, 1)
+		b.openUntil = time.Now().Add(b.config.OpenTimeout)
+		b.setState(circuitOpen)
+	}
+}
+
+// setState has to be called with the mutex locked.
+func (b *breakerSender) setState(state circuitState) {
+	b.state = state
+	close(b.changedC)
+	b.changedC = make(chan struct{})
+}
@@ -0,0 +1,93 @@
+package connector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/testutil"
+)
+
+func TestBreakerSender_OpensAfterFailures(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	sender := NewMockSender(ctrl)
+	b := newBreakerSender(sender, CircuitBreakerConfig{Failures: 2, OpenTimeout: 100 * time.Millisecond}, "test")
+	request := testRetryRequest("/foo", 1)
+
+	// errors which are not failures of the provider do not open the circuit
+	sender.EXPECT().Send(request).Return(nil, errors.New("bad request")).Times(3)
+	for i := 0; i < 3; i++ {
+		b.Send(request)
+	}
+	a.Equal(circuitClosed, b.state)
+
+	sender.EXPECT().Send(request).Return(nil, temporaryError{true}).Times(2)
+	b.Send(request)
+	a.Equal(circuitClosed, b.state)
+	b.Send(request)
+	a.Equal(circuitOpen, b.state)
+
+	// the next request waits for the open timeout, and its failure opens the circuit again
+	sender.EXPECT().Send(request).Return(nil, temporaryError{true})
+	start := time.Now()
+	b.Send(request)
+	a.True(time.Since(start) >= 90*time.Millisecond)
+	a.Equal(circuitOpen, b.state)
+
+	// the success of the trial request closes the circuit
+	sender.EXPECT().Send(request).Return("ok", nil)
+	response, err := b.Send(request)
+	a.NoError(err)
+	a.Equal("ok", response)
+	a.Equal(circuitClosed, b.state)
+}
+
+func TestBreakerSender_HalfOpenSendsSingleRequest(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	sender := NewMockSender(ctrl)
+	b := newBreakerSender(sender, CircuitBreakerConfig{Failures: 1, OpenTimeout: 50 * time.Millisecond}, "test")
+	request := testRetryRequest("/foo", 1)
+
+	sender.EXPECT().Send(request).Return(nil, temporaryError{true})
+	b.Send(request)
+	a.Equal(circuitOpen, b.state)
+
+	// the trial request is slow: the other request waits for its result
+	releaseC := make(chan struct{})
+	sender.EXPECT().Send(request).Do(func(Request) { <-releaseC }).Return("ok", nil)
+	trialDone := make(chan struct{})
+	go func() {
+		b.Send(request)
+		close(trialDone)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	otherDone := make(chan struct{})
+	go func() {
+		b.Send(request)
+		close(otherDone)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-otherDone:
+		a.FailNow("request was sent while the circuit was half-open")
+	default:
+	}
+
+	sender.EXPECT().Send(request).Return("ok", nil)
+	close(releaseC)
+	<-trialDone
+	select {
+	case <-otherDone:
+	case <-time.After(time.Second):
+		a.FailNow("request was not sent after closing the circuit")
+	}
+}
@@ -17,13 +17,18 @@ import (
 )
 
 const (
-	DefaultWorkers = 1
-	SubstitutePath = "/substitute/"
+	DefaultWorkers    = 1
+	SubstitutePath    = "/substitute/"
+	SubscriptionsPath = "/subscriptions"
 )
 
 var (
 	TopicParam     = "topic"
 	ConnectorParam = "connector"
+
+	// DefaultMaxWorkers is the maximum number of workers of the connectors whose Config has no MaxWorkers
+	// (the number of workers is fixed, if it is not greater than the number of workers).
+	DefaultMaxWorkers = 0
 )
 
 type Sender interface {
@@ -57,7 +62,10 @@ type Runner interface {
 type Connector interface {
 	service.Startable
 	service.Stopable
+	service.ContextStopable
 	service.Endpoint
+	service.Dependent
+	service.Panicking
 	SenderSetter
 	ResponseHandlerSetter
 	Runner
@@ -78,6 +86,9 @@ type connector struct {
 	queue   Queue
 	router  router.Router
 
+	// balancer is set when the subscribers are distributed across the cluster nodes
+	balancer *balancer
+
 	mux *mux.Router
 
 	ctx    context.Context
@@ -85,6 +96,9 @@ type connector struct {
 
 	logger *log.Entry
 	wg     sync.WaitGroup
+
+	// the panics of the subscription loops are recovered when the connector is supervised
+	service.PanicRecorder
 }
 
 type Config struct {
@@ -93,6 +107,31 @@ type Config struct {
 	Prefix     string
 	URLPattern string
 	Workers    int
+
+	// MaxWorkers enables the scaling of the workers between Workers and MaxWorkers (default: DefaultMaxWorkers)
+	MaxWorkers int
+
+	// Retry enables the retrying of the failed requests and their dead-lettering (optional)
+	Retry *RetryConfig
+
+	// RateLimit limits the messages sent to each subscriber (default: DefaultRateLimit)
+	RateLimit *RateLimitConfig
+
+	// ReceiptTopic receives a receipt for each handled request (default: DefaultReceiptTopic)
+	ReceiptTopic string
+
+	// PayloadTemplates transform the messages into the sent payloads (default: DefaultPayloadTemplates)
+	PayloadTemplates *PayloadTemplates
+
+	// CircuitBreaker pauses the sending after repeated failures (default: DefaultCircuitBreaker)
+	CircuitBreaker *CircuitBreakerConfig
+
+	// ClusterBalancing runs each subscriber on a single node of the cluster (default: DefaultClusterBalancing)
+	ClusterBalancing bool
+
+	// QueryParams adds the query parameters of the subscription requests to the route params of the subscriptions
+	// (e.g. the URL of a webhook); otherwise, only the variables of the URL pattern are used.
+	QueryParams bool
 }
 
 func NewConnector(router router.Router, sender Sender, config Config) (Connector, error) {
@@ -104,15 +143,48 @@ func NewConnector(router router.Router, sender Sender, config Config) (Connector
 	if config.Workers <= 0 {
 		config.Workers = DefaultWorkers
 	}
+	if config.MaxWorkers <= 0 {
+		config.MaxWorkers = DefaultMaxWorkers
+	}
+	if config.ReceiptTopic == "" {
+		config.ReceiptTopic = DefaultReceiptTopic
+	}
+	if config.PayloadTemplates == nil {
+		config.PayloadTemplates = DefaultPayloadTemplates[config.Name]
+	}
+	if config.CircuitBreaker == nil && DefaultCircuitBreaker.Failures > 0 {
+		breaker := DefaultCircuitBreaker
+		config.CircuitBreaker = &breaker
+	}
+	if !config.ClusterBalancing {
+		config.ClusterBalancing = DefaultClusterBalancing
+	}
+	if config.Retry == nil && (DefaultRetry.MaxAttempts > 1 || DefaultRetry.DeadLetterTopic != "") {
+		retry := DefaultRetry
+		config.Retry = &retry
+	}
 
 	c := &connector{
 		config:  config,
-		sender:  sender,
 		manager: NewManager(config.Schema, kvs),
-		queue:   NewQueue(sender, config.Workers),
 		router:  router,
 		logger:  logger.WithField("name", config.Name),
 	}
+	if config.ClusterBalancing {
+		if cl := router.Cluster(); cl != nil {
+			c.balancer = newBalancer(cl)
+		}
+	}
+	c.sender = c.wrapSender(sender)
+	c.queue = NewScalingQueue(c.sender, config.Workers, config.MaxWorkers)
+
+	rateLimit := DefaultRateLimit
+	if config.RateLimit != nil {
+		rateLimit = *config.RateLimit
+	}
+	if rateLimit.Messages > 0 {
+		c.queue = &rateLimitedQueue{c.queue, config.Name, newRateLimiter(rateLimit)}
+	}
 	c.initMuxRouter()
 	return c, nil
 }
@@ -121,6 +193,7 @@ func (c *connector) initMuxRouter() {
 	muxRouter := mux.NewRouter()
 
 	baseRouter := muxRouter.PathPrefix(c.GetPrefix()).Subrouter()
+	baseRouter.Methods(http.MethodGet).Path(SubscriptionsPath).HandlerFunc(c.GetSubscriptions)
 	baseRouter.Methods(http.MethodGet).HandlerFunc(c.GetList)
 	baseRouter.Methods(http.MethodPost).PathPrefix(SubstitutePath).HandlerFunc(c.Substitute)
 
@@ -142,21 +215,12 @@ func (c *connector) GetPrefix() string {
 	return c.config.Prefix
 }
 
-// GetList returns list of subscribers
+// GetList returns the list of the topics of the subscribers matching the filters given as query params
 func (c *connector) GetList(w http.ResponseWriter, req *http.Request) {
-	query := req.URL.Query()
-	filters := make(map[string]string, len(query))
-
-	for key, value := range query {
-		if len(value) == 0 {
-			continue
-		}
-		filters[key] = value[0]
-	}
-
+	filters := queryFilters(req)
 	c.logger.WithField("filters", filters).Info("Get list of subscriptions")
 	if len(filters) == 0 {
-		http.Error(w, `{"error":"Missing filters"}`, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Missing filters")
 		return
 	}
 
@@ -165,23 +229,38 @@ func (c *connector) GetList(w http.ResponseWriter, req *http.Request) {
 	for _, s := range subscribers {
 		topics = append(topics, s.Route().Path.RemovePrefixSlash())
 	}
+	c.writeJSON(w, topics)
+}
 
-	encoder := json.NewEncoder(w)
-	err := encoder.Encode(topics)
-	if err != nil {
-		http.Error(w, "Error encoding data.", http.StatusInternalServerError)
-		c.logger.WithField("error", err.Error()).Error("Error encoding data.")
-		return
+// GetSubscriptions returns the subscriptions matching the filters given as query params (all, if there are none)
+func (c *connector) GetSubscriptions(w http.ResponseWriter, req *http.Request) {
+	filters := queryFilters(req)
+	c.logger.WithField("filters", filters).Info("Get subscriptions")
+
+	var subscribers []Subscriber
+	if len(filters) == 0 {
+		subscribers = c.manager.List()
+	} else {
+		subscribers = c.manager.Filter(filters)
+	}
+	subscriptions := make([]Subscription, 0, len(subscribers))
+	for _, s := range subscribers {
+		subscriptions = append(subscriptions, SubscriptionOf(s))
 	}
+	c.writeJSON(w, subscriptions)
 }
 
 // Post creates a new subscriber
 func (c *connector) Post(w http.ResponseWriter, req *http.Request) {
-	params := mux.Vars(req)
+	params := c.subscriptionParams(req)
 	c.logger.WithField("params", params).Info("POST subscription")
+	if router.IsDraining(c.router) {
+		writeError(w, http.StatusServiceUnavailable, router.ErrDraining.Error())
+		return
+	}
 	topic, ok := params[TopicParam]
-	if !ok {
-		fmt.Fprintf(w, "Missing topic parameter.")
+	if !ok || topic == "" {
+		writeError(w, http.StatusBadRequest, "Missing topic parameter")
 		return
 	}
 	delete(params, TopicParam)
@@ -190,24 +269,25 @@ func (c *connector) Post(w http.ResponseWriter, req *http.Request) {
 	subscriber, err := c.manager.Create(protocol.Path("/"+topic), params)
 	if err != nil {
 		if err == ErrSubscriberExists {
-			fmt.Fprintf(w, `{"error":"subscription already exists"}`)
+			writeError(w, http.StatusConflict, "subscription already exists")
 		} else {
-			http.Error(w, fmt.Sprintf(`{"error":"unknown error: %s"}`, err.Error()), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "unknown error: "+err.Error())
 		}
 		return
 	}
-	go c.Run(subscriber)
+	c.runOwned(subscriber)
 	c.logger.WithField("topic", topic).Info("Subscription created")
+	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprintf(w, `{"subscribed":"/%v"}`, topic)
 }
 
 // Delete removes a subscriber
 func (c *connector) Delete(w http.ResponseWriter, req *http.Request) {
-	params := mux.Vars(req)
+	params := c.subscriptionParams(req)
 	c.logger.WithField("params", params).Info("DELETE subscription")
 	topic, ok := params[TopicParam]
-	if !ok {
-		fmt.Fprintf(w, "Missing topic parameter.")
+	if !ok || topic == "" {
+		writeError(w, http.StatusBadRequest, "Missing topic parameter")
 		return
 	}
 	delete(params, TopicParam)
@@ -215,27 +295,75 @@ func (c *connector) Delete(w http.ResponseWriter, req *http.Request) {
 	c.logger.WithField("params", params).WithField("topic", topic).Info("Finding subscription to delete it")
 	subscriber := c.manager.Find(GenerateKey("/"+topic, params))
 	if subscriber == nil {
-		http.Error(w, `{"error":"subscription not found"}`, http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "subscription not found")
 		return
 	}
 	c.logger.WithField("params", params).WithField("topic", topic).Info("Deleting subscription")
 	err := c.manager.Remove(subscriber)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"unknown error: %s"}`, err.Error()), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "unknown error: "+err.Error())
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprintf(w, `{"unsubscribed":"/%v"}`, topic)
 }
 
+// queryFilters returns the first value of each query param of the request.
+func queryFilters(req *http.Request) map[string]string {
+	query := req.URL.Query()
+	filters := make(map[string]string, len(query))
+	for key, value := range query {
+		if len(value) == 0 {
+			continue
+		}
+		filters[key] = value[0]
+	}
+	return filters
+}
+
+func (c *connector) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		c.logger.WithField("error", err.Error()).Error("Error encoding data.")
+	}
+}
+
+// writeError writes the uniform JSON error of the connector API: {"error":"<message>"}
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// subscriptionParams returns the route params of the subscription given in the request:
+// the variables of the URL pattern, and the query parameters (which do not override them) if enabled by QueryParams.
+// The params of a subscription are also used as filters for the messages it receives.
+func (c *connector) subscriptionParams(req *http.Request) map[string]string {
+	params := mux.Vars(req)
+	if params == nil {
+		params = make(map[string]string)
+	}
+	if !c.config.QueryParams {
+		return params
+	}
+	for key, value := range req.URL.Query() {
+		if _, ok := params[key]; ok || len(value) == 0 {
+			continue
+		}
+		params[key] = value[0]
+	}
+	return params
+}
+
 func (c *connector) Substitute(w http.ResponseWriter, req *http.Request) {
 	s := new(substitution)
 	err := json.NewDecoder(req.Body).Decode(&s)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"json body could not be decoded: %s"}`, err.Error()), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "json body could not be decoded: "+err.Error())
 		return
 	}
 	if !s.isValid() {
-		http.Error(w, `{"error":"not all required values were supplied"}`, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "not all required values were supplied")
 		return
 	}
 
@@ -247,13 +375,14 @@ func (c *connector) Substitute(w http.ResponseWriter, req *http.Request) {
 		sub.Route().Set(s.FieldName, s.NewValue)
 		err = c.manager.Update(sub)
 		if err != nil {
-			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 		totalSubscribersUpdated++
 	}
 
 	c.logger.WithField("subscribers", subscribers).WithField("req", s).Info("Substituted subscriber info ")
+	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprintf(w, `{"modified":"%d"}`, totalSubscribersUpdated)
 }
 
@@ -272,8 +401,9 @@ func (c *connector) Start() error {
 
 	c.logger.Info("Starting subscriptions")
 	for _, s := range c.manager.List() {
-		go c.Run(s)
+		c.runOwned(s)
 	}
+	c.startBalancing()
 
 	c.logger.Info("Started connector")
 	return nil
@@ -282,10 +412,13 @@ func (c *connector) Start() error {
 func (c *connector) Run(s Subscriber) {
 	c.wg.Add(1)
 	defer c.wg.Done()
+	defer c.Recover()
 
+	route := s.Route()
 	var provideErr error
 	go func() {
-		err := s.Route().Provide(c.router, true)
+		defer c.Recover()
+		err := route.Provide(c.router, true)
 		if err != nil {
 			// cancel subscription loop if there is an error on the provider
 			provideErr = err
@@ -299,7 +432,7 @@ func (c *connector) Run(s Subscriber) {
 		// if context cancelled loop then unsubscribe the route from router
 		// in case it's been subscribed
 		if err == context.Canceled {
-			c.router.Unsubscribe(s.Route())
+			c.router.Unsubscribe(route)
 			return
 		}
 
@@ -337,14 +470,36 @@ func (c *connector) restart(s Subscriber) error {
 	return nil
 }
 
+// DependsOn returns the router, which should be running before the connector subscribes to it.
+func (c *connector) DependsOn() []string {
+	return []string{router.ModuleName}
+}
+
 // Stop the connector (the context, the queue, the subscription loops)
 func (c *connector) Stop() error {
+	return c.StopWithContext(context.Background())
+}
+
+// StopWithContext stops the connector, waiting for its subscribers until the context is done.
+// It is a part of the service.ContextStopable implementation.
+func (c *connector) StopWithContext(ctx context.Context) error {
 	c.logger.Info("Stopping connector")
 	c.cancel()
 	c.queue.Stop()
-	c.wg.Wait()
-	c.logger.Info("Stopped connector")
-	return nil
+
+	stoppedC := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(stoppedC)
+	}()
+	select {
+	case <-stoppedC:
+		c.logger.Info("Stopped connector")
+		return nil
+	case <-ctx.Done():
+		c.logger.WithError(ctx.Err()).Warn("Connector did not stop in time")
+		return ctx.Err()
+	}
 }
 
 func (c *connector) Manager() Manager {
@@ -361,7 +516,15 @@ func (c *connector) ResponseHandler() ResponseHandler {
 
 func (c *connector) SetResponseHandler(handler ResponseHandler) {
 	c.handler = handler
-	c.queue.SetResponseHandler(handler)
+	c.queue.SetResponseHandler(c.withReceipts(handler))
+}
+
+// withReceipts wraps the response handler for publishing the delivery receipts, if configured.
+func (c *connector) withReceipts(handler ResponseHandler) ResponseHandler {
+	if c.config.ReceiptTopic == "" || handler == nil {
+		return handler
+	}
+	return &receiptHandler{handler, c.config.Name, protocol.Path(c.config.ReceiptTopic), c.router}
 }
 
 func (c *connector) Sender() Sender {
@@ -369,6 +532,32 @@ func (c *connector) Sender() Sender {
 }
 
 func (c *connector) SetSender(s Sender) {
-	c.sender = s
-	c.queue.SetSender(s)
+	c.sender = c.wrapSender(s)
+	c.queue.SetSender(c.sender)
+}
+
+// wrapSender wraps the sender for applying the payload templates, pausing while the provider fails,
+// and retrying its failed requests, if configured.
+func (c *connector) wrapSender(s Sender) Sender {
+	if s == nil {
+		return s
+	}
+	if c.config.PayloadTemplates != nil {
+		s = &templateSender{s, c.config.Name, c.config.PayloadTemplates}
+	}
+	if c.config.CircuitBreaker != nil && c.config.CircuitBreaker.Failures > 0 {
+		s = newBreakerSender(s, *c.config.CircuitBreaker, c.config.Name)
+	}
+	if c.config.Retry != nil {
+		s = newRetrySender(s, *c.config.Retry, c.config.Name, c.router, c.pushRetry)
+	}
+	return s
+}
+
+// pushRetry pushes a request to be sent again, unless the connector was stopped in the meantime.
+func (c *connector) pushRetry(r Request) error {
+	if ctx := c.Context(); ctx == nil || ctx.Err() != nil {
+		return ErrConnectorStopped
+	}
+	return c.queue.Push(r)
 }
@@ -69,6 +69,66 @@ func TestConnector_PostSubscription(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 }
 
+func TestConnector_subscriptionParams(t *testing.T) {
+	a := assert.New(t)
+
+	req, err := http.NewRequest(http.MethodPost, "/connector/topic1?user_id=user1", nil)
+	a.NoError(err)
+
+	// the query params are ignored, unless the connector uses them
+	c := &connector{}
+	a.Equal(map[string]string{}, c.subscriptionParams(req))
+	c.config.QueryParams = true
+	a.Equal(map[string]string{"user_id": "user1"}, c.subscriptionParams(req))
+}
+
+func TestConnector_PostSubscriptionWithQueryParams(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	a := assert.New(t)
+
+	recorder := httptest.NewRecorder()
+	conn, mocks := getTestConnector(t, Config{
+		Name:        "test",
+		Schema:      "test",
+		Prefix:      "/connector/",
+		URLPattern:  "/{device_token}/{topic:.*}",
+		QueryParams: true,
+	}, true, false)
+
+	mocks.manager.EXPECT().Load().Return(nil)
+	mocks.manager.EXPECT().List().Return(make([]Subscriber, 0))
+	err := conn.Start()
+	a.NoError(err)
+	defer conn.Stop()
+
+	// query params are added to the subscription, but do not override the URL pattern variables
+	subscriber := NewMockSubscriber(testutil.MockCtrl)
+	mocks.manager.EXPECT().Create(gomock.Eq(protocol.Path("/topic1")), gomock.Eq(router.RouteParams{
+		"device_token": "device1",
+		"user_id":      "user1",
+		"connector":    "test",
+	})).Return(subscriber, nil)
+
+	subscriber.EXPECT().Loop(gomock.Any(), gomock.Any())
+	r := router.NewRoute(router.RouteConfig{
+		Path: protocol.Path("topic1"),
+		RouteParams: router.RouteParams{
+			"device_token": "device1",
+			"user_id":      "user1",
+		},
+	})
+	subscriber.EXPECT().Route().Return(r)
+	mocks.router.EXPECT().Subscribe(gomock.Eq(r)).Return(r, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/connector/device1/topic1?user_id=user1&device_token=other", strings.NewReader(""))
+	a.NoError(err)
+	conn.ServeHTTP(recorder, req)
+	a.Equal(`{"subscribed":"/topic1"}`, recorder.Body.String())
+	time.Sleep(100 * time.Millisecond)
+}
+
 func TestConnector_PostSubscriptionNoMocks(t *testing.T) {
 	_, finish := testutil.NewMockCtrl(t)
 	defer finish()
@@ -396,3 +456,55 @@ func getTestConnector(t *testing.T, config Config, mockManager bool, mockQueue b
 		mKVS,
 	}
 }
+
+func TestConnector_GetSubscriptions(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn, mocks := getTestConnector(t, Config{
+		Name:       "test",
+		Schema:     "test",
+		Prefix:     "/connector/",
+		URLPattern: "/{device_token}/{user_id}/{topic:.*}",
+	}, true, false)
+
+	s := NewSubscriber("/topic1", router.RouteParams{"device_token": "device1", "user_id": "user1"}, 0)
+	mocks.manager.EXPECT().List().Return([]Subscriber{s})
+	mocks.manager.EXPECT().Filter(gomock.Eq(map[string]string{"user_id": "user1"})).Return([]Subscriber{})
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/connector"+SubscriptionsPath, nil)
+	a.NoError(err)
+	conn.ServeHTTP(recorder, req)
+	a.Equal(http.StatusOK, recorder.Code)
+	a.Equal("application/json", recorder.Header().Get("Content-Type"))
+	a.JSONEq(`[{"topic":"/topic1","params":{"device_token":"device1","user_id":"user1"}}]`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/connector"+SubscriptionsPath+"?user_id=user1", nil)
+	a.NoError(err)
+	conn.ServeHTTP(recorder, req)
+	a.JSONEq(`[]`, recorder.Body.String())
+}
+
+func TestConnector_PostExistingSubscription(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn, mocks := getTestConnector(t, Config{
+		Name:       "test",
+		Schema:     "test",
+		Prefix:     "/connector/",
+		URLPattern: "/{device_token}/{user_id}/{topic:.*}",
+	}, true, false)
+	mocks.manager.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil, ErrSubscriberExists)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/connector/device1/user1/topic1", nil)
+	a.NoError(err)
+	conn.ServeHTTP(recorder, req)
+	a.Equal(http.StatusConflict, recorder.Code)
+	a.JSONEq(`{"error":"subscription already exists"}`, recorder.Body.String())
+}
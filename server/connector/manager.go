@@ -1,8 +1,11 @@
 package connector
 
 import (
+	"expvar"
 	"sync"
 
+	log "github.com/Sirupsen/logrus"
+
 	"github.com/smancke/guble/protocol"
 	"github.com/smancke/guble/server/kvstore"
 	"github.com/smancke/guble/server/router"
@@ -10,6 +13,7 @@ import (
 
 type Manager interface {
 	Load() error
+	Refresh() error
 	List() []Subscriber
 	Filter(map[string]string) []Subscriber
 	Find(string) Subscriber
@@ -37,17 +41,98 @@ func NewManager(schema string, kvstore kvstore.KVStore) Manager {
 
 func (m *manager) Load() error {
 	// try to load s from kvstore
+	var migrated []Subscriber
+	var staleKeys []string
 	entries := m.kvstore.Iterate(m.schema, "")
 	for e := range entries {
-		subscriber, err := NewSubscriberFromJSON([]byte(e[1]))
+		sd, isMigrated, err := decodeSubscriberData([]byte(e[1]))
+		if err == ErrUnknownSubscriberVersion {
+			m.skipUnknownVersion(e[0])
+			continue
+		}
 		if err != nil {
 			return err
 		}
+		subscriber := NewSubscriberFromData(sd)
 		m.subscribers[subscriber.Key()] = subscriber
+		if isMigrated {
+			migrated = append(migrated, subscriber)
+			if subscriber.Key() != e[0] {
+				staleKeys = append(staleKeys, e[0])
+			}
+		}
+	}
+	m.Lock()
+	m.updateGauge()
+	m.Unlock()
+
+	// store the migrated subscribers in the current version (after iterating, not to write while reading)
+	for _, s := range migrated {
+		if err := m.updateStore(s); err != nil {
+			return err
+		}
+	}
+	for _, key := range staleKeys {
+		if err := m.kvstore.Delete(m.schema, key); err != nil {
+			return err
+		}
+	}
+	if len(migrated) > 0 {
+		logger.WithFields(log.Fields{
+			"schema":  m.schema,
+			"count":   len(migrated),
+			"version": SubscriberVersion,
+		}).Info("Migrated stored subscribers")
 	}
 	return nil
 }
 
+// skipUnknownVersion logs a subscriber stored by a newer version of guble (e.g. during a rolling upgrade of a cluster),
+// which is left in the KV store but not loaded.
+func (m *manager) skipUnknownVersion(key string) {
+	logger.WithFields(log.Fields{
+		"schema": m.schema,
+		"key":    key,
+	}).Warn("Skipping subscriber stored by a newer version")
+}
+
+// Refresh synchronizes the subscribers with the KV store, which may be shared with other nodes:
+// it adds the new subscribers, drops the removed ones, and advances the last IDs of the existing ones.
+func (m *manager) Refresh() error {
+	stored := make(map[string]SubscriberData)
+	for e := range m.kvstore.Iterate(m.schema, "") {
+		sd, _, err := decodeSubscriberData([]byte(e[1]))
+		if err == ErrUnknownSubscriberVersion {
+			m.skipUnknownVersion(e[0])
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		stored[e[0]] = sd
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	for key, s := range m.subscribers {
+		sd, exists := stored[key]
+		if !exists {
+			s.Cancel()
+			delete(m.subscribers, key)
+			continue
+		}
+		s.SetLastID(sd.LastID)
+		delete(stored, key)
+	}
+	for _, sd := range stored {
+		s := NewSubscriberFromData(sd)
+		m.subscribers[s.Key()] = s
+	}
+	m.updateGauge()
+	return nil
+}
+
 func (m *manager) Find(key string) Subscriber {
 	m.RLock()
 	defer m.RUnlock()
@@ -138,12 +223,21 @@ func (m *manager) putSubscriber(s Subscriber) {
 	m.Lock()
 	defer m.Unlock()
 	m.subscribers[s.Key()] = s
+	m.updateGauge()
 }
 
 func (m *manager) deleteSubscriber(s Subscriber) {
 	m.Lock()
 	defer m.Unlock()
 	delete(m.subscribers, s.Key())
+	m.updateGauge()
+}
+
+// updateGauge publishes the current number of subscribers of the connector; the manager should be locked.
+func (m *manager) updateGauge() {
+	count := new(expvar.Int)
+	count.Set(int64(len(m.subscribers)))
+	mCurrentSubscribers.Set(m.schema, count)
 }
 
 func (m *manager) Exists(key string) bool {
@@ -1 +1,80 @@
 package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/router"
+)
+
+func TestManager_Refresh(t *testing.T) {
+	a := assert.New(t)
+
+	kvs := kvstore.NewMemoryKVStore()
+	m := NewManager("test", kvs)
+	a.NoError(m.Load())
+
+	kept, err := m.Create("/foo", router.RouteParams{"device_token": "device1"})
+	a.NoError(err)
+	removed, err := m.Create("/foo", router.RouteParams{"device_token": "device2"})
+	a.NoError(err)
+
+	// changes made by another node sharing the KV store
+	other := NewManager("test", kvs)
+	a.NoError(other.Load())
+	s := other.Find(kept.Key())
+	s.SetLastID(7)
+	a.NoError(other.Update(s))
+	a.NoError(other.Remove(other.Find(removed.Key())))
+	added, err := other.Create("/bar", router.RouteParams{"device_token": "device3"})
+	a.NoError(err)
+
+	a.NoError(m.Refresh())
+
+	a.Len(m.List(), 2)
+	a.True(kept == m.Find(kept.Key()), "Existing subscribers should be kept")
+	a.Nil(m.Find(removed.Key()))
+	a.NotNil(m.Find(added.Key()))
+
+	data, err := kept.Encode()
+	a.NoError(err)
+	a.Contains(string(data), `"LastID":7`)
+}
+
+func TestManager_SubscribersGauge(t *testing.T) {
+	a := assert.New(t)
+
+	m := NewManager("gauge_test", kvstore.NewMemoryKVStore())
+	a.NoError(m.Load())
+	a.Equal("0", mCurrentSubscribers.Get("gauge_test").String())
+
+	s, err := m.Create("/foo", router.RouteParams{"device_token": "device1"})
+	a.NoError(err)
+	_, err = m.Create("/foo", router.RouteParams{"device_token": "device2"})
+	a.NoError(err)
+	a.Equal("2", mCurrentSubscribers.Get("gauge_test").String())
+
+	a.NoError(m.Remove(s))
+	a.Equal("1", mCurrentSubscribers.Get("gauge_test").String())
+}
+
+func TestManager_LoadSkipsUnknownVersion(t *testing.T) {
+	a := assert.New(t)
+
+	kvs := kvstore.NewMemoryKVStore()
+	m := NewManager("test", kvs)
+	a.NoError(m.Load())
+	s, err := m.Create("/foo", router.RouteParams{"device_token": "device1"})
+	a.NoError(err)
+	a.NoError(kvs.Put("test", "newer", []byte(`{"Version":999,"Topic":"/bar","Params":{"device_token":"device2"}}`)))
+
+	other := NewManager("test", kvs)
+	a.NoError(other.Load())
+	a.Len(other.List(), 1)
+	a.NotNil(other.Find(s.Key()))
+
+	a.NoError(other.Refresh())
+	a.Len(other.List(), 1)
+}
@@ -0,0 +1,19 @@
+package connector
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                = metrics.NS("connector")
+	mTotalRetries     = ns.NewMap("total_retries")
+	mTotalDeadLetters = ns.NewMap("total_dead_letters")
+	mTotalRateLimited = ns.NewMap("total_rate_limited")
+	mTotalReceipts    = ns.NewMap("total_receipts")
+	mTotalExpired     = ns.NewInt("total_expired")
+
+	mTotalTemplateErrors = ns.NewMap("total_template_errors")
+	mTotalCircuitOpened  = ns.NewMap("total_circuit_opened")
+
+	mCurrentSubscribers = ns.NewMap("current_subscribers")
+)
@@ -0,0 +1,57 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// SubscriberVersion is the version of the subscriptions written to the KVStore.
+// It has to be increased, with a new migration, whenever SubscriberData changes in an incompatible way.
+const SubscriberVersion = 1
+
+var ErrUnknownSubscriberVersion = errors.New("Subscriber stored by a newer version.")
+
+// migration transforms the decoded JSON document of a subscriber from one version to the next.
+type migration func(map[string]interface{}) error
+
+// migrations contains, at index i, the migration from version i to version i+1.
+var migrations = []migration{
+	// version 0 is the unversioned format, which has the same fields as version 1
+	func(map[string]interface{}) error { return nil },
+}
+
+// decodeSubscriberData decodes a stored subscriber, migrating it to SubscriberVersion if needed.
+// It returns true if the subscriber was migrated and has to be stored again.
+func decodeSubscriberData(data []byte) (SubscriberData, bool, error) {
+	sd := SubscriberData{}
+
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return sd, false, err
+	}
+	version := 0
+	if v, ok := doc["Version"].(float64); ok {
+		version = int(v)
+	}
+	if version > SubscriberVersion {
+		return sd, false, ErrUnknownSubscriberVersion
+	}
+	if version == SubscriberVersion {
+		err := json.Unmarshal(data, &sd)
+		return sd, false, err
+	}
+
+	for ; version < SubscriberVersion; version++ {
+		if err := migrations[version](doc); err != nil {
+			return sd, false, err
+		}
+	}
+	doc["Version"] = SubscriberVersion
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return sd, false, err
+	}
+	err = json.Unmarshal(migrated, &sd)
+	return sd, true, err
+}
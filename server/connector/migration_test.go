@@ -0,0 +1,63 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/router"
+)
+
+func TestDecodeSubscriberData_Unversioned(t *testing.T) {
+	a := assert.New(t)
+
+	sd, migrated, err := decodeSubscriberData([]byte(`{"Topic":"/foo","Params":{"device_token":"device1"},"LastID":3}`))
+	a.NoError(err)
+	a.True(migrated)
+	a.Equal(SubscriberData{
+		Version: SubscriberVersion,
+		Topic:   "/foo",
+		Params:  router.RouteParams{"device_token": "device1"},
+		LastID:  3,
+	}, sd)
+}
+
+func TestDecodeSubscriberData_CurrentVersion(t *testing.T) {
+	a := assert.New(t)
+
+	data, err := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 5).Encode()
+	a.NoError(err)
+	a.Contains(string(data), `"Version":1`)
+
+	sd, migrated, err := decodeSubscriberData(data)
+	a.NoError(err)
+	a.False(migrated)
+	a.Equal(protocol.Path("/foo"), sd.Topic)
+	a.Equal(uint64(5), sd.LastID)
+}
+
+func TestDecodeSubscriberData_NewerVersion(t *testing.T) {
+	a := assert.New(t)
+
+	_, _, err := decodeSubscriberData([]byte(`{"Version":1000,"Topic":"/foo"}`))
+	a.Equal(ErrUnknownSubscriberVersion, err)
+}
+
+func TestManager_LoadMigratesSubscribers(t *testing.T) {
+	a := assert.New(t)
+
+	kvs := kvstore.NewMemoryKVStore()
+	key := GenerateKey("/foo", map[string]string{"device_token": "device1"})
+	a.NoError(kvs.Put("test", key, []byte(`{"Topic":"/foo","Params":{"device_token":"device1"},"LastID":3}`)))
+
+	m := NewManager("test", kvs)
+	a.NoError(m.Load())
+	a.NotNil(m.Find(key))
+
+	data, exists, err := kvs.Get("test", key)
+	a.NoError(err)
+	a.True(exists)
+	a.JSONEq(`{"Version":1,"Topic":"/foo","Params":{"device_token":"device1"},"LastID":3}`, string(data))
+}
@@ -43,6 +43,16 @@ func (_mr *_MockConnectorRecorder) Context() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Context")
 }
 
+func (_m *MockConnector) DependsOn() []string {
+	ret := _m.ctrl.Call(_m, "DependsOn")
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+func (_mr *_MockConnectorRecorder) DependsOn() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DependsOn")
+}
+
 func (_m *MockConnector) GetPrefix() string {
 	ret := _m.ctrl.Call(_m, "GetPrefix")
 	ret0, _ := ret[0].(string)
@@ -63,6 +73,16 @@ func (_mr *_MockConnectorRecorder) Manager() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Manager")
 }
 
+func (_m *MockConnector) Panicked() error {
+	ret := _m.ctrl.Call(_m, "Panicked")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockConnectorRecorder) Panicked() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Panicked")
+}
+
 func (_m *MockConnector) ResponseHandler() ResponseHandler {
 	ret := _m.ctrl.Call(_m, "ResponseHandler")
 	ret0, _ := ret[0].(ResponseHandler)
@@ -115,6 +135,14 @@ func (_mr *_MockConnectorRecorder) SetSender(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetSender", arg0)
 }
 
+func (_m *MockConnector) SetSupervised(_param0 bool) {
+	_m.ctrl.Call(_m, "SetSupervised", _param0)
+}
+
+func (_mr *_MockConnectorRecorder) SetSupervised(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetSupervised", arg0)
+}
+
 func (_m *MockConnector) Start() error {
 	ret := _m.ctrl.Call(_m, "Start")
 	ret0, _ := ret[0].(error)
@@ -135,6 +163,16 @@ func (_mr *_MockConnectorRecorder) Stop() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Stop")
 }
 
+func (_m *MockConnector) StopWithContext(_param0 context.Context) error {
+	ret := _m.ctrl.Call(_m, "StopWithContext", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockConnectorRecorder) StopWithContext(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StopWithContext", arg0)
+}
+
 // Mock of Sender interface
 type MockSender struct {
 	ctrl     *gomock.Controller
@@ -290,6 +328,16 @@ func (_mr *_MockManagerRecorder) Load() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Load")
 }
 
+func (_m *MockManager) Refresh() error {
+	ret := _m.ctrl.Call(_m, "Refresh")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockManagerRecorder) Refresh() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Refresh")
+}
+
 func (_m *MockManager) Remove(_param0 Subscriber) error {
 	ret := _m.ctrl.Call(_m, "Remove", _param0)
 	ret0, _ := ret[0].(error)
@@ -0,0 +1,165 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/smancke/guble/protocol"
+)
+
+// DefaultPayloadTemplates are the payload templates of the connectors whose Config has no PayloadTemplates, by connector name.
+var DefaultPayloadTemplates map[string]*PayloadTemplates
+
+// PayloadData is the data available in a payload template.
+type PayloadData struct {
+	ID      uint64
+	Topic   string
+	UserID  string
+	Time    time.Time
+	Header  map[string]interface{}
+	Filters map[string]string
+	// Params are the params of the subscription
+	Params map[string]string
+	// Body is the body of the message, and JSON its decoded value (if it is JSON)
+	Body string
+	JSON interface{}
+}
+
+// templateFuncs are the helpers available in the payload templates.
+var templateFuncs = template.FuncMap{
+	// json returns the JSON encoding of a value (e.g. for writing escaped strings in JSON payloads)
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// default returns the value, or the default value if it is empty
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+	// truncate returns at most the first n characters of the string
+	"truncate": func(n int, s string) string {
+		if r := []rune(s); len(r) > n {
+			return string(r[:n])
+		}
+		return s
+	},
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"trim":    strings.TrimSpace,
+	"replace": strings.Replace,
+}
+
+type topicTemplate struct {
+	path     protocol.Path
+	template *template.Template
+}
+
+// PayloadTemplates transform the guble messages into the payloads sent by a connector,
+// with a template per topic (also applied to its subtopics).
+type PayloadTemplates struct {
+	templates []topicTemplate
+}
+
+// ParsePayloadTemplates parses the templates given as "<connector>/<topic>=<template>",
+// or as "<connector>/<topic>=@<path of the template file>", and returns them by connector name.
+func ParsePayloadTemplates(specs []string) (map[string]*PayloadTemplates, error) {
+	all := make(map[string]*PayloadTemplates)
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		slash := strings.Index(parts[0], "/")
+		if len(parts) != 2 || slash <= 0 {
+			return nil, fmt.Errorf("invalid payload template %q: the format is <connector>/<topic>=<template>", spec)
+		}
+		name, path := parts[0][:slash], protocol.Path(parts[0][slash:])
+
+		text := parts[1]
+		if strings.HasPrefix(text, "@") {
+			data, err := ioutil.ReadFile(text[1:])
+			if err != nil {
+				return nil, err
+			}
+			text = string(data)
+		}
+		tmpl, err := template.New(parts[0]).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, err
+		}
+
+		if all[name] == nil {
+			all[name] = &PayloadTemplates{}
+		}
+		all[name].templates = append(all[name].templates, topicTemplate{path, tmpl})
+	}
+	return all, nil
+}
+
+// find returns the template of the most specific topic matching the path, or nil.
+func (pt *PayloadTemplates) find(path protocol.Path) *template.Template {
+	var found *topicTemplate
+	for i, t := range pt.templates {
+		if (path == t.path || strings.HasPrefix(string(path), string(t.path)+"/")) &&
+			(found == nil || len(t.path) > len(found.path)) {
+			found = &pt.templates[i]
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return found.template
+}
+
+// Payload returns the payload of the request: the result of the template of its topic,
+// or the unchanged body of the message if there is no template, or if the body is end-to-end encrypted.
+func (pt *PayloadTemplates) Payload(request Request) ([]byte, error) {
+	message := request.Message()
+	tmpl := pt.find(message.Path)
+	if tmpl == nil || message.IsEncrypted() {
+		return message.Body, nil
+	}
+
+	data := PayloadData{
+		ID:      message.ID,
+		Topic:   string(message.Path),
+		UserID:  message.UserID,
+		Time:    time.Unix(message.Time, 0),
+		Filters: message.Filters,
+		Params:  request.Subscriber().Route().RouteParams,
+		Body:    string(message.Body),
+	}
+	if message.HeaderJSON != "" {
+		json.Unmarshal([]byte(message.HeaderJSON), &data.Header)
+	}
+	json.Unmarshal(message.Body, &data.JSON)
+
+	buff := &bytes.Buffer{}
+	if err := tmpl.Execute(buff, data); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// templateSender is a Sender replacing the body of the messages by their payload, before sending them with another Sender.
+type templateSender struct {
+	Sender
+	name      string
+	templates *PayloadTemplates
+}
+
+func (s *templateSender) Send(request Request) (interface{}, error) {
+	payload, err := s.templates.Payload(request)
+	if err != nil {
+		mTotalTemplateErrors.Add(s.name, 1)
+		return nil, err
+	}
+	message := *request.Message()
+	message.Body = payload
+	return s.Sender.Send(NewRequest(request.Subscriber(), &message))
+}
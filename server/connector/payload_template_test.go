@@ -0,0 +1,114 @@
+package connector
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+func TestParsePayloadTemplates(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := ioutil.TempFile("", "guble_template")
+	a.NoError(err)
+	defer os.Remove(f.Name())
+	f.WriteString("{{.Body}} from file")
+	f.Close()
+
+	templates, err := ParsePayloadTemplates([]string{
+		"fcm/news={{.Body}} in news",
+		"fcm/news/sport=@" + f.Name(),
+		"apns/alerts={{upper .Body}}",
+	})
+	a.NoError(err)
+	a.Len(templates, 2)
+	a.Len(templates["fcm"].templates, 2)
+	a.Len(templates["apns"].templates, 1)
+
+	for _, spec := range []string{"fcm", "fcm/news", "/news={{.Body}}", "fcm/news={{.Body"} {
+		_, err = ParsePayloadTemplates([]string{spec})
+		a.Error(err, spec)
+	}
+}
+
+func TestPayloadTemplates_Payload(t *testing.T) {
+	a := assert.New(t)
+
+	templates, err := ParsePayloadTemplates([]string{
+		`fcm/news={"title":{{json (default "News" .Header.title)}},"body":{{json (truncate 5 .Body)}},"user":{{json .Params.user_id}}}`,
+		`fcm/news/sport={{.JSON.team}} scored`,
+	})
+	a.NoError(err)
+	pt := templates["fcm"]
+
+	s := NewSubscriber("/news", router.RouteParams{"user_id": "user01"}, 0)
+	payload, err := pt.Payload(NewRequest(s, &protocol.Message{
+		Path:       "/news/politics",
+		HeaderJSON: `{"title":"Breaking \"news\""}`,
+		Body:       []byte("something happened"),
+	}))
+	a.NoError(err)
+	a.JSONEq(`{"title":"Breaking \"news\"","body":"somet","user":"user01"}`, string(payload))
+
+	payload, err = pt.Payload(NewRequest(s, &protocol.Message{Path: "/news", Body: []byte("text")}))
+	a.NoError(err)
+	a.JSONEq(`{"title":"News","body":"text","user":"user01"}`, string(payload))
+
+	// the template of the most specific topic is used
+	payload, err = pt.Payload(NewRequest(s, &protocol.Message{Path: "/news/sport", Body: []byte(`{"team":"guble"}`)}))
+	a.NoError(err)
+	a.Equal("guble scored", string(payload))
+
+	// without a template, the body is unchanged
+	payload, err = pt.Payload(NewRequest(s, &protocol.Message{Path: "/newsletter", Body: []byte("text")}))
+	a.NoError(err)
+	a.Equal("text", string(payload))
+
+	// the encrypted bodies are unchanged
+	payload, err = pt.Payload(NewRequest(s, &protocol.Message{
+		Path:       "/news/sport",
+		HeaderJSON: `{"Encryption-Key-Id":"team-a-2024","Encryption-Algorithm":"A256GCM"}`,
+		Body:       []byte("c2VjcmV0"),
+	}))
+	a.NoError(err)
+	a.Equal("c2VjcmV0", string(payload))
+}
+
+func TestConnector_SenderWithPayloadTemplates(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	templates, err := ParsePayloadTemplates([]string{"test/foo=<{{.Body}}>"})
+	a.NoError(err)
+	conn, _ := getTestConnector(t, Config{
+		Name:             "test",
+		Schema:           "test",
+		Prefix:           "/connector/",
+		URLPattern:       "/{device_token}/{topic:.*}",
+		PayloadTemplates: templates["test"],
+	}, false, false)
+
+	sender := NewMockSender(ctrl)
+	conn.SetSender(sender)
+
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 0)
+	message := &protocol.Message{ID: 1, Path: "/foo", Body: []byte("text")}
+	sender.EXPECT().Send(gomock.Any()).Do(func(request Request) {
+		a.Equal("<text>", string(request.Message().Body))
+		a.Equal(uint64(1), request.Message().ID)
+	}).Return("ok", nil)
+
+	response, err := conn.Sender().Send(NewRequest(s, message))
+	a.NoError(err)
+	a.Equal("ok", response)
+	// the original message is unchanged
+	a.Equal("text", string(message.Body))
+}
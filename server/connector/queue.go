@@ -2,10 +2,13 @@ package connector
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/tracing"
 )
 
 // Queue is an interface modeling a task-queue (it is started and more Requests can be pushed to it, and finally it is stopped after all requests are handled).
@@ -18,6 +21,17 @@ type Queue interface {
 	Stop() error
 }
 
+const (
+	// defaultIdleTimeout is the time after which an idle worker above the minimum number of workers is stopped.
+	defaultIdleTimeout = 30 * time.Second
+
+	// maxScaleUpWait is the maximum time a request waits for a busy worker, before another worker is started.
+	maxScaleUpWait = 50 * time.Millisecond
+
+	// latencyWeight is the weight of the last send in the moving average of the latency.
+	latencyWeight = 0.2
+)
+
 type queue struct {
 	sender          Sender
 	responseHandler ResponseHandler
@@ -25,14 +39,35 @@ type queue struct {
 	nWorkers        int
 	metrics         bool
 	wg              sync.WaitGroup
+
+	// the number of workers is scaled between nWorkers and maxWorkers
+	maxWorkers  int
+	idleTimeout time.Duration
+	workersMu   sync.Mutex
+	workers     int
+	lastWorker  int
+
+	// latency is the exponentially weighted moving average of the send latency, in nanoseconds
+	latency int64
 }
 
 // NewQueue returns a new Queue (not started).
 func NewQueue(sender Sender, nWorkers int) Queue {
+	return NewScalingQueue(sender, nWorkers, nWorkers)
+}
+
+// NewScalingQueue returns a new Queue (not started), starting more workers when the requests are
+// backing up, up to maxWorkers, and stopping the idle workers until there are minWorkers left.
+func NewScalingQueue(sender Sender, minWorkers, maxWorkers int) Queue {
+	if maxWorkers < minWorkers {
+		maxWorkers = minWorkers
+	}
 	q := &queue{
-		sender:   sender,
-		nWorkers: nWorkers,
-		metrics:  true,
+		sender:      sender,
+		nWorkers:    minWorkers,
+		metrics:     true,
+		maxWorkers:  maxWorkers,
+		idleTimeout: defaultIdleTimeout,
 	}
 	return q
 }
@@ -56,12 +91,26 @@ func (q *queue) SetSender(s Sender) {
 // Start a fixed number of goroutines to handle requests and responses w.r.t. external push-notification services.
 func (q *queue) Start() error {
 	q.requestsC = make(chan Request)
+	q.workersMu.Lock()
+	defer q.workersMu.Unlock()
+	q.workers, q.lastWorker = 0, 0
 	for i := 1; i <= q.nWorkers; i++ {
-		go q.worker(i)
+		q.startWorker()
 	}
 	return nil
 }
 
+// startWorker has to be called with the workersMu locked.
+func (q *queue) startWorker() {
+	q.workers++
+	q.lastWorker++
+	if q.maxWorkers > q.nWorkers {
+		go q.scalingWorker(q.lastWorker)
+	} else {
+		go q.worker(q.lastWorker)
+	}
+}
+
 func (q *queue) worker(i int) {
 	logger.WithField("worker", i).Info("starting queue worker")
 	for request := range q.requestsC {
@@ -69,15 +118,102 @@ func (q *queue) worker(i int) {
 	}
 }
 
+// scalingWorker is a worker which stops after being idle, if there are more than the minimum number of workers.
+func (q *queue) scalingWorker(i int) {
+	logger.WithField("worker", i).Info("starting queue worker")
+	timer := time.NewTimer(q.idleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case request, opened := <-q.requestsC:
+			if !opened {
+				return
+			}
+			q.handle(request)
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+			if q.scaleDown() {
+				logger.WithField("worker", i).Info("stopping idle queue worker")
+				return
+			}
+		}
+		timer.Reset(q.idleTimeout)
+	}
+}
+
+// scaleUp starts a new worker if the maximum number of workers is not reached.
+func (q *queue) scaleUp() {
+	q.workersMu.Lock()
+	defer q.workersMu.Unlock()
+	if q.workers < q.maxWorkers {
+		q.startWorker()
+		logger.WithField("workers", q.workers).Debug("scaled up queue workers")
+	}
+}
+
+// scaleDown returns true if a worker can stop, without going under the minimum number of workers.
+func (q *queue) scaleDown() bool {
+	q.workersMu.Lock()
+	defer q.workersMu.Unlock()
+	if q.workers > q.nWorkers {
+		q.workers--
+		return true
+	}
+	return false
+}
+
+// updateLatency adds the duration of a send to the moving average of the latency.
+func (q *queue) updateLatency(d time.Duration) {
+	latency := atomic.LoadInt64(&q.latency)
+	if latency == 0 {
+		atomic.StoreInt64(&q.latency, int64(d))
+		return
+	}
+	atomic.StoreInt64(&q.latency, latency+int64(latencyWeight*float64(int64(d)-latency)))
+}
+
+// scaleUpWait returns the time a request waits for a busy worker before another worker is started:
+// twice the average latency, so that the workers are not scaled up while a fast service is keeping up,
+// but when the latency of the service makes the requests back up.
+func (q *queue) scaleUpWait() time.Duration {
+	wait := 2 * time.Duration(atomic.LoadInt64(&q.latency))
+	if wait > maxScaleUpWait {
+		return maxScaleUpWait
+	}
+	return wait
+}
+
+// Workers returns the current number of workers.
+func (q *queue) Workers() int {
+	q.workersMu.Lock()
+	defer q.workersMu.Unlock()
+	return q.workers
+}
+
 func (q *queue) handle(request Request) {
 	q.wg.Add(1)
 	defer q.wg.Done()
 
-	var beforeSend time.Time
-	if q.metrics {
-		beforeSend = time.Now()
+	if request.Message().Expired(time.Now()) {
+		logger.WithFields(request.Message().LogFields()).Debug("not sending expired message")
+		mTotalExpired.Add(1)
+		handled(request)
+		return
 	}
+
+	beforeSend := time.Now()
+	span := tracing.StartSpan("connector.send", tracing.FromMessage(request.Message()))
 	response, err := q.sender.Send(request)
+	span.SetError(err)
+	span.End()
+	q.updateLatency(time.Since(beforeSend))
+	if err == ErrRetryScheduled {
+		// the response is handled after the last attempt
+		return
+	}
+	defer handled(request)
 	if q.responseHandler != nil {
 		var metadata *Metadata
 		if q.metrics {
@@ -85,10 +221,9 @@ func (q *queue) handle(request Request) {
 		}
 		err = q.responseHandler.HandleResponse(request, response, metadata, err)
 		if err != nil {
-			logger.WithFields(log.Fields{
+			logger.WithFields(request.Message().LogFields()).WithFields(log.Fields{
 				"error":      err.Error(),
 				"subscriber": request.Subscriber(),
-				"message":    request.Message(),
 			}).Error("error handling connector response")
 		}
 	} else if err == nil {
@@ -111,6 +246,24 @@ func (q *queue) Push(request Request) error {
 		}
 	}()
 
+	if q.maxWorkers > q.nWorkers {
+		select {
+		case q.requestsC <- request:
+			return nil
+		default:
+		}
+		if wait := q.scaleUpWait(); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case q.requestsC <- request:
+				timer.Stop()
+				return nil
+			case <-timer.C:
+			}
+		}
+		// no worker became idle within the latency of the service: the requests are backing up
+		q.scaleUp()
+	}
 	q.requestsC <- request
 	return nil
 }
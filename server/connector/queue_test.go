@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+type blockingSender struct {
+	releaseC chan struct{}
+}
+
+func (s *blockingSender) Send(request Request) (interface{}, error) {
+	<-s.releaseC
+	return nil, nil
+}
+
+func TestScalingQueue_ScalesWorkers(t *testing.T) {
+	a := assert.New(t)
+
+	sender := &blockingSender{releaseC: make(chan struct{})}
+	q := NewScalingQueue(sender, 1, 3).(*queue)
+	q.idleTimeout = 50 * time.Millisecond
+	a.NoError(q.Start())
+	a.Equal(1, q.Workers())
+
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 0)
+	for i := 0; i < 3; i++ {
+		a.NoError(q.Push(NewRequest(s, &protocol.Message{ID: uint64(i), Path: "/foo"})))
+	}
+	// all the workers are busy
+	a.Equal(3, q.Workers())
+
+	// the idle workers are stopped, down to the minimum
+	close(sender.releaseC)
+	time.Sleep(200 * time.Millisecond)
+	a.Equal(1, q.Workers())
+
+	a.NoError(q.Stop())
+}
+
+type slowSender struct {
+	latency time.Duration
+}
+
+func (s *slowSender) Send(request Request) (interface{}, error) {
+	time.Sleep(s.latency)
+	return nil, nil
+}
+
+func TestScalingQueue_ScalesWithLatency(t *testing.T) {
+	a := assert.New(t)
+
+	sender := &slowSender{latency: time.Millisecond}
+	q := NewScalingQueue(sender, 1, 5).(*queue)
+	a.NoError(q.Start())
+	q.updateLatency(sender.latency)
+
+	// a fast service keeps up with the requests: they wait for a busy worker
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 0)
+	for i := 0; i < 20; i++ {
+		a.NoError(q.Push(NewRequest(s, &protocol.Message{ID: uint64(i), Path: "/foo"})))
+	}
+	a.True(q.Workers() < 5)
+	a.True(q.scaleUpWait() > 0)
+
+	// the wait for a worker is bounded
+	q.updateLatency(time.Hour)
+	a.Equal(maxScaleUpWait, q.scaleUpWait())
+
+	a.NoError(q.Stop())
+}
+
+type recordingSender struct {
+	sent chan uint64
+}
+
+func (s *recordingSender) Send(request Request) (interface{}, error) {
+	s.sent <- request.Message().ID
+	return nil, nil
+}
+
+func TestQueue_DropsExpiredMessages(t *testing.T) {
+	a := assert.New(t)
+
+	sender := &recordingSender{sent: make(chan uint64, 2)}
+	q := NewQueue(sender, 1)
+	a.NoError(q.Start())
+
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 0)
+	a.NoError(q.Push(NewRequest(s, &protocol.Message{ID: 1, Path: "/foo", Expires: time.Now().Add(-time.Second).Unix()})))
+	a.NoError(q.Push(NewRequest(s, &protocol.Message{ID: 2, Path: "/foo", Expires: time.Now().Add(time.Hour).Unix()})))
+
+	// the single worker handles the requests in order: the expired message is not sent
+	select {
+	case id := <-sender.sent:
+		a.Equal(uint64(2), id)
+	case <-time.After(time.Second):
+		a.Fail("the valid message was not sent")
+	}
+	a.NoError(q.Stop())
+}
+
+func TestQueue_FixedWorkers(t *testing.T) {
+	a := assert.New(t)
+
+	q := NewQueue(&blockingSender{}, 2).(*queue)
+	a.NoError(q.Start())
+	a.Equal(2, q.Workers())
+	a.NoError(q.Stop())
+}
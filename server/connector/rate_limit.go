@@ -0,0 +1,97 @@
+package connector
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// RateLimitConfig limits the number of messages sent to each subscriber of a connector.
+type RateLimitConfig struct {
+	// Messages is the maximum number of messages sent to a subscriber in an interval (no limit if <= 0)
+	Messages int
+	// Interval is the duration of the interval (default: 1 minute)
+	Interval time.Duration
+}
+
+// DefaultRateLimit is used by the connectors whose Config has no RateLimit.
+var DefaultRateLimit RateLimitConfig
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter counts the messages of each subscriber in fixed time windows.
+type rateLimiter struct {
+	sync.Mutex
+	config    RateLimitConfig
+	windows   map[string]*window
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	return &rateLimiter{
+		config:  config,
+		windows: make(map[string]*window),
+		now:     time.Now,
+	}
+}
+
+// Allow returns true if one more message can be sent to the subscriber with the given key.
+func (l *rateLimiter) Allow(key string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastPrune) >= l.config.Interval {
+		l.prune(now)
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.config.Interval {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.config.Messages {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// prune removes the expired windows, so that the removed subscribers are forgotten.
+func (l *rateLimiter) prune(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.config.Interval {
+			delete(l.windows, key)
+		}
+	}
+	l.lastPrune = now
+}
+
+// rateLimitedQueue is a Queue dropping the requests of the subscribers exceeding the rate limit.
+type rateLimitedQueue struct {
+	Queue
+	name    string
+	limiter *rateLimiter
+}
+
+func (q *rateLimitedQueue) Push(request Request) error {
+	if !q.limiter.Allow(request.Subscriber().Key()) {
+		logger.WithFields(log.Fields{
+			"name":       q.name,
+			"subscriber": request.Subscriber().Key(),
+			"messageID":  request.Message().ID,
+		}).Warn("Rate limit of subscriber exceeded, dropping message")
+		mTotalRateLimited.Add(q.name, 1)
+		handled(request)
+		return nil
+	}
+	return q.Queue.Push(request)
+}
@@ -0,0 +1,75 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	a := assert.New(t)
+
+	now := time.Unix(1000, 0)
+	l := newRateLimiter(RateLimitConfig{Messages: 2, Interval: time.Minute})
+	l.now = func() time.Time { return now }
+
+	a.True(l.Allow("device1"))
+	a.True(l.Allow("device1"))
+	a.False(l.Allow("device1"))
+	a.True(l.Allow("device2"))
+
+	// a new window starts, and the expired window of device2 is pruned
+	now = now.Add(time.Minute)
+	a.True(l.Allow("device1"))
+	a.Len(l.windows, 1)
+}
+
+func TestConnector_RateLimitDropsMessages(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn, mocks := getTestConnector(t, Config{
+		Name:       "test",
+		Schema:     "test",
+		Prefix:     "/connector/",
+		URLPattern: "/{device_token}/{topic:.*}",
+		RateLimit:  &RateLimitConfig{Messages: 1, Interval: time.Hour},
+	}, false, true)
+
+	// the rate limit wraps the queue of the connector
+	c := conn.(*connector)
+	c.queue = &rateLimitedQueue{mocks.queue, "test", newRateLimiter(*c.config.RateLimit)}
+
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 0)
+	mocks.queue.EXPECT().Push(gomock.Any()).Return(nil)
+
+	a.NoError(c.queue.Push(NewRequest(s, &protocol.Message{ID: 1, Path: "/foo"})))
+	a.NoError(c.queue.Push(NewRequest(s, &protocol.Message{ID: 2, Path: "/foo"})))
+}
+
+func TestNewConnector_DefaultRateLimit(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	config := Config{
+		Name:       "test",
+		Schema:     "test",
+		Prefix:     "/connector/",
+		URLPattern: "/{device_token}/{topic:.*}",
+	}
+	conn, _ := getTestConnector(t, config, false, false)
+	a.IsType(&queue{}, conn.(*connector).queue)
+
+	DefaultRateLimit = RateLimitConfig{Messages: 10}
+	defer func() { DefaultRateLimit = RateLimitConfig{} }()
+	conn, _ = getTestConnector(t, config, false, false)
+	a.IsType(&rateLimitedQueue{}, conn.(*connector).queue)
+}
@@ -0,0 +1,84 @@
+package connector
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// ReceiptDelivered is the status of a receipt when the message was delivered
+	ReceiptDelivered = "delivered"
+	// ReceiptFailed is the status of a receipt when the message could not be delivered
+	ReceiptFailed = "failed"
+)
+
+// DefaultReceiptTopic is used by the connectors whose Config has no ReceiptTopic (no receipts if empty).
+var DefaultReceiptTopic string
+
+// Receipt is the body of the message published to the receipt topic of a connector, after handling a request.
+// The subscriber is identified by its key, so that its params (e.g. device tokens or URLs) are not published.
+type Receipt struct {
+	Connector  string `json:"connector"`
+	Topic      string `json:"topic"`
+	MessageID  uint64 `json:"message_id"`
+	Subscriber string `json:"subscriber"`
+	UserID     string `json:"user_id,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Time       int64  `json:"time"`
+}
+
+// receiptHandler is a ResponseHandler publishing a receipt for each request handled by another ResponseHandler.
+type receiptHandler struct {
+	ResponseHandler
+	name   string
+	topic  protocol.Path
+	router router.Router
+}
+
+func (h *receiptHandler) HandleResponse(request Request, response interface{}, metadata *Metadata, err error) error {
+	handleErr := h.ResponseHandler.HandleResponse(request, response, metadata, err)
+	if err == nil {
+		err = handleErr
+	}
+	if receiptErr := h.publish(request, err); receiptErr != nil {
+		logger.WithField("error", receiptErr.Error()).Error("Could not publish delivery receipt")
+	}
+	return handleErr
+}
+
+// publish sends the receipt of the request to the receipt topic.
+// The messages of the receipt topic itself do not get receipts.
+func (h *receiptHandler) publish(request Request, err error) error {
+	message := request.Message()
+	if message.Path == h.topic {
+		return nil
+	}
+	receipt := Receipt{
+		Connector:  h.name,
+		Topic:      string(message.Path),
+		MessageID:  message.ID,
+		Subscriber: request.Subscriber().Key(),
+		UserID:     request.Subscriber().Route().Get("user_id"),
+		Status:     ReceiptDelivered,
+		Time:       time.Now().Unix(),
+	}
+	if err != nil {
+		receipt.Status = ReceiptFailed
+		receipt.Error = err.Error()
+	}
+	body, jsonErr := json.Marshal(receipt)
+	if jsonErr != nil {
+		return jsonErr
+	}
+
+	mTotalReceipts.Add(h.name, 1)
+	return h.router.HandleMessage(&protocol.Message{
+		Path:   h.topic,
+		UserID: h.name,
+		Body:   body,
+	})
+}
@@ -0,0 +1,96 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+func TestReceiptHandler_PublishesReceipts(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	handler := NewMockResponseHandler(ctrl)
+	routerMock := NewMockRouter(ctrl)
+	h := &receiptHandler{handler, "test", "/receipts", routerMock}
+
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1", "user_id": "user01"}, 0)
+	request := NewRequest(s, &protocol.Message{ID: 42, Path: "/foo"})
+
+	var receipts []Receipt
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/receipts"), m.Path)
+		a.Equal("test", m.UserID)
+		receipt := Receipt{}
+		a.NoError(json.Unmarshal(m.Body, &receipt))
+		receipts = append(receipts, receipt)
+	}).Return(nil).Times(2)
+
+	handler.EXPECT().HandleResponse(request, "ok", nil, nil).Return(nil)
+	a.NoError(h.HandleResponse(request, "ok", nil, nil))
+
+	sendErr := errors.New("connection refused")
+	handler.EXPECT().HandleResponse(request, nil, nil, sendErr).Return(sendErr)
+	a.Equal(sendErr, h.HandleResponse(request, nil, nil, sendErr))
+
+	a.Len(receipts, 2)
+	a.Equal("test", receipts[0].Connector)
+	a.Equal("/foo", receipts[0].Topic)
+	a.Equal(uint64(42), receipts[0].MessageID)
+	a.Equal(s.Key(), receipts[0].Subscriber)
+	a.Equal("user01", receipts[0].UserID)
+	a.Equal(ReceiptDelivered, receipts[0].Status)
+	a.Empty(receipts[0].Error)
+	a.Equal(ReceiptFailed, receipts[1].Status)
+	a.Equal("connection refused", receipts[1].Error)
+
+	// the messages of the receipt topic do not get receipts
+	request = NewRequest(s, &protocol.Message{ID: 43, Path: "/receipts"})
+	handler.EXPECT().HandleResponse(request, "ok", nil, nil).Return(nil)
+	a.NoError(h.HandleResponse(request, "ok", nil, nil))
+}
+
+func TestConnector_SetResponseHandlerWithReceipts(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn, _ := getTestConnector(t, Config{
+		Name:         "test",
+		Schema:       "test",
+		Prefix:       "/connector/",
+		URLPattern:   "/{device_token}/{topic:.*}",
+		ReceiptTopic: "/receipts",
+	}, false, false)
+
+	handler := NewMockResponseHandler(ctrl)
+	conn.SetResponseHandler(handler)
+	a.Equal(handler, conn.ResponseHandler())
+	a.IsType(&receiptHandler{}, conn.(*connector).queue.ResponseHandler())
+}
+
+func TestNewConnector_DefaultReceiptTopic(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	DefaultReceiptTopic = "/receipts"
+	defer func() { DefaultReceiptTopic = "" }()
+	conn, _ := getTestConnector(t, Config{
+		Name:       "test",
+		Schema:     "test",
+		Prefix:     "/connector/",
+		URLPattern: "/{device_token}/{topic:.*}",
+	}, false, false)
+
+	conn.SetResponseHandler(NewMockResponseHandler(ctrl))
+	a.IsType(&receiptHandler{}, conn.(*connector).queue.ResponseHandler())
+}
@@ -0,0 +1,182 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/jpillora/backoff"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+)
+
+var (
+	// ErrRetryScheduled is returned when sending a request failed, and it is sent again later:
+	// its response is handled after the last attempt.
+	ErrRetryScheduled = errors.New("the request is sent again later")
+
+	// ErrConnectorStopped is returned when retrying a request of a stopped connector.
+	ErrConnectorStopped = errors.New("the connector is stopped")
+)
+
+// DefaultRetry is used by the connectors whose Config has no Retry.
+var DefaultRetry RetryConfig
+
+// RetryConfig configures the retrying of the requests which could not be sent by a connector,
+// and the dead-letter topic receiving the requests which failed in the end.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of times a request is sent (it is not retried if <= 1)
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the exponential backoff between the attempts
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Retryable tells whether a request can be sent again after the error (default: Temporary)
+	Retryable func(error) bool
+	// DeadLetterTopic is the topic of the messages which could not be sent (none if empty)
+	DeadLetterTopic string
+}
+
+// DeadLetterHeader is the JSON header of a message published to the dead-letter topic of a connector.
+type DeadLetterHeader struct {
+	Connector string             `json:"connector"`
+	Topic     string             `json:"topic"`
+	MessageID uint64             `json:"message_id"`
+	Params    router.RouteParams `json:"params"`
+	Error     string             `json:"error"`
+	Attempts  int                `json:"attempts"`
+}
+
+// Temporary returns true for network errors and for the errors reporting themselves as temporary.
+func Temporary(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	t, ok := err.(interface {
+		Temporary() bool
+	})
+	return ok && t.Temporary()
+}
+
+// retryRequest is a request sent again, after its previous attempts failed.
+type retryRequest struct {
+	Request
+	attempts int
+}
+
+// retrySender is a Sender retrying the failed requests of another Sender with exponential backoff,
+// and publishing to the dead-letter topic the messages which could not be sent.
+// A failed request is pushed again to the queue once its backoff is over, so that no worker waits for it.
+type retrySender struct {
+	Sender
+	config  RetryConfig
+	name    string
+	router  router.Router
+	backoff backoff.Backoff
+	// push pushes a request to be sent again to the queue
+	push func(Request) error
+}
+
+func newRetrySender(sender Sender, config RetryConfig, name string, r router.Router, push func(Request) error) *retrySender {
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultMinBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultMaxBackoff
+	}
+	if config.Retryable == nil {
+		config.Retryable = Temporary
+	}
+	return &retrySender{
+		Sender:  sender,
+		config:  config,
+		name:    name,
+		router:  r,
+		backoff: backoff.Backoff{Min: config.MinBackoff, Max: config.MaxBackoff, Factor: 2},
+		push:    push,
+	}
+}
+
+// Send returns the response of a successful attempt, or the error of the last one.
+// If the request can be retried, it is pushed again after its backoff, and ErrRetryScheduled is returned.
+func (s *retrySender) Send(request Request) (interface{}, error) {
+	attempts := 0
+	if r, ok := request.(*retryRequest); ok {
+		request, attempts = r.Request, r.attempts
+	}
+	response, err := s.Sender.Send(request)
+	attempts++
+	if err == nil {
+		return response, nil
+	}
+	if attempts < s.config.MaxAttempts && s.config.Retryable(err) {
+		if request.Message().Expired(time.Now()) {
+			// an expired message is neither retried nor dead-lettered
+			mTotalExpired.Add(1)
+			return response, err
+		}
+		logger.WithFields(log.Fields{
+			"name":    s.name,
+			"error":   err.Error(),
+			"attempt": attempts,
+		}).Info("Could not send request, retrying")
+		mTotalRetries.Add(s.name, 1)
+		s.retry(&retryRequest{request, attempts}, err)
+		return nil, ErrRetryScheduled
+	}
+
+	if dlErr := s.deadLetter(request, err, attempts); dlErr != nil {
+		logger.WithField("error", dlErr.Error()).Error("Could not publish message to dead-letter topic")
+	}
+	return response, err
+}
+
+// retry pushes the request again once its backoff is over; if this fails (e.g. the connector was stopped),
+// its message is published to the dead-letter topic.
+func (s *retrySender) retry(r *retryRequest, err error) {
+	time.AfterFunc(s.backoff.ForAttempt(float64(r.attempts-1)), func() {
+		if pushErr := s.push(r); pushErr != nil {
+			logger.WithField("error", pushErr.Error()).Error("Could not push request to retry")
+			if dlErr := s.deadLetter(r.Request, err, r.attempts); dlErr != nil {
+				logger.WithField("error", dlErr.Error()).Error("Could not publish message to dead-letter topic")
+			}
+		}
+	})
+}
+
+// deadLetter publishes the message which could not be sent to the dead-letter topic,
+// with the details of the failure in the message header.
+// The messages of the dead-letter topic itself are never dead-lettered again.
+func (s *retrySender) deadLetter(request Request, err error, attempts int) error {
+	message := request.Message()
+	topic := protocol.Path(s.config.DeadLetterTopic)
+	if topic == "" || message.Path == topic {
+		return nil
+	}
+	header, jsonErr := json.Marshal(DeadLetterHeader{
+		Connector: s.name,
+		Topic:     string(message.Path),
+		MessageID: message.ID,
+		Params:    request.Subscriber().Route().RouteParams,
+		Error:     err.Error(),
+		Attempts:  attempts,
+	})
+	if jsonErr != nil {
+		return jsonErr
+	}
+
+	mTotalDeadLetters.Add(s.name, 1)
+	return s.router.HandleMessage(&protocol.Message{
+		Path:       topic,
+		UserID:     s.name,
+		HeaderJSON: string(header),
+		Body:       message.Body,
+	})
+}
@@ -0,0 +1,207 @@
+package connector
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+type temporaryError struct {
+	temporary bool
+}
+
+func (e temporaryError) Error() string   { return "temporary error" }
+func (e temporaryError) Temporary() bool { return e.temporary }
+
+func testRetryRequest(path protocol.Path, id uint64) Request {
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 0)
+	return NewRequest(s, &protocol.Message{ID: id, Path: path, Body: []byte("payload")})
+}
+
+func TestTemporary(t *testing.T) {
+	a := assert.New(t)
+	a.True(Temporary(temporaryError{true}))
+	a.False(Temporary(temporaryError{false}))
+	a.True(Temporary(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	a.False(Temporary(errors.New("error")))
+	a.False(Temporary(nil))
+}
+
+// retried returns a push func passing the retried requests to the channel.
+func retried() (func(Request) error, chan Request) {
+	c := make(chan Request, 1)
+	return func(r Request) error {
+		c <- r
+		return nil
+	}, c
+}
+
+func expectRetry(a *assert.Assertions, c chan Request) Request {
+	select {
+	case r := <-c:
+		return r
+	case <-time.After(time.Second):
+		a.FailNow("the request is not retried")
+	}
+	return nil
+}
+
+func TestRetrySender_RetriesTemporaryErrors(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	sender := NewMockSender(ctrl)
+	routerMock := NewMockRouter(ctrl)
+	push, retriedC := retried()
+	s := newRetrySender(sender, RetryConfig{
+		MaxAttempts:     3,
+		MinBackoff:      time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+		DeadLetterTopic: "/dead_letters",
+	}, "test", routerMock, push)
+
+	request := testRetryRequest("/foo", 1)
+	gomock.InOrder(
+		sender.EXPECT().Send(request).Return(nil, temporaryError{true}),
+		sender.EXPECT().Send(request).Return(nil, temporaryError{true}),
+		sender.EXPECT().Send(request).Return("ok", nil),
+	)
+
+	// the failed request is pushed again after its backoff, instead of waiting for it
+	_, err := s.Send(request)
+	a.Equal(ErrRetryScheduled, err)
+	retry := expectRetry(a, retriedC)
+	a.Equal(request.Message(), retry.Message())
+	_, err = s.Send(retry)
+	a.Equal(ErrRetryScheduled, err)
+
+	response, err := s.Send(expectRetry(a, retriedC))
+	a.NoError(err)
+	a.Equal("ok", response)
+}
+
+func TestRetrySender_SendsToDeadLetterTopic(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	sender := NewMockSender(ctrl)
+	routerMock := NewMockRouter(ctrl)
+	push, retriedC := retried()
+	s := newRetrySender(sender, RetryConfig{
+		MaxAttempts:     2,
+		MinBackoff:      time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+		DeadLetterTopic: "/dead_letters",
+	}, "test", routerMock, push)
+
+	request := testRetryRequest("/foo", 7)
+	sender.EXPECT().Send(request).Return(nil, temporaryError{true}).Times(2)
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/dead_letters"), m.Path)
+		a.Equal("test", m.UserID)
+		a.Equal([]byte("payload"), m.Body)
+		a.JSONEq(`{"connector":"test","topic":"/foo","message_id":7,"params":{"device_token":"device1"},`+
+			`"error":"temporary error","attempts":2}`, m.HeaderJSON)
+	}).Return(nil)
+
+	_, err := s.Send(request)
+	a.Equal(ErrRetryScheduled, err)
+	_, err = s.Send(expectRetry(a, retriedC))
+	a.Equal(temporaryError{true}, err)
+
+	// permanent errors are not retried
+	request = testRetryRequest("/foo", 8)
+	sender.EXPECT().Send(request).Return(nil, temporaryError{false})
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Return(nil)
+	_, err = s.Send(request)
+	a.Equal(temporaryError{false}, err)
+
+	// messages of the dead-letter topic are never dead-lettered again
+	request = testRetryRequest("/dead_letters", 9)
+	sender.EXPECT().Send(request).Return(nil, temporaryError{false})
+	_, err = s.Send(request)
+	a.Equal(temporaryError{false}, err)
+
+	// the request is dead-lettered if it can not be retried
+	s.push = func(Request) error { return ErrConnectorStopped }
+	request = testRetryRequest("/foo", 10)
+	deadLettered := make(chan bool)
+	sender.EXPECT().Send(request).Return(nil, temporaryError{true})
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Contains(m.HeaderJSON, `"attempts":1`)
+		close(deadLettered)
+	}).Return(nil)
+	_, err = s.Send(request)
+	a.Equal(ErrRetryScheduled, err)
+	select {
+	case <-deadLettered:
+	case <-time.After(time.Second):
+		a.Fail("the message is not dead-lettered")
+	}
+}
+
+func TestQueue_Retry(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	sender := NewMockSender(ctrl)
+	handler := NewMockResponseHandler(ctrl)
+	q := NewQueue(nil, 1)
+	q.SetSender(newRetrySender(sender, RetryConfig{
+		MaxAttempts: 2,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}, "test", NewMockRouter(ctrl), q.Push))
+	q.SetResponseHandler(handler)
+	a.NoError(q.Start())
+
+	// the response is handled once, after the successful retry
+	request := testRetryRequest("/foo", 1)
+	handled := make(chan bool)
+	gomock.InOrder(
+		sender.EXPECT().Send(request).Return(nil, temporaryError{true}),
+		sender.EXPECT().Send(request).Return("ok", nil),
+	)
+	handler.EXPECT().HandleResponse(gomock.Any(), "ok", gomock.Any(), nil).Do(
+		func(r Request, response interface{}, metadata *Metadata, err error) {
+			close(handled)
+		}).Return(nil)
+	a.NoError(q.Push(request))
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		a.Fail("the response is not handled")
+	}
+	a.NoError(q.Stop())
+}
+
+func TestConnector_SetSenderWithRetry(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn, _ := getTestConnector(t, Config{
+		Name:       "test",
+		Schema:     "test",
+		Prefix:     "/connector/",
+		URLPattern: "/{device_token}/{topic:.*}",
+		Retry:      &RetryConfig{MaxAttempts: 2},
+	}, false, false)
+	a.IsType(&retrySender{}, conn.Sender())
+
+	sender := NewMockSender(ctrl)
+	conn.SetSender(sender)
+	a.Equal(sender, conn.Sender().(*retrySender).Sender)
+}
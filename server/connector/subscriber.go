@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"sync"
 
 	"github.com/smancke/guble/protocol"
 	"github.com/smancke/guble/server/router"
@@ -35,16 +36,33 @@ type Subscriber interface {
 	Encode() ([]byte, error)
 }
 
+// Subscription is the JSON representation of a subscriber in the HTTP API of the connectors.
+type Subscription struct {
+	Topic  string            `json:"topic"`
+	Params map[string]string `json:"params"`
+}
+
+// SubscriptionOf returns the Subscription of the subscriber.
+func SubscriptionOf(s Subscriber) Subscription {
+	route := s.Route()
+	return Subscription{
+		Topic:  string(route.Path),
+		Params: route.RouteParams,
+	}
+}
+
 type SubscriberData struct {
-	Topic  protocol.Path
-	Params router.RouteParams
-	LastID uint64
+	Version int
+	Topic   protocol.Path
+	Params  router.RouteParams
+	LastID  uint64
 }
 
+// newRoute returns a route resuming after the last delivered message, if there is one.
 func (sd *SubscriberData) newRoute() *router.Route {
 	var fr *store.FetchRequest
 	if sd.LastID > 0 {
-		fr = store.NewFetchRequest(sd.Topic.Partition(), sd.LastID, 0, store.DirectionForward, -1)
+		fr = store.NewFetchRequest(sd.Topic.Partition(), sd.LastID+1, 0, store.DirectionForward, -1)
 	}
 	return router.NewRoute(router.RouteConfig{
 		Path:         sd.Topic,
@@ -54,8 +72,16 @@ func (sd *SubscriberData) newRoute() *router.Route {
 }
 
 type subscriber struct {
+	// mu guards the data, which is checkpointed by the concurrent workers of a connector,
+	// and the messages in flight
+	mu   sync.Mutex
 	data SubscriberData
 
+	// inFlight are the IDs of the messages pushed to the queue and not handled yet,
+	// and handled is the highest ID of the handled messages
+	inFlight map[uint64]struct{}
+	handled  uint64
+
 	key    string
 	route  *router.Route
 	cancel context.CancelFunc
@@ -71,14 +97,16 @@ func NewSubscriber(topic protocol.Path, params router.RouteParams, lastID uint64
 
 func NewSubscriberFromData(data SubscriberData) Subscriber {
 	return &subscriber{
-		data:  data,
-		route: data.newRoute(),
+		data:     data,
+		route:    data.newRoute(),
+		inFlight: make(map[uint64]struct{}),
+		handled:  data.LastID,
 	}
 }
 
+// NewSubscriberFromJSON decodes a stored subscriber, migrating it from an older version if needed.
 func NewSubscriberFromJSON(data []byte) (Subscriber, error) {
-	sd := SubscriberData{}
-	err := json.Unmarshal(data, &sd)
+	sd, _, err := decodeSubscriberData(data)
 	if err != nil {
 		return nil, err
 	}
@@ -90,8 +118,13 @@ func (s *subscriber) String() string {
 }
 
 func (s *subscriber) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.route = s.data.newRoute()
 	s.cancel = nil
+	// the messages after the checkpoint are fetched again by the new route
+	s.inFlight = make(map[uint64]struct{})
+	s.handled = s.data.LastID
 	return nil
 }
 
@@ -123,7 +156,13 @@ func (s *subscriber) Loop(ctx context.Context, q Queue) error {
 			if !opened {
 				break
 			}
+			// the params of the subscription may have changed since the message was routed
+			if !s.Filter(m.Filters) {
+				logger.WithField("messageID", m.ID).Debug("Message filters do not match the subscription")
+				continue
+			}
 
+			s.push(m.ID)
 			q.Push(NewRequest(s, m))
 		case <-sCtx.Done():
 			// If the parent context is still running then only this subscriber context
@@ -139,8 +178,40 @@ func (s *subscriber) Loop(ctx context.Context, q Queue) error {
 	return ErrRouteChannelClosed
 }
 
+// push marks the message as in flight, until it is handled.
+func (s *subscriber) push(ID uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight[ID] = struct{}{}
+}
+
+// SetLastID marks the message as handled, and checkpoints the highest ID below which all the messages
+// were handled: the messages are handled out of order by the concurrent workers (and the retries),
+// so that a message still in flight is fetched again after a restart. The checkpoint is never moved backwards.
 func (s *subscriber) SetLastID(ID uint64) {
-	s.data.LastID = ID
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, ID)
+	if ID > s.handled {
+		s.handled = ID
+	}
+	checkpoint := s.handled
+	for inFlight := range s.inFlight {
+		if inFlight <= checkpoint {
+			checkpoint = inFlight - 1
+		}
+	}
+	if checkpoint > s.data.LastID {
+		s.data.LastID = checkpoint
+	}
+}
+
+// handled marks the message of the request as handled by the connector, whether it was delivered or not
+// (e.g. dropped or dead-lettered), so that it does not hold back the checkpoint of its subscriber.
+func handled(request Request) {
+	if s, ok := request.Subscriber().(*subscriber); ok {
+		s.SetLastID(request.Message().ID)
+	}
 }
 
 func (s *subscriber) Cancel() {
@@ -150,7 +221,11 @@ func (s *subscriber) Cancel() {
 }
 
 func (s *subscriber) Encode() ([]byte, error) {
-	return json.Marshal(s.data)
+	s.mu.Lock()
+	data := s.data
+	s.mu.Unlock()
+	data.Version = SubscriberVersion
+	return json.Marshal(data)
 }
 
 func GenerateKey(topic string, params map[string]string) string {
@@ -0,0 +1,98 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+func TestSubscriber_SetLastIDIsMonotonic(t *testing.T) {
+	a := assert.New(t)
+
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 0)
+	s.SetLastID(5)
+	s.SetLastID(3)
+
+	data, err := s.Encode()
+	a.NoError(err)
+	a.Contains(string(data), `"LastID":5`)
+}
+
+func TestSubscriber_CheckpointsTheContiguousHandledMessages(t *testing.T) {
+	a := assert.New(t)
+
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 4).(*subscriber)
+	s.push(5)
+	s.push(6)
+	s.push(7)
+
+	// the message 5 is still in flight (e.g. waiting for a retry)
+	s.SetLastID(6)
+	a.Equal(uint64(4), s.data.LastID)
+
+	s.SetLastID(5)
+	a.Equal(uint64(6), s.data.LastID)
+
+	// a dropped message is handled as well
+	handled(NewRequest(s, &protocol.Message{ID: 7, Path: "/foo"}))
+	a.Equal(uint64(7), s.data.LastID)
+}
+
+func TestSubscriber_ResumesAfterLastID(t *testing.T) {
+	a := assert.New(t)
+
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1"}, 0)
+	a.Nil(s.Route().FetchRequest)
+
+	s.SetLastID(7)
+	a.NoError(s.Reset())
+	a.NotNil(s.Route().FetchRequest)
+	a.Equal(uint64(8), s.Route().FetchRequest.StartID)
+
+	// a restarted subscriber resumes from its stored position
+	data, err := s.Encode()
+	a.NoError(err)
+	restored, err := NewSubscriberFromJSON(data)
+	a.NoError(err)
+	a.Equal(uint64(8), restored.Route().FetchRequest.StartID)
+	a.Equal(s.Key(), restored.Key())
+}
+
+func TestSubscriber_LoopSkipsFilteredMessages(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	s := NewSubscriber("/foo", router.RouteParams{"device_token": "device1", "user_id": "user01"}, 0)
+	q := NewMockQueue(ctrl)
+
+	pushed := make(chan uint64, 2)
+	q.EXPECT().Push(gomock.Any()).Do(func(request Request) {
+		pushed <- request.Message().ID
+	}).Return(nil)
+
+	// the route delivers all the messages, whatever their filters
+	s.Route().IgnoreFilters = true
+	go func() {
+		s.Route().Deliver(&protocol.Message{ID: 1, Path: "/foo", Filters: map[string]string{"user_id": "user02"}}, true)
+		s.Route().Deliver(&protocol.Message{ID: 2, Path: "/foo", Filters: map[string]string{"user_id": "user01"}}, true)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Loop(ctx, q)
+
+	select {
+	case id := <-pushed:
+		a.Equal(uint64(2), id)
+	case <-time.After(time.Second):
+		a.FailNow("message was not pushed")
+	}
+}
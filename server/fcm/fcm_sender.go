@@ -12,8 +12,9 @@ import (
 )
 
 const (
-	// sendRetries is the number of retries when something fails
-	sendRetries = 5
+	// sendRetries is the number of retries of the FCM client when something fails:
+	// the failed requests are retried by the connector instead (see connector.RetryConfig)
+	sendRetries = 0
 
 	// sendTimeout timeout to wait for response from FCM
 	sendTimeout = time.Second
@@ -33,6 +34,9 @@ func (s *sender) Send(request connector.Request) (interface{}, error) {
 	deviceToken := request.Subscriber().Route().Get(deviceTokenKey)
 	fcmMessage := fcmMessage(request.Message())
 	fcmMessage.To = deviceToken
+	if fcmMessage.Priority == "" {
+		fcmMessage.Priority = fcmPriority(request.Message().Priority)
+	}
 	logger.WithFields(log.Fields{"deviceToken": fcmMessage.To}).Debug("sending message")
 	return s.gcmSender.Send(fcmMessage)
 }
@@ -61,6 +65,18 @@ func fcmMessage(message *protocol.Message) *gcm.Message {
 	return m
 }
 
+// fcmPriority returns the FCM priority of a message priority, or an empty one for the normal priority
+// (FCM delivers the data messages with the normal priority by default).
+func fcmPriority(p protocol.Priority) string {
+	switch {
+	case p > protocol.PriorityNormal:
+		return "high"
+	case p < protocol.PriorityNormal:
+		return "normal"
+	}
+	return ""
+}
+
 // isValidResponseError returns True if the error is accepted as a valid response
 // cases are InvalidRegistration and NotRegistered
 func isValidResponseError(err error) bool {
@@ -94,6 +94,13 @@ func TestConnector_GetErrorMessageFromFCM(t *testing.T) {
 	a.NoError(err)
 }
 
+func TestFCMPriority(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("high", fcmPriority(protocol.PriorityHigh))
+	a.Equal("", fcmPriority(protocol.PriorityNormal))
+	a.Equal("normal", fcmPriority(protocol.PriorityLow))
+}
+
 func TestFCMFormatMessage(t *testing.T) {
 	_, finish := testutil.NewMockCtrl(t)
 	defer finish()
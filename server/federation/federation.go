@@ -0,0 +1,398 @@
+package federation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/webserver"
+)
+
+const (
+	// applicationIDPrefix marks the messages received from another cluster (followed by the name of the cluster
+	// where they were published), so that they are not sent to the other clusters again.
+	applicationIDPrefix = "guble-federation:"
+
+	defaultChannelSize = 1000
+
+	// defaultQueueSize is the number of messages waiting to be sent to a peer, before dropping the new ones
+	defaultQueueSize = 10000
+
+	defaultRequestTimeout = 30 * time.Second
+
+	maxSendAttempts = 5
+	firstRetryDelay = time.Second
+)
+
+// Config is used for configuring the federation with other guble clusters.
+type Config struct {
+	Enabled *bool
+
+	// Name identifies this cluster in the federation.
+	Name *string
+
+	// Peers are the URLs of the federation endpoints of the other clusters.
+	Peers *[]string
+
+	// Topics are the guble topics whose messages are sent to the other clusters.
+	Topics *[]string
+
+	// Prefix is the endpoint receiving the messages from the other clusters.
+	Prefix *string
+
+	// Token authenticates the clusters to each other; it is required.
+	Token *string
+
+	// AdminKey is the admin API key of the peers, sent with the messages when their federation endpoint
+	// is protected by the admin authentication.
+	AdminKey *string
+
+	// The messages are sent to a peer in batches of BatchSize messages at most, at least every BatchInterval.
+	BatchSize     *int
+	BatchInterval *time.Duration
+}
+
+// Federation exchanges the messages of some topics with other guble clusters, typically in other regions:
+// the messages are delivered with a low latency to the local subscribers, and sent to the other clusters
+// over HTTP, in compressed batches.
+// A message is sent only by the cluster where it was published, which prevents loops between the clusters.
+// When running in a cluster, each message is sent by the node owning its partition.
+type Federation struct {
+	config Config
+	router router.Router
+	client *http.Client
+
+	routes []*router.Route
+	peers  []*peer
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+type peer struct {
+	url    string
+	queueC chan *federatedMessage
+}
+
+// batch is the body of the requests sent to the federation endpoint of a peer, as gzipped JSON.
+type batch struct {
+	Origin   string              `json:"origin"`
+	Messages []*federatedMessage `json:"messages"`
+}
+
+type federatedMessage struct {
+	Path       string `json:"path"`
+	UserID     string `json:"userId,omitempty"`
+	HeaderJSON string `json:"header,omitempty"`
+	Body       []byte `json:"body"`
+}
+
+// New returns a Federation of this cluster with the configured peers.
+func New(router router.Router, config Config) *Federation {
+	return &Federation{
+		config: config,
+		router: router,
+		client: &http.Client{Timeout: defaultRequestTimeout},
+	}
+}
+
+// Start subscribes to the federated topics, and starts sending their messages to the peers.
+func (f *Federation) Start() error {
+	logger.WithFields(log.Fields{
+		"name":   *f.config.Name,
+		"peers":  *f.config.Peers,
+		"topics": *f.config.Topics,
+	}).Info("Starting federation")
+	resetFederationMetrics()
+
+	f.ctx, f.cancelFunc = context.WithCancel(context.Background())
+
+	f.peers = nil
+	for _, url := range *f.config.Peers {
+		p := &peer{url: url, queueC: make(chan *federatedMessage, defaultQueueSize)}
+		f.peers = append(f.peers, p)
+		f.wg.Add(1)
+		go f.sendLoop(p)
+	}
+
+	f.routes = nil
+	for _, topic := range *f.config.Topics {
+		route := router.NewRoute(router.RouteConfig{
+			Path:        protocol.Path(topic),
+			ChannelSize: defaultChannelSize,
+		})
+		if _, err := f.router.Subscribe(route); err != nil {
+			f.Stop()
+			return err
+		}
+		f.routes = append(f.routes, route)
+		f.wg.Add(1)
+		go f.forward(route)
+	}
+	return nil
+}
+
+// Stop unsubscribes from the federated topics, and sends the pending messages one last time.
+func (f *Federation) Stop() error {
+	logger.Info("Stopping federation")
+	f.cancelFunc()
+	for _, route := range f.routes {
+		f.router.Unsubscribe(route)
+	}
+	f.wg.Wait()
+	return nil
+}
+
+// GetPrefix returns the prefix of the endpoint receiving the messages of the other clusters.
+func (f *Federation) GetPrefix() string {
+	return *f.config.Prefix
+}
+
+// ServeHTTP receives a batch of messages from another cluster, and publishes them in this cluster.
+func (f *Federation) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Only HTTP POST is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	if !f.authorized(req) {
+		http.Error(w, "Invalid federation token", http.StatusUnauthorized)
+		return
+	}
+
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, "Invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	b := &batch{}
+	if err := json.NewDecoder(body).Decode(b); err != nil {
+		http.Error(w, "Invalid batch of messages", http.StatusBadRequest)
+		return
+	}
+	if b.Origin == *f.config.Name {
+		// the messages were published in this cluster
+		mTotalLoopedMessages.Add(int64(len(b.Messages)))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for _, fm := range b.Messages {
+		if !f.federated(protocol.Path(fm.Path)) {
+			logger.WithFields(log.Fields{
+				"origin": b.Origin,
+				"path":   fm.Path,
+			}).Warn("Rejecting message of a topic which is not federated")
+			http.Error(w, "Topic is not federated: "+fm.Path, http.StatusForbidden)
+			return
+		}
+	}
+
+	for _, fm := range b.Messages {
+		m := &protocol.Message{
+			Path:          protocol.Path(fm.Path),
+			UserID:        fm.UserID,
+			ApplicationID: applicationIDPrefix + b.Origin,
+			HeaderJSON:    fm.HeaderJSON,
+			Body:          fm.Body,
+		}
+		if err := f.router.HandleMessage(m); err != nil {
+			logger.WithFields(log.Fields{
+				"error":  err.Error(),
+				"origin": b.Origin,
+				"path":   fm.Path,
+			}).Error("Could not handle federated message")
+			mTotalReceiveErrors.Add(1)
+			// the whole batch is sent again by the peer
+			http.Error(w, "Could not handle the messages", http.StatusServiceUnavailable)
+			return
+		}
+		mTotalReceivedMessages.Add(1)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorized returns true if the request has the federation token; an empty token never matches.
+func (f *Federation) authorized(req *http.Request) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return *f.config.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(*f.config.Token)) == 1
+}
+
+// federated returns true if the path is one of the federated topics, or one of their subtopics.
+func (f *Federation) federated(path protocol.Path) bool {
+	for _, topic := range *f.config.Topics {
+		t := strings.TrimSuffix(topic, "/")
+		if string(path) == t || strings.HasPrefix(string(path), t+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// forward queues the messages received by a route for all the peers.
+func (f *Federation) forward(route *router.Route) {
+	defer f.wg.Done()
+	for {
+		select {
+		case m, opened := <-route.MessagesChannel():
+			if !opened {
+				if f.ctx.Err() != nil {
+					return
+				}
+				logger.WithField("route", route.String()).Info("Route closed by router, subscribing again")
+				route = router.NewRoute(route.RouteConfig)
+				if _, err := f.router.Subscribe(route); err != nil {
+					logger.WithField("error", err.Error()).Error("Could not subscribe again")
+					return
+				}
+				continue
+			}
+			if !f.sends(m) {
+				continue
+			}
+			fm := &federatedMessage{
+				Path:       string(m.Path),
+				UserID:     m.UserID,
+				HeaderJSON: m.HeaderJSON,
+				Body:       m.Body,
+			}
+			for _, p := range f.peers {
+				select {
+				case p.queueC <- fm:
+				default:
+					logger.WithField("peer", p.url).Warn("Federation queue is full, dropping message")
+					mTotalDroppedMessages.Add(1)
+				}
+			}
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+// sends returns true if the message should be sent to the other clusters by this node.
+func (f *Federation) sends(m *protocol.Message) bool {
+	if strings.HasPrefix(m.ApplicationID, applicationIDPrefix) {
+		return false
+	}
+	if c := f.router.Cluster(); c != nil {
+		return c.OwnsKey(m.Path.Partition())
+	}
+	return true
+}
+
+// sendLoop sends the queued messages to the peer in batches.
+func (f *Federation) sendLoop(p *peer) {
+	defer f.wg.Done()
+	ticker := time.NewTicker(*f.config.BatchInterval)
+	defer ticker.Stop()
+
+	var messages []*federatedMessage
+	for {
+		select {
+		case fm := <-p.queueC:
+			messages = append(messages, fm)
+			if len(messages) >= *f.config.BatchSize {
+				f.sendWithRetries(p, messages)
+				messages = nil
+			}
+		case <-ticker.C:
+			if len(messages) > 0 {
+				f.sendWithRetries(p, messages)
+				messages = nil
+			}
+		case <-f.ctx.Done():
+			for len(p.queueC) > 0 {
+				messages = append(messages, <-p.queueC)
+			}
+			if len(messages) > 0 {
+				if err := f.send(p, messages); err != nil {
+					mTotalDroppedMessages.Add(int64(len(messages)))
+				}
+			}
+			return
+		}
+	}
+}
+
+// sendWithRetries sends a batch to the peer, retrying with an exponential backoff; the batch is dropped
+// after maxSendAttempts.
+func (f *Federation) sendWithRetries(p *peer, messages []*federatedMessage) {
+	delay := firstRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := f.send(p, messages)
+		if err == nil {
+			return
+		}
+		logger.WithFields(log.Fields{
+			"error":   err.Error(),
+			"peer":    p.url,
+			"attempt": attempt,
+		}).Warn("Could not send messages to federation peer")
+		if attempt == maxSendAttempts {
+			logger.WithField("peer", p.url).Error("Dropping messages not sent to federation peer")
+			mTotalDroppedMessages.Add(int64(len(messages)))
+			return
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *Federation) send(p *peer, messages []*federatedMessage) error {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	if err := json.NewEncoder(gz).Encode(&batch{Origin: *f.config.Name, Messages: messages}); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.url, buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Authorization", "Bearer "+*f.config.Token)
+	if f.config.AdminKey != nil && *f.config.AdminKey != "" {
+		req.Header.Set(webserver.AdminKeyHeader, *f.config.AdminKey)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		mTotalSendErrors.Add(1)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		mTotalSendErrors.Add(1)
+		return fmt.Errorf("federation peer responded with status %d", resp.StatusCode)
+	}
+
+	mTotalSentBatches.Add(1)
+	mTotalSentMessages.Add(int64(len(messages)))
+	return nil
+}
@@ -0,0 +1,26 @@
+package federation
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                     = metrics.NS("federation")
+	mTotalSentMessages     = ns.NewInt("total_sent_messages")
+	mTotalSentBatches      = ns.NewInt("total_sent_batches")
+	mTotalSendErrors       = ns.NewInt("total_send_errors")
+	mTotalDroppedMessages  = ns.NewInt("total_dropped_messages")
+	mTotalReceivedMessages = ns.NewInt("total_received_messages")
+	mTotalReceiveErrors    = ns.NewInt("total_receive_errors")
+	mTotalLoopedMessages   = ns.NewInt("total_looped_messages")
+)
+
+func resetFederationMetrics() {
+	mTotalSentMessages.Set(0)
+	mTotalSentBatches.Set(0)
+	mTotalSendErrors.Set(0)
+	mTotalDroppedMessages.Set(0)
+	mTotalReceivedMessages.Set(0)
+	mTotalReceiveErrors.Set(0)
+	mTotalLoopedMessages.Set(0)
+}
@@ -0,0 +1,142 @@
+package federation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/cluster"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+func testConfig(name string, peers, topics []string) Config {
+	enabled := true
+	prefix := "/federation/"
+	token := "secret"
+	batchSize := 2
+	batchInterval := 10 * time.Millisecond
+	return Config{
+		Enabled:       &enabled,
+		Name:          &name,
+		Peers:         &peers,
+		Topics:        &topics,
+		Prefix:        &prefix,
+		Token:         &token,
+		BatchSize:     &batchSize,
+		BatchInterval: &batchInterval,
+	}
+}
+
+func gzipBatch(a *assert.Assertions, b *batch) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	a.NoError(json.NewEncoder(gz).Encode(b))
+	a.NoError(gz.Close())
+	return buf
+}
+
+func TestFederation_SendsBatchesToPeers(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	batchC := make(chan *batch, 10)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("gzip", r.Header.Get("Content-Encoding"))
+		a.Equal("Bearer secret", r.Header.Get("Authorization"))
+		gz, err := gzip.NewReader(r.Body)
+		a.NoError(err)
+		b := &batch{}
+		a.NoError(json.NewDecoder(gz).Decode(b))
+		batchC <- b
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer peer.Close()
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().Cluster().Return((*cluster.Cluster)(nil)).AnyTimes()
+	var route *router.Route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo"), r.Path)
+		route = r
+	}).Return(nil, nil)
+
+	f := New(routerMock, testConfig("eu", []string{peer.URL}, []string{"/foo"}))
+	a.NoError(f.Start())
+
+	a.NoError(route.Deliver(&protocol.Message{ID: 1, Path: "/foo/bar", UserID: "marvin", Body: []byte("hello")}, false))
+	// messages coming from another cluster are not sent again
+	a.NoError(route.Deliver(&protocol.Message{ID: 2, Path: "/foo/bar", ApplicationID: applicationIDPrefix + "us", Body: []byte("loop")}, false))
+	a.NoError(route.Deliver(&protocol.Message{ID: 3, Path: "/foo/baz", Body: []byte("world")}, false))
+
+	select {
+	case b := <-batchC:
+		a.Equal("eu", b.Origin)
+		if a.Len(b.Messages, 2) {
+			a.Equal("/foo/bar", b.Messages[0].Path)
+			a.Equal("marvin", b.Messages[0].UserID)
+			a.Equal([]byte("hello"), b.Messages[0].Body)
+			a.Equal([]byte("world"), b.Messages[1].Body)
+		}
+	case <-time.After(time.Second):
+		a.Fail("batch was not sent")
+	}
+
+	routerMock.EXPECT().Unsubscribe(route)
+	a.NoError(f.Stop())
+}
+
+func TestFederation_ReceivesBatches(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	f := New(routerMock, testConfig("eu", nil, []string{"/foo"}))
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/foo/bar"), m.Path)
+		a.Equal("marvin", m.UserID)
+		a.Equal(applicationIDPrefix+"us", m.ApplicationID)
+		a.Equal([]byte("hello"), m.Body)
+	}).Return(nil)
+
+	post := func(token string, b *batch) int {
+		req := httptest.NewRequest(http.MethodPost, "/federation/", gzipBatch(a, b))
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	messages := []*federatedMessage{{Path: "/foo/bar", UserID: "marvin", Body: []byte("hello")}}
+	a.Equal(http.StatusNoContent, post("secret", &batch{Origin: "us", Messages: messages}))
+	a.Equal(http.StatusUnauthorized, post("wrong", &batch{Origin: "us", Messages: messages}))
+	a.Equal(http.StatusUnauthorized, post("", &batch{Origin: "us", Messages: messages}))
+
+	// messages of the topics which are not federated are rejected
+	a.Equal(http.StatusForbidden, post("secret", &batch{Origin: "us", Messages: []*federatedMessage{
+		{Path: "/foobar", Body: []byte("hello")},
+	}}))
+	a.Equal(http.StatusForbidden, post("secret", &batch{Origin: "us", Messages: []*federatedMessage{
+		{Path: "/foo/bar", Body: []byte("hello")},
+		{Path: "/admin/bar", Body: []byte("hello")},
+	}}))
+
+	// messages published in this cluster are not published again
+	a.Equal(http.StatusNoContent, post("secret", &batch{Origin: "eu", Messages: messages}))
+
+	// the token is required
+	*f.config.Token = ""
+	a.Equal(http.StatusUnauthorized, post("", &batch{Origin: "us", Messages: messages}))
+}
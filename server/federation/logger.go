@@ -0,0 +1,7 @@
+package federation
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "federation")
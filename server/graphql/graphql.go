@@ -0,0 +1,196 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	graphqllib "github.com/graph-gophers/graphql-go"
+
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/webserver"
+)
+
+// Config is used for configuring the GraphQL endpoint.
+type Config struct {
+	Enabled *bool
+	Prefix  *string
+}
+
+// executor executes GraphQL operations; it is implemented by *graphqllib.Schema.
+type executor interface {
+	Exec(ctx context.Context, query string, operationName string, variables map[string]interface{}) *graphqllib.Response
+	Subscribe(ctx context.Context, query string, operationName string, variables map[string]interface{}) (<-chan interface{}, error)
+}
+
+// request is the body of a GraphQL request, as sent over HTTP or in a websocket "start" message.
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: []string{subprotocol},
+}
+
+// Handler serves the GraphQL queries and mutations over HTTP,
+// and the subscriptions over websocket (using the subscriptions-transport-ws protocol of Apollo).
+type Handler struct {
+	prefix         string
+	schema         executor
+	resolver       *resolver
+	tokenValidator auth.TokenValidator
+}
+
+// MessageLimiter limits the rate of the messages published by each identity, implemented by a webserver.RateLimiter.
+type MessageLimiter interface {
+	AllowMessage(identity string) bool
+}
+
+// MessageQuota counts the messages published by each identity against their daily quotas, implemented by quota.Quotas.
+type MessageQuota interface {
+	Use(identity string, size int) error
+}
+
+// clientKey is the key of the client of the operations in their context.
+type clientKey struct{}
+
+// client identifies the client of the operations, for the rate limits and the quotas.
+type client struct {
+	rateLimitIdentity string
+	apiKey            string
+}
+
+func clientOf(ctx context.Context) client {
+	c, _ := ctx.Value(clientKey{}).(client)
+	return c
+}
+
+// userIDKey is the key of the authenticated user ID in the context of the operations.
+type userIDKey struct{}
+
+func withUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// authenticatedUserID returns the user ID authenticated for the operation, which the claimed user ID (if any) has to match,
+// or the claimed user ID if the operation is not authenticated.
+func authenticatedUserID(ctx context.Context, claimed *string) (string, error) {
+	userID, ok := ctx.Value(userIDKey{}).(string)
+	if !ok {
+		return stringValue(claimed), nil
+	}
+	if claimed != nil && *claimed != "" && *claimed != userID {
+		return "", auth.ErrUserIDMismatch
+	}
+	return userID, nil
+}
+
+// NewHandler returns a new GraphQL Handler for the given prefix, resolving the Schema with the router.
+func NewHandler(router router.Router, config Config) (*Handler, error) {
+	r := &resolver{router: router}
+	schema, err := graphqllib.ParseSchema(Schema, r)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{
+		prefix:   *config.Prefix,
+		schema:   schema,
+		resolver: r,
+	}, nil
+}
+
+// WithTokenValidator requires a valid bearer token on each request (or in the connection_init message of the subscriptions);
+// the userId arguments of the operations have to be its subject.
+func (h *Handler) WithTokenValidator(v auth.TokenValidator) *Handler {
+	h.tokenValidator = v
+	return h
+}
+
+// WithMessageLimiter limits the rate of the published messages, by the identity of the requests
+// given by the webserver.RateLimiter handling them.
+func (h *Handler) WithMessageLimiter(l MessageLimiter) *Handler {
+	h.resolver.messageLimiter = l
+	return h
+}
+
+// WithMessageQuota counts the published messages against the daily quotas of their API key or user.
+func (h *Handler) WithMessageQuota(q MessageQuota) *Handler {
+	h.resolver.messageQuota = q
+	return h
+}
+
+// GetPrefix returns the prefix.
+// It is a part of the service.endpoint implementation.
+func (h *Handler) GetPrefix() string {
+	return h.prefix
+}
+
+// ServeHTTP is an http.Handler.
+// It is a part of the service.endpoint implementation.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.Authenticate(h.tokenValidator, r, "")
+	pending := err == auth.ErrMissingToken && websocket.IsWebSocketUpgrade(r)
+	if err != nil && !pending {
+		http.Error(w, err.Error(), auth.AuthenticationStatus(err))
+		return
+	}
+	c := client{
+		rateLimitIdentity: webserver.RateLimitIdentity(r),
+		apiKey:            r.Header.Get(webserver.APIKeyHeader),
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.WithError(err).Error("Error on upgrading to websocket")
+			return
+		}
+		conn := newSubscriptionConn(wsConn, h.schema)
+		conn.ctx = context.WithValue(conn.ctx, clientKey{}, c)
+		if userID != "" {
+			conn.ctx = withUserID(conn.ctx, userID)
+		}
+		if pending {
+			// the subscriptions-transport-ws clients send their token in the connection_init message
+			conn.tokenValidator = h.tokenValidator
+		}
+		conn.serve()
+		return
+	}
+
+	req := request{}
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid GraphQL request", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), clientKey{}, c)
+	if userID != "" {
+		ctx = withUserID(ctx, userID)
+	}
+	response := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.WithError(err).Error("Could not write GraphQL response")
+	}
+}
@@ -0,0 +1,7 @@
+package graphql
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "graphql")
@@ -0,0 +1,258 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	graphqllib "github.com/graph-gophers/graphql-go"
+	"github.com/rs/xid"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/audit"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/quota"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/store"
+)
+
+// Schema is the GraphQL schema of the guble topics.
+const Schema = `
+schema {
+	query: Query
+	mutation: Mutation
+	subscription: Subscription
+}
+
+type Query {
+	# the stored messages of a topic, starting with the given ID
+	messages(topic: String!, startId: ID, count: Int, userId: String): [Message!]!
+}
+
+type Mutation {
+	# publishes a message on a topic
+	publish(topic: String!, body: String!, headerJson: String, userId: String): Message!
+}
+
+type Subscription {
+	# the messages published on a topic (and its subtopics)
+	messagePublished(topic: String!, userId: String): Message!
+}
+
+type Message {
+	id: ID!
+	path: String!
+	userId: String!
+	applicationId: String!
+	# the time of publishing, in RFC 3339 format
+	time: String!
+	headerJson: String
+	body: String!
+}
+`
+
+const subscriptionChannelSize = 100
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// resolver is the root resolver of the Schema.
+type resolver struct {
+	router         router.Router
+	messageLimiter MessageLimiter
+	messageQuota   MessageQuota
+}
+
+type messagesArgs struct {
+	Topic   string
+	StartID *graphqllib.ID
+	Count   *int32
+	UserID  *string
+}
+
+func (r *resolver) Messages(ctx context.Context, args messagesArgs) ([]*messageResolver, error) {
+	path := protocol.Path(args.Topic)
+	userID, err := authenticatedUserID(ctx, args.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessManager, err := r.router.AccessManager()
+	if err != nil {
+		return nil, err
+	}
+	if !accessManager.IsAllowed(auth.READ, userID, path) {
+		audit.RecordAuthFailure(auth.READ, userID, path)
+		return nil, &router.PermissionDeniedError{UserID: userID, AccessType: auth.READ, Path: path}
+	}
+
+	var startID uint64
+	if args.StartID != nil {
+		if startID, err = strconv.ParseUint(string(*args.StartID), 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	count := math.MaxInt32
+	if args.Count != nil && *args.Count > 0 {
+		count = int(*args.Count)
+	}
+
+	fr := store.NewFetchRequest(path.Partition(), startID, 0, store.DirectionForward, count)
+	fr.Init()
+	if err := r.router.Fetch(fr); err != nil {
+		return nil, err
+	}
+	fr.Ready()
+
+	messages := make([]*messageResolver, 0)
+	for {
+		select {
+		case fm, open := <-fr.Messages():
+			if !open {
+				return messages, nil
+			}
+			m, err := protocol.ParseMessage(fm.Message)
+			if err != nil {
+				logger.WithError(err).WithField("messageID", fm.ID).Error("Could not parse fetched message")
+				continue
+			}
+			if matchesTopic(m.Path, path) {
+				messages = append(messages, &messageResolver{m})
+			}
+		case err := <-fr.Errors():
+			return nil, err
+		}
+	}
+}
+
+type publishArgs struct {
+	Topic      string
+	Body       string
+	HeaderJSON *string
+	UserID     *string
+}
+
+func (r *resolver) Publish(ctx context.Context, args publishArgs) (*messageResolver, error) {
+	userID, err := authenticatedUserID(ctx, args.UserID)
+	if err != nil {
+		return nil, err
+	}
+	m := &protocol.Message{
+		Path:          protocol.Path(args.Topic),
+		UserID:        userID,
+		ApplicationID: xid.New().String(),
+		HeaderJSON:    stringValue(args.HeaderJSON),
+		Body:          []byte(args.Body),
+	}
+	c := clientOf(ctx)
+	if r.messageLimiter != nil && c.rateLimitIdentity != "" && !r.messageLimiter.AllowMessage(c.rateLimitIdentity) {
+		return nil, errRateLimited
+	}
+	if identity := quota.Identity(c.apiKey, userID); r.messageQuota != nil && identity != "" {
+		if err := r.messageQuota.Use(identity, len(m.Body)); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.router.HandleMessage(m); err != nil {
+		return nil, err
+	}
+	return &messageResolver{m}, nil
+}
+
+type messagePublishedArgs struct {
+	Topic  string
+	UserID *string
+}
+
+// MessagePublished subscribes to the topic until the context of the GraphQL subscription is done.
+func (r *resolver) MessagePublished(ctx context.Context, args messagePublishedArgs) (<-chan *messageResolver, error) {
+	userID, err := authenticatedUserID(ctx, args.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if router.IsDraining(r.router) {
+		return nil, router.ErrDraining
+	}
+	route := router.NewRoute(router.RouteConfig{
+		RouteParams: router.RouteParams{"application_id": xid.New().String(), "user_id": userID},
+		Path:        protocol.Path(args.Topic),
+		ChannelSize: subscriptionChannelSize,
+	})
+	if _, err := r.router.Subscribe(route); err != nil {
+		return nil, err
+	}
+
+	messagesC := make(chan *messageResolver)
+	go func() {
+		defer close(messagesC)
+		for {
+			select {
+			case m, opened := <-route.MessagesChannel():
+				if !opened {
+					logger.WithField("route", route.String()).Info("Route closed by router, ending GraphQL subscription")
+					return
+				}
+				select {
+				case messagesC <- &messageResolver{m}:
+				case <-ctx.Done():
+					r.router.Unsubscribe(route)
+					return
+				}
+			case <-ctx.Done():
+				r.router.Unsubscribe(route)
+				return
+			}
+		}
+	}()
+	return messagesC, nil
+}
+
+// messageResolver resolves the fields of a guble message.
+type messageResolver struct {
+	m *protocol.Message
+}
+
+func (r *messageResolver) ID() graphqllib.ID {
+	return graphqllib.ID(strconv.FormatUint(r.m.ID, 10))
+}
+
+func (r *messageResolver) Path() string {
+	return string(r.m.Path)
+}
+
+func (r *messageResolver) UserID() string {
+	return r.m.UserID
+}
+
+func (r *messageResolver) ApplicationID() string {
+	return r.m.ApplicationID
+}
+
+func (r *messageResolver) Time() string {
+	return time.Unix(r.m.Time, 0).UTC().Format(time.RFC3339)
+}
+
+func (r *messageResolver) HeaderJSON() *string {
+	if r.m.HeaderJSON == "" {
+		return nil
+	}
+	return &r.m.HeaderJSON
+}
+
+func (r *messageResolver) Body() string {
+	return string(r.m.Body)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// matchesTopic checks whether the message path is the topic path or one of its subtopics.
+func matchesTopic(messagePath, topicPath protocol.Path) bool {
+	return messagePath == topicPath || strings.HasPrefix(string(messagePath), string(topicPath)+"/")
+}
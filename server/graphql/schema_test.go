@@ -0,0 +1,153 @@
+package graphql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	graphqllib "github.com/graph-gophers/graphql-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/store"
+	"github.com/smancke/guble/testutil"
+)
+
+func TestResolver_Publish(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	r := &resolver{router: routerMock}
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/foo/bar"), m.Path)
+		a.Equal("user01", m.UserID)
+		a.Equal([]byte("hello"), m.Body)
+		m.ID = 42
+		m.Time = 1451236804
+	}).Return(nil)
+
+	userID := "user01"
+	m, err := r.Publish(context.Background(), publishArgs{Topic: "/foo/bar", Body: "hello", UserID: &userID})
+	a.NoError(err)
+	a.Equal(graphqllib.ID("42"), m.ID())
+	a.Equal("/foo/bar", m.Path())
+	a.Equal("2015-12-27T17:20:04Z", m.Time())
+	a.Nil(m.HeaderJSON())
+	a.Equal("hello", m.Body())
+}
+
+func TestResolver_PublishRateLimited(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	r := &resolver{router: routerMock, messageLimiter: &testMessageLimiter{identity: "ip:10.0.0.1", messages: 1}}
+	ctx := context.WithValue(context.Background(), clientKey{}, client{rateLimitIdentity: "ip:10.0.0.1"})
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Return(nil)
+	_, err := r.Publish(ctx, publishArgs{Topic: "/foo", Body: "hello"})
+	a.NoError(err)
+
+	_, err = r.Publish(ctx, publishArgs{Topic: "/foo", Body: "hello"})
+	a.Equal(errRateLimited, err)
+}
+
+// testMessageLimiter allows a number of messages to the identity
+type testMessageLimiter struct {
+	identity string
+	messages int
+}
+
+func (l *testMessageLimiter) AllowMessage(identity string) bool {
+	if identity != l.identity || l.messages == 0 {
+		return false
+	}
+	l.messages--
+	return true
+}
+
+func TestResolver_Messages(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().AccessManager().Return(auth.NewAllowAllAccessManager(true), nil)
+	r := &resolver{router: routerMock}
+
+	routerMock.EXPECT().Fetch(gomock.Any()).Do(func(fr *store.FetchRequest) {
+		a.Equal("foo", fr.Partition)
+		a.Equal(uint64(3), fr.StartID)
+		a.Equal(10, fr.Count)
+		go func() {
+			fr.StartC <- 2
+			fr.Push(3, (&protocol.Message{ID: 3, Path: "/foo/bar", Body: []byte("first")}).Bytes())
+			fr.Push(4, (&protocol.Message{ID: 4, Path: "/foobar"}).Bytes())
+			fr.Done()
+		}()
+	}).Return(nil)
+
+	startID := graphqllib.ID("3")
+	count := int32(10)
+	messages, err := r.Messages(context.Background(), messagesArgs{Topic: "/foo", StartID: &startID, Count: &count})
+	a.NoError(err)
+	a.Len(messages, 1)
+	a.Equal(graphqllib.ID("3"), messages[0].ID())
+	a.Equal("first", messages[0].Body())
+}
+
+func TestResolver_MessagesPermissionDenied(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().AccessManager().Return(auth.NewAllowAllAccessManager(false), nil)
+	r := &resolver{router: routerMock}
+
+	_, err := r.Messages(context.Background(), messagesArgs{Topic: "/foo"})
+	a.IsType(&router.PermissionDeniedError{}, err)
+}
+
+func TestResolver_MessagePublished(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	r := &resolver{router: routerMock}
+
+	var route *router.Route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(rt *router.Route) {
+		a.Equal(protocol.Path("/foo"), rt.Path)
+		route = rt
+	}).Return(nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messagesC, err := r.MessagePublished(ctx, messagePublishedArgs{Topic: "/foo"})
+	a.NoError(err)
+
+	a.NoError(route.Deliver(&protocol.Message{ID: 7, Path: "/foo", Body: []byte("hello")}, false))
+	select {
+	case m := <-messagesC:
+		a.Equal(graphqllib.ID("7"), m.ID())
+	case <-time.After(time.Second):
+		a.Fail("message was not received")
+	}
+
+	routerMock.EXPECT().Unsubscribe(route)
+	cancel()
+	select {
+	case _, opened := <-messagesC:
+		a.False(opened)
+	case <-time.After(time.Second):
+		a.Fail("subscription channel was not closed")
+	}
+}
@@ -0,0 +1,204 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/smancke/guble/server/auth"
+)
+
+const (
+	// subprotocol is the websocket subprotocol of subscriptions-transport-ws
+	subprotocol = "graphql-ws"
+
+	typeConnectionInit      = "connection_init"
+	typeConnectionAck       = "connection_ack"
+	typeConnectionError     = "connection_error"
+	typeConnectionTerminate = "connection_terminate"
+	typeStart               = "start"
+	typeData                = "data"
+	typeError               = "error"
+	typeComplete            = "complete"
+	typeStop                = "stop"
+)
+
+// operationMessage is the envelope of all the messages of the subscriptions-transport-ws protocol.
+type operationMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// jsonConn is the subset of the websocket.Conn used by the subscriptions.
+type jsonConn interface {
+	ReadJSON(v interface{}) error
+	WriteJSON(v interface{}) error
+	Close() error
+}
+
+// initPayload is the payload of the connection_init message, which can carry the bearer token
+// of the clients not able to set it on the websocket request.
+type initPayload struct {
+	AuthToken     string `json:"authToken"`
+	Authorization string `json:"Authorization"`
+}
+
+// subscriptionConn runs the GraphQL operations started by a websocket client.
+type subscriptionConn struct {
+	conn   jsonConn
+	schema executor
+
+	// ctx is the parent context of the operations, carrying the authenticated user ID (if any)
+	ctx context.Context
+	// tokenValidator authenticates the connection_init message, if the websocket request was not authenticated
+	tokenValidator auth.TokenValidator
+
+	writeMu    sync.Mutex
+	mu         sync.Mutex
+	operations map[string]context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+func newSubscriptionConn(conn jsonConn, schema executor) *subscriptionConn {
+	return &subscriptionConn{
+		conn:       conn,
+		schema:     schema,
+		ctx:        context.Background(),
+		operations: make(map[string]context.CancelFunc),
+	}
+}
+
+// serve reads the messages of the client until the connection is closed or terminated.
+func (c *subscriptionConn) serve() {
+	defer func() {
+		c.stopAll()
+		c.wg.Wait()
+		c.conn.Close()
+	}()
+
+	for {
+		msg := operationMessage{}
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			logger.WithError(err).Debug("GraphQL websocket closed")
+			return
+		}
+
+		switch msg.Type {
+		case typeConnectionInit:
+			if err := c.authenticate(msg.Payload); err != nil {
+				payload, _ := json.Marshal(map[string]string{"message": err.Error()})
+				c.write(operationMessage{Type: typeConnectionError, Payload: payload})
+				return
+			}
+			c.write(operationMessage{Type: typeConnectionAck})
+		case typeStart:
+			if c.tokenValidator != nil {
+				c.writeError(msg.ID, auth.ErrMissingToken.Error())
+				continue
+			}
+			c.start(msg)
+		case typeStop:
+			c.stop(msg.ID)
+		case typeConnectionTerminate:
+			return
+		default:
+			c.writeError(msg.ID, "unknown message type: "+msg.Type)
+		}
+	}
+}
+
+// authenticate validates the bearer token of the connection_init payload, if the connection is not authenticated yet.
+func (c *subscriptionConn) authenticate(data json.RawMessage) error {
+	if c.tokenValidator == nil {
+		return nil
+	}
+	payload := initPayload{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return err
+		}
+	}
+	token := payload.AuthToken
+	if token == "" {
+		token = strings.TrimSpace(strings.TrimPrefix(payload.Authorization, "Bearer "))
+	}
+	userID, err := auth.AuthenticateToken(c.tokenValidator, token, "")
+	if err != nil {
+		return err
+	}
+	c.ctx = withUserID(c.ctx, userID)
+	c.tokenValidator = nil
+	return nil
+}
+
+func (c *subscriptionConn) start(msg operationMessage) {
+	req := request{}
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		c.writeError(msg.ID, "invalid payload: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	responses, err := c.schema.Subscribe(ctx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		cancel()
+		c.writeError(msg.ID, err.Error())
+		return
+	}
+
+	c.mu.Lock()
+	if previous, ok := c.operations[msg.ID]; ok {
+		previous()
+	}
+	c.operations[msg.ID] = cancel
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer cancel()
+		for response := range responses {
+			payload, err := json.Marshal(response)
+			if err != nil {
+				logger.WithError(err).Error("Could not encode GraphQL response")
+				continue
+			}
+			c.write(operationMessage{ID: msg.ID, Type: typeData, Payload: payload})
+		}
+		c.write(operationMessage{ID: msg.ID, Type: typeComplete})
+	}()
+}
+
+// stop cancels the operation; its goroutine sends the complete message.
+func (c *subscriptionConn) stop(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.operations[id]; ok {
+		cancel()
+		delete(c.operations, id)
+	}
+}
+
+func (c *subscriptionConn) stopAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, cancel := range c.operations {
+		cancel()
+		delete(c.operations, id)
+	}
+}
+
+func (c *subscriptionConn) writeError(id, message string) {
+	payload, _ := json.Marshal(map[string]string{"message": message})
+	c.write(operationMessage{ID: id, Type: typeError, Payload: payload})
+}
+
+func (c *subscriptionConn) write(msg operationMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.conn.WriteJSON(msg); err != nil {
+		logger.WithError(err).WithField("type", msg.Type).Debug("Could not write to GraphQL websocket")
+	}
+}
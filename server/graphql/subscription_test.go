@@ -0,0 +1,188 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	graphqllib "github.com/graph-gophers/graphql-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/server/auth"
+)
+
+type fakeConn struct {
+	readC  chan operationMessage
+	writeC chan operationMessage
+	closed bool
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		readC:  make(chan operationMessage, 10),
+		writeC: make(chan operationMessage, 10),
+	}
+}
+
+func (c *fakeConn) ReadJSON(v interface{}) error {
+	msg, ok := <-c.readC
+	if !ok {
+		return io.EOF
+	}
+	*(v.(*operationMessage)) = msg
+	return nil
+}
+
+func (c *fakeConn) WriteJSON(v interface{}) error {
+	c.writeC <- v.(operationMessage)
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) expectWrite(a *assert.Assertions, id, typ string) operationMessage {
+	select {
+	case msg := <-c.writeC:
+		a.Equal(id, msg.ID)
+		a.Equal(typ, msg.Type)
+		return msg
+	case <-time.After(time.Second):
+		a.Fail("no message written", typ)
+		return operationMessage{}
+	}
+}
+
+// fakeExecutor streams the responses sent on its channel, until the operation is stopped.
+type fakeExecutor struct {
+	query     string
+	responses chan *graphqllib.Response
+	err       error
+}
+
+func (e *fakeExecutor) Exec(ctx context.Context, query string, operationName string, variables map[string]interface{}) *graphqllib.Response {
+	return &graphqllib.Response{}
+}
+
+func (e *fakeExecutor) Subscribe(ctx context.Context, query string, operationName string, variables map[string]interface{}) (<-chan interface{}, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.query = query
+	c := make(chan interface{})
+	go func() {
+		defer close(c)
+		for {
+			select {
+			case r := <-e.responses:
+				c <- r
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func TestSubscriptionConn_Protocol(t *testing.T) {
+	a := assert.New(t)
+
+	conn := newFakeConn()
+	schema := &fakeExecutor{responses: make(chan *graphqllib.Response)}
+	doneC := make(chan bool)
+	go func() {
+		newSubscriptionConn(conn, schema).serve()
+		doneC <- true
+	}()
+
+	conn.readC <- operationMessage{Type: typeConnectionInit}
+	conn.expectWrite(a, "", typeConnectionAck)
+
+	conn.readC <- operationMessage{
+		ID:      "1",
+		Type:    typeStart,
+		Payload: json.RawMessage(`{"query":"subscription { messagePublished(topic: \"/foo\") { id body } }"}`),
+	}
+	schema.responses <- &graphqllib.Response{Data: json.RawMessage(`{"messagePublished":{"id":"1","body":"hello"}}`)}
+	msg := conn.expectWrite(a, "1", typeData)
+	a.JSONEq(`{"data":{"messagePublished":{"id":"1","body":"hello"}}}`, string(msg.Payload))
+	a.Contains(schema.query, "messagePublished")
+
+	conn.readC <- operationMessage{ID: "1", Type: typeStop}
+	conn.expectWrite(a, "1", typeComplete)
+
+	conn.readC <- operationMessage{Type: typeConnectionTerminate}
+	select {
+	case <-doneC:
+		a.True(conn.closed)
+	case <-time.After(time.Second):
+		a.Fail("connection was not terminated")
+	}
+}
+
+func TestSubscriptionConn_Errors(t *testing.T) {
+	a := assert.New(t)
+
+	conn := newFakeConn()
+	schema := &fakeExecutor{err: errors.New("invalid query")}
+	go newSubscriptionConn(conn, schema).serve()
+
+	conn.readC <- operationMessage{ID: "1", Type: typeStart, Payload: json.RawMessage(`{"query":"subscription {}"}`)}
+	msg := conn.expectWrite(a, "1", typeError)
+	a.JSONEq(`{"message":"invalid query"}`, string(msg.Payload))
+
+	conn.readC <- operationMessage{ID: "2", Type: "unknown"}
+	conn.expectWrite(a, "2", typeError)
+
+	close(conn.readC)
+}
+
+// fakeValidator accepts the token "valid", whose subject is user01.
+type fakeValidator struct{}
+
+func (fakeValidator) Validate(token string) (*auth.Claims, error) {
+	if token != "valid" {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Claims{Subject: "user01"}, nil
+}
+
+func TestSubscriptionConn_Authentication(t *testing.T) {
+	a := assert.New(t)
+
+	conn := newFakeConn()
+	schema := &fakeExecutor{responses: make(chan *graphqllib.Response)}
+	c := newSubscriptionConn(conn, schema)
+	c.tokenValidator = fakeValidator{}
+	go c.serve()
+
+	// the operations are refused until the connection is authenticated
+	conn.readC <- operationMessage{ID: "1", Type: typeStart, Payload: json.RawMessage(`{"query":"subscription {}"}`)}
+	conn.expectWrite(a, "1", typeError)
+
+	conn.readC <- operationMessage{Type: typeConnectionInit, Payload: json.RawMessage(`{"authToken":"valid"}`)}
+	conn.expectWrite(a, "", typeConnectionAck)
+	userID, err := authenticatedUserID(c.ctx, nil)
+	a.NoError(err)
+	a.Equal("user01", userID)
+
+	_, err = authenticatedUserID(c.ctx, &userID)
+	a.NoError(err)
+	other := "user02"
+	_, err = authenticatedUserID(c.ctx, &other)
+	a.Equal(auth.ErrUserIDMismatch, err)
+	close(conn.readC)
+
+	conn = newFakeConn()
+	c = newSubscriptionConn(conn, schema)
+	c.tokenValidator = fakeValidator{}
+	go c.serve()
+	conn.readC <- operationMessage{Type: typeConnectionInit, Payload: json.RawMessage(`{"Authorization":"Bearer invalid"}`)}
+	msg := conn.expectWrite(a, "", typeConnectionError)
+	a.JSONEq(`{"message":"The token is invalid"}`, string(msg.Payload))
+}
@@ -0,0 +1,7 @@
+package grpc
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "grpc")
@@ -0,0 +1,109 @@
+package grpc
+
+//go:generate protoc --go_out=plugins=grpc:. guble.proto
+
+import (
+	"net"
+
+	grpclib "google.golang.org/grpc"
+
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/router"
+)
+
+// Config is used for configuring the gRPC API.
+type Config struct {
+	Enabled *bool
+	Listen  *string
+}
+
+// Server serves the Guble gRPC service (defined in guble.proto) on its own listener.
+type Server struct {
+	config         Config
+	router         router.Router
+	tokenValidator auth.TokenValidator
+	messageLimiter MessageLimiter
+	messageQuota   MessageQuota
+
+	server *grpclib.Server
+	ln     net.Listener
+}
+
+// MessageLimiter limits the rate of the messages published by each identity, implemented by a webserver.RateLimiter.
+type MessageLimiter interface {
+	AllowMessage(identity string) bool
+}
+
+// MessageQuota counts the messages published by each identity against their daily quotas, implemented by quota.Quotas.
+type MessageQuota interface {
+	Use(identity string, size int) error
+}
+
+// New returns a new gRPC Server using the given router.
+func New(router router.Router, config Config) *Server {
+	return &Server{
+		config: config,
+		router: router,
+	}
+}
+
+// WithTokenValidator requires a valid bearer token in the "authorization" metadata of each call;
+// the user ID of the requests has to be its subject.
+func (s *Server) WithTokenValidator(v auth.TokenValidator) *Server {
+	s.tokenValidator = v
+	return s
+}
+
+// WithMessageLimiter limits the rate of the published messages, by their authenticated user or else their IP address.
+func (s *Server) WithMessageLimiter(l MessageLimiter) *Server {
+	s.messageLimiter = l
+	return s
+}
+
+// WithMessageQuota counts the published messages against the daily quotas of their user.
+func (s *Server) WithMessageQuota(q MessageQuota) *Server {
+	s.messageQuota = q
+	return s
+}
+
+// Start listens on the configured address and serves the gRPC requests (implementing service.startable interface).
+func (s *Server) Start() error {
+	logger.WithField("address", *s.config.Listen).Info("gRPC server is starting up on address")
+
+	ln, err := net.Listen("tcp", *s.config.Listen)
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+	s.server = grpclib.NewServer()
+	RegisterGubleServer(s.server, &service{
+		router:         s.router,
+		tokenValidator: s.tokenValidator,
+		messageLimiter: s.messageLimiter,
+		messageQuota:   s.messageQuota,
+	})
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil {
+			logger.WithError(err).Error("gRPC Serve")
+		}
+		logger.WithField("address", *s.config.Listen).Info("gRPC server stopped")
+	}()
+	return nil
+}
+
+// Stop closes the listener and all the open streams (implementing service.stopable interface).
+func (s *Server) Stop() error {
+	if s.server != nil {
+		s.server.Stop()
+	}
+	return nil
+}
+
+// GetAddr returns the address on which the gRPC server is listening.
+func (s *Server) GetAddr() string {
+	if s.ln == nil {
+		return "::unknown::"
+	}
+	return s.ln.Addr().String()
+}
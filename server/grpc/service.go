@@ -0,0 +1,307 @@
+package grpc
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rs/xid"
+	"golang.org/x/net/context"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/audit"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/quota"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/store"
+	"github.com/smancke/guble/server/webserver"
+)
+
+const defaultChannelSize = 100
+
+// service implements the GubleServer interface on top of the router.
+type service struct {
+	router         router.Router
+	tokenValidator auth.TokenValidator
+	messageLimiter MessageLimiter
+	messageQuota   MessageQuota
+}
+
+func (s *service) Publish(ctx context.Context, req *PublishRequest) (*PublishResponse, error) {
+	if err := validatePath(req.Path); err != nil {
+		return nil, err
+	}
+	userID, err := s.authenticate(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	applicationID := req.ApplicationId
+	if applicationID == "" {
+		applicationID = xid.New().String()
+	}
+	m := &protocol.Message{
+		Path:          protocol.Path(req.Path),
+		UserID:        userID,
+		ApplicationID: applicationID,
+		HeaderJSON:    req.HeaderJson,
+		Body:          req.Body,
+	}
+	for key, value := range req.Filters {
+		m.SetFilter(key, value)
+	}
+	if err := m.ValidateEncryption(); err != nil {
+		return nil, grpclib.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if identity := s.rateLimitIdentity(ctx, userID); s.messageLimiter != nil && identity != "" && !s.messageLimiter.AllowMessage(identity) {
+		return nil, grpclib.Errorf(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	if identity := quota.Identity("", userID); s.messageQuota != nil && identity != "" {
+		if err := s.messageQuota.Use(identity, len(m.Body)); err != nil {
+			return nil, grpclib.Errorf(codes.ResourceExhausted, err.Error())
+		}
+	}
+
+	if err := s.router.HandleMessage(m); err != nil {
+		return nil, statusError(err)
+	}
+	return &PublishResponse{Id: m.ID}, nil
+}
+
+func (s *service) Subscribe(req *SubscribeRequest, stream Guble_SubscribeServer) error {
+	if err := validatePath(req.Path); err != nil {
+		return err
+	}
+	userID, err := s.authenticate(stream.Context(), req.UserId)
+	if err != nil {
+		return err
+	}
+	if router.IsDraining(s.router) {
+		return grpclib.Errorf(codes.Unavailable, router.ErrDraining.Error())
+	}
+
+	params := router.RouteParams{}
+	for key, value := range req.Params {
+		params[key] = value
+	}
+	params["user_id"] = userID
+	params["application_id"] = req.ApplicationId
+	if req.ApplicationId == "" {
+		params["application_id"] = xid.New().String()
+	}
+
+	startID := req.StartId
+	var lastID uint64
+	for {
+		var fr *store.FetchRequest
+		if startID > 0 {
+			fr = store.NewFetchRequest("", startID, 0, store.DirectionForward, -1)
+		}
+		route := router.NewRoute(router.RouteConfig{
+			RouteParams:  params,
+			Path:         protocol.Path(req.Path),
+			ChannelSize:  defaultChannelSize,
+			FetchRequest: fr,
+		})
+
+		done, err := s.stream(route, stream, &lastID)
+		if done || err != nil {
+			return err
+		}
+
+		// the router closed the route, because the client is too slow:
+		// subscribe again, fetching the messages sent in the meantime
+		logger.WithField("lastID", lastID).Info("Route closed by router, subscribing again")
+		if lastID > 0 {
+			startID = lastID + 1
+		}
+	}
+}
+
+// stream sends the messages of the route (fetched and then subscribed) to the client,
+// until the client or the router is done or the route is closed.
+func (s *service) stream(route *router.Route, stream Guble_SubscribeServer, lastID *uint64) (bool, error) {
+	provideC := make(chan error, 1)
+	go func() {
+		provideC <- route.Provide(s.router, true)
+	}()
+
+	for {
+		select {
+		case err := <-provideC:
+			if err != nil {
+				return true, statusError(err)
+			}
+			provideC = nil
+		case m, opened := <-route.MessagesChannel():
+			if !opened {
+				return stream.Context().Err() != nil, nil
+			}
+			if m.ID <= *lastID {
+				continue
+			}
+			if err := stream.Send(m.ToProto()); err != nil {
+				s.router.Unsubscribe(route)
+				return true, err
+			}
+			*lastID = m.ID
+		case <-stream.Context().Done():
+			s.router.Unsubscribe(route)
+			return true, nil
+		case <-s.router.Done():
+			return true, grpclib.Errorf(codes.Unavailable, "server is stopping")
+		}
+	}
+}
+
+func (s *service) Fetch(req *FetchRequest, stream Guble_FetchServer) error {
+	if err := validatePath(req.Path); err != nil {
+		return err
+	}
+	userID, err := s.authenticate(stream.Context(), req.UserId)
+	if err != nil {
+		return err
+	}
+	path := protocol.Path(req.Path)
+
+	accessManager, err := s.router.AccessManager()
+	if err != nil {
+		return statusError(err)
+	}
+	if !accessManager.IsAllowed(auth.READ, userID, path) {
+		audit.RecordAuthFailure(auth.READ, userID, path)
+		return statusError(&router.PermissionDeniedError{UserID: userID, AccessType: auth.READ, Path: path})
+	}
+
+	direction := store.DirectionForward
+	startID := req.StartId
+	if req.Backwards {
+		direction = store.DirectionBackwards
+		if startID == 0 {
+			messageStore, err := s.router.MessageStore()
+			if err != nil {
+				return statusError(err)
+			}
+			if startID, err = messageStore.MaxMessageID(path.Partition()); err != nil {
+				return statusError(err)
+			}
+		}
+	}
+	count := int(req.Count)
+	if count <= 0 {
+		count = -1
+	}
+
+	fr := store.NewFetchRequest(path.Partition(), startID, 0, direction, count)
+	fr.Init()
+	if err := s.router.Fetch(fr); err != nil {
+		return statusError(err)
+	}
+	fr.Ready()
+
+	for {
+		select {
+		case fm, open := <-fr.Messages():
+			if !open {
+				return nil
+			}
+			m, err := protocol.ParseMessage(fm.Message)
+			if err != nil {
+				logger.WithFields(log.Fields{
+					"error":     err.Error(),
+					"messageID": fm.ID,
+				}).Error("Could not parse fetched message")
+				continue
+			}
+			if !matchesTopic(m.Path, path) {
+				continue
+			}
+			if err := stream.Send(m.ToProto()); err != nil {
+				go drain(fr)
+				return err
+			}
+		case err := <-fr.Errors():
+			return statusError(err)
+		case <-stream.Context().Done():
+			go drain(fr)
+			return nil
+		}
+	}
+}
+
+// drain consumes the rest of a fetch request, so that the message store is not blocked.
+func drain(fr *store.FetchRequest) {
+	for {
+		select {
+		case _, open := <-fr.Messages():
+			if !open {
+				return
+			}
+		case <-fr.Errors():
+			return
+		}
+	}
+}
+
+func validatePath(path string) error {
+	if len(path) < 2 || path[0] != '/' {
+		return grpclib.Errorf(codes.InvalidArgument, "invalid topic path: %q", path)
+	}
+	return nil
+}
+
+// authenticate returns the user ID of a call: the subject of the bearer token of its "authorization" metadata,
+// or the claimed user ID if no token validator is configured.
+func (s *service) authenticate(ctx context.Context, userID string) (string, error) {
+	if s.tokenValidator == nil {
+		return userID, nil
+	}
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md["authorization"] {
+			if strings.HasPrefix(value, "Bearer ") {
+				token = strings.TrimSpace(strings.TrimPrefix(value, "Bearer "))
+			}
+		}
+	}
+	userID, err := auth.AuthenticateToken(s.tokenValidator, token, userID)
+	if err == auth.ErrUserIDMismatch {
+		return "", grpclib.Errorf(codes.PermissionDenied, err.Error())
+	} else if err != nil {
+		return "", grpclib.Errorf(codes.Unauthenticated, err.Error())
+	}
+	return userID, nil
+}
+
+// rateLimitIdentity returns the identity of the caller for the rate limits: its authenticated user, or else its IP address.
+func (s *service) rateLimitIdentity(ctx context.Context, userID string) string {
+	if s.tokenValidator == nil {
+		userID = ""
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return webserver.ConnIdentity(userID, p.Addr.String())
+	}
+	if userID != "" {
+		return webserver.ConnIdentity(userID, "")
+	}
+	return ""
+}
+
+// statusError converts a router error to a gRPC error with the matching status code.
+func statusError(err error) error {
+	switch err.(type) {
+	case *router.PermissionDeniedError:
+		return grpclib.Errorf(codes.PermissionDenied, err.Error())
+	case *router.ModuleStoppingError:
+		return grpclib.Errorf(codes.Unavailable, err.Error())
+	}
+	return grpclib.Errorf(codes.Internal, err.Error())
+}
+
+// matchesTopic checks whether the message path is the topic path or one of its subtopics.
+func matchesTopic(messagePath, topicPath protocol.Path) bool {
+	return messagePath == topicPath || strings.HasPrefix(string(messagePath), string(topicPath)+"/")
+}
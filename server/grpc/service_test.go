@@ -0,0 +1,262 @@
+package grpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/protocol/pb"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/store"
+	"github.com/smancke/guble/testutil"
+)
+
+// fakeStream implements both Guble_SubscribeServer and Guble_FetchServer.
+type fakeStream struct {
+	ctx   context.Context
+	sentC chan *pb.Message
+}
+
+func newFakeStream(ctx context.Context) *fakeStream {
+	return &fakeStream{ctx: ctx, sentC: make(chan *pb.Message, 10)}
+}
+
+func (s *fakeStream) Send(m *pb.Message) error {
+	s.sentC <- m
+	return nil
+}
+
+func (s *fakeStream) Context() context.Context     { return s.ctx }
+func (s *fakeStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeStream) SetTrailer(metadata.MD)       {}
+func (s *fakeStream) SendMsg(m interface{}) error  { return nil }
+func (s *fakeStream) RecvMsg(m interface{}) error  { return nil }
+
+func TestService_Publish(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	s := &service{router: routerMock}
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/foo/bar"), m.Path)
+		a.Equal("user01", m.UserID)
+		a.NotEmpty(m.ApplicationID)
+		a.Equal(`{"key":"value"}`, m.HeaderJSON)
+		a.Equal([]byte("hello"), m.Body)
+		a.Equal(map[string]string{"device": "android"}, m.Filters)
+		m.ID = 42
+	}).Return(nil)
+
+	resp, err := s.Publish(context.Background(), &PublishRequest{
+		Path:       "/foo/bar",
+		UserId:     "user01",
+		HeaderJson: `{"key":"value"}`,
+		Body:       []byte("hello"),
+		Filters:    map[string]string{"device": "android"},
+	})
+	a.NoError(err)
+	a.Equal(uint64(42), resp.Id)
+}
+
+func TestService_PublishErrors(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	s := &service{router: routerMock}
+
+	_, err := s.Publish(context.Background(), &PublishRequest{Path: "foo"})
+	a.Equal(codes.InvalidArgument, grpclib.Code(err))
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).
+		Return(&router.PermissionDeniedError{UserID: "user01", AccessType: auth.WRITE, Path: "/foo"})
+	_, err = s.Publish(context.Background(), &PublishRequest{Path: "/foo", UserId: "user01"})
+	a.Equal(codes.PermissionDenied, grpclib.Code(err))
+}
+
+func TestService_Subscribe(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().Done().Return(make(chan bool)).AnyTimes()
+	s := &service{router: routerMock}
+
+	routeC := make(chan *router.Route, 1)
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo"), r.Path)
+		a.Equal("user01", r.Get("user_id"))
+		a.Equal("app01", r.Get("application_id"))
+		a.Equal("android", r.Get("device"))
+		routeC <- r
+	}).Return(nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := newFakeStream(ctx)
+	doneC := make(chan error)
+	go func() {
+		doneC <- s.Subscribe(&SubscribeRequest{
+			Path:          "/foo",
+			UserId:        "user01",
+			ApplicationId: "app01",
+			Params:        map[string]string{"device": "android"},
+		}, stream)
+	}()
+
+	var route *router.Route
+	select {
+	case route = <-routeC:
+	case <-time.After(time.Second):
+		a.FailNow("route was not subscribed")
+	}
+
+	a.NoError(route.Deliver(&protocol.Message{
+		ID:      1,
+		Path:    "/foo/bar",
+		Body:    []byte("hello"),
+		NodeID:  2,
+		Filters: map[string]string{"device": "android"},
+	}, false))
+	select {
+	case m := <-stream.sentC:
+		a.Equal(uint64(1), m.Id)
+		a.Equal("/foo/bar", m.Path)
+		a.Equal([]byte("hello"), m.Body)
+		a.Equal(uint32(2), m.NodeId)
+		a.Equal(map[string]string{"device": "android"}, m.Filters)
+	case <-time.After(time.Second):
+		a.Fail("message was not sent")
+	}
+
+	routerMock.EXPECT().Unsubscribe(route)
+	cancel()
+	select {
+	case err := <-doneC:
+		a.NoError(err)
+	case <-time.After(time.Second):
+		a.Fail("subscription did not end")
+	}
+}
+
+func TestService_Fetch(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().AccessManager().Return(auth.NewAllowAllAccessManager(true), nil)
+	s := &service{router: routerMock}
+
+	routerMock.EXPECT().Fetch(gomock.Any()).Do(func(fr *store.FetchRequest) {
+		a.Equal("foo", fr.Partition)
+		a.Equal(uint64(3), fr.StartID)
+		a.Equal(store.DirectionForward, fr.Direction)
+		a.Equal(2, fr.Count)
+		go func() {
+			fr.StartC <- 2
+			fr.Push(3, (&protocol.Message{ID: 3, Path: "/foo", Body: []byte("first")}).Bytes())
+			fr.Push(4, (&protocol.Message{ID: 4, Path: "/foobar"}).Bytes())
+			fr.Done()
+		}()
+	}).Return(nil)
+
+	stream := newFakeStream(context.Background())
+	a.NoError(s.Fetch(&FetchRequest{Path: "/foo", StartId: 3, Count: 2}, stream))
+
+	a.Len(stream.sentC, 1)
+	m := <-stream.sentC
+	a.Equal(uint64(3), m.Id)
+	a.Equal([]byte("first"), m.Body)
+}
+
+func TestService_FetchPermissionDenied(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().AccessManager().Return(auth.NewAllowAllAccessManager(false), nil)
+	s := &service{router: routerMock}
+
+	err := s.Fetch(&FetchRequest{Path: "/foo", UserId: "user01"}, newFakeStream(context.Background()))
+	a.Equal(codes.PermissionDenied, grpclib.Code(err))
+}
+
+// fakeValidator accepts the token "valid", whose subject is user01.
+type fakeValidator struct{}
+
+func (fakeValidator) Validate(token string) (*auth.Claims, error) {
+	if token != "valid" {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Claims{Subject: "user01"}, nil
+}
+
+func TestService_PublishAuthenticated(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	s := &service{router: routerMock, tokenValidator: fakeValidator{}}
+
+	_, err := s.Publish(context.Background(), &PublishRequest{Path: "/foo"})
+	a.Equal(codes.Unauthenticated, grpclib.Code(err))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{"authorization": []string{"Bearer valid"}})
+	_, err = s.Publish(ctx, &PublishRequest{Path: "/foo", UserId: "user02"})
+	a.Equal(codes.PermissionDenied, grpclib.Code(err))
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal("user01", m.UserID)
+	}).Return(nil)
+	_, err = s.Publish(ctx, &PublishRequest{Path: "/foo"})
+	a.NoError(err)
+}
+
+func TestService_PublishRateLimited(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	s := &service{router: routerMock, messageLimiter: &testMessageLimiter{identity: "ip:10.0.0.1", messages: 1}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4242}})
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Return(nil)
+	_, err := s.Publish(ctx, &PublishRequest{Path: "/foo", UserId: "user01"})
+	a.NoError(err)
+
+	_, err = s.Publish(ctx, &PublishRequest{Path: "/foo", UserId: "user01"})
+	a.Equal(codes.ResourceExhausted, grpclib.Code(err))
+}
+
+// testMessageLimiter allows a number of messages to the identity
+type testMessageLimiter struct {
+	identity string
+	messages int
+}
+
+func (l *testMessageLimiter) AllowMessage(identity string) bool {
+	if identity != l.identity || l.messages == 0 {
+		return false
+	}
+	l.messages--
+	return true
+}
@@ -5,22 +5,23 @@ import (
 
 	"github.com/smancke/guble/logformatter"
 	"github.com/smancke/guble/protocol"
-	"github.com/smancke/guble/server/apns"
 	"github.com/smancke/guble/server/auth"
 	"github.com/smancke/guble/server/cluster"
-	"github.com/smancke/guble/server/fcm"
+	"github.com/smancke/guble/server/connector"
 	"github.com/smancke/guble/server/kvstore"
 	"github.com/smancke/guble/server/metrics"
-	"github.com/smancke/guble/server/rest"
+	"github.com/smancke/guble/server/quota"
 	"github.com/smancke/guble/server/router"
 	"github.com/smancke/guble/server/service"
-	"github.com/smancke/guble/server/sms"
 	"github.com/smancke/guble/server/store"
 	"github.com/smancke/guble/server/store/dummystore"
 	"github.com/smancke/guble/server/store/filestore"
+	"github.com/smancke/guble/server/systemd"
 	"github.com/smancke/guble/server/webserver"
-	"github.com/smancke/guble/server/websocket"
 
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -28,19 +29,22 @@ import (
 	"path"
 	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
-	"github.com/Bogh/gcm"
 	"github.com/pkg/profile"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
 const (
 	fileOption = "file"
+
+	slackTimeout = 10 * time.Second
 )
 
 var AfterMessageDelivery = func(m *protocol.Message) {
-	logger.WithField("message", m).Debug("message delivered")
+	logger.WithFields(m.LogFields()).Debug("message delivered")
 }
 
 // ValidateStoragePath validates the guble configuration with regard to the storagePath
@@ -114,89 +118,31 @@ var CreateMessageStore = func() store.MessageStore {
 }
 
 // CreateModules is a func which returns a slice of modules which should be used by the service
-// (currently, based on guble configuration);
+// (based on guble configuration, see moduleFactories);
 // see package `service` for terminological details.
 var CreateModules = func(router router.Router) []interface{} {
-	var modules []interface{}
-
-	if wsHandler, err := websocket.NewWSHandler(router, "/stream/"); err != nil {
-		logger.WithError(err).Error("Error loading WSHandler module")
-	} else {
-		modules = append(modules, wsHandler)
+	connector.DefaultMaxWorkers = *Config.Connector.MaxWorkers
+	connector.DefaultReceiptTopic = *Config.Connector.ReceiptTopic
+	templates, err := connector.ParsePayloadTemplates(*Config.Connector.Templates)
+	if err != nil {
+		logger.WithError(err).Panic("Invalid payload template")
 	}
-
-	modules = append(modules, rest.NewRestMessageAPI(router, "/api/"))
-
-	if *Config.FCM.Enabled {
-		logger.Info("Firebase Cloud Messaging: enabled")
-		if *Config.FCM.APIKey == "" {
-			logger.Panic("The API Key has to be provided when Firebase Cloud Messaging is enabled")
-		}
-		Config.FCM.AfterMessageDelivery = AfterMessageDelivery
-		*Config.FCM.IntervalMetrics = true
-		if Config.FCM.Endpoint != nil {
-			gcm.GcmSendEndpoint = *Config.FCM.Endpoint
-		}
-		sender := fcm.NewSender(*Config.FCM.APIKey)
-		if fcmConn, err := fcm.New(router, sender, Config.FCM); err != nil {
-			logger.WithError(err).Error("Error creating FCM connector")
-		} else {
-			modules = append(modules, fcmConn)
-		}
-	} else {
-		logger.Info("Firebase Cloud Messaging: disabled")
+	connector.DefaultPayloadTemplates = templates
+	connector.DefaultCircuitBreaker = connector.CircuitBreakerConfig{
+		Failures:    *Config.Connector.BreakerFailures,
+		OpenTimeout: *Config.Connector.BreakerTimeout,
 	}
-
-	if *Config.APNS.Enabled {
-		if *Config.APNS.Production {
-			logger.Info("APNS: enabled in production mode")
-		} else {
-			logger.Info("APNS: enabled in development mode")
-		}
-		logger.Info("APNS: enabled")
-		if *Config.APNS.CertificateFileName == "" && Config.APNS.CertificateBytes == nil {
-			logger.Panic("The certificate (as filename or bytes) has to be provided when APNS is enabled")
-		}
-		if *Config.APNS.CertificatePassword == "" {
-			logger.Panic("A non-empty password has to be provided when APNS is enabled")
-		}
-		if *Config.APNS.AppTopic == "" {
-			logger.Panic("The Mobile App Topic (usually the bundle-id) has to be provided when APNS is enabled")
-		}
-		apnsSender, err := apns.NewSender(Config.APNS)
-		if err != nil {
-			logger.Panic("APNS Sender could not be created")
-		}
-		*Config.APNS.IntervalMetrics = true
-		if apnsConn, err := apns.New(router, apnsSender, Config.APNS); err != nil {
-			logger.WithError(err).Error("Error creating APNS connector")
-		} else {
-			modules = append(modules, apnsConn)
-		}
-	} else {
-		logger.Info("APNS: disabled")
+	connector.DefaultRateLimit = connector.RateLimitConfig{
+		Messages: *Config.Connector.RateLimit,
+		Interval: *Config.Connector.RateInterval,
 	}
-
-	if *Config.SMS.Enabled {
-		logger.Info("Nexmo SMS: enabled")
-		if *Config.SMS.APIKey == "" || *Config.SMS.APISecret == "" {
-			logger.Panic("The API Key has to be provided when NEXMO SMS connector is enabled")
-		}
-		nexmoSender, err := sms.NewNexmoSender(*Config.SMS.APIKey, *Config.SMS.APISecret)
-		if err != nil {
-			logger.WithError(err).Error("Error creating Nexmo Sender")
-		}
-		smsConn, err := sms.New(router, nexmoSender, Config.SMS)
-		if err != nil {
-			logger.WithError(err).Error("Error creating Nexmo Sender")
-		} else {
-			modules = append(modules, smsConn)
-		}
-	} else {
-		logger.Info("SMS: disabled")
+	connector.DefaultClusterBalancing = *Config.Connector.ClusterBalancing
+	connector.DefaultRetry = connector.RetryConfig{
+		MaxAttempts:     *Config.Connector.Retries + 1,
+		DeadLetterTopic: *Config.Connector.DeadLetterTopic,
 	}
 
-	return modules
+	return createEnabledModules(router)
 }
 
 // Main is the entry-point of the guble server.
@@ -209,8 +155,15 @@ func Main() {
 
 	parseConfig()
 
-	if !terminal.IsTerminal(int(os.Stdout.Fd())) {
+	switch *Config.LogFormat {
+	case jsonLogFormat:
 		log.SetFormatter(&logformatter.LogstashFormatter{Env: *Config.EnvName})
+	case textLogFormat:
+		log.SetFormatter(&log.TextFormatter{})
+	default:
+		if !terminal.IsTerminal(int(os.Stdout.Fd())) {
+			log.SetFormatter(&logformatter.LogstashFormatter{Env: *Config.EnvName})
+		}
 	}
 
 	level, err := log.ParseLevel(*Config.Log)
@@ -219,6 +172,20 @@ func Main() {
 	}
 	log.SetLevel(level)
 
+	if command == checkConfigCommand.FullCommand() {
+		os.Exit(runCheckConfig(os.Stdout))
+	}
+	if strings.HasPrefix(command, clusterCommand.FullCommand()+" ") {
+		if err := runCluster(command, os.Stdout); err != nil {
+			logger.WithError(err).Fatal("The cluster command failed")
+		}
+		os.Exit(0)
+	}
+
+	if err := resolveSecrets(); err != nil {
+		logger.WithError(err).Fatal("Could not resolve the secrets of the configuration")
+	}
+
 	switch *Config.Profile {
 	case cpuProfile:
 		logger.Info("starting to profile cpu")
@@ -241,51 +208,78 @@ func Main() {
 	if srv == nil {
 		logger.Fatal("exiting because of unrecoverable error(s) when starting the service")
 	}
+	notifySystemd(systemd.Ready + "\n" + systemd.Status("serving on "+*Config.HttpListen))
+	stopWatchdog := make(chan bool)
+	systemd.StartWatchdog(stopWatchdog)
+	captureProfiles()
 
 	waitForTermination(func() {
-		err := srv.Stop()
+		stopTimeout := *Config.StopTimeout
+		if *Config.Drain.Enabled {
+			stopTimeout += *Config.Drain.Timeout
+		}
+		notifySystemd(systemd.Stopping + "\n" + systemd.ExtendTimeout(stopTimeout))
+		close(stopWatchdog)
+		if *Config.Drain.Enabled {
+			if err := srv.Drain(*Config.Drain.Peer, *Config.Drain.Timeout); err != nil {
+				logger.WithField("error", err.Error()).Error("errors occurred while draining service")
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *Config.StopTimeout)
+		defer cancel()
+		err := srv.StopWithContext(ctx)
 		if err != nil {
 			logger.WithField("error", err.Error()).Error("errors occurred while stopping service")
 		}
 	})
 }
 
-// StartService starts a server.Service after first creating the router (and its dependencies), the webserver.
-func StartService() *service.Service {
-	//TODO StartService could return an error in case it fails to start
-
-	accessManager := CreateAccessManager()
-	messageStore := CreateMessageStore()
-	kvStore := CreateKVStore()
-
-	var cl *cluster.Cluster
-	var err error
-
-	if *Config.Cluster.NodeID > 0 {
-		exitIfInvalidClusterParams(*Config.Cluster.NodeID, *Config.Cluster.NodePort, *Config.Cluster.Remotes)
-		logger.Info("Starting in cluster-mode")
-		cl, err = cluster.New(&cluster.Config{
-			ID:      *Config.Cluster.NodeID,
-			Port:    *Config.Cluster.NodePort,
-			Remotes: *Config.Cluster.Remotes,
-		})
-		if err != nil {
-			logger.WithField("err", err).Fatal("Module could not be started (cluster)")
-		}
-	} else {
-		logger.Info("Starting in standalone-mode")
-	}
+// tokenValidator validates the bearer tokens of the websocket and REST clients, when the JWT authentication is enabled.
+var tokenValidator auth.TokenValidator
 
-	r := router.New(accessManager, messageStore, kvStore, cl)
-	websrv := webserver.New(*Config.HttpListen)
+// quotas counts the messages published by each user or API key against their daily quotas, when they are enabled.
+var quotas *quota.Quotas
 
-	srv := service.New(r, websrv).
-		HealthEndpoint(*Config.HealthEndpoint).
-		MetricsEndpoint(*Config.MetricsEndpoint)
+// rateLimiter limits the rates of the requests and of the messages of each client, when the rate limits are enabled.
+var rateLimiter *webserver.RateLimiter
 
-	srv.RegisterModules(0, 6, kvStore, messageStore)
-	srv.RegisterModules(4, 3, CreateModules(r)...)
+// createTokenValidator returns the validators of the enabled authentications (JWT, OAuth2/OIDC, API keys of the users),
+// or nil if none is enabled. The roles of the OAuth2 tokens are bound in the ACL, if any.
+func createTokenValidator(acl *auth.ACLAccessManager, users *auth.UserManager) (auth.TokenValidator, error) {
+	var validators auth.TokenValidators
+	if *Config.JWT.Enabled {
+		validator, err := auth.NewJWTValidator(Config.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create the JWT validator: %v", err)
+		}
+		validators = append(validators, validator)
+	}
+	if *Config.OIDC.IssuerURL != "" || *Config.OIDC.IntrospectionURL != "" {
+		var binder auth.RoleBinder
+		if acl != nil {
+			binder = acl
+		}
+		validator, err := auth.NewOIDCValidator(Config.OIDC, binder)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create the OAuth2 token validator: %v", err)
+		}
+		validators = append(validators, validator)
+	}
+	if users != nil {
+		validators = append(validators, users)
+	}
+	if len(validators) == 0 {
+		return nil, nil
+	}
+	return validators, nil
+}
 
+// StartService starts a server.Service after first creating the router (and its dependencies), the webserver.
+func StartService() *service.Service {
+	srv, err := New()
+	if err != nil {
+		logger.WithError(err).Fatal("Could not create the service")
+	}
 	if err = srv.Start(); err != nil {
 		logger.WithField("error", err.Error()).Error("errors occurred while starting service")
 		if err = srv.Stop(); err != nil {
@@ -297,14 +291,112 @@ func StartService() *service.Service {
 	return srv
 }
 
-func exitIfInvalidClusterParams(nodeID uint8, nodePort int, remotes []*net.TCPAddr) {
+// createIPFilters returns the IP filters of the websocket, REST and admin endpoints which have networks configured.
+func createIPFilters() ([]*webserver.IPFilter, error) {
+	groups := []struct {
+		name     string
+		config   webserver.IPFilterConfig
+		prefixes []string
+	}{
+		{"ws", Config.WSIPFilter, []string{"/stream/", *Config.SockJS.Prefix}},
+		{"rest", Config.RESTIPFilter, []string{"/api/"}},
+		{"admin", Config.AdminIPFilter, adminPrefixes()},
+	}
+	var filters []*webserver.IPFilter
+	for _, g := range groups {
+		f, err := webserver.NewIPFilter(g.name, g.config, g.prefixes...)
+		if err != nil {
+			return nil, fmt.Errorf("Could not configure the IP filter %s: %v", g.name, err)
+		}
+		if f != nil {
+			filters = append(filters, f)
+		}
+	}
+	return filters, nil
+}
+
+// adminPrefixes returns the prefixes of the admin and management endpoints: the /admin/ endpoints
+// (e.g. the router and cluster membership ones), the configured admin endpoints and the subscription
+// management of the connectors. The health endpoint is not one of them, since the load balancers poll it.
+func adminPrefixes() []string {
+	return []string{
+		"/admin/",
+		*Config.MetricsEndpoint, *Config.PrometheusEndpoint,
+		*Config.Drain.Endpoint, *Config.Debug.Endpoint, *Config.SlowConsumersEndpoint, *Config.TopicsEndpoint,
+		*Config.MetricsHistory.Endpoint, *Config.Audit.Endpoint, *Config.Users.Endpoint, *Config.Quota.Endpoint,
+		*Config.FCM.Prefix, *Config.APNS.Prefix, *Config.Webhook.Prefix, *Config.WNS.Prefix,
+		*Config.HMS.Prefix, *Config.Telegram.Prefix, *Config.XMPP.Prefix, *Config.Federation.Prefix,
+	}
+}
+
+// metricsEndpoint returns the configured metrics endpoint, or "" if the metrics module is disabled.
+func metricsEndpoint(endpoint string) string {
+	if moduleDisabled(metricsModule) {
+		return ""
+	}
+	return endpoint
+}
+
+// clusterDiscovery returns the configured discovery of the cluster nodes, or nil if only the static remotes are used.
+func clusterDiscovery() (cluster.Discovery, error) {
+	if *Config.Cluster.DiscoveryKubernetes != "" {
+		d, err := cluster.NewKubernetesDiscovery(*Config.Cluster.DiscoveryKubernetes, *Config.Cluster.NodePort)
+		if err != nil {
+			return nil, fmt.Errorf("Could not configure the Kubernetes discovery of the cluster: %v", err)
+		}
+		return d, nil
+	}
+	if *Config.Cluster.DiscoveryDNS != "" {
+		return cluster.NewDNSDiscovery(*Config.Cluster.DiscoveryDNS), nil
+	}
+	return nil, nil
+}
+
+// clusterSecretKey returns the decoded secret key of the cluster, or nil if the cluster traffic is not encrypted.
+func clusterSecretKey() ([]byte, error) {
+	if *Config.Cluster.SecretKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(*Config.Cluster.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode the cluster secret key: %v", err)
+	}
+	return key, nil
+}
+
+func validateClusterParams(nodeID uint8, nodePort int, remotes []*net.TCPAddr) error {
 	if (nodeID <= 0 && len(remotes) > 0) || (nodePort <= 0) {
-		errorMessage := "Could not start in cluster-mode: invalid/incomplete parameters"
 		logger.WithFields(log.Fields{
 			"nodeID":          nodeID,
 			"nodePort":        nodePort,
 			"numberOfRemotes": len(remotes),
-		}).Fatal(errorMessage)
+		}).Error("Invalid cluster parameters")
+		return errors.New("Could not start in cluster-mode: invalid/incomplete parameters")
+	}
+	return nil
+}
+
+// captureProfiles captures the profiles of --debug-capture to files, in the background.
+func captureProfiles() {
+	for _, kind := range *Config.Debug.Capture {
+		go func(kind string) {
+			path, err := service.CaptureProfile(kind, *Config.Debug.CaptureDir, *Config.Debug.CaptureDuration)
+			if err != nil {
+				logger.WithError(err).WithField("profile", kind).Error("Could not capture the profile")
+				return
+			}
+			logger.WithFields(log.Fields{
+				"profile": kind,
+				"file":    path,
+			}).Info("Captured profile")
+		}(kind)
+	}
+}
+
+// notifySystemd sends the state to systemd, if gubled runs as a service of Type=notify.
+func notifySystemd(state string) {
+	if _, err := systemd.Notify(state); err != nil {
+		logger.WithError(err).Error("Could not notify systemd")
 	}
 }
 
@@ -312,7 +404,7 @@ func waitForTermination(callback func()) {
 	signalC := make(chan os.Signal)
 	signal.Notify(signalC, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-signalC
-	logger.Infof("Got signal '%v' .. exiting gracefully now", sig)
+	logger.WithField("signal", sig.String()).Info("Got signal, exiting gracefully now")
 	callback()
 	metrics.LogOnDebugLevel()
 	logger.Info("Exit gracefully now")
@@ -65,6 +65,27 @@ func TestFCMOnlyStartedIfEnabled(t *testing.T) {
 	a.False(containsFCMModule(CreateModules(routerMock)))
 }
 
+func TestFCMNotCreatedIfDisabledModule(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	defer func() { *Config.DisabledModules = nil }()
+
+	a := assert.New(t)
+
+	routerMock := initRouterMock()
+	*Config.FCM.Enabled = true
+	*Config.FCM.APIKey = "xyz"
+	*Config.APNS.Enabled = false
+	*Config.DisabledModules = []string{"fcm", "rest"}
+
+	modules := CreateModules(routerMock)
+	a.False(containsFCMModule(modules))
+	for _, module := range modules {
+		a.NotEqual("*rest.RestMessageAPI", reflect.TypeOf(module).String())
+	}
+	*Config.FCM.Enabled = false
+}
+
 func containsFCMModule(modules []interface{}) bool {
 	for _, module := range modules {
 		if reflect.TypeOf(module).String() == "*fcm.fcm" {
@@ -123,13 +144,13 @@ func TestStartServiceModules(t *testing.T) {
 	s := StartService()
 
 	// then the number and ordering of modules should be correct
-	a.Equal(6, len(s.ModulesSortedByStartOrder()))
+	a.Equal(7, len(s.ModulesSortedByStartOrder()))
 	var moduleNames []string
 	for _, iface := range s.ModulesSortedByStartOrder() {
 		name := reflect.TypeOf(iface).String()
 		moduleNames = append(moduleNames, name)
 	}
-	a.Equal("*kvstore.MemoryKVStore *filestore.FileMessageStore *router.router *webserver.WebServer *websocket.WSHandler *rest.RestMessageAPI",
+	a.Equal("*metrics.Rates *kvstore.MemoryKVStore *filestore.FileMessageStore *router.router *webserver.WebServer *websocket.WSHandler *rest.RestMessageAPI",
 		strings.Join(moduleNames, " "))
 }
 
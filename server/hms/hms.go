@@ -0,0 +1,113 @@
+package hms
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// schema is the default database schema for Huawei Push Kit
+	schema = "hms_registration"
+
+	deviceTokenKey = "device_token"
+	userIDKey      = "user_id"
+)
+
+// Config is used for configuring the Huawei Push Kit component.
+type Config struct {
+	Enabled       *bool
+	AppID         *string
+	AppSecret     *string
+	Endpoint      *string
+	TokenEndpoint *string
+	Timeout       *time.Duration
+	Workers       *int
+	Prefix        *string
+}
+
+// hms is the connector for Huawei Push Kit (part of Huawei Mobile Services), reaching devices without Google services.
+type hms struct {
+	Config
+	connector.Connector
+}
+
+// New creates a new Push Kit connector and returns it as a connector.ResponsiveConnector
+func New(router router.Router, sender connector.Sender, config Config) (connector.ResponsiveConnector, error) {
+	baseConn, err := connector.NewConnector(router, sender, connector.Config{
+		Name:       "hms",
+		Schema:     schema,
+		Prefix:     *config.Prefix,
+		URLPattern: fmt.Sprintf("/{%s}/{%s}/{%s:.*}", deviceTokenKey, userIDKey, connector.TopicParam),
+		Workers:    *config.Workers,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Base connector error")
+		return nil, err
+	}
+
+	h := &hms{config, baseConn}
+	h.SetResponseHandler(h)
+	return h, nil
+}
+
+func (h *hms) Start() error {
+	err := h.Connector.Start()
+	if err == nil {
+		mTotalSentMessages.Set(0)
+		mTotalSendErrors.Set(0)
+		mTotalResponseErrors.Set(0)
+		mTotalResponseInternalErrors.Set(0)
+		mTotalResponseInvalidTokenErrors.Set(0)
+		mTotalResponseOtherErrors.Set(0)
+	}
+	return err
+}
+
+func (h *hms) HandleResponse(request connector.Request, responseIface interface{}, metadata *connector.Metadata, err error) error {
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("Error sending message to Push Kit")
+		mTotalSendErrors.Add(1)
+		return err
+	}
+	message := request.Message()
+	subscriber := request.Subscriber()
+
+	response, ok := responseIface.(*Response)
+	if !ok {
+		mTotalResponseErrors.Add(1)
+		return fmt.Errorf("Invalid Push Kit Response")
+	}
+
+	if response.InvalidToken() {
+		logger.WithField("deviceToken", subscriber.Route().Get(deviceTokenKey)).Info("Removing Push Kit subscription with invalid token")
+		mTotalResponseInvalidTokenErrors.Add(1)
+		return h.Manager().Remove(subscriber)
+	}
+
+	subscriber.SetLastID(message.ID)
+	if err := h.Manager().Update(subscriber); err != nil {
+		logger.WithField("error", err.Error()).Error("Manager could not update subscription")
+		mTotalResponseInternalErrors.Add(1)
+		return err
+	}
+
+	if !response.Ok() {
+		logger.WithFields(log.Fields{
+			"code":      response.Code,
+			"msg":       response.Msg,
+			"requestID": response.RequestID,
+			"messageID": message.ID,
+		}).Error("Unexpected response from Push Kit")
+		mTotalResponseOtherErrors.Add(1)
+		return nil
+	}
+
+	logger.WithField("messageID", message.ID).Debug("Delivered message to Push Kit")
+	mTotalSentMessages.Add(1)
+	return nil
+}
@@ -0,0 +1,15 @@
+package hms
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                               = metrics.NS("hms")
+	mTotalSentMessages               = ns.NewInt("total_sent_messages")
+	mTotalSendErrors                 = ns.NewInt("total_sent_message_errors")
+	mTotalResponseErrors             = ns.NewInt("total_response_errors")
+	mTotalResponseInternalErrors     = ns.NewInt("total_response_internal_errors")
+	mTotalResponseInvalidTokenErrors = ns.NewInt("total_response_invalid_token_errors")
+	mTotalResponseOtherErrors        = ns.NewInt("total_response_other_errors")
+)
@@ -0,0 +1,138 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/oauth"
+)
+
+const (
+	// DefaultTokenEndpoint is the OAuth endpoint issuing the access tokens for Push Kit
+	DefaultTokenEndpoint = "https://oauth-login.cloud.huawei.com/oauth2/v3/token"
+
+	// DefaultEndpoint is the base URL of the Push Kit API
+	DefaultEndpoint = "https://push-api.cloud.huawei.com/v1"
+
+	// Push Kit result codes
+	codeSuccess      = "80000000"
+	codeTokenExpired = "80200003"
+	codeInvalidToken = "80300007"
+)
+
+// Response is the result returned by Push Kit.
+type Response struct {
+	Code      string `json:"code"`
+	Msg       string `json:"msg"`
+	RequestID string `json:"requestId"`
+}
+
+// Ok returns true if the message was accepted by Push Kit.
+func (r *Response) Ok() bool {
+	return r.Code == codeSuccess
+}
+
+// InvalidToken returns true if the device token of the subscription is not valid anymore.
+func (r *Response) InvalidToken() bool {
+	return r.Code == codeInvalidToken
+}
+
+type hmsMessage struct {
+	Data         string          `json:"data,omitempty"`
+	Notification json.RawMessage `json:"notification,omitempty"`
+	Android      json.RawMessage `json:"android,omitempty"`
+	Token        []string        `json:"token"`
+}
+
+type hmsRequest struct {
+	ValidateOnly bool       `json:"validate_only"`
+	Message      hmsMessage `json:"message"`
+}
+
+type sender struct {
+	client *http.Client
+	tokens *oauth.TokenSource
+	url    string
+}
+
+// NewSender returns a connector.Sender for Huawei Push Kit, authenticating with the credentials of the given app.
+func NewSender(endpoint, tokenEndpoint, appID, appSecret string, timeout time.Duration) *sender {
+	client := &http.Client{Timeout: timeout}
+	return &sender{
+		client: client,
+		tokens: oauth.NewTokenSource(tokenEndpoint, appID, appSecret, "", client),
+		url:    fmt.Sprintf("%s/%s/messages:send", endpoint, appID),
+	}
+}
+
+// Send sends the message to the device token of the subscriber, and returns a *Response.
+func (s *sender) Send(request connector.Request) (interface{}, error) {
+	deviceToken := request.Subscriber().Route().Get(deviceTokenKey)
+	body, err := json.Marshal(&hmsRequest{Message: hmsMessageFor(request.Message(), deviceToken)})
+	if err != nil {
+		return nil, err
+	}
+
+	response, token, err := s.send(body)
+	if err == nil && response.Code == codeTokenExpired {
+		// the access token expired or was revoked: retry once with a new one
+		s.tokens.Invalidate(token)
+		response, _, err = s.send(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.WithFields(log.Fields{
+		"code":      response.Code,
+		"requestID": response.RequestID,
+	}).Debug("Sent message to Push Kit")
+	return response, nil
+}
+
+func (s *sender) send(body []byte) (*Response, string, error) {
+	token, err := s.tokens.Token()
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, token, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, token, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return &Response{Code: codeTokenExpired}, token, nil
+	}
+	response := &Response{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, token, fmt.Errorf("could not decode Push Kit response (status code %d): %s", resp.StatusCode, err)
+	}
+	return response, token, nil
+}
+
+// hmsMessageFor uses the body of the guble message as Push Kit message, if it is one;
+// otherwise the body is sent as data message.
+func hmsMessageFor(message *protocol.Message, deviceToken string) hmsMessage {
+	m := hmsMessage{}
+	err := json.Unmarshal(message.Body, &m)
+	if err != nil || (m.Notification == nil && m.Android == nil && m.Data == "") {
+		m = hmsMessage{Data: string(message.Body)}
+	}
+	m.Token = []string{deviceToken}
+	return m
+}
@@ -0,0 +1,101 @@
+package hms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/router"
+)
+
+type testServer struct {
+	*httptest.Server
+	tokenRequests int
+	codes         []string
+	bodies        []string
+	tokens        []string
+}
+
+func newTestServer(a *assert.Assertions, codes ...string) *testServer {
+	ts := &testServer{codes: codes}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		a.NoError(req.ParseForm())
+		a.Equal("app01", req.PostForm.Get("client_id"))
+		ts.tokenRequests++
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"Bearer","expires_in":3600}`, ts.tokenRequests)
+	})
+	mux.HandleFunc("/v1/app01/messages:send", func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		ts.bodies = append(ts.bodies, string(body))
+		ts.tokens = append(ts.tokens, req.Header.Get("Authorization"))
+		code := ts.codes[0]
+		ts.codes = ts.codes[1:]
+		fmt.Fprintf(w, `{"code":"%s","msg":"message","requestId":"req01"}`, code)
+	})
+	ts.Server = httptest.NewServer(mux)
+	return ts
+}
+
+func newTestRequest(m *protocol.Message) connector.Request {
+	s := connector.NewSubscriber(m.Path, router.RouteParams{deviceTokenKey: "device01", userIDKey: "user01"}, 0)
+	return connector.NewRequest(s, m)
+}
+
+func TestSender_Send(t *testing.T) {
+	a := assert.New(t)
+	server := newTestServer(a, codeSuccess, codeSuccess)
+	defer server.Close()
+
+	s := NewSender(server.URL+"/v1", server.URL+"/token", "app01", "secret", time.Second)
+
+	response, err := s.Send(newTestRequest(&protocol.Message{ID: 1, Path: "/topic", Body: []byte("plain text")}))
+	a.NoError(err)
+	a.Equal(&Response{Code: codeSuccess, Msg: "message", RequestID: "req01"}, response)
+	a.JSONEq(`{"validate_only":false,"message":{"data":"plain text","token":["device01"]}}`, server.bodies[0])
+	a.Equal("Bearer token1", server.tokens[0])
+
+	_, err = s.Send(newTestRequest(&protocol.Message{
+		ID:   2,
+		Path: "/topic",
+		Body: []byte(`{"notification":{"title":"Hello","body":"World"}}`),
+	}))
+	a.NoError(err)
+	a.JSONEq(`{"validate_only":false,"message":{"notification":{"title":"Hello","body":"World"},"token":["device01"]}}`, server.bodies[1])
+	a.Equal(1, server.tokenRequests)
+}
+
+func TestSender_SendRenewsExpiredToken(t *testing.T) {
+	a := assert.New(t)
+	server := newTestServer(a, codeTokenExpired, codeSuccess)
+	defer server.Close()
+
+	s := NewSender(server.URL+"/v1", server.URL+"/token", "app01", "secret", time.Second)
+	response, err := s.Send(newTestRequest(&protocol.Message{ID: 1, Path: "/topic", Body: []byte("{}")}))
+	a.NoError(err)
+	a.True(response.(*Response).Ok())
+	a.Equal([]string{"Bearer token1", "Bearer token2"}, server.tokens)
+}
+
+func TestHMSMessageFor(t *testing.T) {
+	a := assert.New(t)
+
+	m := hmsMessageFor(&protocol.Message{Body: []byte(`{"data":"{\"key\":\"value\"}"}`)}, "device01")
+	a.Equal(`{"key":"value"}`, m.Data)
+	a.Equal([]string{"device01"}, m.Token)
+
+	m = hmsMessageFor(&protocol.Message{Body: []byte(`{"key":"value"}`)}, "device01")
+	a.Equal(`{"key":"value"}`, m.Data)
+
+	data, err := json.Marshal(hmsMessageFor(&protocol.Message{Body: []byte(`{"android":{"urgency":"HIGH"}}`)}, "device01"))
+	a.NoError(err)
+	a.JSONEq(`{"android":{"urgency":"HIGH"},"token":["device01"]}`, string(data))
+}
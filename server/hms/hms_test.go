@@ -0,0 +1,91 @@
+package hms
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+func testHMS(t *testing.T) (*hms, *MockRouter) {
+	enabled := true
+	appID := "app01"
+	appSecret := "secret"
+	endpoint := DefaultEndpoint
+	tokenEndpoint := DefaultTokenEndpoint
+	timeout := time.Second
+	workers := 1
+	prefix := "/hms/"
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().KVStore().Return(kvstore.NewMemoryKVStore(), nil).AnyTimes()
+
+	conn, err := New(routerMock, NewSender(endpoint, tokenEndpoint, appID, appSecret, timeout), Config{
+		Enabled:       &enabled,
+		AppID:         &appID,
+		AppSecret:     &appSecret,
+		Endpoint:      &endpoint,
+		TokenEndpoint: &tokenEndpoint,
+		Timeout:       &timeout,
+		Workers:       &workers,
+		Prefix:        &prefix,
+	})
+	assert.NoError(t, err)
+	return conn.(*hms), routerMock
+}
+
+func TestHMS_PostSubscription(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	h, routerMock := testHMS(t)
+	a.NoError(h.Start())
+	defer h.Stop()
+
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/topic"), r.Path)
+		a.Equal("user01", r.Get(userIDKey))
+		a.Equal("device01", r.Get(deviceTokenKey))
+	}).Return(nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/hms/device01/user01/topic", strings.NewReader(""))
+	a.NoError(err)
+	h.ServeHTTP(recorder, req)
+	a.Equal(`{"subscribed":"/topic"}`, recorder.Body.String())
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestHMS_HandleResponse(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	h, _ := testHMS(t)
+	subscriber, err := h.Manager().Create("/topic", router.RouteParams{deviceTokenKey: "device01", userIDKey: "user01"})
+	a.NoError(err)
+
+	request := connector.NewRequest(subscriber, &protocol.Message{ID: 5, Path: "/topic"})
+	a.NoError(h.HandleResponse(request, &Response{Code: codeSuccess}, nil, nil))
+	data, err := subscriber.Encode()
+	a.NoError(err)
+	a.Contains(string(data), `"LastID":5`)
+
+	a.Error(h.HandleResponse(request, "invalid", nil, nil))
+	a.Len(h.Manager().List(), 1)
+
+	// invalid device tokens are removed
+	a.NoError(h.HandleResponse(request, &Response{Code: codeInvalidToken}, nil, nil))
+	a.Len(h.Manager().List(), 0)
+}
@@ -0,0 +1,7 @@
+package hms
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "hms")
@@ -31,5 +31,15 @@ func NewMap(name string) Map {
 	return &dummyMap{}
 }
 
+type dummyTiming struct{}
+
+// Dummy functions on dummyTiming
+func (v *dummyTiming) Observe(d time.Duration) {}
+
+// NewTiming returns a dummyTiming, depending on the build tag declared at the beginning of this file.
+func NewTiming(name string) Timing {
+	return &dummyTiming{}
+}
+
 func RegisterInterval(m Map, td time.Duration, reset func(Map, time.Time), processAndReset func(Map, time.Duration, time.Time)) {
 }
@@ -17,6 +17,13 @@ func NewMap(name string) Map {
 	return expvar.NewMap(name)
 }
 
+// NewTiming returns a Timing published as an expvar, depending on the absence of build tag declared at the beginning of this file
+func NewTiming(name string) Timing {
+	t := newTiming()
+	expvar.Publish(name, t)
+	return t
+}
+
 func RegisterInterval(ctx context.Context, m Map, td time.Duration, reset func(Map, time.Time), processAndReset func(Map, time.Duration, time.Time)) {
 	reset(m, time.Now())
 	go func(m Map, td time.Duration, processAndReset func(Map, time.Duration, time.Time)) {
@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHistoryPrefix is the prefix of the endpoint returning the history of the metrics
+	DefaultHistoryPrefix = "/admin/metrics/history"
+
+	// HistoryResolution is the interval of the snapshots of the metrics
+	HistoryResolution = time.Minute
+
+	// HistoryRetention is the age of the oldest snapshots kept
+	HistoryRetention = 24 * time.Hour
+
+	historySchema = "metrics_history"
+)
+
+// HistoryStore is the persistence of the snapshots of the metrics, implemented by a kvstore.KVStore.
+type HistoryStore interface {
+	Put(schema, key string, value []byte) error
+	Delete(schema, key string) error
+	Iterate(schema, keyPrefix string) (entries chan [2]string)
+}
+
+// HistoryConfig is used for configuring the history of the metrics.
+type HistoryConfig struct {
+	Enabled  *bool
+	Endpoint *string
+}
+
+// Rollup is the aggregation of the values of a metric over a step of the history.
+type Rollup struct {
+	Time time.Time `json:"time"`
+	Min  float64   `json:"min"`
+	Max  float64   `json:"max"`
+	Avg  float64   `json:"avg"`
+	Last float64   `json:"last"`
+
+	count int
+}
+
+// History persists periodically a snapshot of the numeric metrics in a store, keeping the last 24h,
+// and serves their rollups.
+type History struct {
+	store      HistoryStore
+	prefix     string
+	resolution time.Duration
+	retention  time.Duration
+
+	stopC chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewHistory returns a new History of the metrics persisted in the store, which has to be started.
+func NewHistory(store HistoryStore, config HistoryConfig) *History {
+	h := &History{
+		store:      store,
+		prefix:     DefaultHistoryPrefix,
+		resolution: HistoryResolution,
+		retention:  HistoryRetention,
+	}
+	if config.Endpoint != nil && *config.Endpoint != "" {
+		h.prefix = *config.Endpoint
+	}
+	return h
+}
+
+// Start begins taking the snapshots of the metrics.
+func (h *History) Start() error {
+	h.stopC = make(chan struct{})
+	h.wg.Add(1)
+	go h.loop()
+	return nil
+}
+
+// Stop ends taking the snapshots of the metrics.
+func (h *History) Stop() error {
+	if h.stopC == nil {
+		return nil
+	}
+	close(h.stopC)
+	h.wg.Wait()
+	h.stopC = nil
+	return nil
+}
+
+func (h *History) loop() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(h.resolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case t := <-ticker.C:
+			if err := h.snapshot(t); err != nil {
+				logger.WithError(err).Error("Could not persist the snapshot of the metrics")
+			}
+		case <-h.stopC:
+			return
+		}
+	}
+}
+
+// snapshot persists the current numeric values of the metrics, and deletes the snapshots older than the retention.
+func (h *History) snapshot(t time.Time) error {
+	values := make(map[string]float64)
+	eachValue(func(name, key string, value float64) {
+		if key != "" {
+			name = name + "." + key
+		}
+		values[name] = value
+	})
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if err := h.store.Put(historySchema, historyKey(t.Truncate(h.resolution)), data); err != nil {
+		return err
+	}
+
+	oldest := historyKey(t.Add(-h.retention))
+	var expired []string
+	for entry := range h.store.Iterate(historySchema, "") {
+		if entry[0] < oldest {
+			expired = append(expired, entry[0])
+		}
+	}
+	for _, key := range expired {
+		if err := h.store.Delete(historySchema, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// historyKey returns the key of the snapshot taken at the time, sorted as the times.
+func historyKey(t time.Time) string {
+	return fmt.Sprintf("%020d", t.Unix())
+}
+
+// Rollups returns the rollups of the metrics over the steps of the history since the given time.
+func (h *History) Rollups(names []string, since time.Time, step time.Duration) map[string][]*Rollup {
+	type snapshot struct {
+		time   time.Time
+		values map[string]float64
+	}
+	var snapshots []snapshot
+	start := historyKey(since)
+	for entry := range h.store.Iterate(historySchema, "") {
+		if entry[0] < start {
+			continue
+		}
+		unix, err := strconv.ParseInt(entry[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		s := snapshot{time: time.Unix(unix, 0)}
+		if err := json.Unmarshal([]byte(entry[1]), &s.values); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].time.Before(snapshots[j].time) })
+
+	rollups := make(map[string][]*Rollup, len(names))
+	for _, name := range names {
+		rollups[name] = []*Rollup{}
+	}
+	for _, s := range snapshots {
+		bucket := s.time.Truncate(step)
+		for _, name := range names {
+			value, ok := s.values[name]
+			if !ok {
+				continue
+			}
+			metric := rollups[name]
+			if len(metric) == 0 || !metric[len(metric)-1].Time.Equal(bucket) {
+				metric = append(metric, &Rollup{Time: bucket, Min: value, Max: value})
+				rollups[name] = metric
+			}
+			metric[len(metric)-1].add(value)
+		}
+	}
+	return rollups
+}
+
+func (r *Rollup) add(value float64) {
+	if value < r.Min {
+		r.Min = value
+	}
+	if value > r.Max {
+		r.Max = value
+	}
+	r.Avg = (r.Avg*float64(r.count) + value) / float64(r.count+1)
+	r.Last = value
+	r.count++
+}
+
+// GetPrefix returns the prefix of the history endpoint.
+func (h *History) GetPrefix() string {
+	return h.prefix
+}
+
+// ServeHTTP returns the rollups of the metrics given by the `metric` query parameter (can be repeated),
+// since `since` (a unix timestamp, default: 24h ago), for each `step` (a duration, default: 1m).
+func (h *History) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if req.Method != http.MethodGet {
+		http.Error(w, `{"error":"only HTTP GET is accepted"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query()
+	names := query["metric"]
+	if len(names) == 0 {
+		http.Error(w, `{"error":"missing metric"}`, http.StatusBadRequest)
+		return
+	}
+	since := time.Now().Add(-h.retention)
+	if s := query.Get("since"); s != "" {
+		unix, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, `{"error":"invalid since"}`, http.StatusBadRequest)
+			return
+		}
+		since = time.Unix(unix, 0)
+	}
+	step := h.resolution
+	if s := query.Get("step"); s != "" {
+		var err error
+		if step, err = time.ParseDuration(s); err != nil || step < h.resolution {
+			http.Error(w, `{"error":"invalid step"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(h.Rollups(names, since, step)); err != nil {
+		logger.WithError(err).Error("Error encoding data.")
+	}
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/server/kvstore"
+)
+
+func TestHistory_SnapshotsAndRollups(t *testing.T) {
+	a := assert.New(t)
+
+	gauge := expvar.NewInt("history_test.current_connections")
+	kvs := kvstore.NewMemoryKVStore()
+	h := NewHistory(kvs, HistoryConfig{})
+
+	start := time.Now().Truncate(time.Hour)
+	for i, value := range []int64{4, 8, 6} {
+		gauge.Set(value)
+		a.NoError(h.snapshot(start.Add(time.Duration(i) * time.Minute)))
+	}
+
+	rollups := h.Rollups([]string{"history_test.current_connections", "history_test.missing"}, start, time.Minute)
+	a.Len(rollups["history_test.current_connections"], 3)
+	a.Equal(float64(8), rollups["history_test.current_connections"][1].Last)
+	a.Empty(rollups["history_test.missing"])
+
+	rollups = h.Rollups([]string{"history_test.current_connections"}, start, time.Hour)
+	a.Len(rollups["history_test.current_connections"], 1)
+	rollup := rollups["history_test.current_connections"][0]
+	a.Equal(float64(4), rollup.Min)
+	a.Equal(float64(8), rollup.Max)
+	a.Equal(float64(6), rollup.Avg)
+	a.Equal(float64(6), rollup.Last)
+
+	// the snapshots older than the retention are deleted
+	a.NoError(h.snapshot(start.Add(HistoryRetention + 2*time.Minute)))
+	var keys []string
+	for key := range kvs.IterateKeys(historySchema, "") {
+		keys = append(keys, key)
+	}
+	a.Len(keys, 2)
+}
+
+func TestHistory_ServeHTTP(t *testing.T) {
+	a := assert.New(t)
+
+	expvar.NewInt("history_test.total_messages").Set(3)
+	h := NewHistory(kvstore.NewMemoryKVStore(), HistoryConfig{})
+	now := time.Now()
+	a.NoError(h.snapshot(now))
+
+	since := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultHistoryPrefix+"?metric=history_test.total_messages&since="+since, nil))
+	a.Equal(http.StatusOK, rec.Code)
+	var rollups map[string][]Rollup
+	a.NoError(json.Unmarshal(rec.Body.Bytes(), &rollups))
+	a.Len(rollups["history_test.total_messages"], 1)
+	a.Equal(float64(3), rollups["history_test.total_messages"][0].Last)
+
+	for _, query := range []string{"", "?metric=x&step=10s", "?metric=x&since=x"} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultHistoryPrefix+query, nil))
+		a.Equal(http.StatusBadRequest, rec.Code, query)
+	}
+}
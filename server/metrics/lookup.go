@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"sort"
+	"strings"
+)
+
+// Lookup returns the current value of a numeric metric, given its name, or the name of a Map metric (or Timing)
+// followed by a dot and the key of the value, e.g. "router.current_routes", "router.delivery_latency_msec.p99",
+// or "rates.router.total_errors_deliver_message.1m". It returns false if there is no such numeric value.
+func Lookup(path string) (float64, bool) {
+	var (
+		result float64
+		found  bool
+	)
+	expvar.Do(func(kv expvar.KeyValue) {
+		if found || !strings.HasPrefix(path, kv.Key) {
+			return
+		}
+		key := strings.TrimPrefix(path, kv.Key)
+		if key != "" && !strings.HasPrefix(key, ".") {
+			return
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(kv.Value.String()), &value); err != nil {
+			return
+		}
+		switch v := value.(type) {
+		case float64:
+			result, found = v, key == ""
+		case map[string]interface{}:
+			if key != "" {
+				result, found = v[key[1:]].(float64)
+			}
+		}
+	})
+	return result, found
+}
+
+// eachValue calls the function with each current numeric value: the numeric metrics (with an empty key),
+// and the numeric values of the Map metrics and Timings, in the order of their keys.
+func eachValue(f func(name, key string, value float64)) {
+	expvar.Do(func(kv expvar.KeyValue) {
+		var value interface{}
+		if err := json.Unmarshal([]byte(kv.Value.String()), &value); err != nil {
+			return
+		}
+		switch v := value.(type) {
+		case float64:
+			f(kv.Key, "", v)
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if number, ok := v[key].(float64); ok {
+					f(kv.Key, key, number)
+				}
+			}
+		}
+	})
+}
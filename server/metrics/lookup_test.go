@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	a := assert.New(t)
+
+	expvar.NewInt("lookup_test.current").Set(3)
+	m := expvar.NewMap("lookup_test.map")
+	m.Add("a.b", 7)
+	m.Set("text", new(expvar.String))
+
+	v, ok := Lookup("lookup_test.current")
+	a.True(ok)
+	a.Equal(float64(3), v)
+
+	v, ok = Lookup("lookup_test.map.a.b")
+	a.True(ok)
+	a.Equal(float64(7), v)
+
+	for _, missing := range []string{"lookup_test.curr", "lookup_test.current.x", "lookup_test.map", "lookup_test.map.text", "lookup_test.map.c"} {
+		_, ok = Lookup(missing)
+		a.False(ok, missing)
+	}
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	prometheusPrefix      = "guble_"
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// PrometheusHandler is a HTTP handler writing the current metrics to the http.ResponseWriter,
+// in the text exposition format of Prometheus.
+func PrometheusHandler(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", prometheusContentType)
+	writePrometheusMetrics(rw)
+}
+
+// writePrometheusMetrics writes the numeric metrics: the Int ones as samples without labels,
+// and the numeric values of the Map ones as samples labeled with their key.
+// The other values (e.g. strings, or the nested values of the memstats) are not exposed.
+func writePrometheusMetrics(w io.Writer) {
+	numGoroutines.Set(int64(runtime.NumGoroutine()))
+	expvar.Do(func(kv expvar.KeyValue) {
+		var value interface{}
+		if err := json.Unmarshal([]byte(kv.Value.String()), &value); err != nil {
+			return
+		}
+		name := prometheusName(kv.Key)
+		switch v := value.(type) {
+		case float64:
+			writePrometheusType(w, name)
+			fmt.Fprintf(w, "%s %v\n", name, v)
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key, field := range v {
+				if _, ok := field.(float64); ok {
+					keys = append(keys, key)
+				}
+			}
+			if len(keys) == 0 {
+				return
+			}
+			sort.Strings(keys)
+			writePrometheusType(w, name)
+			for _, key := range keys {
+				fmt.Fprintf(w, "%s{key=%q} %v\n", name, key, v[key])
+			}
+		}
+	})
+}
+
+// writePrometheusType declares the total_* metrics as counters, and the other ones as gauges.
+func writePrometheusType(w io.Writer, name string) {
+	metricType := "gauge"
+	if strings.Contains(name, "_total_") {
+		metricType = "counter"
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+// prometheusName converts the name of an expvar (e.g. "router.total_messages_incoming")
+// to a valid Prometheus metric name (e.g. "guble_router_total_messages_incoming").
+func prometheusName(key string) string {
+	return prometheusPrefix + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, key)
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	a := assert.New(t)
+
+	expvar.NewInt("prometheus_test.total_messages").Set(42)
+	m := expvar.NewMap("prometheus_test.per_connector")
+	m.Add("fcm", 3)
+	m.Set("average", zeroValue)
+	expvar.NewString("prometheus_test.version").Set("1.0")
+
+	req, _ := http.NewRequest(http.MethodGet, "", nil)
+	w := httptest.NewRecorder()
+	PrometheusHandler(w, req)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(prometheusContentType, w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	a.Contains(body, "# TYPE guble_prometheus_test_total_messages counter\nguble_prometheus_test_total_messages 42\n")
+	a.Contains(body, "# TYPE guble_prometheus_test_per_connector gauge\n")
+	a.Contains(body, `guble_prometheus_test_per_connector{key="fcm"} 3`)
+	a.Contains(body, "guble_num_goroutines ")
+	a.NotContains(body, "prometheus_test_version")
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRatesInterval is the interval of sampling the counters for computing their rates
+	DefaultRatesInterval = 10 * time.Second
+
+	ratesKey = "rates"
+)
+
+// rateWindows are the timeframes of the computed rates, with the suffix of their keys
+var rateWindows = []struct {
+	suffix    string
+	timeframe time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+}
+
+var ratesMap = NewMap(ratesKey)
+
+// Rates samples periodically the counters (the Int metrics whose name contains "total_"),
+// and exposes their per-second rates over the last minute and the last 5 minutes in the "rates" metric,
+// e.g. "router.total_messages_incoming.1m".
+type Rates struct {
+	interval time.Duration
+	samples  []ratesSample
+
+	stopC chan struct{}
+	wg    sync.WaitGroup
+}
+
+type ratesSample struct {
+	time   time.Time
+	values map[string]int64
+}
+
+// NewRates returns a new Rates sampling the counters every interval, once started.
+func NewRates(interval time.Duration) *Rates {
+	if interval <= 0 {
+		interval = DefaultRatesInterval
+	}
+	return &Rates{interval: interval}
+}
+
+// Start begins the sampling of the counters.
+func (r *Rates) Start() error {
+	r.samples = nil
+	r.stopC = make(chan struct{})
+	r.wg.Add(1)
+	go r.loop()
+	return nil
+}
+
+// Stop ends the sampling of the counters.
+func (r *Rates) Stop() error {
+	if r.stopC == nil {
+		return nil
+	}
+	close(r.stopC)
+	r.wg.Wait()
+	r.stopC = nil
+	return nil
+}
+
+func (r *Rates) loop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.sample(time.Now())
+	for {
+		select {
+		case t := <-ticker.C:
+			r.sample(t)
+		case <-r.stopC:
+			return
+		}
+	}
+}
+
+// sample reads the current values of the counters, and updates their rates.
+func (r *Rates) sample(t time.Time) {
+	current := ratesSample{time: t, values: make(map[string]int64)}
+	expvar.Do(func(kv expvar.KeyValue) {
+		if i, ok := kv.Value.(*expvar.Int); ok && strings.Contains(kv.Key, "total_") {
+			current.values[kv.Key] = i.Value()
+		}
+	})
+	r.samples = append(r.samples, current)
+
+	// keep the samples of the longest timeframe, and the one just before it
+	longest := rateWindows[len(rateWindows)-1].timeframe
+	for len(r.samples) > 2 && t.Sub(r.samples[1].time) >= longest {
+		r.samples = r.samples[1:]
+	}
+
+	for _, w := range rateWindows {
+		previous := r.oldestSince(t.Add(-w.timeframe))
+		for key, value := range current.values {
+			old, ok := previous.values[key]
+			if !ok {
+				continue
+			}
+			ratesMap.Set(key+"."+w.suffix, newRate(value-old, t.Sub(previous.time), time.Second))
+		}
+	}
+}
+
+// oldestSince returns the oldest sample taken at or after the time, or the latest sample if there is none.
+func (r *Rates) oldestSince(since time.Time) ratesSample {
+	for _, s := range r.samples {
+		if !s.time.Before(since) {
+			return s
+		}
+	}
+	return r.samples[len(r.samples)-1]
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRates_Sample(t *testing.T) {
+	a := assert.New(t)
+
+	counter := expvar.NewInt("rates_test.total_messages")
+	r := NewRates(time.Second)
+
+	now := time.Now()
+	r.sample(now)
+	counter.Add(120)
+	r.sample(now.Add(time.Minute))
+	counter.Add(60)
+	r.sample(now.Add(2 * time.Minute))
+
+	a.Equal("1", ratesMap.Get("rates_test.total_messages.1m").String())
+	a.Equal("1.5", ratesMap.Get("rates_test.total_messages.5m").String())
+}
+
+func TestTiming_Percentiles(t *testing.T) {
+	a := assert.New(t)
+
+	timing := newTiming()
+	a.JSONEq(`{"p50": 0, "p95": 0, "p99": 0}`, timing.String())
+
+	for i := 1; i <= 100; i++ {
+		timing.Observe(time.Duration(i) * time.Millisecond)
+	}
+	a.JSONEq(`{"p50": 50, "p95": 95, "p99": 99}`, timing.String())
+
+	// the oldest durations are replaced
+	for i := 0; i < timingSize; i++ {
+		timing.Observe(time.Second)
+	}
+	a.JSONEq(`{"p50": 1000, "p95": 1000, "p99": 1000}`, timing.String())
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"expvar"
+	"io/ioutil"
+	"runtime"
+	"time"
+)
+
+const (
+	runtimeKey = "runtime"
+
+	// fdDir lists the open file descriptors of the process (on Linux)
+	fdDir = "/proc/self/fd"
+)
+
+func init() {
+	expvar.Publish(runtimeKey, expvar.Func(runtimeMetrics))
+}
+
+// runtimeMetrics returns the current goroutines, heap and GC statistics of the process,
+// and the number of its open file descriptors, where it is known.
+// They are read on each export of the metrics, so they are always up to date.
+func runtimeMetrics() interface{} {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	values := map[string]interface{}{
+		"goroutines":          runtime.NumGoroutine(),
+		"heap_alloc_bytes":    m.HeapAlloc,
+		"heap_inuse_bytes":    m.HeapInuse,
+		"heap_sys_bytes":      m.HeapSys,
+		"heap_objects":        m.HeapObjects,
+		"num_gc":              m.NumGC,
+		"gc_pause_total_msec": float64(m.PauseTotalNs) / float64(time.Millisecond),
+		"last_gc_pause_msec":  float64(m.PauseNs[(m.NumGC+255)%256]) / float64(time.Millisecond),
+		"next_gc_bytes":       m.NextGC,
+	}
+	if fds, err := ioutil.ReadDir(fdDir); err == nil {
+		// without the descriptor of the listed directory itself
+		values["open_fds"] = len(fds) - 1
+	}
+	return values
+}
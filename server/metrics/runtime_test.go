@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeMetrics(t *testing.T) {
+	a := assert.New(t)
+
+	goroutines, ok := Lookup("runtime.goroutines")
+	a.True(ok)
+	a.True(goroutines > 0)
+
+	heap, ok := Lookup("runtime.heap_alloc_bytes")
+	a.True(ok)
+	a.True(heap > 0)
+
+	if runtime.GOOS == "linux" {
+		fds, ok := Lookup("runtime.open_fds")
+		a.True(ok)
+		a.True(fds > 0)
+	}
+
+	buff := &bytes.Buffer{}
+	writePrometheusMetrics(buff)
+	a.Contains(buff.String(), `guble_runtime{key="heap_inuse_bytes"}`)
+}
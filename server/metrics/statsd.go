@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultStatsDInterval is the interval of pushing the metrics to StatsD
+	DefaultStatsDInterval = 10 * time.Second
+
+	// statsDPacketSize keeps the UDP packets below the usual MTU
+	statsDPacketSize = 1432
+)
+
+// StatsDConfig is used for configuring the pushing of the metrics to StatsD / DogStatsD.
+type StatsDConfig struct {
+	Address  *string
+	Prefix   *string
+	Tags     *[]string
+	Interval *time.Duration
+}
+
+// StatsD pushes periodically the metrics to a StatsD server over UDP:
+// the counters (the Int metrics whose name contains "total_") as the increments since the last push,
+// and the other numeric metrics (including the percentiles of the timings) as gauges.
+// With tags (in the DogStatsD format, e.g. "env:prod"), the keys of the Map metrics are sent as a "key" tag,
+// otherwise they are appended to the name of the metric.
+type StatsD struct {
+	config   StatsDConfig
+	interval time.Duration
+	conn     net.Conn
+	previous map[string]float64
+
+	stopC chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewStatsD returns a new StatsD pusher, which has to be started.
+func NewStatsD(config StatsDConfig) *StatsD {
+	interval := DefaultStatsDInterval
+	if config.Interval != nil && *config.Interval > 0 {
+		interval = *config.Interval
+	}
+	return &StatsD{config: config, interval: interval}
+}
+
+// Start connects to the StatsD server, and begins pushing the metrics.
+func (s *StatsD) Start() error {
+	conn, err := net.Dial("udp", *s.config.Address)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.previous = make(map[string]float64)
+	s.stopC = make(chan struct{})
+	s.wg.Add(1)
+	go s.loop()
+	logger.WithField("address", *s.config.Address).Info("Pushing metrics to StatsD")
+	return nil
+}
+
+// Stop pushes the metrics a last time, and closes the connection.
+func (s *StatsD) Stop() error {
+	if s.stopC == nil {
+		return nil
+	}
+	close(s.stopC)
+	s.wg.Wait()
+	s.stopC = nil
+	return s.conn.Close()
+}
+
+func (s *StatsD) loop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.push()
+		case <-s.stopC:
+			s.push()
+			return
+		}
+	}
+}
+
+// push sends the current metrics, in packets of at most statsDPacketSize bytes.
+func (s *StatsD) push() {
+	buff := &bytes.Buffer{}
+	for _, line := range s.lines() {
+		if buff.Len() > 0 && buff.Len()+len(line)+1 > statsDPacketSize {
+			s.send(buff.Bytes())
+			buff.Reset()
+		}
+		if buff.Len() > 0 {
+			buff.WriteByte('\n')
+		}
+		buff.WriteString(line)
+	}
+	if buff.Len() > 0 {
+		s.send(buff.Bytes())
+	}
+}
+
+func (s *StatsD) send(packet []byte) {
+	if _, err := s.conn.Write(packet); err != nil {
+		logger.WithError(err).Warn("Could not push metrics to StatsD")
+	}
+}
+
+// lines returns the StatsD lines of the current values of the numeric metrics.
+func (s *StatsD) lines() []string {
+	var lines []string
+	eachValue(func(name, key string, value float64) {
+		lines = s.appendLine(lines, name, key, value)
+	})
+	return lines
+}
+
+func (s *StatsD) appendLine(lines []string, name, key string, value float64) []string {
+	counter := strings.Contains(name, "total_")
+	tags := s.tags()
+	if key != "" {
+		if len(tags) > 0 {
+			tags = append(tags, "key:"+statsDName(key))
+		} else {
+			name = name + "." + key
+		}
+	}
+	metricType := "g"
+	if counter {
+		id := name + "|" + key
+		delta := value - s.previous[id]
+		s.previous[id] = value
+		if delta < 0 {
+			// the counter was reset
+			delta = value
+		}
+		value = delta
+		metricType = "c"
+	}
+
+	line := fmt.Sprintf("%s%s:%v|%s", s.prefix(), statsDName(name), value, metricType)
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return append(lines, line)
+}
+
+func (s *StatsD) prefix() string {
+	if s.config.Prefix == nil {
+		return ""
+	}
+	return *s.config.Prefix
+}
+
+func (s *StatsD) tags() []string {
+	if s.config.Tags == nil {
+		return nil
+	}
+	return append([]string(nil), *s.config.Tags...)
+}
+
+// statsDName replaces the characters reserved by the StatsD protocol.
+func statsDName(name string) string {
+	return strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_").Replace(name)
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"expvar"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsD_PushesCountersAndGauges(t *testing.T) {
+	a := assert.New(t)
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	a.NoError(err)
+	defer server.Close()
+
+	counter := expvar.NewInt("statsd_test.total_messages")
+	counter.Set(5)
+	expvar.NewInt("statsd_test.current_routes").Set(3)
+	expvar.NewMap("statsd_test.per_topic").Add("/foo", 2)
+
+	address, prefix, interval := server.LocalAddr().String(), "guble.", time.Hour
+	tags := []string{"env:test"}
+	statsd := NewStatsD(StatsDConfig{Address: &address, Prefix: &prefix, Tags: &tags, Interval: &interval})
+	a.NoError(statsd.Start())
+
+	counter.Add(3)
+	statsd.push()
+	a.NoError(statsd.Stop())
+
+	var received []string
+	buff := make([]byte, statsDPacketSize)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := server.ReadFrom(buff)
+		if err != nil {
+			break
+		}
+		received = append(received, strings.Split(string(buff[:n]), "\n")...)
+	}
+
+	a.Contains(received, "guble.statsd_test.total_messages:8|c|#env:test")
+	a.Contains(received, "guble.statsd_test.current_routes:3|g|#env:test")
+	a.Contains(received, "guble.statsd_test.per_topic:2|g|#env:test,key:/foo")
+	// the last push on stop only sends the increment of the counter
+	a.Contains(received, "guble.statsd_test.total_messages:0|c|#env:test")
+}
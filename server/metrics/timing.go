@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// timingSize is the number of the last observations kept for computing the percentiles of a Timing
+const timingSize = 1024
+
+// Timing is a metric exposing the percentiles (p50, p95, p99) of the last observed durations of an operation,
+// in milliseconds.
+type Timing interface {
+	Observe(time.Duration)
+}
+
+type timing struct {
+	mutex  sync.Mutex
+	values []float64
+	next   int
+}
+
+func newTiming() *timing {
+	return &timing{values: make([]float64, 0, timingSize)}
+}
+
+// Observe records a duration, replacing the oldest one when timingSize durations are kept.
+func (t *timing) Observe(d time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ms := float64(d) / float64(time.Millisecond)
+	if len(t.values) < timingSize {
+		t.values = append(t.values, ms)
+		return
+	}
+	t.values[t.next] = ms
+	t.next = (t.next + 1) % timingSize
+}
+
+func (t *timing) String() string {
+	t.mutex.Lock()
+	sorted := make([]float64, len(t.values))
+	copy(sorted, t.values)
+	t.mutex.Unlock()
+
+	sort.Float64s(sorted)
+	return fmt.Sprintf(`{"p50": %v, "p95": %v, "p99": %v}`,
+		percentile(sorted, 50), percentile(sorted, 95), percentile(sorted, 99))
+}
+
+// percentile returns the nearest-rank percentile of the sorted values, or 0 if there are none.
+func percentile(sorted []float64, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,443 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Bogh/gcm"
+
+	"github.com/smancke/guble/server/amqp"
+	"github.com/smancke/guble/server/apns"
+	"github.com/smancke/guble/server/fcm"
+	"github.com/smancke/guble/server/federation"
+	"github.com/smancke/guble/server/graphql"
+	"github.com/smancke/guble/server/grpc"
+	"github.com/smancke/guble/server/hms"
+	"github.com/smancke/guble/server/nats"
+	"github.com/smancke/guble/server/plugin"
+	"github.com/smancke/guble/server/pubsub"
+	"github.com/smancke/guble/server/redis"
+	"github.com/smancke/guble/server/rest"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/slack"
+	"github.com/smancke/guble/server/sms"
+	"github.com/smancke/guble/server/sns"
+	"github.com/smancke/guble/server/stomp"
+	"github.com/smancke/guble/server/telegram"
+	"github.com/smancke/guble/server/webhook"
+	"github.com/smancke/guble/server/webserver"
+	"github.com/smancke/guble/server/websocket"
+	"github.com/smancke/guble/server/wns"
+	"github.com/smancke/guble/server/xmpp"
+)
+
+const (
+	// clusterModule and metricsModule are not created by a moduleFactory, but can be disabled like the other modules
+	clusterModule = "cluster"
+	metricsModule = "metrics"
+)
+
+// moduleFactory creates the modules of an optional subsystem of the server, if it is enabled by the configuration.
+type moduleFactory struct {
+	name    string
+	enabled func() bool
+	create  func(router router.Router) ([]interface{}, error)
+}
+
+// moduleFactories are the constructors of the modules, in their order of creation.
+// Any of them can also be disabled with `--disable-module <name>`.
+var moduleFactories = []moduleFactory{
+	{
+		name:    "ws",
+		enabled: always,
+		create: func(router router.Router) ([]interface{}, error) {
+			handler, err := websocket.NewWSHandler(router, "/stream/")
+			if err != nil {
+				return nil, err
+			}
+			handler.WithTokenValidator(tokenValidator)
+			if rateLimiter != nil {
+				handler.WithMessageLimiter(rateLimiter)
+			}
+			if quotas != nil {
+				handler.WithMessageQuota(quotas)
+			}
+			if *Config.Presence {
+				handler.WithPresence()
+			}
+			return []interface{}{handler}, nil
+		},
+	},
+	{
+		name:    "sockjs",
+		enabled: func() bool { return *Config.SockJS.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			handler, err := websocket.NewSockJSHandler(router, *Config.SockJS.Prefix)
+			if err != nil {
+				return nil, err
+			}
+			handler.WithTokenValidator(tokenValidator)
+			if rateLimiter != nil {
+				handler.WithMessageLimiter(rateLimiter)
+			}
+			if quotas != nil {
+				handler.WithMessageQuota(quotas)
+			}
+			if *Config.Presence {
+				handler.WithPresence()
+			}
+			return []interface{}{handler}, nil
+		},
+	},
+	{
+		name:    "rest",
+		enabled: always,
+		create: func(router router.Router) ([]interface{}, error) {
+			api := rest.NewRestMessageAPI(router, "/api/").
+				WithTokenValidator(tokenValidator).
+				WithSignatures(Config.RESTSignatures).
+				WithCORS(Config.RESTCORS)
+			if rateLimiter != nil {
+				api.WithMessageLimiter(rateLimiter)
+			}
+			if quotas != nil {
+				api.WithMessageQuota(quotas)
+			}
+			return []interface{}{api}, nil
+		},
+	},
+	{
+		name:    "grpc",
+		enabled: func() bool { return *Config.GRPC.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if certificateAuthentication() {
+				return nil, errCertificateAuthentication
+			}
+			server := grpc.New(router, Config.GRPC).WithTokenValidator(tokenValidator)
+			if rateLimiter != nil {
+				server.WithMessageLimiter(rateLimiter)
+			}
+			if quotas != nil {
+				server.WithMessageQuota(quotas)
+			}
+			return []interface{}{server}, nil
+		},
+	},
+	{
+		name:    "graphql",
+		enabled: func() bool { return *Config.GraphQL.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			handler, err := graphql.NewHandler(router, Config.GraphQL)
+			if err != nil {
+				return nil, err
+			}
+			handler.WithTokenValidator(tokenValidator)
+			if rateLimiter != nil {
+				handler.WithMessageLimiter(rateLimiter)
+			}
+			if quotas != nil {
+				handler.WithMessageQuota(quotas)
+			}
+			return []interface{}{handler}, nil
+		},
+	},
+	{
+		name:    "stomp",
+		enabled: func() bool { return *Config.STOMP.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if certificateAuthentication() {
+				return nil, errCertificateAuthentication
+			}
+			server := stomp.New(router, Config.STOMP).WithTokenValidator(tokenValidator)
+			if rateLimiter != nil {
+				server.WithMessageLimiter(rateLimiter)
+			}
+			if quotas != nil {
+				server.WithMessageQuota(quotas)
+			}
+			return []interface{}{server}, nil
+		},
+	},
+	{
+		name:    "fcm",
+		enabled: func() bool { return *Config.FCM.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.FCM.APIKey == "" {
+				logger.Panic("The API Key has to be provided when Firebase Cloud Messaging is enabled")
+			}
+			Config.FCM.AfterMessageDelivery = AfterMessageDelivery
+			*Config.FCM.IntervalMetrics = true
+			if Config.FCM.Endpoint != nil {
+				gcm.GcmSendEndpoint = *Config.FCM.Endpoint
+			}
+			sender := fcm.NewSender(*Config.FCM.APIKey)
+			return one(fcm.New(router, sender, Config.FCM))
+		},
+	},
+	{
+		name:    "apns",
+		enabled: func() bool { return *Config.APNS.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.APNS.Production {
+				logger.Info("APNS: enabled in production mode")
+			} else {
+				logger.Info("APNS: enabled in development mode")
+			}
+			if *Config.APNS.CertificateFileName == "" && Config.APNS.CertificateBytes == nil {
+				logger.Panic("The certificate (as filename or bytes) has to be provided when APNS is enabled")
+			}
+			if *Config.APNS.CertificatePassword == "" {
+				logger.Panic("A non-empty password has to be provided when APNS is enabled")
+			}
+			if *Config.APNS.AppTopic == "" {
+				logger.Panic("The Mobile App Topic (usually the bundle-id) has to be provided when APNS is enabled")
+			}
+			apnsSender, err := apns.NewSender(Config.APNS)
+			if err != nil {
+				logger.Panic("APNS Sender could not be created")
+			}
+			*Config.APNS.IntervalMetrics = true
+			return one(apns.New(router, apnsSender, Config.APNS))
+		},
+	},
+	{
+		name:    "sms",
+		enabled: func() bool { return *Config.SMS.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.SMS.APIKey == "" || *Config.SMS.APISecret == "" {
+				logger.Panic("The API Key has to be provided when NEXMO SMS connector is enabled")
+			}
+			nexmoSender, err := sms.NewNexmoSender(*Config.SMS.APIKey, *Config.SMS.APISecret)
+			if err != nil {
+				logger.WithError(err).Error("Error creating Nexmo Sender")
+			}
+			return one(sms.New(router, nexmoSender, Config.SMS))
+		},
+	},
+	{
+		name:    "amqp",
+		enabled: func() bool { return *Config.AMQP.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if len(*Config.AMQP.Topics) == 0 && *Config.AMQP.Queue == "" {
+				logger.Panic("At least a topic or a queue has to be provided when the AMQP bridge is enabled")
+			}
+			return one(amqp.New(router, amqp.Dial, Config.AMQP))
+		},
+	},
+	{
+		name:    "federation",
+		enabled: func() bool { return *Config.Federation.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.Federation.Name == "" || *Config.Federation.Token == "" ||
+				len(*Config.Federation.Peers) == 0 || len(*Config.Federation.Topics) == 0 {
+				logger.Panic("The name, the token, the peers and the topics have to be provided when the federation is enabled")
+			}
+			return []interface{}{federation.New(router, Config.Federation)}, nil
+		},
+	},
+	{
+		name:    "nats",
+		enabled: func() bool { return *Config.NATS.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if len(*Config.NATS.Topics) == 0 && len(*Config.NATS.Subjects) == 0 {
+				logger.Panic("At least a topic or a subject has to be provided when the NATS bridge is enabled")
+			}
+			return one(nats.New(router, nats.Dial, Config.NATS))
+		},
+	},
+	{
+		name:    "redis",
+		enabled: func() bool { return *Config.Redis.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if len(*Config.Redis.Topics) == 0 && len(*Config.Redis.Channels) == 0 {
+				logger.Panic("At least a topic or a channel has to be provided when the Redis bridge is enabled")
+			}
+			return one(redis.New(router, redis.Dial, Config.Redis))
+		},
+	},
+	{
+		name:    "webhook",
+		enabled: func() bool { return *Config.Webhook.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			sender := webhook.NewSender(*Config.Webhook.Secret, *Config.Webhook.Timeout)
+			return one(webhook.New(router, sender, Config.Webhook))
+		},
+	},
+	{
+		name:    "slack",
+		enabled: func() bool { return *Config.Slack.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.Slack.WebhookURL == "" {
+				logger.Panic("The webhook URL has to be provided when the Slack connector is enabled")
+			}
+			sender := slack.NewSender(*Config.Slack.WebhookURL, slackTimeout)
+			return one(slack.New(router, sender, Config.Slack))
+		},
+	},
+	{
+		name:    "wns",
+		enabled: func() bool { return *Config.WNS.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.WNS.ClientID == "" || *Config.WNS.ClientSecret == "" {
+				logger.Panic("The client ID and secret have to be provided when WNS is enabled")
+			}
+			sender := wns.NewSender(*Config.WNS.TokenEndpoint, *Config.WNS.ClientID, *Config.WNS.ClientSecret,
+				*Config.WNS.Type, *Config.WNS.Timeout)
+			return one(wns.New(router, sender, Config.WNS))
+		},
+	},
+	{
+		name:    "hms",
+		enabled: func() bool { return *Config.HMS.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.HMS.AppID == "" || *Config.HMS.AppSecret == "" {
+				logger.Panic("The app ID and secret have to be provided when Huawei Push Kit is enabled")
+			}
+			sender := hms.NewSender(*Config.HMS.Endpoint, *Config.HMS.TokenEndpoint, *Config.HMS.AppID,
+				*Config.HMS.AppSecret, *Config.HMS.Timeout)
+			return one(hms.New(router, sender, Config.HMS))
+		},
+	},
+	{
+		name:    "telegram",
+		enabled: func() bool { return *Config.Telegram.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.Telegram.BotToken == "" {
+				logger.Panic("The bot token has to be provided when Telegram is enabled")
+			}
+			sender := telegram.NewSender(*Config.Telegram.Endpoint, *Config.Telegram.BotToken,
+				*Config.Telegram.ParseMode, *Config.Telegram.Timeout)
+			return one(telegram.New(router, sender, Config.Telegram))
+		},
+	},
+	{
+		name:    "sns",
+		enabled: func() bool { return *Config.SNS.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.SNS.Region == "" {
+				logger.Panic("The AWS region has to be provided when the SNS connector is enabled")
+			}
+			var modules []interface{}
+			if *Config.SNS.Prefix != "" {
+				modules = append(modules, sns.NewNotificationHandler(router, Config.SNS))
+			}
+			publisher, err := sns.NewPublisher(*Config.SNS.Region)
+			if err != nil {
+				return modules, err
+			}
+			snsConn, err := sns.New(router, publisher, Config.SNS)
+			if err != nil {
+				return modules, err
+			}
+			return append(modules, snsConn), nil
+		},
+	},
+	{
+		name:    "pubsub",
+		enabled: func() bool { return *Config.PubSub.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.PubSub.Project == "" {
+				logger.Panic("The project has to be provided when the Pub/Sub sink is enabled")
+			}
+			publisher, err := pubsub.NewPublisher(context.Background(), *Config.PubSub.Project, *Config.PubSub.CredentialsFile)
+			if err != nil {
+				return nil, err
+			}
+			return one(pubsub.New(router, publisher, Config.PubSub))
+		},
+	},
+	{
+		name:    "xmpp",
+		enabled: func() bool { return *Config.XMPP.Enabled },
+		create: func(router router.Router) ([]interface{}, error) {
+			if *Config.XMPP.Domain == "" || *Config.XMPP.Secret == "" {
+				logger.Panic("The component domain and secret have to be provided when XMPP is enabled")
+			}
+			return one(xmpp.New(router, xmpp.Dial, Config.XMPP))
+		},
+	},
+	{
+		name:    "plugins",
+		enabled: func() bool { return len(*Config.Plugins.Paths) > 0 || len(*Config.Plugins.Processes) > 0 },
+		create: func(router router.Router) ([]interface{}, error) {
+			var modules []interface{}
+			for _, spec := range *Config.Plugins.Paths {
+				if pluginConn, err := plugin.Load(router, spec); err != nil {
+					logger.WithError(err).WithField("plugin", spec).Error("Error loading plugin")
+				} else {
+					modules = append(modules, pluginConn)
+				}
+			}
+			for _, command := range *Config.Plugins.Processes {
+				logger.WithField("command", command).Info("Plugin process: enabled")
+				modules = append(modules, plugin.NewProcess(router, strings.Fields(command)))
+			}
+			return modules, nil
+		},
+	},
+}
+
+// errCertificateAuthentication is returned by the factories of the modules on their own listeners without TLS,
+// which can not authenticate the clients when only the client certificates do.
+var errCertificateAuthentication = errors.New("The clients can not be authenticated without TLS, when the client certificates are required")
+
+// certificateAuthentication returns true if the clients are authenticated only by their client certificates.
+func certificateAuthentication() bool {
+	return tokenValidator == nil && *Config.TLS.ClientCAFile != "" && *Config.TLS.ClientAuth == webserver.ClientAuthRequire
+}
+
+func always() bool {
+	return true
+}
+
+// one returns the single module created by a constructor, or its error.
+func one(module interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{module}, nil
+}
+
+// createEnabledModules creates the modules of all the factories enabled by the configuration.
+func createEnabledModules(router router.Router) []interface{} {
+	checkDisabledModules()
+
+	var modules []interface{}
+	for _, f := range moduleFactories {
+		if moduleDisabled(f.name) || !f.enabled() {
+			logger.WithField("module", f.name).Info("Module disabled")
+			continue
+		}
+		logger.WithField("module", f.name).Info("Module enabled")
+		created, err := f.create(router)
+		if err != nil {
+			logger.WithError(err).WithField("module", f.name).Error("Error creating module")
+		}
+		modules = append(modules, created...)
+	}
+	return modules
+}
+
+// moduleDisabled returns true if the module was disabled with `--disable-module`.
+func moduleDisabled(name string) bool {
+	for _, disabled := range *Config.DisabledModules {
+		if disabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDisabledModules warns about the disabled modules which do not exist, e.g. because of a typo.
+func checkDisabledModules() {
+	for _, disabled := range *Config.DisabledModules {
+		known := disabled == clusterModule || disabled == metricsModule
+		for _, f := range moduleFactories {
+			known = known || f.name == disabled
+		}
+		if !known {
+			logger.WithField("module", disabled).Warn("Unknown module can not be disabled")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package nats
+
+import (
+	"time"
+
+	natslib "github.com/nats-io/go-nats"
+)
+
+// Conn is the subset of a NATS connection used by the bridge.
+type Conn interface {
+	Publish(subject string, data []byte) error
+	QueueSubscribe(subject, queue string, handler natslib.MsgHandler) error
+	Close()
+}
+
+// Dialer opens a Conn to the NATS server(s) given in the Config.
+type Dialer func(Config) (Conn, error)
+
+type conn struct {
+	*natslib.Conn
+}
+
+// Dial is the default Dialer: the returned connection reconnects forever on its own,
+// keeping its subscriptions, and does not receive the messages it publishes itself.
+func Dial(config Config) (Conn, error) {
+	nc, err := natslib.Connect(*config.URL,
+		natslib.Name(bridgeID),
+		natslib.NoEcho(),
+		natslib.MaxReconnects(-1),
+		natslib.ReconnectWait(time.Second),
+		natslib.DisconnectHandler(func(*natslib.Conn) {
+			logger.Warn("Disconnected from NATS")
+		}),
+		natslib.ReconnectHandler(func(nc *natslib.Conn) {
+			logger.WithField("url", nc.ConnectedUrl()).Info("Reconnected to NATS")
+			mTotalReconnects.Add(1)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{nc}, nil
+}
+
+func (c *conn) QueueSubscribe(subject, queue string, handler natslib.MsgHandler) error {
+	var err error
+	if queue == "" {
+		_, err = c.Conn.Subscribe(subject, handler)
+	} else {
+		_, err = c.Conn.QueueSubscribe(subject, queue, handler)
+	}
+	return err
+}
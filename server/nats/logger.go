@@ -0,0 +1,7 @@
+package nats
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "nats")
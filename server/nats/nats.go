@@ -0,0 +1,172 @@
+package nats
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	natslib "github.com/nats-io/go-nats"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// bridgeID marks the messages published in guble by the bridge,
+	// so that they are not sent back to NATS.
+	bridgeID = "guble-nats-bridge"
+
+	defaultChannelSize = 1000
+)
+
+// Config is used for configuring the NATS bridge.
+type Config struct {
+	Enabled *bool
+	URL     *string
+
+	// Topics are the guble topics which are published to NATS.
+	Topics *[]string
+
+	// Subjects are the NATS subjects (wildcards allowed) whose messages are published in guble.
+	Subjects *[]string
+
+	// QueueGroup is used for subscribing to the Subjects, so that each message is received
+	// by a single guble node of a cluster (an empty QueueGroup makes all the nodes receive it).
+	QueueGroup *string
+
+	// TopicPrefix is prepended to the path of the messages coming from NATS.
+	TopicPrefix *string
+}
+
+type bridge struct {
+	config Config
+	router router.Router
+	dial   Dialer
+	conn   Conn
+
+	routes []*router.Route
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// New returns a bridge between the guble router and the NATS server reached through the dialer.
+func New(router router.Router, dial Dialer, config Config) (*bridge, error) {
+	return &bridge{
+		config: config,
+		router: router,
+		dial:   dial,
+	}, nil
+}
+
+func (b *bridge) Start() error {
+	logger.Debug("Starting NATS bridge")
+	resetNATSMetrics()
+
+	conn, err := b.dial(b.config)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("Could not connect to NATS")
+		return err
+	}
+	b.conn = conn
+
+	b.ctx, b.cancelFunc = context.WithCancel(context.Background())
+	b.routes = nil
+
+	for _, topic := range *b.config.Topics {
+		route := router.NewRoute(router.RouteConfig{
+			Path:        protocol.Path(topic),
+			ChannelSize: defaultChannelSize,
+		})
+		if _, err := b.router.Subscribe(route); err != nil {
+			b.cancelFunc()
+			conn.Close()
+			return err
+		}
+		b.routes = append(b.routes, route)
+		b.wg.Add(1)
+		go b.forward(route)
+	}
+
+	for _, subject := range *b.config.Subjects {
+		if err := conn.QueueSubscribe(subject, *b.config.QueueGroup, b.receive); err != nil {
+			logger.WithFields(log.Fields{
+				"error":   err.Error(),
+				"subject": subject,
+			}).Error("Could not subscribe to NATS subject")
+			b.Stop()
+			return err
+		}
+	}
+
+	logger.Debug("Started NATS bridge")
+	return nil
+}
+
+func (b *bridge) Stop() error {
+	logger.Debug("Stopping NATS bridge")
+	if b.cancelFunc == nil {
+		// the bridge is stopped after a failed connection as well
+		return nil
+	}
+	b.cancelFunc()
+	for _, route := range b.routes {
+		b.router.Unsubscribe(route)
+	}
+	b.wg.Wait()
+	b.conn.Close()
+	logger.Debug("Stopped NATS bridge")
+	return nil
+}
+
+// forward publishes to NATS the messages received by a guble route.
+func (b *bridge) forward(route *router.Route) {
+	defer b.wg.Done()
+	err := router.Forward(b.ctx, b.router, route, func(m *protocol.Message) {
+		if m.UserID == bridgeID {
+			return
+		}
+		if err := b.conn.Publish(subject(m.Path), m.Body); err != nil {
+			logger.WithFields(log.Fields{
+				"error":   err.Error(),
+				"message": m.ID,
+			}).Error("Could not publish message to NATS")
+			mTotalPublishErrors.Add(1)
+			return
+		}
+		mTotalPublishedMessages.Add(1)
+	})
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("Could not subscribe again")
+	}
+}
+
+// receive publishes in guble a message coming from NATS.
+func (b *bridge) receive(msg *natslib.Msg) {
+	m := &protocol.Message{
+		Path:   topicPath(*b.config.TopicPrefix, msg.Subject),
+		UserID: bridgeID,
+		Body:   msg.Data,
+	}
+	if err := b.router.HandleMessage(m); err != nil {
+		logger.WithFields(log.Fields{
+			"error":   err.Error(),
+			"subject": msg.Subject,
+		}).Error("Could not handle message from NATS")
+		mTotalReceiveErrors.Add(1)
+		return
+	}
+	mTotalReceivedMessages.Add(1)
+}
+
+// subject converts a guble path to a NATS subject: /foo/bar becomes foo.bar
+func subject(p protocol.Path) string {
+	return strings.Replace(p.RemovePrefixSlash(), "/", ".", -1)
+}
+
+// topicPath converts a NATS subject to a guble path (under the given prefix): foo.bar becomes /prefix/foo/bar
+func topicPath(prefix, subject string) protocol.Path {
+	return protocol.Path(strings.TrimRight(prefix, "/") + "/" + strings.Replace(subject, ".", "/", -1))
+}
@@ -0,0 +1,150 @@
+package nats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	natslib "github.com/nats-io/go-nats"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+type published struct {
+	subject string
+	data    []byte
+}
+
+type fakeConn struct {
+	publishedC chan published
+	handlers   map[string]natslib.MsgHandler
+	queues     map[string]string
+	closed     bool
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		publishedC: make(chan published, 10),
+		handlers:   make(map[string]natslib.MsgHandler),
+		queues:     make(map[string]string),
+	}
+}
+
+func (c *fakeConn) Publish(subject string, data []byte) error {
+	c.publishedC <- published{subject, data}
+	return nil
+}
+
+func (c *fakeConn) QueueSubscribe(subject, queue string, handler natslib.MsgHandler) error {
+	c.handlers[subject] = handler
+	c.queues[subject] = queue
+	return nil
+}
+
+func (c *fakeConn) Close() {
+	c.closed = true
+}
+
+func testConfig(topics, subjects []string) Config {
+	enabled := true
+	url := "nats://localhost:4222"
+	queueGroup := "guble"
+	prefix := "/nats"
+	return Config{
+		Enabled:     &enabled,
+		URL:         &url,
+		Topics:      &topics,
+		Subjects:    &subjects,
+		QueueGroup:  &queueGroup,
+		TopicPrefix: &prefix,
+	}
+}
+
+func TestSubjectAndTopicPath(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("foo.bar", subject(protocol.Path("/foo/bar")))
+	a.Equal("foo", subject(protocol.Path("/foo")))
+	a.Equal(protocol.Path("/nats/foo/bar"), topicPath("/nats", "foo.bar"))
+	a.Equal(protocol.Path("/nats/foo"), topicPath("/nats/", "foo"))
+	a.Equal(protocol.Path("/foo"), topicPath("", "foo"))
+}
+
+func TestBridge_StartFailsWhenDialFails(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	dialErr := errors.New("connection refused")
+
+	b, err := New(routerMock, func(Config) (Conn, error) { return nil, dialErr }, testConfig([]string{"/foo"}, nil))
+	a.NoError(err)
+	a.Equal(dialErr, b.Start())
+
+	// the service is stopped after its failed start
+	a.NoError(b.Stop())
+}
+
+func TestBridge_PublishesGubleMessages(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn := newFakeConn()
+	routerMock := NewMockRouter(testutil.MockCtrl)
+
+	var route *router.Route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo"), r.Path)
+		route = r
+	}).Return(nil, nil)
+
+	b, err := New(routerMock, func(Config) (Conn, error) { return conn, nil }, testConfig([]string{"/foo"}, nil))
+	a.NoError(err)
+	a.NoError(b.Start())
+
+	a.NoError(route.Deliver(&protocol.Message{ID: 42, Path: "/foo/bar", Body: []byte("hello")}, false))
+	// messages coming from the bridge itself are not published back
+	a.NoError(route.Deliver(&protocol.Message{ID: 43, Path: "/foo/bar", UserID: bridgeID}, false))
+
+	select {
+	case p := <-conn.publishedC:
+		a.Equal("foo.bar", p.subject)
+		a.Equal([]byte("hello"), p.data)
+	case <-time.After(time.Second):
+		a.Fail("message was not published")
+	}
+
+	routerMock.EXPECT().Unsubscribe(route)
+	a.NoError(b.Stop())
+	a.True(conn.closed)
+	a.Len(conn.publishedC, 0)
+}
+
+func TestBridge_ReceivesNATSMessages(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn := newFakeConn()
+	routerMock := NewMockRouter(testutil.MockCtrl)
+
+	b, err := New(routerMock, func(Config) (Conn, error) { return conn, nil }, testConfig(nil, []string{"orders.>"}))
+	a.NoError(err)
+	a.NoError(b.Start())
+	a.Equal("guble", conn.queues["orders.>"])
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/nats/orders/created"), m.Path)
+		a.Equal(bridgeID, m.UserID)
+		a.Equal([]byte("hello"), m.Body)
+	}).Return(nil)
+	conn.handlers["orders.>"](&natslib.Msg{Subject: "orders.created", Data: []byte("hello")})
+
+	a.NoError(b.Stop())
+}
@@ -0,0 +1,95 @@
+// Package oauth provides access tokens obtained with the OAuth 2.0 client-credentials flow,
+// as used by some of the push connectors.
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenExpiryMargin is subtracted from the lifetime of a token, so that it is renewed before it expires
+	tokenExpiryMargin = time.Minute
+)
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// TokenSource requests access tokens with the OAuth client-credentials flow, and caches them until they expire.
+type TokenSource struct {
+	endpoint     string
+	clientID     string
+	clientSecret string
+	scope        string
+	client       *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewTokenSource returns a TokenSource for the given token endpoint and client credentials
+// (the scope is optional).
+func NewTokenSource(endpoint, clientID, clientSecret, scope string, client *http.Client) *TokenSource {
+	return &TokenSource{
+		endpoint:     endpoint,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scope:        scope,
+		client:       client,
+	}
+}
+
+// Token returns a valid access token, requesting a new one if needed.
+func (ts *TokenSource) Token() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && time.Now().Before(ts.expiry) {
+		return ts.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {ts.clientID},
+		"client_secret": {ts.clientSecret},
+	}
+	if ts.scope != "" {
+		form.Set("scope", ts.scope)
+	}
+	resp, err := ts.client.PostForm(ts.endpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	tr := &tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(tr); err != nil {
+		return "", fmt.Errorf("could not decode token response (status code %d): %s", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return "", fmt.Errorf("could not get access token (status code %d): %s", resp.StatusCode, tr.Error)
+	}
+
+	ts.token = tr.AccessToken
+	ts.expiry = time.Now().Add(time.Duration(tr.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return ts.token, nil
+}
+
+// Invalidate discards the given token (if it is still the cached one), so that a new one is requested.
+func (ts *TokenSource) Invalidate(token string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token == token {
+		ts.token = ""
+	}
+}
@@ -0,0 +1,86 @@
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenSource_Token(t *testing.T) {
+	a := assert.New(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		a.NoError(req.ParseForm())
+		a.Equal("client_credentials", req.PostForm.Get("grant_type"))
+		a.Equal("id", req.PostForm.Get("client_id"))
+		a.Equal("secret", req.PostForm.Get("client_secret"))
+		a.Equal("scope", req.PostForm.Get("scope"))
+		requests++
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"bearer","expires_in":3600}`, requests)
+	}))
+	defer server.Close()
+
+	ts := NewTokenSource(server.URL, "id", "secret", "scope", http.DefaultClient)
+
+	token, err := ts.Token()
+	a.NoError(err)
+	a.Equal("token1", token)
+
+	// the token is cached
+	token, err = ts.Token()
+	a.NoError(err)
+	a.Equal("token1", token)
+
+	// invalidating an older token has no effect
+	ts.Invalidate("token0")
+	token, err = ts.Token()
+	a.NoError(err)
+	a.Equal("token1", token)
+
+	ts.Invalidate("token1")
+	token, err = ts.Token()
+	a.NoError(err)
+	a.Equal("token2", token)
+	a.Equal(2, requests)
+}
+
+func TestTokenSource_TokenExpired(t *testing.T) {
+	a := assert.New(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		// shorter than the expiry margin
+		fmt.Fprintf(w, `{"access_token":"token%d","expires_in":30}`, requests)
+	}))
+	defer server.Close()
+
+	ts := NewTokenSource(server.URL, "id", "secret", "", http.DefaultClient)
+	ts.Token()
+	token, err := ts.Token()
+	a.NoError(err)
+	a.Equal("token2", token)
+}
+
+func TestTokenSource_TokenError(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"invalid_client"}`)
+	}))
+	defer server.Close()
+
+	_, err := NewTokenSource(server.URL, "id", "wrong", "", http.DefaultClient).Token()
+	a.EqualError(err, "could not get access token (status code 401): invalid_client")
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `<html>`)
+	})
+	_, err = NewTokenSource(server.URL, "id", "wrong", "", http.DefaultClient).Token()
+	a.Error(err)
+}
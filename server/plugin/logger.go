@@ -0,0 +1,7 @@
+package plugin
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "plugin")
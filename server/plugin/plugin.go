@@ -0,0 +1,68 @@
+// Package plugin loads the connectors which are not a part of guble: Go plugins, and connectors running as a subprocess.
+//
+// A Go plugin (built with `go build -buildmode=plugin`) exports a function named NewConnector, of the Factory type.
+// The module it returns is registered like the built-in connectors: it can implement any of
+// service.Startable, service.Stopable, service.Endpoint and health.Checker.
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	goplugin "plugin"
+
+	"github.com/smancke/guble/server/router"
+)
+
+// FactorySymbol is the name of the function exported by a Go plugin.
+const FactorySymbol = "NewConnector"
+
+var (
+	ErrInvalidFactory = errors.New("plugin symbol " + FactorySymbol + " is not a plugin.Factory")
+)
+
+// Factory creates the connector of a Go plugin, configured with the given arguments.
+type Factory func(router router.Router, args map[string]string) (interface{}, error)
+
+// Load opens the Go plugin given by the spec (the path of the plugin, with optional arguments
+// in URL query format, e.g. `/usr/lib/guble/foo.so?key=value`) and returns its connector.
+func Load(r router.Router, spec string) (interface{}, error) {
+	path, args, err := parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := goplugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := p.Lookup(FactorySymbol)
+	if err != nil {
+		return nil, err
+	}
+	factory, ok := symbol.(func(router.Router, map[string]string) (interface{}, error))
+	if !ok {
+		return nil, ErrInvalidFactory
+	}
+
+	logger.WithField("path", path).Info("Loading plugin")
+	return factory(r, args)
+}
+
+// parseSpec returns the path and the arguments of a plugin spec.
+func parseSpec(spec string) (string, map[string]string, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return "", nil, err
+	}
+	if u.Path == "" {
+		return "", nil, fmt.Errorf("missing plugin path in %q", spec)
+	}
+	args := make(map[string]string)
+	for key, values := range u.Query() {
+		if len(values) > 0 {
+			args[key] = values[0]
+		}
+	}
+	return u.Path, args, nil
+}
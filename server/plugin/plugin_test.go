@@ -0,0 +1,29 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSpec(t *testing.T) {
+	a := assert.New(t)
+
+	path, args, err := parseSpec("/usr/lib/guble/foo.so?key=value&other=1")
+	a.NoError(err)
+	a.Equal("/usr/lib/guble/foo.so", path)
+	a.Equal(map[string]string{"key": "value", "other": "1"}, args)
+
+	path, args, err = parseSpec("foo.so")
+	a.NoError(err)
+	a.Equal("foo.so", path)
+	a.Empty(args)
+
+	_, _, err = parseSpec("?key=value")
+	a.Error(err)
+}
+
+func TestLoad_MissingPlugin(t *testing.T) {
+	_, err := Load(nil, "/does/not/exist.so")
+	assert.Error(t, err)
+}
@@ -0,0 +1,298 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/jpillora/backoff"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+// Types of the lines exchanged with a connector process
+const (
+	// TypeSubscribe is sent by the process, for receiving the messages of a topic.
+	TypeSubscribe = "subscribe"
+	// TypeUnsubscribe is sent by the process, for cancelling a subscription.
+	TypeUnsubscribe = "unsubscribe"
+	// TypePublish is sent by the process, for publishing a message in guble.
+	TypePublish = "publish"
+	// TypeMessage is sent to the process, for each message of its subscriptions.
+	TypeMessage = "message"
+
+	defaultChannelSize = 1000
+	maxLineSize        = 1024 * 1024
+)
+
+var (
+	ErrEmptyCommand = errors.New("empty plugin command")
+)
+
+// Line is a line of JSON exchanged with a connector process, on its standard input and output.
+type Line struct {
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	ID         uint64 `json:"id,omitempty"`
+	UserID     string `json:"userId,omitempty"`
+	HeaderJSON string `json:"headerJSON,omitempty"`
+	Time       int64  `json:"time,omitempty"`
+
+	// Body is encoded as base64
+	Body []byte `json:"body,omitempty"`
+}
+
+// Process is a connector running as a subprocess, which is restarted when it exits.
+// The process subscribes to topics and publishes messages by writing lines of JSON to its standard output,
+// and receives the messages of its subscriptions as lines of JSON on its standard input.
+// The standard error of the process is forwarded to the standard error of guble.
+type Process struct {
+	router  router.Router
+	command []string
+
+	mu     sync.Mutex
+	stdin  io.WriteCloser
+	cmd    *exec.Cmd
+	routes map[protocol.Path]*router.Route
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+
+	logger *log.Entry
+}
+
+// NewProcess returns a connector running the given command (the executable, followed by its arguments).
+func NewProcess(r router.Router, command []string) *Process {
+	return &Process{
+		router:  r,
+		command: command,
+		routes:  make(map[protocol.Path]*router.Route),
+		logger:  logger.WithField("command", command),
+	}
+}
+
+func (p *Process) Start() error {
+	if len(p.command) == 0 {
+		return ErrEmptyCommand
+	}
+	p.ctx, p.cancelFunc = context.WithCancel(context.Background())
+
+	stdout, err := p.start()
+	if err != nil {
+		p.logger.WithField("error", err.Error()).Error("Could not start plugin process")
+		return err
+	}
+	p.wg.Add(1)
+	go p.run(stdout)
+	return nil
+}
+
+func (p *Process) Stop() error {
+	p.cancelFunc()
+	p.mu.Lock()
+	if p.cmd != nil {
+		p.stdin.Close()
+		p.cmd.Process.Kill()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
+
+// start starts the process, returning its standard output.
+func (p *Process) start() (io.Reader, error) {
+	cmd := exec.Command(p.command[0], p.command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.cmd, p.stdin = cmd, stdin
+	p.mu.Unlock()
+	p.logger.WithField("pid", cmd.Process.Pid).Info("Started plugin process")
+	return stdout, nil
+}
+
+// run reads the output of the process, restarting it when it exits.
+func (p *Process) run(stdout io.Reader) {
+	defer p.wg.Done()
+	bo := &backoff.Backoff{Min: 100 * time.Millisecond, Max: 30 * time.Second, Factor: 2}
+
+	for {
+		if stdout != nil {
+			p.read(stdout)
+			err := p.cmd.Wait()
+			p.unsubscribeAll()
+			if p.ctx.Err() != nil {
+				return
+			}
+			p.logger.WithField("error", err).Error("Plugin process exited")
+		}
+
+		select {
+		case <-time.After(bo.Duration()):
+		case <-p.ctx.Done():
+			return
+		}
+		var err error
+		if stdout, err = p.start(); err != nil {
+			p.logger.WithField("error", err.Error()).Error("Could not restart plugin process")
+		}
+	}
+}
+
+func (p *Process) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	for scanner.Scan() {
+		line := &Line{}
+		if err := json.Unmarshal(scanner.Bytes(), line); err != nil {
+			p.logger.WithField("error", err.Error()).Error("Invalid line from plugin process")
+			continue
+		}
+		p.handle(line)
+	}
+}
+
+func (p *Process) handle(line *Line) {
+	path := protocol.Path(line.Path)
+	switch line.Type {
+	case TypeSubscribe:
+		p.subscribe(path)
+	case TypeUnsubscribe:
+		p.unsubscribe(path)
+	case TypePublish:
+		err := p.router.HandleMessage(&protocol.Message{
+			Path:       path,
+			UserID:     line.UserID,
+			HeaderJSON: line.HeaderJSON,
+			Body:       line.Body,
+		})
+		if err != nil {
+			p.logger.WithFields(log.Fields{
+				"error": err.Error(),
+				"path":  path,
+			}).Error("Could not publish message of plugin process")
+		}
+	default:
+		p.logger.WithField("type", line.Type).Error("Unknown line type from plugin process")
+	}
+}
+
+func (p *Process) subscribe(path protocol.Path) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.routes[path]; ok {
+		return
+	}
+	route := router.NewRoute(router.RouteConfig{
+		Path:        path,
+		ChannelSize: defaultChannelSize,
+	})
+	if _, err := p.router.Subscribe(route); err != nil {
+		p.logger.WithFields(log.Fields{
+			"error": err.Error(),
+			"path":  path,
+		}).Error("Could not subscribe plugin process")
+		return
+	}
+	p.routes[path] = route
+	p.wg.Add(1)
+	go p.forward(route)
+}
+
+func (p *Process) unsubscribe(path protocol.Path) {
+	p.mu.Lock()
+	route, ok := p.routes[path]
+	delete(p.routes, path)
+	p.mu.Unlock()
+	if ok {
+		p.router.Unsubscribe(route)
+	}
+}
+
+func (p *Process) unsubscribeAll() {
+	p.mu.Lock()
+	routes := p.routes
+	p.routes = make(map[protocol.Path]*router.Route)
+	p.mu.Unlock()
+	for _, route := range routes {
+		p.router.Unsubscribe(route)
+	}
+}
+
+// forward writes to the process the messages of a route, until it is unsubscribed.
+func (p *Process) forward(route *router.Route) {
+	defer p.wg.Done()
+	for {
+		select {
+		case m, opened := <-route.MessagesChannel():
+			if !opened {
+				if route = p.resubscribe(route); route == nil {
+					return
+				}
+				continue
+			}
+			p.write(&Line{
+				Type:       TypeMessage,
+				Path:       string(m.Path),
+				ID:         m.ID,
+				UserID:     m.UserID,
+				HeaderJSON: m.HeaderJSON,
+				Time:       m.Time,
+				Body:       m.Body,
+			})
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// resubscribe replaces a route closed by the router, returning nil if it was unsubscribed.
+func (p *Process) resubscribe(route *router.Route) *router.Route {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx.Err() != nil || p.routes[route.Path] != route {
+		return nil
+	}
+	p.logger.WithField("route", route.String()).Info("Route closed by router, subscribing again")
+	newRoute := router.NewRoute(route.RouteConfig)
+	if _, err := p.router.Subscribe(newRoute); err != nil {
+		p.logger.WithField("error", err.Error()).Error("Could not subscribe again")
+		delete(p.routes, route.Path)
+		return nil
+	}
+	p.routes[route.Path] = newRoute
+	return newRoute
+}
+
+func (p *Process) write(line *Line) {
+	data, err := json.Marshal(line)
+	if err != nil {
+		p.logger.WithField("error", err.Error()).Error("Could not encode line for plugin process")
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.stdin.Write(append(data, '\n')); err != nil {
+		p.logger.WithField("error", err.Error()).Error("Could not write to plugin process")
+	}
+}
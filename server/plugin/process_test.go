@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+// echoScript subscribes to /foo, and publishes on /bar the body of each message it receives.
+const echoScript = `
+echo '{"type":"subscribe","path":"/foo"}'
+while read line; do
+	body=$(echo "$line" | sed 's/.*"body":"\([^"]*\)".*/\1/')
+	echo '{"type":"publish","path":"/bar","userId":"plugin","body":"'$body'"}'
+done
+`
+
+func TestProcess(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	subscribed := make(chan *router.Route, 1)
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo"), r.Path)
+		subscribed <- r
+	}).Return(nil, nil)
+
+	published := make(chan *protocol.Message, 1)
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		published <- m
+	}).Return(nil)
+
+	p := NewProcess(routerMock, []string{"sh", "-c", echoScript})
+	a.NoError(p.Start())
+
+	var route *router.Route
+	select {
+	case route = <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("plugin process did not subscribe")
+	}
+	route.Deliver(&protocol.Message{ID: 1, Path: "/foo", Body: []byte("hello")}, false)
+
+	select {
+	case m := <-published:
+		a.Equal(protocol.Path("/bar"), m.Path)
+		a.Equal("plugin", m.UserID)
+		a.Equal("hello", string(m.Body))
+	case <-time.After(time.Second):
+		t.Fatal("plugin process did not publish")
+	}
+
+	routerMock.EXPECT().Unsubscribe(route)
+	a.NoError(p.Stop())
+}
+
+func TestProcess_EmptyCommand(t *testing.T) {
+	assert.Equal(t, ErrEmptyCommand, NewProcess(nil, nil).Start())
+}
@@ -0,0 +1,72 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	pubsublib "cloud.google.com/go/pubsub"
+	"google.golang.org/api/option"
+)
+
+// Publisher publishes messages to Pub/Sub topics.
+type Publisher interface {
+	// Publish blocks until the message is accepted by Pub/Sub, or it failed.
+	Publish(ctx context.Context, topicID string, m *pubsublib.Message) error
+	Close() error
+}
+
+// client is the Publisher using the Pub/Sub client library, with message ordering enabled on all the topics.
+type client struct {
+	client *pubsublib.Client
+
+	mu     sync.Mutex
+	topics map[string]*pubsublib.Topic
+}
+
+// NewPublisher returns a Publisher for the topics of the given project.
+// Without a credentials file, the application default credentials are used.
+func NewPublisher(ctx context.Context, project, credentialsFile string) (Publisher, error) {
+	var opts []option.ClientOption
+	if credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
+	}
+	c, err := pubsublib.NewClient(ctx, project, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &client{
+		client: c,
+		topics: make(map[string]*pubsublib.Topic),
+	}, nil
+}
+
+func (c *client) Publish(ctx context.Context, topicID string, m *pubsublib.Message) error {
+	topic := c.topic(topicID)
+	_, err := topic.Publish(ctx, m).Get(ctx)
+	if err != nil && m.OrderingKey != "" {
+		// after an error, the publishing of messages with the same ordering key is paused until resumed
+		topic.ResumePublish(m.OrderingKey)
+	}
+	return err
+}
+
+func (c *client) Close() error {
+	c.mu.Lock()
+	for _, topic := range c.topics {
+		topic.Stop()
+	}
+	c.mu.Unlock()
+	return c.client.Close()
+}
+
+func (c *client) topic(id string) *pubsublib.Topic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	topic, ok := c.topics[id]
+	if !ok {
+		topic = c.client.Topic(id)
+		topic.EnableMessageOrdering = true
+		c.topics[id] = topic
+	}
+	return topic
+}
@@ -0,0 +1,7 @@
+package pubsub
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "pubsub")
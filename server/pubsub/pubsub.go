@@ -0,0 +1,180 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pubsublib "cloud.google.com/go/pubsub"
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	defaultChannelSize = 1000
+
+	attributeMessageID = "guble-message-id"
+	attributePath      = "guble-path"
+	attributeUserID    = "guble-user-id"
+	attributeTime      = "guble-time"
+)
+
+// Config is used for configuring the Pub/Sub sink.
+type Config struct {
+	Enabled         *bool
+	Project         *string
+	CredentialsFile *string
+
+	// Topics are the guble topics published to Pub/Sub, each one with its Pub/Sub topic: "/topic=pubsub-topic"
+	Topics *[]string
+
+	// OrderingKeys are the filter fields of a message giving its ordering key;
+	// the messages with the same values of these fields are delivered by Pub/Sub in order.
+	OrderingKeys *[]string
+}
+
+type topicMapping struct {
+	path    protocol.Path
+	topicID string
+}
+
+type sink struct {
+	config    Config
+	router    router.Router
+	publisher Publisher
+	topics    []topicMapping
+	routes    []*router.Route
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// New returns a sink publishing the messages of the configured guble topics to Pub/Sub.
+func New(router router.Router, publisher Publisher, config Config) (*sink, error) {
+	var topics []topicMapping
+	for _, t := range *config.Topics {
+		parts := strings.SplitN(t, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid Pub/Sub topic %q, expected format: /topic=pubsub-topic", t)
+		}
+		topics = append(topics, topicMapping{path: protocol.Path(parts[0]), topicID: parts[1]})
+	}
+
+	return &sink{
+		config:    config,
+		router:    router,
+		publisher: publisher,
+		topics:    topics,
+	}, nil
+}
+
+func (s *sink) Start() error {
+	logger.Debug("Starting Pub/Sub sink")
+	resetPubSubMetrics()
+
+	s.ctx, s.cancelFunc = context.WithCancel(context.Background())
+	for _, t := range s.topics {
+		route := router.NewRoute(router.RouteConfig{
+			Path:          t.path,
+			ChannelSize:   defaultChannelSize,
+			IgnoreFilters: true,
+		})
+		if _, err := s.router.Subscribe(route); err != nil {
+			s.cancelFunc()
+			return err
+		}
+		s.routes = append(s.routes, route)
+		s.wg.Add(1)
+		go s.forward(route, t.topicID)
+	}
+	logger.Debug("Started Pub/Sub sink")
+	return nil
+}
+
+func (s *sink) Stop() error {
+	logger.Debug("Stopping Pub/Sub sink")
+	s.cancelFunc()
+	for _, route := range s.routes {
+		s.router.Unsubscribe(route)
+	}
+	s.wg.Wait()
+	err := s.publisher.Close()
+	logger.Debug("Stopped Pub/Sub sink")
+	return err
+}
+
+func (s *sink) forward(route *router.Route, topicID string) {
+	defer s.wg.Done()
+	for {
+		select {
+		case m, opened := <-route.MessagesChannel():
+			if !opened {
+				if s.ctx.Err() != nil {
+					return
+				}
+				logger.WithField("route", route.String()).Info("Route closed by router, subscribing again")
+				route = router.NewRoute(route.RouteConfig)
+				if _, err := s.router.Subscribe(route); err != nil {
+					logger.WithField("error", err.Error()).Error("Could not subscribe again")
+					return
+				}
+				continue
+			}
+			if err := s.publisher.Publish(s.ctx, topicID, s.pubsubMessage(m)); err != nil {
+				if s.ctx.Err() != nil {
+					return
+				}
+				logger.WithFields(log.Fields{
+					"error":     err.Error(),
+					"messageID": m.ID,
+					"topic":     topicID,
+				}).Error("Could not publish message to Pub/Sub")
+				mTotalPublishErrors.Add(1)
+				continue
+			}
+			mTotalPublishedMessages.Add(1)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *sink) pubsubMessage(m *protocol.Message) *pubsublib.Message {
+	attributes := map[string]string{
+		attributeMessageID: strconv.FormatUint(m.ID, 10),
+		attributePath:      string(m.Path),
+		attributeTime:      time.Unix(m.Time, 0).UTC().Format(time.RFC3339),
+	}
+	if m.UserID != "" {
+		attributes[attributeUserID] = m.UserID
+	}
+	return &pubsublib.Message{
+		Data:        m.Body,
+		Attributes:  attributes,
+		OrderingKey: s.orderingKey(m),
+	}
+}
+
+// orderingKey joins the values of the configured filter fields of the message, e.g. "user01/device01".
+// It is empty (no ordering) if the message has none of these fields.
+func (s *sink) orderingKey(m *protocol.Message) string {
+	var values []string
+	found := false
+	for _, key := range *s.config.OrderingKeys {
+		value := m.Filters[key]
+		if value != "" {
+			found = true
+		}
+		values = append(values, value)
+	}
+	if !found {
+		return ""
+	}
+	return strings.Join(values, "/")
+}
@@ -0,0 +1,16 @@
+package pubsub
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                      = metrics.NS("pubsub")
+	mTotalPublishedMessages = ns.NewInt("total_published_messages")
+	mTotalPublishErrors     = ns.NewInt("total_publish_errors")
+)
+
+func resetPubSubMetrics() {
+	mTotalPublishedMessages.Set(0)
+	mTotalPublishErrors.Set(0)
+}
@@ -0,0 +1,125 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pubsublib "cloud.google.com/go/pubsub"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+type published struct {
+	topicID string
+	message *pubsublib.Message
+}
+
+type fakePublisher struct {
+	sync.Mutex
+	messages []published
+	err      error
+	closed   bool
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, topicID string, m *pubsublib.Message) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, published{topicID, m})
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	p.Lock()
+	defer p.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *fakePublisher) published() []published {
+	p.Lock()
+	defer p.Unlock()
+	return p.messages
+}
+
+func testConfig(orderingKeys []string, topics ...string) Config {
+	enabled := true
+	project := "project"
+	credentialsFile := ""
+	return Config{
+		Enabled:         &enabled,
+		Project:         &project,
+		CredentialsFile: &credentialsFile,
+		Topics:          &topics,
+		OrderingKeys:    &orderingKeys,
+	}
+}
+
+func TestNew_InvalidTopic(t *testing.T) {
+	_, err := New(nil, &fakePublisher{}, testConfig(nil, "/foo"))
+	assert.Error(t, err)
+}
+
+func TestSink_Forward(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	var route *router.Route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo"), r.Path)
+		route = r
+	}).Return(nil, nil)
+
+	publisher := &fakePublisher{}
+	s, err := New(routerMock, publisher, testConfig([]string{"user_id"}, "/foo=guble-foo"))
+	a.NoError(err)
+	a.NoError(s.Start())
+
+	m := &protocol.Message{ID: 1, Path: "/foo/bar", UserID: "user01", Time: 1451236804, Body: []byte("hello")}
+	m.SetFilter("user_id", "user01")
+	route.Deliver(m, false)
+	time.Sleep(50 * time.Millisecond)
+
+	routerMock.EXPECT().Unsubscribe(route)
+	a.NoError(s.Stop())
+	a.True(publisher.closed)
+
+	messages := publisher.published()
+	if a.Len(messages, 1) {
+		a.Equal("guble-foo", messages[0].topicID)
+		a.Equal("hello", string(messages[0].message.Data))
+		a.Equal("user01", messages[0].message.OrderingKey)
+		a.Equal(map[string]string{
+			attributeMessageID: "1",
+			attributePath:      "/foo/bar",
+			attributeUserID:    "user01",
+			attributeTime:      "2015-12-27T17:20:04Z",
+		}, messages[0].message.Attributes)
+	}
+}
+
+func TestSink_OrderingKey(t *testing.T) {
+	a := assert.New(t)
+	s, err := New(nil, &fakePublisher{err: errors.New("unavailable")}, testConfig([]string{"user_id", "device_id"}))
+	a.NoError(err)
+
+	m := &protocol.Message{ID: 1, Path: "/foo"}
+	a.Equal("", s.orderingKey(m))
+
+	m.SetFilter("device_id", "device01")
+	a.Equal("/device01", s.orderingKey(m))
+
+	m.SetFilter("user_id", "user01")
+	a.Equal("user01/device01", s.orderingKey(m))
+}
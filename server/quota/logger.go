@@ -0,0 +1,7 @@
+package quota
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "quota")
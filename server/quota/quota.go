@@ -0,0 +1,255 @@
+package quota
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPrefix is the prefix of the endpoint returning the status of the quotas
+	DefaultPrefix = "/admin/quota"
+
+	// syncInterval is the interval of persisting the usages of the quotas
+	syncInterval = 5 * time.Second
+
+	usageSchema = "quota_usage"
+	dayFormat   = "2006-01-02"
+)
+
+// ErrQuotaExceeded is returned when a message exceeds the daily quota of its publisher.
+var ErrQuotaExceeded = errors.New("Daily quota exceeded")
+
+// Store is the persistence of the usages of the quotas, implemented by a kvstore.KVStore.
+type Store interface {
+	Put(schema, key string, value []byte) error
+	Get(schema, key string) (value []byte, exist bool, err error)
+}
+
+// Config is used for configuring the daily quotas of the publishers.
+type Config struct {
+	Enabled *bool
+	// Messages is the number of messages published per day by each user or API key (no limit if <= 0)
+	Messages *int64
+	// Bytes is the size of the bodies published per day by each user or API key (no limit if <= 0)
+	Bytes    *int64
+	Endpoint *string
+}
+
+// Usage is the usage of the quotas of a publisher for a day (UTC).
+type Usage struct {
+	Day      string `json:"day"`
+	Messages int64  `json:"messages"`
+	Bytes    int64  `json:"bytes"`
+
+	dirty bool
+}
+
+// Status is the usage and the limits of the quotas of a publisher, returned by the quota endpoint.
+type Status struct {
+	Identity      string    `json:"identity"`
+	Usage                   // the usage of the current day
+	MessagesLimit int64     `json:"messagesLimit,omitempty"`
+	BytesLimit    int64     `json:"bytesLimit,omitempty"`
+	Resets        time.Time `json:"resets"`
+}
+
+// Identity returns the identity of a publisher: "key:<hash of the API key>" if it has one,
+// otherwise "user:<user ID>", or "" if it is anonymous.
+// The API keys are hashed, since the identities are persisted.
+func Identity(apiKey, userID string) string {
+	if apiKey != "" {
+		hash := sha256.Sum256([]byte(apiKey))
+		return "key:" + hex.EncodeToString(hash[:16])
+	}
+	if userID != "" {
+		return "user:" + userID
+	}
+	return ""
+}
+
+// Quotas counts the messages and the bytes published by each identity per day, persisted in a store
+// so that they survive the restarts, and rejects the messages exceeding the limits.
+type Quotas struct {
+	store    Store
+	prefix   string
+	messages int64
+	bytes    int64
+	now      func() time.Time
+
+	mutex  sync.Mutex
+	usages map[string]*Usage
+
+	stopC chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New returns new Quotas persisted in the store, which have to be started.
+func New(store Store, config Config) *Quotas {
+	q := &Quotas{
+		store:  store,
+		prefix: DefaultPrefix,
+		now:    time.Now,
+		usages: make(map[string]*Usage),
+	}
+	if config.Messages != nil {
+		q.messages = *config.Messages
+	}
+	if config.Bytes != nil {
+		q.bytes = *config.Bytes
+	}
+	if config.Endpoint != nil && *config.Endpoint != "" {
+		q.prefix = *config.Endpoint
+	}
+	return q
+}
+
+// Start begins persisting the usages periodically.
+func (q *Quotas) Start() error {
+	q.stopC = make(chan struct{})
+	q.wg.Add(1)
+	go q.loop()
+	return nil
+}
+
+// Stop persists the last usages.
+func (q *Quotas) Stop() error {
+	if q.stopC == nil {
+		return nil
+	}
+	close(q.stopC)
+	q.wg.Wait()
+	q.stopC = nil
+	q.sync()
+	return nil
+}
+
+func (q *Quotas) loop() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.sync()
+		case <-q.stopC:
+			return
+		}
+	}
+}
+
+// sync persists the changed usages, and forgets the usages of the past days.
+func (q *Quotas) sync() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	today := q.now().UTC().Format(dayFormat)
+	for identity, u := range q.usages {
+		if u.dirty {
+			data, _ := json.Marshal(u)
+			if err := q.store.Put(usageSchema, identity, data); err != nil {
+				logger.WithError(err).WithField("identity", identity).Error("Could not persist the usage of the quota")
+				mTotalStoreFailures.Add(1)
+				continue
+			}
+			u.dirty = false
+		}
+		if u.Day != today {
+			delete(q.usages, identity)
+		}
+	}
+}
+
+// usage returns the usage of the identity for the day, loaded from the store if needed; the mutex has to be locked.
+func (q *Quotas) usage(identity, day string) *Usage {
+	u, ok := q.usages[identity]
+	if !ok {
+		u = &Usage{}
+		if data, exist, err := q.store.Get(usageSchema, identity); err != nil {
+			logger.WithError(err).WithField("identity", identity).Error("Could not read the usage of the quota")
+			mTotalStoreFailures.Add(1)
+		} else if exist {
+			if err := json.Unmarshal(data, u); err != nil {
+				logger.WithError(err).WithField("identity", identity).Error("Invalid usage of the quota")
+			}
+		}
+		q.usages[identity] = u
+	}
+	if u.Day != day {
+		u.Day, u.Messages, u.Bytes, u.dirty = day, 0, 0, true
+	}
+	return u
+}
+
+// Use counts a message of the size published by the identity, or returns ErrQuotaExceeded
+// if it exceeds one of the daily quotas (the message is not counted then).
+func (q *Quotas) Use(identity string, size int) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	u := q.usage(identity, q.now().UTC().Format(dayFormat))
+	if (q.messages > 0 && u.Messages+1 > q.messages) || (q.bytes > 0 && u.Bytes+int64(size) > q.bytes) {
+		mTotalExceeded.Add(1)
+		return ErrQuotaExceeded
+	}
+	u.Messages++
+	u.Bytes += int64(size)
+	u.dirty = true
+	return nil
+}
+
+// Status returns the usage and the limits of the quotas of the identity.
+func (q *Quotas) Status(identity string) Status {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := q.now().UTC()
+	u := q.usage(identity, now.Format(dayFormat))
+	y, m, d := now.Date()
+	return Status{
+		Identity:      identity,
+		Usage:         *u,
+		MessagesLimit: q.messages,
+		BytesLimit:    q.bytes,
+		Resets:        time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// GetPrefix returns the prefix of the quota endpoint.
+func (q *Quotas) GetPrefix() string {
+	return q.prefix
+}
+
+// ServeHTTP returns the status of the quotas of a user on GET <prefix>/user/<user ID>,
+// or of an API key on GET <prefix>/key/<API key>.
+func (q *Quotas) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if req.Method != http.MethodGet {
+		http.Error(w, `{"error":"only HTTP GET is accepted"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(req.URL.Path, q.prefix), "/"), "/", 2)
+	var identity string
+	if len(parts) == 2 && parts[1] != "" {
+		switch parts[0] {
+		case "user":
+			identity = Identity("", parts[1])
+		case "key":
+			identity = Identity(parts[1], "")
+		}
+	}
+	if identity == "" {
+		http.Error(w, `{"error":"expected /user/<user ID> or /key/<API key>"}`, http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(q.Status(identity)); err != nil {
+		logger.WithError(err).Error("Error encoding data.")
+	}
+}
@@ -0,0 +1,11 @@
+package quota
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                  = metrics.NS("quota")
+	mTotalExceeded      = ns.NewInt("total_exceeded")
+	mTotalStoreFailures = ns.NewInt("total_store_failures")
+)
@@ -0,0 +1,104 @@
+package quota
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/server/kvstore"
+)
+
+func testQuotas(store Store, messages, bytes int64) (*Quotas, *time.Time) {
+	now := time.Date(2026, 10, 15, 23, 0, 0, 0, time.UTC)
+	q := New(store, Config{Messages: &messages, Bytes: &bytes})
+	q.now = func() time.Time { return now }
+	return q, &now
+}
+
+func TestIdentity(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("user:marvin", Identity("", "marvin"))
+	a.Equal("", Identity("", ""))
+	key := Identity("secret-key", "marvin")
+	a.Len(key, len("key:")+32)
+	a.NotContains(key, "secret-key")
+	a.Equal(key, Identity("secret-key", ""))
+}
+
+func TestQuotas_Use(t *testing.T) {
+	a := assert.New(t)
+	q, now := testQuotas(kvstore.NewMemoryKVStore(), 3, 10)
+
+	a.NoError(q.Use("user:marvin", 4))
+	a.NoError(q.Use("user:marvin", 4))
+	// exceeding the bytes
+	a.Equal(ErrQuotaExceeded, q.Use("user:marvin", 4))
+	a.NoError(q.Use("user:marvin", 2))
+	// exceeding the messages
+	a.Equal(ErrQuotaExceeded, q.Use("user:marvin", 0))
+
+	// the other identities have their own quotas
+	a.NoError(q.Use("user:other", 10))
+
+	// the quotas are reset each day
+	*now = now.Add(2 * time.Hour)
+	a.NoError(q.Use("user:marvin", 10))
+	status := q.Status("user:marvin")
+	a.Equal("2026-10-16", status.Day)
+	a.Equal(int64(1), status.Messages)
+	a.Equal(int64(10), status.Bytes)
+	a.Equal(time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), status.Resets)
+}
+
+func TestQuotas_SurviveRestarts(t *testing.T) {
+	a := assert.New(t)
+	store := kvstore.NewMemoryKVStore()
+
+	q, _ := testQuotas(store, 2, 0)
+	a.NoError(q.Start())
+	a.NoError(q.Use("user:marvin", 100))
+	a.NoError(q.Use("user:marvin", 100))
+	a.NoError(q.Stop())
+
+	restarted, now := testQuotas(store, 2, 0)
+	a.Equal(ErrQuotaExceeded, restarted.Use("user:marvin", 1))
+
+	*now = now.Add(24 * time.Hour)
+	a.NoError(restarted.Use("user:marvin", 1))
+}
+
+func TestQuotas_ServeHTTP(t *testing.T) {
+	a := assert.New(t)
+	q, _ := testQuotas(kvstore.NewMemoryKVStore(), 100, 0)
+	a.NoError(q.Use(Identity("", "marvin"), 5))
+	a.NoError(q.Use(Identity("marvins-key", ""), 7))
+
+	get := func(path string) (int, Status) {
+		w := httptest.NewRecorder()
+		q.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var status Status
+		json.Unmarshal(w.Body.Bytes(), &status)
+		return w.Code, status
+	}
+
+	code, status := get("/admin/quota/user/marvin")
+	a.Equal(http.StatusOK, code)
+	a.Equal("user:marvin", status.Identity)
+	a.Equal(int64(1), status.Messages)
+	a.Equal(int64(5), status.Bytes)
+	a.Equal(int64(100), status.MessagesLimit)
+
+	code, status = get("/admin/quota/key/marvins-key")
+	a.Equal(http.StatusOK, code)
+	a.Equal(int64(7), status.Bytes)
+
+	code, _ = get("/admin/quota/other/marvin")
+	a.Equal(http.StatusNotFound, code)
+	code, _ = get("/admin/quota/user/")
+	a.Equal(http.StatusNotFound, code)
+}
@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	redislib "github.com/garyburd/redigo/redis"
+)
+
+const maxIdleConns = 10
+
+var errClosed = errors.New("Redis client is closed")
+
+// Client is the subset of the Redis commands used by the bridge.
+type Client interface {
+	Publish(channel string, data []byte) error
+
+	// Subscribe subscribes to the channel patterns and calls the handler for each received message.
+	// It blocks until the subscription fails or the Client is closed.
+	Subscribe(patterns []string, handler func(channel string, data []byte)) error
+
+	Close() error
+}
+
+// Dialer returns a Client of the Redis server given in the Config.
+type Dialer func(Config) (Client, error)
+
+type client struct {
+	pool *redislib.Pool
+
+	mu     sync.Mutex
+	psc    *redislib.PubSubConn
+	closed bool
+}
+
+// Dial is the default Dialer: the messages are published using a pool of connections,
+// and each subscription uses its own connection.
+func Dial(config Config) (Client, error) {
+	url := *config.URL
+	dial := func() (redislib.Conn, error) {
+		return redislib.DialURL(url, redislib.DialConnectTimeout(5*time.Second))
+	}
+
+	// fail early if the server is not reachable
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+
+	return &client{pool: &redislib.Pool{
+		Dial:        dial,
+		MaxIdle:     maxIdleConns,
+		IdleTimeout: 5 * time.Minute,
+	}}, nil
+}
+
+func (c *client) Publish(channel string, data []byte) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("PUBLISH", channel, data)
+	return err
+}
+
+func (c *client) Subscribe(patterns []string, handler func(channel string, data []byte)) error {
+	conn := c.pool.Get()
+	psc := &redislib.PubSubConn{Conn: conn}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return errClosed
+	}
+	c.psc = psc
+	c.mu.Unlock()
+	defer psc.Close()
+
+	args := make([]interface{}, len(patterns))
+	for i, p := range patterns {
+		args[i] = p
+	}
+	if err := psc.PSubscribe(args...); err != nil {
+		return err
+	}
+	for {
+		switch v := psc.Receive().(type) {
+		case redislib.Message:
+			handler(v.Channel, v.Data)
+		case error:
+			return v
+		}
+	}
+}
+
+// Close closes the pool and the connection of the current subscription, if any.
+func (c *client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	if c.psc != nil {
+		c.psc.Close()
+	}
+	c.mu.Unlock()
+	return c.pool.Close()
+}
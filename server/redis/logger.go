@@ -0,0 +1,7 @@
+package redis
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "redis")
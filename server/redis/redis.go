@@ -0,0 +1,191 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/jpillora/backoff"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// bridgeID marks the messages published in guble by the bridge,
+	// so that they are not sent back to Redis.
+	bridgeID = "guble-redis-bridge"
+
+	defaultChannelSize = 1000
+)
+
+// Config is used for configuring the Redis pub/sub bridge.
+type Config struct {
+	Enabled *bool
+	URL     *string
+
+	// Topics are the guble topics which are republished on Redis channels.
+	Topics *[]string
+
+	// ChannelPrefix is prepended to the Redis channels of the republished messages.
+	ChannelPrefix *string
+
+	// Channels are the Redis channel patterns whose messages are published in guble (none disables this direction).
+	Channels *[]string
+
+	// TopicPrefix is prepended to the path of the messages coming from Redis.
+	TopicPrefix *string
+}
+
+type bridge struct {
+	config Config
+	router router.Router
+	dial   Dialer
+	client Client
+
+	routes []*router.Route
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// New returns a bridge between the guble router and the Redis server reached through the dialer.
+func New(router router.Router, dial Dialer, config Config) (*bridge, error) {
+	return &bridge{
+		config: config,
+		router: router,
+		dial:   dial,
+	}, nil
+}
+
+func (b *bridge) Start() error {
+	logger.Debug("Starting Redis bridge")
+	resetRedisMetrics()
+
+	client, err := b.dial(b.config)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("Could not connect to Redis")
+		return err
+	}
+	b.client = client
+
+	b.ctx, b.cancelFunc = context.WithCancel(context.Background())
+	b.routes = nil
+
+	for _, topic := range *b.config.Topics {
+		route := router.NewRoute(router.RouteConfig{
+			Path:        protocol.Path(topic),
+			ChannelSize: defaultChannelSize,
+		})
+		if _, err := b.router.Subscribe(route); err != nil {
+			b.cancelFunc()
+			client.Close()
+			return err
+		}
+		b.routes = append(b.routes, route)
+		b.wg.Add(1)
+		go b.forward(route)
+	}
+
+	if len(*b.config.Channels) > 0 {
+		b.wg.Add(1)
+		go b.subscribe()
+	}
+
+	logger.Debug("Started Redis bridge")
+	return nil
+}
+
+func (b *bridge) Stop() error {
+	logger.Debug("Stopping Redis bridge")
+	if b.cancelFunc == nil {
+		// the bridge is stopped after a failed connection as well
+		return nil
+	}
+	b.cancelFunc()
+	for _, route := range b.routes {
+		b.router.Unsubscribe(route)
+	}
+	err := b.client.Close()
+	b.wg.Wait()
+	logger.Debug("Stopped Redis bridge")
+	return err
+}
+
+// forward republishes on Redis the messages received by a guble route.
+func (b *bridge) forward(route *router.Route) {
+	defer b.wg.Done()
+	err := router.Forward(b.ctx, b.router, route, func(m *protocol.Message) {
+		if m.UserID == bridgeID {
+			return
+		}
+		if err := b.client.Publish(channel(*b.config.ChannelPrefix, m.Path), m.Body); err != nil {
+			logger.WithFields(log.Fields{
+				"error":   err.Error(),
+				"message": m.ID,
+			}).Error("Could not publish message to Redis")
+			mTotalPublishErrors.Add(1)
+			return
+		}
+		mTotalPublishedMessages.Add(1)
+	})
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("Could not subscribe again")
+	}
+}
+
+// subscribe receives the messages of the configured channel patterns, subscribing again when needed.
+func (b *bridge) subscribe() {
+	defer b.wg.Done()
+	bo := &backoff.Backoff{Min: 100 * time.Millisecond, Max: 30 * time.Second, Factor: 2}
+
+	for {
+		start := time.Now()
+		err := b.client.Subscribe(*b.config.Channels, b.receive)
+		if b.ctx.Err() != nil {
+			return
+		}
+		logger.WithField("error", err).Error("Redis subscription failed")
+		if time.Since(start) > bo.Max {
+			bo.Reset()
+		}
+
+		select {
+		case <-time.After(bo.Duration()):
+		case <-b.ctx.Done():
+			return
+		}
+		mTotalResubscriptions.Add(1)
+	}
+}
+
+// receive publishes in guble a message coming from Redis.
+func (b *bridge) receive(channel string, data []byte) {
+	m := &protocol.Message{
+		Path:   topicPath(*b.config.TopicPrefix, channel),
+		UserID: bridgeID,
+		Body:   data,
+	}
+	if err := b.router.HandleMessage(m); err != nil {
+		logger.WithFields(log.Fields{
+			"error":   err.Error(),
+			"channel": channel,
+		}).Error("Could not handle message from Redis")
+		mTotalReceiveErrors.Add(1)
+		return
+	}
+	mTotalReceivedMessages.Add(1)
+}
+
+// channel converts a guble path to a Redis channel (under the given prefix): /foo/bar becomes prefix:foo:bar
+func channel(prefix string, p protocol.Path) string {
+	return prefix + strings.Replace(p.RemovePrefixSlash(), "/", ":", -1)
+}
+
+// topicPath converts a Redis channel to a guble path (under the given prefix): foo:bar becomes /prefix/foo/bar
+func topicPath(prefix, channel string) protocol.Path {
+	return protocol.Path(strings.TrimRight(prefix, "/") + "/" + strings.Replace(channel, ":", "/", -1))
+}
@@ -0,0 +1,22 @@
+package redis
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                      = metrics.NS("redis")
+	mTotalPublishedMessages = ns.NewInt("total_published_messages")
+	mTotalPublishErrors     = ns.NewInt("total_publish_errors")
+	mTotalReceivedMessages  = ns.NewInt("total_received_messages")
+	mTotalReceiveErrors     = ns.NewInt("total_receive_errors")
+	mTotalResubscriptions   = ns.NewInt("total_resubscriptions")
+)
+
+func resetRedisMetrics() {
+	mTotalPublishedMessages.Set(0)
+	mTotalPublishErrors.Set(0)
+	mTotalReceivedMessages.Set(0)
+	mTotalReceiveErrors.Set(0)
+	mTotalResubscriptions.Set(0)
+}
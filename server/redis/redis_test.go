@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+type published struct {
+	channel string
+	data    []byte
+}
+
+type fakeClient struct {
+	publishedC     chan published
+	subscriptionsC chan func(channel string, data []byte)
+	closeC         chan bool
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		publishedC:     make(chan published, 10),
+		subscriptionsC: make(chan func(channel string, data []byte), 10),
+		closeC:         make(chan bool),
+	}
+}
+
+func (c *fakeClient) Publish(channel string, data []byte) error {
+	c.publishedC <- published{channel, data}
+	return nil
+}
+
+func (c *fakeClient) Subscribe(patterns []string, handler func(channel string, data []byte)) error {
+	c.subscriptionsC <- handler
+	<-c.closeC
+	return errors.New("connection closed")
+}
+
+func (c *fakeClient) Close() error {
+	close(c.closeC)
+	return nil
+}
+
+func testConfig(topics, channels []string) Config {
+	enabled := true
+	url := "redis://localhost:6379"
+	channelPrefix := "guble:"
+	topicPrefix := "/redis"
+	return Config{
+		Enabled:       &enabled,
+		URL:           &url,
+		Topics:        &topics,
+		ChannelPrefix: &channelPrefix,
+		Channels:      &channels,
+		TopicPrefix:   &topicPrefix,
+	}
+}
+
+func TestChannelAndTopicPath(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("foo:bar", channel("", protocol.Path("/foo/bar")))
+	a.Equal("guble:foo", channel("guble:", protocol.Path("/foo")))
+	a.Equal(protocol.Path("/redis/foo/bar"), topicPath("/redis", "foo:bar"))
+	a.Equal(protocol.Path("/redis/foo"), topicPath("/redis/", "foo"))
+	a.Equal(protocol.Path("/foo"), topicPath("", "foo"))
+}
+
+func TestBridge_StartFailsWhenDialFails(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	dialErr := errors.New("connection refused")
+
+	b, err := New(routerMock, func(Config) (Client, error) { return nil, dialErr }, testConfig([]string{"/foo"}, nil))
+	a.NoError(err)
+	a.Equal(dialErr, b.Start())
+
+	// the service is stopped after its failed start
+	a.NoError(b.Stop())
+}
+
+func TestBridge_RepublishesGubleMessages(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	client := newFakeClient()
+	routerMock := NewMockRouter(testutil.MockCtrl)
+
+	var route *router.Route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo"), r.Path)
+		route = r
+	}).Return(nil, nil)
+
+	b, err := New(routerMock, func(Config) (Client, error) { return client, nil }, testConfig([]string{"/foo"}, nil))
+	a.NoError(err)
+	a.NoError(b.Start())
+
+	a.NoError(route.Deliver(&protocol.Message{ID: 42, Path: "/foo/bar", Body: []byte("hello")}, false))
+	// messages coming from the bridge itself are not published back
+	a.NoError(route.Deliver(&protocol.Message{ID: 43, Path: "/foo/bar", UserID: bridgeID}, false))
+
+	select {
+	case p := <-client.publishedC:
+		a.Equal("guble:foo:bar", p.channel)
+		a.Equal([]byte("hello"), p.data)
+	case <-time.After(time.Second):
+		a.Fail("message was not published")
+	}
+
+	routerMock.EXPECT().Unsubscribe(route)
+	a.NoError(b.Stop())
+	a.Len(client.publishedC, 0)
+}
+
+func TestBridge_ReceivesRedisMessages(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	client := newFakeClient()
+	routerMock := NewMockRouter(testutil.MockCtrl)
+
+	b, err := New(routerMock, func(Config) (Client, error) { return client, nil }, testConfig(nil, []string{"orders:*"}))
+	a.NoError(err)
+	a.NoError(b.Start())
+
+	var handler func(channel string, data []byte)
+	select {
+	case handler = <-client.subscriptionsC:
+	case <-time.After(time.Second):
+		a.FailNow("bridge did not subscribe")
+	}
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/redis/orders/created"), m.Path)
+		a.Equal(bridgeID, m.UserID)
+		a.Equal([]byte("hello"), m.Body)
+	}).Return(nil)
+	handler("orders:created", []byte("hello"))
+
+	a.NoError(b.Stop())
+}
@@ -0,0 +1,170 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smancke/guble/server/webserver"
+)
+
+// The CORS policy applies to the browser apps calling the REST API from other origins.
+var (
+	// DefaultCORSMethods are the methods allowed by default to the other origins
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodHead}
+
+	// DefaultCORSHeaders are the request headers allowed by default; a trailing "*" allows a prefix,
+	// e.g. the headers set in the message header
+	DefaultCORSHeaders = []string{"Authorization", "Content-Type", webserver.APIKeyHeader, webserver.RequestIDHeader,
+		SignatureHeader, "X-Guble-*"}
+
+	// corsExposedHeaders are the response headers readable by the browser apps
+	corsExposedHeaders = strings.Join([]string{webserver.RequestIDHeader, "Retry-After"}, ", ")
+)
+
+// CORSConfig is used for configuring the cross-origin requests to the REST API.
+type CORSConfig struct {
+	// AllowedOrigins are the origins of the browser apps, or "*" for all of them; CORS is disabled if it is empty
+	AllowedOrigins *[]string
+	// AllowedMethods are the allowed methods (DefaultCORSMethods if empty)
+	AllowedMethods *[]string
+	// AllowedHeaders are the allowed request headers (DefaultCORSHeaders if empty)
+	AllowedHeaders *[]string
+	// MaxAge is the duration of caching the preflight responses by the browsers (not sent if 0)
+	MaxAge *time.Duration
+	// AllowCredentials allows the requests with cookies or HTTP authentication
+	AllowCredentials *bool
+}
+
+// corsPolicy sets the CORS headers of the responses to the allowed origins, and answers the preflight requests.
+type corsPolicy struct {
+	origins          []string
+	methods          []string
+	headers          []string
+	maxAge           time.Duration
+	allowCredentials bool
+}
+
+func newCORSPolicy(config CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		methods: DefaultCORSMethods,
+		headers: DefaultCORSHeaders,
+	}
+	if config.AllowedOrigins != nil {
+		p.origins = nonEmpty(*config.AllowedOrigins)
+	}
+	if config.AllowedMethods != nil && len(nonEmpty(*config.AllowedMethods)) > 0 {
+		p.methods = nil
+		for _, method := range nonEmpty(*config.AllowedMethods) {
+			p.methods = append(p.methods, strings.ToUpper(method))
+		}
+	}
+	if config.AllowedHeaders != nil && len(nonEmpty(*config.AllowedHeaders)) > 0 {
+		p.headers = nonEmpty(*config.AllowedHeaders)
+	}
+	if config.MaxAge != nil {
+		p.maxAge = *config.MaxAge
+	}
+	if config.AllowCredentials != nil {
+		p.allowCredentials = *config.AllowCredentials
+	}
+	return p
+}
+
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// originAllowed returns if the origin is allowed, and if it is listed explicitly (not only allowed by "*").
+func (p *corsPolicy) originAllowed(origin string) (allowed bool, listed bool) {
+	for _, o := range p.origins {
+		if strings.EqualFold(o, origin) {
+			return true, true
+		}
+		allowed = allowed || o == "*"
+	}
+	return allowed, false
+}
+
+func (p *corsPolicy) methodAllowed(method string) bool {
+	for _, allowed := range p.methods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) headerAllowed(header string) bool {
+	for _, allowed := range p.headers {
+		if allowed == "*" || strings.EqualFold(allowed, header) {
+			return true
+		}
+		if strings.HasSuffix(allowed, "*") &&
+			strings.HasPrefix(strings.ToLower(header), strings.ToLower(strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// handle sets the CORS headers of the response to a request from an allowed origin,
+// and returns true if the request was a preflight request, which is answered.
+func (p *corsPolicy) handle(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	requestedMethod := r.Header.Get("Access-Control-Request-Method")
+	preflight := r.Method == http.MethodOptions && requestedMethod != ""
+	allowed, listed := p.originAllowed(origin)
+	if origin == "" || !allowed {
+		if preflight {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		return preflight
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Set("Access-Control-Allow-Origin", origin)
+	// the credentials are not allowed to the origins allowed only by "*"
+	if p.allowCredentials && listed {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		return false
+	}
+
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if !p.methodAllowed(requestedMethod) {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	var headers []string
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if header = strings.TrimSpace(header); header == "" {
+			continue
+		}
+		if !p.headerAllowed(header) {
+			w.WriteHeader(http.StatusForbidden)
+			return true
+		}
+		headers = append(headers, header)
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+	if len(headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if p.maxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/testutil"
+)
+
+func corsRequest(api *RestMessageAPI, method, origin string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/message/my/topic?userId=marvin", bytes.NewReader(testBytes))
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	maxAge := 10 * time.Minute
+	api := NewRestMessageAPI(NewMockRouter(ctrl), "/api").
+		WithCORS(CORSConfig{AllowedOrigins: &[]string{"https://app.example.com"}, MaxAge: &maxAge})
+
+	w := corsRequest(api, http.MethodOptions, "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type, x-guble-encryption-key-id",
+	})
+	a.Equal(http.StatusNoContent, w.Code)
+	a.Equal("https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	a.Equal("GET, POST, HEAD", w.Header().Get("Access-Control-Allow-Methods"))
+	a.Equal("content-type, x-guble-encryption-key-id", w.Header().Get("Access-Control-Allow-Headers"))
+	a.Equal("600", w.Header().Get("Access-Control-Max-Age"))
+	a.Empty(w.Header().Get("Access-Control-Allow-Credentials"))
+
+	// not allowed: the origin, the method or a header
+	w = corsRequest(api, http.MethodOptions, "https://evil.example.com", map[string]string{"Access-Control-Request-Method": "POST"})
+	a.Equal(http.StatusForbidden, w.Code)
+	a.Empty(w.Header().Get("Access-Control-Allow-Origin"))
+	w = corsRequest(api, http.MethodOptions, "https://app.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"})
+	a.Equal(http.StatusForbidden, w.Code)
+	w = corsRequest(api, http.MethodOptions, "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "X-Other",
+	})
+	a.Equal(http.StatusForbidden, w.Code)
+}
+
+func TestCORS_Request(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	credentials := true
+	api := NewRestMessageAPI(routerMock, "/api").
+		WithCORS(CORSConfig{AllowedOrigins: &[]string{"*", "https://app.example.com"}, AllowCredentials: &credentials})
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Times(3)
+
+	w := corsRequest(api, http.MethodPost, "https://app.example.com", nil)
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	a.Equal("true", w.Header().Get("Access-Control-Allow-Credentials"))
+	a.Equal("X-Request-ID, Retry-After", w.Header().Get("Access-Control-Expose-Headers"))
+
+	// the credentials are allowed only to the listed origins
+	w = corsRequest(api, http.MethodPost, "https://other.example.com", nil)
+	a.Equal("https://other.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	a.Empty(w.Header().Get("Access-Control-Allow-Credentials"))
+
+	// the requests without origin are not changed
+	w = corsRequest(api, http.MethodPost, "", nil)
+	a.Equal(http.StatusOK, w.Code)
+	a.Empty(w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_Disabled(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	api := NewRestMessageAPI(NewMockRouter(ctrl), "/api").WithCORS(CORSConfig{AllowedOrigins: &[]string{""}})
+	assert.Nil(t, api.cors)
+}
@@ -7,11 +7,17 @@ import (
 	"github.com/azer/snakecase"
 
 	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/audit"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/quota"
 	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/tracing"
+	"github.com/smancke/guble/server/webserver"
 
 	"github.com/rs/xid"
 
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -23,19 +29,74 @@ const (
 	xHeaderPrefix     = "x-guble-"
 	filterPrefix      = "filter"
 	subscribersPrefix = "/subscribers"
+
+	// requestIDHeaderField is the field of the message header with the correlation ID of the publishing request
+	requestIDHeaderField = "requestID"
 )
 
 var errNotFound = errors.New("Not Found.")
 
 // RestMessageAPI is a struct representing a router's connector for a REST API.
 type RestMessageAPI struct {
-	router router.Router
-	prefix string
+	router         router.Router
+	prefix         string
+	tokenValidator auth.TokenValidator
+	messageLimiter MessageLimiter
+	messageQuota   MessageQuota
+	signatures     *signatureVerifier
+	cors           *corsPolicy
+}
+
+// MessageLimiter limits the rate of the messages published by each identity, implemented by a webserver.RateLimiter.
+type MessageLimiter interface {
+	AllowMessage(identity string) bool
+}
+
+// MessageQuota counts the messages published by each identity against their daily quotas, implemented by quota.Quotas.
+type MessageQuota interface {
+	Use(identity string, size int) error
 }
 
 // NewRestMessageAPI returns a new RestMessageAPI.
 func NewRestMessageAPI(router router.Router, prefix string) *RestMessageAPI {
-	return &RestMessageAPI{router, prefix}
+	return &RestMessageAPI{router: router, prefix: prefix}
+}
+
+// WithTokenValidator requires a valid bearer token for publishing, and binds the subject of the token
+// to the user ID of the published messages.
+func (api *RestMessageAPI) WithTokenValidator(v auth.TokenValidator) *RestMessageAPI {
+	api.tokenValidator = v
+	return api
+}
+
+// WithSignatures verifies the HMAC signatures of the publishing requests, if the config has secrets.
+// The signed requests are trusted with their user ID; the other ones are rejected if the signatures are required.
+func (api *RestMessageAPI) WithSignatures(config SignatureConfig) *RestMessageAPI {
+	if config.Secrets != nil && len(*config.Secrets) > 0 {
+		api.signatures = newSignatureVerifier(config)
+	}
+	return api
+}
+
+// WithCORS allows the cross-origin requests of the browser apps, if the config has allowed origins.
+func (api *RestMessageAPI) WithCORS(config CORSConfig) *RestMessageAPI {
+	if config.AllowedOrigins != nil && len(nonEmpty(*config.AllowedOrigins)) > 0 {
+		api.cors = newCORSPolicy(config)
+	}
+	return api
+}
+
+// WithMessageLimiter limits the rate of the published messages, by the identity of the requests
+// given by the webserver.RateLimiter handling them.
+func (api *RestMessageAPI) WithMessageLimiter(l MessageLimiter) *RestMessageAPI {
+	api.messageLimiter = l
+	return api
+}
+
+// WithMessageQuota counts the published messages against the daily quotas of their API key or user.
+func (api *RestMessageAPI) WithMessageQuota(q MessageQuota) *RestMessageAPI {
+	api.messageQuota = q
+	return api
 }
 
 // GetPrefix returns the prefix.
@@ -47,6 +108,9 @@ func (api *RestMessageAPI) GetPrefix() string {
 // ServeHTTP is an http.Handler.
 // It is a part of the service.endpoint implementation.
 func (api *RestMessageAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if api.cors != nil && api.cors.handle(w, r) {
+		return
+	}
 	if r.Method == http.MethodHead {
 		return
 	}
@@ -54,6 +118,11 @@ func (api *RestMessageAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		log.WithField("url", r.URL.Path).Debug("GET")
 
+		if topic, err := api.extractTopic(r.URL.Path, streamPrefix); err == nil {
+			api.serveStream(w, r, topic)
+			return
+		}
+
 		topic, err := api.extractTopic(r.URL.Path, subscribersPrefix)
 		if err != nil {
 			log.WithError(err).Error("Extracting topic failed")
@@ -88,6 +157,19 @@ func (api *RestMessageAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	claimedUserID := q(r, "userId")
+	userID, err := api.authenticate(r, claimedUserID, body)
+	if err != nil {
+		log.WithError(err).WithField("userID", claimedUserID).Info("Rejected the publishing request")
+		audit.Record(audit.Event{Type: audit.AuthFailure, UserID: claimedUserID, RemoteAddr: r.RemoteAddr, URL: r.URL.Path})
+		http.Error(w, err.Error(), auth.AuthenticationStatus(err))
+		return
+	}
+	if identity := webserver.RateLimitIdentity(r); api.messageLimiter != nil && identity != "" && !api.messageLimiter.AllowMessage(identity) {
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
 	topic, err := api.extractTopic(r.URL.Path, "/message")
 	if err != nil {
 		if err == errNotFound {
@@ -101,18 +183,74 @@ func (api *RestMessageAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	msg := &protocol.Message{
 		Path:          protocol.Path(topic),
 		Body:          body,
-		UserID:        q(r, "userId"),
+		UserID:        userID,
 		ApplicationID: xid.New().String(),
 		HeaderJSON:    headersToJSON(r.Header),
 	}
+	if err := msg.ValidateEncryption(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if identity := quota.Identity(r.Header.Get(webserver.APIKeyHeader), userID); api.messageQuota != nil && identity != "" {
+		if err := api.messageQuota.Use(identity, len(body)); err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+	}
 
 	// add filters
 	api.setFilters(r, msg)
 
-	api.router.HandleMessage(msg)
+	if id := webserver.RequestID(r); id != "" {
+		if err := msg.SetHeader(requestIDHeaderField, id); err != nil {
+			log.WithError(err).Debug("Can not add the request ID to an invalid message header")
+		}
+	}
+
+	span := tracing.StartSpan("rest.publish", tracing.FromRequest(r))
+	span.SetAttribute("topic", topic)
+	tracing.ToMessage(msg, span.Context())
+
+	err = api.router.HandleMessage(msg)
+	span.SetError(err)
+	span.End()
+	if r.Header.Get("Accept") == "application/json" {
+		api.writeReceipt(w, msg, q(r, "messageId"), err)
+		return
+	}
 	fmt.Fprintf(w, "OK")
 }
 
+// writeReceipt writes the receipt of the published message as JSON, for the clients asking for it
+// (e.g. the REST transport of the Go client) with the messageId query parameter, or the error of the router.
+func (api *RestMessageAPI) writeReceipt(w http.ResponseWriter, msg *protocol.Message, publisherMessageID string, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&protocol.SendReceipt{
+		SequenceID:            msg.ID,
+		Path:                  string(msg.Path),
+		PublisherMessageID:    publisherMessageID,
+		MessagePublishingTime: msg.Time,
+	})
+}
+
+// authenticate returns the user ID of the publishing request: the claimed one if the request is signed,
+// otherwise the one authenticated by its client certificate or its bearer token (if required).
+func (api *RestMessageAPI) authenticate(r *http.Request, userID string, body []byte) (string, error) {
+	if api.signatures != nil {
+		if header := r.Header.Get(SignatureHeader); header != "" || api.signatures.required {
+			if err := api.signatures.verify(header, r.Method, r.URL, body); err != nil {
+				return "", err
+			}
+			return userID, nil
+		}
+	}
+	return auth.Authenticate(api.tokenValidator, r, userID)
+}
+
 func (api *RestMessageAPI) extractTopic(path string, requestTypeTopicPrefix string) (string, error) {
 	p := removeTrailingSlash(api.prefix) + requestTypeTopicPrefix
 	if !strings.HasPrefix(path, p) {
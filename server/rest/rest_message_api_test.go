@@ -2,6 +2,10 @@ package rest
 
 import (
 	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/quota"
+	"github.com/smancke/guble/server/webserver"
 	"github.com/smancke/guble/testutil"
 
 	"github.com/golang/mock/gomock"
@@ -223,3 +227,137 @@ func TestRestMessageAPI_SetFiltersWhenServing(t *testing.T) {
 
 	time.Sleep(10 * time.Millisecond)
 }
+
+// testTokenValidator accepts the tokens mapped to their subject
+type testTokenValidator map[string]string
+
+func (v testTokenValidator) Validate(token string) (*auth.Claims, error) {
+	subject, ok := v[token]
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Claims{Subject: subject}, nil
+}
+
+type testMessageLimiter struct {
+	messages int
+}
+
+func (l *testMessageLimiter) AllowMessage(identity string) bool {
+	if l.messages == 0 {
+		return false
+	}
+	l.messages--
+	return true
+}
+
+func TestServeHTTP_MessagesRateLimited(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	api := NewRestMessageAPI(routerMock, "/api").WithMessageLimiter(&testMessageLimiter{messages: 1})
+	limiter := webserver.NewRateLimiter(webserver.RateLimitConfig{})
+	handler := limiter.Handler(api)
+
+	post := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/message/my/topic", bytes.NewReader(testBytes))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	routerMock.EXPECT().HandleMessage(gomock.Any())
+	a.Equal(http.StatusOK, post())
+	a.Equal(http.StatusTooManyRequests, post())
+}
+
+func TestServeHTTP_QuotaExceeded(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	messages := int64(1)
+	quotas := quota.New(kvstore.NewMemoryKVStore(), quota.Config{Messages: &messages})
+	api := NewRestMessageAPI(routerMock, "/api").WithMessageQuota(quotas)
+
+	post := func(userID, apiKey string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/message/my/topic?userId="+userID, bytes.NewReader(testBytes))
+		if apiKey != "" {
+			req.Header.Set(webserver.APIKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Times(3)
+	a.Equal(http.StatusOK, post("marvin", ""))
+	a.Equal(http.StatusTooManyRequests, post("marvin", ""))
+
+	// each user and API key has its own quota, and the anonymous messages have none
+	a.Equal(http.StatusOK, post("marvin", "marvins-key"))
+	a.Equal(http.StatusTooManyRequests, post("other", "marvins-key"))
+	a.Equal(http.StatusOK, post("", ""))
+	a.Equal(int64(1), quotas.Status(quota.Identity("", "marvin")).Messages)
+}
+
+func TestServeHTTP_EncryptedMessage(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	api := NewRestMessageAPI(routerMock, "/api")
+
+	post := func(headers map[string]string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/message/my/topic", bytes.NewReader([]byte{0x00, '\n', 0xff}))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	a.Equal(http.StatusBadRequest, post(map[string]string{"X-Guble-Encryption-Algorithm": "A256GCM"}))
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(msg *protocol.Message) {
+		a.Equal([]byte{0x00, '\n', 0xff}, msg.Body)
+		a.Equal(&protocol.Encryption{KeyID: "team-a-2024", Algorithm: "A256GCM"}, msg.Encryption())
+	})
+	a.Equal(http.StatusOK, post(map[string]string{
+		"X-Guble-Encryption-Key-Id":    "team-a-2024",
+		"X-Guble-Encryption-Algorithm": "A256GCM",
+	}))
+}
+
+func TestServeHTTP_TokenRequired(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	api := NewRestMessageAPI(routerMock, "/api").WithTokenValidator(testTokenValidator{"token": "marvin"})
+
+	post := func(url, token string) int {
+		req := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(testBytes))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	a.Equal(http.StatusUnauthorized, post("/api/message/my/topic", ""))
+	a.Equal(http.StatusUnauthorized, post("/api/message/my/topic", "invalid"))
+	a.Equal(http.StatusForbidden, post("/api/message/my/topic?userId=arthur", "token"))
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(msg *protocol.Message) {
+		a.Equal("marvin", msg.UserID)
+	})
+	a.Equal(http.StatusOK, post("/api/message/my/topic", "token"))
+}
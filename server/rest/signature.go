@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader is the header of the signed publishing requests: "t=<unix timestamp>,v1=<hex HMAC-SHA256>",
+	// where the HMAC of the lines "<unix timestamp>", "<method>", "<path>", "<canonical query>" and "<body>"
+	// is keyed with a shared secret; the canonical query has its parameters sorted by key.
+	// It has not the prefix X-Guble-, whose headers are copied in the message header.
+	SignatureHeader = "Guble-Signature"
+
+	// DefaultSignatureTolerance is the maximum age of the timestamp of a signed request
+	DefaultSignatureTolerance = 5 * time.Minute
+)
+
+var (
+	ErrMissingSignature = errors.New("The signature of the request is missing")
+	ErrInvalidSignature = errors.New("The signature of the request is invalid")
+	ErrExpiredSignature = errors.New("The timestamp of the signature is too old or in the future")
+	ErrReplayedRequest  = errors.New("The signed request was already received")
+)
+
+// SignatureConfig is used for configuring the HMAC signatures of the publishing requests.
+type SignatureConfig struct {
+	// Secrets are the shared secrets; a signature keyed with any of them is valid (e.g. while rotating them)
+	Secrets *[]string
+	// Tolerance is the maximum age of the timestamp of a signature
+	Tolerance *time.Duration
+	// Required rejects the requests without a signature; otherwise they are authenticated as the other requests
+	Required *bool
+}
+
+// signatureVerifier verifies the signatures of the requests, and rejects the signatures already received
+// (within the tolerance of their timestamps, the older ones being rejected anyway).
+type signatureVerifier struct {
+	secrets   [][]byte
+	tolerance time.Duration
+	required  bool
+	now       func() time.Time
+
+	mutex     sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newSignatureVerifier(config SignatureConfig) *signatureVerifier {
+	v := &signatureVerifier{
+		tolerance: DefaultSignatureTolerance,
+		now:       time.Now,
+		seen:      make(map[string]time.Time),
+	}
+	if config.Secrets != nil {
+		for _, secret := range *config.Secrets {
+			v.secrets = append(v.secrets, []byte(secret))
+		}
+	}
+	if config.Tolerance != nil && *config.Tolerance > 0 {
+		v.tolerance = *config.Tolerance
+	}
+	if config.Required != nil {
+		v.required = *config.Required
+	}
+	return v
+}
+
+// Sign returns the value of the signature header of a request with the method, the URL and the body, at the time.
+func Sign(secret []byte, t time.Time, method string, u *url.URL, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(signatureMAC(secret, timestamp, canonicalRequest(method, u), body))
+}
+
+// canonicalRequest returns the signed lines of the method, the path and the query (sorted by key) of a request.
+func canonicalRequest(method string, u *url.URL) string {
+	return method + "\n" + u.Path + "\n" + u.Query().Encode()
+}
+
+func signatureMAC(secret []byte, timestamp string, request string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(request))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// verify checks the signature header of a request with the method, the URL and the body.
+func (v *signatureVerifier) verify(header string, method string, u *url.URL, body []byte) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return ErrInvalidSignature
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signature, err := hex.DecodeString(kv[1])
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	now := v.now()
+	if age := now.Sub(time.Unix(unix, 0)); age > v.tolerance || age < -v.tolerance {
+		return ErrExpiredSignature
+	}
+	signature := v.valid(timestamp, canonicalRequest(method, u), body, signatures)
+	if signature == nil {
+		return ErrInvalidSignature
+	}
+	return v.checkReplay(hex.EncodeToString(signature), now)
+}
+
+// valid returns the first of the signatures keyed with one of the secrets, or nil.
+func (v *signatureVerifier) valid(timestamp string, request string, body []byte, signatures [][]byte) []byte {
+	for _, secret := range v.secrets {
+		expected := signatureMAC(secret, timestamp, request, body)
+		for _, signature := range signatures {
+			if hmac.Equal(expected, signature) {
+				return signature
+			}
+		}
+	}
+	return nil
+}
+
+// checkReplay remembers the signature until it expires, and rejects it if it was already received.
+func (v *signatureVerifier) checkReplay(signature string, now time.Time) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if now.Sub(v.lastPrune) >= time.Second {
+		for s, expires := range v.seen {
+			if now.After(expires) {
+				delete(v.seen, s)
+			}
+		}
+		v.lastPrune = now
+	}
+	if _, ok := v.seen[signature]; ok {
+		return ErrReplayedRequest
+	}
+	v.seen[signature] = now.Add(2 * v.tolerance)
+	return nil
+}
@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/testutil"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	a := assert.New(t)
+
+	secrets := []string{"old", "new"}
+	v := newSignatureVerifier(SignatureConfig{Secrets: &secrets})
+	now := time.Unix(1500000000, 0)
+	v.now = func() time.Time { return now }
+	body := []byte("Hello")
+	u, _ := url.Parse("/api/message/foo?userId=marvin&filterA=1")
+	verify := func(header string) error {
+		return v.verify(header, http.MethodPost, u, body)
+	}
+
+	a.NoError(verify(Sign([]byte("new"), now, http.MethodPost, u, body)))
+	a.NoError(verify(Sign([]byte("old"), now.Add(-time.Minute), http.MethodPost, u, body)))
+
+	a.Equal(ErrMissingSignature, verify(""))
+	a.Equal(ErrInvalidSignature, verify("t=1500000000"))
+	a.Equal(ErrInvalidSignature, verify(Sign([]byte("other"), now, http.MethodPost, u, body)))
+	a.Equal(ErrInvalidSignature, v.verify(Sign([]byte("new"), now.Add(time.Second), http.MethodPost, u, body), http.MethodPost, u, []byte("Hello!")))
+	a.Equal(ErrExpiredSignature, verify(Sign([]byte("new"), now.Add(-10*time.Minute), http.MethodPost, u, body)))
+
+	// the method, the path and the query are signed, the order of the query parameters does not matter
+	other, _ := url.Parse("/api/message/bar?userId=marvin&filterA=1")
+	a.Equal(ErrInvalidSignature, verify(Sign([]byte("new"), now.Add(3*time.Second), http.MethodPost, other, body)))
+	other, _ = url.Parse("/api/message/foo?userId=zaphod&filterA=1")
+	a.Equal(ErrInvalidSignature, verify(Sign([]byte("new"), now.Add(3*time.Second), http.MethodPost, other, body)))
+	a.Equal(ErrInvalidSignature, verify(Sign([]byte("new"), now.Add(3*time.Second), http.MethodPut, u, body)))
+	other, _ = url.Parse("/api/message/foo?filterA=1&userId=marvin")
+	a.NoError(verify(Sign([]byte("new"), now.Add(3*time.Second), http.MethodPost, other, body)))
+
+	// a signature is accepted only once, whatever the order of the fields
+	signature := Sign([]byte("new"), now.Add(2*time.Second), http.MethodPost, u, body)
+	a.NoError(verify(signature))
+	a.Equal(ErrReplayedRequest, verify(signature))
+	a.Equal(ErrReplayedRequest, verify(signature[len("t=1500000002,"):]+",t=1500000002"))
+}
+
+func TestServeHTTP_SignedRequests(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	secrets := []string{"secret"}
+	required := true
+	api := NewRestMessageAPI(routerMock, "/api").
+		WithTokenValidator(testTokenValidator{"token": "marvin"}).
+		WithSignatures(SignatureConfig{Secrets: &secrets, Required: &required})
+
+	target, _ := url.Parse("/api/message/my/topic?userId=hooks")
+	post := func(header, value string) int {
+		req := httptest.NewRequest(http.MethodPost, target.String(), bytes.NewReader(testBytes))
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// the signature is required, even with a valid token
+	a.Equal(http.StatusUnauthorized, post("Authorization", "Bearer token"))
+	a.Equal(http.StatusUnauthorized, post(SignatureHeader, Sign([]byte("other"), time.Now(), http.MethodPost, target, testBytes)))
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(msg *protocol.Message) {
+		a.Equal("hooks", msg.UserID)
+		a.NotContains(msg.HeaderJSON, "Signature")
+	})
+	a.Equal(http.StatusOK, post(SignatureHeader, Sign([]byte("secret"), time.Now(), http.MethodPost, target, testBytes)))
+}
@@ -0,0 +1,187 @@
+package rest
+
+import (
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/audit"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/store"
+
+	"github.com/rs/xid"
+
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	streamPrefix = "/stream"
+
+	// lastEventIDHeader is sent by the reconnecting event sources with the ID of the last message they received
+	lastEventIDHeader = "Last-Event-ID"
+
+	streamChannelSize = 100
+
+	// binaryEvent is the type of the events of the messages with binary bodies
+	binaryEvent = "binary"
+)
+
+// streamHeartbeat is the interval of the comments sent on the idle streams, keeping them open through the proxies.
+var streamHeartbeat = 15 * time.Second
+
+// serveStream streams the messages of the topic as server-sent events, with their IDs as event IDs and their
+// encoded protocol messages as data, until the request is done or the router closes the route.
+// The messages are fetched first from the ID given by the `since` query parameter (or following the one of the
+// Last-Event-ID header), and filtered by the `filter*` query parameters like the published ones.
+func (api *RestMessageAPI) serveStream(w http.ResponseWriter, r *http.Request, topic string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	claimedUserID := q(r, "userId")
+	userID, err := auth.Authenticate(api.tokenValidator, r, claimedUserID)
+	if err != nil {
+		log.WithError(err).WithField("userID", claimedUserID).Info("Rejected the streaming request")
+		audit.Record(audit.Event{Type: audit.AuthFailure, UserID: claimedUserID, RemoteAddr: r.RemoteAddr, URL: r.URL.Path})
+		http.Error(w, err.Error(), auth.AuthenticationStatus(err))
+		return
+	}
+
+	if router.IsDraining(api.router) {
+		http.Error(w, router.ErrDraining.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	path := protocol.Path(topic)
+	accessManager, err := api.router.AccessManager()
+	if err != nil {
+		http.Error(w, "Server error.", http.StatusInternalServerError)
+		return
+	}
+	if !accessManager.IsAllowed(auth.READ, userID, path) {
+		audit.RecordAuthFailure(auth.READ, userID, path)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	since, err := streamStart(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := router.RouteParams{}
+	for name, values := range r.URL.Query() {
+		if strings.HasPrefix(name, filterPrefix) && len(values) > 0 {
+			params[filterName(name)] = values[0]
+		}
+	}
+	params["application_id"] = xid.New().String()
+	params["user_id"] = userID
+
+	var fr *store.FetchRequest
+	if since > 0 {
+		fr = store.NewFetchRequest("", since, 0, store.DirectionForward, -1)
+	}
+	route := router.NewRoute(router.RouteConfig{
+		RouteParams:  params,
+		Path:         path,
+		ChannelSize:  streamChannelSize,
+		FetchRequest: fr,
+	})
+	provideC := make(chan error, 1)
+	go func() {
+		provideC <- route.Provide(api.router, true)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	var lastID uint64
+	for {
+		select {
+		case err := <-provideC:
+			if err != nil {
+				log.WithError(err).WithField("topic", topic).Error("Subscribing the stream failed")
+				return
+			}
+			provideC = nil
+		case m, opened := <-route.MessagesChannel():
+			if !opened {
+				log.WithField("route", route.String()).Info("Route closed by router, ending the stream")
+				return
+			}
+			if m.ID <= lastID {
+				continue
+			}
+			if _, err := w.Write(event(m)); err != nil {
+				api.router.Unsubscribe(route)
+				return
+			}
+			flusher.Flush()
+			lastID = m.ID
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ":\n\n"); err != nil {
+				api.router.Unsubscribe(route)
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			api.router.Unsubscribe(route)
+			return
+		case <-api.router.Done():
+			return
+		}
+	}
+}
+
+// streamStart returns the ID of the first message to fetch before subscribing, or 0 to only subscribe.
+func streamStart(r *http.Request) (uint64, error) {
+	if lastEventID := r.Header.Get(lastEventIDHeader); lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid %s: %s", lastEventIDHeader, lastEventID)
+		}
+		return id + 1, nil
+	}
+	if since := q(r, "since"); since != "" {
+		id, err := strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid since: %s", since)
+		}
+		return id, nil
+	}
+	return 0, nil
+}
+
+// event returns the server-sent event of the message, with a data line for each line of the encoded message,
+// or a binary event with the base64 encoded message if its body is binary (the events being text).
+func event(m *protocol.Message) []byte {
+	buff := &bytes.Buffer{}
+	fmt.Fprintf(buff, "id: %d\n", m.ID)
+	if m.IsBinary() {
+		fmt.Fprintf(buff, "event: %s\ndata: %s\n\n", binaryEvent, base64.StdEncoding.EncodeToString(m.Bytes()))
+		return buff.Bytes()
+	}
+	for _, line := range strings.Split(string(m.Bytes()), "\n") {
+		buff.WriteString("data: ")
+		buff.WriteString(line)
+		buff.WriteString("\n")
+	}
+	buff.WriteString("\n")
+	return buff.Bytes()
+}
@@ -0,0 +1,176 @@
+package rest
+
+import (
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeStream(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	api := NewRestMessageAPI(routerMock, "/api")
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	routerMock.EXPECT().AccessManager().Return(auth.NewAllowAllAccessManager(true), nil)
+	routerMock.EXPECT().Done().Return(make(<-chan bool)).AnyTimes()
+	routeC := make(chan *router.Route, 1)
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		routeC <- r
+	}).Return(nil, nil)
+	unsubscribed := make(chan bool)
+	routerMock.EXPECT().Unsubscribe(gomock.Any()).Do(func(r *router.Route) {
+		close(unsubscribed)
+	})
+
+	// when streaming a topic with a filter
+	resp, err := http.Get(server.URL + "/api/stream/foo?userId=marvin&filterDeviceId=d1")
+	a.NoError(err)
+	a.Equal(http.StatusOK, resp.StatusCode)
+	a.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	// then the route of the stream has the filter and the user
+	var route *router.Route
+	select {
+	case route = <-routeC:
+	case <-time.After(time.Second):
+		a.FailNow("timeout while waiting for the subscription")
+	}
+	a.Equal("/foo", string(route.Path))
+	a.Equal("d1", route.RouteParams["device_id"])
+	a.Equal("marvin", route.RouteParams["user_id"])
+
+	// and the messages of the route are sent as events, with a data line for each line of the message
+	m := &protocol.Message{ID: 42, Path: "/foo", UserID: "someone", Body: []byte("Hello\nWorld")}
+	a.NoError(route.Deliver(m, false))
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		a.NoError(err)
+		if line == "\n" {
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	a.Equal("id: 42", lines[0])
+	var data []string
+	for _, line := range lines[1:] {
+		a.True(strings.HasPrefix(line, "data: "))
+		data = append(data, strings.TrimPrefix(line, "data: "))
+	}
+	received, err := protocol.ParseMessage([]byte(strings.Join(data, "\n")))
+	a.NoError(err)
+	a.Equal(uint64(42), received.ID)
+	a.Equal("Hello\nWorld", string(received.Body))
+
+	// and the route is unsubscribed when the stream is closed
+	resp.Body.Close()
+	select {
+	case <-unsubscribed:
+	case <-time.After(time.Second):
+		a.Fail("timeout while waiting for the unsubscription")
+	}
+}
+
+func TestServeStream_Forbidden(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	api := NewRestMessageAPI(routerMock, "/api")
+	routerMock.EXPECT().AccessManager().Return(auth.NewAllowAllAccessManager(false), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stream/foo?userId=marvin", nil)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+
+	a.Equal(http.StatusForbidden, w.Code)
+}
+
+func TestStreamStart(t *testing.T) {
+	a := assert.New(t)
+
+	for _, test := range []struct {
+		query       string
+		lastEventID string
+		start       uint64
+		fails       bool
+	}{
+		{query: "", start: 0},
+		{query: "?since=5", start: 5},
+		{query: "?since=5", lastEventID: "7", start: 8},
+		{query: "?since=-5", fails: true},
+		{lastEventID: "x", fails: true},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/stream/foo"+test.query, nil)
+		if test.lastEventID != "" {
+			req.Header.Set(lastEventIDHeader, test.lastEventID)
+		}
+		start, err := streamStart(req)
+		if test.fails {
+			a.Error(err, test.query)
+			continue
+		}
+		a.NoError(err, test.query)
+		a.Equal(test.start, start, test.query)
+	}
+}
+
+func TestServeHTTP_Receipt(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	api := NewRestMessageAPI(routerMock, "/api")
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(msg *protocol.Message) {
+		msg.ID = 42
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/message/my/topic?userId=marvin&messageId=7", bytes.NewReader(testBytes))
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+
+	a.Equal(http.StatusOK, w.Code)
+	receipt := &protocol.SendReceipt{}
+	a.NoError(json.Unmarshal(w.Body.Bytes(), receipt))
+	a.Equal(uint64(42), receipt.SequenceID)
+	a.Equal("/my/topic", receipt.Path)
+	a.Equal("7", receipt.PublisherMessageID)
+}
+
+func TestEvent_Binary(t *testing.T) {
+	a := assert.New(t)
+
+	m := &protocol.Message{ID: 42, Path: "/foo", Body: []byte{0x00, '\r', '\n', 0xff}}
+	a.NoError(m.SetContentType("application/octet-stream"))
+
+	lines := strings.Split(string(event(m)), "\n")
+	a.Equal([]string{"id: 42", "event: binary"}, lines[:2])
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(lines[2], "data: "))
+	a.NoError(err)
+	a.Equal(m.Bytes(), data)
+	a.Equal([]string{"", ""}, lines[3:])
+}
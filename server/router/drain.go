@@ -0,0 +1,44 @@
+package router
+
+import (
+	"time"
+)
+
+// Draining is implemented by a Router refusing new subscriptions while the service drains its clients.
+type Draining interface {
+	IsDraining() bool
+}
+
+// IsDraining returns true if the router refuses new subscriptions
+// (the routers not implementing Draining never refuse them).
+// The modules check it before subscribing a new client, and answer with ErrDraining.
+func IsDraining(r Router) bool {
+	d, ok := r.(Draining)
+	return ok && d.IsDraining()
+}
+
+// IsDraining returns true while the service drains its clients.
+func (router *router) IsDraining() bool {
+	router.RLock()
+	defer router.RUnlock()
+	return router.draining
+}
+
+// Drain refuses the new subscriptions of all the modules, until the service is resumed.
+// It is a part of the service.Drainable implementation.
+func (router *router) Drain(peer string, timeout time.Duration) error {
+	router.setDraining(true)
+	return nil
+}
+
+// Resume accepts the new subscriptions again.
+// It is a part of the service.Resumable implementation.
+func (router *router) Resume() {
+	router.setDraining(false)
+}
+
+func (router *router) setDraining(draining bool) {
+	router.Lock()
+	defer router.Unlock()
+	router.draining = draining
+}
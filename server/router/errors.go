@@ -22,6 +22,12 @@ var (
 
 	// ErrQueueFull is returned when trying to `Deliver` a message in a full queued route
 	ErrQueueFull = errors.New("Route queue is full. Route is closed.")
+
+	// ErrMessageExpired is returned when handling a message whose expiration time is passed
+	ErrMessageExpired = errors.New("The message is expired")
+
+	// ErrDraining is returned by the modules refusing a new subscription while the service drains its clients
+	ErrDraining = errors.New("The server is draining its clients, no new subscriptions are accepted")
 )
 
 // PermissionDeniedError is returned when AccessManager denies a user request for a topic
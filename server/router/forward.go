@@ -0,0 +1,32 @@
+package router
+
+import (
+	"context"
+
+	"github.com/smancke/guble/protocol"
+)
+
+// Forward passes the messages received by the route to the handler, until the context is done.
+// When the router closes the route (e.g. because its consumer is too slow), a new route with the same
+// configuration is subscribed in its place; Forward returns the error if this fails.
+func Forward(ctx context.Context, r Router, route *Route, handle func(*protocol.Message)) error {
+	for {
+		select {
+		case m, opened := <-route.MessagesChannel():
+			if !opened {
+				if ctx.Err() != nil {
+					return nil
+				}
+				logger.WithField("route", route.String()).Info("Route closed by router, subscribing again")
+				route = NewRoute(route.RouteConfig)
+				if _, err := r.Subscribe(route); err != nil {
+					return err
+				}
+				continue
+			}
+			handle(m)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
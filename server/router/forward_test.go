@@ -0,0 +1,64 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForward(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(ctrl)
+	route := NewRoute(RouteConfig{Path: "/foo", ChannelSize: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the closed route is replaced by a new one with the same configuration
+	resubscribed := make(chan *Route, 1)
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *Route) {
+		resubscribed <- r
+	}).Return(nil, nil)
+
+	received := make(chan *protocol.Message, 2)
+	done := make(chan error)
+	go func() {
+		done <- Forward(ctx, routerMock, route, func(m *protocol.Message) { received <- m })
+	}()
+
+	a.NoError(route.Deliver(&protocol.Message{ID: 1, Path: "/foo"}, false))
+	route.Close()
+	var next *Route
+	select {
+	case next = <-resubscribed:
+		a.True(next.Equal(route))
+	case <-time.After(time.Second):
+		a.FailNow("the route is not subscribed again")
+	}
+	a.NoError(next.Deliver(&protocol.Message{ID: 2, Path: "/foo"}, false))
+
+	a.Equal(uint64(1), (<-received).ID)
+	a.Equal(uint64(2), (<-received).ID)
+
+	cancel()
+	select {
+	case err := <-done:
+		a.NoError(err)
+	case <-time.After(time.Second):
+		a.Fail("Forward did not return")
+	}
+
+	// an error of the new subscription is returned
+	route = NewRoute(RouteConfig{Path: "/foo", ChannelSize: 1})
+	route.Close()
+	routerMock.EXPECT().Subscribe(gomock.Any()).Return(nil, errors.New("stopping"))
+	a.EqualError(Forward(context.Background(), routerMock, route, nil), "stopping")
+}
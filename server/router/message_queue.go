@@ -4,6 +4,7 @@ import (
 	"github.com/smancke/guble/protocol"
 
 	"sync"
+	"time"
 )
 
 const (
@@ -13,6 +14,7 @@ const (
 type queue struct {
 	mu    sync.Mutex
 	queue []*protocol.Message
+	times []time.Time // the times when the messages were queued
 }
 
 // newQueue creates a *queue that will have the capacity specified by size.
@@ -23,6 +25,7 @@ func newQueue(size int) *queue {
 	}
 	return &queue{
 		queue: make([]*protocol.Message, 0, size),
+		times: make([]time.Time, 0, size),
 	}
 }
 
@@ -31,6 +34,8 @@ func (q *queue) push(m *protocol.Message) {
 	defer q.mu.Unlock()
 
 	q.queue = append(q.queue, m)
+	q.times = append(q.times, time.Now())
+	mCurrentQueuedMessages.Add(1)
 }
 
 // remove the first item from the queue if exists
@@ -42,6 +47,20 @@ func (q *queue) remove() {
 		return
 	}
 	q.queue = q.queue[1:]
+	q.times = q.times[1:]
+	mCurrentQueuedMessages.Add(-1)
+}
+
+// clear removes all the items from the queue, returning their number
+func (q *queue) clear() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(q.queue)
+	mCurrentQueuedMessages.Add(-int64(n))
+	q.queue = q.queue[:0]
+	q.times = q.times[:0]
+	return n
 }
 
 // poll returns the first item from the queue without removing it
@@ -56,6 +75,17 @@ func (q *queue) poll() (*protocol.Message, error) {
 	return q.queue[0], nil
 }
 
+// oldest returns the time when the first item was queued, or the zero time if the queue is empty
+func (q *queue) oldest() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.times) == 0 {
+		return time.Time{}
+	}
+	return q.times[0]
+}
+
 func (q *queue) size() int {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -38,6 +39,11 @@ type Route struct {
 	invalid   bool
 	mu        sync.RWMutex
 
+	// the number of messages not delivered because the route was too slow, or closed with queued messages
+	drops       int64
+	closeReason string
+	closedAt    time.Time
+
 	logger *log.Entry
 }
 
@@ -75,7 +81,7 @@ func (r *Route) String() string {
 // isFromStore boolean specifies if the messages are being fetched or are from the router
 // In case they are fetched from the store the route won't close if it's full
 func (r *Route) Deliver(msg *protocol.Message, isFromStore bool) error {
-	loggerMessage := r.logger.WithField("message", msg)
+	loggerMessage := r.logger.WithFields(msg.LogFields())
 
 	if r.isInvalid() {
 		loggerMessage.Error("Cannot deliver because route is invalid")
@@ -88,6 +94,11 @@ func (r *Route) Deliver(msg *protocol.Message, isFromStore bool) error {
 		mTotalNotMatchedByFilters.Add(1)
 		return nil
 	}
+	if msg.Expired(time.Now()) {
+		loggerMessage.Debug("Message is expired")
+		mTotalMessagesExpired.Add(1)
+		return nil
+	}
 	// not an infinite queue
 	if r.queueSize >= 0 {
 		// if size is zero the sending is direct
@@ -95,7 +106,8 @@ func (r *Route) Deliver(msg *protocol.Message, isFromStore bool) error {
 			return r.sendDirect(msg, isFromStore)
 		} else if r.queue.size() >= r.queueSize {
 			loggerMessage.Error("Closing route because queue is full")
-			r.Close()
+			atomic.AddInt64(&r.drops, 1)
+			r.closeBecause(closedQueueFull)
 			mTotalDeliverMessageErrors.Add(1)
 			return ErrQueueFull
 		}
@@ -218,10 +230,45 @@ func (r *Route) Close() error {
 	r.invalid = true
 	close(r.messagesC)
 	close(r.closeC)
+	atomic.AddInt64(&r.drops, int64(r.queue.clear()))
 
 	return ErrInvalidRoute
 }
 
+// closeBecause closes the route because its consumer is too slow, recording it in the recently closed routes.
+func (r *Route) closeBecause(reason string) {
+	r.mu.Lock()
+	if !r.invalid {
+		r.closeReason = reason
+		r.closedAt = time.Now()
+	}
+	r.mu.Unlock()
+
+	r.Close()
+	recordClosedRoute(r.Stats())
+}
+
+// Stats returns the current delivery statistics of the route.
+func (r *Route) Stats() RouteStats {
+	stats := RouteStats{
+		Route:     r.Key(),
+		QueueSize: r.queue.size(),
+		Drops:     atomic.LoadInt64(&r.drops),
+	}
+	if oldest := r.queue.oldest(); !oldest.IsZero() {
+		stats.OldestQueuedMsec = int64(time.Since(oldest) / time.Millisecond)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stats.CloseReason = r.closeReason
+	if !r.closedAt.IsZero() {
+		closedAt := r.closedAt
+		stats.ClosedAt = &closedAt
+	}
+	return stats
+}
+
 // Equal will check if the route path is matched and all the parameters or just a
 // subset of specific parameters between the routes
 func (r *Route) Equal(other *Route, keys ...string) bool {
@@ -288,8 +335,16 @@ func (r *Route) consume() {
 				continue
 			}
 
+			// the message can expire while waiting in the queue
+			if msg.Expired(time.Now()) {
+				r.logger.WithFields(msg.LogFields()).Debug("Dropping expired message from queue")
+				mTotalMessagesExpired.Add(1)
+				r.queue.remove()
+				continue
+			}
+
 			if err = r.send(msg); err != nil {
-				r.logger.WithField("message", msg).Error("Error sending message through route")
+				r.logger.WithFields(msg.LogFields()).WithError(err).Error("Error sending message through route")
 				if err == errTimeout || err == ErrInvalidRoute {
 					// channel been closed, ending the consumer
 					return
@@ -306,23 +361,25 @@ func (r *Route) consume() {
 func (r *Route) send(msg *protocol.Message) error {
 	defer r.invalidRecover()
 
-	r.logger.WithField("message", msg).Debug("Sending message through route channel")
+	r.logger.WithFields(msg.LogFields()).Debug("Sending message through route channel")
 
 	// no timeout, means we don't close the channel
 	if r.timeout == -1 {
 		r.messagesC <- msg
+		countDelivered(msg)
 		r.logger.WithField("size", len(r.messagesC)).Debug("Channel size")
 		return nil
 	}
 
 	select {
 	case r.messagesC <- msg:
+		countDelivered(msg)
 		return nil
 	case <-r.closeC:
 		return ErrInvalidRoute
 	case <-time.After(r.timeout):
 		r.logger.Debug("Closing route because of timeout")
-		r.Close()
+		r.closeBecause(closedSendTimeout)
 		return errTimeout
 	}
 }
@@ -340,15 +397,18 @@ func (r *Route) invalidRecover() error {
 func (r *Route) sendDirect(msg *protocol.Message, store bool) error {
 	if store {
 		r.messagesC <- msg
+		countDelivered(msg)
 		return nil
 	}
 
 	select {
 	case r.messagesC <- msg:
+		countDelivered(msg)
 		return nil
 	default:
 		r.logger.Debug("Closing route because of full channel")
-		r.Close()
+		atomic.AddInt64(&r.drops, 1)
+		r.closeBecause(closedChannelFull)
 		return ErrChannelFull
 	}
 }
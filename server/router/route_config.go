@@ -34,6 +34,10 @@ type RouteConfig struct {
 	// FetchRequest to fetch messages before subscribing
 	// The Partition field of the FetchRequest is overrided with the Partition of the Route topic
 	FetchRequest *store.FetchRequest `json:"-"`
+
+	// IgnoreFilters if set delivers all the messages of the topic to the route,
+	// whatever their filters (e.g. for the sinks forwarding whole topics)
+	IgnoreFilters bool `json:"-"`
 }
 
 func (rc *RouteConfig) Equal(other RouteConfig, keys ...string) bool {
@@ -45,7 +49,7 @@ func (rc *RouteConfig) Equal(other RouteConfig, keys ...string) bool {
 
 // messageFilter returns true if the route matches message filters
 func (rc *RouteConfig) messageFilter(m *protocol.Message) bool {
-	if m.Filters == nil {
+	if m.Filters == nil || rc.IgnoreFilters {
 		return true
 	}
 
@@ -205,4 +205,10 @@ func TestRouteConfig_messageFilter(t *testing.T) {
 		m := &protocol.Message{Filters: c.filters}
 		a.Equal(c.result, routeConfig.messageFilter(m), "Failed filter: "+name)
 	}
+
+	routeConfig.IgnoreFilters = true
+	for name, c := range testcases {
+		m := &protocol.Message{Filters: c.filters}
+		a.True(routeConfig.messageFilter(m), "Failed ignoring filter: "+name)
+	}
 }
@@ -82,6 +82,24 @@ func TestRouteDeliver_Invalid(t *testing.T) {
 	a.Equal(ErrInvalidRoute, err)
 }
 
+func TestRouteDeliver_Expired(t *testing.T) {
+	a := assert.New(t)
+	r := testRoute()
+
+	expired := &protocol.Message{ID: 1, Path: dummyPath, Expires: time.Now().Add(-time.Second).Unix()}
+	valid := &protocol.Message{ID: 2, Path: dummyPath, Expires: time.Now().Add(time.Hour).Unix()}
+	a.NoError(r.Deliver(expired, false))
+	a.NoError(r.Deliver(valid, true))
+
+	select {
+	case m := <-r.MessagesChannel():
+		a.Equal(uint64(2), m.ID)
+	case <-time.After(10 * time.Millisecond):
+		a.Fail("the valid message was not delivered")
+	}
+	a.Equal(0, len(r.MessagesChannel()))
+}
+
 func TestRouteDeliver_QueueSize(t *testing.T) {
 	a := assert.New(t)
 	// create a route with a queue size
@@ -3,8 +3,10 @@ package router
 import (
 	"fmt"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/distribution/health"
@@ -14,10 +16,12 @@ import (
 	"net/http"
 
 	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/audit"
 	"github.com/smancke/guble/server/auth"
 	"github.com/smancke/guble/server/cluster"
 	"github.com/smancke/guble/server/kvstore"
 	"github.com/smancke/guble/server/store"
+	"github.com/smancke/guble/server/tracing"
 )
 
 const (
@@ -28,6 +32,9 @@ const (
 	prefix                       = "/admin/router"
 )
 
+// ModuleName is the name of the router in the service, referenced by the modules depending on it.
+const ModuleName = "router"
+
 // Router interface provides a mechanism for PubSub messaging
 type Router interface {
 	Subscribe(r *Route) (*Route, error)
@@ -55,9 +62,11 @@ type router struct {
 	handleC      chan *protocol.Message
 	subscribeC   chan subRequest
 	unsubscribeC chan subRequest
-	stopC        chan bool      // Channel that signals stop of the router
-	stopping     bool           // Flag: the router is in stopping process and no incoming messages are accepted
-	wg           sync.WaitGroup // Add any operation that we need to wait upon here
+	routesC      chan chan []*Route // Channel of the requests of a snapshot of the routes
+	stopC        chan bool          // Channel that signals stop of the router
+	stopping     bool               // Flag: the router is in stopping process and no incoming messages are accepted
+	draining     bool               // Flag: the service is draining its clients and no new subscriptions are accepted
+	wg           sync.WaitGroup     // Add any operation that we need to wait upon here
 
 	accessManager auth.AccessManager
 	messageStore  store.MessageStore
@@ -75,6 +84,7 @@ func New(accessManager auth.AccessManager, messageStore store.MessageStore, kvSt
 		handleC:      make(chan *protocol.Message, handleChannelCapacity),
 		subscribeC:   make(chan subRequest, subscribeChannelCapacity),
 		unsubscribeC: make(chan subRequest, unsubscribeChannelCapacity),
+		routesC:      make(chan chan []*Route),
 		stopC:        make(chan bool, 1),
 
 		accessManager: accessManager,
@@ -113,6 +123,8 @@ func (router *router) Start() error {
 				case unsubscriber := <-router.unsubscribeC:
 					router.unsubscribe(unsubscriber.route)
 					unsubscriber.doneC <- true
+				case replyC := <-router.routesC:
+					replyC <- router.allRoutes()
 				case <-router.Done():
 					router.setStopping(true)
 				}
@@ -123,6 +135,11 @@ func (router *router) Start() error {
 	return nil
 }
 
+// Name returns the ModuleName of the router, referenced by the modules depending on it.
+func (router *router) Name() string {
+	return ModuleName
+}
+
 // Stop stops the router by closing the stop channel, and waiting on the WaitGroup
 func (router *router) Stop() error {
 	logger.Info("Stopping router")
@@ -157,33 +174,93 @@ func (router *router) Check() error {
 // HandleMessage stores the message in the MessageStore(and gets a new ID for it if the message was created locally)
 // and then passes it to the internal channel, and asynchronously to the cluster (if available).
 func (router *router) HandleMessage(message *protocol.Message) error {
-	logger.WithFields(log.Fields{
-		"userID": message.UserID,
-		"path":   message.Path}).Debug("HandleMessage")
+	logger.WithFields(message.LogFields()).Debug("HandleMessage")
 
 	mTotalMessagesIncoming.Add(1)
+	message.ReceivedAt = time.Now()
 	if err := router.isStopping(); err != nil {
 		logger.WithField("error", err.Error()).Error("Router is stopping")
 		return err
 	}
 
+	span := tracing.StartSpan("router.handle_message", tracing.FromMessage(message))
+	defer span.End()
+	span.SetAttribute("topic", string(message.Path))
+	tracing.ToMessage(message, span.Context())
+
 	if !router.accessManager.IsAllowed(auth.WRITE, message.UserID, message.Path) {
+		audit.RecordAuthFailure(auth.WRITE, message.UserID, message.Path)
 		return &PermissionDeniedError{UserID: message.UserID, AccessType: auth.WRITE, Path: message.Path}
 	}
 
+	if err := message.ParseHeader(); err != nil {
+		mTotalMessagesRejected.Add(1)
+		return err
+	}
+	if message.Expired(time.Now()) {
+		mTotalMessagesExpired.Add(1)
+		return ErrMessageExpired
+	}
+
 	var nodeID uint8
 	if router.cluster != nil {
 		nodeID = router.cluster.Config.ID
+
+		if message.NodeID == 0 {
+			if err := router.cluster.AcceptsWrites(); err != nil {
+				logger.WithField("error", err.Error()).Warn("Rejecting message")
+				mTotalMessagesRejected.Add(1)
+				return err
+			}
+		}
+
+		if router.cluster.Config.Partitioning {
+			partition := message.Path.Partition()
+			if owner := router.cluster.Owner(partition); owner != nodeID {
+				if message.NodeID == 0 {
+					// the owner of the partition stores and sequences the message, and broadcasts it back
+					mTotalMessagesForwarded.Add(1)
+					return router.cluster.ForwardMessage(owner, message)
+				}
+				if !router.cluster.IsStorageNode(partition) {
+					// a message stored by its owner: only deliver it to the local subscribers
+					router.handleOverloadedChannel()
+					router.handleC <- message
+					return nil
+				}
+				// this node is a replica of the partition: store the message as well
+			}
+		}
+
+		if router.cluster.Config.Sequencer && message.NodeID == 0 {
+			// the message was received by this node: its ID is assigned by the cluster sequencer
+			id, err := router.cluster.NextMessageID(message.Path.Partition())
+			if err != nil {
+				logger.WithField("error", err.Error()).Error("Error getting message ID from cluster sequencer")
+				mTotalMessageStoreErrors.Add(1)
+				return err
+			}
+			message.ID = id
+			message.Time = time.Now().Unix()
+			message.NodeID = nodeID
+		}
 	}
 
 	mTotalMessagesIncomingBytes.Add(int64(len(message.Bytes())))
+	storeSpan := tracing.StartSpan("store.store_message", span.Context())
+	storeStart := time.Now()
 	size, err := router.messageStore.StoreMessage(message, nodeID)
+	mStoreLatency.Observe(time.Since(storeStart))
+	storeSpan.SetError(err)
+	storeSpan.End()
 	if err != nil {
 		logger.WithField("error", err.Error()).Error("Error storing message")
 		mTotalMessageStoreErrors.Add(1)
+		span.SetError(err)
 		return err
 	}
 	mTotalMessagesStoredBytes.Add(int64(size))
+	countPublished(message)
 
 	router.handleOverloadedChannel()
 
@@ -211,6 +288,7 @@ func (router *router) Subscribe(r *Route) (*Route, error) {
 
 	accessAllowed := router.accessManager.IsAllowed(auth.READ, userID, routePath)
 	if !accessAllowed {
+		audit.RecordAuthFailure(auth.READ, userID, routePath)
 		return r, &PermissionDeniedError{UserID: userID, AccessType: auth.READ, Path: routePath}
 	}
 	req := subRequest{
@@ -268,6 +346,7 @@ func (router *router) subscribe(r *Route) {
 		slice = make([]*Route, 0, 1)
 		router.routes[routePath] = slice
 		mCurrentRoutes.Add(1)
+		defer router.updateClusterSubscriptions()
 	}
 	router.routes[routePath] = append(slice, r)
 	if removed {
@@ -275,6 +354,7 @@ func (router *router) subscribe(r *Route) {
 	} else {
 		mTotalSubscriptions.Add(1)
 		mCurrentSubscriptions.Add(1)
+		audit.Record(audit.Event{Type: audit.Subscribe, UserID: r.Get("user_id"), Topic: routePath})
 	}
 }
 
@@ -293,13 +373,27 @@ func (router *router) unsubscribe(r *Route) {
 	if removed {
 		mTotalUnsubscriptions.Add(1)
 		mCurrentSubscriptions.Add(-1)
+		audit.Record(audit.Event{Type: audit.Unsubscribe, UserID: r.Get("user_id"), Topic: routePath})
 	} else {
 		mTotalInvalidUnsubscriptionAttempts.Add(1)
 	}
 	if len(router.routes[routePath]) == 0 {
 		delete(router.routes, routePath)
 		mCurrentRoutes.Add(-1)
+		router.updateClusterSubscriptions()
+	}
+}
+
+// updateClusterSubscriptions lets the other nodes of the cluster know the paths subscribed on this node.
+func (router *router) updateClusterSubscriptions() {
+	if router.cluster == nil {
+		return
+	}
+	paths := make([]protocol.Path, 0, len(router.routes))
+	for path := range router.routes {
+		paths = append(paths, path)
 	}
+	router.cluster.UpdateSubscriptions(paths)
 }
 
 func (router *router) panicIfInternalDependenciesAreNil() {
@@ -336,19 +430,20 @@ func (router *router) isStopping() error {
 }
 
 func (router *router) handleMessage(message *protocol.Message) {
-	flog := logger.WithFields(log.Fields{
-		"topic":    message.Path,
-		"metadata": message.Metadata(),
-		"filters":  message.Filters,
-	})
+	flog := logger.WithFields(message.LogFields()).WithField("filters", message.Filters)
 	flog.Debug("Called routeMessage for data")
 	mTotalMessagesRouted.Add(1)
 
+	span := tracing.StartSpan("router.route", tracing.FromMessage(message))
+	defer span.End()
+
 	matched := false
+	routes := 0
 	for path, pathRoutes := range router.routes {
 		if matchesTopic(message.Path, path) {
 			matched = true
 			for _, route := range pathRoutes {
+				routes++
 				if err := route.Deliver(message, false); err == ErrInvalidRoute {
 					// Unsubscribe invalid routes
 					router.unsubscribe(route)
@@ -357,6 +452,8 @@ func (router *router) handleMessage(message *protocol.Message) {
 		}
 	}
 
+	span.SetAttribute("routes", strconv.Itoa(routes))
+
 	if !matched {
 		flog.Debug("No route matched.")
 		mTotalMessagesNotMatchingTopic.Add(1)
@@ -415,6 +512,11 @@ func (router *router) Fetch(req *store.FetchRequest) error {
 	if err := router.isStopping(); err != nil {
 		return err
 	}
+	if router.cluster != nil && router.cluster.Config.Partitioning && !router.cluster.IsStorageNode(req.Partition) {
+		// the partition is stored only by its owner and replicas
+		router.cluster.Fetch(req)
+		return nil
+	}
 	router.messageStore.Fetch(req)
 	return nil
 }
@@ -14,15 +14,24 @@ var (
 	mTotalUnsubscriptions                      = metrics.NewInt("router.total_unsubscriptions")
 	mCurrentSubscriptions                      = metrics.NewInt("router.current_subscriptions")
 	mCurrentRoutes                             = metrics.NewInt("router.current_routes")
+	mCurrentQueuedMessages                     = metrics.NewInt("router.current_queued_messages")
 	mTotalMessagesIncoming                     = metrics.NewInt("router.total_messages_incoming")
 	mTotalMessagesIncomingBytes                = metrics.NewInt("router.total_messages_bytes_incoming")
 	mTotalMessagesStoredBytes                  = metrics.NewInt("router.total_messages_bytes_stored")
+	mTotalMessagesForwarded                    = metrics.NewInt("router.total_messages_forwarded")
+	mTotalMessagesRejected                     = metrics.NewInt("router.total_messages_rejected")
 	mTotalMessagesRouted                       = metrics.NewInt("router.total_messages_routed")
 	mTotalOverloadedHandleChannel              = metrics.NewInt("router.total_overloaded_handle_channel")
 	mTotalMessagesNotMatchingTopic             = metrics.NewInt("router.total_messages_not_matching_topic")
 	mTotalMessageStoreErrors                   = metrics.NewInt("router.total_errors_message_store")
 	mTotalDeliverMessageErrors                 = metrics.NewInt("router.total_errors_deliver_message")
 	mTotalNotMatchedByFilters                  = metrics.NewInt("router.total_not_matched_by_filters")
+	mTotalMessagesExpired                      = metrics.NewInt("router.total_messages_expired")
+	mTotalTopicPublishedMessages               = metrics.NewMap("router.total_topic_published_messages")
+	mTotalTopicDeliveredMessages               = metrics.NewMap("router.total_topic_delivered_messages")
+	mTotalTopicDeliveryLatencyMsec             = metrics.NewMap("router.total_topic_delivery_latency_msec")
+	mDeliveryLatency                           = metrics.NewTiming("router.delivery_latency_msec")
+	mStoreLatency                              = metrics.NewTiming("router.store_latency_msec")
 )
 
 func resetRouterMetrics() {
@@ -35,6 +44,7 @@ func resetRouterMetrics() {
 	mTotalInvalidUnsubscriptionAttempts.Set(0)
 	mCurrentSubscriptions.Set(0)
 	mCurrentRoutes.Set(0)
+	mCurrentQueuedMessages.Set(0)
 	mTotalMessagesIncoming.Set(0)
 	mTotalMessagesRouted.Set(0)
 	mTotalOverloadedHandleChannel.Set(0)
@@ -43,5 +53,8 @@ func resetRouterMetrics() {
 	mTotalMessageStoreErrors.Set(0)
 	mTotalMessagesIncomingBytes.Set(0)
 	mTotalMessagesStoredBytes.Set(0)
+	mTotalMessagesForwarded.Set(0)
+	mTotalMessagesRejected.Set(0)
 	mTotalNotMatchedByFilters.Set(0)
+	resetTopicMetrics()
 }
@@ -185,6 +185,46 @@ func TestRouter_HandleMessageNotAllowed(t *testing.T) {
 	a.NoError(err)
 }
 
+func TestRouter_HandleMessageExpired(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	// Given a Router with route, whose message store is not used
+	router, r := aRouterRoute(chanSize)
+
+	// when sending an expired message
+	err := router.HandleMessage(&protocol.Message{
+		Path:       r.Path,
+		Body:       aTestByteMessage,
+		HeaderJSON: `{"Expires": "2015-01-01T12:00:00Z"}`,
+	})
+
+	// then it is rejected
+	a.Equal(ErrMessageExpired, err)
+
+	// and a message with an invalid expiration time as well
+	err = router.HandleMessage(&protocol.Message{
+		Path:       r.Path,
+		Body:       aTestByteMessage,
+		HeaderJSON: `{"Expires": "tomorrow"}`,
+	})
+	a.Error(err)
+}
+
+func TestRouter_HandleMessageInvalidPriority(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	router, r := aRouterRoute(chanSize)
+	err := router.HandleMessage(&protocol.Message{
+		Path:       r.Path,
+		Body:       aTestByteMessage,
+		HeaderJSON: `{"Priority": "urgent"}`,
+	})
+	assert.EqualError(t, err, `invalid priority "urgent": use low, normal or high`)
+}
+
 func TestRouter_ReplacingOfRoutesMatchingAppID(t *testing.T) {
 	a := assert.New(t)
 
@@ -543,3 +583,15 @@ func assertChannelContainsMessage(a *assert.Assertions, c <-chan *protocol.Messa
 		a.Fail("No message received")
 	}
 }
+
+func TestRouter_Draining(t *testing.T) {
+	a := assert.New(t)
+	router, _, _, _ := aStartedRouter()
+	a.False(IsDraining(router))
+
+	a.NoError(router.Drain("", time.Second))
+	a.True(IsDraining(router))
+
+	router.Resume()
+	a.False(IsDraining(router))
+}
@@ -0,0 +1,174 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSlowConsumersPrefix is the prefix of the endpoint reporting the slowest routes
+	DefaultSlowConsumersPrefix = "/admin/router/slow"
+
+	defaultSlowConsumersLimit = 20
+	recentlyClosedRoutesMax   = 20
+	routesSnapshotTimeout     = 5 * time.Second
+
+	closedQueueFull   = "queue full"
+	closedSendTimeout = "send timeout"
+	closedChannelFull = "channel full"
+)
+
+var errRoutesSnapshotTimeout = errors.New("Timeout while getting the routes from the router")
+
+// RouteStats are the delivery statistics of a route.
+type RouteStats struct {
+	Route            string     `json:"route"`
+	QueueSize        int        `json:"queueSize"`
+	OldestQueuedMsec int64      `json:"oldestQueuedMsec"`
+	Drops            int64      `json:"drops"`
+	CloseReason      string     `json:"closeReason,omitempty"`
+	ClosedAt         *time.Time `json:"closedAt,omitempty"`
+}
+
+// SlowConsumers is the report of the slow consumers endpoint.
+type SlowConsumers struct {
+	Routes         []RouteStats `json:"routes"`
+	RecentlyClosed []RouteStats `json:"recentlyClosed"`
+}
+
+var (
+	recentlyClosedRoutes      []RouteStats
+	recentlyClosedRoutesMutex sync.Mutex
+)
+
+// recordClosedRoute keeps the statistics of a route closed because of its slow consumer.
+func recordClosedRoute(stats RouteStats) {
+	recentlyClosedRoutesMutex.Lock()
+	defer recentlyClosedRoutesMutex.Unlock()
+
+	recentlyClosedRoutes = append(recentlyClosedRoutes, stats)
+	if len(recentlyClosedRoutes) > recentlyClosedRoutesMax {
+		recentlyClosedRoutes = recentlyClosedRoutes[len(recentlyClosedRoutes)-recentlyClosedRoutesMax:]
+	}
+}
+
+// recentlyClosed returns the routes recently closed because of their slow consumers, the latest first.
+func recentlyClosed() []RouteStats {
+	recentlyClosedRoutesMutex.Lock()
+	defer recentlyClosedRoutesMutex.Unlock()
+
+	closed := make([]RouteStats, 0, len(recentlyClosedRoutes))
+	for i := len(recentlyClosedRoutes) - 1; i >= 0; i-- {
+		closed = append(closed, recentlyClosedRoutes[i])
+	}
+	return closed
+}
+
+// rankRoutes sorts the statistics from the slowest route: by the age of the oldest queued message,
+// then by the queue size and the number of drops.
+func rankRoutes(stats []RouteStats) {
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].OldestQueuedMsec != stats[j].OldestQueuedMsec {
+			return stats[i].OldestQueuedMsec > stats[j].OldestQueuedMsec
+		}
+		if stats[i].QueueSize != stats[j].QueueSize {
+			return stats[i].QueueSize > stats[j].QueueSize
+		}
+		return stats[i].Drops > stats[j].Drops
+	})
+}
+
+// routesSnapshot returns all the current routes, read by the goroutine of the router.
+func (router *router) routesSnapshot() ([]*Route, error) {
+	replyC := make(chan []*Route, 1)
+	select {
+	case router.routesC <- replyC:
+	case <-time.After(routesSnapshotTimeout):
+		return nil, errRoutesSnapshotTimeout
+	}
+	select {
+	case routes := <-replyC:
+		return routes, nil
+	case <-time.After(routesSnapshotTimeout):
+		return nil, errRoutesSnapshotTimeout
+	}
+}
+
+func (router *router) allRoutes() []*Route {
+	var routes []*Route
+	for _, pathRoutes := range router.routes {
+		routes = append(routes, pathRoutes...)
+	}
+	return routes
+}
+
+// SlowConsumers returns the statistics of the limit slowest routes, and of the routes recently closed
+// because of their slow consumers.
+func (router *router) SlowConsumers(limit int) (*SlowConsumers, error) {
+	routes, err := router.routesSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]RouteStats, 0, len(routes))
+	for _, r := range routes {
+		stats = append(stats, r.Stats())
+	}
+	rankRoutes(stats)
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return &SlowConsumers{Routes: stats, RecentlyClosed: recentlyClosed()}, nil
+}
+
+// SlowConsumersEndpoint serves the report of the slowest routes (queue size, age of the oldest queued message, drops),
+// and of the routes recently closed because of their slow consumers.
+type SlowConsumersEndpoint struct {
+	router *router
+	prefix string
+}
+
+// NewSlowConsumersEndpoint returns the endpoint reporting the slow consumers of the router, at the prefix.
+func NewSlowConsumersEndpoint(r Router, prefix string) (*SlowConsumersEndpoint, error) {
+	rtr, ok := r.(*router)
+	if !ok {
+		return nil, ErrServiceNotProvided
+	}
+	return &SlowConsumersEndpoint{router: rtr, prefix: prefix}, nil
+}
+
+// GetPrefix returns the prefix of the endpoint.
+func (e *SlowConsumersEndpoint) GetPrefix() string {
+	return e.prefix
+}
+
+// ServeHTTP returns the SlowConsumers report, with at most `limit` routes (query parameter, default: 20).
+func (e *SlowConsumersEndpoint) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if req.Method != http.MethodGet {
+		http.Error(w, `{"error":"only HTTP GET is accepted"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	limit := defaultSlowConsumersLimit
+	if l := req.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			http.Error(w, `{"error":"invalid limit"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	report, err := e.router.SlowConsumers(limit)
+	if err != nil {
+		logger.WithError(err).Error("Could not report the slow consumers")
+		http.Error(w, `{"error":"router not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.WithError(err).Error("Error encoding data.")
+	}
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteStats_ClosedBecauseOfFullQueue(t *testing.T) {
+	a := assert.New(t)
+
+	r := testRoute()
+	r.queueSize = queueSize
+	r.timeout = -1 // blocking send: the messages stay queued
+
+	// fill the channel buffer, and then the queue (whose first message is blocked in the consumer)
+	for i := 0; i < chanSize; i++ {
+		a.NoError(r.Deliver(dummyMessageWithID, false))
+	}
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < queueSize; i++ {
+		a.NoError(r.Deliver(dummyMessageWithID, false))
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	stats := r.Stats()
+	a.Equal(r.Key(), stats.Route)
+	a.Equal(queueSize, stats.QueueSize)
+	a.True(stats.OldestQueuedMsec >= 20)
+	a.Equal(int64(0), stats.Drops)
+	a.Empty(stats.CloseReason)
+
+	a.Equal(ErrQueueFull, r.Deliver(dummyMessageWithID, false))
+
+	stats = r.Stats()
+	a.Equal(0, stats.QueueSize)
+	a.Equal(int64(queueSize+1), stats.Drops)
+	a.Equal(closedQueueFull, stats.CloseReason)
+	a.NotNil(stats.ClosedAt)
+
+	closed := recentlyClosed()
+	a.NotEmpty(closed)
+	a.Equal(closedQueueFull, closed[0].CloseReason)
+}
+
+func TestRankRoutes(t *testing.T) {
+	stats := []RouteStats{
+		{Route: "a", QueueSize: 1, OldestQueuedMsec: 10},
+		{Route: "b", QueueSize: 3},
+		{Route: "c", QueueSize: 1, OldestQueuedMsec: 200},
+		{Route: "d", Drops: 2},
+		{Route: "e", QueueSize: 3, Drops: 1},
+	}
+	rankRoutes(stats)
+
+	var ranked []string
+	for _, s := range stats {
+		ranked = append(ranked, s.Route)
+	}
+	assert.Equal(t, []string{"c", "a", "e", "b", "d"}, ranked)
+}
+
+func TestSlowConsumersEndpoint(t *testing.T) {
+	a := assert.New(t)
+
+	router, _, _, _ := aStartedRouter()
+	defer router.Stop()
+	for _, path := range []string{"/fast", "/slow"} {
+		route := NewRoute(RouteConfig{Path: protocol.Path(path), ChannelSize: 1, queueSize: -1, timeout: -1})
+		_, err := router.Subscribe(route)
+		a.NoError(err)
+	}
+	for i := 0; i < 5; i++ {
+		a.NoError(router.HandleMessage(&protocol.Message{Path: "/slow", Body: []byte("x")}))
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	endpoint, err := NewSlowConsumersEndpoint(router, DefaultSlowConsumersPrefix)
+	a.NoError(err)
+	a.Equal(DefaultSlowConsumersPrefix, endpoint.GetPrefix())
+
+	rec := httptest.NewRecorder()
+	endpoint.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/router/slow?limit=1", nil))
+	a.Equal(http.StatusOK, rec.Code)
+
+	var report SlowConsumers
+	a.NoError(json.Unmarshal(rec.Body.Bytes(), &report))
+	a.Len(report.Routes, 1)
+	a.Equal("/slow ", report.Routes[0].Route)
+	// one message is in the channel of the route, the other ones are queued
+	a.Equal(4, report.Routes[0].QueueSize)
+	a.True(report.Routes[0].OldestQueuedMsec > 0)
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smancke/guble/protocol"
+)
+
+// otherTopics is the key of the topics counted together, once TopicMetricsMax topics are tracked
+const otherTopics = "other"
+
+var (
+	// TopicMetricsDepth is the number of levels of the topics kept in the per-topic metrics,
+	// e.g. "/foo" for "/foo/bar" with a depth of 1; the per-topic metrics are disabled if it is 0.
+	TopicMetricsDepth = 0
+
+	// TopicMetricsMax is the maximum number of topics tracked separately in the per-topic metrics.
+	TopicMetricsMax = 100
+
+	trackedTopics      = make(map[string]bool)
+	trackedTopicsMutex sync.Mutex
+)
+
+// topicKey returns the key of the topic in the per-topic metrics, bounding their cardinality.
+func topicKey(path protocol.Path) string {
+	levels := strings.SplitN(strings.TrimPrefix(string(path), "/"), "/", TopicMetricsDepth+1)
+	if len(levels) > TopicMetricsDepth {
+		levels = levels[:TopicMetricsDepth]
+	}
+	key := "/" + strings.Join(levels, "/")
+
+	trackedTopicsMutex.Lock()
+	defer trackedTopicsMutex.Unlock()
+	if !trackedTopics[key] {
+		if len(trackedTopics) >= TopicMetricsMax {
+			return otherTopics
+		}
+		trackedTopics[key] = true
+	}
+	return key
+}
+
+// countPublished counts a message stored by the router.
+func countPublished(message *protocol.Message) {
+	if TopicMetricsDepth <= 0 {
+		return
+	}
+	mTotalTopicPublishedMessages.Add(topicKey(message.Path), 1)
+}
+
+// countDelivered counts a message sent to a route, and the time since it was received.
+func countDelivered(message *protocol.Message) {
+	var latency time.Duration
+	if !message.ReceivedAt.IsZero() {
+		latency = time.Since(message.ReceivedAt)
+		mDeliveryLatency.Observe(latency)
+	}
+	if TopicMetricsDepth <= 0 {
+		return
+	}
+	key := topicKey(message.Path)
+	mTotalTopicDeliveredMessages.Add(key, 1)
+	if !message.ReceivedAt.IsZero() {
+		mTotalTopicDeliveryLatencyMsec.Add(key, int64(latency/time.Millisecond))
+	}
+}
+
+func resetTopicMetrics() {
+	mTotalTopicPublishedMessages.Init()
+	mTotalTopicDeliveredMessages.Init()
+	mTotalTopicDeliveryLatencyMsec.Init()
+
+	trackedTopicsMutex.Lock()
+	defer trackedTopicsMutex.Unlock()
+	trackedTopics = make(map[string]bool)
+}
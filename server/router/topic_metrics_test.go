@@ -0,0 +1,51 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicKeyBoundsTheCardinality(t *testing.T) {
+	a := assert.New(t)
+	defer func(depth, max int) {
+		TopicMetricsDepth, TopicMetricsMax = depth, max
+		resetTopicMetrics()
+	}(TopicMetricsDepth, TopicMetricsMax)
+
+	TopicMetricsDepth, TopicMetricsMax = 2, 2
+	resetTopicMetrics()
+
+	a.Equal("/foo/bar", topicKey(protocol.Path("/foo/bar/baz")))
+	a.Equal("/foo", topicKey(protocol.Path("/foo")))
+	a.Equal(otherTopics, topicKey(protocol.Path("/marvin/zaphod")))
+	// the tracked topics are still counted separately
+	a.Equal("/foo/bar", topicKey(protocol.Path("/foo/bar/qux")))
+}
+
+func TestRouter_CountsOnlyStoredMessages(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+	defer func(depth int) {
+		TopicMetricsDepth = depth
+		resetTopicMetrics()
+	}(TopicMetricsDepth)
+
+	TopicMetricsDepth = 1
+	resetTopicMetrics()
+
+	router, r := aRouterRoute(chanSize)
+	a.NoError(router.HandleMessage(&protocol.Message{Path: r.Path, Body: aTestByteMessage}))
+	a.Equal("1", mTotalTopicPublishedMessages.Get("/blah").String())
+
+	// a message which is not allowed is not counted
+	amMock := NewMockAccessManager(ctrl)
+	router.accessManager = amMock
+	amMock.EXPECT().IsAllowed(auth.WRITE, "", r.Path).Return(false)
+	a.Error(router.HandleMessage(&protocol.Message{Path: r.Path, Body: aTestByteMessage}))
+	a.Equal("1", mTotalTopicPublishedMessages.Get("/blah").String())
+}
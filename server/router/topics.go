@@ -0,0 +1,152 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/store"
+)
+
+// DefaultTopicsPrefix is the prefix of the topic administration endpoint
+const DefaultTopicsPrefix = "/admin/topics"
+
+// TopicStats are the statistics of a topic: the stored messages of its root topic (the partition of the store),
+// and the number of routes receiving its messages.
+type TopicStats struct {
+	Topic        string `json:"topic"`
+	Messages     uint64 `json:"messages"`
+	MaxMessageID uint64 `json:"maxMessageId"`
+	Subscribers  int    `json:"subscribers"`
+}
+
+// TopicsEndpoint lists the stored topics (GET on the prefix), returns the statistics of a topic (GET on the prefix
+// followed by the topic), and purges the stored messages of a root topic (DELETE on the prefix followed by the topic).
+type TopicsEndpoint struct {
+	router *router
+	prefix string
+}
+
+// NewTopicsEndpoint returns the topic administration endpoint of the router, at the prefix.
+func NewTopicsEndpoint(r Router, prefix string) (*TopicsEndpoint, error) {
+	rtr, ok := r.(*router)
+	if !ok {
+		return nil, ErrServiceNotProvided
+	}
+	return &TopicsEndpoint{router: rtr, prefix: strings.TrimSuffix(prefix, "/")}, nil
+}
+
+// GetPrefix returns the prefix of the endpoint, with a trailing slash for serving the topics under it.
+func (e *TopicsEndpoint) GetPrefix() string {
+	return e.prefix + "/"
+}
+
+func (e *TopicsEndpoint) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	topic := protocol.Path(strings.TrimPrefix(req.URL.Path, e.prefix))
+	if topic == "" || topic == "/" {
+		if req.Method != http.MethodGet {
+			http.Error(w, `{"error":"only HTTP GET is accepted"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		e.writeJSON(w, func() (interface{}, error) {
+			return e.router.topicsStats()
+		})
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		e.writeJSON(w, func() (interface{}, error) {
+			return e.router.topicStats(topic)
+		})
+	case http.MethodDelete:
+		if strings.Contains(topic.RemovePrefixSlash(), "/") {
+			http.Error(w, `{"error":"only the root topics can be purged"}`, http.StatusBadRequest)
+			return
+		}
+		purger, ok := e.router.messageStore.(store.Purger)
+		if !ok {
+			http.Error(w, `{"error":"the message store can not purge topics"}`, http.StatusNotImplemented)
+			return
+		}
+		if err := purger.Purge(topic.Partition()); err != nil {
+			logger.WithError(err).WithField("topic", topic).Error("Could not purge the topic")
+			http.Error(w, `{"error":"could not purge the topic"}`, http.StatusInternalServerError)
+			return
+		}
+		logger.WithField("topic", topic).Info("Purged topic")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"error":"only HTTP GET and DELETE are accepted"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+func (e *TopicsEndpoint) writeJSON(w http.ResponseWriter, result func() (interface{}, error)) {
+	value, err := result()
+	if err != nil {
+		logger.WithError(err).Error("Could not get the topic statistics")
+		http.Error(w, `{"error":"router or message store not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.WithError(err).Error("Error encoding data.")
+	}
+}
+
+// topicsStats returns the statistics of the root topics stored in the message store, ordered by topic.
+func (router *router) topicsStats() ([]TopicStats, error) {
+	if router.messageStore == nil {
+		return nil, ErrServiceNotProvided
+	}
+	partitions, err := router.messageStore.Partitions()
+	if err != nil {
+		return nil, err
+	}
+	routes, err := router.routesSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]TopicStats, 0, len(partitions))
+	for _, p := range partitions {
+		stats = append(stats, newTopicStats(protocol.Path("/"+p.Name()), p, routes))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Topic < stats[j].Topic
+	})
+	return stats, nil
+}
+
+// topicStats returns the statistics of the topic.
+func (router *router) topicStats(topic protocol.Path) (*TopicStats, error) {
+	if router.messageStore == nil {
+		return nil, ErrServiceNotProvided
+	}
+	p, err := router.messageStore.Partition(topic.Partition())
+	if err != nil {
+		return nil, err
+	}
+	routes, err := router.routesSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	stats := newTopicStats(topic, p, routes)
+	return &stats, nil
+}
+
+func newTopicStats(topic protocol.Path, p store.MessagePartition, routes []*Route) TopicStats {
+	stats := TopicStats{Topic: string(topic)}
+	if p != nil {
+		stats.Messages = p.Count()
+		stats.MaxMessageID = p.MaxMessageID()
+	}
+	for _, r := range routes {
+		if matchesTopic(topic, r.Path) {
+			stats.Subscribers++
+		}
+	}
+	return stats
+}
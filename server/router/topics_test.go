@@ -0,0 +1,71 @@
+package router
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/store/filestore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicsEndpoint(t *testing.T) {
+	a := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "guble_topics_test")
+	defer os.RemoveAll(dir)
+	router := New(auth.NewAllowAllAccessManager(true), filestore.New(dir), kvstore.NewMemoryKVStore(), nil).(*router)
+	a.NoError(router.Start())
+	defer router.Stop()
+
+	_, err := router.Subscribe(NewRoute(RouteConfig{Path: "/foo", ChannelSize: 10}))
+	a.NoError(err)
+	for _, path := range []protocol.Path{"/foo/bar", "/foo/baz", "/other"} {
+		a.NoError(router.HandleMessage(&protocol.Message{Path: path, Body: []byte("x")}))
+	}
+
+	endpoint, err := NewTopicsEndpoint(router, DefaultTopicsPrefix)
+	a.NoError(err)
+	a.Equal(DefaultTopicsPrefix+"/", endpoint.GetPrefix())
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		endpoint.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	// the stored root topics are listed
+	rec := serve(http.MethodGet, "/admin/topics")
+	a.Equal(http.StatusOK, rec.Code)
+	var list []TopicStats
+	a.NoError(json.Unmarshal(rec.Body.Bytes(), &list))
+	a.Len(list, 2)
+	a.Equal("/foo", list[0].Topic)
+	a.Equal(uint64(2), list[0].Messages)
+	a.Equal(1, list[0].Subscribers)
+	a.Equal("/other", list[1].Topic)
+	a.Equal(0, list[1].Subscribers)
+
+	// the statistics of a topic include the subscribers of its parent topics
+	rec = serve(http.MethodGet, "/admin/topics/foo/bar")
+	a.Equal(http.StatusOK, rec.Code)
+	var stats TopicStats
+	a.NoError(json.Unmarshal(rec.Body.Bytes(), &stats))
+	a.Equal("/foo/bar", stats.Topic)
+	a.Equal(uint64(2), stats.Messages)
+	a.True(stats.MaxMessageID > 0)
+	a.Equal(1, stats.Subscribers)
+
+	// only the root topics can be purged
+	a.Equal(http.StatusBadRequest, serve(http.MethodDelete, "/admin/topics/foo/bar").Code)
+	a.Equal(http.StatusNoContent, serve(http.MethodDelete, "/admin/topics/foo").Code)
+	a.NoError(json.Unmarshal(serve(http.MethodGet, "/admin/topics/foo").Body.Bytes(), &stats))
+	a.Equal(uint64(0), stats.Messages)
+
+	a.Equal(http.StatusMethodNotAllowed, serve(http.MethodPost, "/admin/topics").Code)
+}
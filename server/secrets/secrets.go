@@ -0,0 +1,145 @@
+// Package secrets resolves the secrets referenced by URIs in the configuration, instead of their plain-text values:
+// "env://<variable>" from the environment, and "vault://<path>#<key>" from HashiCorp Vault.
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// EnvScheme references an environment variable, e.g. "env://FCM_API_KEY"
+	EnvScheme = "env://"
+
+	// VaultScheme references a key of a Vault secret, e.g. "vault://secret/data/guble#fcm-api-key"
+	// (KV version 2, or "vault://secret/guble#fcm-api-key" with KV version 1)
+	VaultScheme = "vault://"
+
+	// DefaultVaultTimeout is the timeout of the requests to Vault
+	DefaultVaultTimeout = 10 * time.Second
+
+	vaultTokenHeader = "X-Vault-Token"
+)
+
+// Resolver resolves the secret URIs, reading each Vault secret once.
+type Resolver struct {
+	vaultAddress string
+	vaultToken   string
+	client       *http.Client
+	vaultSecrets map[string]map[string]interface{}
+}
+
+// NewResolver returns a Resolver reading the secrets from the Vault server at the address (e.g. "https://vault:8200")
+// with the token. The Vault token can itself be an "env://" URI, resolved only if a Vault secret is read.
+func NewResolver(vaultAddress, vaultToken string) *Resolver {
+	return &Resolver{
+		vaultAddress: strings.TrimSuffix(vaultAddress, "/"),
+		vaultToken:   vaultToken,
+		client:       &http.Client{Timeout: DefaultVaultTimeout},
+		vaultSecrets: make(map[string]map[string]interface{}),
+	}
+}
+
+// IsURI returns true if the value references a secret.
+func IsURI(value string) bool {
+	return strings.HasPrefix(value, EnvScheme) || strings.HasPrefix(value, VaultScheme)
+}
+
+// Resolve returns the secret referenced by the value, or the value itself if it is not a secret URI.
+func (r *Resolver) Resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, EnvScheme):
+		name := strings.TrimPrefix(value, EnvScheme)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("The environment variable %q of the secret is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, VaultScheme):
+		return r.resolveVault(strings.TrimPrefix(value, VaultScheme))
+	}
+	return value, nil
+}
+
+// ResolveAll replaces the secret URIs by the secrets, ignoring the nil values.
+func (r *Resolver) ResolveAll(values ...*string) error {
+	for _, value := range values {
+		if value == nil || !IsURI(*value) {
+			continue
+		}
+		secret, err := r.Resolve(*value)
+		if err != nil {
+			return err
+		}
+		*value = secret
+	}
+	return nil
+}
+
+func (r *Resolver) resolveVault(reference string) (string, error) {
+	i := strings.LastIndex(reference, "#")
+	if i <= 0 || i == len(reference)-1 {
+		return "", fmt.Errorf("Invalid Vault secret %q: expected %s<path>#<key>", reference, VaultScheme)
+	}
+	path, key := strings.Trim(reference[:i], "/"), reference[i+1:]
+	data, ok := r.vaultSecrets[path]
+	if !ok {
+		var err error
+		if data, err = r.readVault(path); err != nil {
+			return "", err
+		}
+		r.vaultSecrets[path] = data
+	}
+	switch secret := data[key].(type) {
+	case string:
+		return secret, nil
+	case nil:
+		return "", fmt.Errorf("The Vault secret %q has no key %q", path, key)
+	default:
+		return "", fmt.Errorf("The key %q of the Vault secret %q is not a string", key, path)
+	}
+}
+
+// readVault returns the data of the Vault secret: the "data" of a KV version 2 secret,
+// or the secret itself with KV version 1.
+func (r *Resolver) readVault(path string) (map[string]interface{}, error) {
+	if r.vaultAddress == "" {
+		return nil, fmt.Errorf("The Vault address is required for reading the secret %q", path)
+	}
+	if strings.HasPrefix(r.vaultToken, VaultScheme) {
+		return nil, fmt.Errorf("The Vault token can not be read from Vault")
+	}
+	token, err := r.Resolve(r.vaultToken)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, r.vaultAddress+"/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(vaultTokenHeader, token)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the Vault secret %q: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not read the Vault secret %q: status %d", path, resp.StatusCode)
+	}
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("Could not decode the Vault secret %q: %v", path, err)
+	}
+	if data, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, versioned := secret.Data["metadata"]; versioned {
+			return data, nil
+		}
+	}
+	return secret.Data, nil
+}
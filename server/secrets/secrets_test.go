@@ -0,0 +1,96 @@
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve_Env(t *testing.T) {
+	a := assert.New(t)
+	os.Setenv("GUBLE_TEST_SECRET", "s3cr3t")
+	defer os.Unsetenv("GUBLE_TEST_SECRET")
+
+	r := NewResolver("", "")
+	secret, err := r.Resolve("env://GUBLE_TEST_SECRET")
+	a.NoError(err)
+	a.Equal("s3cr3t", secret)
+
+	_, err = r.Resolve("env://GUBLE_TEST_MISSING")
+	a.Error(err)
+
+	// the other values are not secret URIs
+	secret, err = r.Resolve("plain-text")
+	a.NoError(err)
+	a.Equal("plain-text", secret)
+}
+
+func testVault(requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.Header.Get(vaultTokenHeader) != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/guble":
+			w.Write([]byte(`{"data":{"data":{"fcm-api-key":"fcm-key","apns-password":"apns"},"metadata":{"version":3}}}`))
+		case "/v1/kv/guble":
+			w.Write([]byte(`{"data":{"smtp-password":"smtp","port":25}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestResolveAll_Vault(t *testing.T) {
+	a := assert.New(t)
+	os.Setenv("GUBLE_TEST_VAULT_TOKEN", "vault-token")
+	defer os.Unsetenv("GUBLE_TEST_VAULT_TOKEN")
+
+	requests := 0
+	vault := testVault(&requests)
+	defer vault.Close()
+
+	fcmKey, apnsPassword, smtpPassword := "vault://secret/data/guble#fcm-api-key", "vault://secret/data/guble#apns-password", "vault://kv/guble#smtp-password"
+	plain := "plain"
+	r := NewResolver(vault.URL+"/", "env://GUBLE_TEST_VAULT_TOKEN")
+	a.NoError(r.ResolveAll(&fcmKey, &apnsPassword, &smtpPassword, &plain, nil))
+	a.Equal("fcm-key", fcmKey)
+	a.Equal("apns", apnsPassword)
+	a.Equal("smtp", smtpPassword)
+	a.Equal("plain", plain)
+
+	// each secret is read once
+	a.Equal(2, requests)
+}
+
+func TestResolve_VaultErrors(t *testing.T) {
+	a := assert.New(t)
+
+	requests := 0
+	vault := testVault(&requests)
+	defer vault.Close()
+
+	r := NewResolver(vault.URL, "vault-token")
+	for _, uri := range []string{
+		"vault://secret/data/guble",
+		"vault://secret/data/guble#",
+		"vault://secret/data/guble#missing",
+		"vault://kv/guble#port",
+		"vault://secret/data/other#key",
+	} {
+		_, err := r.Resolve(uri)
+		a.Error(err, uri)
+	}
+
+	_, err := NewResolver(vault.URL, "wrong-token").Resolve("vault://secret/data/guble#fcm-api-key")
+	a.Error(err)
+	_, err = NewResolver("", "vault-token").Resolve("vault://secret/data/guble#fcm-api-key")
+	a.Error(err)
+	_, err = NewResolver(vault.URL, "vault://secret/data/guble#token").Resolve("vault://secret/data/guble#fcm-api-key")
+	a.Error(err)
+}
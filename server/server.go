@@ -0,0 +1,335 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/smancke/guble/server/alerting"
+	"github.com/smancke/guble/server/audit"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/cluster"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/metrics"
+	"github.com/smancke/guble/server/quota"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/service"
+	"github.com/smancke/guble/server/store"
+	"github.com/smancke/guble/server/tracing"
+	"github.com/smancke/guble/server/webserver"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Option configures the guble server created by New.
+type Option func(*options) error
+
+// options are the components of the server given by the Options, instead of being created from the Config.
+type options struct {
+	accessManager auth.AccessManager
+	messageStore  store.MessageStore
+	kvStore       kvstore.KVStore
+	listeners     []*webserver.Listener
+	modules       []interface{}
+}
+
+// WithArgs sets the Config from the command line arguments of gubled (e.g. "--http", ":8080"), from the environment
+// variables and from the config file, like gubled does. Without it, the Config keeps its current values:
+// the options which were not parsed have no defaults.
+func WithArgs(args ...string) Option {
+	return func(o *options) error {
+		if err := loadConfigFile(args); err != nil {
+			return err
+		}
+		if _, err := kingpin.CommandLine.Parse(args); err != nil {
+			return err
+		}
+		parsed = true
+		return nil
+	}
+}
+
+// WithConfig changes the Config with the function, e.g. for enabling and configuring the connectors.
+func WithConfig(configure func(config *GubleConfig)) Option {
+	return func(o *options) error {
+		configure(Config)
+		return nil
+	}
+}
+
+// WithHTTPListen sets the address of the web server ("[Host]:Port").
+func WithHTTPListen(address string) Option {
+	return func(o *options) error {
+		*Config.HttpListen = address
+		return nil
+	}
+}
+
+// WithListener adds a listener to the web server, besides those of the Config.
+func WithListener(l *webserver.Listener) Option {
+	return func(o *options) error {
+		o.listeners = append(o.listeners, l)
+		return nil
+	}
+}
+
+// WithMessageStore uses the message store instead of the one of the Config (--ms).
+func WithMessageStore(messageStore store.MessageStore) Option {
+	return func(o *options) error {
+		o.messageStore = messageStore
+		return nil
+	}
+}
+
+// WithKVStore uses the key-value store instead of the one of the Config (--kvs).
+func WithKVStore(kvStore kvstore.KVStore) Option {
+	return func(o *options) error {
+		o.kvStore = kvStore
+		return nil
+	}
+}
+
+// WithAccessManager uses the access manager instead of allowing all the accesses (the ACL and the authorizer
+// of the Config still apply).
+func WithAccessManager(accessManager auth.AccessManager) Option {
+	return func(o *options) error {
+		o.accessManager = accessManager
+		return nil
+	}
+}
+
+// WithModules registers more modules in the service (e.g. connectors or endpoints of the application),
+// started after the router and the web server like the connectors.
+func WithModules(modules ...interface{}) Option {
+	return func(o *options) error {
+		o.modules = append(o.modules, modules...)
+		return nil
+	}
+}
+
+// WithDisabledModules disables modules of the server, like `--disable-module`.
+func WithDisabledModules(names ...string) Option {
+	return func(o *options) error {
+		*Config.DisabledModules = append(*Config.DisabledModules, names...)
+		return nil
+	}
+}
+
+// New creates a guble server (not started yet): its router, its web server and all the modules enabled
+// by the Config, which is changed by the options. It allows embedding guble in an application, e.g.
+//
+//	srv, err := server.New(server.WithArgs(), server.WithHTTPListen(":8080"), server.WithMessageStore(ms))
+//	if err == nil {
+//		err = srv.Start()
+//	}
+//
+// The Config and the modules are global: only one server can be created at a time.
+func New(opts ...Option) (*service.Service, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	accessManager := o.accessManager
+	if accessManager == nil {
+		accessManager = CreateAccessManager()
+	}
+	messageStore := o.messageStore
+	if messageStore == nil {
+		messageStore = CreateMessageStore()
+	}
+	kvStore := o.kvStore
+	if kvStore == nil {
+		kvStore = CreateKVStore()
+	}
+
+	var acl *auth.ACLAccessManager
+	if *Config.ACL.Enabled {
+		var err error
+		if acl, err = auth.NewACLAccessManager(kvStore, Config.ACL); err != nil {
+			return nil, fmt.Errorf("Could not create the ACL: %v", err)
+		}
+		accessManager = acl
+	}
+	if *Config.Authorizer.URL != "" {
+		authorizer, err := auth.NewAuthorizer(Config.Authorizer)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create the authorizer: %v", err)
+		}
+		accessManager = auth.AccessManagers{accessManager, authorizer}
+	}
+	var users *auth.UserManager
+	if *Config.Users.Enabled {
+		users = auth.NewUserManager(kvStore, acl, Config.Users)
+	}
+	var err error
+	if tokenValidator, err = createTokenValidator(acl, users); err != nil {
+		return nil, err
+	}
+	if users != nil {
+		users.WithTokenValidator(tokenValidator)
+	}
+
+	cl, err := createCluster()
+	if err != nil {
+		return nil, err
+	}
+
+	router.TopicMetricsDepth = *Config.TopicMetrics.Depth
+	router.TopicMetricsMax = *Config.TopicMetrics.Max
+	r := router.New(accessManager, messageStore, kvStore, cl)
+	tlsConfig, err := webserver.NewTLSConfig(Config.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("Could not configure TLS: %v", err)
+	}
+	websrv := webserver.New(*Config.HttpListen).WithTLS(tlsConfig)
+	for _, definition := range *Config.Listeners {
+		l, err := webserver.ParseListener(definition)
+		if err != nil {
+			return nil, fmt.Errorf("Could not configure the listener: %v", err)
+		}
+		websrv.WithListener(l)
+	}
+	for _, l := range o.listeners {
+		websrv.WithListener(l)
+	}
+	if tlsConfig != nil && tlsConfig.ClientCAs != nil {
+		websrv.WithClientIdentity(*Config.TLS.ClientIdentity)
+	}
+	rateLimiter = nil
+	quotas = nil
+	if *Config.Quota.Enabled {
+		quotas = quota.New(kvStore, Config.Quota)
+	}
+	if *Config.RateLimit.Enabled {
+		rateLimiter = webserver.NewRateLimiter(Config.RateLimit).WithTokenValidator(tokenValidator)
+		if cl != nil {
+			rateLimiter.WithBroadcaster(cl)
+			cl.RateUsageHandler = rateLimiter
+		}
+		websrv.WithRateLimiter(rateLimiter)
+	}
+	ipFilters, err := createIPFilters()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range ipFilters {
+		websrv.WithIPFilter(f)
+	}
+	websrv.WithAdminAuth(webserver.NewAdminAuth(Config.AdminAuth, adminPrefixes()...).WithPublicEndpoints(*Config.HealthEndpoint))
+
+	srv := service.New(r, websrv).
+		HealthEndpoint(*Config.HealthEndpoint).
+		MetricsEndpoint(metricsEndpoint(*Config.MetricsEndpoint)).
+		PrometheusEndpoint(metricsEndpoint(*Config.PrometheusEndpoint)).
+		DrainEndpoint(*Config.Drain.Endpoint).
+		LifecycleTopic(*Config.LifecycleTopic)
+	if *Config.Debug.Enabled {
+		srv.DebugEndpoint(*Config.Debug.Endpoint, *Config.Debug.Token).CaptureDir(*Config.Debug.CaptureDir)
+	}
+	if *Config.Supervisor.Enabled {
+		srv.Supervise(*Config.Supervisor.Interval, *Config.Supervisor.MaxRestarts)
+	}
+
+	if !moduleDisabled(metricsModule) {
+		srv.RegisterModules(0, 6, metrics.NewRates(*Config.MetricsRatesInterval))
+		if *Config.StatsD.Address != "" {
+			srv.RegisterModules(0, 6, metrics.NewStatsD(Config.StatsD))
+		}
+		if *Config.MetricsHistory.Enabled {
+			srv.RegisterModules(1, 5, metrics.NewHistory(kvStore, Config.MetricsHistory))
+		}
+	}
+	if *Config.Audit.Path != "" {
+		srv.RegisterModules(0, 6, audit.New(Config.Audit))
+	}
+	if *Config.Tracing.Endpoint != "" {
+		srv.RegisterModules(0, 6, tracing.New(Config.Tracing))
+	}
+	if rateLimiter != nil {
+		srv.RegisterModules(0, 6, rateLimiter)
+	}
+
+	srv.RegisterModule(service.KVStoreModule, 0, 6, kvStore)
+	if acl != nil {
+		srv.RegisterModules(1, 5, acl)
+	}
+	if quotas != nil {
+		srv.RegisterModules(1, 5, quotas)
+	}
+	srv.RegisterModule(service.MessageStoreModule, 0, 6, messageStore)
+	srv.RegisterModules(4, 3, CreateModules(r)...)
+	if *Config.SlowConsumersEndpoint != "" {
+		endpoint, err := router.NewSlowConsumersEndpoint(r, *Config.SlowConsumersEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create the slow consumers endpoint: %v", err)
+		}
+		srv.RegisterModules(4, 3, endpoint)
+	}
+	if *Config.TopicsEndpoint != "" {
+		endpoint, err := router.NewTopicsEndpoint(r, *Config.TopicsEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create the topics endpoint: %v", err)
+		}
+		srv.RegisterModules(4, 3, endpoint)
+	}
+	if users != nil {
+		srv.RegisterModules(4, 3, users)
+	}
+	if len(*Config.Alerting.Rules) > 0 {
+		alerter, err := alerting.New(r, Config.Alerting)
+		if err != nil {
+			return nil, fmt.Errorf("Could not configure the alerting: %v", err)
+		}
+		srv.RegisterModules(4, 3, alerter)
+	}
+	if len(o.modules) > 0 {
+		srv.RegisterModules(4, 3, o.modules...)
+	}
+	return srv, nil
+}
+
+// createCluster returns the cluster of the node, or nil if it is started in standalone mode.
+func createCluster() (*cluster.Cluster, error) {
+	if *Config.Cluster.NodeID == 0 || moduleDisabled(clusterModule) {
+		logger.Info("Starting in standalone-mode")
+		return nil, nil
+	}
+	if err := validateClusterParams(*Config.Cluster.NodeID, *Config.Cluster.NodePort, *Config.Cluster.Remotes); err != nil {
+		return nil, err
+	}
+	discovery, err := clusterDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	secretKey, err := clusterSecretKey()
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Starting in cluster-mode")
+	cl, err := cluster.New(&cluster.Config{
+		ID:                   *Config.Cluster.NodeID,
+		Port:                 *Config.Cluster.NodePort,
+		Remotes:              *Config.Cluster.Remotes,
+		Sequencer:            *Config.Cluster.Sequencer,
+		Partitioning:         *Config.Cluster.Partitioning,
+		Replicas:             *Config.Cluster.Replicas,
+		Discovery:            discovery,
+		DiscoveryInterval:    *Config.Cluster.DiscoveryInterval,
+		SecretKey:            secretKey,
+		SplitBrainPolicy:     cluster.SplitBrainPolicy(*Config.Cluster.SplitBrain),
+		Size:                 *Config.Cluster.Size,
+		SubscriptionRegistry: *Config.Cluster.SubscriptionRegistry,
+		UserAffinity:         *Config.Cluster.UserAffinity,
+		HTTPAddress:          *Config.Cluster.HTTPAddress,
+		Snapshot:             *Config.Cluster.Snapshot,
+		SnapshotSchemas:      *Config.Cluster.SnapshotSchemas,
+		SnapshotMessages:     *Config.Cluster.SnapshotMessages,
+		PeerQueueSize:        *Config.Cluster.PeerQueueSize,
+		Protobuf:             *Config.Cluster.Protobuf,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Module could not be started (cluster): %v", err)
+	}
+	return cl, nil
+}
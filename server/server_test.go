@@ -0,0 +1,75 @@
+package server
+
+import (
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/store/dummystore"
+
+	"github.com/smancke/guble/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// appModule is a module of an application embedding guble.
+type appModule struct {
+	started bool
+}
+
+func (m *appModule) Start() error {
+	m.started = true
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	defer testutil.ResetDefaultRegistryHealthCheck()
+	defer func() { *Config.DisabledModules = nil }()
+
+	a := assert.New(t)
+
+	testHttpPort++
+	kvStore := kvstore.NewMemoryKVStore()
+	module := &appModule{}
+
+	// when creating a server with its components given as options
+	srv, err := New(
+		WithHTTPListen(fmt.Sprintf(":%d", testHttpPort)),
+		WithKVStore(kvStore),
+		WithMessageStore(dummystore.New(kvStore)),
+		WithConfig(func(config *GubleConfig) {
+			*config.FCM.Enabled = false
+			*config.APNS.Enabled = false
+		}),
+		WithDisabledModules("rest", metricsModule),
+		WithModules(module),
+	)
+	a.NoError(err)
+
+	// then the service has them, and the modules enabled by the config
+	var moduleNames []string
+	for _, iface := range srv.ModulesSortedByStartOrder() {
+		moduleNames = append(moduleNames, reflect.TypeOf(iface).String())
+	}
+	a.Equal("*kvstore.MemoryKVStore *dummystore.DummyMessageStore *router.router *webserver.WebServer *websocket.WSHandler *server.appModule",
+		strings.Join(moduleNames, " "))
+	a.Equal(fmt.Sprintf(":%d", testHttpPort), *Config.HttpListen)
+
+	// and it can be started and stopped by the application
+	a.NoError(srv.Start())
+	a.True(module.started)
+	a.NoError(srv.Stop())
+}
+
+func TestNew_Errors(t *testing.T) {
+	a := assert.New(t)
+
+	*Config.Listeners = []string{"unix:/run/guble.sock?tls=true"}
+	defer func() { *Config.Listeners = nil }()
+
+	kvStore := kvstore.NewMemoryKVStore()
+	_, err := New(WithKVStore(kvStore), WithMessageStore(dummystore.New(kvStore)))
+	a.Error(err)
+	a.Contains(err.Error(), "Could not configure the listener")
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// The kinds of the profiles captured to files.
+const (
+	CaptureCPU   = "cpu"
+	CaptureHeap  = "heap"
+	CaptureTrace = "trace"
+)
+
+const (
+	defaultCaptureDuration = 30 * time.Second
+	maxCaptureDuration     = 10 * time.Minute
+)
+
+// ErrCaptureRunning is returned when a capture of the same kind is already running.
+var ErrCaptureRunning = errors.New("A capture of this kind is already running")
+
+var (
+	capturesMutex sync.Mutex
+	captures      = make(map[string]bool)
+)
+
+// CaptureProfile records a CPU profile or a runtime execution trace during the duration, or writes a heap profile
+// at its end, to a new file of the directory (the temporary directory if it is empty). It returns the path of the file.
+func CaptureProfile(kind string, dir string, duration time.Duration) (string, error) {
+	var start func(f *os.File) error
+	var stop func()
+	ext := ".pprof"
+	switch kind {
+	case CaptureCPU:
+		start, stop = func(f *os.File) error { return runtimepprof.StartCPUProfile(f) }, runtimepprof.StopCPUProfile
+	case CaptureTrace:
+		start, stop = func(f *os.File) error { return trace.Start(f) }, trace.Stop
+		ext = ".trace"
+	case CaptureHeap:
+	default:
+		return "", fmt.Errorf("Unknown profile %q: use %s, %s or %s", kind, CaptureCPU, CaptureHeap, CaptureTrace)
+	}
+
+	capturesMutex.Lock()
+	if captures[kind] {
+		capturesMutex.Unlock()
+		return "", ErrCaptureRunning
+	}
+	captures[kind] = true
+	capturesMutex.Unlock()
+	defer func() {
+		capturesMutex.Lock()
+		delete(captures, kind)
+		capturesMutex.Unlock()
+	}()
+
+	f, err := ioutil.TempFile(dir, "guble-"+kind+"-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	logger.WithFields(log.Fields{
+		"profile":  kind,
+		"file":     f.Name(),
+		"duration": duration,
+	}).Info("Capturing profile")
+
+	if start != nil {
+		if err := start(f); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+		time.Sleep(duration)
+		stop()
+	} else {
+		time.Sleep(duration)
+		runtime.GC()
+		if err := runtimepprof.WriteHeapProfile(f); err != nil {
+			return "", err
+		}
+	}
+	return f.Name(), f.Close()
+}
+
+// CaptureDir sets the directory of the profiles captured with POST requests to <debug endpoint>/capture/<kind>
+// (the temporary directory if it is empty). Returns the updated service.
+func (s *Service) CaptureDir(dir string) *Service {
+	s.captureDir = dir
+	return s
+}
+
+// serveCapture captures the profile of the kind given in the path, for the duration of the request parameter,
+// and returns the path of its file.
+func (s *Service) serveCapture(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "only HTTP POST is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	kind := strings.TrimPrefix(req.URL.Path, s.debugEndpoint+"/capture/")
+	duration := defaultCaptureDuration
+	switch kind {
+	case CaptureCPU, CaptureTrace:
+	case CaptureHeap:
+		duration = 0
+	default:
+		http.Error(w, fmt.Sprintf("unknown profile %q", kind), http.StatusNotFound)
+		return
+	}
+	if value := req.URL.Query().Get("duration"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 || d > maxCaptureDuration {
+			http.Error(w, fmt.Sprintf("invalid duration %q (maximum: %v)", value, maxCaptureDuration), http.StatusBadRequest)
+			return
+		}
+		duration = d
+	}
+
+	path, err := CaptureProfile(kind, s.captureDir, duration)
+	switch {
+	case err == ErrCaptureRunning:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		logger.WithError(err).WithField("profile", kind).Error("Could not capture the profile")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"profile":  kind,
+		"file":     path,
+		"duration": duration.String(),
+	})
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smancke/guble/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureProfile(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guble_capture_test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	for _, kind := range []string{CaptureCPU, CaptureHeap, CaptureTrace} {
+		path, err := CaptureProfile(kind, dir, 10*time.Millisecond)
+		a.NoError(err, kind)
+		a.Equal(dir, filepath.Dir(path))
+		a.True(strings.HasPrefix(filepath.Base(path), "guble-"+kind+"-"), path)
+		info, err := os.Stat(path)
+		a.NoError(err)
+		a.True(info.Size() > 0, kind)
+	}
+
+	_, err = CaptureProfile("goroutine", dir, 0)
+	a.Error(err)
+
+	// only one capture of a kind can run at a time
+	done := make(chan bool)
+	go func() {
+		CaptureProfile(CaptureTrace, dir, 100*time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_, err = CaptureProfile(CaptureTrace, dir, 0)
+	a.Equal(ErrCaptureRunning, err)
+	<-done
+}
+
+func TestDebugEndpoint_Capture(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guble_capture_test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	service, _, _, _ := aMockedServiceWithMockedRouterStandalone()
+	service.DebugEndpoint("/admin/debug", "").CaptureDir(dir)
+	handler := service.debugHandler()
+
+	request := func(method string, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := request(http.MethodPost, "/admin/debug/capture/heap")
+	a.Equal(http.StatusOK, rec.Code)
+	result := make(map[string]string)
+	a.NoError(json.Unmarshal(rec.Body.Bytes(), &result))
+	a.Equal(CaptureHeap, result["profile"])
+	a.Equal("0s", result["duration"])
+	a.Equal(dir, filepath.Dir(result["file"]))
+
+	rec = request(http.MethodPost, "/admin/debug/capture/cpu?duration=10ms")
+	a.Equal(http.StatusOK, rec.Code)
+	a.Contains(rec.Body.String(), `"duration":"10ms"`)
+
+	a.Equal(http.StatusMethodNotAllowed, request(http.MethodGet, "/admin/debug/capture/heap").Code)
+	a.Equal(http.StatusNotFound, request(http.MethodPost, "/admin/debug/capture/goroutine").Code)
+	a.Equal(http.StatusBadRequest, request(http.MethodPost, "/admin/debug/capture/cpu?duration=1h").Code)
+	a.Equal(http.StatusBadRequest, request(http.MethodPost, "/admin/debug/capture/cpu?duration=soon").Code)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+	"strings"
+)
+
+// DebugEndpoint sets the endpoint serving the pprof profiles (e.g. <prefix>/pprof/heap, <prefix>/pprof/goroutine,
+// <prefix>/pprof/trace), a dump of the stacks of all the goroutines (<prefix>/goroutines), and capturing the profiles
+// to files on the server (POST <prefix>/capture/<cpu|heap|trace>?duration=30s, see CaptureDir).
+// If a token is given, the requests have to be authorized with the header "Authorization: Bearer <token>".
+// Parameter for disabling the endpoint is: "". Returns the updated service.
+func (s *Service) DebugEndpoint(endpointPrefix string, token string) *Service {
+	s.debugEndpoint = strings.TrimSuffix(endpointPrefix, "/")
+	s.debugToken = token
+	return s
+}
+
+// debugHandler returns the handler of the debug endpoint.
+func (s *Service) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.debugEndpoint+"/pprof/", func(w http.ResponseWriter, req *http.Request) {
+		// the index and the named profiles of net/http/pprof expect the path /debug/pprof/<name>
+		name := strings.TrimPrefix(req.URL.Path, s.debugEndpoint+"/pprof/")
+		if name == "" {
+			pprof.Index(w, req)
+			return
+		}
+		pprof.Handler(name).ServeHTTP(w, req)
+	})
+	mux.HandleFunc(s.debugEndpoint+"/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc(s.debugEndpoint+"/pprof/profile", pprof.Profile)
+	mux.HandleFunc(s.debugEndpoint+"/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc(s.debugEndpoint+"/pprof/trace", pprof.Trace)
+	mux.HandleFunc(s.debugEndpoint+"/goroutines", serveGoroutines)
+	mux.HandleFunc(s.debugEndpoint+"/capture/", s.serveCapture)
+	return s.authorizeDebug(mux)
+}
+
+// authorizeDebug rejects the requests without the bearer token, if one is configured.
+func (s *Service) authorizeDebug(handler http.Handler) http.Handler {
+	if s.debugToken == "" {
+		return handler
+	}
+	expected := []byte("Bearer " + s.debugToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+			logger.WithField("remoteAddr", req.RemoteAddr).Warn("Unauthorized request to the debug endpoint")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// serveGoroutines writes the stacks of all the goroutines, in the format of an unrecovered panic.
+func serveGoroutines(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := runtimepprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		logger.WithError(err).Error("Could not dump the goroutines")
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smancke/guble/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugEndpoint(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	service, _, _, _ := aMockedServiceWithMockedRouterStandalone()
+	service.DebugEndpoint("/admin/debug/", "secret")
+	handler := service.debugHandler()
+
+	get := func(path string, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	a.Equal(http.StatusUnauthorized, get("/admin/debug/goroutines", "").Code)
+	a.Equal(http.StatusUnauthorized, get("/admin/debug/goroutines", "Bearer wrong").Code)
+
+	rec := get("/admin/debug/goroutines", "Bearer secret")
+	a.Equal(http.StatusOK, rec.Code)
+	a.True(strings.Contains(rec.Body.String(), "goroutine "))
+
+	rec = get("/admin/debug/pprof/", "Bearer secret")
+	a.Equal(http.StatusOK, rec.Code)
+	a.True(strings.Contains(rec.Body.String(), "heap"))
+
+	rec = get("/admin/debug/pprof/heap?debug=1", "Bearer secret")
+	a.Equal(http.StatusOK, rec.Code)
+	a.True(strings.Contains(rec.Body.String(), "heap profile"))
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/docker/distribution/health"
+)
+
+// defaultDrainTimeout is the duration of draining the service through the drain endpoint, if not given in the request
+const defaultDrainTimeout = 30 * time.Second
+
+// IsDraining returns true if the service is draining its clients.
+func (s *Service) IsDraining() bool {
+	s.drainMutex.Lock()
+	defer s.drainMutex.Unlock()
+	return s.draining
+}
+
+// setDraining sets the draining state, which makes the health check fail.
+func (s *Service) setDraining(draining bool) {
+	s.drainMutex.Lock()
+	defer s.drainMutex.Unlock()
+
+	s.draining = draining
+	if draining && !s.drainChecking {
+		s.drainChecking = true
+		health.RegisterFunc("draining", func() error {
+			if s.IsDraining() {
+				return ErrDraining
+			}
+			return nil
+		})
+	}
+}
+
+// Resume ends the draining of the service: the health check passes again, and the Resumable modules accept new clients.
+func (s *Service) Resume() {
+	logger.Info("Resuming service")
+	s.setDraining(false)
+	for _, iface := range s.modulesSortedBy(ascendingStartOrder) {
+		if r, ok := iface.(Resumable); ok {
+			r.Resume()
+		}
+	}
+}
+
+// serveDrain handles the drain endpoint:
+// POST drains the service (with the optional `peer` and `timeout` query parameters) in the background,
+// DELETE resumes it, and GET returns the draining state.
+func (s *Service) serveDrain(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch req.Method {
+	case http.MethodPost:
+		timeout := defaultDrainTimeout
+		if t := req.URL.Query().Get("timeout"); t != "" {
+			d, err := time.ParseDuration(t)
+			if err != nil {
+				http.Error(w, `{"error":"invalid timeout"}`, http.StatusBadRequest)
+				return
+			}
+			timeout = d
+		}
+		peer := req.URL.Query().Get("peer")
+		s.setDraining(true)
+		go func() {
+			if err := s.Drain(peer, timeout); err != nil {
+				logger.WithError(err).Error("Errors occurred while draining service")
+			}
+		}()
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodDelete:
+		s.Resume()
+	case http.MethodGet:
+	default:
+		http.Error(w, `{"error":"only HTTP GET, POST and DELETE are accepted"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]bool{"draining": s.IsDraining()})
+}
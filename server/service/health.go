@@ -0,0 +1,123 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/health"
+)
+
+const (
+	// HealthUp is the status of the service, or of a module, passing its health checks
+	HealthUp = "up"
+	// HealthDown is the status of the service, or of a module, failing its health checks
+	HealthDown = "down"
+	// HealthUnknown is the status of a module which was not checked yet
+	HealthUnknown = "unknown"
+)
+
+// ModuleHealth is the detailed health status of a module.
+type ModuleHealth struct {
+	Status              string     `json:"status"`
+	LastCheck           *time.Time `json:"lastCheck,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Error               string     `json:"error,omitempty"`
+}
+
+// HealthStatus is the detailed health status of the service, returned by the health endpoint
+// when called with the `detailed` query parameter.
+type HealthStatus struct {
+	Status   string                  `json:"status"`
+	Draining bool                    `json:"draining"`
+	Errors   map[string]string       `json:"errors,omitempty"`
+	Modules  map[string]ModuleHealth `json:"modules"`
+}
+
+// healthTracker keeps the result of the last health check of each module.
+type healthTracker struct {
+	modules map[string]*ModuleHealth
+	mutex   sync.Mutex
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{modules: make(map[string]*ModuleHealth)}
+}
+
+// checked wraps the health check of a module, recording its result.
+func (h *healthTracker) checked(name string, check func() error) func() error {
+	h.mutex.Lock()
+	if _, ok := h.modules[name]; !ok {
+		h.modules[name] = &ModuleHealth{Status: HealthUnknown}
+	}
+	h.mutex.Unlock()
+
+	return func() error {
+		err := check()
+		now := time.Now()
+
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		m, ok := h.modules[name]
+		if !ok {
+			m = &ModuleHealth{}
+			h.modules[name] = m
+		}
+		m.LastCheck = &now
+		if err != nil {
+			m.Status = HealthDown
+			m.ConsecutiveFailures++
+			m.Error = err.Error()
+		} else {
+			m.Status = HealthUp
+			m.ConsecutiveFailures = 0
+			m.Error = ""
+		}
+		return err
+	}
+}
+
+// snapshot returns a copy of the health of the modules.
+func (h *healthTracker) snapshot() map[string]ModuleHealth {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	modules := make(map[string]ModuleHealth, len(h.modules))
+	for name, m := range h.modules {
+		modules[name] = *m
+	}
+	return modules
+}
+
+// HealthStatus returns the detailed health status of the service: the aggregate status is down
+// if any registered health check fails (taking into account the threshold of failures), or while draining.
+func (s *Service) HealthStatus() HealthStatus {
+	errors := health.CheckStatus()
+	status := HealthStatus{
+		Status:   HealthUp,
+		Draining: s.IsDraining(),
+		Modules:  s.health.snapshot(),
+	}
+	if len(errors) > 0 {
+		status.Status = HealthDown
+		status.Errors = errors
+	}
+	return status
+}
+
+// serveHealth handles the health endpoint: with the `detailed` query parameter it returns the HealthStatus,
+// otherwise only the failing checks (as the default health handler).
+func (s *Service) serveHealth(w http.ResponseWriter, req *http.Request) {
+	if _, detailed := req.URL.Query()["detailed"]; !detailed || req.URL.Query().Get("detailed") == "false" {
+		health.StatusHandler(w, req)
+		return
+	}
+	status := s.HealthStatus()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if status.Status != HealthUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logger.WithError(err).Error("Could not encode the health status")
+	}
+}
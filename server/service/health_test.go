@@ -0,0 +1,76 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smancke/guble/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthTracker(t *testing.T) {
+	a := assert.New(t)
+	h := newHealthTracker()
+
+	healthy := false
+	check := h.checked("module", func() error {
+		if healthy {
+			return nil
+		}
+		return errors.New("sick")
+	})
+	a.Equal(HealthUnknown, h.snapshot()["module"].Status)
+	a.Nil(h.snapshot()["module"].LastCheck)
+
+	a.Error(check())
+	a.Error(check())
+	m := h.snapshot()["module"]
+	a.Equal(HealthDown, m.Status)
+	a.Equal(2, m.ConsecutiveFailures)
+	a.Equal("sick", m.Error)
+	a.NotNil(m.LastCheck)
+
+	healthy = true
+	a.NoError(check())
+	m = h.snapshot()["module"]
+	a.Equal(HealthUp, m.Status)
+	a.Equal(0, m.ConsecutiveFailures)
+	a.Equal("", m.Error)
+}
+
+func TestDetailedHealthEndpoint(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	defer testutil.ResetDefaultRegistryHealthCheck()
+	a := assert.New(t)
+
+	service, _, _, _ := aMockedServiceWithMockedRouterStandalone()
+	check := service.health.checked("module", func() error { return errors.New("sick") })
+	check()
+
+	// the aggregate status only follows the registered health checks
+	rec := httptest.NewRecorder()
+	service.serveHealth(rec, httptest.NewRequest(http.MethodGet, "/health?detailed", nil))
+	a.Equal(http.StatusOK, rec.Code)
+
+	var status HealthStatus
+	a.NoError(json.Unmarshal(rec.Body.Bytes(), &status))
+	a.Equal(HealthUp, status.Status)
+	a.False(status.Draining)
+	a.Equal(HealthDown, status.Modules["module"].Status)
+	a.Equal(1, status.Modules["module"].ConsecutiveFailures)
+	a.Equal("sick", status.Modules["module"].Error)
+
+	// while draining, the service is down
+	service.setDraining(true)
+	rec = httptest.NewRecorder()
+	service.serveHealth(rec, httptest.NewRequest(http.MethodGet, "/health?detailed=true", nil))
+	a.Equal(http.StatusServiceUnavailable, rec.Code)
+	a.NoError(json.Unmarshal(rec.Body.Bytes(), &status))
+	a.Equal(HealthDown, status.Status)
+	a.True(status.Draining)
+	a.Equal(ErrDraining.Error(), status.Errors["draining"])
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// DefaultLifecycleTopic is the reserved topic where the lifecycle events of the modules are published
+	DefaultLifecycleTopic = "/_guble/lifecycle"
+
+	// LifecycleStarted is the event of a module which was started
+	LifecycleStarted = "started"
+	// LifecycleStopping is the event of a module which is going to be stopped
+	LifecycleStopping = "stopping"
+	// LifecycleStopped is the event of a module which was stopped
+	LifecycleStopped = "stopped"
+	// LifecycleHealthy is the event of a module passing again its health check
+	LifecycleHealthy = "healthy"
+	// LifecycleUnhealthy is the event of a module failing its health check
+	LifecycleUnhealthy = "unhealthy"
+
+	lifecycleUserID = "guble"
+)
+
+// LifecycleEvent is the body of the messages published to the lifecycle topic.
+type LifecycleEvent struct {
+	Module string `json:"module"`
+	Event  string `json:"event"`
+	Error  string `json:"error,omitempty"`
+	Time   int64  `json:"time"`
+}
+
+// lifecycle publishes the lifecycle events through the router.
+// The events happening while the router is not running (e.g. the start of the stores) are not published.
+type lifecycle struct {
+	topic  protocol.Path
+	router router.Router
+
+	running bool
+	healthy map[string]bool
+	mutex   sync.Mutex
+}
+
+// LifecycleTopic sets the topic where the start, stop and health changes of the modules are published.
+// Parameter for disabling the events is: "". Returns the updated service.
+func (s *Service) LifecycleTopic(topic string) *Service {
+	if topic == "" {
+		s.lifecycle = nil
+		return s
+	}
+	s.lifecycle = &lifecycle{
+		topic:   protocol.Path(topic),
+		router:  s.router,
+		healthy: make(map[string]bool),
+	}
+	return s
+}
+
+// setRunning enables or disables the publishing, following the state of the router.
+func (l *lifecycle) setRunning(running bool) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.running = running
+}
+
+// publish sends an event of the module to the lifecycle topic, if the router is running.
+func (l *lifecycle) publish(name string, event string, err error) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	running := l.running
+	l.mutex.Unlock()
+	if !running {
+		return
+	}
+
+	e := LifecycleEvent{Module: name, Event: event, Time: time.Now().Unix()}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	body, jsonErr := json.Marshal(e)
+	if jsonErr != nil {
+		logger.WithError(jsonErr).Error("Could not encode lifecycle event")
+		return
+	}
+	if pubErr := l.router.HandleMessage(&protocol.Message{
+		Path:   l.topic,
+		UserID: lifecycleUserID,
+		Body:   body,
+	}); pubErr != nil {
+		logger.WithError(pubErr).WithField("module", name).Warn("Could not publish lifecycle event")
+	}
+}
+
+// checked wraps the health check of a module, publishing an event when its result changes.
+func (l *lifecycle) checked(name string, check func() error) func() error {
+	if l == nil {
+		return check
+	}
+	return func() error {
+		err := check()
+		healthy := err == nil
+
+		l.mutex.Lock()
+		previous, known := l.healthy[name]
+		l.healthy[name] = healthy
+		l.mutex.Unlock()
+
+		// a module is healthy until its first failed check
+		if !known {
+			previous = true
+		}
+		if previous != healthy {
+			if healthy {
+				l.publish(name, LifecycleHealthy, nil)
+			} else {
+				l.publish(name, LifecycleUnhealthy, err)
+			}
+		}
+		return err
+	}
+}
+
+// nameOf returns the name under which the module was registered.
+func (s *Service) nameOf(iface interface{}) string {
+	for _, m := range s.modules {
+		if reflect.TypeOf(m.iface).Comparable() && reflect.TypeOf(iface).Comparable() && m.iface == iface {
+			return m.name
+		}
+	}
+	return moduleName(iface)
+}
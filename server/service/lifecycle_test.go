@@ -0,0 +1,57 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleEvents(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	service, _, _, routerMock := aMockedServiceWithMockedRouterStandalone()
+	service.LifecycleTopic(DefaultLifecycleTopic)
+
+	var events []LifecycleEvent
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path(DefaultLifecycleTopic), m.Path)
+		var e LifecycleEvent
+		a.NoError(json.Unmarshal(m.Body, &e))
+		events = append(events, e)
+	}).AnyTimes()
+
+	// nothing is published before the router is running
+	service.lifecycle.publish("module", LifecycleStarted, nil)
+	a.Empty(events)
+
+	service.lifecycle.setRunning(true)
+	service.lifecycle.publish("module", LifecycleStarted, nil)
+
+	healthy := true
+	check := service.lifecycle.checked("module", func() error {
+		if healthy {
+			return nil
+		}
+		return errors.New("sick")
+	})
+	a.NoError(check())
+	healthy = false
+	a.Error(check())
+	a.Error(check())
+	healthy = true
+	a.NoError(check())
+
+	a.Len(events, 3)
+	a.Equal(LifecycleStarted, events[0].Event)
+	a.Equal(LifecycleUnhealthy, events[1].Event)
+	a.Equal("sick", events[1].Error)
+	a.Equal(LifecycleHealthy, events[2].Event)
+	a.Equal("module", events[2].Module)
+}
@@ -1,8 +1,19 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
 	"sort"
+	"time"
+)
+
+var (
+	ErrUnknownDependency = errors.New("Module depends on a module which is not registered")
+
+	ErrDependencyCycle = errors.New("The dependencies of the modules contain a cycle")
 )
 
 // Startable interface for modules which provide a start mechanism
@@ -15,6 +26,45 @@ type Stopable interface {
 	Stop() error
 }
 
+// ContextStartable interface for modules whose start follows the deadline and the cancellation of a context;
+// it is preferred over Startable
+type ContextStartable interface {
+	StartWithContext(ctx context.Context) error
+}
+
+// ContextStopable interface for modules whose stop follows the deadline and the cancellation of a context;
+// it is preferred over Stopable
+type ContextStopable interface {
+	StopWithContext(ctx context.Context) error
+}
+
+// Drainable interface for modules which can hand their clients over to another node before stopping
+type Drainable interface {
+	Drain(peer string, timeout time.Duration) error
+}
+
+// Named interface for modules which declare the name referenced by the dependencies of other modules;
+// by default, the name of a module is its type (e.g. "*router.router")
+type Named interface {
+	Name() string
+}
+
+// Ordered interface for modules which declare their start order, overriding the one given when registering them
+type Ordered interface {
+	StartupOrder() int
+}
+
+// Dependent interface for modules which should be started after the modules they depend on (and stopped before them),
+// whatever the order given when registering them
+type Dependent interface {
+	DependsOn() []string
+}
+
+// Resumable interface for modules which can accept new clients again after being drained
+type Resumable interface {
+	Resume()
+}
+
 // Endpoint adds a HTTP handler for the `GetPrefix()` to the webserver
 type Endpoint interface {
 	http.Handler
@@ -22,6 +72,7 @@ type Endpoint interface {
 }
 
 type module struct {
+	name       string
 	iface      interface{}
 	startLevel int
 	stopLevel  int
@@ -34,12 +85,13 @@ type moduleSorter struct {
 	by      func(m1, m2 *module) bool
 }
 
+// sort sorts the modules by the criteria; the modules having the same order keep their registration order.
 func (criteria by) sort(modules []module) {
 	ms := &moduleSorter{
 		modules: modules,
 		by:      criteria,
 	}
-	sort.Sort(ms)
+	sort.Stable(ms)
 }
 
 // functions implementing the sort.Interface
@@ -55,3 +107,194 @@ var ascendingStartOrder = func(m1, m2 *module) bool {
 var ascendingStopOrder = func(m1, m2 *module) bool {
 	return m1.stopLevel < m2.stopLevel
 }
+
+// moduleName returns the default name of the module, referenced by the dependencies of other modules.
+func moduleName(iface interface{}) string {
+	if n, ok := iface.(Named); ok {
+		return n.Name()
+	}
+	return reflect.TypeOf(iface).String()
+}
+
+// orderByDependencies returns the (already sorted) modules reordered so that each module comes after its dependencies,
+// or before them if reverse is true; otherwise the modules keep their order.
+// It returns ErrUnknownDependency or ErrDependencyCycle if the dependencies can not be satisfied.
+func orderByDependencies(modules []module, reverse bool) ([]interface{}, error) {
+	ordered, _, err := orderModules(modules, reverse)
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]interface{}, 0, len(ordered))
+	for _, m := range ordered {
+		sorted = append(sorted, m.iface)
+	}
+	return sorted, nil
+}
+
+// orderModules returns the reordered modules like orderByDependencies,
+// and for each of them the names of the modules which should come before it.
+func orderModules(modules []module, reverse bool) ([]module, map[string][]string, error) {
+	index := make(map[string]int, len(modules))
+	for i, m := range modules {
+		index[m.name] = i
+	}
+
+	// before[i] are the modules which should come before the module i
+	before := make([][]int, len(modules))
+	for i, m := range modules {
+		d, ok := m.iface.(Dependent)
+		if !ok {
+			continue
+		}
+		for _, name := range d.DependsOn() {
+			j, ok := index[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("%v: %s depends on %s", ErrUnknownDependency, m.name, name)
+			}
+			if reverse {
+				before[j] = append(before[j], i)
+			} else {
+				before[i] = append(before[i], j)
+			}
+		}
+	}
+
+	sorted := make([]module, 0, len(modules))
+	placed := make([]bool, len(modules))
+	for len(sorted) < len(modules) {
+		next := -1
+		for i := range modules {
+			if !placed[i] && allPlaced(before[i], placed) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, nil, ErrDependencyCycle
+		}
+		placed[next] = true
+		sorted = append(sorted, modules[next])
+	}
+
+	beforeNames := make(map[string][]string)
+	for i, indexes := range before {
+		for _, j := range indexes {
+			beforeNames[modules[i].name] = append(beforeNames[modules[i].name], modules[j].name)
+		}
+	}
+	return sorted, beforeNames, nil
+}
+
+// stopWaves groups the modules which can be stopped concurrently: the waves are stopped one after the other,
+// each one containing modules of the same stop order, none of them depending on another one.
+func stopWaves(modules []module) ([][]interface{}, error) {
+	by(ascendingStopOrder).sort(modules)
+	ordered, before, err := orderModules(modules, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var waves [][]interface{}
+	var wave []interface{}
+	inWave := make(map[string]bool)
+	level := 0
+	for _, m := range ordered {
+		if len(wave) > 0 && (m.stopLevel != level || anyIn(before[m.name], inWave)) {
+			waves = append(waves, wave)
+			wave = nil
+			inWave = make(map[string]bool)
+		}
+		wave = append(wave, m.iface)
+		inWave[m.name] = true
+		level = m.stopLevel
+	}
+	if len(wave) > 0 {
+		waves = append(waves, wave)
+	}
+	return waves, nil
+}
+
+func anyIn(names []string, set map[string]bool) bool {
+	for _, name := range names {
+		if set[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func allPlaced(indexes []int, placed []bool) bool {
+	for _, i := range indexes {
+		if !placed[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isStartable(iface interface{}) bool {
+	_, startable := iface.(Startable)
+	_, contextStartable := iface.(ContextStartable)
+	return startable || contextStartable
+}
+
+func isStopable(iface interface{}) bool {
+	_, stopable := iface.(Stopable)
+	_, contextStopable := iface.(ContextStopable)
+	return stopable || contextStopable
+}
+
+// startModule starts the module with the context, adapting the Startable modules.
+func startModule(ctx context.Context, iface interface{}) error {
+	if s, ok := iface.(ContextStartable); ok {
+		return s.StartWithContext(ctx)
+	}
+	if s, ok := iface.(Startable); ok {
+		return withContext(ctx, s.Start)
+	}
+	return nil
+}
+
+// stopModule stops the module with the context, adapting the Stopable modules.
+func stopModule(ctx context.Context, iface interface{}) error {
+	if s, ok := iface.(ContextStopable); ok {
+		return s.StopWithContext(ctx)
+	}
+	if s, ok := iface.(Stopable); ok {
+		return withContext(ctx, s.Stop)
+	}
+	return nil
+}
+
+// withContext calls the function of a module not supporting contexts, returning the error of the context
+// if it is done first (the function keeps running in the background); a panic of the function is propagated.
+func withContext(ctx context.Context, f func() error) error {
+	if ctx.Done() == nil {
+		// the context can not be cancelled
+		return f()
+	}
+
+	type result struct {
+		err       error
+		recovered interface{}
+	}
+	resultC := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				resultC <- result{recovered: r}
+			}
+		}()
+		resultC <- result{err: f()}
+	}()
+
+	select {
+	case r := <-resultC:
+		if r.recovered != nil {
+			panic(r.recovered)
+		}
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -4,13 +4,19 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/distribution/health"
 
+	"github.com/smancke/guble/server/audit"
+	"github.com/smancke/guble/server/kvstore"
 	"github.com/smancke/guble/server/metrics"
 	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/store"
 	"github.com/smancke/guble/server/webserver"
 
+	"context"
+	"errors"
 	"github.com/hashicorp/go-multierror"
 	"net/http"
 	"reflect"
+	"sync"
 	"time"
 )
 
@@ -19,15 +25,37 @@ const (
 	defaultHealthThreshold = 1
 )
 
+// The names of the modules registered by the service, or expected by its lookup helpers.
+const (
+	KVStoreModule      = "kvstore"
+	MessageStoreModule = "messagestore"
+	ClusterModule      = "cluster"
+	WebServerModule    = "webserver"
+)
+
+var ErrDraining = errors.New("Service is draining its clients before stopping")
+
 // Service is the main struct for controlling a guble server
 type Service struct {
-	webserver       *webserver.WebServer
-	router          router.Router
-	modules         []module
-	healthEndpoint  string
-	healthFrequency time.Duration
-	healthThreshold int
-	metricsEndpoint string
+	webserver          *webserver.WebServer
+	router             router.Router
+	modules            []module
+	healthEndpoint     string
+	healthFrequency    time.Duration
+	healthThreshold    int
+	metricsEndpoint    string
+	prometheusEndpoint string
+	drainEndpoint      string
+	debugEndpoint      string
+	debugToken         string
+	captureDir         string
+	supervisor         *supervisor
+	lifecycle          *lifecycle
+	health             *healthTracker
+
+	draining      bool
+	drainChecking bool
+	drainMutex    sync.Mutex
 }
 
 // New creates a new Service, using the given Router and WebServer.
@@ -39,14 +67,15 @@ func New(router router.Router, webserver *webserver.WebServer) *Service {
 		router:          router,
 		healthFrequency: defaultHealthFrequency,
 		healthThreshold: defaultHealthThreshold,
+		health:          newHealthTracker(),
 	}
 	cluster := router.Cluster()
 	if cluster != nil {
-		s.RegisterModules(1, 5, cluster)
+		s.RegisterModule(ClusterModule, 1, 5, cluster)
 		router.Cluster().Router = router
 	}
 	s.RegisterModules(2, 2, s.router)
-	s.RegisterModules(3, 4, s.webserver)
+	s.RegisterModule(WebServerModule, 3, 4, s.webserver)
 	return s
 }
 
@@ -59,16 +88,58 @@ func (s *Service) RegisterModules(startOrder int, stopOrder int, ifaces ...inter
 	}).Info("RegisterModules")
 
 	for _, i := range ifaces {
-		m := module{
-			iface:      i,
-			startLevel: startOrder,
-			stopLevel:  stopOrder,
+		s.RegisterModule(moduleName(i), startOrder, stopOrder, i)
+	}
+}
+
+// RegisterModule adds a module to the service under an explicit name, which can be used for looking it up
+// and in the dependencies of other modules.
+func (s *Service) RegisterModule(name string, startOrder int, stopOrder int, i interface{}) {
+	m := module{
+		name:       name,
+		iface:      i,
+		startLevel: startOrder,
+		stopLevel:  stopOrder,
+	}
+	if o, ok := i.(Ordered); ok {
+		m.startLevel = o.StartupOrder()
+	}
+	s.modules = append(s.modules, m)
+}
+
+// ModuleByName returns the module registered under the name, and false if there is none.
+// The modules registered without an explicit name are found by their Name(), or else by their type (e.g. "*router.router").
+func (s *Service) ModuleByName(name string) (interface{}, bool) {
+	for _, m := range s.modules {
+		if m.name == name {
+			return m.iface, true
+		}
+	}
+	return nil, false
+}
+
+// MessageStore returns the message store registered under MessageStoreModule, or nil.
+func (s *Service) MessageStore() store.MessageStore {
+	if iface, ok := s.ModuleByName(MessageStoreModule); ok {
+		if ms, ok := iface.(store.MessageStore); ok {
+			return ms
+		}
+	}
+	return nil
+}
+
+// KVStore returns the key-value store registered under KVStoreModule, or nil.
+func (s *Service) KVStore() kvstore.KVStore {
+	if iface, ok := s.ModuleByName(KVStoreModule); ok {
+		if kvs, ok := iface.(kvstore.KVStore); ok {
+			return kvs
 		}
-		s.modules = append(s.modules, m)
 	}
+	return nil
 }
 
-// HealthEndpoint sets the endpoint used for health. Parameter for disabling the endpoint is: "". Returns the updated service.
+// HealthEndpoint sets the endpoint used for health, which returns the detailed HealthStatus
+// when called with the `detailed` query parameter. Parameter for disabling the endpoint is: "". Returns the updated service.
 func (s *Service) HealthEndpoint(endpointPrefix string) *Service {
 	s.healthEndpoint = endpointPrefix
 	return s
@@ -80,15 +151,35 @@ func (s *Service) MetricsEndpoint(endpointPrefix string) *Service {
 	return s
 }
 
+// PrometheusEndpoint sets the endpoint used for the metrics in the Prometheus format. Parameter for disabling the endpoint is: "".
+// Returns the updated service.
+func (s *Service) PrometheusEndpoint(endpointPrefix string) *Service {
+	s.prometheusEndpoint = endpointPrefix
+	return s
+}
+
+// DrainEndpoint sets the endpoint used for draining and resuming the service. Parameter for disabling the endpoint is: "".
+// Returns the updated service.
+func (s *Service) DrainEndpoint(endpointPrefix string) *Service {
+	s.drainEndpoint = endpointPrefix
+	return s
+}
+
 // Start checks the modules for the following interfaces and registers and/or starts:
 //   Startable:
 //   health.Checker:
 //   Endpoint: Register the handler function of the Endpoint in the http service at prefix
 func (s *Service) Start() error {
+	return s.StartWithContext(context.Background())
+}
+
+// StartWithContext starts the service like Start, passing the context to the modules:
+// the ContextStartable modules use it directly, and the others are not waited for after it is done.
+func (s *Service) StartWithContext(ctx context.Context) error {
 	var multierr *multierror.Error
 	if s.healthEndpoint != "" {
 		logger.WithField("healthEndpoint", s.healthEndpoint).Info("Health endpoint")
-		s.webserver.Handle(s.healthEndpoint, http.HandlerFunc(health.StatusHandler))
+		s.webserver.Handle(s.healthEndpoint, http.HandlerFunc(s.serveHealth))
 	} else {
 		logger.Info("Health endpoint disabled")
 	}
@@ -98,20 +189,43 @@ func (s *Service) Start() error {
 	} else {
 		logger.Info("Metrics endpoint disabled")
 	}
-	for order, iface := range s.ModulesSortedByStartOrder() {
+	if s.prometheusEndpoint != "" {
+		logger.WithField("prometheusEndpoint", s.prometheusEndpoint).Info("Prometheus metrics endpoint")
+		s.webserver.Handle(s.prometheusEndpoint, http.HandlerFunc(metrics.PrometheusHandler))
+	}
+	if s.drainEndpoint != "" {
+		logger.WithField("drainEndpoint", s.drainEndpoint).Info("Drain endpoint")
+		s.webserver.Handle(s.drainEndpoint, audit.Handler(http.HandlerFunc(s.serveDrain)))
+	}
+	if s.debugEndpoint != "" {
+		logger.WithField("debugEndpoint", s.debugEndpoint).Info("Debug endpoint")
+		s.webserver.Handle(s.debugEndpoint+"/", audit.Handler(s.debugHandler()))
+	}
+	modules, err := s.modulesInOrder(ascendingStartOrder, false)
+	if err != nil {
+		logger.WithError(err).Error("Could not order the modules by their dependencies")
+		return err
+	}
+	for order, iface := range modules {
 		name := reflect.TypeOf(iface).String()
-		if s, ok := iface.(Startable); ok {
+		if isStartable(iface) {
 			logger.WithFields(log.Fields{"name": name, "order": order}).Info("Starting module")
-			if err := s.Start(); err != nil {
+			if err := startModule(ctx, iface); err != nil {
 				logger.WithError(err).WithField("name", name).Error("Error while starting module")
 				multierr = multierror.Append(multierr, err)
+			} else {
+				if iface == s.router {
+					s.lifecycle.setRunning(true)
+				}
+				s.lifecycle.publish(s.nameOf(iface), LifecycleStarted, nil)
 			}
 		} else {
 			logger.WithFields(log.Fields{"name": name, "order": order}).Debug("Module is not startable")
 		}
 		if c, ok := iface.(health.Checker); ok && s.healthEndpoint != "" {
 			logger.WithField("name", name).Info("Registering module as Health-Checker")
-			health.RegisterPeriodicThresholdFunc(name, s.healthFrequency, s.healthThreshold, health.CheckFunc(c.Check))
+			check := s.health.checked(s.nameOf(iface), s.lifecycle.checked(s.nameOf(iface), c.Check))
+			health.RegisterPeriodicThresholdFunc(name, s.healthFrequency, s.healthThreshold, health.CheckFunc(check))
 		}
 		if e, ok := iface.(Endpoint); ok {
 			prefix := e.GetPrefix()
@@ -119,23 +233,123 @@ func (s *Service) Start() error {
 			s.webserver.Handle(prefix, e)
 		}
 	}
+	if s.supervisor != nil {
+		s.supervisor.start(modules, s.nameOf)
+	}
 	return multierr.ErrorOrNil()
 }
 
-// Stop stops the registered modules in their given order
+// Stop stops the registered modules in their given order; a module is stopped before the modules it depends on.
 func (s *Service) Stop() error {
+	return s.StopWithContext(context.Background())
+}
+
+// StopWithContext stops the service like Stop, passing the context to the modules: the ContextStopable modules
+// use it directly, and the others are not waited for after it is done (e.g. after the deadline of the stop).
+func (s *Service) StopWithContext(ctx context.Context) error {
+	if s.supervisor != nil {
+		s.supervisor.stop()
+	}
+
+	waves, err := stopWaves(s.modules)
+	if err != nil {
+		logger.WithError(err).Error("Could not order the modules by their dependencies")
+		waves = nil
+		for _, iface := range s.modulesSortedBy(ascendingStopOrder) {
+			waves = append(waves, []interface{}{iface})
+		}
+	}
+
+	// the stopped events can not be published anymore after the router, so all the modules announce their stop first
+	for _, wave := range waves {
+		for _, iface := range wave {
+			if isStopable(iface) {
+				s.lifecycle.publish(s.nameOf(iface), LifecycleStopping, nil)
+			}
+		}
+	}
+
+	var multierr *multierror.Error
+	for order, wave := range waves {
+		if err := s.stopWave(ctx, order, wave); err != nil {
+			multierr = multierror.Append(multierr, err)
+		}
+	}
+	return multierr.ErrorOrNil()
+}
+
+// stopWave stops concurrently the modules of a wave, which do not depend on each other;
+// a panic of a module is propagated after all the modules of the wave were stopped.
+func (s *Service) stopWave(ctx context.Context, order int, wave []interface{}) error {
+	for _, iface := range wave {
+		if iface == s.router {
+			s.lifecycle.setRunning(false)
+		}
+	}
+
 	var multierr *multierror.Error
-	for order, iface := range s.modulesSortedBy(ascendingStopOrder) {
+	var recovered interface{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, iface := range wave {
 		name := reflect.TypeOf(iface).String()
-		if s, ok := iface.(Stopable); ok {
-			logger.WithFields(log.Fields{"name": name, "order": order}).Info("Stopping module")
-			if err := s.Stop(); err != nil {
+		if !isStopable(iface) {
+			logger.WithFields(log.Fields{"name": name, "order": order}).Debug("Module is not stoppable")
+			continue
+		}
+		logger.WithFields(log.Fields{"name": name, "order": order}).Info("Stopping module")
+		wg.Add(1)
+		go func(iface interface{}) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					mutex.Lock()
+					recovered = r
+					mutex.Unlock()
+				}
+			}()
+			if err := stopModule(ctx, iface); err != nil {
+				mutex.Lock()
 				multierr = multierror.Append(multierr, err)
+				mutex.Unlock()
+				return
 			}
-		} else {
-			logger.WithFields(log.Fields{"name": name, "order": order}).Debug("Module is not stoppable")
+			s.lifecycle.publish(s.nameOf(iface), LifecycleStopped, nil)
+		}(iface)
+	}
+	wg.Wait()
+	if recovered != nil {
+		panic(recovered)
+	}
+	return multierr.ErrorOrNil()
+}
+
+// Drain prepares the stopping of the service: the health check fails from now on, so that no new clients are sent to it,
+// and the Drainable modules tell their clients to reconnect to the peer, within the timeout.
+func (s *Service) Drain(peer string, timeout time.Duration) error {
+	logger.WithFields(log.Fields{"peer": peer, "timeout": timeout}).Info("Draining service")
+	s.setDraining(true)
+
+	var multierr *multierror.Error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, iface := range s.modulesSortedBy(ascendingStopOrder) {
+		d, ok := iface.(Drainable)
+		if !ok {
+			continue
 		}
+		wg.Add(1)
+		go func(d Drainable, name string) {
+			defer wg.Done()
+			logger.WithField("name", name).Info("Draining module")
+			if err := d.Drain(peer, timeout); err != nil {
+				mutex.Lock()
+				multierr = multierror.Append(multierr, err)
+				mutex.Unlock()
+			}
+		}(d, reflect.TypeOf(iface).String())
 	}
+	wg.Wait()
 	return multierr.ErrorOrNil()
 }
 
@@ -144,9 +358,21 @@ func (s *Service) WebServer() *webserver.WebServer {
 	return s.webserver
 }
 
-// ModulesSortedByStartOrder returns the registered modules sorted by their startOrder property
+// ModulesSortedByStartOrder returns the registered modules sorted by their startOrder property,
+// each module coming after its dependencies.
 func (s *Service) ModulesSortedByStartOrder() []interface{} {
-	return s.modulesSortedBy(ascendingStartOrder)
+	modules, err := s.modulesInOrder(ascendingStartOrder, false)
+	if err != nil {
+		return s.modulesSortedBy(ascendingStartOrder)
+	}
+	return modules
+}
+
+// modulesInOrder returns the registered modules sorted using a `by` criteria, and then by their dependencies:
+// each module comes after its dependencies, or before them if reverse is true.
+func (s *Service) modulesInOrder(criteria by, reverse bool) ([]interface{}, error) {
+	by(criteria).sort(s.modules)
+	return orderByDependencies(s.modules, reverse)
 }
 
 // modulesSortedBy returns the registered modules sorted using a `by` criteria.
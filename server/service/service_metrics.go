@@ -0,0 +1,18 @@
+package service
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                    = metrics.NS("service")
+	mTotalRestarts        = ns.NewInt("total_restarts")
+	mTotalFailedRestarts  = ns.NewInt("total_failed_restarts")
+	mTotalRecoveredPanics = ns.NewInt("total_recovered_panics")
+)
+
+func resetSupervisorMetrics() {
+	mTotalRestarts.Set(0)
+	mTotalFailedRestarts.Set(0)
+	mTotalRecoveredPanics.Set(0)
+}
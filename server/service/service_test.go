@@ -9,10 +9,12 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -76,6 +78,22 @@ func TestEndpointRegisterAndServing(t *testing.T) {
 	a.Equal("bar", string(body))
 }
 
+func TestDrainingOfModules(t *testing.T) {
+	defer testutil.ResetDefaultRegistryHealthCheck()
+	a := assert.New(t)
+
+	service, _, _, _ := aMockedServiceWithMockedRouterStandalone()
+	drainable := &testDrainable{}
+	failing := &testDrainable{err: errors.New("could not drain")}
+	service.RegisterModules(0, 0, drainable, failing)
+
+	err := service.Drain("10.0.0.2:8080", time.Second)
+	a.Error(err)
+	a.Equal("10.0.0.2:8080", drainable.peer)
+	a.Equal(time.Second, drainable.timeout)
+	a.Equal("10.0.0.2:8080", failing.peer)
+}
+
 func TestHealthUp(t *testing.T) {
 	_, finish := testutil.NewMockCtrl(t)
 	defer finish()
@@ -196,3 +214,202 @@ type testStopable struct {
 func (*testStopable) Stop() error {
 	panic(fmt.Errorf("In a panic when I should stop"))
 }
+
+type testDrainable struct {
+	err     error
+	peer    string
+	timeout time.Duration
+}
+
+func (d *testDrainable) Drain(peer string, timeout time.Duration) error {
+	d.peer = peer
+	d.timeout = timeout
+	return d.err
+}
+
+type testOrderedModule struct {
+	name      string
+	order     int
+	dependsOn []string
+}
+
+func (m *testOrderedModule) Name() string        { return m.name }
+func (m *testOrderedModule) StartupOrder() int   { return m.order }
+func (m *testOrderedModule) DependsOn() []string { return m.dependsOn }
+
+func TestModulesOrderedByDependencies(t *testing.T) {
+	a := assert.New(t)
+
+	connector := &testOrderedModule{name: "connector", dependsOn: []string{"store"}}
+	store := &testOrderedModule{name: "store", order: 5}
+	cache := &testOrderedModule{name: "cache", order: 1}
+
+	s := &Service{}
+	s.RegisterModules(0, 0, connector, store, cache)
+
+	// the store is started before the connector, despite its startup order
+	a.Equal([]interface{}{cache, store, connector}, s.ModulesSortedByStartOrder())
+
+	stopOrder, err := s.modulesInOrder(ascendingStopOrder, true)
+	a.NoError(err)
+	// the connector is stopped before the store
+	a.Equal([]interface{}{connector, cache, store}, stopOrder)
+
+	store.dependsOn = []string{"connector"}
+	_, err = s.modulesInOrder(ascendingStartOrder, false)
+	a.Equal(ErrDependencyCycle, err)
+
+	store.dependsOn = []string{"database"}
+	_, err = s.modulesInOrder(ascendingStartOrder, false)
+	a.Error(err)
+	a.Error(s.Start())
+}
+
+type testResumable struct {
+	testDrainable
+	resumed bool
+}
+
+func (r *testResumable) Resume() {
+	r.resumed = true
+}
+
+func TestDrainEndpoint(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	defer testutil.ResetDefaultRegistryHealthCheck()
+	a := assert.New(t)
+
+	service, _, _, _ := aMockedServiceWithMockedRouterStandalone()
+	resumable := &testResumable{}
+	service.RegisterModules(0, 0, resumable)
+
+	serve := func(method, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		service.serveDrain(w, httptest.NewRequest(method, "/admin/drain"+query, nil))
+		return w
+	}
+
+	w := serve(http.MethodPost, "?peer=10.0.0.2:8080&timeout=1s")
+	a.Equal(http.StatusAccepted, w.Code)
+	a.JSONEq(`{"draining":true}`, w.Body.String())
+	a.True(service.IsDraining())
+
+	a.Equal(http.StatusBadRequest, serve(http.MethodPost, "?timeout=soon").Code)
+
+	w = serve(http.MethodDelete, "")
+	a.Equal(http.StatusOK, w.Code)
+	a.JSONEq(`{"draining":false}`, w.Body.String())
+	a.True(resumable.resumed)
+
+	a.JSONEq(`{"draining":false}`, serve(http.MethodGet, "").Body.String())
+	a.Equal(http.StatusMethodNotAllowed, serve(http.MethodPut, "").Code)
+}
+
+func TestModuleByName(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	service, kvStore, messageStore, _ := aMockedServiceWithMockedRouterStandalone()
+	a.Nil(service.MessageStore())
+
+	service.RegisterModule(KVStoreModule, 0, 0, kvStore)
+	service.RegisterModule(MessageStoreModule, 0, 0, messageStore)
+	service.RegisterModules(0, 0, &testOrderedModule{name: "named"}, &testEndpoint{})
+
+	a.Equal(messageStore, service.MessageStore())
+	a.Equal(kvStore, service.KVStore())
+
+	webserver, ok := service.ModuleByName(WebServerModule)
+	a.True(ok)
+	a.Equal(service.WebServer(), webserver)
+
+	_, ok = service.ModuleByName("named")
+	a.True(ok)
+	_, ok = service.ModuleByName("*service.testEndpoint")
+	a.True(ok)
+	_, ok = service.ModuleByName("unknown")
+	a.False(ok)
+}
+
+type testSlowStopable struct{}
+
+func (*testSlowStopable) Stop() error {
+	time.Sleep(time.Second)
+	return nil
+}
+
+type testContextModule struct {
+	started context.Context
+	stopped context.Context
+}
+
+func (m *testContextModule) StartWithContext(ctx context.Context) error {
+	m.started = ctx
+	return nil
+}
+
+func (m *testContextModule) StopWithContext(ctx context.Context) error {
+	m.stopped = ctx
+	return nil
+}
+
+func TestStopWithContext(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	defer testutil.ResetDefaultRegistryHealthCheck()
+	a := assert.New(t)
+
+	service, _, _, _ := aMockedServiceWithMockedRouterStandalone()
+	contextModule := &testContextModule{}
+	service.RegisterModules(0, 0, contextModule, &testSlowStopable{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.NoError(service.StartWithContext(ctx))
+	a.Equal(ctx, contextModule.started)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := service.StopWithContext(ctx)
+
+	// the slow module is not waited for after the deadline
+	a.Error(err)
+	a.True(time.Since(start) < 500*time.Millisecond)
+	a.Equal(ctx, contextModule.stopped)
+}
+
+type testNamedSlowStopable struct {
+	testOrderedModule
+	stopped time.Time
+}
+
+func (m *testNamedSlowStopable) Stop() error {
+	time.Sleep(100 * time.Millisecond)
+	m.stopped = time.Now()
+	return nil
+}
+
+func TestStopOfIndependentModulesInParallel(t *testing.T) {
+	a := assert.New(t)
+
+	first := &testNamedSlowStopable{testOrderedModule: testOrderedModule{name: "first"}}
+	second := &testNamedSlowStopable{testOrderedModule: testOrderedModule{name: "second"}}
+	dependent := &testNamedSlowStopable{testOrderedModule: testOrderedModule{name: "dependent", dependsOn: []string{"first"}}}
+
+	s := &Service{}
+	s.RegisterModules(0, 0, first, second, dependent)
+
+	waves, err := stopWaves(s.modules)
+	a.NoError(err)
+	a.Equal([][]interface{}{{second, dependent}, {first}}, waves)
+
+	start := time.Now()
+	a.NoError(s.Stop())
+
+	// the independent modules are stopped at the same time, and the dependency after its dependent
+	a.True(time.Since(start) < 300*time.Millisecond)
+	a.True(first.stopped.After(dependent.stopped))
+}
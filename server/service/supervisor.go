@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/health"
+)
+
+const (
+	defaultSupervisorInterval  = 10 * time.Second
+	defaultSupervisorRestarts  = 5
+	defaultSupervisorFailures  = 3
+	firstSupervisorRestartWait = time.Second
+
+	// supervisorRestartTimeout bounds the stop and the start of each module restarted by the supervisor
+	supervisorRestartTimeout = 30 * time.Second
+)
+
+// Panicking interface for modules recovering the panics of their goroutines (e.g. by embedding a PanicRecorder):
+// when supervised, a module is restarted as soon as one of its goroutines panicked.
+type Panicking interface {
+	// Panicked returns the last panic recovered since it was called, or nil
+	Panicked() error
+	// SetSupervised tells the module whether the panics of its goroutines are recovered (or propagated)
+	SetSupervised(supervised bool)
+}
+
+// PanicRecorder implements Panicking for the modules embedding it: their goroutines defer its Recover.
+type PanicRecorder struct {
+	mutex      sync.Mutex
+	supervised bool
+	err        error
+}
+
+// Recover records the panic of the goroutine deferring it, for the supervisor;
+// the panic is propagated if the module is not supervised.
+func (p *PanicRecorder) Recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.supervised {
+		panic(r)
+	}
+	logger.WithField("panic", r).Error("Recovered panic of a supervised module")
+	mTotalRecoveredPanics.Add(1)
+	p.err = fmt.Errorf("panic: %v", r)
+}
+
+// Panicked is a part of the Panicking implementation.
+func (p *PanicRecorder) Panicked() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	err := p.err
+	p.err = nil
+	return err
+}
+
+// SetSupervised is a part of the Panicking implementation.
+func (p *PanicRecorder) SetSupervised(supervised bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.supervised = supervised
+}
+
+// supervisor restarts the modules which fail repeatedly their health checks, panic when checked,
+// or report a panic of their goroutines, with an exponential backoff between the restarts of a module,
+// and up to a maximum number of restarts. The modules depending on a restarted module are restarted with it.
+type supervisor struct {
+	interval    time.Duration
+	maxRestarts int
+
+	modules []*supervisedModule
+
+	// all the modules, in their start order, and their names
+	ordered []interface{}
+	nameOf  func(interface{}) string
+
+	stopC chan struct{}
+	wg    sync.WaitGroup
+}
+
+type supervisedModule struct {
+	name     string
+	iface    interface{}
+	failures int
+	restarts int
+	nextWait time.Duration
+	notUntil time.Time
+}
+
+// Supervise enables the restarting of the modules (being Startable and Stopable) failing their health check
+// or reporting a panic (see Panicking): the modules are checked every interval, and restarted at most maxRestarts times.
+// Returns the updated service.
+func (s *Service) Supervise(interval time.Duration, maxRestarts int) *Service {
+	if interval <= 0 {
+		interval = defaultSupervisorInterval
+	}
+	if maxRestarts <= 0 {
+		maxRestarts = defaultSupervisorRestarts
+	}
+	s.supervisor = &supervisor{interval: interval, maxRestarts: maxRestarts}
+	return s
+}
+
+// start begins supervising the modules which can be restarted, given in their start order.
+func (sv *supervisor) start(modules []interface{}, nameOf func(interface{}) string) {
+	sv.ordered = modules
+	sv.nameOf = nameOf
+	sv.modules = nil
+	for _, iface := range modules {
+		_, checker := iface.(health.Checker)
+		p, panicking := iface.(Panicking)
+		if isStartable(iface) && isStopable(iface) && (checker || panicking) {
+			sv.modules = append(sv.modules, &supervisedModule{
+				name:     nameOf(iface),
+				iface:    iface,
+				nextWait: firstSupervisorRestartWait,
+			})
+			if panicking {
+				p.SetSupervised(true)
+			}
+		}
+	}
+	resetSupervisorMetrics()
+
+	sv.stopC = make(chan struct{})
+	sv.wg.Add(1)
+	go sv.loop()
+}
+
+func (sv *supervisor) stop() {
+	if sv.stopC == nil {
+		return
+	}
+	close(sv.stopC)
+	sv.wg.Wait()
+	sv.stopC = nil
+	for _, m := range sv.modules {
+		if p, ok := m.iface.(Panicking); ok {
+			p.SetSupervised(false)
+		}
+	}
+}
+
+func (sv *supervisor) loop() {
+	defer sv.wg.Done()
+	ticker := time.NewTicker(sv.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, m := range sv.modules {
+				sv.supervise(m)
+			}
+		case <-sv.stopC:
+			return
+		}
+	}
+}
+
+// supervise checks the module, and restarts it after defaultSupervisorFailures consecutive failures,
+// or after a panic of one of its goroutines.
+func (sv *supervisor) supervise(m *supervisedModule) {
+	var err error
+	if p, ok := m.iface.(Panicking); ok {
+		if err = p.Panicked(); err != nil {
+			m.failures = defaultSupervisorFailures - 1
+		}
+	}
+	if c, ok := m.iface.(health.Checker); ok && err == nil {
+		err = safely(c.Check)
+	}
+	if err == nil {
+		m.failures = 0
+		return
+	}
+	m.failures++
+	logger.WithFields(log.Fields{
+		"name":     m.name,
+		"failures": m.failures,
+		"error":    err.Error(),
+	}).Warn("Supervised module failed its health check")
+
+	if m.failures < defaultSupervisorFailures || time.Now().Before(m.notUntil) {
+		return
+	}
+	if m.restarts >= sv.maxRestarts {
+		if m.restarts == sv.maxRestarts {
+			logger.WithField("name", m.name).Error("Supervised module failed too many times, not restarting it anymore")
+			m.restarts++
+		}
+		return
+	}
+	sv.restart(m)
+}
+
+func (sv *supervisor) restart(m *supervisedModule) {
+	m.restarts++
+	logger.WithFields(log.Fields{
+		"name":     m.name,
+		"restarts": m.restarts,
+	}).Warn("Restarting supervised module")
+	mTotalRestarts.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), supervisorRestartTimeout)
+	defer cancel()
+
+	// the dependents are stopped before the module, and started after it
+	dependents := sv.dependents(m.name)
+	for i := len(dependents) - 1; i >= 0; i-- {
+		sv.stopModule(ctx, dependents[i])
+	}
+	sv.stopModule(ctx, m.iface)
+	if err := safely(func() error { return startModule(ctx, m.iface) }); err != nil {
+		logger.WithError(err).WithField("name", m.name).Error("Error while restarting supervised module")
+		mTotalFailedRestarts.Add(1)
+	}
+	for _, iface := range dependents {
+		if err := safely(func() error { return startModule(ctx, iface) }); err != nil {
+			logger.WithError(err).WithField("name", sv.nameOf(iface)).Error("Error while restarting dependent module")
+			mTotalFailedRestarts.Add(1)
+		}
+	}
+
+	m.failures = 0
+	m.notUntil = time.Now().Add(m.nextWait)
+	m.nextWait *= 2
+}
+
+func (sv *supervisor) stopModule(ctx context.Context, iface interface{}) {
+	if err := safely(func() error { return stopModule(ctx, iface) }); err != nil {
+		logger.WithError(err).WithField("name", sv.nameOf(iface)).Error("Error while stopping supervised module")
+	}
+}
+
+// dependents returns the startable and stopable modules depending, directly or not, on the named module,
+// in their start order.
+func (sv *supervisor) dependents(name string) []interface{} {
+	restarted := map[string]bool{name: true}
+	var dependents []interface{}
+	for _, iface := range sv.ordered {
+		d, ok := iface.(Dependent)
+		if !ok {
+			continue
+		}
+		for _, dependency := range d.DependsOn() {
+			if restarted[dependency] {
+				restarted[sv.nameOf(iface)] = true
+				if isStartable(iface) && isStopable(iface) {
+					dependents = append(dependents, iface)
+				}
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// safely calls the function, returning the recovered panic as an error.
+func safely(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return f()
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSupervised struct {
+	starts  int32
+	stops   int32
+	healthy int32
+}
+
+func (m *testSupervised) Start() error {
+	atomic.AddInt32(&m.starts, 1)
+	return nil
+}
+
+func (m *testSupervised) Stop() error {
+	atomic.AddInt32(&m.stops, 1)
+	return nil
+}
+
+func (m *testSupervised) Check() error {
+	if atomic.LoadInt32(&m.healthy) == 1 {
+		return nil
+	}
+	panic(errors.New("crashed"))
+}
+
+func TestSupervisorRestartsFailingModule(t *testing.T) {
+	a := assert.New(t)
+
+	failing := &testSupervised{}
+	healthy := &testSupervised{healthy: 1}
+
+	sv := &supervisor{interval: time.Millisecond, maxRestarts: 1}
+	sv.start([]interface{}{failing, healthy, &testStartable{}}, moduleName)
+	time.Sleep(50 * time.Millisecond)
+	sv.stop()
+
+	// the failing module is restarted only once, and the healthy one is not restarted
+	a.Equal(int32(1), atomic.LoadInt32(&failing.stops))
+	a.Equal(int32(1), atomic.LoadInt32(&failing.starts))
+	a.Equal(int32(0), atomic.LoadInt32(&healthy.stops))
+	a.Len(sv.modules, 2)
+}
+
+type testPanicking struct {
+	PanicRecorder
+	name      string
+	dependsOn []string
+	events    *[]string
+}
+
+func (m *testPanicking) Name() string        { return m.name }
+func (m *testPanicking) DependsOn() []string { return m.dependsOn }
+
+func (m *testPanicking) Start() error {
+	*m.events = append(*m.events, "start "+m.name)
+	return nil
+}
+
+func (m *testPanicking) Stop() error {
+	*m.events = append(*m.events, "stop "+m.name)
+	return nil
+}
+
+func TestSupervisorRestartsPanickingModuleWithDependents(t *testing.T) {
+	a := assert.New(t)
+
+	var events []string
+	base := &testPanicking{name: "base", events: &events}
+	dependent := &testPanicking{name: "dependent", dependsOn: []string{"base"}, events: &events}
+	transitive := &testPanicking{name: "transitive", dependsOn: []string{"dependent"}, events: &events}
+	other := &testPanicking{name: "other", events: &events}
+
+	sv := &supervisor{interval: time.Hour, maxRestarts: 1}
+	sv.start([]interface{}{base, dependent, transitive, other}, moduleName)
+	defer sv.stop()
+
+	func() {
+		defer base.Recover()
+		panic("boom")
+	}()
+	sv.supervise(sv.modules[0])
+
+	a.Equal([]string{
+		"stop transitive", "stop dependent", "stop base",
+		"start base", "start dependent", "start transitive",
+	}, events)
+	a.NoError(base.Panicked())
+}
+
+func TestPanicRecorderPropagatesPanicsWhenNotSupervised(t *testing.T) {
+	a := assert.New(t)
+
+	p := &PanicRecorder{}
+	a.Panics(func() {
+		defer p.Recover()
+		panic("boom")
+	})
+
+	p.SetSupervised(true)
+	a.NotPanics(func() {
+		defer p.Recover()
+		panic("boom")
+	})
+	a.EqualError(p.Panicked(), "panic: boom")
+	a.NoError(p.Panicked())
+}
+
+func TestSafelyRecoversPanics(t *testing.T) {
+	a := assert.New(t)
+
+	a.NoError(safely(func() error { return nil }))
+	a.EqualError(safely(func() error { panic("boom") }), "panic: boom")
+}
@@ -0,0 +1,7 @@
+package slack
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "slack")
@@ -0,0 +1,200 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// DefaultTemplate is used for formatting the messages when no template is configured.
+	DefaultTemplate = "*{{.Topic}}*: {{.Body}}"
+
+	defaultChannelSize = 1000
+)
+
+// Config is used for configuring the Slack connector.
+type Config struct {
+	Enabled    *bool
+	WebhookURL *string
+
+	// Topics are the guble topics forwarded to Slack, each one with an optional channel: "/topic" or "/topic=#channel"
+	Topics    *[]string
+	Template  *string
+	Username  *string
+	IconEmoji *string
+}
+
+// TemplateData is the data available in the formatting template.
+type TemplateData struct {
+	ID     uint64
+	Topic  string
+	UserID string
+	Time   time.Time
+	Header map[string]interface{}
+	Body   string
+}
+
+type topicChannel struct {
+	path    protocol.Path
+	channel string
+}
+
+type slack struct {
+	config   Config
+	router   router.Router
+	sender   Sender
+	template *template.Template
+	topics   []topicChannel
+	routes   []*router.Route
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// New returns a connector forwarding the messages of the configured topics to Slack.
+func New(router router.Router, sender Sender, config Config) (*slack, error) {
+	text := *config.Template
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New("slack").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var topics []topicChannel
+	for _, t := range *config.Topics {
+		parts := strings.SplitN(t, "=", 2)
+		tc := topicChannel{path: protocol.Path(parts[0])}
+		if len(parts) == 2 {
+			tc.channel = parts[1]
+		}
+		topics = append(topics, tc)
+	}
+
+	return &slack{
+		config:   config,
+		router:   router,
+		sender:   sender,
+		template: tmpl,
+		topics:   topics,
+	}, nil
+}
+
+func (s *slack) Start() error {
+	logger.Debug("Starting Slack connector")
+	mTotalSentMessages.Set(0)
+	mTotalSendErrors.Set(0)
+	mTotalTemplateErrors.Set(0)
+
+	s.ctx, s.cancelFunc = context.WithCancel(context.Background())
+	for _, tc := range s.topics {
+		route := router.NewRoute(router.RouteConfig{
+			Path:        tc.path,
+			ChannelSize: defaultChannelSize,
+		})
+		if _, err := s.router.Subscribe(route); err != nil {
+			s.cancelFunc()
+			return err
+		}
+		s.routes = append(s.routes, route)
+		s.wg.Add(1)
+		go s.forward(route, tc.channel)
+	}
+	logger.Debug("Started Slack connector")
+	return nil
+}
+
+func (s *slack) Stop() error {
+	logger.Debug("Stopping Slack connector")
+	s.cancelFunc()
+	for _, route := range s.routes {
+		s.router.Unsubscribe(route)
+	}
+	s.wg.Wait()
+	logger.Debug("Stopped Slack connector")
+	return nil
+}
+
+func (s *slack) forward(route *router.Route, channel string) {
+	defer s.wg.Done()
+	for {
+		select {
+		case m, opened := <-route.MessagesChannel():
+			if !opened {
+				if s.ctx.Err() != nil {
+					return
+				}
+				logger.WithField("route", route.String()).Info("Route closed by router, subscribing again")
+				route = router.NewRoute(route.RouteConfig)
+				if _, err := s.router.Subscribe(route); err != nil {
+					logger.WithField("error", err.Error()).Error("Could not subscribe again")
+					return
+				}
+				continue
+			}
+			s.send(m, channel)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *slack) send(m *protocol.Message, channel string) {
+	text, err := s.format(m)
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"error":     err.Error(),
+			"messageID": m.ID,
+		}).Error("Could not format message for Slack")
+		mTotalTemplateErrors.Add(1)
+		return
+	}
+
+	err = s.sender.Send(&Payload{
+		Text:      text,
+		Channel:   channel,
+		Username:  *s.config.Username,
+		IconEmoji: *s.config.IconEmoji,
+	})
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"error":     err.Error(),
+			"messageID": m.ID,
+		}).Error("Could not send message to Slack")
+		mTotalSendErrors.Add(1)
+		return
+	}
+	mTotalSentMessages.Add(1)
+}
+
+// format returns the text of the Slack message, by applying the template to the guble message.
+func (s *slack) format(m *protocol.Message) (string, error) {
+	data := TemplateData{
+		ID:     m.ID,
+		Topic:  string(m.Path),
+		UserID: m.UserID,
+		Time:   time.Unix(m.Time, 0),
+		Body:   string(m.Body),
+	}
+	if m.HeaderJSON != "" {
+		json.Unmarshal([]byte(m.HeaderJSON), &data.Header)
+	}
+
+	buff := &bytes.Buffer{}
+	if err := s.template.Execute(buff, data); err != nil {
+		return "", err
+	}
+	return buff.String(), nil
+}
@@ -0,0 +1,12 @@
+package slack
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                   = metrics.NS("slack")
+	mTotalSentMessages   = ns.NewInt("total_sent_messages")
+	mTotalSendErrors     = ns.NewInt("total_sent_message_errors")
+	mTotalTemplateErrors = ns.NewInt("total_template_errors")
+)
@@ -0,0 +1,55 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Payload is the JSON body accepted by Slack incoming webhooks.
+type Payload struct {
+	Text      string `json:"text"`
+	Channel   string `json:"channel,omitempty"`
+	Username  string `json:"username,omitempty"`
+	IconEmoji string `json:"icon_emoji,omitempty"`
+}
+
+// Sender sends a payload to Slack.
+type Sender interface {
+	Send(*Payload) error
+}
+
+type sender struct {
+	url    string
+	client *http.Client
+}
+
+// NewSender returns a Sender POSTing to the given Slack incoming webhook URL.
+func NewSender(url string, timeout time.Duration) Sender {
+	return &sender{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *sender) Send(p *Payload) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack responded with status code %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package slack
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSender_Send(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		a.Equal("application/json", req.Header.Get("Content-Type"))
+		a.JSONEq(`{"text":"hello","channel":"#ops"}`, string(body))
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	a.NoError(NewSender(server.URL, time.Second).Send(&Payload{Text: "hello", Channel: "#ops"}))
+}
+
+func TestSender_SendError(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "channel_not_found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	err := NewSender(server.URL, time.Second).Send(&Payload{Text: "hello"})
+	a.EqualError(err, "slack responded with status code 404: channel_not_found\n")
+}
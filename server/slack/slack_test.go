@@ -0,0 +1,103 @@
+package slack
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+type senderFunc func(*Payload) error
+
+func (f senderFunc) Send(p *Payload) error { return f(p) }
+
+func testConfig(tmpl string, topics ...string) Config {
+	enabled := true
+	url := "http://localhost/hook"
+	username := "guble"
+	iconEmoji := ":bell:"
+	return Config{
+		Enabled:    &enabled,
+		WebhookURL: &url,
+		Topics:     &topics,
+		Template:   &tmpl,
+		Username:   &username,
+		IconEmoji:  &iconEmoji,
+	}
+}
+
+func TestNew_InvalidTemplate(t *testing.T) {
+	_, err := New(nil, nil, testConfig("{{.Body"))
+	assert.Error(t, err)
+}
+
+func TestSlack_Format(t *testing.T) {
+	a := assert.New(t)
+
+	s, err := New(nil, nil, testConfig(""))
+	a.NoError(err)
+	text, err := s.format(&protocol.Message{Path: "/alerts", Body: []byte("disk full")})
+	a.NoError(err)
+	a.Equal("*/alerts*: disk full", text)
+
+	s, err = New(nil, nil, testConfig(`[{{.Header.severity}}] {{.UserID}} #{{.ID}}: {{.Body}}`))
+	a.NoError(err)
+	text, err = s.format(&protocol.Message{
+		ID:         12,
+		Path:       "/alerts",
+		UserID:     "monitor",
+		HeaderJSON: `{"severity":"critical"}`,
+		Body:       []byte("disk full"),
+	})
+	a.NoError(err)
+	a.Equal("[critical] monitor #12: disk full", text)
+}
+
+func TestSlack_ForwardsMessagesOfConfiguredTopics(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	payloadsC := make(chan *Payload, 10)
+	sender := senderFunc(func(p *Payload) error {
+		payloadsC <- p
+		if p.Text == "*/deploys*: fail" {
+			return errors.New("slack is down")
+		}
+		return nil
+	})
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routes := make(map[protocol.Path]*router.Route)
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		routes[r.Path] = r
+	}).Return(nil, nil).Times(2)
+
+	s, err := New(routerMock, sender, testConfig("", "/alerts=#ops", "/deploys"))
+	a.NoError(err)
+	a.NoError(s.Start())
+
+	a.NoError(routes["/alerts"].Deliver(&protocol.Message{ID: 1, Path: "/alerts", Body: []byte("disk full")}, false))
+	expectPayload(a, payloadsC, &Payload{Text: "*/alerts*: disk full", Channel: "#ops", Username: "guble", IconEmoji: ":bell:"})
+
+	a.NoError(routes["/deploys"].Deliver(&protocol.Message{ID: 2, Path: "/deploys", Body: []byte("fail")}, false))
+	expectPayload(a, payloadsC, &Payload{Text: "*/deploys*: fail", Username: "guble", IconEmoji: ":bell:"})
+
+	routerMock.EXPECT().Unsubscribe(gomock.Any()).Times(2)
+	a.NoError(s.Stop())
+}
+
+func expectPayload(a *assert.Assertions, payloadsC chan *Payload, expected *Payload) {
+	select {
+	case p := <-payloadsC:
+		a.Equal(expected, p)
+	case <-time.After(time.Second):
+		a.Fail("no payload was sent")
+	}
+}
@@ -204,7 +204,7 @@ func (g *gateway) proxyLoop() (*protocol.Message, error) {
 }
 
 func (g *gateway) retry(msg *protocol.Message) error {
-	l := logger.WithField("message", msg)
+	l := logger.WithFields(msg.LogFields())
 	l.Info("Retrying to send message")
 	for i := 0; i < 3; i++ {
 		l.WithField("retry", i+1).Info("Sending message")
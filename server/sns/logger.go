@@ -0,0 +1,7 @@
+package sns
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "sns")
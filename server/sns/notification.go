@@ -0,0 +1,165 @@
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+// Types of the SNS messages posted to the endpoint
+const (
+	typeNotification             = "Notification"
+	typeSubscriptionConfirmation = "SubscriptionConfirmation"
+	typeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+// notification is a message posted by SNS to an HTTP(S) endpoint.
+type notification struct {
+	Type             string
+	MessageId        string
+	Token            string
+	TopicArn         string
+	Subject          string
+	Message          string
+	Timestamp        string
+	SignatureVersion string
+	Signature        string
+	SigningCertURL   string
+	SubscribeURL     string
+}
+
+// NotificationHandler is the endpoint of the SNS subscriptions, publishing the received notifications in guble.
+// The subscriptions are confirmed automatically, and the signature of each message is verified.
+type NotificationHandler struct {
+	router      router.Router
+	prefix      string
+	topicPrefix string
+	topicARNs   map[string]bool
+	client      *http.Client
+	verify      func(*notification) error
+}
+
+// NewNotificationHandler returns the endpoint for the SNS subscriptions.
+func NewNotificationHandler(router router.Router, config Config) *NotificationHandler {
+	topicARNs := make(map[string]bool)
+	for _, arn := range *config.TopicARNs {
+		topicARNs[arn] = true
+	}
+	client := &http.Client{Timeout: defaultTimeout}
+	return &NotificationHandler{
+		router:      router,
+		prefix:      *config.Prefix,
+		topicPrefix: *config.TopicPrefix,
+		topicARNs:   topicARNs,
+		client:      client,
+		verify:      newVerifier(client).verify,
+	}
+}
+
+// GetPrefix returns the prefix.
+// It is a part of the service.endpoint implementation.
+func (h *NotificationHandler) GetPrefix() string {
+	return h.prefix
+}
+
+// ServeHTTP is an http.Handler.
+// It is a part of the service.endpoint implementation.
+func (h *NotificationHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n := &notification{}
+	if err := json.NewDecoder(req.Body).Decode(n); err != nil {
+		http.Error(w, "Invalid SNS message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(h.topicARNs) > 0 && !h.topicARNs[n.TopicArn] {
+		logger.WithField("topicARN", n.TopicArn).Warn("Rejected SNS message of unknown topic")
+		http.Error(w, "Unknown topic", http.StatusForbidden)
+		return
+	}
+	if err := h.verify(n); err != nil {
+		logger.WithFields(log.Fields{
+			"error":    err.Error(),
+			"topicARN": n.TopicArn,
+		}).Warn("Rejected SNS message with invalid signature")
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+
+	switch n.Type {
+	case typeNotification:
+		if err := h.publish(n); err != nil {
+			logger.WithFields(log.Fields{
+				"error":        err.Error(),
+				"snsMessageID": n.MessageId,
+			}).Error("Could not handle message from SNS")
+			mTotalReceiveErrors.Add(1)
+			http.Error(w, "Could not handle message", http.StatusInternalServerError)
+			return
+		}
+		mTotalReceivedMessages.Add(1)
+	case typeSubscriptionConfirmation:
+		if err := h.confirm(n); err != nil {
+			logger.WithFields(log.Fields{
+				"error":    err.Error(),
+				"topicARN": n.TopicArn,
+			}).Error("Could not confirm SNS subscription")
+			http.Error(w, "Could not confirm subscription", http.StatusInternalServerError)
+			return
+		}
+		logger.WithField("topicARN", n.TopicArn).Info("Confirmed SNS subscription")
+		mTotalConfirmedSubscriptions.Add(1)
+	case typeUnsubscribeConfirmation:
+		logger.WithField("topicARN", n.TopicArn).Info("SNS subscription was removed")
+	default:
+		http.Error(w, "Unknown SNS message type", http.StatusBadRequest)
+	}
+}
+
+func (h *NotificationHandler) publish(n *notification) error {
+	header := map[string]string{
+		"sns-message-id": n.MessageId,
+		"sns-topic-arn":  n.TopicArn,
+	}
+	if n.Subject != "" {
+		header["sns-subject"] = n.Subject
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	return h.router.HandleMessage(&protocol.Message{
+		Path:       topicPath(h.topicPrefix, n.TopicArn),
+		UserID:     bridgeID,
+		HeaderJSON: string(headerJSON),
+		Body:       []byte(n.Message),
+	})
+}
+
+func (h *NotificationHandler) confirm(n *notification) error {
+	resp, err := h.client.Get(n.SubscribeURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("subscription confirmation returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// topicPath returns the guble topic of the notifications of an SNS topic, e.g. "/sns/orders" for "arn:aws:sns:eu-west-1:123456789012:orders".
+func topicPath(prefix string, arn string) protocol.Path {
+	name := arn[strings.LastIndex(arn, ":")+1:]
+	return protocol.Path(strings.TrimSuffix(prefix, "/") + "/" + name)
+}
@@ -0,0 +1,99 @@
+package sns
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/testutil"
+)
+
+func testNotificationHandler(routerMock *MockRouter, topicARNs ...string) *NotificationHandler {
+	config := testConfig()
+	prefix := "/sns/"
+	config.Prefix = &prefix
+	config.TopicARNs = &topicARNs
+	h := NewNotificationHandler(routerMock, config)
+	h.verify = func(n *notification) error {
+		if n.Signature != "valid" {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return h
+}
+
+func postNotification(h *NotificationHandler, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/sns/", strings.NewReader(body))
+	h.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestNotificationHandler_Notification(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	h := testNotificationHandler(routerMock)
+	a.Equal("/sns/", h.GetPrefix())
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/sns/orders"), m.Path)
+		a.Equal(bridgeID, m.UserID)
+		a.Equal("hello", string(m.Body))
+		a.JSONEq(`{"sns-message-id":"1","sns-topic-arn":"arn:aws:sns:eu-west-1:123456789012:orders","sns-subject":"greeting"}`, m.HeaderJSON)
+	}).Return(nil)
+
+	recorder := postNotification(h, `{"Type":"Notification","MessageId":"1","TopicArn":"arn:aws:sns:eu-west-1:123456789012:orders",
+		"Subject":"greeting","Message":"hello","Signature":"valid"}`)
+	a.Equal(http.StatusOK, recorder.Code)
+}
+
+func TestNotificationHandler_Rejected(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	h := testNotificationHandler(NewMockRouter(testutil.MockCtrl), "arn:aws:sns:eu-west-1:123456789012:orders")
+
+	recorder := postNotification(h, `{"Type":"Notification","TopicArn":"arn:aws:sns:eu-west-1:123456789012:orders","Signature":"forged"}`)
+	a.Equal(http.StatusForbidden, recorder.Code)
+
+	recorder = postNotification(h, `{"Type":"Notification","TopicArn":"arn:aws:sns:eu-west-1:123456789012:other","Signature":"valid"}`)
+	a.Equal(http.StatusForbidden, recorder.Code)
+
+	recorder = postNotification(h, `no json`)
+	a.Equal(http.StatusBadRequest, recorder.Code)
+}
+
+func TestNotificationHandler_SubscriptionConfirmation(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	confirmed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		a.Equal("ConfirmSubscription", req.URL.Query().Get("Action"))
+		confirmed = true
+	}))
+	defer server.Close()
+
+	h := testNotificationHandler(NewMockRouter(testutil.MockCtrl))
+	recorder := postNotification(h, `{"Type":"SubscriptionConfirmation","TopicArn":"arn:aws:sns:eu-west-1:123456789012:orders",
+		"SubscribeURL":"`+server.URL+`/?Action=ConfirmSubscription&Token=abc","Signature":"valid"}`)
+	a.Equal(http.StatusOK, recorder.Code)
+	a.True(confirmed)
+}
+
+func TestTopicPath(t *testing.T) {
+	assert.Equal(t, protocol.Path("/sns/orders"), topicPath("/sns", "arn:aws:sns:eu-west-1:123456789012:orders"))
+	assert.Equal(t, protocol.Path("/aws/orders"), topicPath("/aws/", "arn:aws:sns:eu-west-1:123456789012:orders"))
+}
@@ -0,0 +1,189 @@
+package sns
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	snslib "github.com/aws/aws-sdk-go/service/sns"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// bridgeID marks the messages crossing the bridge, in both directions,
+	// so that they are never sent back to where they came from.
+	bridgeID = "guble-sns-bridge"
+
+	defaultChannelSize = 1000
+
+	attributeMessageID = "guble-message-id"
+	attributePath      = "guble-path"
+	attributeUserID    = "guble-user-id"
+)
+
+// Config is used for configuring the SNS connector.
+type Config struct {
+	Enabled *bool
+	Region  *string
+
+	// Topics are the guble topics forwarded to SNS, each one with the ARN of its SNS topic: "/topic=arn:aws:sns:..."
+	Topics *[]string
+
+	// Prefix is the endpoint receiving the notifications of SNS subscriptions (an empty Prefix disables this direction).
+	Prefix *string
+
+	// TopicARNs are the SNS topics whose notifications are accepted by the endpoint (all of them, if empty).
+	TopicARNs *[]string
+
+	// TopicPrefix is prepended to the name of the SNS topic, giving the guble topic of a received notification.
+	TopicPrefix *string
+}
+
+// Publisher publishes messages to SNS topics; it is implemented by the SNS client of the AWS SDK.
+type Publisher interface {
+	Publish(*snslib.PublishInput) (*snslib.PublishOutput, error)
+}
+
+// NewPublisher returns the SNS client of the given region.
+// The credentials are taken from the environment, the shared credentials file or the instance role.
+func NewPublisher(region string) (Publisher, error) {
+	sess, err := session.NewSession(aws.NewConfig().WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return snslib.New(sess), nil
+}
+
+type topicARN struct {
+	path protocol.Path
+	arn  string
+}
+
+type connector struct {
+	router    router.Router
+	publisher Publisher
+	topics    []topicARN
+	routes    []*router.Route
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// New returns a connector publishing the messages of the configured guble topics to SNS.
+func New(router router.Router, publisher Publisher, config Config) (*connector, error) {
+	var topics []topicARN
+	for _, t := range *config.Topics {
+		parts := strings.SplitN(t, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid SNS topic %q, expected format: /topic=arn", t)
+		}
+		topics = append(topics, topicARN{path: protocol.Path(parts[0]), arn: parts[1]})
+	}
+
+	return &connector{
+		router:    router,
+		publisher: publisher,
+		topics:    topics,
+	}, nil
+}
+
+func (c *connector) Start() error {
+	logger.Debug("Starting SNS connector")
+	resetSNSMetrics()
+
+	c.ctx, c.cancelFunc = context.WithCancel(context.Background())
+	for _, t := range c.topics {
+		route := router.NewRoute(router.RouteConfig{
+			Path:        t.path,
+			ChannelSize: defaultChannelSize,
+		})
+		if _, err := c.router.Subscribe(route); err != nil {
+			c.cancelFunc()
+			return err
+		}
+		c.routes = append(c.routes, route)
+		c.wg.Add(1)
+		go c.forward(route, t.arn)
+	}
+	logger.Debug("Started SNS connector")
+	return nil
+}
+
+func (c *connector) Stop() error {
+	logger.Debug("Stopping SNS connector")
+	c.cancelFunc()
+	for _, route := range c.routes {
+		c.router.Unsubscribe(route)
+	}
+	c.wg.Wait()
+	logger.Debug("Stopped SNS connector")
+	return nil
+}
+
+func (c *connector) forward(route *router.Route, arn string) {
+	defer c.wg.Done()
+	for {
+		select {
+		case m, opened := <-route.MessagesChannel():
+			if !opened {
+				if c.ctx.Err() != nil {
+					return
+				}
+				logger.WithField("route", route.String()).Info("Route closed by router, subscribing again")
+				route = router.NewRoute(route.RouteConfig)
+				if _, err := c.router.Subscribe(route); err != nil {
+					logger.WithField("error", err.Error()).Error("Could not subscribe again")
+					return
+				}
+				continue
+			}
+			if m.UserID == bridgeID {
+				continue
+			}
+			if err := c.publish(m, arn); err != nil {
+				logger.WithFields(log.Fields{
+					"error":     err.Error(),
+					"messageID": m.ID,
+					"topicARN":  arn,
+				}).Error("Could not publish message to SNS")
+				mTotalPublishErrors.Add(1)
+				continue
+			}
+			mTotalPublishedMessages.Add(1)
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *connector) publish(m *protocol.Message, arn string) error {
+	attributes := map[string]*snslib.MessageAttributeValue{
+		attributeMessageID: {DataType: aws.String("Number"), StringValue: aws.String(strconv.FormatUint(m.ID, 10))},
+		attributePath:      {DataType: aws.String("String"), StringValue: aws.String(string(m.Path))},
+	}
+	if m.UserID != "" {
+		attributes[attributeUserID] = &snslib.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(m.UserID)}
+	}
+
+	output, err := c.publisher.Publish(&snslib.PublishInput{
+		TopicArn:          aws.String(arn),
+		Message:           aws.String(string(m.Body)),
+		MessageAttributes: attributes,
+	})
+	if err != nil {
+		return err
+	}
+	logger.WithFields(log.Fields{
+		"messageID":    m.ID,
+		"snsMessageID": aws.StringValue(output.MessageId),
+	}).Debug("Published message to SNS")
+	return nil
+}
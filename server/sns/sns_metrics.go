@@ -0,0 +1,22 @@
+package sns
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                           = metrics.NS("sns")
+	mTotalPublishedMessages      = ns.NewInt("total_published_messages")
+	mTotalPublishErrors          = ns.NewInt("total_publish_errors")
+	mTotalReceivedMessages       = ns.NewInt("total_received_messages")
+	mTotalReceiveErrors          = ns.NewInt("total_receive_errors")
+	mTotalConfirmedSubscriptions = ns.NewInt("total_confirmed_subscriptions")
+)
+
+func resetSNSMetrics() {
+	mTotalPublishedMessages.Set(0)
+	mTotalPublishErrors.Set(0)
+	mTotalReceivedMessages.Set(0)
+	mTotalReceiveErrors.Set(0)
+	mTotalConfirmedSubscriptions.Set(0)
+}
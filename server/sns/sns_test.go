@@ -0,0 +1,105 @@
+package sns
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	snslib "github.com/aws/aws-sdk-go/service/sns"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+type fakePublisher struct {
+	sync.Mutex
+	inputs []*snslib.PublishInput
+	err    error
+}
+
+func (p *fakePublisher) Publish(input *snslib.PublishInput) (*snslib.PublishOutput, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.inputs = append(p.inputs, input)
+	return &snslib.PublishOutput{MessageId: aws.String("sns-id")}, nil
+}
+
+func (p *fakePublisher) published() []*snslib.PublishInput {
+	p.Lock()
+	defer p.Unlock()
+	return p.inputs
+}
+
+func testConfig(topics ...string) Config {
+	enabled := true
+	region := "eu-west-1"
+	prefix := ""
+	topicPrefix := "/sns"
+	return Config{
+		Enabled:     &enabled,
+		Region:      &region,
+		Topics:      &topics,
+		Prefix:      &prefix,
+		TopicARNs:   &[]string{},
+		TopicPrefix: &topicPrefix,
+	}
+}
+
+func TestNew_InvalidTopic(t *testing.T) {
+	_, err := New(nil, &fakePublisher{}, testConfig("/foo"))
+	assert.Error(t, err)
+}
+
+func TestConnector_Forward(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	var route *router.Route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo"), r.Path)
+		route = r
+	}).Return(nil, nil)
+
+	publisher := &fakePublisher{}
+	c, err := New(routerMock, publisher, testConfig("/foo=arn:aws:sns:eu-west-1:123456789012:foo"))
+	a.NoError(err)
+	a.NoError(c.Start())
+
+	route.Deliver(&protocol.Message{ID: 1, Path: "/foo/bar", UserID: "user01", Body: []byte("hello")}, false)
+	// messages which came from SNS are not sent back
+	route.Deliver(&protocol.Message{ID: 2, Path: "/foo", UserID: bridgeID, Body: []byte("loop")}, false)
+	time.Sleep(50 * time.Millisecond)
+
+	routerMock.EXPECT().Unsubscribe(route)
+	a.NoError(c.Stop())
+
+	published := publisher.published()
+	if a.Len(published, 1) {
+		input := published[0]
+		a.Equal("arn:aws:sns:eu-west-1:123456789012:foo", *input.TopicArn)
+		a.Equal("hello", *input.Message)
+		a.Equal("1", *input.MessageAttributes[attributeMessageID].StringValue)
+		a.Equal("/foo/bar", *input.MessageAttributes[attributePath].StringValue)
+		a.Equal("user01", *input.MessageAttributes[attributeUserID].StringValue)
+	}
+}
+
+func TestConnector_PublishError(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	c, err := New(nil, &fakePublisher{err: errors.New("throttled")}, testConfig())
+	a.NoError(err)
+	a.Error(c.publish(&protocol.Message{ID: 1, Path: "/foo"}, "arn:aws:sns:eu-west-1:123456789012:foo"))
+}
@@ -0,0 +1,134 @@
+package sns
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// signingCertHost matches the hosts from which SNS serves its signing certificates.
+var signingCertHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// verifier checks the signatures of the SNS messages, caching the signing certificates.
+type verifier struct {
+	client   *http.Client
+	certHost *regexp.Regexp
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+func newVerifier(client *http.Client) *verifier {
+	return &verifier{
+		client:   client,
+		certHost: signingCertHost,
+		certs:    make(map[string]*x509.Certificate),
+	}
+}
+
+func (v *verifier) verify(n *notification) error {
+	var algorithm x509.SignatureAlgorithm
+	switch n.SignatureVersion {
+	case "1":
+		algorithm = x509.SHA1WithRSA
+	case "2":
+		algorithm = x509.SHA256WithRSA
+	default:
+		return fmt.Errorf("unsupported signature version %q", n.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(n.Signature)
+	if err != nil {
+		return err
+	}
+	cert, err := v.certificate(n.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	return cert.CheckSignature(algorithm, stringToSign(n), signature)
+}
+
+func (v *verifier) certificate(certURL string) (*x509.Certificate, error) {
+	u, err := url.Parse(certURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" || !v.certHost.MatchString(u.Host) || !strings.HasSuffix(u.Path, ".pem") {
+		return nil, fmt.Errorf("untrusted signing certificate URL %q", certURL)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if cert, ok := v.certs[certURL]; ok {
+		return cert, nil
+	}
+
+	resp, err := v.client.Get(certURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not get signing certificate (status code %d)", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid signing certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	v.certs[certURL] = cert
+	return cert, nil
+}
+
+// stringToSign returns the fields of the message which are signed by SNS, in their canonical format.
+func stringToSign(n *notification) []byte {
+	var fields [][2]string
+	if n.Type == typeNotification {
+		fields = [][2]string{
+			{"Message", n.Message},
+			{"MessageId", n.MessageId},
+			{"Subject", n.Subject},
+			{"Timestamp", n.Timestamp},
+			{"TopicArn", n.TopicArn},
+			{"Type", n.Type},
+		}
+	} else {
+		fields = [][2]string{
+			{"Message", n.Message},
+			{"MessageId", n.MessageId},
+			{"SubscribeURL", n.SubscribeURL},
+			{"Timestamp", n.Timestamp},
+			{"Token", n.Token},
+			{"TopicArn", n.TopicArn},
+			{"Type", n.Type},
+		}
+	}
+
+	buff := &bytes.Buffer{}
+	for _, f := range fields {
+		if f[0] == "Subject" && f[1] == "" {
+			continue
+		}
+		buff.WriteString(f[0] + "\n" + f[1] + "\n")
+	}
+	return buff.Bytes()
+}
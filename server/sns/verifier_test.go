@@ -0,0 +1,86 @@
+package sns
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	a := assert.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	a.NoError(err)
+
+	certRequests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		certRequests++
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	v := newVerifier(server.Client())
+	v.certHost = regexp.MustCompile("^" + regexp.QuoteMeta(serverURL.Host) + "$")
+
+	n := &notification{
+		Type:             typeNotification,
+		MessageId:        "1",
+		TopicArn:         "arn:aws:sns:eu-west-1:123456789012:orders",
+		Message:          "hello",
+		Timestamp:        "2017-06-01T12:00:00.000Z",
+		SignatureVersion: "1",
+		SigningCertURL:   server.URL + "/SimpleNotificationService-1234.pem",
+	}
+	hash := sha1.Sum(stringToSign(n))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, hash[:])
+	a.NoError(err)
+	n.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	a.NoError(v.verify(n))
+	a.NoError(v.verify(n))
+	a.Equal(1, certRequests)
+
+	n.Message = "forged"
+	a.Error(v.verify(n))
+}
+
+func TestVerifier_UntrustedCertificateURL(t *testing.T) {
+	v := newVerifier(http.DefaultClient)
+	for _, certURL := range []string{
+		"http://sns.eu-west-1.amazonaws.com/cert.pem",
+		"https://sns.eu-west-1.amazonaws.com.evil.com/cert.pem",
+		"https://evil.com/cert.pem",
+	} {
+		err := v.verify(&notification{SignatureVersion: "1", SigningCertURL: certURL})
+		assert.Error(t, err, certURL)
+	}
+}
+
+func TestSigningCertHost(t *testing.T) {
+	assert.True(t, signingCertHost.MatchString("sns.eu-west-1.amazonaws.com"))
+	assert.True(t, signingCertHost.MatchString("sns.cn-north-1.amazonaws.com.cn"))
+	assert.False(t, signingCertHost.MatchString("sns.eu-west-1.amazonaws.com.evil.com"))
+}
@@ -0,0 +1,178 @@
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// STOMP 1.2 commands
+const (
+	cmdConnect     = "CONNECT"
+	cmdStomp       = "STOMP"
+	cmdConnected   = "CONNECTED"
+	cmdSend        = "SEND"
+	cmdSubscribe   = "SUBSCRIBE"
+	cmdUnsubscribe = "UNSUBSCRIBE"
+	cmdAck         = "ACK"
+	cmdNack        = "NACK"
+	cmdBegin       = "BEGIN"
+	cmdCommit      = "COMMIT"
+	cmdAbort       = "ABORT"
+	cmdDisconnect  = "DISCONNECT"
+	cmdMessage     = "MESSAGE"
+	cmdReceipt     = "RECEIPT"
+	cmdError       = "ERROR"
+)
+
+const maxFrameSize = 1 << 20
+
+var errFrameTooLarge = errors.New("frame too large")
+
+// header is the list of the headers of a frame;
+// as required by STOMP, only the first occurrence of a repeated header is used.
+type header [][2]string
+
+// Get returns the value of the first header with the given key.
+func (h header) Get(key string) string {
+	for _, kv := range h {
+		if kv[0] == key {
+			return kv[1]
+		}
+	}
+	return ""
+}
+
+// frame is a STOMP frame.
+type frame struct {
+	command string
+	header  header
+	body    []byte
+}
+
+func newFrame(command string, kv ...string) *frame {
+	f := &frame{command: command}
+	for i := 0; i+1 < len(kv); i += 2 {
+		f.header = append(f.header, [2]string{kv[i], kv[i+1]})
+	}
+	return f
+}
+
+// readFrame reads the next frame, skipping the heart-beat EOLs before it.
+func readFrame(r *bufio.Reader) (*frame, error) {
+	var command string
+	for command == "" {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		command = line
+	}
+
+	f := &frame{command: command}
+	contentLength := -1
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid header: %q", line)
+		}
+		key, value := line[:i], line[i+1:]
+		if command != cmdConnect && command != cmdConnected {
+			key, value = unescape(key), unescape(value)
+		}
+		if key == "content-length" && contentLength < 0 {
+			if contentLength, err = strconv.Atoi(value); err != nil || contentLength < 0 {
+				return nil, fmt.Errorf("invalid content-length: %q", value)
+			}
+		}
+		f.header = append(f.header, [2]string{key, value})
+	}
+
+	if contentLength > maxFrameSize {
+		return nil, errFrameTooLarge
+	}
+	if contentLength >= 0 {
+		f.body = make([]byte, contentLength)
+		if _, err := io.ReadFull(r, f.body); err != nil {
+			return nil, err
+		}
+		if b, err := r.ReadByte(); err != nil {
+			return nil, err
+		} else if b != 0 {
+			return nil, errors.New("frame does not end with NULL")
+		}
+		return f, nil
+	}
+
+	// without content-length, the body ends with the first NULL
+	for {
+		chunk, err := r.ReadSlice(0)
+		f.body = append(f.body, chunk...)
+		if len(f.body) > maxFrameSize {
+			return nil, errFrameTooLarge
+		}
+		if err == nil {
+			f.body = f.body[:len(f.body)-1]
+			return f, nil
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// bytes serializes the frame, always including the content-length header.
+func (f *frame) bytes() []byte {
+	buff := &bytes.Buffer{}
+	buff.WriteString(f.command)
+	buff.WriteByte('\n')
+	for _, kv := range f.header {
+		if kv[0] == "content-length" {
+			continue
+		}
+		if f.command == cmdConnected {
+			buff.WriteString(kv[0] + ":" + kv[1] + "\n")
+		} else {
+			buff.WriteString(escape(kv[0]) + ":" + escape(kv[1]) + "\n")
+		}
+	}
+	if len(f.body) > 0 {
+		buff.WriteString("content-length:" + strconv.Itoa(len(f.body)) + "\n")
+	}
+	buff.WriteByte('\n')
+	buff.Write(f.body)
+	buff.WriteByte(0)
+	return buff.Bytes()
+}
+
+var (
+	escaper   = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+	unescaper = strings.NewReplacer("\\\\", "\\", "\\r", "\r", "\\n", "\n", "\\c", ":")
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
@@ -0,0 +1,62 @@
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadFrame(t *testing.T) {
+	a := assert.New(t)
+
+	r := bufio.NewReader(strings.NewReader(
+		"\n\r\nSEND\r\ndestination:/foo\nfoo:bar\\cbaz\nfoo:ignored\n\nhello\x00" +
+			"SEND\ndestination:/foo\ncontent-length:5\n\nhe\x00lo\x00"))
+
+	f, err := readFrame(r)
+	a.NoError(err)
+	a.Equal(cmdSend, f.command)
+	a.Equal("/foo", f.header.Get("destination"))
+	a.Equal("bar:baz", f.header.Get("foo"))
+	a.Equal([]byte("hello"), f.body)
+
+	f, err = readFrame(r)
+	a.NoError(err)
+	a.Equal([]byte("he\x00lo"), f.body)
+
+	_, err = readFrame(r)
+	a.Error(err)
+}
+
+func TestReadFrame_Errors(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := readFrame(bufio.NewReader(strings.NewReader("SEND\ninvalid\n\n\x00")))
+	a.Error(err)
+
+	_, err = readFrame(bufio.NewReader(strings.NewReader("SEND\ncontent-length:2\n\nabc\x00")))
+	a.Error(err)
+
+	_, err = readFrame(bufio.NewReader(strings.NewReader("SEND\ncontent-length:2000000\n\n")))
+	a.Equal(errFrameTooLarge, err)
+}
+
+func TestFrame_Bytes(t *testing.T) {
+	a := assert.New(t)
+
+	f := newFrame(cmdMessage, "destination", "/foo", "key", "a:b\nc")
+	f.body = []byte("hello")
+	a.Equal("MESSAGE\ndestination:/foo\nkey:a\\cb\\nc\ncontent-length:5\n\nhello\x00", string(f.bytes()))
+
+	// frames are read back as they were written
+	read, err := readFrame(bufio.NewReader(bytes.NewReader(f.bytes())))
+	a.NoError(err)
+	a.Equal("a:b\nc", read.header.Get("key"))
+	a.Equal(f.body, read.body)
+
+	// CONNECTED headers are not escaped
+	a.Equal("CONNECTED\nversion:1.2\n\n\x00", string(newFrame(cmdConnected, "version", "1.2").bytes()))
+}
@@ -0,0 +1,7 @@
+package stomp
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "stomp")
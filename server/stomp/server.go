@@ -0,0 +1,137 @@
+package stomp
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/router"
+)
+
+// Config is used for configuring the STOMP listener.
+type Config struct {
+	Enabled *bool
+	Listen  *string
+}
+
+// Server accepts STOMP 1.2 connections, mapping the destinations of the frames to guble topics.
+type Server struct {
+	config         Config
+	router         router.Router
+	tokenValidator auth.TokenValidator
+	messageLimiter MessageLimiter
+	messageQuota   MessageQuota
+
+	ln net.Listener
+
+	mu       sync.Mutex
+	sessions map[*session]bool
+	wg       sync.WaitGroup
+}
+
+// MessageLimiter limits the rate of the messages published by each identity, implemented by a webserver.RateLimiter.
+type MessageLimiter interface {
+	AllowMessage(identity string) bool
+}
+
+// MessageQuota counts the messages published by each identity against their daily quotas, implemented by quota.Quotas.
+type MessageQuota interface {
+	Use(identity string, size int) error
+}
+
+// New returns a new STOMP Server using the given router.
+func New(router router.Router, config Config) *Server {
+	return &Server{
+		config:   config,
+		router:   router,
+		sessions: make(map[*session]bool),
+	}
+}
+
+// WithTokenValidator requires a valid bearer token as passcode of the CONNECT frames;
+// the login (if any) has to be its subject.
+func (s *Server) WithTokenValidator(v auth.TokenValidator) *Server {
+	s.tokenValidator = v
+	return s
+}
+
+// WithMessageLimiter limits the rate of the SEND frames, by their authenticated user or else their IP address.
+func (s *Server) WithMessageLimiter(l MessageLimiter) *Server {
+	s.messageLimiter = l
+	return s
+}
+
+// WithMessageQuota counts the SEND frames against the daily quotas of their user.
+func (s *Server) WithMessageQuota(q MessageQuota) *Server {
+	s.messageQuota = q
+	return s
+}
+
+// Start listens on the configured address and serves the STOMP connections (implementing service.startable interface).
+func (s *Server) Start() error {
+	logger.WithField("address", *s.config.Listen).Info("STOMP server is starting up on address")
+
+	ln, err := net.Listen("tcp", *s.config.Listen)
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+
+	s.wg.Add(1)
+	go s.accept()
+	return nil
+}
+
+// Stop closes the listener and all the connections (implementing service.stopable interface).
+func (s *Server) Stop() error {
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	logger.WithField("address", *s.config.Listen).Info("STOMP server stopped")
+	return err
+}
+
+// GetAddr returns the address on which the STOMP server is listening.
+func (s *Server) GetAddr() string {
+	if s.ln == nil {
+		return "::unknown::"
+	}
+	return s.ln.Addr().String()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if !strings.HasSuffix(err.Error(), "use of closed network connection") {
+				logger.WithError(err).Error("Accept")
+			}
+			return
+		}
+
+		sess := newSession(conn, s.router)
+		sess.tokenValidator = s.tokenValidator
+		sess.messageLimiter = s.messageLimiter
+		sess.messageQuota = s.messageQuota
+		s.mu.Lock()
+		s.sessions[sess] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			sess.serve()
+			s.mu.Lock()
+			delete(s.sessions, sess)
+			s.mu.Unlock()
+		}()
+	}
+}
@@ -0,0 +1,36 @@
+package stomp
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/testutil"
+)
+
+func TestServer_StartStop(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	enabled := true
+	listen := "127.0.0.1:0"
+	s := New(NewMockRouter(testutil.MockCtrl), Config{Enabled: &enabled, Listen: &listen})
+	a.NoError(s.Start())
+
+	conn, err := net.Dial("tcp", s.GetAddr())
+	a.NoError(err)
+	defer conn.Close()
+	_, err = conn.Write(newFrame(cmdConnect, "accept-version", "1.2").bytes())
+	a.NoError(err)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	f, err := readFrame(bufio.NewReader(conn))
+	a.NoError(err)
+	a.Equal(cmdConnected, f.command)
+
+	a.NoError(s.Stop())
+}
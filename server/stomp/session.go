@@ -0,0 +1,374 @@
+package stomp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rs/xid"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/quota"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/webserver"
+)
+
+const (
+	stompVersion       = "1.2"
+	defaultChannelSize = 100
+
+	ackAuto = "auto"
+)
+
+// headers which are part of the STOMP protocol, and are not copied into the guble message header
+var protocolHeaders = map[string]bool{
+	"destination":    true,
+	"content-length": true,
+	"receipt":        true,
+	"transaction":    true,
+}
+
+type subscription struct {
+	id     string
+	ack    string
+	route  *router.Route
+	cancel chan struct{}
+}
+
+// session is a STOMP connection of a client.
+type session struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	router router.Router
+
+	// tokenValidator authenticates the CONNECT frames, if not nil
+	tokenValidator auth.TokenValidator
+	messageLimiter MessageLimiter
+	messageQuota   MessageQuota
+
+	id        string
+	userID    string
+	connected bool
+
+	rateLimitIdentity string
+	quotaIdentity     string
+
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	subscriptions map[string]*subscription
+	wg            sync.WaitGroup
+
+	logger *log.Entry
+}
+
+func newSession(conn net.Conn, router router.Router) *session {
+	id := xid.New().String()
+	return &session{
+		conn:          conn,
+		reader:        bufio.NewReader(conn),
+		router:        router,
+		id:            id,
+		subscriptions: make(map[string]*subscription),
+		logger:        logger.WithField("session", id),
+	}
+}
+
+// serve handles the frames of the client until the connection is closed.
+func (s *session) serve() {
+	defer s.close()
+
+	for {
+		f, err := readFrame(s.reader)
+		if err != nil {
+			if err != io.EOF {
+				s.logger.WithError(err).Info("Could not read STOMP frame")
+				s.sendError(nil, "malformed frame", err.Error())
+			}
+			return
+		}
+
+		if err := s.handle(f); err != nil {
+			s.sendError(f, err.Error(), "")
+			return
+		}
+		if f.command == cmdDisconnect {
+			return
+		}
+	}
+}
+
+func (s *session) handle(f *frame) error {
+	if !s.connected && f.command != cmdConnect && f.command != cmdStomp {
+		return fmt.Errorf("not connected")
+	}
+
+	var err error
+	switch f.command {
+	case cmdConnect, cmdStomp:
+		return s.connect(f)
+	case cmdSend:
+		err = s.send(f)
+	case cmdSubscribe:
+		err = s.subscribe(f)
+	case cmdUnsubscribe:
+		err = s.unsubscribe(f)
+	case cmdAck, cmdNack:
+		// guble does not redeliver messages, so acknowledgements only have to be valid
+		if f.header.Get("id") == "" {
+			err = fmt.Errorf("missing id header")
+		}
+	case cmdBegin, cmdCommit, cmdAbort:
+		err = fmt.Errorf("transactions are not supported")
+	case cmdDisconnect:
+	default:
+		err = fmt.Errorf("unknown command: %s", f.command)
+	}
+	if err != nil {
+		return err
+	}
+
+	if receipt := f.header.Get("receipt"); receipt != "" {
+		s.write(newFrame(cmdReceipt, "receipt-id", receipt))
+	}
+	return nil
+}
+
+func (s *session) connect(f *frame) error {
+	if s.connected {
+		return fmt.Errorf("already connected")
+	}
+	if !supportsVersion(f.header.Get("accept-version")) {
+		return fmt.Errorf("supported protocol version is %s", stompVersion)
+	}
+	s.userID = f.header.Get("login")
+	verifiedUserID := ""
+	if s.tokenValidator != nil {
+		userID, err := auth.AuthenticateToken(s.tokenValidator, f.header.Get("passcode"), s.userID)
+		if err != nil {
+			return err
+		}
+		s.userID = userID
+		verifiedUserID = userID
+	}
+	s.rateLimitIdentity = webserver.ConnIdentity(verifiedUserID, s.conn.RemoteAddr().String())
+	s.quotaIdentity = quota.Identity("", s.userID)
+	s.connected = true
+	s.logger = s.logger.WithField("userID", s.userID)
+
+	s.write(newFrame(cmdConnected,
+		"version", stompVersion,
+		"heart-beat", "0,0",
+		"server", "guble",
+		"session", s.id,
+	))
+	return nil
+}
+
+func (s *session) send(f *frame) error {
+	destination := f.header.Get("destination")
+	if destination == "" {
+		return fmt.Errorf("missing destination header")
+	}
+	if f.header.Get("transaction") != "" {
+		return fmt.Errorf("transactions are not supported")
+	}
+
+	m := &protocol.Message{
+		Path:          protocol.Path(destination),
+		UserID:        s.userID,
+		ApplicationID: s.id,
+		HeaderJSON:    headerJSON(f.header),
+		Body:          f.body,
+	}
+	if s.messageLimiter != nil && !s.messageLimiter.AllowMessage(s.rateLimitIdentity) {
+		return fmt.Errorf("rate limit exceeded")
+	}
+	if s.messageQuota != nil && s.quotaIdentity != "" {
+		if err := s.messageQuota.Use(s.quotaIdentity, len(m.Body)); err != nil {
+			return err
+		}
+	}
+	return s.router.HandleMessage(m)
+}
+
+func (s *session) subscribe(f *frame) error {
+	id := f.header.Get("id")
+	destination := f.header.Get("destination")
+	if id == "" || destination == "" {
+		return fmt.Errorf("missing id or destination header")
+	}
+	if router.IsDraining(s.router) {
+		return router.ErrDraining
+	}
+	ack := f.header.Get("ack")
+	if ack == "" {
+		ack = ackAuto
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.subscriptions[id]; exists {
+		return fmt.Errorf("subscription %s already exists", id)
+	}
+
+	route := router.NewRoute(router.RouteConfig{
+		RouteParams: router.RouteParams{"application_id": s.id + "-" + id, "user_id": s.userID},
+		Path:        protocol.Path(destination),
+		ChannelSize: defaultChannelSize,
+	})
+	if _, err := s.router.Subscribe(route); err != nil {
+		return err
+	}
+
+	sub := &subscription{id: id, ack: ack, route: route, cancel: make(chan struct{})}
+	s.subscriptions[id] = sub
+	s.wg.Add(1)
+	go s.forward(sub)
+	return nil
+}
+
+func (s *session) unsubscribe(f *frame) error {
+	id := f.header.Get("id")
+	s.mu.Lock()
+	sub, exists := s.subscriptions[id]
+	delete(s.subscriptions, id)
+	s.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("unknown subscription: %s", id)
+	}
+	s.stop(sub)
+	return nil
+}
+
+// forward sends the messages of a subscription as MESSAGE frames.
+func (s *session) forward(sub *subscription) {
+	defer s.wg.Done()
+	route := sub.route
+	for {
+		select {
+		case m, opened := <-route.MessagesChannel():
+			if !opened {
+				select {
+				case <-sub.cancel:
+					return
+				default:
+				}
+				s.logger.WithField("route", route.String()).Info("Route closed by router, subscribing again")
+				route = router.NewRoute(route.RouteConfig)
+				if _, err := s.router.Subscribe(route); err != nil {
+					s.logger.WithError(err).Error("Could not subscribe again")
+					return
+				}
+				s.mu.Lock()
+				sub.route = route
+				s.mu.Unlock()
+				continue
+			}
+			s.write(messageFrame(sub, m))
+		case <-sub.cancel:
+			return
+		}
+	}
+}
+
+func (s *session) stop(sub *subscription) {
+	close(sub.cancel)
+	s.mu.Lock()
+	route := sub.route
+	s.mu.Unlock()
+	s.router.Unsubscribe(route)
+}
+
+func (s *session) close() {
+	s.mu.Lock()
+	subscriptions := s.subscriptions
+	s.subscriptions = make(map[string]*subscription)
+	s.mu.Unlock()
+
+	for _, sub := range subscriptions {
+		s.stop(sub)
+	}
+	s.wg.Wait()
+	s.conn.Close()
+}
+
+func (s *session) sendError(f *frame, message, details string) {
+	errFrame := newFrame(cmdError, "message", message)
+	if f != nil {
+		if receipt := f.header.Get("receipt"); receipt != "" {
+			errFrame.header = append(errFrame.header, [2]string{"receipt-id", receipt})
+		}
+		if f.command == cmdConnect || f.command == cmdStomp {
+			errFrame.header = append(errFrame.header, [2]string{"version", stompVersion})
+		}
+	}
+	errFrame.body = []byte(details)
+	s.write(errFrame)
+}
+
+func (s *session) write(f *frame) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.conn.Write(f.bytes()); err != nil {
+		s.logger.WithError(err).WithField("command", f.command).Debug("Could not write STOMP frame")
+	}
+}
+
+func messageFrame(sub *subscription, m *protocol.Message) *frame {
+	messageID := strconv.FormatUint(m.ID, 10)
+	f := newFrame(cmdMessage,
+		"subscription", sub.id,
+		"message-id", messageID,
+		"destination", string(m.Path),
+	)
+	if sub.ack != ackAuto {
+		f.header = append(f.header, [2]string{"ack", messageID})
+	}
+	if m.HeaderJSON != "" {
+		var h map[string]interface{}
+		if err := json.Unmarshal([]byte(m.HeaderJSON), &h); err == nil {
+			for k, v := range h {
+				if value, ok := v.(string); ok && !protocolHeaders[k] && f.header.Get(k) == "" {
+					f.header = append(f.header, [2]string{k, value})
+				}
+			}
+		}
+	}
+	f.body = m.Body
+	return f
+}
+
+// headerJSON converts the application headers of a SEND frame to the JSON header of a guble message.
+func headerJSON(h header) string {
+	values := make(map[string]string)
+	for _, kv := range h {
+		if _, exists := values[kv[0]]; !exists && !protocolHeaders[kv[0]] {
+			values[kv[0]] = kv[1]
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func supportsVersion(acceptVersion string) bool {
+	for _, v := range strings.Split(acceptVersion, ",") {
+		if strings.TrimSpace(v) == stompVersion {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package stomp
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	doneC  chan bool
+}
+
+func newClient(routerMock router.Router) *client {
+	serverConn, clientConn := net.Pipe()
+	c := &client{conn: clientConn, reader: bufio.NewReader(clientConn), doneC: make(chan bool)}
+	go func() {
+		newSession(serverConn, routerMock).serve()
+		close(c.doneC)
+	}()
+	return c
+}
+
+func (c *client) send(a *assert.Assertions, f *frame) {
+	_, err := c.conn.Write(f.bytes())
+	a.NoError(err)
+}
+
+func (c *client) receive(a *assert.Assertions, command string) *frame {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	f, err := readFrame(c.reader)
+	a.NoError(err)
+	if f != nil {
+		a.Equal(command, f.command, string(f.body))
+	}
+	return f
+}
+
+func (c *client) connect(a *assert.Assertions) {
+	c.send(a, newFrame(cmdConnect, "accept-version", "1.1,1.2", "host", "guble", "login", "user01"))
+	f := c.receive(a, cmdConnected)
+	a.Equal("1.2", f.header.Get("version"))
+}
+
+func TestSession_Send(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	c := newClient(routerMock)
+	c.connect(a)
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/foo"), m.Path)
+		a.Equal("user01", m.UserID)
+		a.Equal(`{"correlation-id":"abc"}`, m.HeaderJSON)
+		a.Equal([]byte("hello"), m.Body)
+	}).Return(nil)
+
+	send := newFrame(cmdSend, "destination", "/foo", "correlation-id", "abc", "receipt", "r1")
+	send.body = []byte("hello")
+	c.send(a, send)
+	a.Equal("r1", c.receive(a, cmdReceipt).header.Get("receipt-id"))
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).
+		Return(&router.PermissionDeniedError{UserID: "user01", AccessType: auth.WRITE, Path: "/bar"})
+	c.send(a, newFrame(cmdSend, "destination", "/bar", "receipt", "r2"))
+	a.Equal("r2", c.receive(a, cmdError).header.Get("receipt-id"))
+
+	// the connection is closed after an error
+	select {
+	case <-c.doneC:
+	case <-time.After(time.Second):
+		a.Fail("session was not closed")
+	}
+}
+
+func TestSession_Subscribe(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	c := newClient(routerMock)
+	c.connect(a)
+
+	var route *router.Route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo"), r.Path)
+		a.Equal("user01", r.Get("user_id"))
+		route = r
+	}).Return(nil, nil)
+	c.send(a, newFrame(cmdSubscribe, "id", "0", "destination", "/foo", "ack", "client", "receipt", "r1"))
+	c.receive(a, cmdReceipt)
+
+	a.NoError(route.Deliver(&protocol.Message{
+		ID:         42,
+		Path:       "/foo/bar",
+		HeaderJSON: `{"correlation-id":"abc"}`,
+		Body:       []byte("hello"),
+	}, false))
+	f := c.receive(a, cmdMessage)
+	a.Equal("0", f.header.Get("subscription"))
+	a.Equal("42", f.header.Get("message-id"))
+	a.Equal("42", f.header.Get("ack"))
+	a.Equal("/foo/bar", f.header.Get("destination"))
+	a.Equal("abc", f.header.Get("correlation-id"))
+	a.Equal([]byte("hello"), f.body)
+
+	c.send(a, newFrame(cmdAck, "id", "42", "receipt", "r2"))
+	c.receive(a, cmdReceipt)
+
+	routerMock.EXPECT().Unsubscribe(route)
+	c.send(a, newFrame(cmdUnsubscribe, "id", "0", "receipt", "r3"))
+	c.receive(a, cmdReceipt)
+
+	c.send(a, newFrame(cmdDisconnect, "receipt", "r4"))
+	a.Equal("r4", c.receive(a, cmdReceipt).header.Get("receipt-id"))
+	select {
+	case <-c.doneC:
+	case <-time.After(time.Second):
+		a.Fail("session was not closed")
+	}
+}
+
+func TestSession_UnsubscribesOnClose(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	c := newClient(routerMock)
+	c.connect(a)
+
+	var route *router.Route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		route = r
+	}).Return(nil, nil)
+	c.send(a, newFrame(cmdSubscribe, "id", "0", "destination", "/foo", "receipt", "r1"))
+	c.receive(a, cmdReceipt)
+
+	routerMock.EXPECT().Unsubscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(route, r)
+	})
+	c.conn.Close()
+	select {
+	case <-c.doneC:
+	case <-time.After(time.Second):
+		a.Fail("session was not closed")
+	}
+}
+
+func TestSession_ProtocolErrors(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+
+	// frames before CONNECT are refused
+	c := newClient(routerMock)
+	c.send(a, newFrame(cmdSend, "destination", "/foo"))
+	c.receive(a, cmdError)
+
+	// only STOMP 1.2 is supported
+	c = newClient(routerMock)
+	c.send(a, newFrame(cmdConnect, "accept-version", "1.0,1.1"))
+	a.Equal("1.2", c.receive(a, cmdError).header.Get("version"))
+
+	c = newClient(routerMock)
+	c.connect(a)
+	c.send(a, newFrame(cmdBegin, "transaction", "tx1"))
+	a.Equal("transactions are not supported", c.receive(a, cmdError).header.Get("message"))
+}
+
+// fakeValidator accepts the token "valid", whose subject is user01.
+type fakeValidator struct{}
+
+func (fakeValidator) Validate(token string) (*auth.Claims, error) {
+	if token != "valid" {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Claims{Subject: "user01"}, nil
+}
+
+func TestSession_ConnectAuthenticated(t *testing.T) {
+	a := assert.New(t)
+
+	c, _ := newAuthenticatedClient()
+	c.send(a, newFrame(cmdConnect, "accept-version", "1.2", "login", "user01", "passcode", "invalid"))
+	a.Equal(auth.ErrInvalidToken.Error(), c.receive(a, cmdError).header.Get("message"))
+
+	c, sess := newAuthenticatedClient()
+	c.send(a, newFrame(cmdConnect, "accept-version", "1.2", "passcode", "valid"))
+	c.receive(a, cmdConnected)
+	a.Equal("user01", sess.userID)
+}
+
+func newAuthenticatedClient() (*client, *session) {
+	serverConn, clientConn := net.Pipe()
+	c := &client{conn: clientConn, reader: bufio.NewReader(clientConn), doneC: make(chan bool)}
+	sess := newSession(serverConn, nil)
+	sess.tokenValidator = fakeValidator{}
+	go func() {
+		sess.serve()
+		close(c.doneC)
+	}()
+	return c, sess
+}
+
+func TestSession_SendRateLimited(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	serverConn, clientConn := net.Pipe()
+	c := &client{conn: clientConn, reader: bufio.NewReader(clientConn), doneC: make(chan bool)}
+	sess := newSession(serverConn, routerMock)
+	sess.messageLimiter = &testMessageLimiter{identity: "ip:pipe", messages: 1}
+	go func() {
+		sess.serve()
+		close(c.doneC)
+	}()
+	c.connect(a)
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Return(nil)
+	c.send(a, newFrame(cmdSend, "destination", "/foo", "receipt", "r1"))
+	c.receive(a, cmdReceipt)
+
+	c.send(a, newFrame(cmdSend, "destination", "/foo", "receipt", "r2"))
+	a.Equal("rate limit exceeded", c.receive(a, cmdError).header.Get("message"))
+}
+
+// testMessageLimiter allows a number of messages to the identity
+type testMessageLimiter struct {
+	identity string
+	messages int
+}
+
+func (l *testMessageLimiter) AllowMessage(identity string) bool {
+	if identity != l.identity || l.messages == 0 {
+		return false
+	}
+	l.messages--
+	return true
+}
@@ -201,3 +201,8 @@ func (dms *DummyMessageStore) Partition(name string) (store.MessagePartition, er
 func (dms *DummyMessageStore) Partitions() ([]store.MessagePartition, error) {
 	return nil, nil
 }
+
+// Purge is a part of the `store.Purger` implementation. There is nothing to delete, as no messages are stored.
+func (dms *DummyMessageStore) Purge(partition string) error {
+	return nil
+}
@@ -4,6 +4,9 @@ import (
 	"errors"
 	"math"
 	"sync"
+	"time"
+
+	"github.com/smancke/guble/protocol"
 )
 
 var ErrRequestDone = errors.New("Fetch request is done")
@@ -109,7 +112,11 @@ func (fr *FetchRequest) Push(id uint64, message []byte) {
 	fr.PushFetchMessage(&FetchedMessage{id, message})
 }
 
+// PushFetchMessage sends the fetched message to the receiver, unless it is expired.
 func (fr *FetchRequest) PushFetchMessage(fm *FetchedMessage) {
+	if protocol.IsExpired(fm.Message, time.Now()) {
+		return
+	}
 	fr.MessageC <- fm
 }
 
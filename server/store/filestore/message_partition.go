@@ -297,6 +297,37 @@ func (p *messagePartition) Close() error {
 	return p.closeAppendFiles()
 }
 
+// purge deletes the message and index files of the partition, and resets its index.
+// The max message ID is kept: the IDs of the next messages are generated from the time, so they are greater anyway.
+func (p *messagePartition) purge() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if err := p.closeAppendFiles(); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(p.basedir)
+	if err != nil {
+		return err
+	}
+	for _, fileInfo := range files {
+		name := fileInfo.Name()
+		if strings.HasPrefix(name, p.name+"-") && (strings.HasSuffix(name, ".msg") || strings.HasSuffix(name, ".idx")) {
+			if err := os.Remove(filepath.Join(p.basedir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	p.fileCache = newCache()
+	p.list.clear()
+	p.entriesCount = 0
+	p.totalNumberOfMessages = 0
+	p.appendFilePosition = 0
+
+	logger.WithField("partition", p.name).Info("Purged partition")
+	return nil
+}
+
 func (p *messagePartition) DoInTx(fnToExecute func(maxMessageId uint64) error) error {
 	p.Lock()
 	defer p.Unlock()
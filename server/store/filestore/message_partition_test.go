@@ -136,6 +136,33 @@ func Test_MessagePartition_correctIdAfterRestart(t *testing.T) {
 	a.Equal(uint64(2), newMStore.Count())
 }
 
+func Test_MessagePartition_purge(t *testing.T) {
+	a := assert.New(t)
+	dir, _ := ioutil.TempDir("", "guble_message_partition_test")
+	defer os.RemoveAll(dir)
+	mStore, _ := newMessagePartition(dir, "myMessages")
+
+	a.NoError(mStore.Store(uint64(1), []byte("aaaaaaaaaa")))
+	a.NoError(mStore.Store(uint64(2), []byte("aaaaaaaaaa")))
+
+	// when purging the partition
+	a.NoError(mStore.purge())
+
+	// then its messages are deleted, but not its max message ID
+	a.Equal(uint64(0), mStore.Count())
+	a.Equal(uint64(2), mStore.MaxMessageID())
+	files, _ := ioutil.ReadDir(dir)
+	a.Empty(files)
+
+	// and the next messages are stored in new files
+	a.NoError(mStore.Store(uint64(3), []byte("bbbbbbbbbb")))
+	a.NoError(mStore.Close())
+	newMStore, err := newMessagePartition(dir, "myMessages")
+	a.NoError(err)
+	a.Equal(uint64(1), newMStore.Count())
+	a.Equal(uint64(3), newMStore.MaxMessageID())
+}
+
 func Benchmark_Storing_HelloWorld_Messages(b *testing.B) {
 	a := assert.New(b)
 	dir, _ := ioutil.TempDir("", "guble_message_partition_test")
@@ -145,6 +145,18 @@ func (fms *FileMessageStore) DoInTx(partition string, fnToExecute func(maxMessag
 	return p.DoInTx(fnToExecute)
 }
 
+// Purge deletes all the messages of a partition.
+// It is a part of the `store.Purger` implementation.
+func (fms *FileMessageStore) Purge(partition string) error {
+	if _, err := fms.Partition(partition); err != nil {
+		return err
+	}
+	fms.mutex.RLock()
+	p := fms.partitions[partition]
+	fms.mutex.RUnlock()
+	return p.purge()
+}
+
 // Partitions will walk the filesystem and return all message partitions
 // TODO Bogdan This is not required anymore as the store already read the partitions
 // and saved them in the cacheEntry for the store. Retrieve from there if possible
@@ -38,6 +38,13 @@ type MessageStore interface {
 	Partitions() ([]MessagePartition, error)
 }
 
+// Purger is implemented by the message stores which can delete the stored messages of a partition.
+type Purger interface {
+	// Purge deletes all the messages of the partition.
+	// The IDs of the messages stored afterwards are still greater than the deleted ones.
+	Purge(partition string) error
+}
+
 type MessagePartition interface {
 
 	// Name returns the name of the partition
@@ -0,0 +1,109 @@
+// Package systemd implements the notifications of the services of Type=notify to systemd (sd_notify):
+// the readiness, the watchdog pings and the stopping of the service.
+// All of them do nothing when the process is not started by systemd with a notification socket.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// Ready tells systemd that the service is started.
+	Ready = "READY=1"
+
+	// Stopping tells systemd that the service is stopping.
+	Stopping = "STOPPING=1"
+
+	// Watchdog keeps the watchdog of the service from restarting it.
+	Watchdog = "WATCHDOG=1"
+
+	notifySocketEnvvar = "NOTIFY_SOCKET"
+	watchdogUsecEnvvar = "WATCHDOG_USEC"
+	watchdogPIDEnvvar  = "WATCHDOG_PID"
+)
+
+var logger = log.WithField("module", "systemd")
+
+// Notify sends the state (e.g. Ready, or several newline-separated assignments) to the notification socket of systemd.
+// It returns false if there is no notification socket, i.e. if the process is not a service of Type=notify.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv(notifySocketEnvvar)
+	if socket == "" {
+		return false, nil
+	}
+	// the names of the abstract sockets start with @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Status returns the state describing the status of the service in `systemctl status`.
+func Status(status string) string {
+	return "STATUS=" + status
+}
+
+// ExtendTimeout returns the state asking systemd to extend the current timeout (e.g. of stopping) to the duration.
+func ExtendTimeout(d time.Duration) string {
+	return "EXTEND_TIMEOUT_USEC=" + strconv.FormatInt(int64(d/time.Microsecond), 10)
+}
+
+// WatchdogInterval returns the interval of the watchdog of the service (WatchdogSec), or 0 if it is not enabled
+// for this process.
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv(watchdogUsecEnvvar)
+	if usec == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", watchdogUsecEnvvar, usec)
+	}
+	if pid := os.Getenv(watchdogPIDEnvvar); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	return time.Duration(n) * time.Microsecond, nil
+}
+
+// StartWatchdog pings the watchdog of the service at half its interval, until the stop channel is closed.
+// It returns false if the watchdog is not enabled.
+func StartWatchdog(stop <-chan bool) bool {
+	interval, err := WatchdogInterval()
+	if err != nil {
+		logger.WithError(err).Error("Invalid watchdog interval")
+		return false
+	}
+	if interval == 0 {
+		return false
+	}
+	logger.WithField("interval", interval).Info("Starting the watchdog pings")
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := Notify(Watchdog); err != nil {
+					logger.WithError(err).Error("Error on pinging the watchdog")
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return true
+}
@@ -0,0 +1,100 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// listen creates a notification socket, set in NOTIFY_SOCKET until the returned func is called.
+func listen(t *testing.T) (*net.UnixConn, func()) {
+	dir, err := ioutil.TempDir("", "guble_systemd_test")
+	assert.NoError(t, err)
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	assert.NoError(t, err)
+	os.Setenv(notifySocketEnvvar, socket)
+	return conn, func() {
+		os.Unsetenv(notifySocketEnvvar)
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buff := make([]byte, 256)
+	n, err := conn.Read(buff)
+	assert.NoError(t, err)
+	return string(buff[:n])
+}
+
+func TestNotify(t *testing.T) {
+	a := assert.New(t)
+
+	// without a notification socket, nothing is sent
+	sent, err := Notify(Ready)
+	a.NoError(err)
+	a.False(sent)
+
+	conn, stop := listen(t)
+	defer stop()
+
+	sent, err = Notify(Ready + "\n" + Status("started"))
+	a.NoError(err)
+	a.True(sent)
+	a.Equal("READY=1\nSTATUS=started", receive(t, conn))
+
+	_, err = Notify(ExtendTimeout(90 * time.Second))
+	a.NoError(err)
+	a.Equal("EXTEND_TIMEOUT_USEC=90000000", receive(t, conn))
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	a := assert.New(t)
+
+	interval, err := WatchdogInterval()
+	a.NoError(err)
+	a.Equal(time.Duration(0), interval)
+
+	os.Setenv(watchdogUsecEnvvar, "30000000")
+	defer os.Unsetenv(watchdogUsecEnvvar)
+	interval, err = WatchdogInterval()
+	a.NoError(err)
+	a.Equal(30*time.Second, interval)
+
+	// the watchdog of another process
+	os.Setenv(watchdogPIDEnvvar, strconv.Itoa(os.Getpid()+1))
+	defer os.Unsetenv(watchdogPIDEnvvar)
+	interval, err = WatchdogInterval()
+	a.NoError(err)
+	a.Equal(time.Duration(0), interval)
+
+	os.Setenv(watchdogPIDEnvvar, strconv.Itoa(os.Getpid()))
+	os.Setenv(watchdogUsecEnvvar, "soon")
+	_, err = WatchdogInterval()
+	a.Error(err)
+}
+
+func TestStartWatchdog(t *testing.T) {
+	a := assert.New(t)
+
+	stopWatchdog := make(chan bool)
+	a.False(StartWatchdog(stopWatchdog))
+
+	conn, stop := listen(t)
+	defer stop()
+	os.Setenv(watchdogUsecEnvvar, "20000")
+	defer os.Unsetenv(watchdogUsecEnvvar)
+
+	a.True(StartWatchdog(stopWatchdog))
+	defer close(stopWatchdog)
+	a.Equal(Watchdog, receive(t, conn))
+	a.Equal(Watchdog, receive(t, conn))
+}
@@ -0,0 +1,7 @@
+package telegram
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "telegram")
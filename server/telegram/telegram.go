@@ -0,0 +1,114 @@
+package telegram
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// schema is the default database schema for Telegram
+	schema = "telegram_registration"
+
+	chatIDKey = "chat_id"
+)
+
+// Config is used for configuring the Telegram component.
+type Config struct {
+	Enabled   *bool
+	BotToken  *string
+	Endpoint  *string
+	ParseMode *string
+	Timeout   *time.Duration
+	Workers   *int
+	Prefix    *string
+}
+
+// telegram is the connector delivering messages to Telegram chats, through the Bot API.
+// A subscription is created by a POST request to `<prefix><chat_id>/<topic>`.
+type telegram struct {
+	Config
+	connector.Connector
+}
+
+// New creates a new Telegram connector and returns it as a connector.ResponsiveConnector
+func New(router router.Router, sender connector.Sender, config Config) (connector.ResponsiveConnector, error) {
+	baseConn, err := connector.NewConnector(router, sender, connector.Config{
+		Name:       "telegram",
+		Schema:     schema,
+		Prefix:     *config.Prefix,
+		URLPattern: fmt.Sprintf("/{%s}/{%s:.*}", chatIDKey, connector.TopicParam),
+		Workers:    *config.Workers,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Base connector error")
+		return nil, err
+	}
+
+	t := &telegram{config, baseConn}
+	t.SetResponseHandler(t)
+	return t, nil
+}
+
+func (t *telegram) Start() error {
+	err := t.Connector.Start()
+	if err == nil {
+		mTotalSentMessages.Set(0)
+		mTotalSendErrors.Set(0)
+		mTotalResponseErrors.Set(0)
+		mTotalResponseInternalErrors.Set(0)
+		mTotalResponseUnreachableChatErrors.Set(0)
+		mTotalResponseOtherErrors.Set(0)
+	}
+	return err
+}
+
+func (t *telegram) HandleResponse(request connector.Request, responseIface interface{}, metadata *connector.Metadata, err error) error {
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("Error sending message to Telegram")
+		mTotalSendErrors.Add(1)
+		return err
+	}
+	message := request.Message()
+	subscriber := request.Subscriber()
+
+	response, ok := responseIface.(*Response)
+	if !ok {
+		mTotalResponseErrors.Add(1)
+		return fmt.Errorf("Invalid Telegram Response")
+	}
+
+	if response.ChatUnreachable() {
+		logger.WithFields(log.Fields{
+			"chatID":      subscriber.Route().Get(chatIDKey),
+			"description": response.Description,
+		}).Info("Removing Telegram subscription of unreachable chat")
+		mTotalResponseUnreachableChatErrors.Add(1)
+		return t.Manager().Remove(subscriber)
+	}
+
+	subscriber.SetLastID(message.ID)
+	if err := t.Manager().Update(subscriber); err != nil {
+		logger.WithField("error", err.Error()).Error("Manager could not update subscription")
+		mTotalResponseInternalErrors.Add(1)
+		return err
+	}
+
+	if !response.Ok {
+		logger.WithFields(log.Fields{
+			"errorCode":   response.ErrorCode,
+			"description": response.Description,
+			"messageID":   message.ID,
+		}).Error("Unexpected response from Telegram")
+		mTotalResponseOtherErrors.Add(1)
+		return nil
+	}
+
+	logger.WithField("messageID", message.ID).Debug("Delivered message to Telegram")
+	mTotalSentMessages.Add(1)
+	return nil
+}
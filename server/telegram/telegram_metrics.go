@@ -0,0 +1,15 @@
+package telegram
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                                  = metrics.NS("telegram")
+	mTotalSentMessages                  = ns.NewInt("total_sent_messages")
+	mTotalSendErrors                    = ns.NewInt("total_sent_message_errors")
+	mTotalResponseErrors                = ns.NewInt("total_response_errors")
+	mTotalResponseInternalErrors        = ns.NewInt("total_response_internal_errors")
+	mTotalResponseUnreachableChatErrors = ns.NewInt("total_response_unreachable_chat_errors")
+	mTotalResponseOtherErrors           = ns.NewInt("total_response_other_errors")
+)
@@ -0,0 +1,105 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+)
+
+const (
+	// DefaultEndpoint is the base URL of the Telegram Bot API
+	DefaultEndpoint = "https://api.telegram.org"
+
+	// Parse modes of the message texts
+	ParseModeNone     = ""
+	ParseModeMarkdown = "Markdown"
+	ParseModeHTML     = "HTML"
+
+	// parseModeHeaderKey is the key in the JSON header of a guble message overriding the parse mode
+	parseModeHeaderKey = "telegram_parse_mode"
+)
+
+// Response is the result returned by the Bot API.
+type Response struct {
+	Ok          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+// ChatUnreachable returns true if messages can not be delivered to the chat of the subscription anymore
+// (e.g. the bot was blocked by the user, or removed from the group).
+func (r *Response) ChatUnreachable() bool {
+	return r.ErrorCode == http.StatusForbidden ||
+		(r.ErrorCode == http.StatusBadRequest && strings.Contains(r.Description, "chat not found"))
+}
+
+type sendMessageRequest struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+type sender struct {
+	client    *http.Client
+	url       string
+	parseMode string
+}
+
+// NewSender returns a connector.Sender for the Telegram Bot API, using the given bot token.
+func NewSender(endpoint, botToken, parseMode string, timeout time.Duration) *sender {
+	return &sender{
+		client:    &http.Client{Timeout: timeout},
+		url:       fmt.Sprintf("%s/bot%s/sendMessage", endpoint, botToken),
+		parseMode: parseMode,
+	}
+}
+
+// Send sends the body of the message as text to the chat of the subscriber, and returns a *Response.
+func (s *sender) Send(request connector.Request) (interface{}, error) {
+	message := request.Message()
+	body, err := json.Marshal(&sendMessageRequest{
+		ChatID:    request.Subscriber().Route().Get(chatIDKey),
+		Text:      string(message.Body),
+		ParseMode: s.messageParseMode(message),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response := &Response{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("could not decode Telegram response (status code %d): %s", resp.StatusCode, err)
+	}
+	logger.WithFields(log.Fields{
+		"ok":        response.Ok,
+		"errorCode": response.ErrorCode,
+	}).Debug("Sent message to Telegram")
+	return response, nil
+}
+
+// messageParseMode returns the parse mode given in the header of the message, or else the configured one.
+func (s *sender) messageParseMode(message *protocol.Message) string {
+	if message.HeaderJSON != "" {
+		header := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(message.HeaderJSON), &header); err == nil {
+			if mode, ok := header[parseModeHeaderKey].(string); ok {
+				return mode
+			}
+		}
+	}
+	return s.parseMode
+}
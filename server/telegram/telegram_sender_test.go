@@ -0,0 +1,64 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/router"
+)
+
+func newTestRequest(chatID string, m *protocol.Message) connector.Request {
+	s := connector.NewSubscriber(m.Path, router.RouteParams{chatIDKey: chatID}, 0)
+	return connector.NewRequest(s, m)
+}
+
+func TestSender_Send(t *testing.T) {
+	a := assert.New(t)
+	var received sendMessageRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		a.Equal("/bot123:abc/sendMessage", req.URL.Path)
+		a.Equal("application/json", req.Header.Get("Content-Type"))
+		a.NoError(json.NewDecoder(req.Body).Decode(&received))
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":1}}`)
+	}))
+	defer server.Close()
+
+	s := NewSender(server.URL, "123:abc", ParseModeMarkdown, time.Second)
+	response, err := s.Send(newTestRequest("42", &protocol.Message{ID: 1, Path: "/topic", Body: []byte("*hello*")}))
+	a.NoError(err)
+	a.True(response.(*Response).Ok)
+	a.Equal(sendMessageRequest{ChatID: "42", Text: "*hello*", ParseMode: ParseModeMarkdown}, received)
+
+	// the parse mode can be overridden by the message header
+	_, err = s.Send(newTestRequest("42", &protocol.Message{
+		ID:         2,
+		Path:       "/topic",
+		HeaderJSON: `{"telegram_parse_mode":"HTML"}`,
+		Body:       []byte("<b>hello</b>"),
+	}))
+	a.NoError(err)
+	a.Equal(ParseModeHTML, received.ParseMode)
+}
+
+func TestSender_SendError(t *testing.T) {
+	a := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+	}))
+	defer server.Close()
+
+	s := NewSender(server.URL, "123:abc", ParseModeNone, time.Second)
+	response, err := s.Send(newTestRequest("42", &protocol.Message{ID: 1, Path: "/topic"}))
+	a.NoError(err)
+	a.False(response.(*Response).Ok)
+	a.True(response.(*Response).ChatUnreachable())
+}
@@ -0,0 +1,89 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+func testTelegram(t *testing.T) (*telegram, *MockRouter) {
+	enabled := true
+	botToken := "123:abc"
+	endpoint := DefaultEndpoint
+	parseMode := ParseModeNone
+	timeout := time.Second
+	workers := 1
+	prefix := "/telegram/"
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().KVStore().Return(kvstore.NewMemoryKVStore(), nil).AnyTimes()
+
+	conn, err := New(routerMock, NewSender(endpoint, botToken, parseMode, timeout), Config{
+		Enabled:   &enabled,
+		BotToken:  &botToken,
+		Endpoint:  &endpoint,
+		ParseMode: &parseMode,
+		Timeout:   &timeout,
+		Workers:   &workers,
+		Prefix:    &prefix,
+	})
+	assert.NoError(t, err)
+	return conn.(*telegram), routerMock
+}
+
+func TestTelegram_PostSubscription(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	tg, routerMock := testTelegram(t)
+	a.NoError(tg.Start())
+	defer tg.Stop()
+
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/topic"), r.Path)
+		a.Equal("-100123", r.Get(chatIDKey))
+	}).Return(nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/telegram/-100123/topic", strings.NewReader(""))
+	a.NoError(err)
+	tg.ServeHTTP(recorder, req)
+	a.Equal(`{"subscribed":"/topic"}`, recorder.Body.String())
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestTelegram_HandleResponse(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	tg, _ := testTelegram(t)
+	subscriber, err := tg.Manager().Create("/topic", router.RouteParams{chatIDKey: "42"})
+	a.NoError(err)
+
+	request := connector.NewRequest(subscriber, &protocol.Message{ID: 5, Path: "/topic"})
+	a.NoError(tg.HandleResponse(request, &Response{Ok: true}, nil, nil))
+	data, err := subscriber.Encode()
+	a.NoError(err)
+	a.Contains(string(data), `"LastID":5`)
+
+	a.Error(tg.HandleResponse(request, "invalid", nil, nil))
+	a.NoError(tg.HandleResponse(request, &Response{ErrorCode: http.StatusTooManyRequests}, nil, nil))
+	a.Len(tg.Manager().List(), 1)
+
+	// subscriptions of chats which blocked the bot are removed
+	a.NoError(tg.HandleResponse(request, &Response{ErrorCode: http.StatusForbidden, Description: "Forbidden: bot was blocked by the user"}, nil, nil))
+	a.Len(tg.Manager().List(), 0)
+}
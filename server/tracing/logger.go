@@ -0,0 +1,7 @@
+package tracing
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "tracing")
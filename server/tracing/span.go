@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/smancke/guble/protocol"
+)
+
+// TraceparentHeader is the W3C Trace Context header propagating the span context, in the HTTP requests
+// and in the header of the messages.
+const TraceparentHeader = "traceparent"
+
+// SpanContext identifies a span inside its trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid returns true if the span context identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent returns the span context in the format of the traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// ParseTraceparent returns the span context of a traceparent header, and false if it is invalid.
+func ParseTraceparent(traceparent string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// FromRequest returns the span context propagated by the traceparent header of the HTTP request, if any.
+func FromRequest(r *http.Request) SpanContext {
+	sc, _ := ParseTraceparent(r.Header.Get(TraceparentHeader))
+	return sc
+}
+
+// FromMessage returns the span context propagated in the header of the message, if any.
+func FromMessage(m *protocol.Message) SpanContext {
+	if m.HeaderJSON == "" || !strings.Contains(m.HeaderJSON, TraceparentHeader) {
+		return SpanContext{}
+	}
+	var header map[string]interface{}
+	if err := json.Unmarshal([]byte(m.HeaderJSON), &header); err != nil {
+		return SpanContext{}
+	}
+	traceparent, _ := header[TraceparentHeader].(string)
+	sc, _ := ParseTraceparent(traceparent)
+	return sc
+}
+
+// ToMessage propagates the span context in the header of the message, for the next steps of its delivery.
+func ToMessage(m *protocol.Message, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	if err := m.SetHeader(TraceparentHeader, sc.Traceparent()); err != nil {
+		logger.WithError(err).Debug("Can not propagate the trace in an invalid message header")
+	}
+}
+
+// Span is an operation of a trace, exported when it ends.
+// All its methods can be called on a nil Span (the span of an operation which is not traced).
+type Span struct {
+	tracer     *Tracer
+	name       string
+	context    SpanContext
+	parentID   [8]byte
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        string
+}
+
+// Context returns the span context, to be propagated to the child spans.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute adds an attribute to the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed, if the error is not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.err = err.Error()
+}
+
+// End ends the span, and queues it for the export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.tracer.export(s)
+}
+
+func newID(id []byte) {
+	rand.Read(id)
+}
@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultServiceName    = "guble"
+	defaultBatchSize      = 512
+	defaultExportInterval = 5 * time.Second
+	spanQueueSize         = 4096
+)
+
+var ErrNoEndpoint = errors.New("The endpoint of the tracing collector is missing")
+
+// Config is used for configuring the tracing of the messages.
+type Config struct {
+	Endpoint    *string
+	ServiceName *string
+	SampleRatio *float64
+}
+
+// Tracer creates the spans of the message path, and exports them in batches to an OTLP collector
+// (e.g. the OpenTelemetry collector, or Jaeger).
+type Tracer struct {
+	config   Config
+	exporter *exporter
+
+	spanC chan *Span
+	stopC chan struct{}
+	wg    sync.WaitGroup
+}
+
+var (
+	current      *Tracer
+	currentMutex sync.RWMutex
+)
+
+// New returns a new Tracer, which has to be started for exporting its spans.
+func New(config Config) *Tracer {
+	serviceName := defaultServiceName
+	if config.ServiceName != nil && *config.ServiceName != "" {
+		serviceName = *config.ServiceName
+	}
+	endpoint := ""
+	if config.Endpoint != nil {
+		endpoint = *config.Endpoint
+	}
+	return &Tracer{
+		config:   config,
+		exporter: newExporter(endpoint, serviceName),
+	}
+}
+
+// Name returns the name of the module.
+func (t *Tracer) Name() string {
+	return "tracing"
+}
+
+// Start begins exporting the spans, and makes the tracer the one used by StartSpan.
+func (t *Tracer) Start() error {
+	if t.exporter.endpoint == "" {
+		return ErrNoEndpoint
+	}
+	resetTracingMetrics()
+	t.spanC = make(chan *Span, spanQueueSize)
+	t.stopC = make(chan struct{})
+	t.wg.Add(1)
+	go t.loop()
+
+	currentMutex.Lock()
+	current = t
+	currentMutex.Unlock()
+	logger.WithField("endpoint", t.exporter.endpoint).Info("Tracing started")
+	return nil
+}
+
+// Stop stops tracing, and exports the remaining spans.
+func (t *Tracer) Stop() error {
+	currentMutex.Lock()
+	if current == t {
+		current = nil
+	}
+	currentMutex.Unlock()
+
+	if t.stopC == nil {
+		return nil
+	}
+	close(t.stopC)
+	t.wg.Wait()
+	t.stopC = nil
+	return nil
+}
+
+// StartSpan starts a span of the current tracer, as a child of the parent span context
+// (or as the root span of a new trace if the parent is not valid).
+// It returns nil if tracing is disabled, or if the trace is not sampled.
+func StartSpan(name string, parent SpanContext) *Span {
+	currentMutex.RLock()
+	t := current
+	currentMutex.RUnlock()
+	if t == nil {
+		return nil
+	}
+	return t.startSpan(name, parent)
+}
+
+func (t *Tracer) startSpan(name string, parent SpanContext) *Span {
+	s := &Span{tracer: t, name: name, start: time.Now()}
+	if parent.IsValid() {
+		if !parent.Sampled {
+			return nil
+		}
+		s.context.TraceID = parent.TraceID
+		s.parentID = parent.SpanID
+	} else {
+		if !t.sampled() {
+			return nil
+		}
+		newID(s.context.TraceID[:])
+	}
+	newID(s.context.SpanID[:])
+	s.context.Sampled = true
+	mTotalSpans.Add(1)
+	return s
+}
+
+func (t *Tracer) sampled() bool {
+	if t.config.SampleRatio == nil {
+		return true
+	}
+	return rand.Float64() < *t.config.SampleRatio
+}
+
+// export queues an ended span, dropping it if the collector does not keep up.
+func (t *Tracer) export(s *Span) {
+	select {
+	case t.spanC <- s:
+	default:
+		mTotalDroppedSpans.Add(1)
+	}
+}
+
+func (t *Tracer) loop() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(defaultExportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, defaultBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.export(batch); err != nil {
+			logger.WithError(err).WithField("spans", len(batch)).Warn("Could not export spans")
+			mTotalExportErrors.Add(1)
+			mTotalDroppedSpans.Add(int64(len(batch)))
+		} else {
+			mTotalExportedSpans.Add(int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-t.spanC:
+			batch = append(batch, s)
+			if len(batch) >= defaultBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stopC:
+			for {
+				select {
+				case s := <-t.spanC:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
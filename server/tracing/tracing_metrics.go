@@ -0,0 +1,20 @@
+package tracing
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                  = metrics.NS("tracing")
+	mTotalSpans         = ns.NewInt("total_spans")
+	mTotalExportedSpans = ns.NewInt("total_exported_spans")
+	mTotalDroppedSpans  = ns.NewInt("total_dropped_spans")
+	mTotalExportErrors  = ns.NewInt("total_export_errors")
+)
+
+func resetTracingMetrics() {
+	mTotalSpans.Set(0)
+	mTotalExportedSpans.Set(0)
+	mTotalDroppedSpans.Set(0)
+	mTotalExportErrors.Set(0)
+}
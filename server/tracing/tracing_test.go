@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	a := assert.New(t)
+
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	a.True(ok)
+	a.True(sc.Sampled)
+	a.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	for _, invalid := range []string{"", "00-xyz-00f067aa0ba902b7-01", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"} {
+		_, ok = ParseTraceparent(invalid)
+		a.False(ok, invalid)
+	}
+}
+
+func TestTraceIsPropagatedInMessageHeader(t *testing.T) {
+	a := assert.New(t)
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	m := &protocol.Message{HeaderJSON: `{"Key":"Value"}`}
+	ToMessage(m, sc)
+
+	a.Equal(sc, FromMessage(m))
+	a.Contains(m.HeaderJSON, `"Key":"Value"`)
+	a.Equal(SpanContext{}, FromMessage(&protocol.Message{}))
+}
+
+func TestSpansAreExported(t *testing.T) {
+	a := assert.New(t)
+
+	requestC := make(chan *otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request otlpRequest
+		a.NoError(json.Unmarshal(body, &request))
+		requestC <- &request
+	}))
+	defer collector.Close()
+
+	// no spans without a started tracer
+	a.Nil(StartSpan("nothing", SpanContext{}))
+
+	endpoint := collector.URL
+	tracer := New(Config{Endpoint: &endpoint})
+	a.NoError(tracer.Start())
+
+	parent := StartSpan("rest.publish", SpanContext{})
+	child := StartSpan("router.handle_message", parent.Context())
+	child.SetAttribute("topic", "/foo")
+	child.SetError(errors.New("store failed"))
+	child.End()
+	parent.End()
+	a.NoError(tracer.Stop())
+
+	request := <-requestC
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	a.Len(spans, 2)
+	a.Equal("router.handle_message", spans[0].Name)
+	a.Equal(spans[1].TraceID, spans[0].TraceID)
+	a.Equal(spans[1].SpanID, spans[0].ParentSpanID)
+	a.Equal("topic", spans[0].Attributes[0].Key)
+	a.Equal("store failed", spans[0].Status.Message)
+	a.Equal("guble", request.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+
+	a.Nil(StartSpan("stopped", SpanContext{}))
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// schema is the default database schema for webhooks
+	schema = "webhook_subscription"
+
+	// urlKey is the route param holding the URL to which the messages are POSTed
+	urlKey = "url"
+)
+
+// Config is used for configuring the webhook connector.
+type Config struct {
+	Enabled         *bool
+	Prefix          *string
+	Workers         *int
+	Secret          *string
+	Retries         *int
+	Timeout         *time.Duration
+	DeadLetterTopic *string
+}
+
+// webhook is a connector POSTing the messages of its subscriptions to arbitrary URLs.
+// A subscription is created by a POST request to `<prefix><topic>?url=<url>`; further query params
+// are optional filters, matched against the filters of the messages.
+// Failed requests are retried and dead-lettered by the base connector.
+type webhook struct {
+	Config
+	connector.Connector
+}
+
+// New creates a new webhook connector and returns it as a connector.ResponsiveConnector
+func New(router router.Router, sender connector.Sender, config Config) (connector.ResponsiveConnector, error) {
+	baseConn, err := connector.NewConnector(router, sender, connector.Config{
+		Name:       "webhook",
+		Schema:     schema,
+		Prefix:     *config.Prefix,
+		URLPattern: fmt.Sprintf("/{%s:.*}", connector.TopicParam),
+		Workers:    *config.Workers,
+		// the subscriptions are given the URL of their webhook as a query parameter
+		QueryParams: true,
+		Retry: &connector.RetryConfig{
+			MaxAttempts:     *config.Retries + 1,
+			DeadLetterTopic: *config.DeadLetterTopic,
+		},
+	})
+	if err != nil {
+		logger.WithError(err).Error("Base connector error")
+		return nil, err
+	}
+
+	w := &webhook{config, baseConn}
+	w.SetResponseHandler(w)
+	return w, nil
+}
+
+func (w *webhook) Start() error {
+	err := w.Connector.Start()
+	if err == nil {
+		mTotalSentMessages.Set(0)
+		mTotalSendErrors.Set(0)
+		mTotalResponseInternalErrors.Set(0)
+	}
+	return err
+}
+
+func (w *webhook) HandleResponse(request connector.Request, response interface{}, metadata *connector.Metadata, err error) error {
+	message := request.Message()
+	subscriber := request.Subscriber()
+
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"error":     err.Error(),
+			"messageID": message.ID,
+		}).Error("Error sending message to webhook")
+		mTotalSendErrors.Add(1)
+	} else {
+		logger.WithField("messageID", message.ID).Debug("Delivered message to webhook")
+		mTotalSentMessages.Add(1)
+	}
+
+	// failed messages are not delivered again to the subscription (they are in the dead-letter topic)
+	subscriber.SetLastID(message.ID)
+	if updateErr := w.Manager().Update(subscriber); updateErr != nil {
+		logger.WithField("error", updateErr.Error()).Error("Manager could not update subscription")
+		mTotalResponseInternalErrors.Add(1)
+		return updateErr
+	}
+	return err
+}
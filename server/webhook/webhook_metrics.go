@@ -0,0 +1,12 @@
+package webhook
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                           = metrics.NS("webhook")
+	mTotalSentMessages           = ns.NewInt("total_sent_messages")
+	mTotalSendErrors             = ns.NewInt("total_sent_message_errors")
+	mTotalResponseInternalErrors = ns.NewInt("total_response_internal_errors")
+)
@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+)
+
+const (
+	// SignatureHeader is the header of the signed requests: "t=<unix timestamp>,v1=<hex HMAC-SHA256>",
+	// where the HMAC of the lines "<unix timestamp>", "<message ID>", "<topic>" and "<body>" is keyed with the secret.
+	SignatureHeader = "X-Guble-Signature"
+	MessageIDHeader = "X-Guble-Message-Id"
+	TopicHeader     = "X-Guble-Topic"
+
+	// The headers of the encryption metadata of the end-to-end encrypted bodies
+	EncryptionKeyIDHeader     = "X-Guble-Encryption-Key-Id"
+	EncryptionAlgorithmHeader = "X-Guble-Encryption-Algorithm"
+	EncryptionNonceHeader     = "X-Guble-Encryption-Nonce"
+)
+
+// ResponseError is returned when the webhook answered with a non-2xx status code.
+type ResponseError struct {
+	StatusCode int
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("webhook responded with status code %d", e.StatusCode)
+}
+
+// Temporary returns true if the request can be retried (server errors, or "too many requests"),
+// as checked by connector.Temporary.
+func (e *ResponseError) Temporary() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+type sender struct {
+	client *http.Client
+	secret []byte
+	now    func() time.Time
+}
+
+// NewSender returns a connector.Sender POSTing the messages to the URL of the subscription.
+func NewSender(secret string, timeout time.Duration) *sender {
+	return &sender{
+		client: &http.Client{Timeout: timeout},
+		secret: []byte(secret),
+		now:    time.Now,
+	}
+}
+
+// Send returns the status code of the response (as int), or the error.
+func (s *sender) Send(request connector.Request) (interface{}, error) {
+	url := request.Subscriber().Route().Get(urlKey)
+	statusCode, err := s.post(url, request.Message())
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"error": err.Error(),
+			"url":   url,
+		}).Info("Could not send message to webhook")
+		return nil, err
+	}
+	return statusCode, nil
+}
+
+func (s *sender) post(url string, message *protocol.Message) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(message.Body))
+	if err != nil {
+		return 0, err
+	}
+	if e := message.Encryption(); e != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set(EncryptionKeyIDHeader, e.KeyID)
+		req.Header.Set(EncryptionAlgorithmHeader, e.Algorithm)
+		if e.Nonce != "" {
+			req.Header.Set(EncryptionNonceHeader, e.Nonce)
+		}
+	} else if json.Valid(message.Body) {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	messageID := strconv.FormatUint(message.ID, 10)
+	req.Header.Set(MessageIDHeader, messageID)
+	req.Header.Set(TopicHeader, string(message.Path))
+	if len(s.secret) > 0 {
+		req.Header.Set(SignatureHeader, Signature(s.secret, s.now(), messageID, string(message.Path), message.Body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, &ResponseError{resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
+
+// Signature returns the value of the signature header of a message sent at the time,
+// so that the receiver can reject the replayed or re-targeted requests.
+func Signature(secret []byte, t time.Time, messageID string, topic string, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + messageID + "\n" + topic + "\n"))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
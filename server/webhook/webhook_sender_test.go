@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/router"
+)
+
+func newTestRequest(url string, m *protocol.Message) connector.Request {
+	s := connector.NewSubscriber(m.Path, router.RouteParams{urlKey: url}, 0)
+	return connector.NewRequest(s, m)
+}
+
+func TestSender_SendSignedMessage(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		a.Equal(`{"foo":"bar"}`, string(body))
+		a.Equal("application/json", req.Header.Get("Content-Type"))
+		a.Equal("42", req.Header.Get(MessageIDHeader))
+		a.Equal("/topic", req.Header.Get(TopicHeader))
+		a.Equal(Signature([]byte("secret"), time.Unix(1420110000, 0), "42", "/topic", body), req.Header.Get(SignatureHeader))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	s := NewSender("secret", time.Second)
+	s.now = func() time.Time { return time.Unix(1420110000, 0) }
+	response, err := s.Send(newTestRequest(server.URL, &protocol.Message{
+		ID:   42,
+		Path: "/topic",
+		Body: []byte(`{"foo":"bar"}`),
+	}))
+	a.NoError(err)
+	a.Equal(http.StatusAccepted, response)
+}
+
+func TestSender_SendEncryptedMessage(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		a.Equal(`{"iv":"x"}`, string(body))
+		a.Equal("application/octet-stream", req.Header.Get("Content-Type"))
+		a.Equal("team-a-2024", req.Header.Get(EncryptionKeyIDHeader))
+		a.Equal("A256GCM", req.Header.Get(EncryptionAlgorithmHeader))
+		a.Equal("3q2+7w3q2+7w3q2+", req.Header.Get(EncryptionNonceHeader))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	m := &protocol.Message{ID: 42, Path: "/topic", Body: []byte(`{"iv":"x"}`)}
+	a.NoError(m.SetEncryption(protocol.Encryption{KeyID: "team-a-2024", Algorithm: "A256GCM", Nonce: "3q2+7w3q2+7w3q2+"}))
+	_, err := NewSender("", time.Second).Send(newTestRequest(server.URL, m))
+	a.NoError(err)
+}
+
+func TestSender_ReturnsResponseError(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	s := NewSender("", time.Second)
+	_, err := s.Send(newTestRequest(server.URL, &protocol.Message{ID: 1, Path: "/topic", Body: []byte("text")}))
+	a.Equal(&ResponseError{http.StatusBadRequest}, err)
+	a.False(connector.Temporary(err))
+	a.True(connector.Temporary(&ResponseError{http.StatusServiceUnavailable}))
+	a.True(connector.Temporary(&ResponseError{http.StatusTooManyRequests}))
+}
+
+func TestSignature(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("t=1420110000,v1=aa75110aba382a9eaa1f5bf59413c8f2a10c91750d3082269d9802ffe302a66d",
+		Signature([]byte("key"), time.Unix(1420110000, 0), "42", "/topic", []byte("The quick brown fox jumps over the lazy dog")))
+
+	// the message ID and the topic are signed as well
+	a.NotEqual(Signature([]byte("key"), time.Unix(1420110000, 0), "42", "/topic", []byte("body")),
+		Signature([]byte("key"), time.Unix(1420110000, 0), "42", "/other", []byte("body")))
+}
@@ -0,0 +1,176 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+func testWebhook(t *testing.T, sender connector.Sender, retries int) (*webhook, *MockRouter) {
+	prefix := "/webhook/"
+	workers := 1
+	secret := ""
+	timeout := time.Second
+	deadLetterTopic := "/dead_letters"
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().KVStore().Return(kvstore.NewMemoryKVStore(), nil).AnyTimes()
+
+	conn, err := New(routerMock, sender, Config{
+		Prefix:          &prefix,
+		Workers:         &workers,
+		Secret:          &secret,
+		Retries:         &retries,
+		Timeout:         &timeout,
+		DeadLetterTopic: &deadLetterTopic,
+	})
+	assert.NoError(t, err)
+	return conn.(*webhook), routerMock
+}
+
+func TestWebhook_PostSubscription(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	w, routerMock := testWebhook(t, NewSender("", time.Second), 0)
+	a.NoError(w.Start())
+	defer w.Stop()
+
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/foo/bar"), r.Path)
+		a.Equal("http://example.com/hook", r.Get(urlKey))
+		a.Equal("user01", r.Get("user_id"))
+	}).Return(nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/webhook/foo/bar?url=http://example.com/hook&user_id=user01", strings.NewReader(""))
+	a.NoError(err)
+	w.ServeHTTP(recorder, req)
+	a.Equal(`{"subscribed":"/foo/bar"}`, recorder.Body.String())
+	a.Len(w.Manager().List(), 1)
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestWebhook_RetriesTemporaryErrors(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	calls := 0
+	succeeded := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		close(succeeded)
+	}))
+	defer server.Close()
+
+	w, _ := testWebhook(t, NewSender("", time.Second), 2)
+	a.NoError(w.Start())
+	defer w.Stop()
+
+	subscriber, err := w.Manager().Create("/foo", router.RouteParams{urlKey: server.URL})
+	a.NoError(err)
+	message := &protocol.Message{ID: 1, Path: "/foo", Body: []byte("payload")}
+
+	// the failed request is sent again by the queue of the connector
+	_, err = w.Sender().Send(connector.NewRequest(subscriber, message))
+	a.Equal(connector.ErrRetryScheduled, err)
+	select {
+	case <-succeeded:
+		a.Equal(3, calls)
+	case <-time.After(2 * time.Second):
+		a.Fail("the request is not retried")
+	}
+}
+
+func TestWebhook_SendsToDeadLetterTopic(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	w, routerMock := testWebhook(t, NewSender("", time.Second), 5)
+
+	subscriber, err := w.Manager().Create("/foo", router.RouteParams{urlKey: server.URL})
+	a.NoError(err)
+	message := &protocol.Message{ID: 7, Path: "/foo", Body: []byte("payload")}
+
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/dead_letters"), m.Path)
+		a.Equal("webhook", m.UserID)
+		a.Equal([]byte("payload"), m.Body)
+		a.JSONEq(`{"connector":"webhook","topic":"/foo","message_id":7,"params":{"url":"`+server.URL+`"},`+
+			`"error":"webhook responded with status code 400","attempts":1}`, m.HeaderJSON)
+	}).Return(nil)
+
+	// client errors are not retried
+	_, err = w.Sender().Send(connector.NewRequest(subscriber, message))
+	a.Equal(&ResponseError{http.StatusBadRequest}, err)
+	a.Equal(1, calls)
+
+	// messages of the dead-letter topic are never dead-lettered again
+	message = &protocol.Message{ID: 8, Path: "/dead_letters", Body: []byte("payload")}
+	_, err = w.Sender().Send(connector.NewRequest(subscriber, message))
+	a.Equal(&ResponseError{http.StatusBadRequest}, err)
+}
+
+func TestWebhook_HandleResponseError(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	w, _ := testWebhook(t, NewSender("", time.Second), 0)
+
+	subscriber, err := w.Manager().Create("/foo", router.RouteParams{urlKey: "http://example.com/hook"})
+	a.NoError(err)
+	message := &protocol.Message{ID: 7, Path: "/foo", Body: []byte("payload")}
+
+	sendErr := errors.New("connection refused")
+	a.Equal(sendErr, w.HandleResponse(connector.NewRequest(subscriber, message), nil, nil, sendErr))
+
+	// the message is not delivered again to the subscription
+	data, err := subscriber.Encode()
+	a.NoError(err)
+	a.Contains(string(data), `"LastID":7`)
+}
+
+func TestWebhook_HandleResponseSuccess(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	w, _ := testWebhook(t, NewSender("", time.Second), 0)
+
+	subscriber, err := w.Manager().Create("/foo", router.RouteParams{urlKey: "http://example.com/hook"})
+	a.NoError(err)
+	message := &protocol.Message{ID: 3, Path: "/foo", Body: []byte("payload")}
+
+	a.NoError(w.HandleResponse(connector.NewRequest(subscriber, message), http.StatusOK, nil, nil))
+	data, err := subscriber.Encode()
+	a.NoError(err)
+	a.Contains(string(data), `"LastID":3`)
+}
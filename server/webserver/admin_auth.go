@@ -0,0 +1,119 @@
+package webserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// AdminKeyHeader is the header of the requests carrying the admin API key
+const AdminKeyHeader = "X-Admin-Key"
+
+// AdminAuthConfig is used for configuring the credentials of the admin and management endpoints,
+// distinct from the authentication of the clients.
+type AdminAuthConfig struct {
+	Username *string
+	Password *string
+	APIKey   *string
+}
+
+// AdminAuth rejects the requests to the admin endpoints which have neither the basic auth credentials
+// nor the admin API key.
+type AdminAuth struct {
+	prefixes []string
+	public   map[string]bool
+	username []byte
+	password []byte
+	apiKey   []byte
+}
+
+// NewAdminAuth returns the AdminAuth of the admin endpoints having the path prefixes,
+// or nil if no credential is configured.
+func NewAdminAuth(config AdminAuthConfig, prefixes ...string) *AdminAuth {
+	a := &AdminAuth{}
+	if config.Username != nil && config.Password != nil && *config.Password != "" {
+		a.username = []byte(*config.Username)
+		a.password = []byte(*config.Password)
+	}
+	if config.APIKey != nil {
+		a.apiKey = []byte(*config.APIKey)
+	}
+	if len(a.password) == 0 && len(a.apiKey) == 0 {
+		return nil
+	}
+	for _, prefix := range prefixes {
+		if prefix != "" {
+			a.prefixes = append(a.prefixes, prefix)
+		}
+	}
+	return a
+}
+
+// WithPublicEndpoints does not require the admin credentials on the given paths under the prefixes,
+// e.g. on the health endpoint polled by the load balancers. It can be called on a nil AdminAuth.
+func (a *AdminAuth) WithPublicEndpoints(paths ...string) *AdminAuth {
+	if a == nil {
+		return nil
+	}
+	if a.public == nil {
+		a.public = make(map[string]bool)
+	}
+	for _, path := range paths {
+		if path != "" {
+			a.public[path] = true
+		}
+	}
+	return a
+}
+
+// Applies returns true if the path is one of the admin endpoints.
+func (a *AdminAuth) Applies(path string) bool {
+	if a.public[path] {
+		return false
+	}
+	for _, prefix := range a.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorized returns true if the request has the basic auth credentials or the admin API key.
+func (a *AdminAuth) Authorized(r *http.Request) bool {
+	if len(a.apiKey) > 0 {
+		if key := r.Header.Get(AdminKeyHeader); key != "" && subtle.ConstantTimeCompare([]byte(key), a.apiKey) == 1 {
+			return true
+		}
+	}
+	if len(a.password) > 0 {
+		if username, password, ok := r.BasicAuth(); ok {
+			// both are compared, so that the time does not reveal which one is wrong
+			usernameOK := subtle.ConstantTimeCompare([]byte(username), a.username)
+			passwordOK := subtle.ConstantTimeCompare([]byte(password), a.password)
+			return usernameOK&passwordOK == 1
+		}
+	}
+	return false
+}
+
+// Handler rejects the requests to the admin endpoints without the admin credentials with the status 401.
+func (a *AdminAuth) Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.Applies(r.URL.Path) && !a.Authorized(r) {
+			logger.WithFields(log.Fields{
+				"remoteAddr": r.RemoteAddr,
+				"path":       r.URL.Path,
+			}).Warn("Unauthorized request to an admin endpoint")
+			mTotalAdminUnauthorized.Add(1)
+			if len(a.password) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="guble admin"`)
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
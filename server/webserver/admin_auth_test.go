@@ -0,0 +1,67 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAdminAuth_Disabled(t *testing.T) {
+	a := assert.New(t)
+
+	a.Nil(NewAdminAuth(AdminAuthConfig{}, "/admin/"))
+
+	username, password, key := "admin", "", ""
+	a.Nil(NewAdminAuth(AdminAuthConfig{Username: &username, Password: &password, APIKey: &key}, "/admin/"))
+}
+
+func TestAdminAuth_Handler(t *testing.T) {
+	a := assert.New(t)
+
+	username, password, key := "admin", "secret", "admin-key"
+	auth := NewAdminAuth(AdminAuthConfig{Username: &username, Password: &password, APIKey: &key}, "/admin/", "/fcm/", "")
+	handler := auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(path string, header func(r *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		header(req)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	none := func(r *http.Request) {}
+
+	w := get("/admin/metrics", none)
+	a.Equal(http.StatusUnauthorized, w.Code)
+	a.Equal(`Basic realm="guble admin"`, w.Header().Get("WWW-Authenticate"))
+	a.Equal(http.StatusUnauthorized, get("/fcm/user/token/topic", none).Code)
+
+	a.Equal(http.StatusOK, get("/admin/metrics", func(r *http.Request) { r.SetBasicAuth("admin", "secret") }).Code)
+	a.Equal(http.StatusUnauthorized, get("/admin/metrics", func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }).Code)
+	a.Equal(http.StatusUnauthorized, get("/admin/metrics", func(r *http.Request) { r.SetBasicAuth("other", "secret") }).Code)
+
+	a.Equal(http.StatusOK, get("/admin/metrics", func(r *http.Request) { r.Header.Set(AdminKeyHeader, "admin-key") }).Code)
+	a.Equal(http.StatusUnauthorized, get("/admin/metrics", func(r *http.Request) { r.Header.Set(AdminKeyHeader, "wrong") }).Code)
+
+	// the client credentials are not admin credentials
+	a.Equal(http.StatusUnauthorized, get("/admin/metrics", func(r *http.Request) { r.Header.Set(APIKeyHeader, "admin-key") }).Code)
+
+	// the other endpoints are not gated
+	a.Equal(http.StatusOK, get("/api/message/foo", none).Code)
+	a.Equal(http.StatusOK, get("/", none).Code)
+}
+
+func TestAdminAuth_PublicEndpoints(t *testing.T) {
+	a := assert.New(t)
+
+	key := "admin-key"
+	auth := NewAdminAuth(AdminAuthConfig{APIKey: &key}, "/admin/").WithPublicEndpoints("/admin/healthcheck", "")
+	a.False(auth.Applies("/admin/healthcheck"))
+	a.True(auth.Applies("/admin/healthcheck/other"))
+	a.True(auth.Applies("/admin/metrics"))
+
+	var disabled *AdminAuth
+	a.Nil(disabled.WithPublicEndpoints("/admin/healthcheck"))
+}
@@ -0,0 +1,140 @@
+package webserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// IPFilterConfig is used for configuring the networks allowed and denied on a group of endpoints.
+type IPFilterConfig struct {
+	// Allow are the CIDRs (or single IPs) of the allowed clients; all the clients are allowed if it is empty
+	Allow *[]string
+	// Deny are the CIDRs (or single IPs) of the denied clients, even if they are allowed
+	Deny *[]string
+}
+
+// IPFilter allows or denies the requests by the IP address of their clients.
+type IPFilter struct {
+	name     string
+	prefixes []string
+	allow    []*net.IPNet
+	deny     []*net.IPNet
+}
+
+// NewIPFilter returns the IPFilter of the group of endpoints having the path prefixes,
+// or nil if no network is configured.
+func NewIPFilter(name string, config IPFilterConfig, prefixes ...string) (*IPFilter, error) {
+	f := &IPFilter{name: name}
+	for _, prefix := range prefixes {
+		if prefix != "" {
+			f.prefixes = append(f.prefixes, prefix)
+		}
+	}
+	var err error
+	if config.Allow != nil {
+		if f.allow, err = parseNetworks(*config.Allow); err != nil {
+			return nil, err
+		}
+	}
+	if config.Deny != nil {
+		if f.deny, err = parseNetworks(*config.Deny); err != nil {
+			return nil, err
+		}
+	}
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// parseNetworks parses the CIDRs, a single IP being a network of one address.
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid IP address %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CIDR %q: %v", value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Applies returns true if the path is one of the endpoints of the IPFilter.
+func (f *IPFilter) Applies(path string) bool {
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns true if the IP is not denied, and is allowed (if the allowed networks are configured).
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if contains(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || contains(f.allow, ip)
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP address of the client of the request.
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// filterIPs rejects with the status 403 the requests to the endpoints of any of the IPFilters
+// whose clients are not allowed by it.
+func filterIPs(filters []*IPFilter, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, f := range filters {
+			if f.Applies(r.URL.Path) && !f.Allowed(remoteIP(r)) {
+				logger.WithFields(log.Fields{
+					"filter":     f.name,
+					"remoteAddr": r.RemoteAddr,
+					"path":       r.URL.Path,
+				}).Info("Request denied by the IP filter")
+				mTotalIPDenied.Add(f.name, 1)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
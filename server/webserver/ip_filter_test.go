@@ -0,0 +1,70 @@
+package webserver
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIPFilter(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := NewIPFilter("admin", IPFilterConfig{}, "/admin/")
+	a.NoError(err)
+	a.Nil(f)
+
+	_, err = NewIPFilter("admin", IPFilterConfig{Allow: &[]string{"10.0.0.0/33"}}, "/admin/")
+	a.Error(err)
+	_, err = NewIPFilter("admin", IPFilterConfig{Deny: &[]string{"not-an-ip"}}, "/admin/")
+	a.Error(err)
+}
+
+func TestIPFilter_Allowed(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := NewIPFilter("admin", IPFilterConfig{
+		Allow: &[]string{"10.0.0.0/8", "192.168.1.5", "fd00::/8"},
+		Deny:  &[]string{"10.1.0.0/16"},
+	}, "/admin/")
+	a.NoError(err)
+
+	a.True(f.Allowed(net.ParseIP("10.0.0.1")))
+	a.True(f.Allowed(net.ParseIP("192.168.1.5")))
+	a.True(f.Allowed(net.ParseIP("fd00::1")))
+	a.False(f.Allowed(net.ParseIP("10.1.2.3")))
+	a.False(f.Allowed(net.ParseIP("192.168.1.6")))
+	a.False(f.Allowed(nil))
+
+	// only denied networks: all the others are allowed
+	f, err = NewIPFilter("rest", IPFilterConfig{Deny: &[]string{"203.0.113.0/24"}}, "/api/")
+	a.NoError(err)
+	a.True(f.Allowed(net.ParseIP("10.0.0.1")))
+	a.False(f.Allowed(net.ParseIP("203.0.113.7")))
+}
+
+func TestFilterIPs(t *testing.T) {
+	a := assert.New(t)
+
+	admin, _ := NewIPFilter("admin", IPFilterConfig{Allow: &[]string{"10.0.0.0/8"}}, "/admin/", "")
+	rest, _ := NewIPFilter("rest", IPFilterConfig{Deny: &[]string{"10.0.0.0/8"}}, "/api/")
+	handler := filterIPs([]*IPFilter{admin, rest}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(remoteAddr, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	a.Equal(http.StatusOK, get("10.0.0.1:1234", "/admin/metrics"))
+	a.Equal(http.StatusForbidden, get("203.0.113.7:1234", "/admin/metrics"))
+	a.Equal(http.StatusForbidden, get("10.0.0.1:1234", "/api/message/foo"))
+	a.Equal(http.StatusOK, get("203.0.113.7:1234", "/api/message/foo"))
+
+	// the endpoints of no filter are not filtered
+	a.Equal(http.StatusOK, get("203.0.113.7:1234", "/stream/"))
+}
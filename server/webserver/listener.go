@@ -0,0 +1,160 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// unixPrefix is the prefix of the addresses of the listeners on unix domain sockets, e.g. "unix:/run/guble/admin.sock"
+const unixPrefix = "unix:"
+
+// Listener is an additional address of the WebServer, serving its endpoints (or only those with some path prefixes),
+// with its own TLS and admin authentication settings.
+type Listener struct {
+	// Network is "tcp" or "unix"
+	Network string
+	// Address is the "[Host]:Port" of a TCP listener, or the path of a unix domain socket
+	Address string
+	// Prefixes are the path prefixes of the endpoints served by the listener; all the endpoints are served if it is empty
+	Prefixes []string
+	// AdminAuth requires the admin credentials on the admin endpoints, if they are configured
+	AdminAuth bool
+	// TLS serves HTTPS with the TLS configuration of the WebServer (TCP listeners only)
+	TLS bool
+	// Mode are the permissions of the unix domain socket, if not zero
+	Mode os.FileMode
+
+	ln net.Listener
+}
+
+// ParseListener parses the definition of a listener: its address ("[Host]:Port" or "unix:/path/to/socket"),
+// optionally followed by the query parameters prefixes (comma-separated), admin-auth (true or false, default: true),
+// tls (true or false, default: false) and mode (octal permissions of the socket),
+// e.g. "unix:/run/guble/admin.sock?prefixes=/admin/&admin-auth=false&mode=0660".
+func ParseListener(definition string) (*Listener, error) {
+	address, rawQuery := definition, ""
+	if i := strings.Index(definition, "?"); i >= 0 {
+		address, rawQuery = definition[:i], definition[i+1:]
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid listener %q: %v", definition, err)
+	}
+	l := &Listener{Network: "tcp", Address: address, AdminAuth: true}
+	if strings.HasPrefix(address, unixPrefix) {
+		l.Network, l.Address = "unix", strings.TrimPrefix(address, unixPrefix)
+	}
+	if l.Address == "" {
+		return nil, fmt.Errorf("Invalid listener %q: no address", definition)
+	}
+	for key, values := range query {
+		value := values[len(values)-1]
+		switch key {
+		case "prefixes":
+			for _, prefix := range strings.Split(value, ",") {
+				if prefix = strings.TrimSpace(prefix); prefix != "" {
+					l.Prefixes = append(l.Prefixes, prefix)
+				}
+			}
+		case "admin-auth":
+			l.AdminAuth, err = strconv.ParseBool(value)
+		case "tls":
+			l.TLS, err = strconv.ParseBool(value)
+		case "mode":
+			var mode uint64
+			mode, err = strconv.ParseUint(value, 8, 32)
+			l.Mode = os.FileMode(mode)
+		default:
+			err = fmt.Errorf("unknown parameter %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid listener %q: %v", definition, err)
+		}
+	}
+	if l.TLS && l.Network == "unix" {
+		return nil, fmt.Errorf("Invalid listener %q: TLS is only supported on TCP listeners", definition)
+	}
+	return l, nil
+}
+
+// String returns the address of the listener.
+func (l *Listener) String() string {
+	if l.Network == "unix" {
+		return unixPrefix + l.Address
+	}
+	return l.Address
+}
+
+// Serves returns true if the listener serves the endpoint of the path.
+func (l *Listener) Serves(path string) bool {
+	if len(l.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range l.Prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// listen opens the socket of the listener, replacing a stale unix domain socket.
+func (l *Listener) listen(tlsConfig *tls.Config) (net.Listener, error) {
+	if l.Network == "unix" {
+		if _, err := os.Stat(l.Address); err == nil {
+			if err := os.Remove(l.Address); err != nil {
+				return nil, err
+			}
+		}
+		ln, err := net.Listen("unix", l.Address)
+		if err != nil {
+			return nil, err
+		}
+		if l.Mode != 0 {
+			if err := os.Chmod(l.Address, l.Mode); err != nil {
+				ln.Close()
+				return nil, err
+			}
+		}
+		return ln, nil
+	}
+	ln, err := net.Listen("tcp", l.Address)
+	if err != nil {
+		return nil, err
+	}
+	ln = tcpKeepAliveListener{TCPListener: ln.(*net.TCPListener)}
+	if l.TLS {
+		if tlsConfig == nil {
+			ln.Close()
+			return nil, fmt.Errorf("the listener %s requires a TLS configuration", l)
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+// servePrefixes returns the handler serving only the endpoints of the listener.
+func (l *Listener) servePrefixes(handler http.Handler) http.Handler {
+	if len(l.Prefixes) == 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.Serves(r.URL.Path) {
+			logger.WithFields(log.Fields{
+				"listener": l.String(),
+				"path":     r.URL.Path,
+			}).Debug("Endpoint not served by the listener")
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
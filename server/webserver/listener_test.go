@@ -0,0 +1,98 @@
+package webserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListener(t *testing.T) {
+	a := assert.New(t)
+
+	l, err := ParseListener(":8081")
+	a.NoError(err)
+	a.Equal(&Listener{Network: "tcp", Address: ":8081", AdminAuth: true}, l)
+
+	l, err = ParseListener("unix:/run/guble/admin.sock?prefixes=/admin/,/api/&admin-auth=false&mode=0660")
+	a.NoError(err)
+	a.Equal(&Listener{Network: "unix", Address: "/run/guble/admin.sock", Prefixes: []string{"/admin/", "/api/"}, Mode: 0660}, l)
+	a.Equal("unix:/run/guble/admin.sock", l.String())
+	a.True(l.Serves("/admin/metrics"))
+	a.False(l.Serves("/stream/"))
+
+	l, err = ParseListener("0.0.0.0:8443?tls=true")
+	a.NoError(err)
+	a.True(l.TLS)
+	a.True(l.Serves("/stream/"))
+
+	for _, invalid := range []string{
+		"",
+		"unix:",
+		":8081?admin-auth=maybe",
+		":8081?mode=rw",
+		":8081?port=1",
+		"unix:/tmp/guble.sock?tls=true",
+	} {
+		_, err := ParseListener(invalid)
+		a.Error(err, invalid)
+	}
+}
+
+func TestWebServer_Listeners(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guble_listener_test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "admin.sock")
+
+	// given a webserver requiring the admin credentials, also listening on a unix socket serving only the admin endpoints
+	// without them
+	password := "secret"
+	unix, err := ParseListener("unix:" + socket + "?prefixes=/admin/&admin-auth=false&mode=0600")
+	a.NoError(err)
+	server := New("localhost:0").
+		WithAdminAuth(NewAdminAuth(AdminAuthConfig{Password: &password, Username: &password}, "/admin/")).
+		WithListener(unix)
+	for _, prefix := range []string{"/admin/", "/api/"} {
+		server.Handle(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+	a.NoError(server.Start())
+	defer server.Stop()
+
+	info, err := os.Stat(socket)
+	a.NoError(err)
+	a.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	get := func(client *http.Client, url string) int {
+		resp, err := client.Get(url)
+		a.NoError(err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	tcpClient := &http.Client{}
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	// then the main address requires the admin credentials
+	a.Equal(http.StatusUnauthorized, get(tcpClient, "http://"+server.GetAddr()+"/admin/metrics"))
+	a.Equal(http.StatusOK, get(tcpClient, "http://"+server.GetAddr()+"/api/message"))
+
+	// and the unix socket serves only the admin endpoints, without the credentials
+	a.Equal(http.StatusOK, get(unixClient, "http://unix/admin/metrics"))
+	a.Equal(http.StatusNotFound, get(unixClient, "http://unix/api/message"))
+
+	// and the socket is removed when the webserver stops
+	a.NoError(server.Stop())
+	_, err = os.Stat(socket)
+	a.True(os.IsNotExist(err))
+}
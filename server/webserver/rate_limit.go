@@ -0,0 +1,296 @@
+package webserver
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/auth"
+)
+
+const (
+	// APIKeyHeader is the header of the requests carrying the API key of the client
+	APIKeyHeader = "X-API-Key"
+
+	// rateLimitSyncInterval is the interval of sharing the usage of the rate limits with the other nodes
+	rateLimitSyncInterval = time.Second
+
+	limitRequests = "requests"
+	limitMessages = "messages"
+)
+
+// RateLimitConfig is used for configuring the rate limits of each identity (API key, user or IP).
+type RateLimitConfig struct {
+	Enabled *bool
+	// Requests is the steady rate of the HTTP requests per second (no limit if <= 0)
+	Requests *float64
+	// RequestsBurst is the number of requests accepted at once above the steady rate
+	RequestsBurst *int
+	// Messages is the steady rate of the published messages per second (no limit if <= 0)
+	Messages *float64
+	// MessagesBurst is the number of messages accepted at once above the steady rate
+	MessagesBurst *int
+}
+
+// RateUsageBroadcaster shares the usage of the rate limits with the other nodes, implemented by a cluster.Cluster.
+type RateUsageBroadcaster interface {
+	BroadcastRateUsage(usage map[string]float64) error
+}
+
+type rateLimit struct {
+	perSecond float64
+	burst     float64
+}
+
+// bucket is the token bucket of an identity for a limit.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateLimitIdentityKey struct{}
+
+// RateLimitIdentity returns the identity of the request used by the rate limits, assigned by the RateLimiter.
+func RateLimitIdentity(r *http.Request) string {
+	identity, _ := r.Context().Value(rateLimitIdentityKey{}).(string)
+	return identity
+}
+
+// RateLimiter limits the rates of the HTTP requests and of the published messages of each identity,
+// by token buckets with a steady rate and a burst.
+// The identity of a request is its API key, or its verified user (by its client certificate or its bearer token),
+// or else its IP address.
+// In a cluster, the usage of the limits on each node is shared periodically with the other nodes,
+// so the limits are enforced (approximately) for the whole cluster.
+type RateLimiter struct {
+	limits         map[string]rateLimit
+	tokenValidator auth.TokenValidator
+	broadcaster    RateUsageBroadcaster
+
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	usage   map[string]float64
+	now     func() time.Time
+
+	stopC chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewRateLimiter returns a new RateLimiter, which has to be started for sharing its usage and forgetting the idle identities.
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	l := &RateLimiter{
+		limits:  make(map[string]rateLimit),
+		buckets: make(map[string]*bucket),
+		usage:   make(map[string]float64),
+		now:     time.Now,
+	}
+	l.setLimit(limitRequests, config.Requests, config.RequestsBurst)
+	l.setLimit(limitMessages, config.Messages, config.MessagesBurst)
+	return l
+}
+
+func (l *RateLimiter) setLimit(kind string, perSecond *float64, burst *int) {
+	if perSecond == nil || *perSecond <= 0 {
+		return
+	}
+	limit := rateLimit{perSecond: *perSecond, burst: math.Max(1, math.Ceil(*perSecond))}
+	if burst != nil && *burst > 0 {
+		limit.burst = float64(*burst)
+	}
+	l.limits[kind] = limit
+}
+
+// WithTokenValidator identifies the requests by the subject of their valid bearer tokens (if any).
+func (l *RateLimiter) WithTokenValidator(v auth.TokenValidator) *RateLimiter {
+	l.tokenValidator = v
+	return l
+}
+
+// WithBroadcaster shares the usage of the limits with the other nodes by the broadcaster;
+// the RateLimiter has also to receive their usage as a cluster.RateUsageHandler.
+func (l *RateLimiter) WithBroadcaster(b RateUsageBroadcaster) *RateLimiter {
+	l.broadcaster = b
+	return l
+}
+
+// Start begins sharing the usage of the limits periodically.
+func (l *RateLimiter) Start() error {
+	l.stopC = make(chan struct{})
+	l.wg.Add(1)
+	go l.loop()
+	return nil
+}
+
+// Stop ends sharing the usage of the limits.
+func (l *RateLimiter) Stop() error {
+	if l.stopC == nil {
+		return nil
+	}
+	close(l.stopC)
+	l.wg.Wait()
+	l.stopC = nil
+	return nil
+}
+
+func (l *RateLimiter) loop() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(rateLimitSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.sync()
+		case <-l.stopC:
+			return
+		}
+	}
+}
+
+// sync sends the usage since the previous sync to the other nodes, and forgets the full buckets.
+func (l *RateLimiter) sync() {
+	l.mutex.Lock()
+	usage := l.usage
+	l.usage = make(map[string]float64)
+	now := l.now()
+	for key, b := range l.buckets {
+		if l.refill(key, b, now) {
+			delete(l.buckets, key)
+		}
+	}
+	l.mutex.Unlock()
+
+	if l.broadcaster == nil || len(usage) == 0 {
+		return
+	}
+	if err := l.broadcaster.BroadcastRateUsage(usage); err != nil {
+		logger.WithError(err).Error("Could not share the usage of the rate limits")
+	}
+}
+
+// refill adds the tokens of the steady rate since the last update of the bucket, and returns true if it is full.
+// It has to be called with the mutex locked.
+func (l *RateLimiter) refill(key string, b *bucket, now time.Time) bool {
+	limit := l.limits[kindOf(key)]
+	b.tokens = math.Min(limit.burst, b.tokens+now.Sub(b.updated).Seconds()*limit.perSecond)
+	b.updated = now
+	return b.tokens >= limit.burst
+}
+
+func bucketKey(kind, identity string) string {
+	return kind + "|" + identity
+}
+
+func kindOf(key string) string {
+	return strings.SplitN(key, "|", 2)[0]
+}
+
+// allow takes a token from the bucket of the identity for the limit, or returns the delay until one is available.
+func (l *RateLimiter) allow(kind, identity string) (bool, time.Duration) {
+	limit, ok := l.limits[kind]
+	if !ok {
+		return true, 0
+	}
+	key := bucketKey(kind, identity)
+	now := l.now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.burst, updated: now}
+		l.buckets[key] = b
+	}
+	l.refill(key, b, now)
+	if b.tokens < 1 {
+		mTotalRateLimited.Add(kind, 1)
+		return false, time.Duration((1 - b.tokens) / limit.perSecond * float64(time.Second))
+	}
+	b.tokens--
+	l.usage[key]++
+	return true, 0
+}
+
+// AllowMessage returns true if one more message can be published by the identity.
+func (l *RateLimiter) AllowMessage(identity string) bool {
+	ok, _ := l.allow(limitMessages, identity)
+	return ok
+}
+
+// HandleRateUsage takes the usage of the limits on another node from the buckets of this node.
+// It is an implementation of the cluster.RateUsageHandler interface.
+func (l *RateLimiter) HandleRateUsage(usage map[string]float64) {
+	now := l.now()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for key, used := range usage {
+		limit, ok := l.limits[kindOf(key)]
+		if !ok {
+			continue
+		}
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{tokens: limit.burst, updated: now}
+			l.buckets[key] = b
+		}
+		l.refill(key, b, now)
+		b.tokens = math.Max(-limit.burst, b.tokens-used)
+	}
+}
+
+// Identity returns the identity of the request: "key:<API key>", "user:<user ID>" or "ip:<IP address>".
+// The user ID claimed by a request is not used, since it is not verified.
+func (l *RateLimiter) Identity(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return "key:" + key
+	}
+	if identity := auth.ClientIdentity(r); identity != "" {
+		return "user:" + identity
+	}
+	if l.tokenValidator != nil {
+		if token := auth.TokenFromRequest(r); token != "" {
+			if claims, err := l.tokenValidator.Validate(token); err == nil && claims.Subject != "" {
+				return "user:" + claims.Subject
+			}
+		}
+	}
+	return ConnIdentity("", r.RemoteAddr)
+}
+
+// ConnIdentity returns the identity of a client of the listeners other than the web server (e.g. gRPC or STOMP):
+// "user:<user ID>" if the user ID is verified, or else "ip:<IP address>".
+func ConnIdentity(verifiedUserID string, remoteAddr string) string {
+	if verifiedUserID != "" {
+		return "user:" + verifiedUserID
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return "ip:" + host
+}
+
+// Handler rejects the requests exceeding the request rate of their identity with the status 429,
+// and sets the identity of the accepted requests, returned by RateLimitIdentity.
+func (l *RateLimiter) Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := l.Identity(r)
+		if ok, retryAfter := l.allow(limitRequests, identity); !ok {
+			logger.WithFields(log.Fields{
+				"identity": identity,
+				"path":     r.URL.Path,
+			}).Info("Rate limit of requests exceeded")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rateLimitIdentityKey{}, identity)))
+	})
+}
@@ -0,0 +1,106 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBroadcaster struct {
+	usage map[string]float64
+}
+
+func (b *testBroadcaster) BroadcastRateUsage(usage map[string]float64) error {
+	b.usage = usage
+	return nil
+}
+
+func testRateLimiter(requests float64, burst int) (*RateLimiter, *time.Time) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(RateLimitConfig{Requests: &requests, RequestsBurst: &burst})
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRateLimiter_BurstAndSteadyRate(t *testing.T) {
+	a := assert.New(t)
+	l, now := testRateLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.allow(limitRequests, "ip:10.0.0.1")
+		a.True(ok)
+	}
+	ok, retryAfter := l.allow(limitRequests, "ip:10.0.0.1")
+	a.False(ok)
+	a.Equal(500*time.Millisecond, retryAfter)
+
+	// the other identities have their own buckets
+	ok, _ = l.allow(limitRequests, "ip:10.0.0.2")
+	a.True(ok)
+
+	// refilled at the steady rate
+	*now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		ok, _ = l.allow(limitRequests, "ip:10.0.0.1")
+		a.True(ok)
+	}
+	ok, _ = l.allow(limitRequests, "ip:10.0.0.1")
+	a.False(ok)
+
+	// the messages are not limited
+	a.True(l.AllowMessage("ip:10.0.0.1"))
+}
+
+func TestRateLimiter_SharedUsage(t *testing.T) {
+	a := assert.New(t)
+	l, now := testRateLimiter(1, 5)
+	b := &testBroadcaster{}
+	l.WithBroadcaster(b)
+
+	ok, _ := l.allow(limitRequests, "key:abc")
+	a.True(ok)
+	l.sync()
+	a.Equal(map[string]float64{"requests|key:abc": 1}, b.usage)
+
+	// the requests on the other nodes are taken from the bucket
+	l.HandleRateUsage(map[string]float64{"requests|key:abc": 4, "unknown|key:abc": 4})
+	ok, _ = l.allow(limitRequests, "key:abc")
+	a.False(ok)
+
+	// the full buckets are forgotten
+	*now = now.Add(10 * time.Second)
+	l.sync()
+	a.Len(l.buckets, 0)
+}
+
+func TestRateLimiter_Handler(t *testing.T) {
+	a := assert.New(t)
+	l, _ := testRateLimiter(1, 1)
+
+	var identity string
+	handler := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = RateLimitIdentity(r)
+	}))
+	get := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	a.Equal(http.StatusOK, get("").Code)
+	a.Equal("ip:10.0.0.1", identity)
+	w := get("")
+	a.Equal(http.StatusTooManyRequests, w.Code)
+	a.Equal("1", w.Header().Get("Retry-After"))
+
+	a.Equal(http.StatusOK, get("abc").Code)
+	a.Equal("key:abc", identity)
+}
@@ -0,0 +1,82 @@
+package webserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rs/xid"
+)
+
+const (
+	// RequestIDHeader is the header of the requests and responses carrying the correlation ID of the request
+	RequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength bounds the length of the request IDs given by the clients
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// RequestID returns the correlation ID of the request, assigned by the WebServer.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// logRequests assigns a correlation ID to each request (the one of its X-Request-ID header, if any),
+// returns it in the X-Request-ID header of the response, and logs the request when it is served.
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = xid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(recorder, r)
+
+		logger.WithFields(log.Fields{
+			"requestID":  id,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     recorder.status,
+			"duration":   time.Since(start),
+			"remoteAddr": r.RemoteAddr,
+		}).Info("HTTP request")
+	})
+}
+
+// statusRecorder keeps the status code of a response, and keeps supporting
+// the hijacking (for the websockets) and the flushing (for the streams) of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("The response does not support hijacking")
+	}
+	sr.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
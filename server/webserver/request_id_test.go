@@ -0,0 +1,37 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogRequestsAssignsRequestID(t *testing.T) {
+	a := assert.New(t)
+
+	var seen string
+	handler := logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/message/foo", nil))
+	a.Equal(http.StatusAccepted, rec.Code)
+	a.NotEmpty(seen)
+	a.Equal(seen, rec.Header().Get(RequestIDHeader))
+
+	// the request ID given by the client is kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "client-id")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	a.Equal("client-id", seen)
+	a.Equal("client-id", rec.Header().Get(RequestIDHeader))
+}
+
+func TestRequestIDWithoutMiddleware(t *testing.T) {
+	assert.Equal(t, "", RequestID(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
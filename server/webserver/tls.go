@@ -0,0 +1,128 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/smancke/guble/server/auth"
+)
+
+const (
+	// ClientAuthRequire requires a client certificate verified by the client CAs on each connection
+	ClientAuthRequire = "require"
+
+	// ClientAuthOptional verifies the client certificates by the client CAs, but accepts the connections without one
+	ClientAuthOptional = "optional"
+)
+
+var (
+	// ErrIncompleteKeyPair is returned when only one of the certificate and of the key files is configured
+	ErrIncompleteKeyPair = errors.New("Both the certificate and the key files are required for TLS")
+
+	// ErrClientCAWithoutTLS is returned when the client CAs are configured without a certificate of the server
+	ErrClientCAWithoutTLS = errors.New("The client certificates can be verified only by a TLS server")
+)
+
+// TLSConfig is used for configuring the TLS listener of the WebServer:
+// with the certificate and key files, or with certificates obtained automatically by ACME (e.g. from Let's Encrypt).
+type TLSConfig struct {
+	CertFile     *string
+	KeyFile      *string
+	ACMEHosts    *[]string
+	ACMECacheDir *string
+	ACMEEmail    *string
+
+	// ClientCAFile is the PEM file of the CAs verifying the client certificates (mutual TLS)
+	ClientCAFile *string
+	// ClientAuth is ClientAuthRequire or ClientAuthOptional
+	ClientAuth *string
+	// ClientIdentity is the field of the client certificates mapped to the user IDs: auth.IdentityCN or auth.IdentitySAN
+	ClientIdentity *string
+}
+
+// NewTLSConfig returns the TLS configuration of the WebServer, or nil if TLS is not configured.
+// The ACME certificates are obtained by the TLS-ALPN challenge, so the WebServer has to listen on the port 443.
+// If a client CA file is configured, the client certificates are verified by its CAs.
+func NewTLSConfig(config TLSConfig) (*tls.Config, error) {
+	tlsConfig, err := serverTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	caFile := stringValue(config.ClientCAFile)
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+	if tlsConfig == nil {
+		return nil, ErrClientCAWithoutTLS
+	}
+	if field := stringValue(config.ClientIdentity); field != "" {
+		if err := auth.ValidIdentityField(field); err != nil {
+			return nil, err
+		}
+	}
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("No PEM certificate found in the client CA file %q", caFile)
+	}
+	switch clientAuth := stringValue(config.ClientAuth); clientAuth {
+	case "", ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("Invalid client authentication %q: expected %s or %s", clientAuth, ClientAuthRequire, ClientAuthOptional)
+	}
+	logger.WithField("clientAuth", tlsConfig.ClientAuth).Info("Verifying the client certificates")
+	return tlsConfig, nil
+}
+
+// serverTLSConfig returns the TLS configuration with the certificate of the server, or nil if it is not configured.
+func serverTLSConfig(config TLSConfig) (*tls.Config, error) {
+	if config.ACMEHosts != nil && len(*config.ACMEHosts) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(*config.ACMEHosts...),
+		}
+		if config.ACMECacheDir != nil && *config.ACMECacheDir != "" {
+			m.Cache = autocert.DirCache(*config.ACMECacheDir)
+		}
+		if config.ACMEEmail != nil {
+			m.Email = *config.ACMEEmail
+		}
+		logger.WithField("hosts", *config.ACMEHosts).Info("Using ACME certificates")
+		return m.TLSConfig(), nil
+	}
+
+	certFile, keyFile := stringValue(config.CertFile), stringValue(config.KeyFile)
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, ErrIncompleteKeyPair
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,131 @@
+package webserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/server/auth"
+)
+
+func TestWebServerWithTLS(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guble_tls_test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeKeyPair(t, dir, "localhost")
+
+	tlsConfig, err := NewTLSConfig(TLSConfig{CertFile: &certFile, KeyFile: &keyFile})
+	a.NoError(err)
+	a.NotNil(tlsConfig)
+
+	server := New("localhost:0").WithTLS(tlsConfig)
+	server.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Write([]byte("tls"))
+		}
+	}))
+	a.NoError(server.Start())
+	defer server.Stop()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + server.GetAddr())
+	a.NoError(err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	a.Equal("tls", string(body))
+}
+
+func TestWebServerWithClientCertificates(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guble_tls_test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeKeyPair(t, dir, "localhost")
+	clientCertFile, clientKeyFile := writeKeyPair(t, dir, "device-1")
+
+	tlsConfig, err := NewTLSConfig(TLSConfig{CertFile: &certFile, KeyFile: &keyFile, ClientCAFile: &clientCertFile})
+	a.NoError(err)
+	a.Equal(tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+
+	server := New("localhost:0").WithTLS(tlsConfig).WithClientIdentity(auth.IdentityCN)
+	server.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(auth.ClientIdentity(r)))
+	}))
+	a.NoError(server.Start())
+	defer server.Stop()
+
+	// without a client certificate
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	_, err = client.Get("https://" + server.GetAddr())
+	a.Error(err)
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	a.NoError(err)
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{clientCert},
+	}}}
+	resp, err := client.Get("https://" + server.GetAddr())
+	a.NoError(err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	a.Equal("device-1", string(body))
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	a := assert.New(t)
+
+	tlsConfig, err := NewTLSConfig(TLSConfig{})
+	a.NoError(err)
+	a.Nil(tlsConfig)
+
+	certFile := "cert.pem"
+	_, err = NewTLSConfig(TLSConfig{CertFile: &certFile})
+	a.Equal(ErrIncompleteKeyPair, err)
+
+	_, err = NewTLSConfig(TLSConfig{ClientCAFile: &certFile})
+	a.Equal(ErrClientCAWithoutTLS, err)
+}
+
+// writeKeyPair writes a self-signed certificate of the common name and its key, and returns their files.
+func writeKeyPair(t *testing.T, dir, commonName string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, commonName+".pem")
+	keyFile := filepath.Join(dir, commonName+".key")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+	return certFile, keyFile
+}
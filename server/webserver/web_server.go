@@ -1,18 +1,34 @@
 package webserver
 
 import (
+	"crypto/tls"
 	"net"
 	"net/http"
 	"strings"
 	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/auth"
 )
 
 // WebServer is a struct representing a HTTP Server (using a net.Listener and a ServeMux multiplexer).
 type WebServer struct {
-	server *http.Server
-	ln     net.Listener
-	mux    *http.ServeMux
-	addr   string
+	server    *http.Server
+	ln        net.Listener
+	mux       *http.ServeMux
+	addr      string
+	tlsConfig *tls.Config
+
+	// identityField is the field of the client certificates mapped to the user IDs, if they are verified
+	identityField string
+
+	rateLimiter *RateLimiter
+
+	ipFilters []*IPFilter
+	adminAuth *AdminAuth
+
+	listeners []*Listener
 }
 
 // New returns a new WebServer.
@@ -23,31 +39,130 @@ func New(addr string) *WebServer {
 	}
 }
 
+// WithTLS makes the WebServer serve HTTPS (and WSS) with the TLS configuration, if it is not nil.
+func (ws *WebServer) WithTLS(config *tls.Config) *WebServer {
+	ws.tlsConfig = config
+	return ws
+}
+
+// WithClientIdentity maps the field (auth.IdentityCN or auth.IdentitySAN) of the verified client certificates
+// to the identities of the requests, returned by auth.ClientIdentity.
+func (ws *WebServer) WithClientIdentity(field string) *WebServer {
+	ws.identityField = field
+	return ws
+}
+
+// WithRateLimiter limits the rates of the requests of each identity by the RateLimiter, if it is not nil.
+func (ws *WebServer) WithRateLimiter(l *RateLimiter) *WebServer {
+	ws.rateLimiter = l
+	return ws
+}
+
+// WithIPFilter rejects the requests to the endpoints of the IPFilter whose clients are not allowed,
+// if it is not nil.
+func (ws *WebServer) WithIPFilter(f *IPFilter) *WebServer {
+	if f != nil {
+		ws.ipFilters = append(ws.ipFilters, f)
+	}
+	return ws
+}
+
+// WithAdminAuth requires the admin credentials on the admin endpoints, if the AdminAuth is not nil.
+func (ws *WebServer) WithAdminAuth(a *AdminAuth) *WebServer {
+	ws.adminAuth = a
+	return ws
+}
+
+// WithListener serves the endpoints of the WebServer also on the Listener, with its own settings.
+func (ws *WebServer) WithListener(l *Listener) *WebServer {
+	ws.listeners = append(ws.listeners, l)
+	return ws
+}
+
 // Start the WebServer (implementing service.startable interface).
 func (ws *WebServer) Start() (err error) {
-	logger.WithField("address", ws.addr).Info("Http server is starting up on address")
+	logger.WithFields(log.Fields{
+		"address": ws.addr,
+		"tls":     ws.tlsConfig != nil,
+	}).Info("Http server is starting up on address")
 
-	ws.server = &http.Server{Addr: ws.addr, Handler: ws.mux}
+	ws.server = &http.Server{Addr: ws.addr, Handler: logRequests(ws.handler(true, true))}
 	ws.ln, err = net.Listen("tcp", ws.addr)
 	if err != nil {
 		return
 	}
 
-	go func() {
-		err = ws.server.Serve(tcpKeepAliveListener{TCPListener: ws.ln.(*net.TCPListener)})
-		if err != nil && !strings.HasSuffix(err.Error(), "use of closed network connection") {
-			logger.WithError(err).Error("ListenAndServe")
+	var ln net.Listener = tcpKeepAliveListener{TCPListener: ws.ln.(*net.TCPListener)}
+	if ws.tlsConfig != nil {
+		ln = tls.NewListener(ln, ws.tlsConfig)
+	}
+	go serve(ws.server, ln, ws.addr)
+
+	for _, l := range ws.listeners {
+		logger.WithFields(log.Fields{
+			"address":   l.String(),
+			"prefixes":  l.Prefixes,
+			"adminAuth": l.AdminAuth,
+			"tls":       l.TLS,
+		}).Info("Http server is starting up on additional address")
+		if l.ln, err = l.listen(ws.tlsConfig); err != nil {
+			ws.closeListeners()
+			return
 		}
-		logger.WithField("address", ws.addr).Info("Http server stopped")
-	}()
+		// the clients of the unix domain sockets have no IP address: their access is controlled by the permissions of the socket
+		handler := ws.handler(l.AdminAuth, l.Network == "tcp")
+		go serve(&http.Server{Handler: logRequests(l.servePrefixes(handler))}, l.ln, l.String())
+	}
 	return
 }
 
-// Stop the WebServer (implementing service.stopable interface).
-func (ws *WebServer) Stop() (err error) {
+// handler returns the handler of the endpoints, requiring the admin credentials and filtering the IP addresses
+// of the clients if enabled.
+func (ws *WebServer) handler(adminAuth bool, ipFilters bool) http.Handler {
+	var handler http.Handler = ws.mux
+	if ws.adminAuth != nil && adminAuth {
+		handler = ws.adminAuth.Handler(handler)
+	}
+	if ws.rateLimiter != nil {
+		handler = ws.rateLimiter.Handler(handler)
+	}
+	if ws.identityField != "" {
+		handler = auth.ClientIdentityHandler(ws.identityField, handler)
+	}
+	if len(ws.ipFilters) > 0 && ipFilters {
+		handler = filterIPs(ws.ipFilters, handler)
+	}
+	return handler
+}
+
+func serve(server *http.Server, ln net.Listener, address string) {
+	err := server.Serve(ln)
+	if err != nil && !strings.HasSuffix(err.Error(), "use of closed network connection") {
+		logger.WithError(err).Error("ListenAndServe")
+	}
+	logger.WithField("address", address).Info("Http server stopped")
+}
+
+// closeListeners closes the main listener and the additional ones, returning the first error.
+func (ws *WebServer) closeListeners() (err error) {
 	if ws.ln != nil {
 		err = ws.ln.Close()
 	}
+	for _, l := range ws.listeners {
+		if l.ln == nil {
+			continue
+		}
+		if errClose := l.ln.Close(); errClose != nil && err == nil {
+			err = errClose
+		}
+		l.ln = nil
+	}
+	return
+}
+
+// Stop the WebServer (implementing service.stopable interface).
+func (ws *WebServer) Stop() (err error) {
+	err = ws.closeListeners()
 
 	// reset the mux
 	ws.mux = http.NewServeMux()
@@ -0,0 +1,12 @@
+package webserver
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                      = metrics.NS("webserver")
+	mTotalRateLimited       = ns.NewMap("total_rate_limited")
+	mTotalIPDenied          = ns.NewMap("total_ip_denied")
+	mTotalAdminUnauthorized = ns.NewInt("total_admin_unauthorized")
+)
@@ -0,0 +1,34 @@
+package websocket
+
+import (
+	"github.com/smancke/guble/protocol"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rs/xid"
+)
+
+// WithPresence publishes the presence events of the users on their topics /presence/<user>:
+// a join event when a user opens its first connection to this node, and a leave event when it closes its last one.
+func (handler *WSHandler) WithPresence() *WSHandler {
+	handler.presence = true
+	return handler
+}
+
+// publishPresence publishes the presence event of the user, if the presence events are enabled.
+func (handler *WSHandler) publishPresence(userID string, event string) {
+	if !handler.presence {
+		return
+	}
+	m := &protocol.Message{
+		Path:          protocol.Path(protocol.PresencePrefix + userID),
+		UserID:        userID,
+		ApplicationID: xid.New().String(),
+		Body:          []byte(event),
+	}
+	if err := handler.router.HandleMessage(m); err != nil {
+		logger.WithError(err).WithFields(log.Fields{
+			"userID": userID,
+			"event":  event,
+		}).Error("Error on publishing the presence event")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"github.com/smancke/guble/protocol"
 	"github.com/smancke/guble/server/router"
 	"github.com/smancke/guble/server/store"
+	"github.com/smancke/guble/server/tracing"
 
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -12,6 +14,7 @@ import (
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/rs/xid"
 )
 
 var errUnreadMsgsAvailable = errors.New("unread messages available")
@@ -34,6 +37,12 @@ type Receiver struct {
 	route               *router.Route
 	enableNotifications bool
 	userID              string
+	// filters are the additional route params of the subscription, given as json object in the header of the command
+	filters router.RouteParams
+	// protobuf sends the messages in the protobuf encoding instead of the text one
+	protobuf bool
+	// chunkSize is the size above which the bodies of the messages are sent in chunks (if any)
+	chunkSize int
 }
 
 // NewReceiverFromCmd parses the info in the command
@@ -82,9 +91,32 @@ func NewReceiverFromCmd(
 		}
 	}
 
+	if cmd.HeaderJSON != "" {
+		if rec.filters, err = parseFilters(cmd.HeaderJSON, applicationID, userID); err != nil {
+			return nil, err
+		}
+	}
+
 	return rec, nil
 }
 
+// parseFilters returns the filters of a receive command. The application_id can not be filtered,
+// and the user_id only with the user of the connection.
+func parseFilters(headerJSON, applicationID, userID string) (router.RouteParams, error) {
+	filters := router.RouteParams{}
+	if err := json.Unmarshal([]byte(headerJSON), &filters); err != nil {
+		return nil, fmt.Errorf("filters have to be a json object of strings, but were %q: %v", headerJSON, err)
+	}
+	if _, exists := filters["application_id"]; exists {
+		return nil, fmt.Errorf("application_id can not be filtered")
+	}
+	if value, exists := filters["user_id"]; exists && value != userID {
+		return nil, fmt.Errorf("user_id can only be filtered with the user of the connection")
+	}
+	delete(filters, "user_id")
+	return filters, nil
+}
+
 // Start starts the receiver loop
 func (rec *Receiver) Start() error {
 	rec.shouldStop = false
@@ -144,10 +176,32 @@ func (rec *Receiver) subscribeIfNoUnreadMessagesAvailable(maxMessageID uint64) e
 	return nil
 }
 
+func (rec *Receiver) routeParams() router.RouteParams {
+	params := router.RouteParams{"application_id": rec.applicationID, "user_id": rec.userID}
+	for key, value := range rec.filters {
+		params[key] = value
+	}
+	return params
+}
+
+// matchesFilters returns true if the fetched message would be delivered to the route of a subscription with filters,
+// like the messages published after subscribing.
+func (rec *Receiver) matchesFilters(data []byte) bool {
+	if len(rec.filters) == 0 {
+		return true
+	}
+	m, err := protocol.ParseMessage(data)
+	if err != nil || m.Filters == nil {
+		return true
+	}
+	config := router.RouteConfig{RouteParams: rec.routeParams()}
+	return config.Filter(m.Filters)
+}
+
 func (rec *Receiver) subscribe() {
 	rec.route = router.NewRoute(
 		router.RouteConfig{
-			RouteParams: router.RouteParams{"application_id": rec.applicationID, "user_id": rec.userID},
+			RouteParams: rec.routeParams(),
 			Path:        rec.path,
 			ChannelSize: 10,
 		},
@@ -155,7 +209,7 @@ func (rec *Receiver) subscribe() {
 
 	_, err := rec.router.Subscribe(rec.route)
 	if err != nil {
-		rec.sendError(protocol.ERROR_SUBSCRIBED_TO, string(rec.path), err.Error())
+		rec.sendError(protocol.ERROR_SUBSCRIBED_TO, "%s %s", rec.path, err.Error())
 	} else {
 		rec.sendOK(protocol.SUCCESS_SUBSCRIBED_TO, string(rec.path))
 	}
@@ -173,14 +227,14 @@ func (rec *Receiver) receiveFromSubscription() {
 				return
 			}
 
-			logger.WithFields(log.Fields{
-				"applicationId":   rec.applicationID,
-				"messageMetadata": m.Metadata(),
-			}).Debug("Delivering message")
+			logger.WithFields(m.LogFields()).WithField("applicationId", rec.applicationID).Debug("Delivering message")
 
 			if m.ID > rec.lastSentID {
 				rec.lastSentID = m.ID
-				rec.sendC <- m.Bytes()
+				span := tracing.StartSpan("websocket.deliver", tracing.FromMessage(m))
+				span.SetAttribute("applicationId", rec.applicationID)
+				rec.send(m)
+				span.End()
 			} else {
 				logger.WithFields(log.Fields{
 					"msgId": m.ID,
@@ -250,7 +304,10 @@ func (rec *Receiver) fetch() error {
 			}).Info("Reply sent")
 
 			rec.lastSentID = msgAndID.ID
-			rec.sendC <- msgAndID.Message
+			if !rec.matchesFilters(msgAndID.Message) {
+				continue
+			}
+			rec.sendStored(msgAndID.Message)
 		case err := <-fetch.ErrorC:
 			return err
 		case <-rec.cancelC:
@@ -262,6 +319,54 @@ func (rec *Receiver) fetch() error {
 	}
 }
 
+// send sends the message to the websocket, in chunks if its body is larger than the chunk size.
+func (rec *Receiver) send(m *protocol.Message) {
+	chunks, err := m.Split(rec.chunkSize, xid.New().String())
+	if err != nil {
+		logger.WithError(err).WithField("msgId", m.ID).Error("Error splitting a message in chunks")
+		chunks = []*protocol.Message{m}
+	}
+	for _, chunk := range chunks {
+		rec.sendC <- rec.encode(chunk)
+	}
+}
+
+// sendStored sends a stored message (in the text encoding) to the websocket, in chunks if it is larger than the chunk size.
+func (rec *Receiver) sendStored(data []byte) {
+	if rec.chunkSize <= 0 || len(data) <= rec.chunkSize {
+		rec.sendC <- rec.encodeStored(data)
+		return
+	}
+	m, err := protocol.ParseMessage(data)
+	if err != nil {
+		logger.WithError(err).Error("Error parsing a stored message")
+		rec.sendC <- data
+		return
+	}
+	rec.send(m)
+}
+
+// encode returns the message in the encoding of the websocket.
+func (rec *Receiver) encode(m *protocol.Message) []byte {
+	if rec.protobuf {
+		return m.MarshalProto()
+	}
+	return m.Bytes()
+}
+
+// encodeStored returns a stored message (in the text encoding) in the encoding of the websocket.
+func (rec *Receiver) encodeStored(data []byte) []byte {
+	if !rec.protobuf {
+		return data
+	}
+	m, err := protocol.ParseMessage(data)
+	if err != nil {
+		logger.WithError(err).Error("Error parsing a stored message")
+		return data
+	}
+	return m.MarshalProto()
+}
+
 // Stop stops/cancels the receiver
 func (rec *Receiver) Stop() error {
 	rec.cancelC <- true
@@ -189,6 +189,89 @@ func Test_Receiver_Fetch_Returns_Correct_Messages(t *testing.T) {
 	ctrl.Finish()
 }
 
+func Test_Receiver_Fetch_Protobuf(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	a := assert.New(t)
+
+	rec, msgChannel, _, messageStore, err := aMockedReceiver("/foo 0 1")
+	a.NoError(err)
+	rec.protobuf = true
+
+	stored := &protocol.Message{ID: 1, Path: "/foo", UserID: "marvin", Time: 1420110000, Body: []byte("The answer")}
+	messageStore.EXPECT().Fetch(gomock.Any()).Do(func(r *store.FetchRequest) {
+		go func() {
+			r.StartC <- 1
+			r.MessageC <- &store.FetchedMessage{ID: 1, Message: stored.Bytes()}
+			close(r.MessageC)
+		}()
+	})
+
+	fetchHasTerminated := make(chan bool)
+	go func() {
+		rec.fetchOnlyLoop()
+		fetchHasTerminated <- true
+	}()
+
+	// the stored messages are sent in the protobuf encoding, the notifications in the text one
+	expectMessages(a, msgChannel, "#"+protocol.SUCCESS_FETCH_START+" /foo 1")
+	expectMessages(a, msgChannel, string(stored.MarshalProto()))
+	expectMessages(a, msgChannel, "#"+protocol.SUCCESS_FETCH_END+" /foo")
+
+	testutil.ExpectDone(a, fetchHasTerminated)
+	ctrl.Finish()
+}
+
+func Test_Receiver_Fetch_Chunked(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	a := assert.New(t)
+
+	rec, msgChannel, _, messageStore, err := aMockedReceiver("/foo 0 1")
+	a.NoError(err)
+	rec.chunkSize = 6
+
+	stored := &protocol.Message{ID: 1, Path: "/foo", UserID: "marvin", Time: 1420110000, Body: []byte("The answer")}
+	messageStore.EXPECT().Fetch(gomock.Any()).Do(func(r *store.FetchRequest) {
+		go func() {
+			r.StartC <- 1
+			r.MessageC <- &store.FetchedMessage{ID: 1, Message: stored.Bytes()}
+			close(r.MessageC)
+		}()
+	})
+
+	fetchHasTerminated := make(chan bool)
+	go func() {
+		rec.fetchOnlyLoop()
+		fetchHasTerminated <- true
+	}()
+
+	// the body of the stored message is sent in two chunks, reassembled by the client
+	expectMessages(a, msgChannel, "#"+protocol.SUCCESS_FETCH_START+" /foo 1")
+	reassembler := &protocol.Reassembler{}
+	for i, body := range []string{"The an", "swer"} {
+		select {
+		case data := <-msgChannel:
+			chunk, err := protocol.ParseMessage(data)
+			a.NoError(err)
+			a.Equal(body, string(chunk.Body))
+			reassembled, err := reassembler.Add(chunk)
+			a.NoError(err)
+			if i == 1 && a.NotNil(reassembled) {
+				a.Equal(stored.Bytes(), reassembled.Bytes())
+			}
+		case <-time.After(time.Millisecond * 100):
+			a.Fail("timeout: " + body)
+		}
+	}
+	expectMessages(a, msgChannel, "#"+protocol.SUCCESS_FETCH_END+" /foo")
+
+	testutil.ExpectDone(a, fetchHasTerminated)
+	ctrl.Finish()
+}
+
 func Test_Receiver_Fetch_Produces_Correct_Fetch_Requests(t *testing.T) {
 	_, finish := testutil.NewMockCtrl(t)
 	defer finish()
@@ -290,15 +373,83 @@ func Test_Receiver_Fetch_Sends_error_on_failure_in_MaxMessageId(t *testing.T) {
 	expectMessages(a, msgChannel, "!error-server-internal expected test error")
 }
 
+func Test_Receiver_Filters_error_handling_on_create(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	a := assert.New(t)
+
+	badFilters := []string{"no json", `{"device_id": 42}`, `{"application_id": "other"}`, `{"user_id": "otherUser"}`}
+	for _, filters := range badFilters {
+		rec, _, _, _, err := aMockedReceiverWithFilters("/foo", filters)
+		a.Nil(rec, "Testing with: "+filters)
+		a.Error(err, "Testing with: "+filters)
+	}
+}
+
+func Test_Receiver_Filters(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	a := assert.New(t)
+
+	rec, msgChannel, routerMock, messageStore, err :=
+		aMockedReceiverWithFilters("/foo 0", `{"user_id": "userId", "device_id": "phone01"}`)
+	a.NoError(err)
+
+	// the fetched messages are filtered like the routes
+	messages := []*protocol.Message{
+		{ID: 1, Path: "/foo", Body: []byte("to all")},
+		{ID: 2, Path: "/foo", Body: []byte("to the phone"), Filters: map[string]string{"device_id": "phone01"}},
+		{ID: 3, Path: "/foo", Body: []byte("to another phone"), Filters: map[string]string{"device_id": "phone02"}},
+		{ID: 4, Path: "/foo", Body: []byte("to another user"), Filters: map[string]string{"user_id": "otherUser"}},
+	}
+	messageStore.EXPECT().Fetch(gomock.Any()).Do(func(r *store.FetchRequest) {
+		go func() {
+			r.StartC <- len(messages)
+			for _, m := range messages {
+				r.MessageC <- &store.FetchedMessage{ID: m.ID, Message: m.Bytes()}
+			}
+			close(r.MessageC)
+		}()
+	})
+	messageStore.EXPECT().DoInTx(gomock.Any(), gomock.Any()).
+		Do(func(partition string, callback func(maxMessageId uint64) error) {
+			callback(uint64(4))
+		})
+
+	// and the filters are params of the route
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal("phone01", r.Get("device_id"))
+		a.Equal("userId", r.Get("user_id"))
+		a.Equal("any-appId", r.Get("application_id"))
+		rec.Stop()
+	})
+	routerMock.EXPECT().Unsubscribe(gomock.Any())
+
+	go rec.subscriptionLoop()
+
+	expectMessages(a, msgChannel, "#"+protocol.SUCCESS_FETCH_START+" /foo 4")
+	expectMessages(a, msgChannel, string(messages[0].Bytes()), string(messages[1].Bytes()))
+	expectMessages(a, msgChannel, "#"+protocol.SUCCESS_FETCH_END+" /foo")
+	expectMessages(a, msgChannel, "#"+protocol.SUCCESS_SUBSCRIBED_TO+" /foo")
+	expectMessages(a, msgChannel, "#"+protocol.SUCCESS_CANCELED+" /foo")
+}
+
 //rec, sendChannel, router, messageStore, err := aMockedReceiver("+")
 func aMockedReceiver(arg string) (*Receiver, chan []byte, *MockRouter, *MockMessageStore, error) {
+	return aMockedReceiverWithFilters(arg, "")
+}
+
+func aMockedReceiverWithFilters(arg string, filters string) (*Receiver, chan []byte, *MockRouter, *MockMessageStore, error) {
 	routerMock := NewMockRouter(testutil.MockCtrl)
 	messageStore := NewMockMessageStore(testutil.MockCtrl)
 	routerMock.EXPECT().MessageStore().Return(messageStore, nil).AnyTimes()
 	sendChannel := make(chan []byte)
 	cmd := &protocol.Cmd{
-		Name: protocol.CmdReceive,
-		Arg:  arg,
+		Name:       protocol.CmdReceive,
+		Arg:        arg,
+		HeaderJSON: filters,
 	}
 	rec, err := NewReceiverFromCmd("any-appId", cmd, sendChannel, routerMock, "userId")
 	return rec, sendChannel, routerMock, messageStore, err
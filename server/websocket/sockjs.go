@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"net/http"
+	"strings"
+
+	"gopkg.in/igm/sockjs-go.v2/sockjs"
+
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/quota"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/webserver"
+)
+
+const (
+	sockJSUserIDParam = "userId"
+
+	// sockJSUnauthorized is the close code of the sessions rejected because of a missing or invalid token
+	sockJSUnauthorized = 4001
+)
+
+// SockJSHandler serves the stream API through SockJS, as a fallback for the clients which can not use websockets
+// (e.g. behind proxies dropping them); SockJS then uses transports like XHR streaming or polling.
+// The user id is given in the query of the SockJS URL, e.g. `/sockjs?userId=marvin`.
+type SockJSHandler struct {
+	*WSHandler
+	handler http.Handler
+}
+
+// NewSockJSHandler returns a new SockJSHandler.
+func NewSockJSHandler(router router.Router, prefix string) (*SockJSHandler, error) {
+	wsHandler, err := NewWSHandler(router, prefix)
+	if err != nil {
+		return nil, err
+	}
+	h := &SockJSHandler{WSHandler: wsHandler}
+	h.handler = sockjs.NewHandler(strings.TrimSuffix(prefix, "/"), sockjs.DefaultOptions, h.serveSession)
+	return h, nil
+}
+
+// ServeHTTP is an http.Handler.
+// It is a part of the service.endpoint implementation.
+func (h *SockJSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *SockJSHandler) serveSession(session sockjs.Session) {
+	var (
+		userID   string
+		identity string
+		apiKey   string
+		err      error
+	)
+	if r := session.Request(); r != nil {
+		userID, err = h.authenticate(r, r.URL.Query().Get(sockJSUserIDParam))
+		identity = webserver.RateLimitIdentity(r)
+		apiKey = r.Header.Get(webserver.APIKeyHeader)
+	} else if h.tokenValidator != nil {
+		err = auth.ErrMissingToken
+	}
+	if err != nil {
+		session.Close(sockJSUnauthorized, err.Error())
+		return
+	}
+	ws := NewWebSocket(h.WSHandler, &sockJSConn{session}, userID)
+	ws.rateLimitIdentity = identity
+	ws.quotaIdentity = quota.Identity(apiKey, userID)
+	ws.Start()
+}
+
+// sockJSConn is a wrapper of the sockjs.Session, implementing the WSConnection interface.
+type sockJSConn struct {
+	session sockjs.Session
+}
+
+// Close the session.
+func (conn *sockJSConn) Close() {
+	conn.session.Close(3000, "Go away!")
+}
+
+// Send bytes through the session and possibly return an error.
+func (conn *sockJSConn) Send(bytes []byte) error {
+	return conn.session.Send(string(bytes))
+}
+
+// Receive bytes through the session and possibly return an error.
+func (conn *sockJSConn) Receive(bytes *[]byte) error {
+	msg, err := conn.session.Recv()
+	if err != nil {
+		return err
+	}
+	*bytes = []byte(msg)
+	return nil
+}
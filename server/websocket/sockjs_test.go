@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/testutil"
+)
+
+type fakeSockJSSession struct {
+	request *http.Request
+	recvC   chan string
+	sentC   chan string
+	closeM  sync.Mutex
+	closed  bool
+}
+
+func newFakeSockJSSession(url string) *fakeSockJSSession {
+	r, _ := http.NewRequest(http.MethodGet, url, nil)
+	return &fakeSockJSSession{
+		request: r,
+		recvC:   make(chan string, 10),
+		sentC:   make(chan string, 10),
+	}
+}
+
+func (s *fakeSockJSSession) ID() string             { return "session" }
+func (s *fakeSockJSSession) Request() *http.Request { return s.request }
+func (s *fakeSockJSSession) Send(msg string) error  { s.sentC <- msg; return nil }
+
+func (s *fakeSockJSSession) Recv() (string, error) {
+	msg, ok := <-s.recvC
+	if !ok {
+		return "", errors.New("session closed")
+	}
+	return msg, nil
+}
+
+func (s *fakeSockJSSession) Close(status uint32, reason string) error {
+	s.closeM.Lock()
+	defer s.closeM.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *fakeSockJSSession) isClosed() bool {
+	s.closeM.Lock()
+	defer s.closeM.Unlock()
+	return s.closed
+}
+
+func Test_SockJSHandler_ServeSession(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().MessageStore().Return(NewMockMessageStore(testutil.MockCtrl), nil)
+	routerMock.EXPECT().Subscribe(routeMatcher{"/foo"}).Return(nil, nil)
+	routerMock.EXPECT().Unsubscribe(routeMatcher{"/foo"}).AnyTimes()
+
+	h := &SockJSHandler{WSHandler: testWSHandler(routerMock, auth.NewAllowAllAccessManager(true))}
+	session := newFakeSockJSSession("http://localhost/sockjs/000/abc/xhr_streaming?userId=marvin")
+
+	done := make(chan bool)
+	go func() {
+		h.serveSession(session)
+		close(done)
+	}()
+
+	connected := receiveSockJS(t, session)
+	a.Contains(connected, "#"+protocol.SUCCESS_CONNECTED)
+	a.Contains(connected, `"UserId": "marvin"`)
+
+	session.recvC <- "+ /foo"
+	a.Equal("#"+protocol.SUCCESS_SUBSCRIBED_TO+" /foo", receiveSockJS(t, session))
+
+	close(session.recvC)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("session was not closed")
+	}
+	a.True(session.isClosed())
+}
+
+func receiveSockJS(t *testing.T, session *fakeSockJSSession) string {
+	select {
+	case msg := <-session.sentC:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message sent to the session")
+	}
+	return ""
+}
@@ -2,28 +2,56 @@ package websocket
 
 import (
 	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/audit"
 	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/quota"
 	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/server/webserver"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/websocket"
 	"github.com/rs/xid"
 
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	// maxChunkedMessageSize is the maximum size of the body of a message sent in chunks by a client
+	maxChunkedMessageSize = 8 << 20
+
+	// maxPendingChunkedMessages is the maximum number of chunked messages being sent at once by a client
+	maxPendingChunkedMessages = 4
+
+	// reassemblyBudget is the maximum memory of the chunked messages being sent at once by all the clients
+	reassemblyBudget = 256 << 20
+)
+
+// chunkedMessages is the memory budget of the chunked messages, shared by all the connections.
+var chunkedMessages = protocol.NewReassemblyBudget(reassemblyBudget)
+
 var webSocketUpgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
 // WSHandler is a struct used for handling websocket connections on a certain prefix.
 type WSHandler struct {
-	router        router.Router
-	prefix        string
-	accessManager auth.AccessManager
+	router         router.Router
+	prefix         string
+	accessManager  auth.AccessManager
+	tokenValidator auth.TokenValidator
+	messageLimiter MessageLimiter
+	messageQuota   MessageQuota
+	presence       bool
+
+	mutex    sync.Mutex
+	sockets  map[*WebSocket]struct{}
+	draining bool
 }
 
 // NewWSHandler returns a new WSHandler.
@@ -39,6 +67,36 @@ func NewWSHandler(router router.Router, prefix string) (*WSHandler, error) {
 	}, nil
 }
 
+// WithTokenValidator requires a valid bearer token for connecting, and binds the subject of the token
+// to the user ID of the connection.
+func (handler *WSHandler) WithTokenValidator(v auth.TokenValidator) *WSHandler {
+	handler.tokenValidator = v
+	return handler
+}
+
+// MessageLimiter limits the rate of the messages published by each identity, implemented by a webserver.RateLimiter.
+type MessageLimiter interface {
+	AllowMessage(identity string) bool
+}
+
+// WithMessageLimiter limits the rate of the messages sent by the connections, by their identity given by the
+// webserver.RateLimiter handling their requests.
+func (handler *WSHandler) WithMessageLimiter(l MessageLimiter) *WSHandler {
+	handler.messageLimiter = l
+	return handler
+}
+
+// MessageQuota counts the messages published by each identity against their daily quotas, implemented by quota.Quotas.
+type MessageQuota interface {
+	Use(identity string, size int) error
+}
+
+// WithMessageQuota counts the messages sent by the connections against the daily quotas of their API key or user.
+func (handler *WSHandler) WithMessageQuota(q MessageQuota) *WSHandler {
+	handler.messageQuota = q
+	return handler
+}
+
 // GetPrefix returns the prefix.
 // It is a part of the service.endpoint implementation.
 func (handler *WSHandler) GetPrefix() string {
@@ -48,6 +106,29 @@ func (handler *WSHandler) GetPrefix() string {
 // ServeHTTP is an http.Handler.
 // It is a part of the service.endpoint implementation.
 func (handler *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler.isDraining() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	userID, err := handler.authenticate(r, extractUserID(r.RequestURI))
+	if err != nil {
+		http.Error(w, err.Error(), auth.AuthenticationStatus(err))
+		return
+	}
+	if location := handler.homeNodeLocation(r, userID); location != "" {
+		http.Redirect(w, r, location, http.StatusTemporaryRedirect)
+		return
+	}
+	will, err := handler.will(r, userID)
+	if err != nil {
+		status := http.StatusBadRequest
+		if _, denied := err.(*router.PermissionDeniedError); denied {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
 	c, err := webSocketUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.WithError(err).Error("Error on upgrading to websocket")
@@ -55,7 +136,140 @@ func (handler *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer c.Close()
 
-	NewWebSocket(handler, &wsconn{c}, extractUserID(r.RequestURI)).Start()
+	ws := NewWebSocket(handler, &wsconn{c}, userID)
+	ws.rateLimitIdentity = webserver.RateLimitIdentity(r)
+	ws.quotaIdentity = quota.Identity(r.Header.Get(webserver.APIKeyHeader), userID)
+	ws.will = will
+	ws.protobuf = r.Header.Get(protocol.EncodingHeader) == protocol.EncodingProtobuf
+	if size, err := strconv.Atoi(r.Header.Get(protocol.ChunkSizeHeader)); err == nil && size > 0 {
+		ws.chunkSize = size
+	}
+	ws.Start()
+}
+
+// will returns the last-will message registered by the headers of the handshake (or nil if there is none),
+// if the user is allowed to publish to its topic.
+func (handler *WSHandler) will(r *http.Request, userID string) (*protocol.Message, error) {
+	topic := r.Header.Get(protocol.WillTopicHeader)
+	if topic == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(topic, "/") {
+		return nil, fmt.Errorf("Invalid topic of the will: %s", topic)
+	}
+	path := protocol.Path(topic)
+	if !handler.accessManager.IsAllowed(auth.WRITE, userID, path) {
+		audit.RecordAuthFailure(auth.WRITE, userID, path)
+		return nil, &router.PermissionDeniedError{UserID: userID, AccessType: auth.WRITE, Path: path}
+	}
+	return &protocol.Message{
+		Path:   path,
+		UserID: userID,
+		Body:   []byte(r.Header.Get(protocol.WillMessageHeader)),
+	}, nil
+}
+
+// authenticate returns the user ID of the connection: the identity of its client certificate if any,
+// otherwise the subject of its bearer token, if a token is required.
+func (handler *WSHandler) authenticate(r *http.Request, userID string) (string, error) {
+	subject, err := auth.Authenticate(handler.tokenValidator, r, userID)
+	if err != nil {
+		logger.WithError(err).WithField("userID", userID).Info("Rejected the connection")
+		audit.Record(audit.Event{Type: audit.AuthFailure, UserID: userID, RemoteAddr: r.RemoteAddr, URL: r.URL.Path})
+		return "", err
+	}
+	return subject, nil
+}
+
+// homeNodeLocation returns the URL of the home node of the user, if the user is connecting to another node
+// and the cluster pins the users to their home nodes.
+func (handler *WSHandler) homeNodeLocation(r *http.Request, userID string) string {
+	c := handler.router.Cluster()
+	if c == nil || !c.Config.UserAffinity {
+		return ""
+	}
+	if userID == "" {
+		return ""
+	}
+	id, address := c.HomeNode(userID)
+	if id == c.Config.ID || address == "" {
+		return ""
+	}
+
+	logger.WithFields(log.Fields{
+		"userID":   userID,
+		"homeNode": id,
+	}).Debug("Redirecting user to its home node")
+	scheme := "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+	return scheme + "://" + address + r.RequestURI
+}
+
+func (handler *WSHandler) isDraining() bool {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	return handler.draining
+}
+
+func (handler *WSHandler) add(ws *WebSocket) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	if handler.sockets == nil {
+		handler.sockets = make(map[*WebSocket]struct{})
+	}
+	handler.sockets[ws] = struct{}{}
+}
+
+func (handler *WSHandler) remove(ws *WebSocket) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	delete(handler.sockets, ws)
+}
+
+// Drain stops accepting new connections, and tells the connected clients to reconnect to the peer
+// (or to the same address, if no peer is given). Each connection is closed once its pending messages were sent,
+// or when the timeout expires.
+// It is a part of the service.Drainable implementation.
+func (handler *WSHandler) Drain(peer string, timeout time.Duration) error {
+	handler.mutex.Lock()
+	if handler.draining {
+		handler.mutex.Unlock()
+		return nil
+	}
+	handler.draining = true
+	sockets := make([]*WebSocket, 0, len(handler.sockets))
+	for ws := range handler.sockets {
+		sockets = append(sockets, ws)
+	}
+	handler.mutex.Unlock()
+
+	logger.WithFields(log.Fields{
+		"prefix":      handler.prefix,
+		"connections": len(sockets),
+		"peer":        peer,
+	}).Info("Draining websocket connections")
+
+	deadline := time.Now().Add(timeout)
+	var wg sync.WaitGroup
+	for _, ws := range sockets {
+		wg.Add(1)
+		go func(ws *WebSocket) {
+			defer wg.Done()
+			ws.drain(peer, deadline)
+		}(ws)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Resume accepts new connections again after draining.
+// It is a part of the service.Resumable implementation.
+func (handler *WSHandler) Resume() {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	handler.draining = false
 }
 
 // WSConnection is a wrapper interface for the needed functions of the websocket.Conn
@@ -95,7 +309,27 @@ type WebSocket struct {
 	applicationID string
 	userID        string
 	sendChannel   chan []byte
+	drainedC      chan struct{}
 	receivers     map[protocol.Path]*Receiver
+
+	// rateLimitIdentity is the identity of the connection for the rate of its messages (if any)
+	rateLimitIdentity string
+
+	// quotaIdentity is the identity of the connection for the quotas of its messages (if any)
+	quotaIdentity string
+
+	// will is published if the connection drops without being closed by the client (if any)
+	will *protocol.Message
+
+	// protobuf sends the messages in the protobuf encoding, chosen by the client in the handshake
+	protobuf bool
+
+	// chunkSize is the size above which the bodies of the messages are sent in chunks (if any),
+	// chosen by the client in the handshake
+	chunkSize int
+
+	// reassembler reassembles the messages sent in chunks by the client
+	reassembler *protocol.Reassembler
 }
 
 // NewWebSocket returns a new WebSocket.
@@ -106,13 +340,29 @@ func NewWebSocket(handler *WSHandler, wsConn WSConnection, userID string) *WebSo
 		applicationID: xid.New().String(),
 		userID:        userID,
 		sendChannel:   make(chan []byte, 10),
+		drainedC:      make(chan struct{}),
 		receivers:     make(map[protocol.Path]*Receiver),
+		reassembler: &protocol.Reassembler{
+			MaxSize:    maxChunkedMessageSize,
+			MaxPending: maxPendingChunkedMessages,
+			Budget:     chunkedMessages,
+		},
 	}
 }
 
 // Start the WebSocket (the send and receive loops).
 // It is implementing the service.startable interface.
 func (ws *WebSocket) Start() error {
+	ws.add(ws)
+	defer ws.remove(ws)
+	if connected(ws.userID) {
+		ws.publishPresence(ws.userID, protocol.PresenceJoin)
+	}
+	defer func() {
+		if disconnected(ws.userID) {
+			ws.publishPresence(ws.userID, protocol.PresenceLeave)
+		}
+	}()
 	ws.sendConnectionMessage()
 	go ws.sendLoop()
 	ws.receiveLoop()
@@ -121,6 +371,11 @@ func (ws *WebSocket) Start() error {
 
 func (ws *WebSocket) sendLoop() {
 	for raw := range ws.sendChannel {
+		if raw == nil {
+			// all the messages queued before draining were sent
+			close(ws.drainedC)
+			continue
+		}
 		if !ws.checkAccess(raw) {
 			continue
 		}
@@ -138,23 +393,41 @@ func (ws *WebSocket) sendLoop() {
 }
 
 func (ws *WebSocket) checkAccess(raw []byte) bool {
-	if len(raw) > 0 && raw[0] == byte('/') {
-		path := getPathFromRawMessage(raw)
+	if len(raw) > 0 && (raw[0] == byte('/') || ws.protobuf && protocol.IsProto(raw)) {
+		path, err := getPathFromRawMessage(raw)
+		if err != nil {
+			logger.WithError(err).WithField("userID", ws.userID).Error("Dropping an unparsable msg")
+			return false
+		}
 
 		logger.WithFields(log.Fields{
 			"userID": ws.userID,
 			"path":   path,
 		}).Debug("Received msg")
 
-		return len(path) == 0 || ws.accessManager.IsAllowed(auth.READ, ws.userID, path)
+		if !ws.accessManager.IsAllowed(auth.READ, ws.userID, path) {
+			audit.RecordAuthFailure(auth.READ, ws.userID, path)
+			return false
+		}
+		return true
 
 	}
 	return true
 }
 
-func getPathFromRawMessage(raw []byte) protocol.Path {
+func getPathFromRawMessage(raw []byte) (protocol.Path, error) {
+	if protocol.IsProto(raw) {
+		msg, err := protocol.ParseProtoMessage(raw)
+		if err != nil {
+			return "", err
+		}
+		return msg.Path, nil
+	}
 	i := strings.Index(string(raw), ",")
-	return protocol.Path(raw[:i])
+	if i < 0 {
+		return "", fmt.Errorf("message has no header, got %q", raw)
+	}
+	return protocol.Path(raw[:i]), nil
 }
 
 func (ws *WebSocket) receiveLoop() {
@@ -167,6 +440,9 @@ func (ws *WebSocket) receiveLoop() {
 				"applicationID": ws.applicationID,
 			}).Debug("Closed connnection by application")
 
+			if ws.will != nil && !websocket.IsCloseError(err, websocket.CloseNormalClosure) && !ws.isDraining() {
+				ws.publishWill()
+			}
 			ws.cleanAndClose()
 			break
 		}
@@ -200,6 +476,10 @@ func (ws *WebSocket) sendConnectionMessage() {
 }
 
 func (ws *WebSocket) handleReceiveCmd(cmd *protocol.Cmd) {
+	if router.IsDraining(ws.router) {
+		ws.sendError(protocol.ERROR_UNAVAILABLE, "%s", router.ErrDraining.Error())
+		return
+	}
 	rec, err := NewReceiverFromCmd(
 		ws.applicationID,
 		cmd,
@@ -212,6 +492,8 @@ func (ws *WebSocket) handleReceiveCmd(cmd *protocol.Cmd) {
 		ws.sendError(protocol.ERROR_BAD_REQUEST, err.Error())
 		return
 	}
+	rec.protobuf = ws.protobuf
+	rec.chunkSize = ws.chunkSize
 	ws.receivers[rec.path] = rec
 	rec.Start()
 }
@@ -240,17 +522,78 @@ func (ws *WebSocket) handleSendCmd(cmd *protocol.Cmd) {
 	}
 
 	args := strings.SplitN(cmd.Arg, " ", 2)
-	msg := &protocol.Message{
+	// the optional publisherMessageId is returned in the notifications about the message
+	publisherMessageID := ""
+	if len(args) > 1 {
+		publisherMessageID = strings.TrimSpace(args[1])
+	}
+	// every frame counts, so that the chunks of a message are limited as well
+	if ws.messageLimiter != nil && ws.rateLimitIdentity != "" && !ws.messageLimiter.AllowMessage(ws.rateLimitIdentity) {
+		ws.sendError(protocol.ERROR_RATE_LIMITED, strings.TrimSpace(args[0]+" "+publisherMessageID))
+		return
+	}
+	msg, err := ws.reassembler.Add(&protocol.Message{
 		Path:          protocol.Path(args[0]),
 		ApplicationID: ws.applicationID,
 		UserID:        ws.userID,
 		HeaderJSON:    cmd.HeaderJSON,
 		Body:          cmd.Body,
+	})
+	if err != nil {
+		ws.sendError(protocol.ERROR_BAD_REQUEST, err.Error())
+		return
+	}
+	if msg == nil {
+		// the other chunks of the message are still missing
+		return
+	}
+	if err := msg.ValidateEncryption(); err != nil {
+		ws.sendError(protocol.ERROR_BAD_REQUEST, err.Error())
+		return
+	}
+	if ws.messageQuota != nil && ws.quotaIdentity != "" {
+		if err := ws.messageQuota.Use(ws.quotaIdentity, len(msg.Body)); err != nil {
+			ws.sendError(protocol.ERROR_QUOTA_EXCEEDED, strings.TrimSpace(args[0]+" "+publisherMessageID))
+			return
+		}
+	}
+
+	if err := ws.router.HandleMessage(msg); err != nil {
+		logger.WithError(err).WithField("path", msg.Path).Error("Error on handling the sent message")
+		ws.sendError(protocol.ERROR_SEND, "%s", strings.TrimSpace(publisherMessageID+" "+err.Error()))
+		return
 	}
 
-	ws.router.HandleMessage(msg)
+	if publisherMessageID == "" {
+		ws.sendOK(protocol.SUCCESS_SEND, "")
+		return
+	}
+	receipt, _ := json.Marshal(&protocol.SendReceipt{
+		SequenceID:            msg.ID,
+		Path:                  string(msg.Path),
+		PublisherMessageID:    publisherMessageID,
+		MessagePublishingTime: msg.Time,
+	})
+	ws.sendChannel <- (&protocol.NotificationMessage{
+		Name: protocol.SUCCESS_SEND,
+		Arg:  publisherMessageID,
+		Json: string(receipt),
+	}).Bytes()
+}
 
-	ws.sendOK(protocol.SUCCESS_SEND, "")
+// publishWill publishes the last-will message of the connection, which dropped without being closed by the client.
+// The connections closed while draining are not dropped: their clients reconnect to the peers.
+func (ws *WebSocket) publishWill() {
+	ws.will.ApplicationID = ws.applicationID
+	logger.WithFields(log.Fields{
+		"userID": ws.userID,
+		"path":   ws.will.Path,
+	}).Info("Publishing the will of a dropped connection")
+	if err := ws.router.HandleMessage(ws.will); err != nil {
+		logger.WithError(err).WithField("path", ws.will.Path).Error("Error on publishing the will")
+		return
+	}
+	mWillsPublished.Add(1)
 }
 
 func (ws *WebSocket) cleanAndClose() {
@@ -263,7 +606,33 @@ func (ws *WebSocket) cleanAndClose() {
 		rec.Stop()
 		delete(ws.receivers, path)
 	}
+	ws.reassembler.Reset()
+
+	ws.Close()
+}
 
+// drain sends the messages already queued for the client, tells it to reconnect to the peer,
+// and closes the connection; the connection is closed anyway at the deadline.
+func (ws *WebSocket) drain(peer string, deadline time.Time) {
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+
+	n := &protocol.NotificationMessage{Name: protocol.SUCCESS_RECONNECT, Arg: peer}
+	for _, raw := range [][]byte{n.Bytes(), nil} {
+		select {
+		case ws.sendChannel <- raw:
+		case <-timeout.C:
+			logger.WithField("applicationID", ws.applicationID).Warn("Timeout draining connection")
+			ws.Close()
+			return
+		}
+	}
+	select {
+	case <-ws.drainedC:
+		logger.WithField("applicationID", ws.applicationID).Debug("Closing drained connection")
+	case <-timeout.C:
+		logger.WithField("applicationID", ws.applicationID).Warn("Timeout draining connection")
+	}
 	ws.Close()
 }
 
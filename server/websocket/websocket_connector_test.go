@@ -3,6 +3,8 @@ package websocket
 import (
 	"github.com/smancke/guble/protocol"
 	"github.com/smancke/guble/server/auth"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/quota"
 	"github.com/smancke/guble/server/router"
 	"github.com/smancke/guble/server/store"
 	"github.com/smancke/guble/testutil"
@@ -10,7 +12,10 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
@@ -74,6 +79,103 @@ func Test_SendMessage(t *testing.T) {
 	runNewWebSocket(wsconn, routerMock, messageStore, nil)
 }
 
+func Test_SendMessage_WithPublisherMessageID(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	commands := []string{"> /path 4711\n\nHello", "> /other 4712\n\nHello"}
+	wsconn, routerMock, messageStore := createDefaultMocks(commands)
+
+	routerMock.EXPECT().HandleMessage(messageMatcher{path: "/path", message: "Hello"}).
+		Do(func(m *protocol.Message) {
+			m.ID = 42
+			m.Time = 1420110000
+		})
+	routerMock.EXPECT().HandleMessage(messageMatcher{path: "/other", message: "Hello"}).
+		Return(errors.New("not allowed"))
+	wsconn.EXPECT().Send([]byte("#send 4711\n" +
+		`{"sequenceId":42,"path":"/path","publisherMessageId":"4711","messagePublishingTime":1420110000}`))
+	wsconn.EXPECT().Send([]byte("!" + protocol.ERROR_SEND + " 4712 not allowed"))
+
+	runNewWebSocket(wsconn, routerMock, messageStore, nil)
+}
+
+func Test_SendMessage_Chunked(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	commands := []string{
+		"> /path\n{\"Chunk\": \"abc 1/2\", \"key\": \"value\"}\nWorld",
+		"> /path\n{\"Chunk\": \"abc 0/2\", \"key\": \"value\"}\nHello ",
+		"> /path\n{\"Chunk\": \"abc 2/2\"}\nHello",
+	}
+	wsconn, routerMock, messageStore := createDefaultMocks(commands)
+
+	// the message is handled once all its chunks are received
+	routerMock.EXPECT().HandleMessage(messageMatcher{path: "/path", message: "Hello World", header: `{"key":"value"}`})
+	wsconn.EXPECT().Send([]byte("#send"))
+	wsconn.EXPECT().Send([]byte("!" + protocol.ERROR_BAD_REQUEST + ` invalid chunk "abc 2/2"`))
+
+	runNewWebSocket(wsconn, routerMock, messageStore, nil)
+}
+
+// testMessageLimiter allows a number of messages to the identity
+type testMessageLimiter struct {
+	identity string
+	messages int
+}
+
+func (l *testMessageLimiter) AllowMessage(identity string) bool {
+	if identity != l.identity || l.messages == 0 {
+		return false
+	}
+	l.messages--
+	return true
+}
+
+func Test_SendMessage_RateLimited(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	commands := []string{"> /path\nHello", "> /other\nHello"}
+	wsconn, routerMock, _ := createDefaultMocks(commands)
+
+	routerMock.EXPECT().HandleMessage(gomock.Any())
+	wsconn.EXPECT().Send([]byte("#send"))
+	wsconn.EXPECT().Send([]byte("!" + protocol.ERROR_RATE_LIMITED + " /other"))
+
+	limiter := &testMessageLimiter{identity: "ip:10.0.0.1", messages: 1}
+	handler := testWSHandler(routerMock, auth.NewAllowAllAccessManager(true)).WithMessageLimiter(limiter)
+	ws := NewWebSocket(handler, wsconn, "testuser")
+	ws.rateLimitIdentity = "ip:10.0.0.1"
+	go func() {
+		ws.Start()
+	}()
+	time.Sleep(time.Millisecond * 2)
+}
+
+func Test_SendMessage_QuotaExceeded(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	commands := []string{"> /path\nHello", "> /other\nHello"}
+	wsconn, routerMock, _ := createDefaultMocks(commands)
+
+	routerMock.EXPECT().HandleMessage(gomock.Any())
+	wsconn.EXPECT().Send([]byte("#send"))
+	wsconn.EXPECT().Send([]byte("!" + protocol.ERROR_QUOTA_EXCEEDED + " /other"))
+
+	messages := int64(1)
+	quotas := quota.New(kvstore.NewMemoryKVStore(), quota.Config{Messages: &messages})
+	handler := testWSHandler(routerMock, auth.NewAllowAllAccessManager(true)).WithMessageQuota(quotas)
+	ws := NewWebSocket(handler, wsconn, "testuser")
+	ws.quotaIdentity = quota.Identity("", "testuser")
+	go func() {
+		ws.Start()
+	}()
+	time.Sleep(time.Millisecond * 2)
+}
+
 func Test_AnIncomingMessageIsDelivered(t *testing.T) {
 	_, finish := testutil.NewMockCtrl(t)
 	defer finish()
@@ -121,6 +223,30 @@ func Test_AnIncomingMessageIsNotAllowed(t *testing.T) {
 	time.Sleep(time.Millisecond * 2)
 }
 
+func Test_AnIncomingProtobufMessageIsNotAllowed(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	wsconn, routerMock, _ := createDefaultMocks([]string{})
+
+	tam := NewMockAccessManager(ctrl)
+	tam.EXPECT().IsAllowed(auth.READ, "testuser", protocol.Path("/foo")).Return(false)
+	handler := NewWebSocket(
+		testWSHandler(routerMock, tam),
+		wsconn,
+		"testuser",
+	)
+	handler.protobuf = true
+	go func() {
+		handler.Start()
+	}()
+	time.Sleep(time.Millisecond * 2)
+
+	// nothing shall be sent
+	handler.sendChannel <- aTestMessage.MarshalProto()
+	time.Sleep(time.Millisecond * 2)
+}
+
 func Test_BadCommands(t *testing.T) {
 	_, finish := testutil.NewMockCtrl(t)
 	defer finish()
@@ -153,6 +279,54 @@ func Test_BadCommands(t *testing.T) {
 	assert.Equal(t, len(badRequests), counter, "expected number of bad requests does not match")
 }
 
+func Test_WebSocket_Drain(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	a := assert.New(t)
+
+	wsconn, routerMock, messageStore := createDefaultMocks([]string{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	wsconn.EXPECT().Send([]byte("#" + protocol.SUCCESS_RECONNECT + " 10.0.0.2:8080"))
+	wsconn.EXPECT().Close().Do(func() { wg.Done() })
+
+	websocket := runNewWebSocket(wsconn, routerMock, messageStore, nil)
+	a.NoError(websocket.WSHandler.Drain("10.0.0.2:8080", time.Second))
+	wg.Wait()
+
+	// the new connections are refused
+	w := httptest.NewRecorder()
+	websocket.WSHandler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prefix", nil))
+	a.Equal(http.StatusServiceUnavailable, w.Code)
+}
+
+// drainingRouter is a router refusing the new subscriptions.
+type drainingRouter struct {
+	*MockRouter
+}
+
+func (drainingRouter) IsDraining() bool {
+	return true
+}
+
+func Test_WebSocket_SubscribeWhileDraining(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	wsconn, routerMock, _ := createDefaultMocks([]string{"+ /foo"})
+	wsconn.EXPECT().Send([]byte("!" + protocol.ERROR_UNAVAILABLE + " " + router.ErrDraining.Error()))
+
+	handler := testWSHandler(routerMock, auth.NewAllowAllAccessManager(true))
+	handler.router = drainingRouter{routerMock}
+	ws := NewWebSocket(handler, wsconn, "testuser")
+	go func() {
+		ws.Start()
+	}()
+	time.Sleep(time.Millisecond * 2)
+}
+
 func TestExtractUserId(t *testing.T) {
 	assert.Equal(t, "marvin", extractUserID("/foo/user/marvin"))
 	assert.Equal(t, "marvin", extractUserID("/user/marvin"))
@@ -260,3 +434,212 @@ func (notify connectedNotificationMatcher) Matches(x interface{}) bool {
 func (notify connectedNotificationMatcher) String() string {
 	return fmt.Sprintf("is connected message")
 }
+
+// testTokenValidator accepts the tokens mapped to their subject
+type testTokenValidator map[string]string
+
+func (v testTokenValidator) Validate(token string) (*auth.Claims, error) {
+	subject, ok := v[token]
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Claims{Subject: subject}, nil
+}
+
+func TestWSHandler_TokenRequired(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	handler := testWSHandler(NewMockRouter(ctrl), auth.NewAllowAllAccessManager(true)).
+		WithTokenValidator(testTokenValidator{"token": "marvin"})
+
+	_, err := handler.authenticate(httptest.NewRequest(http.MethodGet, "/prefix/user/marvin", nil), "marvin")
+	a.Equal(auth.ErrMissingToken, err)
+
+	userID, err := handler.authenticate(httptest.NewRequest(http.MethodGet, "/prefix?access_token=token", nil), "")
+	a.NoError(err)
+	a.Equal("marvin", userID)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prefix/user/arthur?access_token=token", nil))
+	a.Equal(http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prefix/user/marvin", nil))
+	a.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func Test_WebSocket_WillPublishedOnDrop(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	for _, draining := range []bool{false, true} {
+		routerMock := NewMockRouter(ctrl)
+		wsconn := NewMockWSConnection(ctrl)
+		wsconn.EXPECT().Send(gomock.Any()).AnyTimes()
+		wsconn.EXPECT().Receive(gomock.Any()).Return(errors.New("connection reset by peer"))
+		wsconn.EXPECT().Close()
+
+		// the will is published if the connection drops, except while draining
+		if !draining {
+			routerMock.EXPECT().HandleMessage(messageMatcher{path: "/status/testuser", message: "offline"})
+		}
+
+		handler := testWSHandler(routerMock, auth.NewAllowAllAccessManager(true))
+		handler.draining = draining
+		ws := NewWebSocket(handler, wsconn, "testuser")
+		ws.will = &protocol.Message{Path: "/status/testuser", UserID: "testuser", Body: []byte("offline")}
+		ws.Start()
+	}
+}
+
+func TestWSHandler_Will(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	request := func(topic string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/prefix/user/marvin", nil)
+		if topic != "" {
+			r.Header.Set(protocol.WillTopicHeader, topic)
+			r.Header.Set(protocol.WillMessageHeader, "offline")
+		}
+		return r
+	}
+
+	handler := testWSHandler(NewMockRouter(ctrl), auth.NewAllowAllAccessManager(true))
+	will, err := handler.will(request("/status/marvin"), "marvin")
+	a.NoError(err)
+	a.Equal(protocol.Path("/status/marvin"), will.Path)
+	a.Equal("marvin", will.UserID)
+	a.Equal("offline", string(will.Body))
+
+	will, err = handler.will(request(""), "marvin")
+	a.NoError(err)
+	a.Nil(will)
+
+	_, err = handler.will(request("status"), "marvin")
+	a.Error(err)
+
+	routerMock := NewMockRouter(ctrl)
+	routerMock.EXPECT().Cluster().Return(nil)
+	handler = testWSHandler(routerMock, auth.NewAllowAllAccessManager(false))
+	_, err = handler.will(request("/status/marvin"), "marvin")
+	a.IsType(&router.PermissionDeniedError{}, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, request("/status/marvin"))
+	a.Equal(http.StatusForbidden, w.Code)
+}
+
+func Test_WebSocket_Presence(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	routerMock := NewMockRouter(ctrl)
+	handler := testWSHandler(routerMock, auth.NewAllowAllAccessManager(true)).WithPresence()
+
+	// a connection is started once it sent the connection message, and closed by closing closeC
+	newConnection := func() (ws *WebSocket, startedC chan bool, closeC chan error) {
+		wsconn := NewMockWSConnection(ctrl)
+		startedC = make(chan bool, 1)
+		wsconn.EXPECT().Send(gomock.Any()).Do(func(bytes []byte) {
+			select {
+			case startedC <- true:
+			default:
+			}
+		}).AnyTimes()
+		closeC = make(chan error)
+		wsconn.EXPECT().Receive(gomock.Any()).Do(func(message *[]byte) { <-closeC }).Return(errors.New("closed"))
+		wsconn.EXPECT().Close()
+		return NewWebSocket(handler, wsconn, "presence-user"), startedC, closeC
+	}
+	run := func(ws *WebSocket) chan bool {
+		done := make(chan bool)
+		go func() {
+			ws.Start()
+			close(done)
+		}()
+		return done
+	}
+
+	// the user joins with its first connection
+	joined := make(chan bool)
+	routerMock.EXPECT().HandleMessage(messageMatcher{path: "/presence/presence-user", message: "join"}).
+		Do(func(m *protocol.Message) { close(joined) })
+	first, _, closeFirst := newConnection()
+	firstDone := run(first)
+	<-joined
+
+	// and leaves with its last one
+	second, secondStarted, closeSecond := newConnection()
+	secondDone := run(second)
+	<-secondStarted
+	close(closeFirst)
+	<-firstDone
+
+	routerMock.EXPECT().HandleMessage(messageMatcher{path: "/presence/presence-user", message: "leave"})
+	close(closeSecond)
+	<-secondDone
+}
+
+func Test_AnIncomingUnparsableProtobufMessageIsNotAllowed(t *testing.T) {
+	ctrl, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	wsconn, routerMock, _ := createDefaultMocks([]string{})
+
+	// the access manager shall not be asked and nothing shall be sent
+	tam := NewMockAccessManager(ctrl)
+	handler := NewWebSocket(
+		testWSHandler(routerMock, tam),
+		wsconn,
+		"testuser",
+	)
+	handler.protobuf = true
+	go func() {
+		handler.Start()
+	}()
+	time.Sleep(time.Millisecond * 2)
+
+	handler.sendChannel <- []byte{0x12, 42, '/'}
+	time.Sleep(time.Millisecond * 2)
+}
+
+func Test_getPathFromRawMessage(t *testing.T) {
+	a := assert.New(t)
+
+	path, err := getPathFromRawMessage([]byte("/foo,42,user01,phone01,id123,1420110000,1\n{}\nHello"))
+	a.NoError(err)
+	a.Equal(protocol.Path("/foo"), path)
+
+	_, err = getPathFromRawMessage([]byte("/foo"))
+	a.Error(err)
+
+	_, err = getPathFromRawMessage([]byte{0x12, 42, '/'})
+	a.Error(err)
+}
+
+func Test_SendMessage_ChunksRateLimited(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+
+	commands := []string{
+		"> /path\n{\"Chunk\": \"abc 0/2\"}\nHello",
+		"> /path\n{\"Chunk\": \"abc 1/2\"}\n World",
+	}
+	wsconn, routerMock, _ := createDefaultMocks(commands)
+
+	// the second chunk exceeds the limit, so that the message is never handled
+	wsconn.EXPECT().Send([]byte("!" + protocol.ERROR_RATE_LIMITED + " /path"))
+
+	limiter := &testMessageLimiter{identity: "ip:10.0.0.1", messages: 1}
+	handler := testWSHandler(routerMock, auth.NewAllowAllAccessManager(true)).WithMessageLimiter(limiter)
+	ws := NewWebSocket(handler, wsconn, "testuser")
+	ws.rateLimitIdentity = "ip:10.0.0.1"
+	go func() {
+		ws.Start()
+	}()
+	time.Sleep(time.Millisecond * 2)
+}
@@ -0,0 +1,53 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                  = metrics.NS("websocket")
+	mCurrentConnections = ns.NewInt("current_connections")
+	mCurrentUsers       = ns.NewInt("current_users")
+	mWillsPublished     = ns.NewInt("wills_published")
+
+	// connectedUsers counts the connections of each user, for the gauge of the distinct users
+	connectedUsers      = make(map[string]int)
+	connectedUsersMutex sync.Mutex
+)
+
+// connected updates the gauges for a new connection of the user, and returns true if it is its first one.
+func connected(userID string) bool {
+	mCurrentConnections.Add(1)
+	if userID == "" {
+		return false
+	}
+
+	connectedUsersMutex.Lock()
+	defer connectedUsersMutex.Unlock()
+	connectedUsers[userID]++
+	if connectedUsers[userID] == 1 {
+		mCurrentUsers.Add(1)
+		return true
+	}
+	return false
+}
+
+// disconnected updates the gauges for a closed connection of the user, and returns true if it was its last one.
+func disconnected(userID string) bool {
+	mCurrentConnections.Add(-1)
+	if userID == "" {
+		return false
+	}
+
+	connectedUsersMutex.Lock()
+	defer connectedUsersMutex.Unlock()
+	connectedUsers[userID]--
+	if connectedUsers[userID] <= 0 {
+		delete(connectedUsers, userID)
+		mCurrentUsers.Add(-1)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/server/metrics"
+)
+
+func TestConnectionAndUserGauges(t *testing.T) {
+	a := assert.New(t)
+	mCurrentConnections.Set(0)
+	mCurrentUsers.Set(0)
+
+	gauges := func() (float64, float64) {
+		connections, _ := metrics.Lookup("websocket.current_connections")
+		users, _ := metrics.Lookup("websocket.current_users")
+		return connections, users
+	}
+
+	a.True(connected("user01"))
+	a.False(connected("user01"))
+	a.True(connected("user02"))
+	a.False(connected(""))
+	connections, users := gauges()
+	a.Equal(float64(4), connections)
+	a.Equal(float64(2), users)
+
+	a.False(disconnected("user01"))
+	a.False(disconnected(""))
+	connections, users = gauges()
+	a.Equal(float64(2), connections)
+	a.Equal(float64(2), users)
+
+	a.True(disconnected("user01"))
+	a.True(disconnected("user02"))
+	connections, users = gauges()
+	a.Equal(float64(0), connections)
+	a.Equal(float64(0), users)
+}
@@ -0,0 +1,7 @@
+package wns
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "wns")
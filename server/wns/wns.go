@@ -0,0 +1,114 @@
+package wns
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// schema is the default database schema for WNS
+	schema = "wns_registration"
+
+	channelURIKey = "channel_uri"
+	userIDKey     = "user_id"
+)
+
+// Config is used for configuring the Windows Notification Services component.
+type Config struct {
+	Enabled       *bool
+	ClientID      *string
+	ClientSecret  *string
+	TokenEndpoint *string
+	Type          *string
+	Timeout       *time.Duration
+	Workers       *int
+	Prefix        *string
+}
+
+// wns is the connector for Windows Notification Services.
+// A subscription is created by a POST request to `<prefix><user_id>/<topic>?channel_uri=<channel URI>`.
+type wns struct {
+	Config
+	connector.Connector
+}
+
+// New creates a new WNS connector and returns it as a connector.ResponsiveConnector
+func New(router router.Router, sender connector.Sender, config Config) (connector.ResponsiveConnector, error) {
+	baseConn, err := connector.NewConnector(router, sender, connector.Config{
+		Name:        "wns",
+		Schema:      schema,
+		Prefix:      *config.Prefix,
+		URLPattern:  fmt.Sprintf("/{%s}/{%s:.*}", userIDKey, connector.TopicParam),
+		QueryParams: true,
+		Workers:     *config.Workers,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Base connector error")
+		return nil, err
+	}
+
+	w := &wns{config, baseConn}
+	w.SetResponseHandler(w)
+	return w, nil
+}
+
+func (w *wns) Start() error {
+	err := w.Connector.Start()
+	if err == nil {
+		mTotalSentMessages.Set(0)
+		mTotalSendErrors.Set(0)
+		mTotalResponseErrors.Set(0)
+		mTotalResponseInternalErrors.Set(0)
+		mTotalResponseExpiredChannelErrors.Set(0)
+		mTotalResponseOtherErrors.Set(0)
+	}
+	return err
+}
+
+func (w *wns) HandleResponse(request connector.Request, responseIface interface{}, metadata *connector.Metadata, err error) error {
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("Error sending message to WNS")
+		mTotalSendErrors.Add(1)
+		return err
+	}
+	message := request.Message()
+	subscriber := request.Subscriber()
+
+	response, ok := responseIface.(*Response)
+	if !ok {
+		mTotalResponseErrors.Add(1)
+		return fmt.Errorf("Invalid WNS Response")
+	}
+
+	if response.ChannelExpired() {
+		logger.WithField("channelURI", subscriber.Route().Get(channelURIKey)).Info("Removing WNS subscription with expired channel URI")
+		mTotalResponseExpiredChannelErrors.Add(1)
+		return w.Manager().Remove(subscriber)
+	}
+
+	subscriber.SetLastID(message.ID)
+	if err := w.Manager().Update(subscriber); err != nil {
+		logger.WithField("error", err.Error()).Error("Manager could not update subscription")
+		mTotalResponseInternalErrors.Add(1)
+		return err
+	}
+
+	if !response.Ok() {
+		logger.WithFields(log.Fields{
+			"statusCode":       response.StatusCode,
+			"errorDescription": response.ErrorDescription,
+			"messageID":        message.ID,
+		}).Error("Unexpected response from WNS")
+		mTotalResponseOtherErrors.Add(1)
+		return nil
+	}
+
+	logger.WithField("messageID", message.ID).Debug("Delivered message to WNS")
+	mTotalSentMessages.Add(1)
+	return nil
+}
@@ -0,0 +1,16 @@
+package wns
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                                 = metrics.NS("wns")
+	mTotalSentMessages                 = ns.NewInt("total_sent_messages")
+	mTotalSendErrors                   = ns.NewInt("total_sent_message_errors")
+	mTotalResponseErrors               = ns.NewInt("total_response_errors")
+	mTotalResponseInternalErrors       = ns.NewInt("total_response_internal_errors")
+	mTotalResponseExpiredChannelErrors = ns.NewInt("total_response_expired_channel_errors")
+	mTotalResponseOtherErrors          = ns.NewInt("total_response_other_errors")
+	mTotalTokenRequests                = ns.NewInt("total_token_requests")
+)
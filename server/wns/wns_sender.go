@@ -0,0 +1,130 @@
+package wns
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/oauth"
+)
+
+const (
+	// DefaultTokenEndpoint is the OAuth endpoint issuing the access tokens for WNS
+	DefaultTokenEndpoint = "https://login.live.com/accesstoken.srf"
+
+	tokenScope = "notify.windows.com"
+
+	// Notification types, as given in the X-WNS-Type header
+	TypeToast = "wns/toast"
+	TypeTile  = "wns/tile"
+	TypeBadge = "wns/badge"
+	TypeRaw   = "wns/raw"
+
+	// typeHeaderKey is the key in the JSON header of a guble message setting its notification type
+	typeHeaderKey = "wns_type"
+)
+
+// Response is the result of sending a notification to a channel URI.
+type Response struct {
+	StatusCode         int
+	NotificationStatus string
+	ErrorDescription   string
+}
+
+// Ok returns true if the notification was accepted by WNS.
+func (r *Response) Ok() bool {
+	return r.StatusCode == http.StatusOK
+}
+
+// ChannelExpired returns true if the channel URI of the subscription is not valid anymore.
+func (r *Response) ChannelExpired() bool {
+	return r.StatusCode == http.StatusNotFound || r.StatusCode == http.StatusGone
+}
+
+type sender struct {
+	client      *http.Client
+	tokens      *oauth.TokenSource
+	defaultType string
+}
+
+// NewSender returns a connector.Sender for WNS, authenticating with the given package credentials.
+func NewSender(tokenEndpoint, clientID, clientSecret, defaultType string, timeout time.Duration) *sender {
+	client := &http.Client{Timeout: timeout}
+	return &sender{
+		client:      client,
+		tokens:      oauth.NewTokenSource(tokenEndpoint, clientID, clientSecret, tokenScope, client),
+		defaultType: defaultType,
+	}
+}
+
+// Send sends the message to the channel URI of the subscriber, and returns a *Response.
+func (s *sender) Send(request connector.Request) (interface{}, error) {
+	channelURI := request.Subscriber().Route().Get(channelURIKey)
+	message := request.Message()
+
+	response, token, err := s.send(channelURI, message)
+	if err == nil && response.StatusCode == http.StatusUnauthorized {
+		// the token expired or was revoked: retry once with a new one
+		s.tokens.Invalidate(token)
+		response, _, err = s.send(channelURI, message)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(log.Fields{
+		"statusCode":         response.StatusCode,
+		"notificationStatus": response.NotificationStatus,
+	}).Debug("Sent message to WNS")
+	return response, nil
+}
+
+func (s *sender) send(channelURI string, message *protocol.Message) (*Response, string, error) {
+	token, err := s.tokens.Token()
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, channelURI, bytes.NewReader(message.Body))
+	if err != nil {
+		return nil, token, err
+	}
+	wnsType := s.notificationType(message)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-WNS-Type", wnsType)
+	if wnsType == TypeRaw {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	} else {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, token, err
+	}
+	resp.Body.Close()
+
+	return &Response{
+		StatusCode:         resp.StatusCode,
+		NotificationStatus: resp.Header.Get("X-WNS-Status"),
+		ErrorDescription:   resp.Header.Get("X-WNS-Error-Description"),
+	}, token, nil
+}
+
+// notificationType returns the type given in the header of the message, or else the default type.
+func (s *sender) notificationType(message *protocol.Message) string {
+	if message.HeaderJSON != "" {
+		header := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(message.HeaderJSON), &header); err == nil {
+			if t, ok := header[typeHeaderKey].(string); ok && t != "" {
+				return t
+			}
+		}
+	}
+	return s.defaultType
+}
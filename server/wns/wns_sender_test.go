@@ -0,0 +1,115 @@
+package wns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/router"
+)
+
+// testServer serves both the token endpoint (at /token) and the channel URIs (at /channel/...)
+type testServer struct {
+	*httptest.Server
+	tokenRequests int
+	channelStatus int
+	lastRequest   *http.Request
+	lastBody      string
+}
+
+func newTestServer(a *assert.Assertions) *testServer {
+	ts := &testServer{channelStatus: http.StatusOK}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		a.NoError(req.ParseForm())
+		a.Equal("client_credentials", req.PostForm.Get("grant_type"))
+		a.Equal("ms-app://sid", req.PostForm.Get("client_id"))
+		a.Equal("secret", req.PostForm.Get("client_secret"))
+		a.Equal(tokenScope, req.PostForm.Get("scope"))
+		ts.tokenRequests++
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"bearer","expires_in":86400}`, ts.tokenRequests)
+	})
+	mux.HandleFunc("/channel/", func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		ts.lastRequest, ts.lastBody = req, string(body)
+		if req.Header.Get("Authorization") == "Bearer token1" && ts.channelStatus == http.StatusUnauthorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-WNS-Status", "received")
+		w.WriteHeader(ts.channelStatus)
+	})
+	ts.Server = httptest.NewServer(mux)
+	return ts
+}
+
+func newTestRequest(channelURI string, m *protocol.Message) connector.Request {
+	s := connector.NewSubscriber(m.Path, router.RouteParams{channelURIKey: channelURI, userIDKey: "user01"}, 0)
+	return connector.NewRequest(s, m)
+}
+
+func TestSender_Send(t *testing.T) {
+	a := assert.New(t)
+	server := newTestServer(a)
+	defer server.Close()
+
+	s := NewSender(server.URL+"/token", "ms-app://sid", "secret", TypeToast, time.Second)
+
+	response, err := s.Send(newTestRequest(server.URL+"/channel/1", &protocol.Message{
+		ID:   1,
+		Path: "/topic",
+		Body: []byte("<toast/>"),
+	}))
+	a.NoError(err)
+	a.Equal(&Response{StatusCode: http.StatusOK, NotificationStatus: "received"}, response)
+	a.Equal("Bearer token1", server.lastRequest.Header.Get("Authorization"))
+	a.Equal(TypeToast, server.lastRequest.Header.Get("X-WNS-Type"))
+	a.Equal("text/xml", server.lastRequest.Header.Get("Content-Type"))
+	a.Equal("<toast/>", server.lastBody)
+
+	// the type can be set in the message header, and the token is reused
+	_, err = s.Send(newTestRequest(server.URL+"/channel/1", &protocol.Message{
+		ID:         2,
+		Path:       "/topic",
+		HeaderJSON: `{"wns_type":"wns/raw"}`,
+		Body:       []byte("raw data"),
+	}))
+	a.NoError(err)
+	a.Equal(TypeRaw, server.lastRequest.Header.Get("X-WNS-Type"))
+	a.Equal("application/octet-stream", server.lastRequest.Header.Get("Content-Type"))
+	a.Equal(1, server.tokenRequests)
+}
+
+func TestSender_SendRenewsRejectedToken(t *testing.T) {
+	a := assert.New(t)
+	server := newTestServer(a)
+	defer server.Close()
+	server.channelStatus = http.StatusUnauthorized
+
+	s := NewSender(server.URL+"/token", "ms-app://sid", "secret", TypeToast, time.Second)
+	response, err := s.Send(newTestRequest(server.URL+"/channel/1", &protocol.Message{ID: 1, Path: "/topic"}))
+	a.NoError(err)
+	a.Equal(http.StatusUnauthorized, response.(*Response).StatusCode)
+	a.Equal(2, server.tokenRequests)
+	a.Equal("Bearer token2", server.lastRequest.Header.Get("Authorization"))
+}
+
+func TestSender_SendTokenError(t *testing.T) {
+	a := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_client"}`)
+	}))
+	defer server.Close()
+
+	s := NewSender(server.URL, "ms-app://sid", "wrong", TypeToast, time.Second)
+	_, err := s.Send(newTestRequest(server.URL+"/channel/1", &protocol.Message{ID: 1, Path: "/topic"}))
+	a.EqualError(err, "could not get access token (status code 400): invalid_client")
+}
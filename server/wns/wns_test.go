@@ -0,0 +1,92 @@
+package wns
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+func testWNS(t *testing.T) (*wns, *MockRouter) {
+	enabled := true
+	clientID := "ms-app://sid"
+	clientSecret := "secret"
+	tokenEndpoint := DefaultTokenEndpoint
+	wnsType := TypeToast
+	timeout := time.Second
+	workers := 1
+	prefix := "/wns/"
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().KVStore().Return(kvstore.NewMemoryKVStore(), nil).AnyTimes()
+
+	conn, err := New(routerMock, NewSender(tokenEndpoint, clientID, clientSecret, wnsType, timeout), Config{
+		Enabled:       &enabled,
+		ClientID:      &clientID,
+		ClientSecret:  &clientSecret,
+		TokenEndpoint: &tokenEndpoint,
+		Type:          &wnsType,
+		Timeout:       &timeout,
+		Workers:       &workers,
+		Prefix:        &prefix,
+	})
+	assert.NoError(t, err)
+	return conn.(*wns), routerMock
+}
+
+func TestWNS_PostSubscription(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	w, routerMock := testWNS(t)
+	a.NoError(w.Start())
+	defer w.Stop()
+
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/topic"), r.Path)
+		a.Equal("user01", r.Get(userIDKey))
+		a.Equal("https://db5.notify.windows.com/?token=abc", r.Get(channelURIKey))
+	}).Return(nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost,
+		"/wns/user01/topic?channel_uri=https%3A%2F%2Fdb5.notify.windows.com%2F%3Ftoken%3Dabc", strings.NewReader(""))
+	a.NoError(err)
+	w.ServeHTTP(recorder, req)
+	a.Equal(`{"subscribed":"/topic"}`, recorder.Body.String())
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestWNS_HandleResponse(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	w, _ := testWNS(t)
+	subscriber, err := w.Manager().Create("/topic", router.RouteParams{channelURIKey: "https://channel", userIDKey: "user01"})
+	a.NoError(err)
+
+	request := connector.NewRequest(subscriber, &protocol.Message{ID: 5, Path: "/topic"})
+	a.NoError(w.HandleResponse(request, &Response{StatusCode: http.StatusOK}, nil, nil))
+	data, err := subscriber.Encode()
+	a.NoError(err)
+	a.Contains(string(data), `"LastID":5`)
+
+	a.Error(w.HandleResponse(request, "invalid", nil, nil))
+	a.Len(w.Manager().List(), 1)
+
+	// expired channel URIs are removed
+	a.NoError(w.HandleResponse(request, &Response{StatusCode: http.StatusGone}, nil, nil))
+	a.Len(w.Manager().List(), 0)
+}
@@ -0,0 +1,166 @@
+package xmpp
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	nsComponent = "jabber:component:accept"
+	nsStream    = "http://etherx.jabber.org/streams"
+
+	dialTimeout = 10 * time.Second
+)
+
+var (
+	ErrHandshakeFailed = errors.New("XMPP component handshake failed")
+)
+
+// Message is an XMPP message stanza.
+type Message struct {
+	XMLName xml.Name `xml:"jabber:component:accept message"`
+	From    string   `xml:"from,attr,omitempty"`
+	To      string   `xml:"to,attr"`
+	ID      string   `xml:"id,attr,omitempty"`
+	Type    string   `xml:"type,attr,omitempty"`
+	Body    string   `xml:"body,omitempty"`
+}
+
+// Conn is the stream of an external component connected to the XMPP server.
+type Conn interface {
+	Send(*Message) error
+	// Receive blocks until the next message stanza addressed to the component is received; other stanzas are ignored.
+	Receive() (*Message, error)
+	Close() error
+}
+
+// Dialer returns a new authenticated component stream.
+type Dialer func(config Config) (Conn, error)
+
+type component struct {
+	conn    net.Conn
+	decoder *xml.Decoder
+
+	mu sync.Mutex
+}
+
+// Dial connects to the component port of the XMPP server, and authenticates as described in XEP-0114.
+func Dial(config Config) (Conn, error) {
+	conn, err := net.DialTimeout("tcp", *config.Addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &component{
+		conn:    conn,
+		decoder: xml.NewDecoder(conn),
+	}
+	if err := c.handshake(*config.Domain, *config.Secret); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *component) handshake(domain, secret string) error {
+	_, err := fmt.Fprintf(c.conn, "<?xml version='1.0'?><stream:stream xmlns='%s' xmlns:stream='%s' to='%s'>",
+		nsComponent, nsStream, xmlEscape(domain))
+	if err != nil {
+		return err
+	}
+
+	start, err := c.nextStart()
+	if err != nil {
+		return err
+	}
+	if start.Name.Space != nsStream || start.Name.Local != "stream" {
+		return fmt.Errorf("unexpected XMPP stream element <%s>", start.Name.Local)
+	}
+	var streamID string
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "id" {
+			streamID = attr.Value
+		}
+	}
+
+	digest := sha1.Sum([]byte(streamID + secret))
+	if _, err := fmt.Fprintf(c.conn, "<handshake>%s</handshake>", hex.EncodeToString(digest[:])); err != nil {
+		return err
+	}
+
+	start, err = c.nextStart()
+	if err != nil {
+		return err
+	}
+	if start.Name.Local != "handshake" {
+		return ErrHandshakeFailed
+	}
+	return c.decoder.Skip()
+}
+
+func (c *component) Send(m *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return xml.NewEncoder(c.conn).Encode(m)
+}
+
+func (c *component) Receive() (*Message, error) {
+	for {
+		start, err := c.nextStart()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case start.Name.Local == "message":
+			m := &Message{}
+			if err := c.decoder.DecodeElement(m, &start); err != nil {
+				return nil, err
+			}
+			return m, nil
+		case start.Name.Space == nsStream && start.Name.Local == "error":
+			return nil, errors.New("XMPP stream error")
+		default:
+			if err := c.decoder.Skip(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (c *component) Close() error {
+	c.mu.Lock()
+	io.WriteString(c.conn, "</stream:stream>")
+	c.mu.Unlock()
+	return c.conn.Close()
+}
+
+// nextStart returns the next start element of the stream.
+func (c *component) nextStart() (xml.StartElement, error) {
+	for {
+		token, err := c.decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			if t.Name.Space == nsStream && t.Name.Local == "stream" {
+				return xml.StartElement{}, io.EOF
+			}
+		}
+	}
+}
+
+func xmlEscape(s string) string {
+	buff := &bytes.Buffer{}
+	xml.EscapeText(buff, []byte(s))
+	return buff.String()
+}
@@ -0,0 +1,100 @@
+package xmpp
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveComponent accepts one component connection, as an XMPP server would.
+func serveComponent(a *assert.Assertions, l net.Listener, secret string, received chan<- *Message) {
+	conn, err := l.Accept()
+	if !a.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	decoder := xml.NewDecoder(conn)
+
+	start := nextStart(a, decoder)
+	a.Equal("stream", start.Name.Local)
+	fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream xmlns:stream='%s' xmlns='%s' from='guble.localhost' id='3BF96D32'>",
+		nsStream, nsComponent)
+
+	var handshake string
+	start = nextStart(a, decoder)
+	a.NoError(decoder.DecodeElement(&handshake, &start))
+	digest := sha1.Sum([]byte("3BF96D32" + secret))
+	if handshake != hex.EncodeToString(digest[:]) {
+		fmt.Fprintf(conn, "<stream:error><not-authorized xmlns='urn:ietf:params:xml:ns:xmpp-streams'/></stream:error></stream:stream>")
+		return
+	}
+	fmt.Fprint(conn, "<handshake/>")
+
+	fmt.Fprint(conn, "<presence from='user@localhost/phone' to='foo@guble.localhost'/>")
+	fmt.Fprint(conn, "<message from='user@localhost/phone' to='foo.bar@guble.localhost' type='chat'><body>hello &amp; welcome</body></message>")
+
+	m := &Message{}
+	start = nextStart(a, decoder)
+	a.NoError(decoder.DecodeElement(m, &start))
+	received <- m
+}
+
+func nextStart(a *assert.Assertions, decoder *xml.Decoder) xml.StartElement {
+	for {
+		token, err := decoder.Token()
+		if !a.NoError(err) {
+			return xml.StartElement{}
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start
+		}
+	}
+}
+
+func testComponentConfig(addr, secret string) Config {
+	domain := "guble.localhost"
+	return Config{Addr: &addr, Domain: &domain, Secret: &secret}
+}
+
+func TestComponent_SendAndReceive(t *testing.T) {
+	a := assert.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+	defer l.Close()
+
+	received := make(chan *Message, 1)
+	go serveComponent(a, l, "secret", received)
+
+	conn, err := Dial(testComponentConfig(l.Addr().String(), "secret"))
+	a.NoError(err)
+	defer conn.Close()
+
+	m, err := conn.Receive()
+	a.NoError(err)
+	a.Equal("user@localhost/phone", m.From)
+	a.Equal("foo.bar@guble.localhost", m.To)
+	a.Equal("hello & welcome", m.Body)
+
+	a.NoError(conn.Send(&Message{From: "foo@guble.localhost", To: "user@localhost", Type: "chat", Body: "<hi>"}))
+	sent := <-received
+	a.Equal("foo@guble.localhost", sent.From)
+	a.Equal("user@localhost", sent.To)
+	a.Equal("<hi>", sent.Body)
+}
+
+func TestComponent_HandshakeFailed(t *testing.T) {
+	a := assert.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+	defer l.Close()
+
+	go serveComponent(a, l, "secret", nil)
+
+	_, err = Dial(testComponentConfig(l.Addr().String(), "wrong"))
+	a.Equal(ErrHandshakeFailed, err)
+}
@@ -0,0 +1,7 @@
+package xmpp
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+var logger = log.WithField("module", "xmpp")
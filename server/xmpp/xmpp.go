@@ -0,0 +1,287 @@
+package xmpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/jpillora/backoff"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/router"
+)
+
+const (
+	// schema is the default database schema for XMPP
+	schema = "xmpp_registration"
+
+	jidKey = "jid"
+)
+
+var (
+	ErrNotConnected = errors.New("XMPP component is not connected")
+)
+
+// Config is used for configuring the XMPP gateway.
+type Config struct {
+	Enabled *bool
+
+	// Addr is the address of the component port of the XMPP server.
+	Addr   *string
+	Domain *string
+	Secret *string
+
+	// TopicPrefix is prepended to the topic of the messages sent by XMPP users.
+	TopicPrefix *string
+
+	Workers *int
+	Prefix  *string
+}
+
+// gateway is an XMPP component (XEP-0114) delivering guble messages to the subscribed JIDs;
+// a subscription is created by a POST request to `<prefix><jid>/<topic>`.
+// The topics are mapped to the JIDs of the component domain, with `.` as separator (e.g. `/foo/bar` is `foo.bar@<domain>`),
+// so that a message sent by an XMPP user to such a JID is published on its topic.
+type gateway struct {
+	Config
+	connector.Connector
+
+	router router.Router
+	dial   Dialer
+
+	mu   sync.RWMutex
+	conn Conn
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// New creates a new XMPP gateway and returns it as a connector.ResponsiveConnector
+func New(router router.Router, dial Dialer, config Config) (connector.ResponsiveConnector, error) {
+	g := &gateway{
+		Config: config,
+		router: router,
+		dial:   dial,
+	}
+	baseConn, err := connector.NewConnector(router, g, connector.Config{
+		Name:       "xmpp",
+		Schema:     schema,
+		Prefix:     *config.Prefix,
+		URLPattern: fmt.Sprintf("/{%s}/{%s:.*}", jidKey, connector.TopicParam),
+		Workers:    *config.Workers,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Base connector error")
+		return nil, err
+	}
+	g.Connector = baseConn
+	g.SetResponseHandler(g)
+	return g, nil
+}
+
+func (g *gateway) Start() error {
+	resetXMPPMetrics()
+
+	conn, err := g.dial(g.Config)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("Could not connect to XMPP server")
+		return err
+	}
+	g.setConn(conn)
+
+	g.ctx, g.cancelFunc = context.WithCancel(context.Background())
+	if err := g.Connector.Start(); err != nil {
+		g.cancelFunc()
+		return err
+	}
+	g.wg.Add(1)
+	go g.receive()
+	return nil
+}
+
+func (g *gateway) Stop() error {
+	g.cancelFunc()
+	err := g.Connector.Stop()
+	if conn := g.setConn(nil); conn != nil {
+		conn.Close()
+	}
+	g.wg.Wait()
+	return err
+}
+
+// Send sends the guble message to the JID of the subscriber, from the JID of its topic.
+func (g *gateway) Send(request connector.Request) (interface{}, error) {
+	message := request.Message()
+	jid := request.Subscriber().Route().Get(jidKey)
+	if message.UserID == jid {
+		// the message was sent by this user, through XMPP
+		return nil, nil
+	}
+
+	conn := g.getConn()
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+	return nil, conn.Send(&Message{
+		From: g.topicJID(message.Path),
+		To:   jid,
+		ID:   strconv.FormatUint(message.ID, 10),
+		Type: "chat",
+		Body: string(message.Body),
+	})
+}
+
+func (g *gateway) HandleResponse(request connector.Request, response interface{}, metadata *connector.Metadata, err error) error {
+	message := request.Message()
+	subscriber := request.Subscriber()
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"error":     err.Error(),
+			"jid":       subscriber.Route().Get(jidKey),
+			"messageID": message.ID,
+		}).Error("Error sending message to XMPP")
+		mTotalSendErrors.Add(1)
+		return err
+	}
+
+	subscriber.SetLastID(message.ID)
+	if err := g.Manager().Update(subscriber); err != nil {
+		logger.WithField("error", err.Error()).Error("Manager could not update subscription")
+		return err
+	}
+	logger.WithField("messageID", message.ID).Debug("Delivered message to XMPP")
+	mTotalSentMessages.Add(1)
+	return nil
+}
+
+// receive publishes in guble the messages sent to the component, reconnecting when needed.
+func (g *gateway) receive() {
+	defer g.wg.Done()
+	bo := &backoff.Backoff{Min: 100 * time.Millisecond, Max: 30 * time.Second, Factor: 2}
+
+	for {
+		conn := g.getConn()
+		if conn != nil {
+			for {
+				m, err := conn.Receive()
+				if err != nil {
+					if g.ctx.Err() == nil {
+						logger.WithField("error", err.Error()).Error("XMPP stream closed")
+					}
+					break
+				}
+				bo.Reset()
+				g.publish(m)
+			}
+		}
+		if g.ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-time.After(bo.Duration()):
+		case <-g.ctx.Done():
+			return
+		}
+		if err := g.reconnect(conn); err != nil {
+			logger.WithField("error", err.Error()).Error("Could not reconnect to XMPP server")
+		}
+	}
+}
+
+func (g *gateway) publish(m *Message) {
+	if m.Type == "error" || m.Body == "" {
+		return
+	}
+	path, ok := g.jidTopic(m.To)
+	if !ok {
+		logger.WithField("to", m.To).Info("Ignoring XMPP message not addressed to a topic")
+		return
+	}
+
+	err := g.router.HandleMessage(&protocol.Message{
+		Path:   path,
+		UserID: bareJID(m.From),
+		Body:   []byte(m.Body),
+	})
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"error": err.Error(),
+			"from":  m.From,
+			"to":    m.To,
+		}).Error("Could not handle message from XMPP")
+		mTotalReceiveErrors.Add(1)
+		return
+	}
+	mTotalReceivedMessages.Add(1)
+}
+
+// reconnect replaces the old stream with a new one, unless this has already been done concurrently.
+func (g *gateway) reconnect(old Conn) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ctx.Err() != nil {
+		return ErrNotConnected
+	}
+	if g.conn != old && g.conn != nil {
+		return nil
+	}
+	if old != nil {
+		old.Close()
+	}
+	g.conn = nil
+
+	mTotalReconnects.Add(1)
+	conn, err := g.dial(g.Config)
+	if err != nil {
+		return err
+	}
+	g.conn = conn
+	return nil
+}
+
+func (g *gateway) getConn() Conn {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.conn
+}
+
+// setConn replaces the current stream, returning the previous one.
+func (g *gateway) setConn(conn Conn) Conn {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	old := g.conn
+	g.conn = conn
+	return old
+}
+
+// topicJID returns the JID of the component representing a topic, e.g. `foo.bar@<domain>` for `<topic prefix>/foo/bar`.
+func (g *gateway) topicJID(path protocol.Path) string {
+	p := strings.TrimPrefix(string(path), strings.TrimSuffix(*g.TopicPrefix, "/"))
+	return strings.Replace(strings.Trim(p, "/"), "/", ".", -1) + "@" + *g.Domain
+}
+
+// jidTopic returns the topic represented by a JID of the component.
+func (g *gateway) jidTopic(jid string) (protocol.Path, bool) {
+	jid = bareJID(jid)
+	i := strings.Index(jid, "@")
+	if i <= 0 || jid[i+1:] != *g.Domain {
+		return "", false
+	}
+	return protocol.Path(strings.TrimSuffix(*g.TopicPrefix, "/") + "/" + strings.Replace(jid[:i], ".", "/", -1)), true
+}
+
+// bareJID returns the JID without its resource.
+func bareJID(jid string) string {
+	if i := strings.Index(jid, "/"); i >= 0 {
+		return jid[:i]
+	}
+	return jid
+}
@@ -0,0 +1,22 @@
+package xmpp
+
+import (
+	"github.com/smancke/guble/server/metrics"
+)
+
+var (
+	ns                     = metrics.NS("xmpp")
+	mTotalSentMessages     = ns.NewInt("total_sent_messages")
+	mTotalSendErrors       = ns.NewInt("total_sent_message_errors")
+	mTotalReceivedMessages = ns.NewInt("total_received_messages")
+	mTotalReceiveErrors    = ns.NewInt("total_receive_errors")
+	mTotalReconnects       = ns.NewInt("total_reconnects")
+)
+
+func resetXMPPMetrics() {
+	mTotalSentMessages.Set(0)
+	mTotalSendErrors.Set(0)
+	mTotalReceivedMessages.Set(0)
+	mTotalReceiveErrors.Set(0)
+	mTotalReconnects.Set(0)
+}
@@ -0,0 +1,169 @@
+package xmpp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smancke/guble/protocol"
+	"github.com/smancke/guble/server/connector"
+	"github.com/smancke/guble/server/kvstore"
+	"github.com/smancke/guble/server/router"
+	"github.com/smancke/guble/testutil"
+)
+
+type fakeConn struct {
+	receiveC chan *Message
+	sentC    chan *Message
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		receiveC: make(chan *Message, 10),
+		sentC:    make(chan *Message, 10),
+	}
+}
+
+func (c *fakeConn) Send(m *Message) error {
+	c.sentC <- m
+	return nil
+}
+
+func (c *fakeConn) Receive() (*Message, error) {
+	m, ok := <-c.receiveC
+	if !ok {
+		return nil, io.EOF
+	}
+	return m, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func testGateway(t *testing.T, conn Conn) (*gateway, *MockRouter) {
+	enabled := true
+	addr := "localhost:5347"
+	domain := "guble.localhost"
+	secret := "secret"
+	topicPrefix := "/chat"
+	workers := 1
+	prefix := "/xmpp/"
+
+	routerMock := NewMockRouter(testutil.MockCtrl)
+	routerMock.EXPECT().KVStore().Return(kvstore.NewMemoryKVStore(), nil).AnyTimes()
+
+	dial := func(Config) (Conn, error) { return conn, nil }
+	g, err := New(routerMock, dial, Config{
+		Enabled:     &enabled,
+		Addr:        &addr,
+		Domain:      &domain,
+		Secret:      &secret,
+		TopicPrefix: &topicPrefix,
+		Workers:     &workers,
+		Prefix:      &prefix,
+	})
+	assert.NoError(t, err)
+	return g.(*gateway), routerMock
+}
+
+func TestGateway_PostSubscription(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn := newFakeConn()
+	g, routerMock := testGateway(t, conn)
+	a.NoError(g.Start())
+	defer func() {
+		close(conn.receiveC)
+		g.Stop()
+	}()
+
+	routerMock.EXPECT().Subscribe(gomock.Any()).Do(func(r *router.Route) {
+		a.Equal(protocol.Path("/chat/foo"), r.Path)
+		a.Equal("user@localhost", r.Get(jidKey))
+	}).Return(nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/xmpp/user@localhost/chat/foo", strings.NewReader(""))
+	a.NoError(err)
+	g.ServeHTTP(recorder, req)
+	a.Equal(`{"subscribed":"/chat/foo"}`, recorder.Body.String())
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestGateway_Send(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn := newFakeConn()
+	g, _ := testGateway(t, conn)
+	g.setConn(conn)
+
+	subscriber := connector.NewSubscriber("/chat/foo", router.RouteParams{jidKey: "user@localhost"}, 0)
+	_, err := g.Send(connector.NewRequest(subscriber, &protocol.Message{ID: 3, Path: "/chat/foo/bar", UserID: "other@localhost", Body: []byte("hello")}))
+	a.NoError(err)
+	a.Equal(&Message{From: "foo.bar@guble.localhost", To: "user@localhost", ID: "3", Type: "chat", Body: "hello"}, <-conn.sentC)
+
+	// the messages are not sent back to their sender
+	_, err = g.Send(connector.NewRequest(subscriber, &protocol.Message{ID: 4, Path: "/chat/foo", UserID: "user@localhost", Body: []byte("echo")}))
+	a.NoError(err)
+	a.Len(conn.sentC, 0)
+
+	g.setConn(nil)
+	_, err = g.Send(connector.NewRequest(subscriber, &protocol.Message{ID: 5, Path: "/chat/foo"}))
+	a.Equal(ErrNotConnected, err)
+}
+
+func TestGateway_Receive(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+
+	conn := newFakeConn()
+	g, routerMock := testGateway(t, conn)
+	a.NoError(g.Start())
+
+	done := make(chan bool)
+	routerMock.EXPECT().HandleMessage(gomock.Any()).Do(func(m *protocol.Message) {
+		a.Equal(protocol.Path("/chat/foo/bar"), m.Path)
+		a.Equal("user@localhost", m.UserID)
+		a.Equal("hello", string(m.Body))
+		close(done)
+	}).Return(nil)
+
+	conn.receiveC <- &Message{From: "user@localhost/phone", To: "other@elsewhere", Body: "ignored"}
+	conn.receiveC <- &Message{From: "user@localhost/phone", To: "foo.bar@guble.localhost", Type: "error", Body: "ignored"}
+	conn.receiveC <- &Message{From: "user@localhost/phone", To: "foo.bar@guble.localhost", Type: "chat", Body: "hello"}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("message was not published")
+	}
+
+	close(conn.receiveC)
+	a.NoError(g.Stop())
+}
+
+func TestGateway_TopicJID(t *testing.T) {
+	_, finish := testutil.NewMockCtrl(t)
+	defer finish()
+	a := assert.New(t)
+	g, _ := testGateway(t, nil)
+
+	a.Equal("foo.bar@guble.localhost", g.topicJID("/chat/foo/bar"))
+	path, ok := g.jidTopic("foo.bar@guble.localhost/resource")
+	a.True(ok)
+	a.Equal(protocol.Path("/chat/foo/bar"), path)
+
+	_, ok = g.jidTopic("guble.localhost")
+	a.False(ok)
+}